@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"math"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+type bakeResult struct {
+	Width  uint `json:"width"`
+	Height uint `json:"height"`
+	// SeamX and SeamY are the discontinuities across the vertical and
+	// horizontal seams when the heightmap is tiled, see seamError.
+	SeamX    float64 `json:"seam_x"`
+	SeamY    float64 `json:"seam_y"`
+	Seamless bool    `json:"seamless"`
+}
+
+// bakeCommand implements "shady bake", which renders the height written by a
+// shader to shady_fragDepth once and writes it as a heightmap along with a
+// normal map derived from it.
+func bakeCommand(args []string) error {
+	fs := flag.NewFlagSet("bake", flag.ContinueOnError)
+	sf := newShaderFlags(fs)
+	geometry := fs.String("g", "1024x1024", "The geometry of the baked textures in WIDTHxHEIGHT format")
+	heightFile := fs.String("height", "", "Write the heightmap to the specified file as a 16 bit grayscale image, or as raw values if the name ends in .npy")
+	heightRange := fs.String("height-range", "0:1", "The range of heights mapped from black to white in LOW:HIGH format")
+	normalFile := fs.String("normal", "", "Write the normal map to the specified file")
+	normalStrength := fs.Float64("normal-strength", 16, "The height in pixels of a difference in height of 1")
+	normalFormat := fs.String("normal-format", "opengl", "The orientation of the green channel of the normal map. Valid values are: opengl (Y+), directx (Y-)")
+	tolerance := fs.Float64("seam-tolerance", 2, "The seam error above which the heightmap is not considered to be seamless")
+	requireSeamless := fs.Bool("seamless", false, "Fail if the heightmap does not tile seamlessly")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	if *heightFile == "" && *normalFile == "" {
+		return errors.New("please specify an output with -height and/or -normal")
+	}
+	if *sf.env != "shadertoy" {
+		return errors.New("baking is only supported by the shadertoy environment")
+	}
+	if *normalFormat != "opengl" && *normalFormat != "directx" {
+		return fmt.Errorf("invalid normal format: %q (valid: opengl, directx)", *normalFormat)
+	}
+	low, high, err := parseDepthRange(*heightRange)
+	if err != nil {
+		return err
+	}
+
+	width, height, err := parseGeometry(*geometry)
+	if err != nil {
+		return err
+	}
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+	env, _, err := sf.newEnvironment()
+	if err != nil {
+		return err
+	}
+	env.(*shadertoy.ShaderToy).SetOutputs(renderer.OutputDepth)
+	sh, err := renderer.NewShader(width, height, openGLVersion)
+	if err != nil {
+		return err
+	}
+	defer sh.Close()
+	logToStderr(sh)
+	if err := sh.EnableOutputs(renderer.OutputDepth); err != nil {
+		return err
+	}
+	sh.SetEnvironment(env)
+	if err := sh.Load(context.Background()); err != nil {
+		return err
+	}
+	frame, err := sh.Image(context.Background(), time.Second/60)
+	if err != nil {
+		return err
+	}
+	heights := frame.(*renderer.LayeredImage).OutputImage(renderer.OutputDepth)
+
+	if *heightFile != "" {
+		var img image.Image = heights
+		if !isFloatFile(*heightFile) {
+			img = heights.Gray16(low, high)
+		}
+		if err := writeImage(*heightFile, img); err != nil {
+			return err
+		}
+	}
+	if *normalFile != "" {
+		// Heights are normalized to the range so the strength does not
+		// depend on it.
+		strength := float32(*normalStrength) / (high - low)
+		normalSh, err := renderer.NewShader(width, height, openGLVersion)
+		if err != nil {
+			return err
+		}
+		defer normalSh.Close()
+		logToStderr(normalSh)
+		normalSh.SetEnvironment(&normalEnvironment{
+			heights:  heights,
+			strength: strength,
+			flipY:    *normalFormat == "directx",
+		})
+		if err := normalSh.Load(context.Background()); err != nil {
+			return err
+		}
+		normals, err := normalSh.Image(context.Background(), time.Second/60)
+		if err != nil {
+			return err
+		}
+		if err := writeImage(*normalFile, normals); err != nil {
+			return err
+		}
+	}
+
+	res := bakeResult{Width: width, Height: height}
+	res.SeamX, res.SeamY = seamError(heights.Data, int(width), int(height))
+	res.Seamless = res.SeamX <= *tolerance && res.SeamY <= *tolerance
+	if *sf.json {
+		if err := printJSON(res); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Baked %dx%d, seam error: x=%.2f y=%.2f\n", res.Width, res.Height, res.SeamX, res.SeamY)
+	}
+	if *requireSeamless && !res.Seamless {
+		if !*sf.json {
+			fmt.Println("The heightmap does not tile seamlessly")
+		}
+		return errCommandFailed
+	}
+	return nil
+}
+
+func writeImage(filename string, img image.Image) error {
+	format, ok := encode.DetectFormat(filename)
+	if !ok {
+		return fmt.Errorf("unable to detect the output format from %q", filename)
+	}
+	w, err := openWriter(filename)
+	if err != nil {
+		return err
+	}
+	if err := format.Encode(w, img); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// seamError measures how well a heightmap tiles. The discontinuity across
+// the vertical seam, i.e. between the right and left edge, is returned as x
+// and across the horizontal seam as y.
+//
+// The discontinuity between two pixels is the difference between the step in
+// height from one to the other and the step predicted from the steps on either
+// side. The error is the mean discontinuity across the seam relative to the
+// mean discontinuity between the other pixels, so a value around 1 means that
+// the seam is indistinguishable from the rest of the image.
+func seamError(heights []float32, width, height int) (x, y float64) {
+	x = seamErrorAlong(width, height, func(i, line int) float64 {
+		return float64(heights[line*width+i])
+	})
+	y = seamErrorAlong(height, width, func(i, line int) float64 {
+		return float64(heights[i*width+line])
+	})
+	return x, y
+}
+
+// seamErrorAlong computes the seam error of a number of lines of n pixels.
+// The pixels are accessed through at, which wraps around the seam.
+func seamErrorAlong(n, lines int, at func(i, line int) float64) float64 {
+	if n < 4 {
+		return 0
+	}
+	step := func(i, line int) float64 {
+		return at((i+1)%n, line) - at(i%n, line)
+	}
+	discontinuity := func(i, line int) float64 {
+		return math.Abs(step(i+n, line) - (step(i+n-1, line)+step(i+n+1, line))/2)
+	}
+
+	var seam, interior float64
+	for line := 0; line < lines; line++ {
+		seam += discontinuity(n-1, line)
+		for i := 1; i < n-2; i++ {
+			interior += discontinuity(i, line)
+		}
+	}
+	seam /= float64(lines)
+	interior /= float64(lines * (n - 3))
+	// Perfectly smooth images, like a gradient, still have a finite error so
+	// it can be reported.
+	return seam / math.Max(interior, 1e-9)
+}
+
+// normalEnvironment derives a normal map from a heightmap. The heightmap is
+// wrapped around the edges, so the normal map tiles if the heightmap does.
+type normalEnvironment struct {
+	heights  *renderer.FloatImage
+	strength float32
+	flipY    bool
+	texture  uint32
+}
+
+func (env *normalEnvironment) Sources() (map[renderer.Stage][]renderer.Source, error) {
+	return map[renderer.Stage][]renderer.Source{
+		renderer.StageVertex: {renderer.SourceBuf(`
+			#version 330 core
+			in vec3 vert;
+			void main(void) {
+				gl_Position = vec4(vert, 1.0);
+			}
+		`)},
+		renderer.StageFragment: {renderer.SourceBuf(`
+			#version 330 core
+			uniform sampler2D heights;
+			uniform float strength;
+			uniform float flipY;
+			out vec4 color;
+
+			float height(ivec2 p) {
+				ivec2 size = textureSize(heights, 0);
+				return texelFetch(heights, (p + size) % size, 0).r;
+			}
+
+			void main(void) {
+				// Rows of the heightmap run downwards while the Y axis
+				// of the normal points up.
+				ivec2 p = ivec2(gl_FragCoord.xy);
+				float dx = height(p + ivec2(1, 0)) - height(p - ivec2(1, 0));
+				float dy = height(p - ivec2(0, 1)) - height(p + ivec2(0, 1));
+				vec3 n = normalize(vec3(-dx, -dy * flipY, 2.0 / strength));
+				color = vec4(n * 0.5 + 0.5, 1.0);
+			}
+		`)},
+	}, nil
+}
+
+func (env *normalEnvironment) Setup(state renderer.RenderState) error {
+	r := env.heights.Rect
+	gl.GenTextures(1, &env.texture)
+	gl.BindTexture(gl.TEXTURE_2D, env.texture)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R32F, int32(r.Dx()), int32(r.Dy()), 0, gl.RED, gl.FLOAT, gl.Ptr(env.heights.Data))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return nil
+}
+
+func (env *normalEnvironment) SubEnvironments() (map[string]renderer.SubEnvironment, error) {
+	return map[string]renderer.SubEnvironment{}, nil
+}
+
+func (env *normalEnvironment) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms["heights"]; ok {
+		gl.ActiveTexture(gl.TEXTURE0)
+		gl.BindTexture(gl.TEXTURE_2D, env.texture)
+		gl.Uniform1i(loc.Location, 0)
+	}
+	if loc, ok := state.Uniforms["strength"]; ok {
+		gl.Uniform1f(loc.Location, env.strength)
+	}
+	if loc, ok := state.Uniforms["flipY"]; ok {
+		flip := float32(1)
+		if env.flipY {
+			flip = -1
+		}
+		gl.Uniform1f(loc.Location, flip)
+	}
+}
+
+func (env *normalEnvironment) Close() error {
+	gl.DeleteTextures(1, &env.texture)
+	return nil
+}
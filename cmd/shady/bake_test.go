@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSeamError(t *testing.T) {
+	const size = 8
+	heights := func(f func(x, y int) float64) []float32 {
+		h := make([]float32, size*size)
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				h[y*size+x] = float32(f(x, y))
+			}
+		}
+		return h
+	}
+
+	// A sine wave with a whole number of periods tiles.
+	x, y := seamError(heights(func(x, y int) float64 {
+		return math.Sin(float64(x)/size*2*math.Pi) + math.Cos(float64(y)/size*4*math.Pi)
+	}), size, size)
+	if x > 2 || y > 2 {
+		t.Fatalf("unexpected seam error for a tiling pattern: x=%v y=%v", x, y)
+	}
+
+	// A ramp jumps back at the seam.
+	x, y = seamError(heights(func(x, y int) float64 {
+		return float64(x)
+	}), size, size)
+	if x < 1e6 || y != 0 {
+		t.Fatalf("unexpected seam error for a ramp: x=%v y=%v", x, y)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"sort"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type benchResult struct {
+	Width        uint    `json:"width"`
+	Height       uint    `json:"height"`
+	Frames       int     `json:"frames"`
+	TotalSeconds float64 `json:"total_seconds"`
+	FPS          float64 `json:"fps"`
+	FrameTimeMS  struct {
+		Mean float64 `json:"mean"`
+		Min  float64 `json:"min"`
+		Max  float64 `json:"max"`
+		P95  float64 `json:"p95"`
+	} `json:"frame_time_ms"`
+}
+
+// benchCommand implements "shady bench", which renders a number of frames as
+// fast as possible and reports the timings.
+func benchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	sf := newShaderFlags(fs)
+	geometry := fs.String("g", "512x512", "The geometry of the rendered image in WIDTHxHEIGHT format. If \"env\", look for the LEDCAT_GEOMETRY variable")
+	numFrames := fs.Int("n", 300, "The number of frames to render")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	if *numFrames <= 0 {
+		return fmt.Errorf("-n must be positive")
+	}
+
+	width, height, err := parseGeometry(*geometry)
+	if err != nil {
+		return err
+	}
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+	env, _, err := sf.newEnvironment()
+	if err != nil {
+		return err
+	}
+	sh, err := renderer.NewShader(width, height, openGLVersion)
+	if err != nil {
+		return err
+	}
+	defer sh.Close()
+	logToStderr(sh)
+	sh.SetEnvironment(env)
+	if err := sh.Load(context.Background()); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan image.Image)
+	frameTimes := make([]time.Duration, 0, *numFrames)
+	start := time.Now()
+	go func() {
+		defer cancel()
+		lastFrame := time.Now()
+		for range stream {
+			now := time.Now()
+			frameTimes = append(frameTimes, now.Sub(lastFrame))
+			lastFrame = now
+			if len(frameTimes) == *numFrames {
+				return
+			}
+		}
+	}()
+	sh.Animate(ctx, time.Second/60, stream)
+	total := time.Since(start)
+
+	res := benchResult{
+		Width:        width,
+		Height:       height,
+		Frames:       len(frameTimes),
+		TotalSeconds: total.Seconds(),
+		FPS:          float64(len(frameTimes)) / total.Seconds(),
+	}
+	sort.Slice(frameTimes, func(i, j int) bool { return frameTimes[i] < frameTimes[j] })
+	var sum time.Duration
+	for _, t := range frameTimes {
+		sum += t
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	res.FrameTimeMS.Mean = ms(sum) / float64(len(frameTimes))
+	res.FrameTimeMS.Min = ms(frameTimes[0])
+	res.FrameTimeMS.Max = ms(frameTimes[len(frameTimes)-1])
+	res.FrameTimeMS.P95 = ms(frameTimes[len(frameTimes)*95/100])
+
+	if *sf.json {
+		return printJSON(res)
+	}
+	fmt.Printf("Rendered %d frames at %dx%d in %.2fs\n", res.Frames, res.Width, res.Height, res.TotalSeconds)
+	fmt.Printf("fps=%.2f mean=%.2fms min=%.2fms max=%.2fms p95=%.2fms\n",
+		res.FPS, res.FrameTimeMS.Mean, res.FrameTimeMS.Min, res.FrameTimeMS.Max, res.FrameTimeMS.P95)
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// changeSettings holds the -skip-unchanged flags.
+type changeSettings struct {
+	skip      bool
+	threshold float64
+	region    string
+	keepalive time.Duration
+}
+
+func (c *changeSettings) flags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.skip, "skip-unchanged", false, "Skip frames that do not differ from the last frame that was written, e.g. to save bandwidth of streams and prevent flicker of LEDs for mostly static shaders")
+	fs.Float64Var(&c.threshold, "change-threshold", 1.0/255, "The largest difference of a color channel, from 0 to 1, at which -skip-unchanged considers a frame to be unchanged")
+	fs.StringVar(&c.region, "change-region", "", "Only compare this region of the frames for -skip-unchanged, as WxH+X+Y in pixels from the top left")
+	fs.DurationVar(&c.keepalive, "change-keepalive", 0, "Write a frame at least this often with -skip-unchanged, even if it is unchanged")
+}
+
+// configureChangeDetection adds a hook that drops unchanged frames if
+// -skip-unchanged is set. The returned detector should be closed after
+// animating, it is nil if the flag is not set. If realtime is not 0, frames
+// are rendered at that interval.
+func configureChangeDetection(engine *renderer.Shader, realtime time.Duration, settings changeSettings) (*renderer.ChangeDetector, error) {
+	if !settings.skip {
+		return nil, nil
+	}
+	if settings.threshold < 0 || settings.threshold > 1 {
+		return nil, fmt.Errorf("-change-threshold must be between 0 and 1")
+	}
+	detector := &renderer.ChangeDetector{
+		Threshold: float32(settings.threshold),
+		Keepalive: settings.keepalive,
+	}
+	if settings.region != "" {
+		region, err := parseRegion(settings.region)
+		if err != nil {
+			return nil, err
+		}
+		detector.Region = region
+	}
+	if realtime != 0 {
+		// The output paces rendering by blocking, which does not happen
+		// for dropped frames.
+		engine.AddFrameHook(limitFramerateHook(realtime))
+	}
+	engine.AddFrameHook(detector.Hook)
+	return detector, nil
+}
+
+// limitFramerateHook paces rendering like limitFramerate, for frames that do
+// not reach the output.
+func limitFramerateHook(interval time.Duration) renderer.FrameHook {
+	lastFrame := time.Now()
+	return func(*renderer.Frame) error {
+		time.Sleep(interval - time.Since(lastFrame))
+		lastFrame = time.Now()
+		return nil
+	}
+}
+
+var regionRe = regexp.MustCompile(`^(\d+)x(\d+)\+(\d+)\+(\d+)$`)
+
+// parseRegion parses a rectangle formatted as WxH+X+Y.
+func parseRegion(s string) (image.Rectangle, error) {
+	m := regionRe.FindStringSubmatch(s)
+	if m == nil {
+		return image.Rectangle{}, fmt.Errorf("invalid region: %q, expected WxH+X+Y", s)
+	}
+	var v [4]int
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	if v[0] == 0 || v[1] == 0 {
+		return image.Rectangle{}, fmt.Errorf("invalid region: %q, the size can not be 0", s)
+	}
+	return image.Rect(v[2], v[3], v[2]+v[0], v[3]+v[1]), nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestParseRegion(t *testing.T) {
+	r, err := parseRegion("32x16+4+8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := image.Rect(4, 8, 36, 24); r != exp {
+		t.Fatalf("expected %v, got %v", exp, r)
+	}
+	for _, s := range []string{"32x16", "0x16+0+0", "32x16+-1+0", ""} {
+		if _, err := parseRegion(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSampleRate is the rate at which audio inputs are captured for clocks.
+const clockSampleRate = 48000
+
+// An externalClock is a clock that frames are slaved to instead of the
+// system clock, so they stay in sync with other equipment.
+type externalClock interface {
+	// Now returns the time of the animation. ok is false if the time is not
+	// known yet, e.g. because no timecode was received.
+	Now() (t time.Duration, ok bool)
+	// Err returns why the clock stopped, or nil if it is running.
+	Err() error
+	Close() error
+}
+
+// openClock opens the clock set by -clock. It returns nil for the system
+// clock, which is used by limitFramerate.
+func openClock(source string, interval time.Duration, tc timecode) (externalClock, error) {
+	kind, device := source, ""
+	if i := strings.IndexByte(source, ':'); i >= 0 {
+		kind, device = source[:i], source[i+1:]
+	}
+	switch kind {
+	case "system":
+		if device != "" {
+			return nil, fmt.Errorf("the system clock does not take a device")
+		}
+		return nil, nil
+	case "audio", "ltc":
+		args, err := audioInputArgs(device)
+		if err != nil {
+			return nil, err
+		}
+		c := &audioClock{}
+		if kind == "ltc" {
+			c.ltc = newLTCDecoder(clockSampleRate, float64(time.Second)/float64(interval))
+			c.interval, c.tc = interval, tc
+		}
+		if err := c.start(args); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("invalid clock: %q (valid: system, audio[:DEVICE], ltc[:DEVICE])", source)
+}
+
+// audioInputArgs returns the arguments for ffmpeg to capture an audio input
+// device, or the default input if the device is empty.
+func audioInputArgs(device string) ([]string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		if device == "" {
+			device = "default"
+		}
+		return []string{"-f", "avfoundation", "-i", ":" + device}, nil
+	case "windows":
+		if device == "" {
+			return nil, fmt.Errorf("the name of the audio input must be specified on Windows")
+		}
+		return []string{"-f", "dshow", "-i", "audio=" + device}, nil
+	default:
+		if device == "" {
+			device = "default"
+		}
+		return []string{"-f", "pulse", "-i", device}, nil
+	}
+}
+
+// audioClock counts the samples captured from an audio input. Without LTC,
+// the time starts at 0 when it is first read. With LTC, it is the time of
+// the last timecode relative to the timecode of the first frame.
+type audioClock struct {
+	ltc      *ltcDecoder
+	interval time.Duration
+	tc       timecode
+
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+
+	lock    sync.Mutex
+	samples int64
+	// origin is the number of samples at the first call to Now.
+	origin  int64
+	started bool
+	// last is the time of the end of the last timecode and the sample at
+	// which it was received.
+	last       time.Duration
+	lastSample int64
+	hasLast    bool
+	err        error
+}
+
+func (c *audioClock) start(input []string) error {
+	args := append([]string{"-loglevel", "error"}, input...)
+	args = append(args,
+		"-f", "s16le",
+		"-acodec", "pcm_s16le",
+		"-ac", "1",
+		"-ar", strconv.Itoa(clockSampleRate),
+		"-",
+	)
+	c.cmd = exec.Command("ffmpeg", args...)
+	c.cmd.Stderr = &c.stderr
+	var err error
+	if c.stdout, err = c.cmd.StdoutPipe(); err != nil {
+		return err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return fmt.Errorf("could not start ffmpeg: %w", err)
+	}
+	go c.capture()
+	return nil
+}
+
+// capture reads samples until ffmpeg exits.
+func (c *audioClock) capture() {
+	// Read in chunks of about 5ms, which is the resolution of the clock.
+	buf := make([]byte, clockSampleRate/200*2)
+	samples := make([]int16, len(buf)/2)
+	for {
+		if _, err := io.ReadFull(c.stdout, buf); err != nil {
+			break
+		}
+		for i := range samples {
+			samples[i] = int16(binary.LittleEndian.Uint16(buf[i*2:]))
+		}
+		var frames []ltcFrame
+		if c.ltc != nil {
+			frames = c.ltc.decode(samples)
+		}
+		c.lock.Lock()
+		c.samples += int64(len(samples))
+		for _, f := range frames {
+			count, err := c.tc.parse(f.String())
+			if err != nil {
+				continue
+			}
+			c.last = time.Duration(int64(count)-int64(c.tc.start)+1) * c.interval
+			c.lastSample, c.hasLast = f.end, true
+		}
+		c.lock.Unlock()
+	}
+	err := c.cmd.Wait()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+		c.err = fmt.Errorf("ffmpeg: %s", msg)
+	} else if err != nil {
+		c.err = fmt.Errorf("ffmpeg: %w", err)
+	} else {
+		c.err = fmt.Errorf("the audio input stopped")
+	}
+}
+
+func (c *audioClock) Now() (time.Duration, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.ltc != nil {
+		if !c.hasLast {
+			return 0, false
+		}
+		return c.last + samplesDuration(c.samples-c.lastSample), true
+	}
+	if !c.started {
+		c.origin, c.started = c.samples, true
+	}
+	return samplesDuration(c.samples - c.origin), true
+}
+
+func (c *audioClock) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
+
+func (c *audioClock) Close() error {
+	c.cmd.Process.Kill()
+	c.stdout.Close()
+	return nil
+}
+
+func samplesDuration(n int64) time.Duration {
+	return time.Duration(n) * time.Second / clockSampleRate
+}
+
+// slaveFramerate passes frame n on when the clock reaches n times the
+// interval. Unlike limitFramerate, the delay of each frame does not add up,
+// so the output does not drift from the clock. Frames are passed on as soon
+// as possible if rendering falls behind.
+func slaveFramerate(ctx context.Context, in <-chan image.Image, interval time.Duration, clock externalClock) <-chan image.Image {
+	out := make(chan image.Image)
+	go func() {
+		defer close(out)
+		var frame time.Duration
+		var last time.Duration
+		for img := range in {
+			for ctx.Err() == nil {
+				if err := clock.Err(); err != nil {
+					log.Printf("The clock stopped, continuing with the system clock: %v", err)
+					clock = &systemClock{base: last, start: time.Now()}
+				}
+				now, ok := clock.Now()
+				wait := frame*interval - now
+				if ok && wait <= 0 {
+					last = now
+					break
+				}
+				if !ok || wait > 10*time.Millisecond {
+					// The clock may be too coarse or slow to wait for it
+					// exactly.
+					wait = 10 * time.Millisecond
+				}
+				time.Sleep(wait)
+			}
+			frame++
+			out <- img
+		}
+	}()
+	return out
+}
+
+// systemClock continues the time of an external clock that stopped.
+type systemClock struct {
+	base  time.Duration
+	start time.Time
+}
+
+func (c *systemClock) Now() (time.Duration, bool) {
+	return c.base + time.Since(c.start), true
+}
+
+func (c *systemClock) Err() error {
+	return nil
+}
+
+func (c *systemClock) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// errCommandFailed is returned by subcommands that have already reported
+// their failure and only need shady to exit with a non-zero status.
+var errCommandFailed = errors.New("command failed")
+
+// errUsage is returned by subcommands that were invoked with invalid
+// arguments after the usage was printed. shady then exits with status 2, like
+// it does for invalid flags.
+var errUsage = errors.New("invalid usage")
+
+// parseArgs parses the arguments of a subcommand. Parse errors are reported by
+// the flag set, so the returned error only determines the exit status.
+// flag.ErrHelp is returned as is if the usage was requested.
+func parseArgs(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && err != flag.ErrHelp {
+		return errUsage
+	}
+	return err
+}
+
+// shaderFlags are the flags shared by subcommands that load a shader.
+type shaderFlags struct {
+	inputFiles   arrayFlags
+	includePaths arrayFlags
+	mappings     arrayFlags
+	templateVars arrayFlags
+	templateFile *string
+	project      *string
+	env          *string
+	glslVersion  *string
+	openGL       *string
+	eglPlatform  *string
+	json         *bool
+
+	proj *project
+}
+
+func newShaderFlags(fs *flag.FlagSet) *shaderFlags {
+	sf := &shaderFlags{}
+	fs.Var(&sf.inputFiles, "i", "The shader file(s) to use")
+	fs.Var(&sf.includePaths, "I", "Add a directory to search for files included with #include")
+	fs.Var(&sf.mappings, "map", "Specify or override ShaderToy input mappings")
+	sf.templateFile = fs.String("template-data", "", "Preprocess the sources as Go templates with the data from the specified JSON file")
+	fs.Var(&sf.templateVars, "template-var", "Preprocess the sources as Go templates, setting a variable in the data as NAME=VALUE")
+	sf.project = fs.String("p", "", "Load inputs and default settings from a project file")
+	sf.env = fs.String("env", "shadertoy", "The shader environment to use")
+	sf.glslVersion = fs.String("glsl", "330", "The GLSL version to use")
+	sf.openGL = fs.String("opengl", "glsl", "The OpenGL version to use. If \"glsl\", the version is inferred from the requested GLSL version")
+	sf.eglPlatform = fs.String("egl-platform", "default", eglPlatformUsage)
+	sf.json = fs.Bool("json", false, "Print the result as JSON")
+	return sf
+}
+
+// load applies the project and config defaults to the flag set. It should be
+// called after the flags are parsed.
+func (sf *shaderFlags) load(fs *flag.FlagSet) error {
+	if *sf.project != "" {
+		proj, err := loadProject(*sf.project)
+		if err != nil {
+			return err
+		}
+		sf.proj = proj
+		if len(sf.inputFiles) == 0 {
+			sf.inputFiles = proj.inputFiles()
+		}
+		if err := proj.applyDefaults(fs); err != nil {
+			return err
+		}
+	}
+	if err := applyConfigDefaults(fs); err != nil {
+		return err
+	}
+	if err := selectPlatform(*sf.eglPlatform); err != nil {
+		return err
+	}
+	if len(sf.inputFiles) == 0 {
+		return errors.New("please specify at least one GLSL file with -i")
+	}
+	renderer.IncludePaths = sf.includePaths
+	return nil
+}
+
+func (sf *shaderFlags) openGLVersion() (renderer.OpenGLVersion, error) {
+	return resolveOpenGLVersion(*sf.openGL, *sf.glslVersion)
+}
+
+func (sf *shaderFlags) newEnvironment() (renderer.Environment, []string, error) {
+	templateData, err := loadTemplateData(sf.proj, *sf.templateFile, sf.templateVars)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newEnvironment(*sf.env, sf.inputFiles, sf.mappings, *sf.glslVersion, sf.proj, templateData)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
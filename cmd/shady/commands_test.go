@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestSubcommandArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  func(args []string) error
+		args []string
+		// err is the expected error, or a substring of its message if the
+		// error is not a sentinel.
+		err     error
+		message string
+	}{
+		{name: "validate unknown flag", cmd: validateCommand, args: []string{"-foo"}, err: errUsage},
+		{name: "validate help", cmd: validateCommand, args: []string{"-h"}, err: flag.ErrHelp},
+		{name: "validate no input", cmd: validateCommand, args: nil, message: "-i"},
+		{name: "validate watch no input", cmd: validateCommand, args: []string{"-w"}, message: "-i"},
+		{name: "validate missing project", cmd: validateCommand, args: []string{"-p", "missing.json"}, message: "missing.json"},
+		{name: "validate invalid platform", cmd: validateCommand, args: []string{"-egl-platform", "foo", "-i", "a.glsl"}, message: "foo"},
+		{name: "info unknown flag", cmd: infoCommand, args: []string{"-foo"}, err: errUsage},
+		{name: "info invalid opengl", cmd: infoCommand, args: []string{"-opengl", "foo"}, message: "foo"},
+		{name: "bench unknown flag", cmd: benchCommand, args: []string{"-n", "foo"}, err: errUsage},
+		{name: "bench no frames", cmd: benchCommand, args: []string{"-n", "0", "-i", "a.glsl"}, message: "-n"},
+		{name: "bench invalid geometry", cmd: benchCommand, args: []string{"-g", "0x0", "-i", "a.glsl"}, message: "geometry"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.cmd(test.args)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Errorf("unexpected error: exp %v, got %v", test.err, err)
+				}
+				return
+			}
+			if err == nil || errors.Is(err, errUsage) || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected an error containing %q, got %v", test.message, err)
+			}
+		})
+	}
+}
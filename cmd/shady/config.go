@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configSettings maps the names of settings that may appear in the config
+// file and environment to the flag they provide a default for.
+var configSettings = map[string]string{
+	"env":       "env",
+	"format":    "ofmt",
+	"framerate": "f",
+	"geometry":  "g",
+	"glsl":      "glsl",
+	"opengl":    "opengl",
+	"output":    "o",
+	"platform":  "egl-platform",
+}
+
+// configFile returns the path of the user's config file.
+func configFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "shady", "config"), nil
+}
+
+// applyConfigDefaults sets the flags which are not set explicitly to the
+// values from SHADY_* environment variables and the config file, in that
+// order of precedence.
+func applyConfigDefaults(flags *flag.FlagSet) error {
+	env := map[string]string{}
+	for name := range configSettings {
+		if v, ok := os.LookupEnv("SHADY_" + strings.ToUpper(name)); ok {
+			env[name] = v
+		}
+	}
+	if err := applySettings(flags, env, "environment"); err != nil {
+		return err
+	}
+
+	filename, err := configFile()
+	if err != nil {
+		return nil
+	}
+	fd, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer fd.Close()
+	config, err := parseConfig(fd)
+	if err != nil {
+		return fmt.Errorf("error in %s: %w", filename, err)
+	}
+	return applySettings(flags, config, filename)
+}
+
+func applySettings(flags *flag.FlagSet, settings map[string]string, origin string) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, value := range settings {
+		flagName, ok := configSettings[name]
+		if !ok {
+			return fmt.Errorf("unknown setting %q in %s", name, origin)
+		}
+		if set[flagName] || flags.Lookup(flagName) == nil {
+			continue
+		}
+		if err := flags.Set(flagName, value); err != nil {
+			return fmt.Errorf("invalid value for %s in %s: %w", name, origin, err)
+		}
+	}
+	return nil
+}
+
+// parseConfig parses a config file consisting of "name = value" lines.
+// Empty lines and lines starting with a '#' are ignored.
+func parseConfig(r io.Reader) (map[string]string, error) {
+	config := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"name = value\", got %q", lineno, line)
+		}
+		config[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return config, scanner.Err()
+}
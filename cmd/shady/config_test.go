@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig(strings.NewReader(`
+# Comment
+geometry = 64x32
+	opengl=3.3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config["geometry"] != "64x32" {
+		t.Errorf("unexpected geometry: %q", config["geometry"])
+	}
+	if config["opengl"] != "3.3" {
+		t.Errorf("unexpected opengl: %q", config["opengl"])
+	}
+
+	if _, err := parseConfig(strings.NewReader("geometry 64x32\n")); err == nil {
+		t.Errorf("expected an error for a line without '='")
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	geometry := fs.String("g", "env", "")
+	format := fs.String("ofmt", "x11", "")
+	fs.Parse([]string{"-g", "8x8"})
+
+	err := applySettings(fs, map[string]string{
+		"geometry": "64x32",
+		"format":   "png",
+	}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *geometry != "8x8" {
+		t.Errorf("explicitly set flag was overridden: %q", *geometry)
+	}
+	if *format != "png" {
+		t.Errorf("default was not applied: %q", *format)
+	}
+
+	if err := applySettings(fs, map[string]string{"foo": "bar"}, "test"); err == nil {
+		t.Errorf("expected an error for an unknown setting")
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/polyfloyd/shady/internal/term"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// debugUniformRows is the number of uniforms shown at once.
+const debugUniformRows = 20
+
+// debugCommand implements "shady debug", a terminal UI for inspecting a shader
+// on machines without a display, e.g. over SSH. The shader is rendered
+// offscreen and reloaded when its files change, while the UI shows the values
+// of its uniforms and how fast it renders. Time can be paused to step through
+// frames and uniforms can be set to values typed in.
+func debugCommand(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shady debug [flags] [shader.glsl...]\n")
+		fs.PrintDefaults()
+	}
+	sf := newShaderFlags(fs)
+	geometry := fs.String("g", "512x512", "The geometry of the rendered image in WIDTHxHEIGHT format")
+	fps := fs.Float64("fps", 30, "The number of frames to render per second while playing")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	sf.inputFiles = append(sf.inputFiles, fs.Args()...)
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	if *fps <= 0 {
+		return fmt.Errorf("-fps must be positive")
+	}
+	width, height, err := parseGeometry(*geometry)
+	if err != nil {
+		return err
+	}
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	sh, err := renderer.NewShaderContext(ctx, width, height, openGLVersion)
+	if err != nil {
+		return err
+	}
+	defer sh.Close()
+
+	// Everything that would be written to the terminal is shown in the UI
+	// instead.
+	messages := &messageLog{max: 5}
+	log.SetOutput(messages)
+	defer log.SetOutput(os.Stderr)
+	logger := log.New(messages, "", log.Ltime)
+	sh.SetLogger(logger)
+	sh.SetDebugHandler(renderer.DebugLow, renderer.DebugLogger(logger))
+
+	restore, err := term.Unbuffer(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	out := bufio.NewWriter(os.Stdout)
+	// Switch to the alternate screen and hide the cursor until done.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+		out.Flush()
+	}()
+
+	d := &debugger{
+		sh:         sh,
+		interval:   time.Duration(float64(time.Second) / *fps),
+		playing:    true,
+		overridden: map[string]bool{},
+		messages:   messages,
+		title:      fmt.Sprintf("shady debug  %s  %dx%d", strings.Join(sf.inputFiles, " "), width, height),
+	}
+	sh.AddFrameHook(func(f *renderer.Frame) error {
+		d.number, d.time = f.Number, f.Time
+		return nil
+	})
+	go watchEnvironment(ctx, sh, sf.newEnvironment)
+	return d.run(ctx, out, readDebugKeys(os.Stdin))
+}
+
+// A debugger is the state of the UI of "shady debug". It is only used from
+// the rendering thread.
+type debugger struct {
+	sh       *renderer.Shader
+	interval time.Duration
+	title    string
+	playing  bool
+
+	uniforms []debugUniform
+	// overridden holds the names of the uniforms set from the UI.
+	overridden map[string]bool
+	selected   int
+	// editing is set while a value for the selected uniform is typed.
+	editing bool
+	input   string
+	status  string
+
+	number    uint64
+	time      time.Duration
+	frameTime time.Duration
+	// frameTimes holds the times at which the frames of the last second
+	// were rendered, to measure the frame rate.
+	frameTimes []time.Time
+	messages   *messageLog
+}
+
+type debugUniform struct {
+	renderer.Uniform
+	value string
+}
+
+func (d *debugger) run(ctx context.Context, out *bufio.Writer, keys <-chan string) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.draw(out)
+		select {
+		case <-ctx.Done():
+			return nil
+		case key, ok := <-keys:
+			if !ok {
+				keys = nil
+			} else if !d.handleKey(ctx, key) {
+				return nil
+			}
+		case <-ticker.C:
+			if d.playing {
+				d.step(ctx)
+			}
+		}
+	}
+}
+
+// step renders the next frame and reads the values of the uniforms it was
+// rendered with.
+func (d *debugger) step(ctx context.Context) {
+	start := time.Now()
+	// Until the first environment is loaded, the UI is kept responsive.
+	frameCtx, cancel := context.WithTimeout(ctx, d.interval)
+	img, err := d.sh.Image(frameCtx, d.interval)
+	cancel()
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return
+	} else if err != nil {
+		log.Println(err)
+		return
+	}
+	if img != nil {
+		d.sh.Recycle(img)
+	}
+	now := time.Now()
+	d.frameTime = now.Sub(start)
+	d.frameTimes = append(d.frameTimes, now)
+	for len(d.frameTimes) > 0 && now.Sub(d.frameTimes[0]) > time.Second {
+		d.frameTimes = d.frameTimes[1:]
+	}
+
+	uniforms := d.sh.Uniforms()
+	names := make([]string, 0, len(uniforms))
+	for name := range uniforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	d.uniforms = d.uniforms[:0]
+	for _, name := range names {
+		value := "-"
+		if v, ok := d.sh.UniformValue(name); ok {
+			value = formatUniformValue(v)
+		}
+		d.uniforms = append(d.uniforms, debugUniform{Uniform: uniforms[name], value: value})
+	}
+	if d.selected >= len(d.uniforms) {
+		d.selected = len(d.uniforms) - 1
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+}
+
+func formatUniformValue(v []float32) string {
+	s := make([]string, len(v))
+	for i, f := range v {
+		s[i] = fmt.Sprintf("%.4g", f)
+	}
+	return strings.Join(s, ", ")
+}
+
+// handleKey applies a key pressed in the UI. It returns false to quit.
+func (d *debugger) handleKey(ctx context.Context, key string) bool {
+	if d.editing {
+		switch key {
+		case "enter":
+			d.editing = false
+			d.apply(d.input)
+		case "escape":
+			d.editing = false
+		case "backspace":
+			if _, n := utf8.DecodeLastRuneInString(d.input); n > 0 {
+				d.input = d.input[:len(d.input)-n]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				d.input += key
+			}
+		}
+		return true
+	}
+
+	switch key {
+	case "q":
+		return false
+	case " ":
+		d.playing = !d.playing
+	case "right", ".":
+		if !d.playing {
+			d.step(ctx)
+		}
+	case "up", "k":
+		if d.selected > 0 {
+			d.selected--
+		}
+	case "down", "j":
+		if d.selected < len(d.uniforms)-1 {
+			d.selected++
+		}
+	case "enter":
+		if d.selected < len(d.uniforms) {
+			d.editing = true
+			d.input = d.uniforms[d.selected].value
+			d.status = ""
+		}
+	case "x":
+		if d.selected < len(d.uniforms) {
+			name := d.uniforms[d.selected].Name
+			d.sh.SetUniform(name, nil)
+			delete(d.overridden, name)
+			d.status = fmt.Sprintf("%s is set by the environment again", name)
+		}
+	}
+	return true
+}
+
+// apply sets the selected uniform to a value typed in.
+func (d *debugger) apply(input string) {
+	if d.selected >= len(d.uniforms) {
+		return
+	}
+	u := d.uniforms[d.selected].Uniform
+	value, err := u.ParseValue(input)
+	if err == nil {
+		err = d.sh.SetUniform(u.Name, value)
+	}
+	if err != nil {
+		d.status = err.Error()
+		return
+	}
+	d.overridden[u.Name] = true
+	d.status = fmt.Sprintf("%s is set to %s from the next frame on", u.Name, input)
+}
+
+func (d *debugger) draw(out *bufio.Writer) {
+	var lines []string
+	line := func(format string, v ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, v...))
+	}
+
+	state := "playing"
+	if !d.playing {
+		state = "paused"
+	}
+	fps := 0.0
+	if n := len(d.frameTimes); n > 1 {
+		fps = float64(n-1) / d.frameTimes[n-1].Sub(d.frameTimes[0]).Seconds()
+	}
+	stats := d.sh.Stats()
+	line("%s", d.title)
+	line("frame %d  time %.3fs  %s", d.number, d.time.Seconds(), state)
+	line("%.1f fps  frame %v  GPU %v", fps, d.frameTime.Round(time.Microsecond), stats.GPUTime.Round(time.Microsecond))
+	line("reloads %d  errors %d", stats.Reloads, stats.Errors)
+	if stats.LastError != nil {
+		line("last error at %s: %s", stats.LastErrorTime.Format("15:04:05"), strings.SplitN(stats.LastError.Error(), "\n", 2)[0])
+	}
+	line("")
+
+	// Scroll the list of uniforms to keep the selected one in view.
+	first := d.selected - debugUniformRows/2
+	if max := len(d.uniforms) - debugUniformRows; first > max {
+		first = max
+	}
+	if first < 0 {
+		first = 0
+	}
+	line("  %-24s %-10s %s", "UNIFORM", "TYPE", "VALUE")
+	for i := first; i < len(d.uniforms) && i < first+debugUniformRows; i++ {
+		u := d.uniforms[i]
+		cursor, mark := " ", " "
+		if i == d.selected {
+			cursor = ">"
+		}
+		if d.overridden[u.Name] {
+			mark = "*"
+		}
+		value := u.value
+		if i == d.selected && d.editing {
+			value = d.input + "_"
+		}
+		line("%s%s%-24s %-10s %s", cursor, mark, u.Name, u.TypeLiteral(), value)
+	}
+	line("")
+	if d.status != "" {
+		line("%s", d.status)
+	}
+	for _, m := range d.messages.lines() {
+		line("%s", m)
+	}
+	if d.editing {
+		line("type a value, enter set  escape cancel")
+	} else {
+		line("space play/pause  right step  up/down select  enter edit  x reset  q quit")
+	}
+
+	fmt.Fprint(out, "\x1b[H")
+	for _, l := range lines {
+		fmt.Fprintf(out, "%s\x1b[K\n", l)
+	}
+	fmt.Fprint(out, "\x1b[J")
+	out.Flush()
+}
+
+// readDebugKeys sends the keys read from r as named by parseDebugKeys.
+func readDebugKeys(r io.Reader) <-chan string {
+	keys := make(chan string, 16)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, k := range parseDebugKeys(buf[:n]) {
+				keys <- k
+			}
+		}
+	}()
+	return keys
+}
+
+// parseDebugKeys maps the bytes read from a terminal to the names of special
+// keys, or to the characters typed. Escape sequences are expected to be read
+// at once.
+func parseDebugKeys(b []byte) []string {
+	sequences := []struct {
+		seq, key string
+	}{
+		{"\x1b[A", "up"},
+		{"\x1b[B", "down"},
+		{"\x1b[C", "right"},
+		{"\x1b[D", "left"},
+		{"\r", "enter"},
+		{"\n", "enter"},
+		{"\x7f", "backspace"},
+		{"\b", "backspace"},
+	}
+	var keys []string
+outer:
+	for len(b) > 0 {
+		for _, s := range sequences {
+			if bytes.HasPrefix(b, []byte(s.seq)) {
+				keys = append(keys, s.key)
+				b = b[len(s.seq):]
+				continue outer
+			}
+		}
+		if b[0] == 0x1b {
+			if len(b) == 1 || b[1] == 0x1b {
+				keys = append(keys, "escape")
+				b = b[1:]
+				continue
+			}
+			// Skip unknown escape sequences.
+			if i := bytes.IndexAny(b[1:], "\x1b~ABCDEFGHPQRS"); i >= 0 && b[1+i] != 0x1b {
+				b = b[2+i:]
+				continue
+			}
+			b = b[1:]
+			continue
+		}
+		r, n := utf8.DecodeRune(b)
+		if r != utf8.RuneError && r >= ' ' {
+			keys = append(keys, string(r))
+		}
+		b = b[n:]
+	}
+	return keys
+}
+
+// A messageLog keeps the last lines written to it, to show log messages in
+// the UI.
+type messageLog struct {
+	max int
+
+	lock sync.Mutex
+	buf  []string
+}
+
+func (l *messageLog) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.buf = append(l.buf, line)
+	}
+	if len(l.buf) > l.max {
+		l.buf = l.buf[len(l.buf)-l.max:]
+	}
+	return len(p), nil
+}
+
+func (l *messageLog) lines() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.buf...)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseDebugKeys(t *testing.T) {
+	for input, expected := range map[string][]string{
+		"q":            {"q"},
+		"\x1b[A\x1b[B": {"up", "down"},
+		"0.5\r":        {"0", ".", "5", "enter"},
+		"\x7f\x1b":     {"backspace", "escape"},
+		"\x1b[15~x":    {"x"},
+		"é":            {"é"},
+		"\x01":         nil,
+	} {
+		if keys := parseDebugKeys([]byte(input)); !reflect.DeepEqual(keys, expected) {
+			t.Errorf("%q: expected %q, got %q", input, expected, keys)
+		}
+	}
+}
+
+func TestMessageLog(t *testing.T) {
+	l := &messageLog{max: 2}
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(l, "line %d\n", i)
+	}
+	if lines := l.lines(); !reflect.DeepEqual(lines, []string{"line 1", "line 2"}) {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type diffResult struct {
+	Width  uint        `json:"width"`
+	Height uint        `json:"height"`
+	Frames []frameDiff `json:"frames"`
+	// Similarity is the lowest similarity of all frames.
+	Similarity float64 `json:"similarity"`
+}
+
+// A frameDiff holds the differences between a frame of both versions.
+type frameDiff struct {
+	Time  float64 `json:"time"`
+	Frame uint64  `json:"frame"`
+	// Similarity is 1 minus the root mean square of the differences of the
+	// color channels, so identical frames have a similarity of 1.
+	Similarity float64 `json:"similarity"`
+	// MaxDelta is the largest difference in any color channel, from 0 to 255.
+	MaxDelta int `json:"max_delta"`
+	// Changed is the fraction of pixels that differ.
+	Changed float64 `json:"changed"`
+}
+
+// diffCommand implements "shady diff", which renders two versions of a shader
+// at the same times and compares the frames.
+func diffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	sf := newShaderFlags(fs)
+	var baseFiles arrayFlags
+	fs.Var(&baseFiles, "base", "The shader file(s) of the version to compare against")
+	geometry := fs.String("g", "512x512", "The geometry of the rendered frames in WIDTHxHEIGHT format")
+	timesStr := fs.String("t", "0", "A comma separated list of the times in seconds at which to compare the versions")
+	framerate := fs.Float64("f", 60, "The number of frames per second at which the shaders are animated up to the last time")
+	outputFile := fs.String("o", "", "Write the frames of both versions side by side to the specified file, with a row for each time")
+	heatmapFile := fs.String("heatmap", "", "Write a heatmap of the differences to the specified file, with a row for each time")
+	gain := fs.Float64("gain", 4, "The factor by which differences are amplified in the heatmap")
+	minSimilarity := fs.Float64("min-similarity", 0, "Exit with a non-zero status if the similarity of any frame is below this value")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	if len(baseFiles) == 0 {
+		return errors.New("please specify the version to compare against with -base")
+	}
+	if *framerate <= 0 {
+		return errors.New("-f must be positive")
+	}
+	times, err := parseTimes(*timesStr)
+	if err != nil {
+		return err
+	}
+	width, height, err := parseGeometry(*geometry)
+	if err != nil {
+		return err
+	}
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+	frameNumbers := make([]uint64, len(times))
+	for i, t := range times {
+		frameNumbers[i] = uint64(math.Round(t * *framerate))
+	}
+
+	interval := time.Duration(float64(time.Second) / *framerate)
+	newFiles := sf.inputFiles
+	render := func(inputFiles []string) ([]*image.RGBA, error) {
+		sf.inputFiles = inputFiles
+		env, _, err := sf.newEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		sh, err := renderer.NewShader(width, height, openGLVersion)
+		if err != nil {
+			return nil, err
+		}
+		defer sh.Close()
+		logToStderr(sh)
+		sh.SetEnvironment(env)
+		if err := sh.Load(context.Background()); err != nil {
+			return nil, err
+		}
+		return captureFrames(sh, interval, frameNumbers), nil
+	}
+	oldFrames, err := render(baseFiles)
+	if err != nil {
+		return fmt.Errorf("base: %w", err)
+	}
+	newFrames, err := render(newFiles)
+	if err != nil {
+		return err
+	}
+
+	res := diffResult{Width: width, Height: height, Similarity: 1}
+	w, h := int(width), int(height)
+	sideBySide := image.NewRGBA(image.Rect(0, 0, w*2, h*len(times)))
+	heatmaps := image.NewRGBA(image.Rect(0, 0, w, h*len(times)))
+	for i := range times {
+		d, heatmap := compareFrames(oldFrames[i], newFrames[i], *gain)
+		d.Time, d.Frame = times[i], frameNumbers[i]
+		res.Frames = append(res.Frames, d)
+		res.Similarity = math.Min(res.Similarity, d.Similarity)
+
+		row := image.Pt(0, h*i)
+		draw.Draw(sideBySide, oldFrames[i].Rect.Add(row), oldFrames[i], image.Point{}, draw.Src)
+		draw.Draw(sideBySide, newFrames[i].Rect.Add(row).Add(image.Pt(w, 0)), newFrames[i], image.Point{}, draw.Src)
+		draw.Draw(heatmaps, heatmap.Rect.Add(row), heatmap, image.Point{}, draw.Src)
+	}
+	if *outputFile != "" {
+		if err := writeImage(*outputFile, sideBySide); err != nil {
+			return err
+		}
+	}
+	if *heatmapFile != "" {
+		if err := writeImage(*heatmapFile, heatmaps); err != nil {
+			return err
+		}
+	}
+
+	if *sf.json {
+		if err := printJSON(res); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range res.Frames {
+			fmt.Printf("t=%gs: similarity %.4f, max delta %d, %.2f%% of pixels changed\n", d.Time, d.Similarity, d.MaxDelta, d.Changed*100)
+		}
+	}
+	if res.Similarity < *minSimilarity {
+		if !*sf.json {
+			fmt.Printf("The similarity is below %g\n", *minSimilarity)
+		}
+		return errCommandFailed
+	}
+	return nil
+}
+
+func parseTimes(s string) ([]float64, error) {
+	var times []float64
+	for _, f := range strings.Split(s, ",") {
+		t, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || t < 0 {
+			return nil, fmt.Errorf("invalid time: %q", f)
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+// captureFrames animates the shader and returns copies of the frames with the
+// specified numbers. Rendering every frame up to the last keeps the state of
+// shaders that depend on previous frames the same as during playback.
+func captureFrames(sh *renderer.Shader, interval time.Duration, numbers []uint64) []*image.RGBA {
+	last := uint64(0)
+	for _, n := range numbers {
+		if n > last {
+			last = n
+		}
+	}
+	frames := make([]*image.RGBA, len(numbers))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan image.Image)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		n := uint64(0)
+		for img := range stream {
+			for i, want := range numbers {
+				if want != n {
+					continue
+				}
+				src := renderer.FrameRGBA(img)
+				frames[i] = image.NewRGBA(src.Rect)
+				draw.Draw(frames[i], src.Rect, src, src.Rect.Min, draw.Src)
+			}
+			if n == last {
+				return
+			}
+			n++
+		}
+	}()
+	sh.Animate(ctx, interval, stream)
+	<-done
+	return frames
+}
+
+// compareFrames computes the differences between the color channels of two
+// frames of the same size and renders them as a heatmap. The alpha channel is
+// ignored.
+func compareFrames(a, b *image.RGBA, gain float64) (frameDiff, *image.RGBA) {
+	var d frameDiff
+	heatmap := image.NewRGBA(a.Rect)
+	var sumSq float64
+	changed := 0
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		for x := a.Rect.Min.X; x < a.Rect.Max.X; x++ {
+			i, j := a.PixOffset(x, y), b.PixOffset(x, y)
+			maxDelta := 0
+			for c := 0; c < 3; c++ {
+				v := absInt(int(a.Pix[i+c]) - int(b.Pix[j+c]))
+				sumSq += float64(v * v)
+				if v > maxDelta {
+					maxDelta = v
+				}
+			}
+			if maxDelta > 0 {
+				changed++
+			}
+			if maxDelta > d.MaxDelta {
+				d.MaxDelta = maxDelta
+			}
+			heatmap.SetRGBA(x, y, heatColor(float64(maxDelta)/255*gain))
+		}
+	}
+	n := float64(a.Rect.Dx() * a.Rect.Dy())
+	d.Similarity = 1 - math.Sqrt(sumSq/(n*3))/255
+	d.Changed = float64(changed) / n
+	return d, heatmap
+}
+
+// heatRamp are the colors of the heatmap from no to the largest difference.
+var heatRamp = []color.RGBA{
+	{0, 0, 0, 255},
+	{80, 0, 160, 255},
+	{220, 30, 30, 255},
+	{255, 200, 0, 255},
+	{255, 255, 255, 255},
+}
+
+func heatColor(v float64) color.RGBA {
+	v = math.Max(0, math.Min(1, v)) * float64(len(heatRamp)-1)
+	i := int(v)
+	if i == len(heatRamp)-1 {
+		return heatRamp[i]
+	}
+	f := v - float64(i)
+	lerp := func(p, q uint8) uint8 {
+		return uint8(math.Round(float64(p)*(1-f) + float64(q)*f))
+	}
+	a, b := heatRamp[i], heatRamp[i+1]
+	return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 255}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestCompareFrames(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	b := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i := range a.Pix {
+		a.Pix[i], b.Pix[i] = 100, 100
+	}
+	d, heatmap := compareFrames(a, b, 1)
+	if d.Similarity != 1 || d.MaxDelta != 0 || d.Changed != 0 {
+		t.Fatalf("unexpected diff of identical frames: %+v", d)
+	}
+	if c := heatmap.RGBAAt(0, 0); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Fatalf("unexpected heat of identical pixels: %v", c)
+	}
+
+	b.SetRGBA(1, 0, color.RGBA{100, 100, 100 + 51, 0})
+	d, heatmap = compareFrames(a, b, 5)
+	if d.MaxDelta != 51 || d.Changed != 0.25 {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+	if want := 1 - math.Sqrt(51*51/12.0)/255; math.Abs(d.Similarity-want) > 1e-9 {
+		t.Fatalf("unexpected similarity: %v, want %v", d.Similarity, want)
+	}
+	if c := heatmap.RGBAAt(1, 0); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Fatalf("unexpected heat of changed pixel: %v", c)
+	}
+}
+
+func TestParseTimes(t *testing.T) {
+	times, err := parseTimes("0, 1.5,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 3 || times[1] != 1.5 || times[2] != 3 {
+		t.Fatalf("unexpected times: %v", times)
+	}
+	if _, err := parseTimes("-1"); err == nil {
+		t.Fatal("expected an error for a negative time")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"log"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+const (
+	errorOverlaySize = 16
+	// errorOverlayMaxLines limits the number of lines shown, as the
+	// first errors reported by a compiler are usually the relevant ones.
+	errorOverlayMaxLines = 24
+)
+
+var errorOverlayColor = color.RGBA{R: 0xff, G: 0x70, B: 0x70, A: 0xff}
+
+// errorOverlay shows the error of the last change to the shader that failed
+// to load over the output, while the previous version keeps rendering.
+type errorOverlay struct {
+	face font.Face
+	// columns is the number of characters after which lines are wrapped.
+	columns int
+
+	lock sync.Mutex
+	img  image.Image
+}
+
+// newErrorOverlay creates an overlay that wraps errors to fit an output of
+// the specified width.
+func newErrorOverlay(width uint) (*errorOverlay, error) {
+	face, err := loadFace("", errorOverlaySize)
+	if err != nil {
+		return nil, err
+	}
+	// Go Mono is monospaced, so any character will do.
+	columns := (int(width) - 4*errorOverlaySize) / font.MeasureString(face, "M").Ceil()
+	if columns < 20 {
+		columns = 20
+	}
+	return &errorOverlay{face: face, columns: columns}, nil
+}
+
+// show renders the error to be shown from the next frame on. A nil error
+// hides the overlay.
+func (o *errorOverlay) show(err error) {
+	var img image.Image
+	if err != nil {
+		lines := wrapLines(err.Error(), o.columns)
+		if len(lines) > errorOverlayMaxLines {
+			lines = append(lines[:errorOverlayMaxLines-1], "...")
+		}
+		img = drawText(o.face, lines, errorOverlayColor)
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.img = img
+}
+
+// Render implements the Render function of renderer.Overlay.
+func (o *errorOverlay) Render(renderer.OverlayFrame) image.Image {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.img
+}
+
+// wrapLines splits text into lines of at most width characters.
+func wrapLines(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		r := []rune(line)
+		for len(r) > width {
+			lines = append(lines, string(r[:width]))
+			r = r[width:]
+		}
+		lines = append(lines, string(r))
+	}
+	return lines
+}
+
+// configureErrorOverlay makes the engine keep rendering the last environment
+// that loaded when a new one fails to and shows the error over it. It returns
+// the engine to pass to watchEnvironment, so errors that occur while loading
+// the files are shown as well. width is the width of the output.
+func configureErrorOverlay(engine interface {
+	SetEnvironment(renderer.Environment)
+	SetKeepOnError(func(error))
+	AddOverlay(renderer.Overlay) error
+}, width uint, fallback func(error) renderer.Environment) (*overlayReporter, error) {
+	ov, err := newErrorOverlay(width)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.AddOverlay(renderer.Overlay{
+		Render:  ov.Render,
+		Corner:  renderer.CornerTopLeft,
+		Margin:  errorOverlaySize,
+		Opacity: 1,
+	}); err != nil {
+		return nil, err
+	}
+	engine.SetKeepOnError(func(err error) {
+		log.Println(err)
+		ov.show(err)
+	})
+	return &overlayReporter{engine: engine, overlay: ov, fallback: fallback}, nil
+}
+
+// overlayReporter shows the errors that occur while watching the environment
+// on the error overlay. Until an environment is set there is nothing to show
+// the error over, so the fallback is shown instead, if set.
+type overlayReporter struct {
+	engine   interface{ SetEnvironment(renderer.Environment) }
+	overlay  *errorOverlay
+	fallback func(error) renderer.Environment
+	loaded   bool
+}
+
+func (r *overlayReporter) SetEnvironment(env renderer.Environment) {
+	// If the environment fails to compile, the error is shown again before
+	// the next frame is drawn.
+	r.overlay.show(nil)
+	r.loaded = true
+	r.engine.SetEnvironment(env)
+}
+
+func (r *overlayReporter) ReportError(err error) {
+	if !r.loaded && r.fallback != nil {
+		fallbackReporter{r.engine, r.fallback}.ReportError(err)
+		return
+	}
+	log.Println(err)
+	r.overlay.show(err)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrapLines(t *testing.T) {
+	tests := []struct {
+		text   string
+		width  int
+		expect []string
+	}{
+		{"error", 10, []string{"error"}},
+		{"0:1(2): error\n0:3(4): error\n", 20, []string{"0:1(2): error", "0:3(4): error"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"äöü", 2, []string{"äö", "ü"}},
+	}
+	for _, tt := range tests {
+		if got := wrapLines(tt.text, tt.width); !reflect.DeepEqual(got, tt.expect) {
+			t.Errorf("%q at %d: expected %q, got %q", tt.text, tt.width, tt.expect, got)
+		}
+	}
+}
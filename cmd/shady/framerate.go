@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/polyfloyd/shady/encode"
+)
+
+// outputInterval returns the time between two frames of the output, given
+// the interval at which frames are rendered and the frame rate of -ofps.
+func outputInterval(interval time.Duration, framerate float64) (time.Duration, error) {
+	if framerate < 0 {
+		return 0, fmt.Errorf("-ofps must be positive")
+	}
+	if framerate == 0 {
+		return interval, nil
+	}
+	return time.Duration(float64(time.Second) / framerate), nil
+}
+
+// sinkInterval returns the rate requested by the sink if it is a
+// FrameRateSink and the frame rate of -ofps is 0, or the output interval
+// otherwise.
+func sinkInterval(sink encode.Sink, interval time.Duration, framerate float64) time.Duration {
+	s, ok := sink.(encode.FrameRateSink)
+	if !ok || framerate != 0 || s.FrameInterval() <= 0 {
+		return interval
+	}
+	return s.FrameInterval()
+}
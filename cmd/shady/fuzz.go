@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+type fuzzResult struct {
+	Seed     int64                  `json:"seed"`
+	Frames   int                    `json:"frames"`
+	Failures []renderer.FuzzFailure `json:"failures"`
+}
+
+// fuzzCommand implements "shady fuzz", which renders a shader at random sizes
+// and with random uniform values to find inputs that break it.
+func fuzzCommand(args []string) error {
+	fs := flag.NewFlagSet("fuzz", flag.ContinueOnError)
+	sf := newShaderFlags(fs)
+	sizes := fs.Int("sizes", 8, "The number of random canvas sizes to render at")
+	iterations := fs.Int("n", 32, "The number of frames with random uniform values to render at each size")
+	minSize := fs.Uint("min-size", 1, "The smallest width and height of the canvas")
+	maxSize := fs.Uint("max-size", 2048, "The largest width and height of the canvas")
+	valueRange := fs.String("range", "-1000:1000", "The range of random uniform values in MIN:MAX format")
+	var uniforms arrayFlags
+	fs.Var(&uniforms, "uniform", "A uniform to randomize. By default, all float, int and bool uniforms are randomized")
+	exclude := fs.String("exclude", "iResolution,iEyeOrigin,iEyeOffset,iJitter", "A comma separated list of uniforms that are not randomized by default")
+	seed := fs.Int64("seed", 0, "The seed of the random values. If 0, a random seed is used")
+	verbose := fs.Bool("v", false, "Print each case before it is rendered, so the case that crashes the driver can be found")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	var min, max float32
+	if _, err := fmt.Sscanf(*valueRange, "%g:%g", &min, &max); err != nil || min > max {
+		return fmt.Errorf("invalid range: %q", *valueRange)
+	}
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	opts := renderer.FuzzOptions{
+		Sizes:      *sizes,
+		Iterations: *iterations,
+		MinSize:    *minSize,
+		MaxSize:    *maxSize,
+		Min:        min,
+		Max:        max,
+		Uniforms:   uniforms,
+		Exclude:    strings.Split(*exclude, ","),
+		Seed:       *seed,
+		// Only the Shadertoy environment can write the unclamped color.
+		CheckNaN: *sf.env == "shadertoy",
+	}
+	if *verbose {
+		opts.Progress = func(c renderer.FuzzCase) {
+			fmt.Fprintf(os.Stderr, "%dx%d %v\n", c.Width, c.Height, c.Uniforms)
+		}
+	}
+	if !opts.CheckNaN {
+		log.Printf("NaN checks are not supported by the %s environment", *sf.env)
+	}
+	failures, err := renderer.Fuzz(func() (renderer.Environment, error) {
+		env, _, err := sf.newEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		if st, ok := env.(*shadertoy.ShaderToy); ok {
+			st.SetOutputs(renderer.OutputColor)
+		}
+		return env, nil
+	}, openGLVersion, opts)
+	if err != nil {
+		return err
+	}
+
+	res := fuzzResult{Seed: *seed, Frames: *sizes * *iterations, Failures: failures}
+	if res.Failures == nil {
+		res.Failures = []renderer.FuzzFailure{}
+	}
+	if *sf.json {
+		if err := printJSON(res); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range res.Failures {
+			fmt.Printf("%v\n    uniforms: %v\n", f, f.Uniforms)
+		}
+		fmt.Printf("%d of %d frames failed, seed %d\n", len(res.Failures), res.Frames, res.Seed)
+	}
+	if len(res.Failures) > 0 {
+		return errCommandFailed
+	}
+	return nil
+}
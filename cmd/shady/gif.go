@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/draw"
+	"time"
+
+	"github.com/polyfloyd/shady/encode"
+)
+
+// gifSettings holds the -gif-* flags.
+type gifSettings struct {
+	delay   int
+	palette string
+	dither  bool
+}
+
+func (g *gifSettings) flags(fs *flag.FlagSet) {
+	fs.IntVar(&g.delay, "gif-delay", 0, "The time each frame of -ofmt gif is shown in hundredths of a second. If 0, the frame rate is used")
+	fs.StringVar(&g.palette, "gif-palette", "plan9", "How the colors of -ofmt gif are chosen. Valid values are: plan9 (a fixed palette), median-cut (per frame, best for gradients and large areas), octree (per frame, best for small details)")
+	fs.BoolVar(&g.dither, "gif-dither", false, "Apply Floyd-Steinberg dithering to -ofmt gif, which reduces banding at the cost of noise")
+}
+
+// configureGIF applies the -gif-* flags to the GIF format.
+func configureGIF(settings gifSettings) error {
+	var quantizer draw.Quantizer
+	switch settings.palette {
+	case "plan9":
+	case "median-cut":
+		quantizer = encode.MedianCut{}
+	case "octree":
+		quantizer = encode.Octree{}
+	default:
+		return fmt.Errorf("invalid GIF palette: %q", settings.palette)
+	}
+	encode.Formats["gif"] = encode.GIFFormat{
+		Delay:     time.Duration(settings.delay) * time.Second / 100,
+		Quantizer: quantizer,
+		Dither:    settings.dither,
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// configureHDR makes the shader render HDR images with the precision set by
+// the -hdr flag, or 32 bits if the output format keeps values beyond 1.0 or
+// more than 8 bits and the flag is not set. The default is not applied if the
+// output can not be HDR, e.g. because of additional outputs. It reports
+// whether HDR images are rendered.
+func configureHDR(engine *renderer.Shader, bits int, outputFormat, outputFile string, canDefault bool) (bool, error) {
+	format, ok := encode.LookupFormat(outputFormat)
+	if !ok {
+		format, _ = encode.DetectFormat(outputFile)
+	}
+	switch f := format.(type) {
+	case encode.EXRFormat, encode.RadianceFormat:
+		if bits == 0 && canDefault {
+			bits = 32
+		}
+	case encode.TIFFFormat:
+		// Half floats are not precise enough for 16 bits.
+		if f.Bits == 16 && bits == 0 && canDefault {
+			bits = 32
+		}
+	}
+	if bits == 16 {
+		encode.Formats["exr"] = encode.EXRFormat{Half: true}
+	}
+	return bits != 0, engine.SetHDR(bits)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/polyfloyd/shady/encode"
+)
+
+// configureICC makes the PNG, JPEG and TIFF formats embed the profile set by the
+// -icc flag, which must match the transfer function of -transfer.
+func configureICC(name, transfer string) error {
+	var profile []byte
+	switch name {
+	case "none":
+		return nil
+	case "srgb":
+		if transfer != "none" && transfer != "srgb" {
+			return fmt.Errorf("-icc srgb does not match -transfer %s", transfer)
+		}
+		profile = encode.SRGBProfile()
+	default:
+		var err error
+		if profile, err = encode.LoadICCProfile(name); err != nil {
+			return err
+		}
+	}
+	png := encode.Formats["png"].(encode.PNGFormat)
+	png.ICC = profile
+	encode.Formats["png"] = png
+	jpg := encode.Formats["jpg"].(encode.JPGFormat)
+	jpg.ICC = profile
+	encode.Formats["jpg"] = jpg
+	tiff := encode.Formats["tiff"].(encode.TIFFFormat)
+	tiff.ICC = profile
+	encode.Formats["tiff"] = tiff
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/polyfloyd/shady/egl"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type infoResult struct {
+	OpenGL renderer.Capabilities `json:"opengl"`
+	EGL    *eglInfo              `json:"egl,omitempty"`
+}
+
+type eglInfo struct {
+	Vendor     string   `json:"vendor"`
+	Version    string   `json:"version"`
+	ClientAPIs []string `json:"client_apis"`
+	Extensions []string `json:"extensions"`
+}
+
+// infoCommand implements "shady info", which reports the capabilities of the
+// OpenGL implementation shady renders with.
+func infoCommand(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	glslVersion := fs.String("glsl", "330", "The GLSL version to use")
+	openGL := fs.String("opengl", "glsl", "The OpenGL version to use. If \"glsl\", the version is inferred from the requested GLSL version")
+	eglPlatform := fs.String("egl-platform", "default", eglPlatformUsage)
+	jsonOut := fs.Bool("json", false, "Print the result as JSON")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if err := applyConfigDefaults(fs); err != nil {
+		return err
+	}
+	if err := selectPlatform(*eglPlatform); err != nil {
+		return err
+	}
+
+	openGLVersion, err := resolveOpenGLVersion(*openGL, *glslVersion)
+	if err != nil {
+		return err
+	}
+	sh, err := renderer.NewShader(1, 1, openGLVersion)
+	if err != nil {
+		return err
+	}
+	defer sh.Close()
+	logToStderr(sh)
+
+	res := infoResult{OpenGL: renderer.QueryCapabilities()}
+	if display, err := egl.GetPlatformDisplay(renderer.Platform()); err == nil {
+		res.EGL = &eglInfo{
+			Vendor:     display.Vendor(),
+			Version:    display.Version(),
+			ClientAPIs: display.ClientAPIs(),
+			Extensions: display.Extensions(),
+		}
+	}
+
+	if *jsonOut {
+		return printJSON(res)
+	}
+	fmt.Printf("OpenGL vendor:    %s\n", res.OpenGL.Vendor)
+	fmt.Printf("OpenGL renderer:  %s\n", res.OpenGL.Renderer)
+	fmt.Printf("OpenGL version:   %s\n", res.OpenGL.Version)
+	fmt.Printf("GLSL version:     %s\n", res.OpenGL.GLSLVersion)
+	fmt.Printf("Max texture size: %d\n", res.OpenGL.MaxTextureSize)
+	fmt.Printf("Extensions:       %s\n", strings.Join(res.OpenGL.Extensions, " "))
+	if res.EGL != nil {
+		fmt.Printf("EGL vendor:       %s\n", res.EGL.Vendor)
+		fmt.Printf("EGL version:      %s\n", res.EGL.Version)
+		fmt.Printf("EGL client APIs:  %s\n", strings.Join(res.EGL.ClientAPIs, " "))
+		fmt.Printf("EGL extensions:   %s\n", strings.Join(res.EGL.Extensions, " "))
+	}
+	return nil
+}
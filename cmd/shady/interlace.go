@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"time"
+
+	"github.com/polyfloyd/shady/encode"
+)
+
+// fieldCadence describes how rendered frames are turned into interlaced
+// frames, as set by the -interlace and -pulldown flags.
+type fieldCadence struct {
+	order encode.FieldOrder
+	// fields holds the number of fields taken from each successive rendered
+	// frame, repeating. Each pair of fields is woven into a frame.
+	fields []int
+}
+
+// parseFieldCadence applies the -interlace and -pulldown flags. It returns
+// nil for progressive output.
+func parseFieldCadence(interlace string, pulldown bool) (*fieldCadence, error) {
+	var order encode.FieldOrder
+	switch interlace {
+	case "none":
+	case "tff":
+		order = encode.TopFieldFirst
+	case "bff":
+		order = encode.BottomFieldFirst
+	default:
+		return nil, fmt.Errorf("invalid field order: %q", interlace)
+	}
+	if pulldown {
+		if order == encode.Progressive {
+			order = encode.TopFieldFirst
+		}
+		return &fieldCadence{order: order, fields: []int{2, 3}}, nil
+	}
+	if order == encode.Progressive {
+		return nil, nil
+	}
+	return &fieldCadence{order: order, fields: []int{1}}, nil
+}
+
+// renderTiming returns the interval at which to render frames to produce
+// output frames at the interval, and the number of frames to render to
+// produce numFrames output frames.
+func (c *fieldCadence) renderTiming(interval time.Duration, numFrames uint) (time.Duration, uint) {
+	var fields int
+	for _, n := range c.fields {
+		fields += n
+	}
+	// Every 2 fields make a frame.
+	num, den := uint(2*len(c.fields)), uint(fields)
+	return interval * time.Duration(fields) / time.Duration(2*len(c.fields)), (numFrames*num + den - 1) / den
+}
+
+// weave takes fields from the rendered frames on the stream according to the
+// cadence and weaves each pair into an interlaced frame. The first field of a
+// pair is taken from the earlier frame.
+func (c *fieldCadence) weave(in <-chan image.Image) <-chan image.Image {
+	out := make(chan image.Image)
+	go func() {
+		defer close(out)
+		var first image.Image
+		i := 0
+		for img := range in {
+			for n := 0; n < c.fields[i%len(c.fields)]; n++ {
+				if first == nil {
+					first = img
+					continue
+				}
+				out <- weaveFields(first, img, c.order)
+				first = nil
+			}
+			i++
+		}
+		// Complete a trailing single field with itself.
+		if first != nil {
+			out <- weaveFields(first, first, c.order)
+		}
+	}()
+	return out
+}
+
+// weaveFields combines the first field of an image and the second field of
+// another into an interlaced frame.
+func weaveFields(first, second image.Image, order encode.FieldOrder) image.Image {
+	b := first.Bounds()
+	frame := image.NewRGBA(b)
+	// The first field consists of the even lines if the top field is first.
+	firstParity := 0
+	if order == encode.BottomFieldFirst {
+		firstParity = 1
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		src := second
+		if (y-b.Min.Y)%2 == firstParity {
+			src = first
+		}
+		row := image.Rect(b.Min.X, y, b.Max.X, y+1)
+		draw.Draw(frame, row, src, row.Min, draw.Src)
+	}
+	return frame
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/encode"
+)
+
+// solidFrames sends frames of a single gray level each, which identifies the
+// frame each line of a woven frame was taken from.
+func solidFrames(levels ...uint8) <-chan image.Image {
+	in := make(chan image.Image, len(levels))
+	for _, l := range levels {
+		img := image.NewRGBA(image.Rect(0, 0, 2, 4))
+		for i := range img.Pix {
+			img.Pix[i] = l
+		}
+		in <- img
+	}
+	close(in)
+	return in
+}
+
+// lineLevels returns the gray levels of the even and odd lines of a frame.
+func lineLevels(img image.Image) [2]uint8 {
+	return [2]uint8{
+		color.GrayModel.Convert(img.At(0, 0)).(color.Gray).Y,
+		color.GrayModel.Convert(img.At(0, 1)).(color.Gray).Y,
+	}
+}
+
+func TestWeaveInterlace(t *testing.T) {
+	for order, expected := range map[encode.FieldOrder][][2]uint8{
+		encode.TopFieldFirst:    {{1, 2}, {3, 4}},
+		encode.BottomFieldFirst: {{2, 1}, {4, 3}},
+	} {
+		c := fieldCadence{order: order, fields: []int{1}}
+		var frames [][2]uint8
+		for img := range c.weave(solidFrames(1, 2, 3, 4)) {
+			frames = append(frames, lineLevels(img))
+		}
+		if len(frames) != len(expected) {
+			t.Fatalf("%s: expected %d frames, got %d", order, len(expected), len(frames))
+		}
+		for i := range frames {
+			if frames[i] != expected[i] {
+				t.Errorf("%s: frame %d: expected lines %v, got %v", order, i, expected[i], frames[i])
+			}
+		}
+	}
+}
+
+func TestWeavePulldown(t *testing.T) {
+	c := fieldCadence{order: encode.TopFieldFirst, fields: []int{2, 3}}
+	// Film frames A, B, C and D become AA, BB, BC, CD and DD.
+	expected := [][2]uint8{{1, 1}, {2, 2}, {2, 3}, {3, 4}, {4, 4}}
+	var frames [][2]uint8
+	for img := range c.weave(solidFrames(1, 2, 3, 4)) {
+		frames = append(frames, lineLevels(img))
+	}
+	if len(frames) != len(expected) {
+		t.Fatalf("expected %d frames, got %d", len(expected), len(frames))
+	}
+	for i := range frames {
+		if frames[i] != expected[i] {
+			t.Errorf("frame %d: expected lines %v, got %v", i, expected[i], frames[i])
+		}
+	}
+}
+
+func TestRenderTiming(t *testing.T) {
+	interval := time.Second * 1001 / 30000
+	interlaced := fieldCadence{fields: []int{1}}
+	if ri, n := interlaced.renderTiming(interval, 30); ri != interval/2 || n != 60 {
+		t.Errorf("interlace: unexpected timing: %v, %d", ri, n)
+	}
+	telecine := fieldCadence{fields: []int{2, 3}}
+	if ri, n := telecine.renderTiming(interval, 3); ri != interval*5/4 || n != 3 {
+		t.Errorf("pulldown: unexpected timing: %v, %d", ri, n)
+	}
+}
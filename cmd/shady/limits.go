@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// submissionLimits restricts the jobs that are accepted from untrusted
+// sources. Zero values disable a limit.
+type submissionLimits struct {
+	MaxWidth, MaxHeight uint
+	// MaxDuration is the maximum length of an animation.
+	MaxDuration time.Duration
+	// MaxCompileTime is the time the shader may take to compile.
+	MaxCompileTime time.Duration
+	// MaxLoopIterations is the maximum number of loop iterations per pixel,
+	// as estimated by static analysis of the sources.
+	MaxLoopIterations float64
+}
+
+func (lim *submissionLimits) flags(fs *flag.FlagSet) {
+	fs.Func("max-resolution", "Reject jobs larger than the specified WIDTHxHEIGHT", func(s string) (err error) {
+		lim.MaxWidth, lim.MaxHeight, err = parseGeometry(s)
+		return err
+	})
+	fs.DurationVar(&lim.MaxDuration, "max-duration", 0, "Reject animations longer than the specified duration")
+	fs.DurationVar(&lim.MaxCompileTime, "max-compile-time", 0, "Reject shaders that take longer than the specified duration to compile")
+	fs.Float64Var(&lim.MaxLoopIterations, "max-loop-iterations", 0, "Reject shaders with loops that are estimated to run more than the specified number of iterations per pixel, or of which the number of iterations is unknown")
+}
+
+// A rejection is returned for jobs that exceed a limit.
+type rejection struct {
+	// Limit is the name of the limit that was exceeded, matching the
+	// command line flag.
+	Limit   string `json:"limit"`
+	Message string `json:"message"`
+	// Value and Max describe the offending value and the limit.
+	Value string `json:"value"`
+	Max   string `json:"max"`
+	// File and Line locate the offending loop, if applicable.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+func (r *rejection) Error() string {
+	return r.Message
+}
+
+// check enforces the limits that can be checked without compiling the shader.
+func (lim submissionLimits) check(spec jobSpec) error {
+	w, h, err := parseGeometry(spec.Geometry)
+	if err != nil {
+		return err
+	}
+	if lim.MaxWidth > 0 && (w > lim.MaxWidth || h > lim.MaxHeight) {
+		return &rejection{
+			Limit:   "max-resolution",
+			Message: fmt.Sprintf("the resolution of %dx%d exceeds the maximum of %dx%d", w, h, lim.MaxWidth, lim.MaxHeight),
+			Value:   fmt.Sprintf("%dx%d", w, h),
+			Max:     fmt.Sprintf("%dx%d", lim.MaxWidth, lim.MaxHeight),
+		}
+	}
+
+	if lim.MaxDuration > 0 && spec.Framerate > 0 {
+		duration := time.Duration(spec.Duration * float64(time.Second))
+		if byFrames := time.Duration(float64(spec.Frames) / spec.Framerate * float64(time.Second)); spec.Frames > 0 && (duration == 0 || byFrames < duration) {
+			duration = byFrames
+		}
+		if duration > lim.MaxDuration {
+			return &rejection{
+				Limit:   "max-duration",
+				Message: fmt.Sprintf("the duration of %v exceeds the maximum of %v", duration, lim.MaxDuration),
+				Value:   duration.String(),
+				Max:     lim.MaxDuration.String(),
+			}
+		}
+	}
+
+	if lim.MaxLoopIterations > 0 {
+		files, err := spec.sourceFiles()
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			for _, loop := range estimateLoops(string(src)) {
+				if loop.Iterations <= lim.MaxLoopIterations {
+					continue
+				}
+				r := &rejection{
+					Limit: "max-loop-iterations",
+					Value: fmt.Sprint(loop.Iterations),
+					Max:   fmt.Sprint(lim.MaxLoopIterations),
+					File:  file,
+					Line:  loop.Line,
+				}
+				if math.IsInf(loop.Iterations, 1) {
+					r.Message = fmt.Sprintf("%s:%d: the number of iterations of the loop can not be determined", file, loop.Line)
+				} else {
+					r.Message = fmt.Sprintf("%s:%d: the loop runs an estimated %g iterations per pixel, exceeding the maximum of %g", file, loop.Line, loop.Iterations, lim.MaxLoopIterations)
+				}
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// checkCompile compiles the shader of the job in a sandbox to enforce the
+// compile time limit.
+func (lim submissionLimits) checkCompile(ctx context.Context, spec jobSpec, sandbox sandboxLimits) error {
+	if lim.MaxCompileTime == 0 {
+		return nil
+	}
+	sandbox.Timeout = lim.MaxCompileTime
+	args := []string{"validate"}
+	for _, input := range spec.Inputs {
+		args = append(args, "-i", input)
+	}
+	if spec.Project != "" {
+		args = append(args, "-p", spec.Project)
+	}
+	if spec.Env != "" {
+		args = append(args, "-env", spec.Env)
+	}
+	for _, m := range spec.Mappings {
+		args = append(args, "-map", m)
+	}
+	start := time.Now()
+	err := runSandboxed(ctx, sandbox, args, nil)
+	if elapsed := time.Since(start); elapsed >= lim.MaxCompileTime && ctx.Err() == nil {
+		return &rejection{
+			Limit:   "max-compile-time",
+			Message: fmt.Sprintf("compiling the shader took longer than the maximum of %v", lim.MaxCompileTime),
+			Value:   elapsed.String(),
+			Max:     lim.MaxCompileTime.String(),
+		}
+	}
+	return err
+}
+
+// sourceFiles returns the shader files of the job, including those of the
+// passes of its project and the files they include.
+func (spec jobSpec) sourceFiles() ([]string, error) {
+	inputs := spec.Inputs
+	if spec.Project != "" {
+		proj, err := loadProject(spec.Project)
+		if err != nil {
+			return nil, err
+		}
+		if len(inputs) == 0 {
+			inputs = proj.inputFiles()
+		}
+		for _, p := range proj.Passes {
+			inputs = append(inputs, proj.resolve(p.Inputs)...)
+		}
+	}
+	return renderer.Includes(inputs...)
+}
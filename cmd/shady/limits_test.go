@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSubmissionLimitsCheck(t *testing.T) {
+	dir := t.TempDir()
+	shader := filepath.Join(dir, "shader.glsl")
+	src := `
+void mainImage(out vec4 c, in vec2 p) {
+	for (int i = 0; i < 100; i++) c += vec4(0.01);
+}
+`
+	if err := os.WriteFile(shader, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lim := submissionLimits{
+		MaxWidth:          1920,
+		MaxHeight:         1080,
+		MaxDuration:       10 * time.Second,
+		MaxLoopIterations: 100,
+	}
+	spec := jobSpec{Inputs: []string{shader}, Geometry: "1920x1080", Framerate: 30, Duration: 10}
+
+	tests := []struct {
+		name  string
+		edit  func(*jobSpec, *submissionLimits)
+		limit string
+	}{
+		{"within limits", func(*jobSpec, *submissionLimits) {}, ""},
+		{"too wide", func(s *jobSpec, _ *submissionLimits) { s.Geometry = "1921x1080" }, "max-resolution"},
+		{"too high", func(s *jobSpec, _ *submissionLimits) { s.Geometry = "1080x1920" }, "max-resolution"},
+		{"too long", func(s *jobSpec, _ *submissionLimits) { s.Duration = 11 }, "max-duration"},
+		{"too many frames", func(s *jobSpec, _ *submissionLimits) { s.Duration, s.Frames = 0, 301 }, "max-duration"},
+		{"frames end early", func(s *jobSpec, _ *submissionLimits) { s.Duration, s.Frames = 60, 300 }, ""},
+		{"too many iterations", func(_ *jobSpec, l *submissionLimits) { l.MaxLoopIterations = 99 }, "max-loop-iterations"},
+		{"no limits", func(s *jobSpec, l *submissionLimits) {
+			*l, s.Geometry, s.Duration = submissionLimits{}, "7680x4320", 3600
+		}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, lim := spec, lim
+			test.edit(&spec, &lim)
+			err := lim.check(spec)
+			var r *rejection
+			if test.limit == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !errors.As(err, &r) {
+				t.Fatalf("expected a rejection by %s, got %v", test.limit, err)
+			} else if r.Limit != test.limit {
+				t.Fatalf("expected a rejection by %s, got %s", test.limit, r.Limit)
+			}
+		})
+	}
+
+	if err := lim.check(jobSpec{Inputs: []string{shader}, Geometry: "wide"}); err == nil {
+		t.Fatal("expected an invalid geometry to be an error")
+	}
+}
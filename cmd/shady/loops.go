@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	commentRe     = regexp.MustCompile(`(?s)//[^\n]*|/\*.*?\*/`)
+	defineRe      = regexp.MustCompile(`(?m)^\s*#\s*define\s+(\w+)\s+\(?\s*([-+]?[0-9.]+)\s*\)?\s*$`)
+	constRe       = regexp.MustCompile(`\bconst\s+(?:int|uint|float)\s+(\w+)\s*=\s*([-+]?[0-9.]+)[uf]?\s*;`)
+	loopKeywordRe = regexp.MustCompile(`\b(for|while)\s*\(`)
+	// loopHeaderRe matches the common form of a for loop header:
+	// "int i = A; i < B; i++", or with a step of "i += C".
+	loopHeaderRe = regexp.MustCompile(`^\s*(?:int|uint|float)?\s*(\w+)\s*=\s*([\w.+-]+)\s*;\s*(\w+)\s*(<=|<|>=|>|!=)\s*([\w.+-]+)\s*;\s*(?:(\+\+|--)\s*(\w+)|(\w+)\s*(\+\+|--)|(\w+)\s*([+-])=\s*([\w.+-]+))\s*$`)
+)
+
+// A loopEstimate is the estimated number of iterations of a loop, including
+// those of the loops it is nested in.
+type loopEstimate struct {
+	// Line is the line number the loop starts on.
+	Line int
+	// Iterations is +Inf if the number of iterations could not be
+	// determined.
+	Iterations float64
+}
+
+// estimateLoops statically estimates the number of iterations per invocation
+// of the loops in GLSL source code. Loops with constant bounds, which may be
+// defined by #define or const declarations, are recognized. The number of
+// iterations of any other loop, such as a while loop, is unknown.
+//
+// Loops in functions called from within other loops are not multiplied, so
+// the estimate is a lower bound for such shaders.
+func estimateLoops(src string) []loopEstimate {
+	// Blank out comments, retaining newlines for the line numbers.
+	src = commentRe.ReplaceAllStringFunc(src, func(c string) string {
+		return strings.Map(func(r rune) rune {
+			if r == '\n' {
+				return r
+			}
+			return ' '
+		}, c)
+	})
+	consts := map[string]float64{}
+	for _, re := range []*regexp.Regexp{defineRe, constRe} {
+		for _, m := range re.FindAllStringSubmatch(src, -1) {
+			if v, err := strconv.ParseFloat(m[2], 64); err == nil {
+				consts[m[1]] = v
+			}
+		}
+	}
+	value := func(s string) (float64, bool) {
+		if v, ok := consts[s]; ok {
+			return v, true
+		}
+		v, err := strconv.ParseFloat(strings.TrimRight(s, "uf"), 64)
+		return v, err == nil
+	}
+
+	type loop struct {
+		line       int
+		count      float64
+		start, end int
+	}
+	var loops []loop
+	for _, m := range loopKeywordRe.FindAllStringSubmatchIndex(src, -1) {
+		headerStart := m[1]
+		headerEnd := matchingParen(src, headerStart-1)
+		if headerEnd < 0 {
+			continue
+		}
+		l := loop{
+			line:  strings.Count(src[:m[0]], "\n") + 1,
+			count: math.Inf(1),
+			start: headerEnd,
+			end:   loopBodyEnd(src, headerEnd+1),
+		}
+		if src[m[2]:m[3]] == "for" {
+			if n, ok := forIterations(src[headerStart:headerEnd], value); ok {
+				l.count = n
+			}
+		}
+		loops = append(loops, l)
+	}
+
+	estimates := make([]loopEstimate, len(loops))
+	for i, l := range loops {
+		total := l.count
+		for _, outer := range loops {
+			if outer.start < l.start && l.start < outer.end {
+				total *= outer.count
+			}
+		}
+		estimates[i] = loopEstimate{Line: l.line, Iterations: total}
+	}
+	return estimates
+}
+
+// forIterations computes the number of iterations of a for loop from its
+// header.
+func forIterations(header string, value func(string) (float64, bool)) (float64, bool) {
+	m := loopHeaderRe.FindStringSubmatch(header)
+	if m == nil {
+		return 0, false
+	}
+	variable, op := m[1], m[4]
+	start, ok1 := value(m[2])
+	end, ok2 := value(m[5])
+	if !ok1 || !ok2 || m[3] != variable {
+		return 0, false
+	}
+	var step float64
+	switch {
+	case m[6] != "":
+		if m[7] != variable {
+			return 0, false
+		}
+		step = map[string]float64{"++": 1, "--": -1}[m[6]]
+	case m[8] != "":
+		if m[8] != variable {
+			return 0, false
+		}
+		step = map[string]float64{"++": 1, "--": -1}[m[9]]
+	default:
+		s, ok := value(m[12])
+		if !ok || m[10] != variable {
+			return 0, false
+		}
+		step = s
+		if m[11] == "-" {
+			step = -s
+		}
+	}
+	if step == 0 {
+		return 0, false
+	}
+	n := (end - start) / step
+	if n < 0 {
+		// The loop does not run at all, unless it never terminates.
+		return 0, op != "!="
+	}
+	if op == "<=" || op == ">=" {
+		n = math.Floor(n) + 1
+	} else {
+		n = math.Ceil(n)
+	}
+	return n, true
+}
+
+// matchingParen returns the index of the parenthesis closing the one at i.
+func matchingParen(src string, i int) int {
+	depth := 0
+	for ; i < len(src); i++ {
+		switch src[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// loopBodyEnd returns the index at which the body of a loop starting at i
+// ends. The body is either a block or a single statement.
+func loopBodyEnd(src string, i int) int {
+	for i < len(src) && strings.ContainsRune(" \t\r\n", rune(src[i])) {
+		i++
+	}
+	if i < len(src) && src[i] == '{' {
+		depth := 0
+		for ; i < len(src); i++ {
+			switch src[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return len(src)
+	}
+	// A single statement, which may itself be a loop.
+	if m := loopKeywordRe.FindStringIndex(src[i:]); m != nil && m[0] == 0 {
+		if end := matchingParen(src, i+m[1]-1); end >= 0 {
+			return loopBodyEnd(src, end+1)
+		}
+	}
+	if end := strings.IndexByte(src[i:], ';'); end >= 0 {
+		return i + end + 1
+	}
+	return len(src)
+}
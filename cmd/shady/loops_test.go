@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateLoops(t *testing.T) {
+	src := `
+#define STEPS 64
+const int SAMPLES = 4;
+// for (int k = 0; k < 1000000; k++)
+void mainImage(out vec4 c, in vec2 p) {
+	for (int i = 0; i < STEPS; i++) {
+		for (int j = SAMPLES; j > 0; j--)
+			c += vec4(1.0);
+	}
+	for (float x = 0.0; x <= 1.0; x += 0.25) c += vec4(x);
+	while (c.r > 0.0) { c.r -= 1.0; }
+}
+`
+	estimates := estimateLoops(src)
+	exp := []loopEstimate{
+		{Line: 6, Iterations: 64},
+		{Line: 7, Iterations: 256},
+		{Line: 10, Iterations: 5},
+		{Line: 11, Iterations: math.Inf(1)},
+	}
+	if len(estimates) != len(exp) {
+		t.Fatalf("unexpected estimates: %v", estimates)
+	}
+	for i, e := range exp {
+		if estimates[i] != e {
+			t.Errorf("loop %d: exp %v, got %v", i, e, estimates[i])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import "fmt"
+
+// ltcSync is the sync word that ends every LTC frame, in the order in which
+// its bits are transmitted.
+var ltcSync = [16]byte{0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 1}
+
+// An ltcFrame is a timecode decoded from linear timecode audio.
+type ltcFrame struct {
+	hours, minutes, seconds, frames int
+	dropFrame                       bool
+	// end is the index of the sample at which the frame ended, which is
+	// the start of the frame after the one labeled by the timecode.
+	end int64
+}
+
+func (f ltcFrame) String() string {
+	sep := ":"
+	if f.dropFrame {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", f.hours, f.minutes, f.seconds, sep, f.frames)
+}
+
+// An ltcDecoder decodes SMPTE linear timecode from audio samples. LTC encodes
+// 80 bits per frame with biphase mark code: the level changes at the start of
+// every bit and a 1 also changes it halfway the bit. The duration of a bit is
+// tracked, so the speed may vary somewhat.
+type ltcDecoder struct {
+	// period is the estimated number of samples per bit.
+	period float64
+	// level is the sign of the signal, with hysteresis to reject noise.
+	level int
+	// since is the number of samples since the level last changed.
+	since int
+	// half is set after the first half of a 1.
+	half bool
+	bits [80]byte
+	// n is the number of samples that were decoded.
+	n int64
+}
+
+// newLTCDecoder creates a decoder for timecode at the number of frames per
+// second, sampled at the sample rate.
+func newLTCDecoder(sampleRate int, fps float64) *ltcDecoder {
+	return &ltcDecoder{period: float64(sampleRate) / (fps * 80)}
+}
+
+// decode processes samples and returns the frames that ended in them.
+func (d *ltcDecoder) decode(samples []int16) []ltcFrame {
+	const threshold = 1024
+	var frames []ltcFrame
+	for _, s := range samples {
+		d.n++
+		d.since++
+		level := d.level
+		if s > threshold {
+			level = 1
+		} else if s < -threshold {
+			level = -1
+		}
+		if level == d.level {
+			continue
+		}
+		d.level = level
+		interval := float64(d.since)
+		d.since = 0
+		if interval < d.period*0.75 {
+			// Half of a 1.
+			d.period = d.period*0.9 + interval*2*0.1
+			if d.half = !d.half; d.half {
+				continue
+			}
+			d.push(1)
+		} else if interval < d.period*1.5 {
+			d.period = d.period*0.9 + interval*0.1
+			d.half = false
+			d.push(0)
+		} else {
+			// A dropout or the first transition.
+			d.half = false
+			continue
+		}
+		if f, ok := d.frame(); ok {
+			frames = append(frames, f)
+		}
+	}
+	return frames
+}
+
+func (d *ltcDecoder) push(bit byte) {
+	copy(d.bits[:], d.bits[1:])
+	d.bits[len(d.bits)-1] = bit
+}
+
+// frame returns the frame of the last 80 bits, if they end with the sync
+// word.
+func (d *ltcDecoder) frame() (ltcFrame, bool) {
+	for i, b := range ltcSync {
+		if d.bits[64+i] != b {
+			return ltcFrame{}, false
+		}
+	}
+	field := func(start, n int) int {
+		v := 0
+		for i := n - 1; i >= 0; i-- {
+			v = v<<1 | int(d.bits[start+i])
+		}
+		return v
+	}
+	f := ltcFrame{
+		frames:    field(0, 4) + field(8, 2)*10,
+		dropFrame: d.bits[10] == 1,
+		seconds:   field(16, 4) + field(24, 3)*10,
+		minutes:   field(32, 4) + field(40, 3)*10,
+		hours:     field(48, 4) + field(56, 2)*10,
+		end:       d.n - 1,
+	}
+	// The sync word can not occur elsewhere in a frame, so it is enough to
+	// reject invalid values.
+	if f.frames >= 30 || f.seconds >= 60 || f.minutes >= 60 || f.hours >= 24 {
+		return ltcFrame{}, false
+	}
+	return f, true
+}
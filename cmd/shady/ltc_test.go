@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+// encodeLTC returns the biphase mark code of a frame, with samplesPerBit
+// samples per bit, starting at the level.
+func encodeLTC(f ltcFrame, samplesPerBit int, level *int16) []int16 {
+	var bits [80]byte
+	set := func(start, n, v int) {
+		for i := 0; i < n; i++ {
+			bits[start+i] = byte(v >> i & 1)
+		}
+	}
+	set(0, 4, f.frames%10)
+	set(8, 2, f.frames/10)
+	if f.dropFrame {
+		bits[10] = 1
+	}
+	set(16, 4, f.seconds%10)
+	set(24, 3, f.seconds/10)
+	set(32, 4, f.minutes%10)
+	set(40, 3, f.minutes/10)
+	set(48, 4, f.hours%10)
+	set(56, 2, f.hours/10)
+	copy(bits[64:], ltcSync[:])
+
+	var samples []int16
+	for _, b := range bits {
+		*level = -*level
+		for i := 0; i < samplesPerBit; i++ {
+			if b == 1 && i == samplesPerBit/2 {
+				*level = -*level
+			}
+			samples = append(samples, *level)
+		}
+	}
+	return samples
+}
+
+func TestLTCDecoder(t *testing.T) {
+	// 25 fps at 48kHz is 24 samples per bit.
+	d := newLTCDecoder(48000, 25)
+	level := int16(8000)
+	var samples []int16
+	expected := []ltcFrame{
+		{hours: 1, minutes: 2, seconds: 3, frames: 4},
+		{hours: 1, minutes: 2, seconds: 3, frames: 5},
+		{hours: 23, minutes: 59, seconds: 59, frames: 24},
+	}
+	// Some silence, then a bit faster than nominal.
+	samples = append(samples, make([]int16, 100)...)
+	for _, f := range expected {
+		samples = append(samples, encodeLTC(f, 23, &level)...)
+	}
+	// The last bit is decoded at the next transition.
+	samples = append(samples, -level)
+
+	var frames []ltcFrame
+	for i := 0; i < len(samples); i += 240 {
+		end := i + 240
+		if end > len(samples) {
+			end = len(samples)
+		}
+		frames = append(frames, d.decode(samples[i:end])...)
+	}
+	if len(frames) != len(expected) {
+		t.Fatalf("expected %d frames, got %v", len(expected), frames)
+	}
+	for i, f := range frames {
+		e := expected[i]
+		e.end = int64(100 + (i+1)*80*23)
+		if f != e {
+			t.Errorf("expected %v ending at %d, got %v ending at %d", e, e.end, f, f.end)
+		}
+	}
+	if s := frames[2].String(); s != "23:59:59:24" {
+		t.Errorf("unexpected timecode: %q", s)
+	}
+}
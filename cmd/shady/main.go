@@ -11,23 +11,37 @@ import (
 	_ "image/png"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
+	"github.com/polyfloyd/shady/egl"
 	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/glslsandbox"
+	"github.com/polyfloyd/shady/plugin"
 	"github.com/polyfloyd/shady/renderer"
 	"github.com/polyfloyd/shady/shadertoy"
 	_ "github.com/polyfloyd/shady/shadertoy/audio"
+	_ "github.com/polyfloyd/shady/shadertoy/camera"
+	_ "github.com/polyfloyd/shady/shadertoy/data"
+	_ "github.com/polyfloyd/shady/shadertoy/gradient"
 	_ "github.com/polyfloyd/shady/shadertoy/image"
+	"github.com/polyfloyd/shady/shadertoy/lut"
+	_ "github.com/polyfloyd/shady/shadertoy/palette"
+	_ "github.com/polyfloyd/shady/shadertoy/pdf"
 	_ "github.com/polyfloyd/shady/shadertoy/peripheral"
+	_ "github.com/polyfloyd/shady/shadertoy/svg"
+	_ "github.com/polyfloyd/shady/shadertoy/text"
 	_ "github.com/polyfloyd/shady/shadertoy/video"
+	_ "github.com/polyfloyd/shady/shadertoy/webcam"
 )
 
 func main() {
@@ -36,19 +50,49 @@ func main() {
 	// OpenGL contexts are bounds to threads.
 	runtime.LockOSThread()
 
-	formatNames := make([]string, 0, len(encode.Formats))
-	for name := range encode.Formats {
-		formatNames = append(formatNames, name)
+	if err := applySandbox(); err != nil {
+		log.Fatal(err)
 	}
 
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			switch err := cmd(os.Args[2:]); {
+			case errors.Is(err, flag.ErrHelp):
+			case errors.Is(err, errUsage):
+				os.Exit(2)
+			case errors.Is(err, errCommandFailed):
+				os.Exit(1)
+			case err != nil:
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	// The built in sinks are registered first, as they take precedence over
+	// those of plugins.
+	var sinks sinkSettings
+	sinks.flags(flag.CommandLine)
+	registerSinks(&sinks)
+	// Make the sources and sinks of external plugins available.
+	plugin.Discover(os.Stderr)
+
+	formatNames := encode.FormatNames()
+
 	var inputFiles arrayFlags
 	flag.Var(&inputFiles, "i", "The shader file(s) to use")
+	var includePaths arrayFlags
+	flag.Var(&includePaths, "I", "Add a directory to search for files included with #include")
+	projectFile := flag.String("p", "", "Load inputs and default settings from a project file")
+	env := flag.String("env", "shadertoy", "The shader environment to use. Valid values are: "+strings.Join(environmentNames, ", "))
 	outputFile := flag.String("o", "-", "The file to write the rendered image to")
 	geometry := flag.String("g", "env", "The geometry of the rendered image in WIDTHxHEIGHT format. If \"env\", look for the LEDCAT_GEOMETRY variable")
-	outputFormat := flag.String("ofmt", "x11", "The encoding format to use to output the image. Valid values are: "+strings.Join(append(formatNames, "x11"), ", "))
+	outputFormat := flag.String("ofmt", "x11", "The encoding format to use to output the image. Valid values are: "+strings.Join(append(append(formatNames, encode.Sinks()...), "x11"), ", ")+", or the MIME type of a format, e.g. image/png. If not set, the format is detected from the extension of -o, e.g. example.png or example.mp4, and the output is shown in a window otherwise. With shm, -o is the name of a shared memory ring buffer. With zmq, -o is the endpoint of a ZeroMQ PUB socket, e.g. tcp://*:5556")
 	framerate := flag.Float64("f", 0, "Whether to animate using the specified number of frames per second")
 	numFrames := flag.Uint("n", 0, "Limit the number of frames in the animation. No limit is set by default")
 	duration := flag.Float64("d", 0.0, "Limit the animation to the specified number of seconds. No limit is set by default")
+	startTime := flag.Float64("start", 0, "The time of the animation in seconds at which the first frame is rendered, e.g. to render a specific moment again")
+	speed := flag.Float64("speed", 1, "The speed at which the animation plays, e.g. 0.25 for slow motion. The frame rate and -d apply to the output, so they are not affected")
 	framerateOld := flag.Float64("framerate", 0, "Whether to animate using the specified number of frames per second")
 	numFramesOld := flag.Uint("numframes", 0, "Limit the number of frames in the animation. No limit is set by default")
 	durationOld := flag.Float64("duration", 0.0, "Limit the animation to the specified number of seconds. No limit is set by default")
@@ -57,10 +101,112 @@ func main() {
 	watch := flag.Bool("w", false, "Watch the shader source files for changes")
 	glslVersion := flag.String("glsl", "330", "The GLSL version to use")
 	openGLVersionStr := flag.String("opengl", "glsl", "The OpenGL version to use. If \"glsl\", the version is inferred from the requested GLSL version")
+	eglPlatform := flag.String("egl-platform", "default", eglPlatformUsage)
+	stereoLayout := flag.String("stereo", "none", "Render the shader once for each eye. Valid values are: none, sbs (side-by-side), ou (over-under)")
+	tiles := flag.Int("tile", 1, "Repeat the shader NxN times over the canvas to preview whether it tiles seamlessly. Each tile has the full resolution divided by N")
+	tileOffset := flag.Bool("tile-offset", false, "Shift the shader by half a tile, so the edges of the output meet in the middle of the canvas")
+	compat := flag.Bool("compat", false, "Run Shadertoy shaders copied from shadertoy.com unmodified: iFrame is an int and unmapped iChannels are empty textures")
+	projection := flag.String("projection", "none", "Render a panorama by calling mainVR or mainCubemap with a ray per pixel. Valid values are: none, equirect, cubemap")
+	eyeSeparation := flag.Float64("eye-separation", 0.064, "The distance between the eyes when rendering stereoscopically")
+	floatPrecision := flag.Bool("float", false, "Keep the previous frame and buffers at 32-bit float precision, for feedback shaders such as simulations")
+	samples := flag.Uint("samples", 1, "The number of sub-frames to render and average for each output frame")
+	shutter := flag.Float64("shutter", 0.5, "The fraction of the frame interval over which sub-frames are spread in time for motion blur")
+	lutFile := flag.String("lut", "", "Grade the output with a 3D lookup table in the .cube or .3dl format")
+	lutStrength := flag.Float64("lut-strength", 1, "Mix between the original (0) and the graded (1) colors of -lut")
+	overlayFile := flag.String("overlay", "", "Composite an image or HUD shader (.glsl) over the output")
+	overlayPos := flag.String("overlay-pos", "bottom-right", "The position of the overlay. Valid values are: top-left, top-right, bottom-left, bottom-right, center")
+	overlayOpacity := flag.Float64("overlay-opacity", 1, "The opacity of the overlay")
+	overlayMargin := flag.Uint("overlay-margin", 16, "The distance in pixels between the overlay and the edges of the output")
+	overlaySize := flag.String("overlay-size", "", "The size of the overlay in WIDTHxHEIGHT format. Defaults to the size of the image, or of the output for shaders")
+	textTemplate := flag.String("text", "", "Overlay text rendered from a template, e.g. \"{{fps}} fps, t={{time}}\". Available functions: fps, time, frame, timecode, uniform \"NAME\"")
+	textFont := flag.String("text-font", "", "The TrueType font to render -text with. Defaults to Go Mono")
+	textSize := flag.Float64("text-size", 16, "The size of the -text font in pixels")
+	textPos := flag.String("text-pos", "top-left", "The position of the text. Valid values are the same as for -overlay-pos")
+	burnTimecode := flag.Bool("timecode", false, "Burn the SMPTE timecode of every frame into the output, for aligning footage with separately recorded audio. Requires -f")
+	timecodeStart := flag.String("timecode-start", "00:00:00:00", "The timecode of the first frame in HH:MM:SS:FF format")
+	timecodePos := flag.String("timecode-pos", "bottom-left", "The position of the timecode. Valid values are the same as for -overlay-pos")
+	statusScreen := flag.Bool("status-screen", false, "Show a status screen with the error and network information instead of exiting when the shader fails to load")
+	initTimeout := flag.Float64("init-timeout", 0, "Fail if setting up OpenGL takes longer than the specified number of seconds, e.g. because of a broken driver. No limit is set by default")
+	statusURL := flag.String("status-url", "", "A URL shown as a QR code on the status screen, e.g. of a control interface")
+	service := flag.Bool("service", false, "Run as a supervised service: notify systemd when ready, ping its watchdog and restart rendering on OpenGL errors")
+	healthzAddr := flag.String("healthz", "", "Serve a /healthz endpoint reporting whether frames are being rendered on the specified address, e.g. :8080")
+	metricsAddr := flag.String("metrics", "", "Serve Prometheus metrics at /metrics on the specified address, e.g. :8080")
+	depthFile := flag.String("depth", "", "Also write the depth output of the shader (shady_fragDepth) to the specified file as a grayscale image, or as a NumPy array of the raw values if the name ends in .npy. Set to zmq to publish it with -ofmt zmq instead")
+	depthRange := flag.String("depth-range", "0:1", "The range of depth values mapped from black to white in NEAR:FAR format")
+	motionFile := flag.String("motion", "", "Also write motion vectors to the specified file. Set to zmq to publish them with -ofmt zmq instead")
+	motionSource := flag.String("motion-source", "shader", "Where motion vectors come from. Valid values are: shader (shady_fragMotion), estimate (derived from frame differences)")
+	motionScale := flag.Float64("motion-scale", 16, "The motion in pixels per frame that is mapped to the full range of the motion output")
+	metadataFile := flag.String("metadata", "", "Also write the number, time and uniform values of every frame as JSON lines to the specified file")
 	var shadertoyMappings arrayFlags
 	flag.Var(&shadertoyMappings, "map", "Specify or override ShaderToy input mappings")
+	templateFile := flag.String("template-data", "", "Preprocess the sources as Go templates with the data from the specified JSON file")
+	var templateVars arrayFlags
+	flag.Var(&templateVars, "template-var", "Preprocess the sources as Go templates, setting a variable in the data as NAME=VALUE. VALUE is parsed as JSON if possible")
+	outputFramerate := flag.Float64("ofps", 0, "Write the output at the specified number of frames per second instead of the rate of -f, dropping or repeating rendered frames, e.g. -f 60 -ofps 30 to render smoothly for a preview while recording at 30 fps. Sinks may request a rate of their own")
+	outputBlend := flag.Bool("ofps-blend", false, "Blend the two nearest rendered frames for -ofps instead of dropping or repeating them")
+	clockSource := flag.String("clock", "system", "The clock that paces -rt. Valid values are: system, audio[:DEVICE] (the sample clock of an audio input, so long recordings do not drift from audio recorded on the same device) and ltc[:DEVICE] (SMPTE linear timecode on an audio input, of which -timecode-start is the time of the first frame)")
+	interlace := flag.String("interlace", "none", "Render fields at twice the frame rate and weave them into interlaced frames. Valid values are: none, tff (top field first), bff (bottom field first)")
+	pulldown := flag.Bool("pulldown", false, "Render at 4/5 of the frame rate, e.g. 23.976 fps for -f 29.97, and apply 2:3 pulldown to produce interlaced frames. Implies -interlace tff unless set")
+	mousePos := flag.String("mouse", "", "Render as if the mouse button is held at X,Y pixels from the bottom left, for interactive shaders that read iMouse or mouse. The window sets the mouse from the actual cursor")
+	hdrBits := flag.Int("hdr", 0, "Render and read back colors as 16 or 32-bit floats without clamping them to 1.0, for -ofmt exr, hdr and npy. Defaults to 32 for exr, hdr and 16-bit tiff. With 16, EXR files store half floats")
+	transferName := flag.String("transfer", "none", "Encode the linear output of the shader with a transfer function and tag -ofmt png and y4m accordingly. Valid values are: none, srgb, bt709, hlg (HDR), pq (HDR)")
+	hdrWhite := flag.Float64("hdr-white", 203, "The luminance of 1.0 in cd/m² with -transfer pq")
+	iccProfile := flag.String("icc", "none", "Embed an ICC profile in -ofmt png, jpg and tiff output, so the colors are interpreted consistently by viewers and browsers. Valid values are: none, srgb or the path of a .icc file")
+	tiffBits := flag.Int("tiff-bits", 8, "The number of bits per channel of -ofmt tiff, 8 or 16. 16-bit files are rendered with -hdr 32 to keep the precision of the shader")
+	var gif gifSettings
+	gif.flags(flag.CommandLine)
+	var changes changeSettings
+	changes.flags(flag.CommandLine)
+	errorOverlayEnabled := flag.Bool("error-overlay", true, "With -w, keep rendering the last version of the shader that loaded when a change fails to load, and show the error over it")
+	vsync := flag.Bool("vsync", true, "Synchronize the window to the refresh rate of the display")
+	historySize := flag.Int("history", 8, "The number of previous versions of the shader that are kept with -w in a window, to roll back to with the Z key")
+	var clips clipSettings
+	clips.flags(flag.CommandLine)
 	flag.Parse()
 
+	var proj *project
+	var live *liveProject
+	if *projectFile != "" {
+		var err error
+		proj, err = loadProject(*projectFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		live = &liveProject{
+			filename: *projectFile,
+			inputs:   len(inputFiles) == 0,
+			mappings: len(shadertoyMappings) == 0,
+			proj:     proj,
+		}
+		if len(inputFiles) == 0 {
+			inputFiles = proj.inputFiles()
+		}
+		if err := proj.applyDefaults(flag.CommandLine); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := applyConfigDefaults(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	// Rendering to a file does not require -ofmt if its extension is known.
+	ofmtSet := false
+	flag.Visit(func(f *flag.Flag) {
+		ofmtSet = ofmtSet || f.Name == "ofmt"
+	})
+	if _, ok := encode.DetectFormat(*outputFile); ok && !ofmtSet && *outputFile != "-" {
+		*outputFormat = ""
+	}
+	if err := selectPlatform(*eglPlatform); err != nil {
+		log.Fatal(err)
+	}
+	if err := configureGIF(gif); err != nil {
+		log.Fatal(err)
+	}
+	if err := configureTIFF(*tiffBits); err != nil {
+		log.Fatal(err)
+	}
+	renderer.IncludePaths = includePaths
+
 	if len(inputFiles) == 0 {
 		log.Fatalf("Please specify at least one GLSL file with -i")
 	}
@@ -96,34 +242,117 @@ func main() {
 	if *framerate <= 0 {
 		animateNumFrames = 1
 	}
+	if changes.skip && animateNumFrames > 0 {
+		log.Fatalf("-skip-unchanged can only be used when animating indefinitely")
+	}
 	if *realtime && *framerate == 0 {
 		log.Fatalf("-rt is set while -framerate is not set")
 	}
+	if *clockSource != "system" && !*realtime {
+		log.Fatalf("-clock is set while -rt is not set")
+	}
+	if *clockSource != "system" && changes.skip {
+		log.Fatalf("-clock can not be combined with -skip-unchanged")
+	}
+	if *outputFramerate != 0 && *framerate == 0 {
+		log.Fatalf("-ofps is set while -framerate is not set")
+	}
 	interval := time.Duration(float64(time.Second) / *framerate)
+	if *burnTimecode && *framerate == 0 {
+		log.Fatalf("-timecode is set while -framerate is not set")
+	}
+	var tc timecode
+	if *framerate > 0 {
+		var err error
+		if tc, err = newTimecode(interval, *timecodeStart); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	layout, err := renderer.ParseStereoLayout(*stereoLayout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if layout != renderer.StereoNone && *env != "shadertoy" {
+		log.Fatalf("-stereo is only supported by the shadertoy environment")
+	}
+	stereo := renderer.Stereo{Layout: layout, Separation: float32(*eyeSeparation)}
+	panorama, err := shadertoy.ParseProjection(*projection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if panorama != shadertoy.ProjectionNone && *env != "shadertoy" {
+		log.Fatalf("-projection is only supported by the shadertoy environment")
+	}
+	tiling := shadertoy.Tiling{Tiles: *tiles, Offset: *tileOffset}
+	if (*tiles != 1 || *tileOffset) && *env != "shadertoy" {
+		log.Fatalf("-tile and -tile-offset are only supported by the shadertoy environment")
+	}
+	var auxOutputs []auxOutput
+	var shaderOutputs []renderer.Output
+	if *depthFile != "" {
+		output, err := depthOutput(*depthFile, *depthRange)
+		if err != nil {
+			log.Fatal(err)
+		}
+		auxOutputs = append(auxOutputs, output)
+		shaderOutputs = append(shaderOutputs, renderer.OutputDepth)
+	}
+	if *motionFile != "" {
+		output, fromShader, err := motionOutput(*motionFile, *motionSource, float32(*motionScale))
+		if err != nil {
+			log.Fatal(err)
+		}
+		auxOutputs = append(auxOutputs, output)
+		if fromShader {
+			shaderOutputs = append(shaderOutputs, renderer.OutputMotion)
+		}
+	}
+	if len(shaderOutputs) > 0 && *env != "shadertoy" {
+		log.Fatalf("-depth and -motion are only supported by the shadertoy environment")
+	}
+	if len(auxOutputs) > 0 && *hdrBits != 0 {
+		log.Fatalf("-depth and -motion can not be combined with -hdr")
+	}
+	// Interlaced output is woven from frames rendered at another rate.
+	renderInterval, renderNumFrames := interval, animateNumFrames
+	cadence, err := parseFieldCadence(*interlace, *pulldown)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cadence != nil {
+		if *framerate == 0 {
+			log.Fatalf("-interlace or -pulldown is set while -framerate is not set")
+		}
+		if len(auxOutputs) > 0 || *burnTimecode || *metadataFile != "" {
+			log.Fatalf("-interlace and -pulldown can not be combined with -depth, -motion, -timecode or -metadata")
+		}
+		if *hdrBits != 0 {
+			log.Fatalf("-interlace and -pulldown can not be combined with -hdr")
+		}
+		renderInterval, renderNumFrames = cadence.renderTiming(interval, animateNumFrames)
+		y4m := encode.Formats["y4m"].(encode.Y4MFormat)
+		y4m.FieldOrder = cadence.order
+		encode.Formats["y4m"] = y4m
+	}
+	outInterval, err := outputInterval(interval, *outputFramerate)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go func() {
 		sig := make(chan os.Signal, 1)
-		signal.Notify(sig, os.Interrupt)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 		<-sig
 		signal.Stop(sig)
 		cancel()
 	}()
 
-	var openGLVersion renderer.OpenGLVersion
-	if *openGLVersionStr == "glsl" {
-		var err error
-		openGLVersion, err = renderer.OpenGLVersionFromGLSLVersion(*glslVersion)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		var err error
-		openGLVersion, err = renderer.ParseOpenGLVersion(*openGLVersionStr)
-		if err != nil {
-			log.Fatal(err)
-		}
+	openGLVersion, err := resolveOpenGLVersion(*openGLVersionStr, *glslVersion)
+	if err != nil {
+		log.Fatal(err)
 	}
 	if *verbose {
 		log.Printf("OpenGL version: %s", openGLVersion)
@@ -131,41 +360,112 @@ func main() {
 	}
 
 	newFn := func() (renderer.Environment, []string, error) {
-		sources, err := renderer.Includes([]string(inputFiles)...)
-		if err != nil {
-			return nil, sources, err
+		files, mappings, proj := inputFiles, []string(shadertoyMappings), proj
+		if live != nil {
+			live.reload()
+			files, mappings, proj = live.scene(files, mappings)
 		}
-
-		mappings := make([]shadertoy.Mapping, 0, len(shadertoyMappings))
-		for _, str := range shadertoyMappings {
-			m, err := shadertoy.ParseMapping(str, ".")
-			if err != nil {
-				return nil, sources, err
-			}
-			mappings = append(mappings, m)
+		var environment renderer.Environment
+		var sources []string
+		templateData, err := loadTemplateData(proj, *templateFile, templateVars)
+		if err == nil {
+			environment, sources, err = newEnvironment(*env, files, mappings, *glslVersion, proj, templateData)
 		}
-		env, err := shadertoy.NewShaderToy(
-			renderer.SourceFiles(sources...),
-			mappings,
-			*glslVersion,
-		)
-		return env, sources, err
+		if st, ok := environment.(*shadertoy.ShaderToy); ok {
+			st.SetProjection(panorama)
+			st.SetTiling(tiling)
+			st.SetOutputs(shaderOutputs...)
+			st.SetCompatible(*compat)
+		}
+		// Watch the template data and project file along with the sources.
+		if *templateFile != "" {
+			sources = append(sources, *templateFile)
+		}
+		if live != nil {
+			sources = append(sources, live.filename)
+		}
+		return environment, sources, err
 	}
 
 	// Check whether we should render directly to an onscreen window. This is a
 	// separate rendering path.
 	if *outputFormat == "x11" {
-		engine, err := renderer.NewOnScreenEngine(openGLVersion)
+		if len(auxOutputs) > 0 {
+			log.Fatalf("-depth and -motion can not be used when rendering to a window")
+		}
+		if *samples > 1 {
+			log.Fatalf("-samples can not be used when rendering to a window")
+		}
+		if *floatPrecision {
+			log.Fatalf("-float can not be used when rendering to a window")
+		}
+		// The health checks, watchdog and metrics are driven by the frames
+		// that are output, which a window does not produce. A window is
+		// also closed by hand, which a service manager would restart.
+		if *service || *healthzAddr != "" || *metricsAddr != "" {
+			log.Fatalf("-service, -healthz and -metrics can not be used when rendering to a window, as they monitor the frames that are output")
+		}
+		if *overlayFile != "" || *textTemplate != "" || *burnTimecode {
+			log.Fatalf("-overlay, -text and -timecode can not be used when rendering to a window")
+		}
+		if *mousePos != "" {
+			log.Fatalf("-mouse can not be used when rendering to a window")
+		}
+		if changes.skip {
+			log.Fatalf("-skip-unchanged can not be used when rendering to a window")
+		}
+		if *lutFile != "" || *transferName != "none" || *hdrBits != 0 {
+			log.Fatalf("-lut, -transfer and -hdr can not be used when rendering to a window")
+		}
+		if cadence != nil {
+			log.Fatalf("-interlace and -pulldown can not be used when rendering to a window")
+		}
+		initCtx, cancelInit := withInitTimeout(*initTimeout)
+		engine, err := renderer.NewOnScreenEngineContext(initCtx, openGLVersion)
+		cancelInit()
 		if err != nil {
 			log.Fatalf("Could initialize engine: %v", err)
 		}
 		defer engine.Close()
-
+		logToStderr(engine)
+		engine.SetStereo(stereo)
+		if err := engine.SetTimeRange(time.Duration(*startTime*float64(time.Second)), *speed); err != nil {
+			log.Fatalf("-speed: %v", err)
+		}
+		// The status screen and error overlay are laid out for the initial
+		// size of the window.
+		width, height := engine.Size()
+		var fallback func(error) renderer.Environment
+		if *statusScreen {
+			fallback = statusFallback(*statusURL, width, height, *glslVersion)
+			engine.SetFallback(fallback)
+		}
+		engine.SetVSync(*vsync)
+		var reporter *overlayReporter
+		if *watch && *errorOverlayEnabled {
+			if reporter, err = configureErrorOverlay(engine, width, fallback); err != nil {
+				log.Fatalf("Could not set error overlay: %v", err)
+			}
+		}
 		if *watch {
+			engine.SetHistory(*historySize)
+		}
+		engine.SetControls(previewControls(engine, newFn, fallback, reporter, clips))
+
+		if live != nil {
+			go reloadProject(ctx, engine, newFn, fallback, live, !*watch)
+		}
+		if reporter != nil {
+			go watchEnvironment(ctx, reporter, newFn)
+		} else if *watch && fallback != nil {
+			go watchEnvironment(ctx, fallbackReporter{engine, fallback}, newFn)
+		} else if *watch {
 			go watchEnvironment(ctx, engine, newFn)
 		} else {
 			env, _, err := newFn()
-			if err != nil {
+			if err != nil && fallback != nil {
+				env = fallback(err)
+			} else if err != nil {
 				log.Fatal(err)
 			}
 			engine.SetEnvironment(env)
@@ -185,56 +485,390 @@ func main() {
 		log.Fatalf("%v", err)
 	}
 
-	engine, err := renderer.NewShader(width, height, openGLVersion)
+	initCtx, cancelInit := withInitTimeout(*initTimeout)
+	engine, err := renderer.NewShaderContext(initCtx, width, height, openGLVersion)
+	cancelInit()
 	if err != nil {
 		log.Fatalf("Could initialize engine: %v", err)
 	}
 	defer engine.Close()
-
-	var format encode.Format
-	var ok bool
-	if format, ok = encode.Formats[*outputFormat]; !ok {
-		if format, ok = encode.DetectFormat(*outputFile); !ok {
-			log.Fatalf("Unable to detect output format. Please set the -ofmt flag")
+	logToStderr(engine)
+	engine.SetStereo(stereo)
+	if err := engine.SetTimeRange(time.Duration(*startTime*float64(time.Second)), *speed); err != nil {
+		log.Fatalf("-speed: %v", err)
+	}
+	engine.SetRestartOnError(*service)
+	if err := engine.SetFloatPrecision(*floatPrecision); err != nil {
+		log.Fatal(err)
+	}
+	hdr, err := configureHDR(engine, *hdrBits, *outputFormat, *outputFile, len(auxOutputs) == 0 && cadence == nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var fallback func(error) renderer.Environment
+	if *statusScreen {
+		fallback = statusFallback(*statusURL, width, height, *glslVersion)
+		engine.SetFallback(fallback)
+	}
+	engine.SetAccumulation(renderer.Accumulation{Samples: *samples, Shutter: *shutter})
+	if *mousePos != "" {
+		mouse, err := parseMouse(*mousePos)
+		if err != nil {
+			log.Fatal(err)
+		}
+		engine.SetMouse(mouse)
+	}
+	var realtimeInterval time.Duration
+	if *realtime {
+		realtimeInterval = renderInterval
+	}
+	detector, err := configureChangeDetection(engine, realtimeInterval, changes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if detector != nil {
+		defer detector.Close()
+	}
+	if *lutFile != "" {
+		table, err := lut.Load(*lutFile)
+		if err != nil {
+			log.Fatalf("Could not load LUT: %v", err)
+		}
+		if err := engine.AddPostPass(lut.PostPass(table, float32(*lutStrength))); err != nil {
+			log.Fatalf("Could not set LUT: %v", err)
+		}
+	}
+	if err := configureTransfer(engine, *floatPrecision || hdr, *transferName, *hdrWhite); err != nil {
+		log.Fatalf("Could not set transfer function: %v", err)
+	}
+	if err := configureICC(*iccProfile, *transferName); err != nil {
+		log.Fatalf("Could not set ICC profile: %v", err)
+	}
+	if *overlayFile != "" {
+		ov, err := loadOverlay(*overlayFile, *overlaySize, width, height, *glslVersion)
+		if err != nil {
+			log.Fatalf("Could not load overlay: %v", err)
+		}
+		ov.Opacity = float32(*overlayOpacity)
+		ov.Margin = *overlayMargin
+		if ov.Corner, err = renderer.ParseCorner(*overlayPos); err != nil {
+			log.Fatal(err)
+		}
+		if err := engine.AddOverlay(*ov); err != nil {
+			log.Fatalf("Could not set overlay: %v", err)
+		}
+	}
+	if *textTemplate != "" {
+		text, err := newTextOverlay(*textTemplate, *textFont, *textSize, tc)
+		if err != nil {
+			log.Fatalf("Could not load text overlay: %v", err)
+		}
+		ov := renderer.Overlay{Render: text.Render, Margin: *overlayMargin, Opacity: 1}
+		if ov.Corner, err = renderer.ParseCorner(*textPos); err != nil {
+			log.Fatal(err)
+		}
+		if err := engine.AddOverlay(ov); err != nil {
+			log.Fatalf("Could not set text overlay: %v", err)
+		}
+	}
+	if *burnTimecode {
+		text, err := newTextOverlay("{{timecode}}", *textFont, *textSize, tc)
+		if err != nil {
+			log.Fatalf("Could not load timecode overlay: %v", err)
+		}
+		ov := renderer.Overlay{Render: text.Render, Margin: *overlayMargin, Opacity: 1}
+		if ov.Corner, err = renderer.ParseCorner(*timecodePos); err != nil {
+			log.Fatal(err)
+		}
+		if err := engine.AddOverlay(ov); err != nil {
+			log.Fatalf("Could not set timecode overlay: %v", err)
 		}
 	}
 
 	// Open the output.
-	outWriter, err := openWriter(*outputFile)
+	var encodeOutput func(<-chan image.Image) error
+	sink, isSink, err := encode.OpenSink(*outputFormat, encode.SinkConfig{
+		Target:   *outputFile,
+		Width:    int(width),
+		Height:   int(height),
+		Interval: outInterval,
+	})
 	if err != nil {
-		log.Fatalf("%v", err)
+		log.Fatalf("Could not open output: %v", err)
+	}
+	if isSink {
+		defer sink.Close()
+		outInterval = sinkInterval(sink, outInterval, *outputFramerate)
+		encodeOutput = func(out <-chan image.Image) error {
+			return encode.WriteAll(sink, out)
+		}
+	} else {
+		var format encode.Format
+		var ok bool
+		if format, ok = encode.LookupFormat(*outputFormat); !ok {
+			if format, ok = encode.DetectFormat(*outputFile); !ok {
+				log.Fatalf("Unable to detect output format. Please set the -ofmt flag")
+			}
+		}
+		outWriter, err := openWriter(*outputFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer outWriter.Close()
+		encodeOutput = func(out <-chan image.Image) error {
+			return format.EncodeAnimation(outWriter, out, outInterval)
+		}
 	}
-	defer outWriter.Close()
 
 	in := make(chan image.Image, 10)
 	out := (<-chan image.Image)(in)
-	if animateNumFrames > 0 {
-		out = limitNumFrames(out, animateNumFrames)
+	if renderNumFrames > 0 {
+		out = limitNumFrames(out, renderNumFrames)
 	}
 	if *realtime {
-		out = limitFramerate(out, interval)
+		clock, err := openClock(*clockSource, interval, tc)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if clock != nil {
+			defer clock.Close()
+			out = slaveFramerate(ctx, out, renderInterval, clock)
+		} else {
+			out = limitFramerate(out, renderInterval)
+		}
 	}
 	if *verbose {
-		out = printStats(out, interval, animateNumFrames)
+		out = printStats(out, renderInterval, renderNumFrames)
+	}
+	// Endpoints on the same address share a server.
+	endpoints := map[string]*http.ServeMux{}
+	handle := func(addr, path string, handler http.Handler) {
+		if endpoints[addr] == nil {
+			endpoints[addr] = http.NewServeMux()
+		}
+		endpoints[addr].Handle(path, handler)
+	}
+	if *service || *healthzAddr != "" {
+		timeout := interval * 10
+		if timeout < 5*time.Second {
+			timeout = 5 * time.Second
+		}
+		h := newHealth(timeout)
+		out = h.monitor(out, *service)
+		if *healthzAddr != "" {
+			handle(*healthzAddr, "/healthz", h)
+		}
+	}
+	if *metricsAddr != "" {
+		m := newMetrics(engine, renderInterval)
+		out = m.monitor(out)
+		handle(*metricsAddr, "/metrics", m)
+	}
+	for addr, mux := range endpoints {
+		if err := serveHTTP(ctx, addr, mux); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(shaderOutputs) > 0 {
+		if err := engine.EnableOutputs(shaderOutputs...); err != nil {
+			log.Fatalf("Could not enable shader outputs: %v", err)
+		}
+	}
+	if *metadataFile != "" {
+		metadataWriter, err := openWriter(*metadataFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer metadataWriter.Close()
+		metadata := make(chan renderer.FrameMetadata, cap(in))
+		engine.SetMetadataStream(metadata)
+		out = recordMetadata(out, metadata, metadataWriter, tc)
+	}
+	pub, _ := sink.(outputPublisher)
+	out, waitAuxOutputs, err := encodeAuxOutputs(out, auxOutputs, interval, pub)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cadence != nil {
+		out = cadence.weave(out)
+		if animateNumFrames > 0 {
+			out = limitNumFrames(out, animateNumFrames)
+		}
+	}
+	if outInterval != interval && *framerate > 0 {
+		if cadence != nil || changes.skip {
+			log.Fatalf("The output frame rate can not be converted with -interlace, -pulldown or -skip-unchanged")
+		}
+		if hdr && *outputBlend {
+			log.Fatalf("-ofps-blend can not be combined with -hdr")
+		}
+		out = encode.ConvertFrameRate(out, interval, outInterval, *outputBlend)
 	}
+	encodeDone := make(chan struct{})
 	go func() {
-		if err := format.EncodeAnimation(outWriter, out, interval); err != nil {
+		defer close(encodeDone)
+		if err := encodeOutput(out); err != nil {
 			log.Printf("Error animating: %v", err)
 		}
+		waitAuxOutputs()
 		cancel()
 	}()
 
-	if *watch {
+	if live != nil {
+		go reloadProject(ctx, engine, newFn, fallback, live, !*watch)
+	}
+	if *watch && *errorOverlayEnabled {
+		reporter, err := configureErrorOverlay(engine, width, fallback)
+		if err != nil {
+			log.Fatalf("Could not set error overlay: %v", err)
+		}
+		go watchEnvironment(ctx, reporter, newFn)
+	} else if *watch && fallback != nil {
+		go watchEnvironment(ctx, fallbackReporter{engine, fallback}, newFn)
+	} else if *watch {
 		go watchEnvironment(ctx, engine, newFn)
 	} else {
 		env, _, err := newFn()
-		if err != nil {
+		if err != nil && fallback != nil {
+			env = fallback(err)
+		} else if err != nil {
 			log.Fatal(err)
 		}
 		engine.SetEnvironment(env)
+		// Compile errors are fatal unless there is a status screen to
+		// show them on, in which case Load does not return them.
+		if err := engine.Load(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	engine.Animate(ctx, renderInterval, in)
+	if *service {
+		sdNotify("STOPPING=1")
+	}
+	// Let the frames that were already rendered be written.
+	close(in)
+	<-encodeDone
+}
+
+// subcommands are invoked when their name is the first argument to shady.
+// They receive the remaining arguments.
+var subcommands = map[string]func(args []string) error{
+	"bake":      bakeCommand,
+	"bench":     benchCommand,
+	"debug":     debugCommand,
+	"diff":      diffCommand,
+	"fuzz":      fuzzCommand,
+	"info":      infoCommand,
+	"new":       newCommand,
+	"queue":     queueCommand,
+	"sandbox":   sandboxCommand,
+	"sound":     soundCommand,
+	"spherical": sphericalCommand,
+	"tile":      tileCommand,
+	"validate":  validateCommand,
+	"watch":     watchCommand,
+}
+
+// environmentNames lists the values accepted by the -env flag.
+var environmentNames = []string{"shadertoy", "glslsandbox", "plain"}
+
+// newEnvironment creates the environment with the specified name for the
+// input files. The files are returned along with all the files they include.
+//
+// If a project is specified, its passes are set up as well.
+func newEnvironment(name string, inputFiles, mappingStrs []string, glslVersion string, proj *project, templateData interface{}) (renderer.Environment, []string, error) {
+	env, files, err := loadEnvironment(name, inputFiles, mappingStrs, glslVersion, proj, templateData)
+	// Files included with #include are not sources of their own, but are
+	// returned so they are watched too. Errors resolving them are reported
+	// when the sources are compiled.
+	included, _ := renderer.IncludedFiles(files...)
+	return env, append(files, included...), err
+}
+
+func loadEnvironment(name string, inputFiles, mappingStrs []string, glslVersion string, proj *project, templateData interface{}) (renderer.Environment, []string, error) {
+	sources, err := renderer.Includes(inputFiles...)
+	if err != nil {
+		return nil, sources, err
+	}
+	if proj != nil && (len(proj.Passes) > 0 || len(proj.Channels) > 0) && name != "shadertoy" {
+		return nil, sources, fmt.Errorf("passes are only supported by the shadertoy environment")
+	}
+
+	switch name {
+	case "shadertoy":
+	case "glslsandbox":
+		return glslsandbox.NewGLSLSandbox(renderer.TemplateSourceFiles(templateData, sources...), glslVersion), sources, nil
+	case "plain":
+		return glslsandbox.NewPlain(renderer.TemplateSourceFiles(templateData, sources...), glslVersion), sources, nil
+	default:
+		return nil, sources, fmt.Errorf("unknown environment %q", name)
+	}
+
+	mappings := make([]shadertoy.Mapping, 0, len(mappingStrs))
+	for _, str := range mappingStrs {
+		m, err := shadertoy.ParseMapping(str, ".")
+		if err != nil {
+			return nil, sources, err
+		}
+		mappings = append(mappings, m)
 	}
+	if proj != nil && (len(proj.Passes) > 0 || len(proj.Channels) > 0) {
+		passes, passFiles, err := proj.passes(templateData)
+		sources = append(sources, passFiles...)
+		if err != nil {
+			return nil, sources, err
+		}
+		env, err := shadertoy.NewPipeline(
+			renderer.TemplateSourceFiles(templateData, sources[:len(sources)-len(passFiles)]...),
+			proj.Channels,
+			passes,
+			mappings,
+			glslVersion,
+		)
+		if err != nil {
+			return nil, sources, err
+		}
+		return env, sources, nil
+	}
+	env, err := shadertoy.NewShaderToy(
+		renderer.TemplateSourceFiles(templateData, sources...),
+		mappings,
+		glslVersion,
+	)
+	if err != nil {
+		// Do not return a nil *ShaderToy as a non-nil Environment.
+		return nil, sources, err
+	}
+	return env, sources, nil
+}
+
+// resolveOpenGLVersion parses the value of the -opengl flag. If it is "glsl",
+// the version is inferred from the GLSL version.
+func resolveOpenGLVersion(openGLVersion, glslVersion string) (renderer.OpenGLVersion, error) {
+	if openGLVersion == "glsl" {
+		return renderer.OpenGLVersionFromGLSLVersion(glslVersion)
+	}
+	return renderer.ParseOpenGLVersion(openGLVersion)
+}
+
+const eglPlatformUsage = "The EGL platform to render offscreen with. Valid values are: default, device (a GPU without a display server), surfaceless (Mesa without a display server)"
 
-	engine.Animate(ctx, interval, in)
+// selectPlatform sets the EGL platform named by the value of the
+// -egl-platform flag.
+func selectPlatform(name string) error {
+	p, err := egl.ParsePlatform(name)
+	if err != nil {
+		return err
+	}
+	return renderer.SetPlatform(p)
+}
+
+// errorReporter may be implemented by the engine passed to watchEnvironment
+// to receive errors that occur while loading an environment. If not
+// implemented, errors are logged.
+type errorReporter interface {
+	ReportError(err error)
 }
 
 func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(renderer.Environment) }, newFn func() (renderer.Environment, []string, error)) {
@@ -253,7 +887,11 @@ func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(rend
 			return env, watcher, err
 		}()
 		if err != nil {
-			log.Println(err)
+			if r, ok := engine.(errorReporter); ok {
+				r.ReportError(err)
+			} else {
+				log.Println(err)
+			}
 			select {
 			case <-watcher.Events:
 			case err := <-watcher.Errors:
@@ -372,6 +1010,16 @@ func parseGeometry(geom string) (uint, uint, error) {
 	return uint(w), uint(h), nil
 }
 
+// logToStderr writes the diagnostics of a shader or engine to the standard
+// error of shady, as the renderer discards them by default.
+func logToStderr(sh interface {
+	SetDebugOutput(io.Writer)
+	SetLogger(*log.Logger)
+}) {
+	sh.SetDebugOutput(os.Stderr)
+	sh.SetLogger(log.Default())
+}
+
 func openWriter(filename string) (io.WriteCloser, error) {
 	if filename == "-" {
 		return nopCloseWriter{Writer: os.Stdout}, nil
@@ -397,3 +1045,13 @@ func (i *arrayFlags) Set(value string) error {
 	*i = append(*i, value)
 	return nil
 }
+
+// withInitTimeout returns the context bounding the setup of OpenGL, which is
+// not limited if the timeout in seconds is 0. Without a limit, OpenGL is set
+// up on the calling thread.
+func withInitTimeout(timeout float64) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), time.Duration(timeout*float64(time.Second)))
+}
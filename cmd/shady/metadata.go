@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"io"
+	"log"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// A frameRecord is a line of the file written with -metadata.
+type frameRecord struct {
+	Frame    uint64                 `json:"frame"`
+	Time     float64                `json:"time"`
+	Timecode string                 `json:"timecode,omitempty"`
+	Uniforms map[string]interface{} `json:"uniforms,omitempty"`
+	GPUTime  float64                `json:"gpu_time"`
+	Reloads  uint64                 `json:"reloads"`
+	Errors   uint64                 `json:"errors"`
+}
+
+// recordMetadata writes the metadata of every frame that passes through the
+// stream as a line of JSON. Animate sends the metadata of each frame before
+// the frame itself, so it is received for each frame in turn. Frames that are
+// not received by the output, e.g. beyond the limit of -n, are not recorded.
+// Frames are labeled with tc, unless it is the zero value.
+func recordMetadata(in <-chan image.Image, metadata <-chan renderer.FrameMetadata, w io.Writer, tc timecode) <-chan image.Image {
+	out := make(chan image.Image)
+	go func() {
+		defer close(out)
+		enc := json.NewEncoder(w)
+		var err error
+		for img := range in {
+			meta := <-metadata
+			if err == nil {
+				record := frameRecord{
+					Frame:    meta.Number,
+					Time:     meta.Time.Seconds(),
+					Uniforms: meta.Uniforms,
+					GPUTime:  meta.Stats.GPUTime.Seconds(),
+					Reloads:  meta.Stats.Reloads,
+					Errors:   meta.Stats.Errors,
+				}
+				if tc.rate > 0 {
+					record.Timecode = tc.format(meta.Number)
+				}
+				err = enc.Encode(record)
+				if err != nil {
+					log.Printf("Error writing metadata: %v", err)
+				}
+			}
+			out <- img
+		}
+	}()
+	return out
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func TestRecordMetadata(t *testing.T) {
+	in := make(chan image.Image, 3)
+	metadata := make(chan renderer.FrameMetadata, 3)
+	for i := 0; i < 3; i++ {
+		metadata <- renderer.FrameMetadata{
+			Number:   uint64(i),
+			Time:     time.Duration(i) * time.Second / 2,
+			Uniforms: map[string]interface{}{"speed": float32(i)},
+		}
+		in <- image.NewRGBA(image.Rect(0, 0, 1, 1))
+	}
+	close(in)
+
+	var buf bytes.Buffer
+	var n int
+	for range recordMetadata(limitNumFrames(in, 2), metadata, &buf, timecode{rate: 2}) {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 frames, got %d", n)
+	}
+	dec := json.NewDecoder(&buf)
+	var records []frameRecord
+	for dec.More() {
+		var r frameRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 || records[1].Frame != 1 || records[1].Time != 0.5 || records[1].Timecode != "00:00:00:01" || records[1].Uniforms["speed"] != 1.0 {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+}
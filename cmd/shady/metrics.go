@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// frameTimeWindow is the number of most recent frames over which the frame
+// time percentiles are computed.
+const frameTimeWindow = 1000
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metrics collects statistics about the rendered frames and exports them
+// along with those of the renderer in the Prometheus text format.
+type metrics struct {
+	engine   interface{ Stats() renderer.Stats }
+	interval time.Duration
+
+	lock       sync.Mutex
+	frames     uint64
+	dropped    uint64
+	lastFrame  time.Time
+	frameTimes []time.Duration
+	next       int
+	// totalFrameTime is the sum of all frame times, not just those in the
+	// window.
+	totalFrameTime time.Duration
+}
+
+func newMetrics(engine interface{ Stats() renderer.Stats }, interval time.Duration) *metrics {
+	return &metrics{engine: engine, interval: interval}
+}
+
+// monitor passes on the frames of the stream while measuring the time between
+// them. If an interval is set, frames that took longer than the interval to
+// render are counted as dropped for each interval they missed.
+func (m *metrics) monitor(in <-chan image.Image) <-chan image.Image {
+	out := make(chan image.Image)
+	go func() {
+		defer close(out)
+		for img := range in {
+			m.frame(time.Now())
+			out <- img
+		}
+	}()
+	return out
+}
+
+func (m *metrics) frame(now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.frames++
+	if !m.lastFrame.IsZero() {
+		d := now.Sub(m.lastFrame)
+		m.totalFrameTime += d
+		if len(m.frameTimes) < frameTimeWindow {
+			m.frameTimes = append(m.frameTimes, d)
+		} else {
+			m.frameTimes[m.next] = d
+			m.next = (m.next + 1) % frameTimeWindow
+		}
+		if m.interval > 0 && d > m.interval {
+			m.dropped += uint64(d/m.interval) - 1
+		}
+	}
+	m.lastFrame = now
+}
+
+// percentiles returns the frame time at each of the quantiles.
+func (m *metrics) percentiles(quantiles ...float64) []time.Duration {
+	sorted := append([]time.Duration(nil), m.frameTimes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p := make([]time.Duration, len(quantiles))
+	if len(sorted) == 0 {
+		return p
+	}
+	for i, q := range quantiles {
+		p[i] = sorted[int(q*float64(len(sorted)-1)+0.5)]
+	}
+	return p
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+func (m *metrics) write(w io.Writer) {
+	st := m.engine.Stats()
+
+	m.lock.Lock()
+	quantiles := []float64{0.5, 0.9, 0.99}
+	percentiles := m.percentiles(quantiles...)
+	var sum time.Duration
+	for _, d := range m.frameTimes {
+		sum += d
+	}
+	fps := 0.0
+	if sum > 0 {
+		fps = float64(len(m.frameTimes)) / sum.Seconds()
+	}
+	frames, dropped, total := m.frames, m.dropped, m.totalFrameTime
+	m.lock.Unlock()
+
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	metric("shady_frames_total", "counter", "The number of frames rendered.")
+	fmt.Fprintf(w, "shady_frames_total %d\n", frames)
+	metric("shady_dropped_frames_total", "counter", "The number of frame intervals missed because rendering was too slow.")
+	fmt.Fprintf(w, "shady_dropped_frames_total %d\n", dropped)
+	metric("shady_frame_rate", "gauge", "The average number of frames per second over the recent frames.")
+	fmt.Fprintf(w, "shady_frame_rate %g\n", fps)
+	metric("shady_frame_time_seconds", "summary", "The time between consecutive frames.")
+	for i, q := range quantiles {
+		fmt.Fprintf(w, "shady_frame_time_seconds{quantile=\"%g\"} %g\n", q, percentiles[i].Seconds())
+	}
+	count := uint64(0)
+	if frames > 0 {
+		count = frames - 1
+	}
+	fmt.Fprintf(w, "shady_frame_time_seconds_sum %g\n", total.Seconds())
+	fmt.Fprintf(w, "shady_frame_time_seconds_count %d\n", count)
+	metric("shady_gpu_time_seconds", "gauge", "The time the GPU spent rendering a recent frame.")
+	fmt.Fprintf(w, "shady_gpu_time_seconds %g\n", st.GPUTime.Seconds())
+	metric("shady_reloads_total", "counter", "The number of times a shader was loaded.")
+	fmt.Fprintf(w, "shady_reloads_total %d\n", st.Reloads)
+	metric("shady_errors_total", "counter", "The number of shader load failures and OpenGL errors.")
+	fmt.Fprintf(w, "shady_errors_total %d\n", st.Errors)
+	if st.LastError != nil {
+		metric("shady_last_error_timestamp_seconds", "gauge", "The time at which the last error occurred.")
+		fmt.Fprintf(w, "shady_last_error_timestamp_seconds %d\n", st.LastErrorTime.Unix())
+		metric("shady_last_error_info", "gauge", "The message of the last error.")
+		fmt.Fprintf(w, "shady_last_error_info{message=\"%s\"} 1\n", labelEscaper.Replace(st.LastError.Error()))
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type staticStats renderer.Stats
+
+func (st staticStats) Stats() renderer.Stats {
+	return renderer.Stats(st)
+}
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics(staticStats{Reloads: 2}, 10*time.Millisecond)
+	start := time.Now()
+	for _, offset := range []time.Duration{0, 10, 20, 50, 60} {
+		m.frame(start.Add(offset * time.Millisecond))
+	}
+
+	var buf strings.Builder
+	m.write(&buf)
+	for _, exp := range []string{
+		"shady_frames_total 5\n",
+		"shady_dropped_frames_total 2\n",
+		"shady_frame_time_seconds{quantile=\"0.5\"} 0.01\n",
+		"shady_frame_time_seconds{quantile=\"0.99\"} 0.03\n",
+		"shady_frame_time_seconds_count 4\n",
+		"shady_reloads_total 2\n",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("missing %q in:\n%s", exp, buf.String())
+		}
+	}
+}
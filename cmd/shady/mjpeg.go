@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sync"
+)
+
+// mjpegServer serves frames as a Motion JPEG stream, which browsers and
+// players such as VLC and OBS show without plugins. Frames are only taken from
+// the stream while a client is connected.
+type mjpegServer struct {
+	frames  chan image.Image
+	quality int
+
+	lock    sync.Mutex
+	clients map[chan []byte]bool
+	// wake is signaled when the first client connects.
+	wake chan struct{}
+}
+
+func newMJPEGServer(quality int) *mjpegServer {
+	return &mjpegServer{
+		frames:  make(chan image.Image, 1),
+		quality: quality,
+		clients: map[chan []byte]bool{},
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// run encodes the frames and sends them to the clients until the context is
+// done.
+func (s *mjpegServer) run(ctx context.Context) {
+	for {
+		s.lock.Lock()
+		idle := len(s.clients) == 0
+		s.lock.Unlock()
+		if idle {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			}
+			continue
+		}
+
+		var img image.Image
+		select {
+		case <-ctx.Done():
+			return
+		case img = <-s.frames:
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: s.quality}); err != nil {
+			log.Printf("Could not encode preview: %v", err)
+			continue
+		}
+		s.lock.Lock()
+		for client := range s.clients {
+			// Clients that can not keep up skip frames.
+			select {
+			case client <- buf.Bytes():
+			default:
+			}
+		}
+		s.lock.Unlock()
+	}
+}
+
+func (s *mjpegServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-cache")
+
+	client := make(chan []byte, 1)
+	s.lock.Lock()
+	s.clients[client] = true
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.clients, client)
+		s.lock.Unlock()
+	}()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	for {
+		var frame []byte
+		select {
+		case <-r.Context().Done():
+			return
+		case frame = <-client:
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":   {"image/jpeg"},
+			"Content-Length": {fmt.Sprint(len(frame))},
+		})
+		if err != nil {
+			return
+		}
+		if _, err := part.Write(frame); err != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
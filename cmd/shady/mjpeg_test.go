@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMJPEGServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newMJPEGServer(75)
+	go s.run(ctx)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// No frames are taken while nobody is watching.
+	s.frames <- image.NewRGBA(image.Rect(0, 0, 8, 8))
+	time.Sleep(10 * time.Millisecond)
+	if len(s.frames) != 1 {
+		t.Fatalf("a frame was taken without clients")
+	}
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" {
+		t.Fatalf("unexpected content type: %q", resp.Header.Get("Content-Type"))
+	}
+	go func() {
+		for ctx.Err() == nil {
+			select {
+			case s.frames <- image.NewRGBA(image.Rect(0, 0, 16, 8)):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for i := 0; i < 2; i++ {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := part.Header.Get("Content-Type"); ct != "image/jpeg" {
+			t.Fatalf("unexpected part type: %q", ct)
+		}
+		img, err := jpeg.Decode(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 && img.Bounds().Size() != image.Pt(16, 8) {
+			t.Fatalf("unexpected size: %v", img.Bounds().Size())
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// parseMouse parses the position of the -mouse flag into the state of a mouse
+// that was dragged there.
+func parseMouse(s string) (renderer.Mouse, error) {
+	var x, y float32
+	if _, err := fmt.Sscanf(s, "%g,%g", &x, &y); err != nil {
+		return renderer.Mouse{}, fmt.Errorf("invalid mouse position %q, expected X,Y", s)
+	}
+	return renderer.Mouse{
+		X: x, Y: y,
+		DragX: x, DragY: y,
+		ClickX: x, ClickY: y,
+		Down: true,
+	}, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const shaderFilename = "main.glsl"
+
+var starterShaders = map[string]string{
+	"shadertoy": `// This is a shader for the ShaderToy environment.
+//
+// Render it in a window with:
+//   shady -p shady.json
+//
+// mainImage is called for every pixel of the output. The following uniforms
+// are declared by shady and can be used right away:
+//   vec3  iResolution  the size of the output in pixels
+//   float iTime        the number of seconds since the start of the animation
+//   float iTimeDelta   the number of seconds since the previous frame
+//   float iFrame       the number of frames rendered so far
+//   vec4  iMouse       xy: the position of the cursor while the button is
+//                      held, zw: where it was clicked
+//
+// Textures, videos, audio and other shaders can be mapped to uniforms with
+// "#pragma map", for example:
+//   #pragma map iChannel0=builtin:RGBA Noise Medium
+
+void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+	// Normalized pixel coordinates, from 0 to 1.
+	vec2 uv = fragCoord / iResolution.xy;
+
+	// Cycle the colors over time.
+	vec3 col = 0.5 + 0.5 * cos(iTime + uv.xyx + vec3(0, 2, 4));
+
+	fragColor = vec4(col, 1.0);
+}
+`,
+	"glslsandbox": `// This is a shader for the GLSL Sandbox environment.
+//
+// Render it in a window with:
+//   shady -p shady.json
+//
+// main is called for every pixel of the output. Shady sets the following
+// uniforms if they are declared:
+//   float     time        the number of seconds since the start of the animation
+//   vec2      resolution  the size of the output in pixels
+//   vec2      mouse       the mouse position, normalized to 0..1
+//   sampler2D backbuffer  the previously rendered frame
+
+uniform float time;
+uniform vec2 resolution;
+
+void main(void) {
+	// Normalized pixel coordinates, from 0 to 1.
+	vec2 uv = gl_FragCoord.xy / resolution;
+
+	// Cycle the colors over time.
+	vec3 col = 0.5 + 0.5 * cos(time + uv.xyx + vec3(0, 2, 4));
+
+	gl_FragColor = vec4(col, 1.0);
+}
+`,
+	"plain": `// This is a plain GLSL fragment shader.
+//
+// Render it in a window with:
+//   shady -p shady.json
+//
+// The source is compiled as-is, so it has to declare its own version. Shady
+// sets the same uniforms as the GLSL Sandbox environment if they are declared:
+//   float     time        the number of seconds since the start of the animation
+//   vec2      resolution  the size of the output in pixels
+//   vec2      mouse       the mouse position, normalized to 0..1
+//   sampler2D backbuffer  the previously rendered frame
+
+#version 330
+
+uniform float time;
+uniform vec2 resolution;
+
+out vec4 fragColor;
+
+void main(void) {
+	// Normalized pixel coordinates, from 0 to 1.
+	vec2 uv = gl_FragCoord.xy / resolution;
+
+	// Cycle the colors over time.
+	vec3 col = 0.5 + 0.5 * cos(time + uv.xyx + vec3(0, 2, 4));
+
+	fragColor = vec4(col, 1.0);
+}
+`,
+}
+
+// newCommand implements "shady new", which creates a directory with a
+// commented starter shader and a project file for it.
+func newCommand(args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	env := fs.String("env", "shadertoy", "The environment to create a shader for. Valid values are: shadertoy, glslsandbox, plain")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shady new [-env ENV] DIRECTORY\n")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	dir := fs.Arg(0)
+
+	shader, ok := starterShaders[*env]
+	if !ok {
+		return fmt.Errorf("unknown environment %q", *env)
+	}
+
+	shaderPath := filepath.Join(dir, shaderFilename)
+	projectPath := filepath.Join(dir, projectFilename)
+	for _, f := range []string{shaderPath, projectPath} {
+		if _, err := os.Stat(f); err == nil {
+			return fmt.Errorf("refusing to overwrite %q", f)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(shaderPath, []byte(shader), 0644); err != nil {
+		return err
+	}
+	proj := project{
+		Env:    *env,
+		Inputs: []string{shaderFilename},
+	}
+	if err := proj.save(projectPath); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s and %s\n", shaderPath, projectPath)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewCommand(t *testing.T) {
+	for env := range starterShaders {
+		t.Run(env, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "shader")
+			if err := newCommand([]string{"-env", env, dir}); err != nil {
+				t.Fatal(err)
+			}
+			proj, err := loadProject(filepath.Join(dir, projectFilename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if proj.Env != env {
+				t.Errorf("unexpected environment: exp %q, got %q", env, proj.Env)
+			}
+			if files := proj.inputFiles(); len(files) != 1 || files[0] != filepath.Join(dir, shaderFilename) {
+				t.Errorf("unexpected inputs: %q", files)
+			}
+
+			if err := newCommand([]string{"-env", env, dir}); err == nil || !strings.Contains(err.Error(), "refusing to overwrite") {
+				t.Errorf("expected an error for an existing shader, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewCommandArgs(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		err  error
+	}{
+		{name: "no directory", args: nil, err: errUsage},
+		{name: "two directories", args: []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, err: errUsage},
+		{name: "unknown flag", args: []string{"-foo", dir}, err: errUsage},
+		{name: "help", args: []string{"-h"}, err: flag.ErrHelp},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := newCommand(test.args); !errors.Is(err, test.err) {
+				t.Errorf("unexpected error: exp %v, got %v", test.err, err)
+			}
+		})
+	}
+
+	if err := newCommand([]string{"-env", "foo", dir}); err == nil || errors.Is(err, errUsage) {
+		t.Errorf("expected an error for an unknown environment, got %v", err)
+	}
+}
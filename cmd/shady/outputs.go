@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// An auxOutput is an additional output of the shader, such as its depth, that
+// is written to a separate file alongside the color output.
+type auxOutput struct {
+	// name identifies the output, e.g. depth.
+	name     string
+	filename string
+	// extract converts a rendered frame to the image that is written. prev
+	// is the color of the previous frame, or nil for the first frame.
+	extract func(img *renderer.LayeredImage, prev *image.RGBA) image.Image
+}
+
+// publishTarget is the file name of additional outputs that are published
+// alongside the color output by a sink, rather than written to a file.
+const publishTarget = "zmq"
+
+// An outputPublisher is a sink that publishes additional outputs under their
+// name.
+type outputPublisher interface {
+	publish(output string, img image.Image) error
+}
+
+// isFloatFile reports whether the output is written as the raw values of the
+// shader rather than as an image.
+func isFloatFile(filename string) bool {
+	return path.Ext(filename) == ".npy"
+}
+
+func depthOutput(filename, depthRange string) (auxOutput, error) {
+	near, far, err := parseDepthRange(depthRange)
+	if err != nil {
+		return auxOutput{}, err
+	}
+	if isFloatFile(filename) {
+		return auxOutput{
+			name:     "depth",
+			filename: filename,
+			extract: func(img *renderer.LayeredImage, _ *image.RGBA) image.Image {
+				return img.OutputImage(renderer.OutputDepth)
+			},
+		}, nil
+	}
+	return auxOutput{
+		name:     "depth",
+		filename: filename,
+		extract: func(img *renderer.LayeredImage, _ *image.RGBA) image.Image {
+			return img.DepthImage(near, far)
+		},
+	}, nil
+}
+
+// motionOutput creates the output for motion vectors. If source is "shader",
+// the vectors written by the shader are used. If it is "estimate", they are
+// derived from the difference between consecutive frames.
+func motionOutput(filename, source string, scale float32) (auxOutput, bool, error) {
+	switch source {
+	case "shader":
+		return auxOutput{
+			name:     "motion",
+			filename: filename,
+			extract: func(img *renderer.LayeredImage, _ *image.RGBA) image.Image {
+				if isFloatFile(filename) {
+					return img.OutputImage(renderer.OutputMotion)
+				}
+				return img.MotionImage(scale)
+			},
+		}, true, nil
+	case "estimate":
+		return auxOutput{
+			name:     "motion",
+			filename: filename,
+			extract: func(img *renderer.LayeredImage, prev *image.RGBA) image.Image {
+				if prev == nil {
+					prev = img.RGBA
+				}
+				motion := renderer.EstimateMotion(prev, img.RGBA)
+				if isFloatFile(filename) {
+					return &renderer.FloatImage{Rect: img.Rect, Channels: 2, Data: motion}
+				}
+				return renderer.EncodeMotion(img.Rect, motion, scale)
+			},
+		}, false, nil
+	}
+	return auxOutput{}, false, fmt.Errorf("invalid motion source: %q (valid: shader, estimate)", source)
+}
+
+func parseDepthRange(s string) (float32, float32, error) {
+	var near, far float32
+	if _, err := fmt.Sscanf(s, "%g:%g", &near, &far); err != nil || near == far {
+		return 0, 0, fmt.Errorf("invalid depth range: %q", s)
+	}
+	return near, far, nil
+}
+
+// encodeAuxOutputs starts encoding the additional outputs to their files, or
+// publishing them with pub if their file name is publishTarget. pub is nil if
+// the color output is not published. The color images are passed on through
+// the returned channel. The returned function blocks until all outputs are
+// written and closes their files.
+func encodeAuxOutputs(in <-chan image.Image, outputs []auxOutput, interval time.Duration, pub outputPublisher) (<-chan image.Image, func(), error) {
+	if len(outputs) == 0 {
+		return in, func() {}, nil
+	}
+
+	var wg sync.WaitGroup
+	streams := make([]chan image.Image, len(outputs))
+	for i, output := range outputs {
+		if output.filename == publishTarget {
+			if pub == nil {
+				return nil, nil, fmt.Errorf("the %s output can only be published with -ofmt zmq", output.name)
+			}
+			stream := make(chan image.Image)
+			streams[i] = stream
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				for img := range stream {
+					if err := pub.publish(name, img); err != nil {
+						log.Printf("Error publishing %s: %v", name, err)
+					}
+				}
+			}(output.name)
+			continue
+		}
+		format, ok := encode.DetectFormat(output.filename)
+		if !ok {
+			return nil, nil, fmt.Errorf("unable to detect the output format from %q", output.filename)
+		}
+		w, err := openWriter(output.filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		stream := make(chan image.Image)
+		streams[i] = stream
+		wg.Add(1)
+		go func(filename string) {
+			defer wg.Done()
+			defer w.Close()
+			if err := format.EncodeAnimation(w, stream, interval); err != nil {
+				log.Printf("Error animating %s: %v", filename, err)
+			}
+		}(output.filename)
+	}
+
+	color := make(chan image.Image)
+	go func() {
+		defer close(color)
+		defer func() {
+			for _, stream := range streams {
+				close(stream)
+			}
+		}()
+		var prev *image.RGBA
+		for img := range in {
+			layered, ok := img.(*renderer.LayeredImage)
+			if !ok {
+				layered = &renderer.LayeredImage{RGBA: img.(*image.RGBA)}
+			}
+			for i, output := range outputs {
+				streams[i] <- output.extract(layered, prev)
+			}
+			prev = layered.RGBA
+			color <- layered.RGBA
+		}
+	}()
+	return color, wg.Wait, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// publishRecorder records the outputs that are published.
+type publishRecorder struct {
+	lock    sync.Mutex
+	outputs []string
+}
+
+func (r *publishRecorder) publish(output string, img image.Image) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.outputs = append(r.outputs, output)
+	return nil
+}
+
+func TestEncodeAuxOutputsPublish(t *testing.T) {
+	depth, err := depthOutput(publishTarget, "0:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := []auxOutput{depth}
+
+	if _, _, err := encodeAuxOutputs(make(chan image.Image), outputs, time.Second, nil); err == nil {
+		t.Fatal("expected an error when the output can not be published")
+	}
+
+	var pub publishRecorder
+	in := make(chan image.Image, 2)
+	for i := 0; i < 2; i++ {
+		rect := image.Rect(0, 0, 2, 2)
+		in <- &renderer.LayeredImage{RGBA: image.NewRGBA(rect), Depth: make([]float32, 4)}
+	}
+	close(in)
+	out, wait, err := encodeAuxOutputs(in, outputs, time.Second, &pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var colors int
+	for img := range out {
+		if _, ok := img.(*image.RGBA); !ok {
+			t.Fatalf("unexpected color image: %T", img)
+		}
+		colors++
+	}
+	wait()
+	if colors != 2 {
+		t.Fatalf("got %d color frames, want 2", colors)
+	}
+	if len(pub.outputs) != 2 || pub.outputs[0] != "depth" || pub.outputs[1] != "depth" {
+		t.Fatalf("unexpected published outputs: %q", pub.outputs)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// loadOverlay loads the overlay from an image or a shader file. Shaders are
+// loaded into the shadertoy environment. If no size is specified, an image
+// retains its size and a shader covers the whole output.
+func loadOverlay(filename, size string, width, height uint, glslVersion string) (*renderer.Overlay, error) {
+	ov := &renderer.Overlay{}
+	if size != "" {
+		w, h, err := parseGeometry(size)
+		if err != nil {
+			return nil, err
+		}
+		ov.Width, ov.Height = w, h
+	}
+
+	if filepath.Ext(filename) == ".glsl" {
+		env, _, err := newEnvironment("shadertoy", []string{filename}, nil, glslVersion, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		ov.Environment = env
+		if ov.Width == 0 || ov.Height == 0 {
+			ov.Width, ov.Height = width, height
+		}
+		return ov, nil
+	}
+
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	if ov.Image, _, err = image.Decode(fd); err != nil {
+		return nil, err
+	}
+	return ov, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"log"
+	"time"
+
+	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// clipSettings holds the -clip-* flags of the clips recorded in the window.
+type clipSettings struct {
+	format string
+	length time.Duration
+}
+
+func (c *clipSettings) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.format, "clip-format", "gif", "The format of the clips recorded with the C key in a window")
+	fs.DurationVar(&c.length, "clip-length", 10*time.Second, "The maximum length of the clips recorded with the C key in a window, 0 for no limit")
+}
+
+// previewControls returns the functions of the keyboard shortcuts of the
+// window. Screenshots and clips are saved in the working directory. If reporter is not
+// nil, the error it shows is hidden when the shader is rolled back.
+func previewControls(engine *renderer.OnScreenEngine, newFn func() (renderer.Environment, []string, error), fallback func(error) renderer.Environment, reporter *overlayReporter, clips clipSettings) renderer.PreviewControls {
+	return renderer.PreviewControls{
+		Reload: func() {
+			log.Printf("Reloading")
+			reloadEnvironment(engine, newFn, fallback)
+		},
+		Rollback: func() {
+			if !engine.Rollback() {
+				log.Printf("There is no previous version to roll back to")
+				return
+			}
+			log.Printf("Rolling back to the previous version")
+			if reporter != nil {
+				reporter.overlay.show(nil)
+			}
+		},
+		Screenshot: func(img image.Image) {
+			filename := time.Now().Format("shady-20060102-150405.000.png")
+			if err := writeImage(filename, img); err != nil {
+				log.Printf("Could not save screenshot: %v", err)
+				return
+			}
+			log.Printf("Saved screenshot to %s", filename)
+		},
+		Clip:         clips.save,
+		ClipInterval: time.Second / 30,
+		ClipLength:   clips.length,
+	}
+}
+
+// save encodes the frames of a clip recorded in the window to a file in the
+// format set with -clip-format.
+func (c clipSettings) save(frames <-chan image.Image, interval time.Duration) {
+	// The window waits for every frame, so they are consumed even if the
+	// clip can not be saved.
+	defer func() {
+		for range frames {
+		}
+	}()
+	format, ok := encode.LookupFormat(c.format)
+	if !ok || len(format.Extensions()) == 0 {
+		log.Printf("Could not record clip: %q is not a file format", c.format)
+		return
+	}
+	filename := time.Now().Format("shady-20060102-150405.000.") + format.Extensions()[0]
+	w, err := openWriter(filename)
+	if err != nil {
+		log.Printf("Could not record clip: %v", err)
+		return
+	}
+	log.Printf("Recording clip to %s", filename)
+	if err := format.EncodeAnimation(w, frames, interval); err != nil {
+		w.Close()
+		log.Printf("Could not record clip: %v", err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("Could not record clip: %v", err)
+		return
+	}
+	log.Printf("Saved clip to %s", filename)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// projectFilename is the name of the project file created by "shady new".
+const projectFilename = "shady.json"
+
+// A project bundles the shader sources and settings of a shader so they do
+// not have to be repeated on the command line.
+//
+// Each setting corresponds to the command line flag of the same name.
+// Settings from a project are only used when the flag is not set explicitly.
+type project struct {
+	Env       string   `json:"env,omitempty"`
+	Inputs    []string `json:"inputs"`
+	Geometry  string   `json:"geometry,omitempty"`
+	Framerate float64  `json:"framerate,omitempty"`
+	GLSL      string   `json:"glsl,omitempty"`
+	Mappings  []string `json:"mappings,omitempty"`
+
+	// Channels maps sampler uniforms of the image shader to the passes they
+	// sample. Only supported by the shadertoy environment.
+	Channels map[string]string `json:"channels,omitempty"`
+	Passes   []projectPass     `json:"passes,omitempty"`
+	// Sound holds the inputs of the sound shader, which is rendered by
+	// "shady sound".
+	Sound []string `json:"sound,omitempty"`
+	// Template is the data the sources are preprocessed with as templates.
+	Template map[string]interface{} `json:"template,omitempty"`
+
+	// dir is the directory the project file is located in. Relative input
+	// paths are resolved against it.
+	dir string
+}
+
+// A projectPass is a shader which renders to a buffer that can be sampled by
+// the image shader and other passes.
+type projectPass struct {
+	Name   string   `json:"name"`
+	Inputs []string `json:"inputs"`
+	// Size is the size of the buffer, either as WxH or a scale factor
+	// relative to the canvas.
+	Size     string            `json:"size"`
+	Channels map[string]string `json:"channels,omitempty"`
+	// Every renders the pass only every Nth frame.
+	Every uint `json:"every,omitempty"`
+	// Once renders the pass only for the first frame.
+	Once bool `json:"once,omitempty"`
+	// On renders the pass when the value set for one of the uniforms
+	// changes.
+	On []string `json:"on,omitempty"`
+}
+
+func loadProject(filename string) (*project, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	var proj project
+	if err := json.NewDecoder(fd).Decode(&proj); err != nil {
+		return nil, fmt.Errorf("could not parse project %q: %w", filename, err)
+	}
+	proj.dir = filepath.Dir(filename)
+	return &proj, nil
+}
+
+func (proj *project) save(filename string) error {
+	buf, err := json.MarshalIndent(proj, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(buf, '\n'), 0644)
+}
+
+// inputFiles returns the input files of the project resolved relative to the
+// project file.
+func (proj *project) inputFiles() []string {
+	return proj.resolve(proj.Inputs)
+}
+
+func (proj *project) resolve(inputs []string) []string {
+	files := make([]string, len(inputs))
+	for i, f := range inputs {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(proj.dir, f)
+		}
+		files[i] = f
+	}
+	return files
+}
+
+// passes loads the sources of the passes of the project. The files of all
+// passes are returned along with the files they include. The sources are
+// preprocessed with the template data if it is not nil.
+func (proj *project) passes(templateData interface{}) ([]shadertoy.Pass, []string, error) {
+	var allFiles []string
+	passes := make([]shadertoy.Pass, len(proj.Passes))
+	for i, p := range proj.Passes {
+		files, err := renderer.Includes(proj.resolve(p.Inputs)...)
+		allFiles = append(allFiles, files...)
+		if err != nil {
+			return nil, allFiles, fmt.Errorf("pass %q: %w", p.Name, err)
+		}
+		passes[i] = shadertoy.Pass{
+			Name:     p.Name,
+			Sources:  renderer.TemplateSourceFiles(templateData, files...),
+			Size:     p.Size,
+			Channels: p.Channels,
+			Every:    p.Every,
+			Once:     p.Once,
+			On:       p.On,
+		}
+	}
+	return passes, allFiles, nil
+}
+
+// applyDefaults sets the flags in the specified set that were not set
+// explicitly to the values in the project.
+func (proj *project) applyDefaults(flags *flag.FlagSet) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	values := map[string]string{
+		"env":  proj.Env,
+		"g":    proj.Geometry,
+		"glsl": proj.GLSL,
+	}
+	if proj.Framerate != 0 {
+		values["f"] = strconv.FormatFloat(proj.Framerate, 'f', -1, 64)
+	}
+	for name, value := range values {
+		if value == "" || set[name] || flags.Lookup(name) == nil {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid project setting for -%s: %w", name, err)
+		}
+	}
+	if !set["map"] && flags.Lookup("map") != nil {
+		for _, m := range proj.Mappings {
+			if err := flags.Set("map", m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
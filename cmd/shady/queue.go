@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polyfloyd/shady/encode"
+)
+
+type jobStatus string
+
+const (
+	jobQueued   jobStatus = "queued"
+	jobRunning  jobStatus = "running"
+	jobDone     jobStatus = "done"
+	jobFailed   jobStatus = "failed"
+	jobCanceled jobStatus = "canceled"
+)
+
+// A jobSpec describes what a render job should render. The fields correspond
+// to the command line flags of the same name.
+type jobSpec struct {
+	// Inputs are the shader files. Either Inputs or Project must be set.
+	Inputs    []string `json:"inputs,omitempty"`
+	Project   string   `json:"project,omitempty"`
+	Env       string   `json:"env,omitempty"`
+	Geometry  string   `json:"geometry"`
+	Framerate float64  `json:"framerate,omitempty"`
+	Frames    uint     `json:"frames,omitempty"`
+	Duration  float64  `json:"duration,omitempty"`
+	// Format is the name of the output format, which is also used as the
+	// extension of the output file.
+	Format   string   `json:"format"`
+	Mappings []string `json:"mappings,omitempty"`
+	// Priority determines the order in which jobs are run. Jobs with a
+	// higher priority are run first, jobs with equal priorities in the order
+	// in which they were submitted.
+	Priority int `json:"priority,omitempty"`
+}
+
+func (spec jobSpec) validate() error {
+	if len(spec.Inputs) == 0 && spec.Project == "" {
+		return fmt.Errorf("no inputs or project specified")
+	}
+	if _, _, err := parseGeometry(spec.Geometry); err != nil {
+		return err
+	}
+	if _, ok := encode.Formats[spec.Format]; !ok {
+		return fmt.Errorf("invalid output format: %q", spec.Format)
+	}
+	if spec.Framerate > 0 && spec.Frames == 0 && spec.Duration == 0 {
+		return fmt.Errorf("an animation requires a number of frames or a duration")
+	}
+	return nil
+}
+
+// args returns the command line arguments that render the job to the output
+// file.
+func (spec jobSpec) args(output string) []string {
+	args := []string{"-g", spec.Geometry, "-ofmt", spec.Format, "-o", output}
+	for _, input := range spec.Inputs {
+		args = append(args, "-i", input)
+	}
+	if spec.Project != "" {
+		args = append(args, "-p", spec.Project)
+	}
+	if spec.Env != "" {
+		args = append(args, "-env", spec.Env)
+	}
+	if spec.Framerate > 0 {
+		args = append(args, "-f", strconv.FormatFloat(spec.Framerate, 'f', -1, 64))
+	}
+	if spec.Frames > 0 {
+		args = append(args, "-n", strconv.FormatUint(uint64(spec.Frames), 10))
+	}
+	if spec.Duration > 0 {
+		args = append(args, "-d", strconv.FormatFloat(spec.Duration, 'f', -1, 64))
+	}
+	for _, m := range spec.Mappings {
+		args = append(args, "-map", m)
+	}
+	return args
+}
+
+// A job is a render job in the queue.
+type job struct {
+	ID     int       `json:"id"`
+	Spec   jobSpec   `json:"spec"`
+	Status jobStatus `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	// Rejection is set if the job failed because it exceeded a limit.
+	Rejection *rejection `json:"rejection,omitempty"`
+	Created   time.Time  `json:"created"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	// Output is the file the job renders to.
+	Output string `json:"-"`
+
+	cancel func()
+}
+
+func timeNow() *time.Time {
+	now := time.Now()
+	return &now
+}
+
+// A jobQueue runs render jobs in order of priority using a number of
+// workers.
+type jobQueue struct {
+	dir    string
+	run    func(ctx context.Context, j *job) error
+	limits submissionLimits
+
+	lock   sync.Mutex
+	cond   *sync.Cond
+	jobs   map[int]*job
+	queue  []*job
+	nextID int
+}
+
+func newJobQueue(dir string, run func(ctx context.Context, j *job) error) *jobQueue {
+	q := &jobQueue{
+		dir:    dir,
+		run:    run,
+		jobs:   map[int]*job{},
+		nextID: 1,
+	}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+// submit adds a job to the queue.
+func (q *jobQueue) submit(spec jobSpec) (job, error) {
+	if err := spec.validate(); err != nil {
+		return job{}, err
+	}
+	if err := q.limits.check(spec); err != nil {
+		return job{}, err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	j := &job{
+		ID:      q.nextID,
+		Spec:    spec,
+		Status:  jobQueued,
+		Created: time.Now(),
+	}
+	j.Output = filepath.Join(q.dir, fmt.Sprintf("job-%d.%s", j.ID, spec.Format))
+	q.nextID++
+	q.jobs[j.ID] = j
+	q.queue = append(q.queue, j)
+	sort.SliceStable(q.queue, func(a, b int) bool {
+		return q.queue[a].Spec.Priority > q.queue[b].Spec.Priority
+	})
+	q.cond.Signal()
+	return *j, nil
+}
+
+// get returns a copy of the job with the ID.
+func (q *jobQueue) get(id int) (job, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// list returns all jobs ordered by their ID.
+func (q *jobQueue) list() []job {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	jobs := make([]job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		jobs = append(jobs, *j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	return jobs
+}
+
+// cancel removes a queued job from the queue or stops a running job.
+func (q *jobQueue) cancel(id int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("no such job: %d", id)
+	}
+	switch j.Status {
+	case jobQueued:
+		for i, qj := range q.queue {
+			if qj == j {
+				q.queue = append(q.queue[:i], q.queue[i+1:]...)
+				break
+			}
+		}
+		j.Status = jobCanceled
+		j.Finished = timeNow()
+	case jobRunning:
+		j.cancel()
+	default:
+		return fmt.Errorf("job %d has already finished", id)
+	}
+	return nil
+}
+
+// work runs jobs from the queue until the context is canceled.
+func (q *jobQueue) work(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		q.lock.Lock()
+		q.cond.Broadcast()
+		q.lock.Unlock()
+	}()
+	for {
+		q.lock.Lock()
+		for len(q.queue) == 0 && ctx.Err() == nil {
+			q.cond.Wait()
+		}
+		if ctx.Err() != nil {
+			q.lock.Unlock()
+			return
+		}
+		j := q.queue[0]
+		q.queue = q.queue[1:]
+		jobCtx, cancel := context.WithCancel(ctx)
+		j.cancel = cancel
+		j.Status = jobRunning
+		j.Started = timeNow()
+		q.lock.Unlock()
+
+		err := q.run(jobCtx, j)
+
+		q.lock.Lock()
+		j.Finished = timeNow()
+		switch {
+		case jobCtx.Err() != nil:
+			j.Status = jobCanceled
+		case err != nil:
+			j.Status = jobFailed
+			j.Error = err.Error()
+			if r, ok := err.(*rejection); ok {
+				j.Rejection = r
+			}
+		default:
+			j.Status = jobDone
+		}
+		q.lock.Unlock()
+		cancel()
+	}
+}
+
+// runJobProcess returns a function that renders a job by running shady in a
+// sandboxed process, which gives every job its own OpenGL context and
+// prevents a broken shader from taking down the queue.
+func runJobProcess(lim sandboxLimits, limits submissionLimits) func(ctx context.Context, j *job) error {
+	return func(ctx context.Context, j *job) error {
+		if err := limits.checkCompile(ctx, j.Spec, lim); err != nil {
+			return err
+		}
+		return runSandboxed(ctx, lim, j.Spec.args(j.Output), nil)
+	}
+}
+
+func (q *jobQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	writeError := func(status int, err error) {
+		writeJSON(status, map[string]string{"error": err.Error()})
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(http.StatusOK, q.list())
+		case http.MethodPost:
+			var spec jobSpec
+			if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+				writeError(http.StatusBadRequest, err)
+				return
+			}
+			j, err := q.submit(spec)
+			if r, ok := err.(*rejection); ok {
+				writeJSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": r.Error(), "rejection": r})
+				return
+			} else if err != nil {
+				writeError(http.StatusBadRequest, err)
+				return
+			}
+			writeJSON(http.StatusCreated, j)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	j, ok := q.get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(http.StatusOK, j)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := q.cancel(id); err != nil {
+			writeError(http.StatusConflict, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case parts[1] == "output" && r.Method == http.MethodGet:
+		if j.Status != jobDone {
+			writeError(http.StatusConflict, fmt.Errorf("job %d is %s", id, j.Status))
+			return
+		}
+		http.ServeFile(w, r, j.Output)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// queueCommand implements "shady queue", which accepts render jobs over HTTP
+// and renders them in order of priority.
+func queueCommand(args []string) error {
+	fs := flag.NewFlagSet("queue", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:8090", "The address to accept jobs on. Jobs name files on the machine, so only local clients are accepted by default")
+	dir := fs.String("dir", ".", "The directory to write the rendered files to")
+	workers := fs.Int("workers", 1, "The number of jobs to render concurrently, each in its own OpenGL context")
+	var lim sandboxLimits
+	lim.flags(fs)
+	var limits submissionLimits
+	limits.flags(fs)
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if *workers < 1 {
+		return fmt.Errorf("-workers must be at least 1")
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := newJobQueue(*dir, runJobProcess(lim, limits))
+	q.limits = limits
+	for i := 0; i < *workers; i++ {
+		go q.work(ctx)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/jobs", q)
+	mux.Handle("/jobs/", q)
+	log.Printf("Accepting jobs on %s", *listen)
+	return http.ListenAndServe(*listen, mux)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobQueue(t *testing.T) {
+	ran := make(chan int)
+	q := newJobQueue(t.TempDir(), func(ctx context.Context, j *job) error {
+		ran <- j.ID
+		return nil
+	})
+	for _, priority := range []int{0, 5, 0, 10} {
+		if _, err := q.submit(jobSpec{Inputs: []string{"a.glsl"}, Geometry: "8x8", Format: "png", Priority: priority}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.cancel(3); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.work(ctx)
+	var order []int
+	for i := 0; i < 3; i++ {
+		select {
+		case id := <-ran:
+			order = append(order, id)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	if exp := []int{4, 2, 1}; !reflect.DeepEqual(order, exp) {
+		t.Fatalf("unexpected order: exp %v, got %v", exp, order)
+	}
+	if j, _ := q.get(3); j.Status != jobCanceled {
+		t.Fatalf("unexpected status of canceled job: %s", j.Status)
+	}
+}
+
+func TestJobSpecValidate(t *testing.T) {
+	if err := (jobSpec{Inputs: []string{"a.glsl"}, Geometry: "8x8", Format: "nope"}).validate(); err == nil {
+		t.Fatal("expected an error for an invalid format")
+	}
+	if err := (jobSpec{Inputs: []string{"a.glsl"}, Geometry: "8x8", Format: "gif", Framerate: 30}).validate(); err == nil {
+		t.Fatal("expected an error for an unbounded animation")
+	}
+}
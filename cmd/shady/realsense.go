@@ -0,0 +1,7 @@
+//go:build realsense
+
+package main
+
+import (
+	_ "github.com/polyfloyd/shady/shadertoy/realsense"
+)
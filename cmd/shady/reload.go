@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// A liveProject is a project that is loaded again every time the scene is
+// set up, so changes to the project file can be applied without interrupting
+// the output.
+//
+// Only the scene, i.e. the shader sources and how they are connected, can be
+// changed while rendering. The geometry, framerate, environment and GLSL
+// version are fixed for the lifetime of the output stream and the OpenGL
+// context, so changes to them are reported, but require a restart.
+type liveProject struct {
+	filename string
+	// inputs and mappings are set when the input files and mappings are
+	// taken from the project rather than the command line.
+	inputs, mappings bool
+
+	lock sync.Mutex
+	proj *project
+}
+
+func (lp *liveProject) get() *project {
+	lp.lock.Lock()
+	defer lp.lock.Unlock()
+	return lp.proj
+}
+
+// reload loads the project file again and reports whether the scene changed.
+// If it can not be loaded, the previous version remains in use.
+func (lp *liveProject) reload() bool {
+	proj, err := loadProject(lp.filename)
+	if err != nil {
+		log.Printf("Could not reload project, keeping the previous version: %v", err)
+		return false
+	}
+	lp.lock.Lock()
+	defer lp.lock.Unlock()
+	scene, restart := diffProjects(lp.proj, proj)
+	if scene {
+		log.Printf("Project %s changed, reloading the scene", lp.filename)
+	}
+	for _, setting := range restart {
+		log.Printf("The %q setting of the project changed, restart shady to apply it", setting)
+	}
+	lp.proj = proj
+	return scene
+}
+
+// scene returns the input files, mappings and project to set up the scene
+// with. The defaults are used for the inputs and mappings that were set on
+// the command line.
+func (lp *liveProject) scene(inputFiles, mappings []string) ([]string, []string, *project) {
+	proj := lp.get()
+	if lp.inputs {
+		inputFiles = proj.inputFiles()
+	}
+	if lp.mappings {
+		mappings = proj.Mappings
+	}
+	return inputFiles, mappings, proj
+}
+
+// diffProjects compares two versions of a project. scene is set if the
+// shaders or their inputs differ. restart lists the changed settings that
+// can not be applied while rendering.
+func diffProjects(a, b *project) (scene bool, restart []string) {
+	scene = !reflect.DeepEqual(a.Inputs, b.Inputs) ||
+		!reflect.DeepEqual(a.Mappings, b.Mappings) ||
+		!reflect.DeepEqual(a.Channels, b.Channels) ||
+		!reflect.DeepEqual(a.Passes, b.Passes) ||
+		!reflect.DeepEqual(a.Template, b.Template)
+	if a.Env != b.Env {
+		restart = append(restart, "env")
+	}
+	if a.Geometry != b.Geometry {
+		restart = append(restart, "geometry")
+	}
+	if a.Framerate != b.Framerate {
+		restart = append(restart, "framerate")
+	}
+	if a.GLSL != b.GLSL {
+		restart = append(restart, "glsl")
+	}
+	return scene, restart
+}
+
+// reloadProject sets up the scene again every time a SIGHUP is received,
+// which reloads the project. If watch is set, the scene is also set up again
+// when the project file changes in a way that affects it. With -w, the project
+// file is watched along with the sources instead.
+func reloadProject(ctx context.Context, engine interface{ SetEnvironment(renderer.Environment) }, newFn func() (renderer.Environment, []string, error), fallback func(error) renderer.Environment, live *liveProject, watch bool) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if watch {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("Could not watch the project file: %v", err)
+		} else {
+			defer watcher.Close()
+			// Editors often replace the file rather than writing to it,
+			// so its directory is watched.
+			if err := watcher.Add(filepath.Dir(live.filename)); err != nil {
+				log.Printf("Could not watch the project file: %v", err)
+			}
+			events, errs = watcher.Events, watcher.Errors
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+		case ev := <-events:
+			if filepath.Clean(ev.Name) != filepath.Clean(live.filename) {
+				continue
+			}
+			// Wait for the file to be written completely.
+			t := time.NewTimer(time.Millisecond * 20)
+		outer:
+			for {
+				select {
+				case <-events:
+				case <-t.C:
+					break outer
+				}
+			}
+			if !live.reload() {
+				continue
+			}
+		case err := <-errs:
+			log.Println(err)
+			continue
+		}
+		reloadEnvironment(engine, newFn, fallback)
+	}
+}
+
+// reloadEnvironment sets up the scene again. If it can not be loaded, the
+// fallback is shown if set, or the previous scene is kept otherwise.
+func reloadEnvironment(engine interface{ SetEnvironment(renderer.Environment) }, newFn func() (renderer.Environment, []string, error), fallback func(error) renderer.Environment) {
+	env, _, err := newFn()
+	if err != nil && fallback != nil {
+		env = fallback(err)
+	} else if err != nil {
+		log.Println(err)
+		return
+	}
+	engine.SetEnvironment(env)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func TestDiffProjects(t *testing.T) {
+	a := &project{Inputs: []string{"a.glsl"}, Geometry: "64x64", Framerate: 30}
+
+	b := *a
+	b.Inputs = []string{"b.glsl"}
+	if scene, restart := diffProjects(a, &b); !scene || len(restart) > 0 {
+		t.Fatalf("unexpected diff: scene=%v, restart=%v", scene, restart)
+	}
+
+	c := *a
+	c.Geometry = "32x32"
+	c.Framerate = 60
+	scene, restart := diffProjects(a, &c)
+	if scene || !reflect.DeepEqual(restart, []string{"geometry", "framerate"}) {
+		t.Fatalf("unexpected diff: scene=%v, restart=%v", scene, restart)
+	}
+}
+
+// envRecorder records the environments that are set.
+type envRecorder chan renderer.Environment
+
+func (r envRecorder) SetEnvironment(env renderer.Environment) {
+	r <- env
+}
+
+func TestReloadProject(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "shady.json")
+	write := func(content string) {
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"inputs": ["a.glsl"], "geometry": "64x64"}`)
+	proj, err := loadProject(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := &liveProject{filename: filename, inputs: true, proj: proj}
+	newFn := func() (renderer.Environment, []string, error) {
+		live.reload()
+		return nil, nil, nil
+	}
+	engine := make(envRecorder, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloadProject(ctx, engine, newFn, nil, live, true)
+
+	// The file is written until the change is seen, as the watcher may not
+	// be set up yet.
+	timeout := time.After(5 * time.Second)
+	for reloaded := false; !reloaded; {
+		write(`{"inputs": ["b.glsl"], "geometry": "64x64"}`)
+		select {
+		case <-engine:
+			reloaded = true
+		case <-time.After(50 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("the scene was not set up again after the inputs changed")
+		}
+	}
+	if inputs := live.get().Inputs; !reflect.DeepEqual(inputs, []string{"b.glsl"}) {
+		t.Fatalf("unexpected inputs: %v", inputs)
+	}
+
+	// Changes that require a restart do not affect the scene.
+	write(`{"inputs": ["b.glsl"], "geometry": "32x32"}`)
+	for live.get().Geometry != "32x32" {
+		select {
+		case <-engine:
+			t.Fatal("the scene was set up again after the geometry changed")
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("the project was not reloaded")
+		}
+	}
+	select {
+	case <-engine:
+		t.Fatal("the scene was set up again after the geometry changed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
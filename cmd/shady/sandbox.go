@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sandboxEnvVar is set for processes started by runSandboxed. It contains the
+// limits the process should apply to itself.
+const sandboxEnvVar = "SHADY_SANDBOX"
+
+// sandboxLimits restricts the resources a sandboxed process may use. Zero
+// values disable a limit.
+type sandboxLimits struct {
+	// Timeout is the wall clock time after which the process is killed.
+	Timeout time.Duration `json:"timeout"`
+	// CPUTime is the processor time the process may use.
+	CPUTime time.Duration `json:"cpu_time"`
+	// Memory is the size of the address space of the process in bytes.
+	Memory uint64 `json:"memory"`
+	// FileSize is the maximum size of the files written by the process in
+	// bytes.
+	FileSize uint64 `json:"file_size"`
+}
+
+// flags registers the command line flags for the limits.
+func (lim *sandboxLimits) flags(fs *flag.FlagSet) {
+	fs.DurationVar(&lim.Timeout, "timeout", 0, "Kill the process after the specified duration")
+	fs.DurationVar(&lim.CPUTime, "cpu-limit", 0, "Limit the processor time the process may use")
+	fs.Func("memory-limit", "Limit the address space of the process, e.g. 4G. OpenGL drivers may reserve a lot of address space, so this should not be set too low", func(s string) (err error) {
+		lim.Memory, err = parseByteSize(s)
+		return err
+	})
+	fs.Func("file-size-limit", "Limit the size of the files written by the process, e.g. 500M", func(s string) (err error) {
+		lim.FileSize, err = parseByteSize(s)
+		return err
+	})
+}
+
+func parseByteSize(s string) (uint64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(s), "B")
+	shift := 0
+	if i := strings.IndexAny(num, "KMGT"); i > 0 && i == len(num)-1 {
+		shift = 10 * (1 + strings.IndexByte("KMGT", num[i]))
+		num = num[:i]
+	}
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return n << shift, nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if n := b.max - b.Len(); n < len(p) {
+		b.Buffer.Write(p[:n])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// sandboxCommand implements "shady sandbox", which runs shady with the
+// arguments following "--" in a subprocess with resource limits.
+func sandboxCommand(args []string) error {
+	fs := flag.NewFlagSet("sandbox", flag.ContinueOnError)
+	var lim sandboxLimits
+	lim.flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shady sandbox [limits] -- [shady arguments]\n")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	return runSandboxed(context.Background(), lim, fs.Args(), os.Stdout)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// applySandbox applies the limits passed by a supervising process, if any.
+// It should be called before any shader is loaded.
+func applySandbox() error {
+	env := os.Getenv(sandboxEnvVar)
+	if env == "" {
+		return nil
+	}
+	var lim sandboxLimits
+	if err := json.Unmarshal([]byte(env), &lim); err != nil {
+		return fmt.Errorf("invalid sandbox limits: %w", err)
+	}
+	setrlimit := func(resource int, value uint64) error {
+		return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+	}
+	// Crashes should not leave core dumps of untrusted programs behind.
+	if err := setrlimit(syscall.RLIMIT_CORE, 0); err != nil {
+		return err
+	}
+	if lim.CPUTime > 0 {
+		seconds := uint64((lim.CPUTime + time.Second - 1) / time.Second)
+		if err := setrlimit(syscall.RLIMIT_CPU, seconds); err != nil {
+			return err
+		}
+	}
+	if lim.Memory > 0 {
+		if err := setrlimit(syscall.RLIMIT_AS, lim.Memory); err != nil {
+			return err
+		}
+	}
+	if lim.FileSize > 0 {
+		if err := setrlimit(syscall.RLIMIT_FSIZE, lim.FileSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSandboxed runs shady with the arguments in a separate process that is
+// subject to the limits. Crashes of the process, e.g. because of a broken
+// driver, are reported as errors instead of affecting the caller.
+func runSandboxed(ctx context.Context, lim sandboxLimits, args []string, stdout io.Writer) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	limits, err := json.Marshal(lim)
+	if err != nil {
+		return err
+	}
+	if lim.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, lim.Timeout)
+		defer cancel()
+	}
+
+	stderr := &cappedBuffer{max: 64 << 10}
+	cmd := exec.Command(executable, args...)
+	cmd.Env = append(os.Environ(), sandboxEnvVar+"="+string(limits))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		// Run in a separate process group so any processes it starts can
+		// be killed along with it.
+		Setpgid: true,
+		// Do not outlive the supervisor.
+		Pdeathsig: syscall.SIGKILL,
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+
+	err = cmd.Wait()
+	if err == nil {
+		return nil
+	}
+	reason := err.Error()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			switch sig := status.Signal(); {
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				reason = fmt.Sprintf("timed out after %v", lim.Timeout)
+			case ctx.Err() != nil:
+				reason = "canceled"
+			case lim.CPUTime > 0 && exitErr.UserTime()+exitErr.SystemTime() >= lim.CPUTime:
+				// Reaching the hard limit kills the process.
+				reason = fmt.Sprintf("exceeded the CPU time limit of %v", lim.CPUTime)
+			case sig == syscall.SIGXFSZ:
+				reason = "exceeded the file size limit"
+			default:
+				reason = fmt.Sprintf("crashed: %v", sig)
+			}
+		}
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%s: %s", reason, msg)
+	}
+	return errors.New(reason)
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// applySandbox is only supported on Linux, where the limits are applied with
+// setrlimit(2). Elsewhere, sandboxed processes refuse to run rather than run
+// without their limits.
+func applySandbox() error {
+	if os.Getenv(sandboxEnvVar) != "" {
+		return errors.New("the sandbox is only supported on Linux")
+	}
+	return nil
+}
+
+// runSandboxed is only supported on Linux.
+func runSandboxed(ctx context.Context, lim sandboxLimits, args []string, stdout io.Writer) error {
+	return errors.New("the sandbox is only supported on Linux")
+}
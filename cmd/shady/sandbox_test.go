@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	for s, exp := range map[string]uint64{
+		"1024":  1024,
+		"4K":    4 << 10,
+		"2G":    2 << 30,
+		"500mb": 500 << 20,
+	} {
+		if n, err := parseByteSize(s); err != nil || n != exp {
+			t.Errorf("parseByteSize(%q): exp %d, got %d, %v", s, exp, n, err)
+		}
+	}
+	if _, err := parseByteSize("lots"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
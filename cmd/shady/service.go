@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sdNotify sends a state notification to the service manager as specified by
+// sd_notify(3). It does nothing if shady was not started by systemd.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// Abstract namespace socket.
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the interval at which the watchdog of the service
+// manager should be notified, or 0 if the watchdog is disabled.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec == 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// health tracks the progress of the render loop.
+type health struct {
+	// timeout is the time after which the render loop is considered to be
+	// stalled if no frame was output.
+	timeout time.Duration
+
+	lock      sync.Mutex
+	start     time.Time
+	lastFrame time.Time
+	frames    uint64
+}
+
+func newHealth(timeout time.Duration) *health {
+	return &health{timeout: timeout, start: time.Now()}
+}
+
+// monitor passes on the frames of the stream, recording their progress. In
+// service mode, readiness is reported once the first frame is rendered and
+// the watchdog is notified for as long as frames keep being rendered.
+func (h *health) monitor(in <-chan image.Image, service bool) <-chan image.Image {
+	out := make(chan image.Image)
+	watchdog := time.Duration(0)
+	if service {
+		watchdog = watchdogInterval()
+	}
+	go func() {
+		defer close(out)
+		var lastWatchdog time.Time
+		for img := range in {
+			h.lock.Lock()
+			h.lastFrame = time.Now()
+			h.frames++
+			first := h.frames == 1
+			h.lock.Unlock()
+
+			if service && first {
+				if err := sdNotify("READY=1"); err != nil {
+					log.Printf("Could not notify service manager: %v", err)
+				}
+			}
+			if watchdog > 0 && time.Since(lastWatchdog) >= watchdog {
+				sdNotify("WATCHDOG=1")
+				lastWatchdog = time.Now()
+			}
+			out <- img
+		}
+	}()
+	return out
+}
+
+// healthStatus is the response of the /healthz endpoint.
+type healthStatus struct {
+	Healthy bool    `json:"healthy"`
+	Frames  uint64  `json:"frames"`
+	Uptime  float64 `json:"uptime"`
+	// SinceLastFrame is the number of seconds since the last frame was
+	// rendered, or -1 if no frame was rendered yet.
+	SinceLastFrame float64 `json:"since_last_frame"`
+}
+
+func (h *health) status() healthStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	st := healthStatus{
+		Frames:         h.frames,
+		Uptime:         time.Since(h.start).Seconds(),
+		SinceLastFrame: -1,
+	}
+	if !h.lastFrame.IsZero() {
+		since := time.Since(h.lastFrame)
+		st.SinceLastFrame = since.Seconds()
+		st.Healthy = since < h.timeout
+	}
+	return st
+}
+
+func (h *health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	st := h.status()
+	w.Header().Set("Content-Type", "application/json")
+	if !st.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(st)
+}
+
+// serveHTTP serves the endpoints on the address until the context is
+// canceled.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			log.Printf("HTTP server on %s: %v", addr, err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/shm"
+	"github.com/polyfloyd/shady/zmq"
+)
+
+// sinkSettings holds the flags of the sinks built into the command.
+type sinkSettings struct {
+	shmSlots       int
+	zmqTopic       string
+	zmqFormat      string
+	zmqQuality     int
+	zmqSubsampling string
+	zmqBitrate     string
+	sheetColumns   int
+}
+
+func (s *sinkSettings) flags(fs *flag.FlagSet) {
+	fs.IntVar(&s.shmSlots, "shm-slots", 3, "The number of frames in the shared memory ring buffer of -ofmt shm")
+	fs.StringVar(&s.zmqTopic, "zmq-topic", "shady", "The prefix of the topics frames are published on with -ofmt zmq. Each output is published on the prefix and its name, e.g. shady/color and shady/depth")
+	fs.StringVar(&s.zmqFormat, "zmq-format", "rgba32", "The format of the frames published with -ofmt zmq, e.g. jpg to compress them")
+	fs.IntVar(&s.zmqQuality, "zmq-quality", 75, "The JPEG quality of frames published with -ofmt zmq and -zmq-format jpg, from 1 to 100. With -zmq-bitrate or subscribers that lag, this is the maximum")
+	fs.StringVar(&s.zmqSubsampling, "zmq-subsampling", "420", "The chroma subsampling of JPEG frames published with -ofmt zmq: 420, or gray to drop the color")
+	fs.StringVar(&s.zmqBitrate, "zmq-bitrate", "", "The target bitrate of JPEG frames published with -ofmt zmq, e.g. 2M for 2 megabits per second. The quality is lowered to stay under it")
+	fs.IntVar(&s.sheetColumns, "sheet-columns", 0, "The number of frames per row of -ofmt sheet. If 0, the sheet is made as square as possible")
+}
+
+// registerSinks makes the sinks built into the command available as output
+// formats. They are configured with the settings at the time they are opened.
+func registerSinks(s *sinkSettings) {
+	encode.RegisterSink("shm", func(c encode.SinkConfig) (encode.Sink, error) {
+		w, err := shm.Create(c.Target, c.Width, c.Height, s.shmSlots)
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	})
+	encode.RegisterSink("sheet", func(c encode.SinkConfig) (encode.Sink, error) {
+		if c.Target == "-" {
+			return nil, errors.New("sprite sheets can not be written to stdout")
+		}
+		return encode.NewSpriteSheet(c.Target, s.sheetColumns, c.Interval), nil
+	})
+	encode.RegisterSink("zmq", func(c encode.SinkConfig) (encode.Sink, error) {
+		z, err := newZMQSink(c.Target, s.zmqTopic, s.zmqFormat, c.Interval)
+		if err != nil {
+			return nil, err
+		}
+		if err := z.configureJPEG(s.zmqQuality, s.zmqSubsampling, s.zmqBitrate); err != nil {
+			z.Close()
+			return nil, err
+		}
+		return z, nil
+	})
+}
+
+// zmqHighWaterMark is the number of frames queued for a subscriber before
+// frames are dropped.
+const zmqHighWaterMark = 4
+
+// A frameHeader is the second part of the messages published over ZeroMQ,
+// describing the image in the third part.
+type frameHeader struct {
+	Frame  uint64  `json:"frame"`
+	Time   float64 `json:"time"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Format string  `json:"format"`
+	// Quality is the JPEG quality the frame was encoded with.
+	Quality int `json:"quality,omitempty"`
+}
+
+// zmqSink publishes frames on a ZeroMQ PUB socket. Every frame is a message
+// of three parts: the topic, a JSON frameHeader and the image encoded in the
+// format. The topic of an output is the configured topic followed by a slash
+// and the name of the output, so subscribers can pick the outputs they need.
+type zmqSink struct {
+	pub        *zmq.Publisher
+	topic      string
+	format     encode.Format
+	formatName string
+	interval   time.Duration
+
+	// lock guards the fields below, as additional outputs are published
+	// concurrently with the color output.
+	lock sync.Mutex
+	// frames holds the number of the next frame of each output.
+	frames map[string]uint64
+	// quality adapts the quality of the JPEG frames of each output, nil for
+	// other formats.
+	quality map[string]*encode.QualityController
+	// newQuality creates the controller of an output.
+	newQuality func() *encode.QualityController
+}
+
+func newZMQSink(endpoint, topic, formatName string, interval time.Duration) (*zmqSink, error) {
+	format, ok := encode.Formats[formatName]
+	if !ok {
+		return nil, fmt.Errorf("invalid format: %q", formatName)
+	}
+	pub, err := zmq.Listen(endpoint, zmqHighWaterMark)
+	if err != nil {
+		return nil, err
+	}
+	return &zmqSink{
+		pub:        pub,
+		topic:      topic,
+		format:     format,
+		formatName: formatName,
+		interval:   interval,
+		frames:     map[string]uint64{},
+	}, nil
+}
+
+// minJPEGQuality is the lowest quality to which JPEG frames are lowered to
+// keep up with subscribers.
+const minJPEGQuality = 10
+
+// configureJPEG sets the quality and chroma subsampling of JPEG frames and
+// enables adapting the quality to the bitrate and to subscribers that lag.
+func (s *zmqSink) configureJPEG(quality int, subsampling, bitrate string) error {
+	jpg, ok := s.format.(encode.JPGFormat)
+	if !ok {
+		return nil
+	}
+	if quality < 1 || quality > 100 {
+		return fmt.Errorf("invalid JPEG quality: %d", quality)
+	}
+	switch subsampling {
+	case "420":
+	case "gray":
+		jpg.Grayscale = true
+	default:
+		return fmt.Errorf("invalid chroma subsampling: %q", subsampling)
+	}
+	var bps float64
+	if bitrate != "" {
+		var err error
+		if bps, err = parseBitrate(bitrate); err != nil {
+			return err
+		}
+	}
+	s.format = jpg
+	s.quality = map[string]*encode.QualityController{}
+	s.newQuality = func() *encode.QualityController {
+		return encode.NewQualityController(minJPEGQuality, quality, bps, s.interval)
+	}
+	return nil
+}
+
+func (s *zmqSink) Write(img image.Image) error {
+	return s.publish("color", img)
+}
+
+// publish sends a frame of the named output.
+func (s *zmqSink) publish(output string, img image.Image) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var quality int
+	controller := s.quality[output]
+	if s.quality != nil && controller == nil {
+		controller = s.newQuality()
+		s.quality[output] = controller
+	}
+	if controller != nil {
+		quality = controller.Quality()
+		jpg := s.format.(encode.JPGFormat)
+		jpg.Quality = quality
+		s.format = jpg
+	}
+	var buf bytes.Buffer
+	if err := s.format.Encode(&buf, img); err != nil {
+		return err
+	}
+	header, err := json.Marshal(frameHeader{
+		Frame:   s.frames[output],
+		Time:    (time.Duration(s.frames[output]) * s.interval).Seconds(),
+		Width:   img.Bounds().Dx(),
+		Height:  img.Bounds().Dy(),
+		Format:  s.formatName,
+		Quality: quality,
+	})
+	if err != nil {
+		return err
+	}
+	if controller != nil {
+		// The backlog of the previous frames determines the quality of
+		// the next.
+		controller.Update(buf.Len(), s.pub.Lagging())
+	}
+	s.pub.Publish([]byte(s.topic+"/"+output), header, buf.Bytes())
+	s.frames[output]++
+	return nil
+}
+
+// parseBitrate parses a number of bits per second with an optional k, M or G
+// suffix, which are powers of 1000.
+func parseBitrate(s string) (float64, error) {
+	num, scale := s, 1.0
+	if i := strings.IndexAny(s, "kKMG"); i > 0 && i == len(s)-1 {
+		num, scale = s[:i], map[byte]float64{'k': 1e3, 'K': 1e3, 'M': 1e6, 'G': 1e9}[s[i]]
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid bitrate: %q", s)
+	}
+	return v * scale, nil
+}
+
+func (s *zmqSink) Close() error {
+	return s.pub.Close()
+}
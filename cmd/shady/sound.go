@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"image"
+	"io"
+	"math"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// soundCommand implements "shady sound", which renders a Shadertoy sound
+// shader to a WAV file or stream.
+func soundCommand(args []string) error {
+	fs := flag.NewFlagSet("sound", flag.ContinueOnError)
+	sf := newShaderFlags(fs)
+	duration := fs.Duration("d", 10*time.Second, "The duration of the sound to render. If 0, render until the output is closed")
+	sampleRate := fs.Int("rate", 44100, "The sample rate in Hz")
+	outputFile := fs.String("o", "-", "The WAV file to write to, or - for stdout, e.g. to play it with aplay")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	explicitInputs := len(sf.inputFiles) > 0
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	if *sf.env != "shadertoy" {
+		return errors.New("sound shaders are only supported by the shadertoy environment")
+	}
+	if *sampleRate <= 0 {
+		return errors.New("-rate must be positive")
+	}
+	inputFiles := sf.inputFiles
+	if !explicitInputs && sf.proj != nil && len(sf.proj.Sound) > 0 {
+		inputFiles = sf.proj.resolve(sf.proj.Sound)
+	}
+
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+	templateData, err := loadTemplateData(sf.proj, *sf.templateFile, sf.templateVars)
+	if err != nil {
+		return err
+	}
+	// The passes of a project belong to the image shader.
+	env, _, err := newEnvironment(*sf.env, inputFiles, sf.mappings, *sf.glslVersion, nil, templateData)
+	if err != nil {
+		return err
+	}
+	env.(*shadertoy.ShaderToy).SetSound(*sampleRate)
+	sh, err := renderer.NewShader(shadertoy.SoundBlockWidth, shadertoy.SoundBlockHeight, openGLVersion)
+	if err != nil {
+		return err
+	}
+	defer sh.Close()
+	logToStderr(sh)
+	sh.SetEnvironment(env)
+	if err := sh.Load(context.Background()); err != nil {
+		return err
+	}
+
+	w, err := openWriter(*outputFile)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	bw := bufio.NewWriter(w)
+	// Stereo frames, or -1 if the length is unknown.
+	numFrames := int64(-1)
+	if *duration > 0 {
+		numFrames = int64(math.Round(duration.Seconds() * float64(*sampleRate)))
+	}
+	if err := writeWAVHeader(bw, *sampleRate, 2, numFrames); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan image.Image)
+	errs := make(chan error, 1)
+	go func() {
+		defer cancel()
+		written := int64(0)
+		for img := range stream {
+			samples, err := shadertoy.DecodeSound(renderer.FrameRGBA(img))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if numFrames >= 0 && written+int64(len(samples)/2) > numFrames {
+				samples = samples[:(numFrames-written)*2]
+			}
+			if err := binary.Write(bw, binary.LittleEndian, samples); err != nil {
+				errs <- err
+				return
+			}
+			written += int64(len(samples) / 2)
+			if written == numFrames {
+				break
+			}
+		}
+		errs <- bw.Flush()
+	}()
+	sh.Animate(ctx, time.Second, stream)
+	return <-errs
+}
+
+// writeWAVHeader writes the header of a WAV file with 16 bit samples. If the
+// number of frames is negative, the maximum length is declared so the file
+// can be streamed.
+func writeWAVHeader(w io.Writer, sampleRate, channels int, numFrames int64) error {
+	dataSize := uint32(math.MaxUint32 - 36)
+	if numFrames >= 0 {
+		dataSize = uint32(numFrames * int64(channels) * 2)
+	}
+	header := struct {
+		RIFF          [4]byte
+		Size          uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		Size:          36 + dataSize,
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        1, // PCM
+		Channels:      uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * channels * 2),
+		BlockAlign:    uint16(channels * 2),
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+	return binary.Write(w, binary.LittleEndian, header)
+}
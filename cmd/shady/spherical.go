@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polyfloyd/shady/spherical"
+)
+
+// sphericalCommand implements "shady spherical", which marks an encoded
+// equirectangular video as 360° content.
+func sphericalCommand(args []string) error {
+	fs := flag.NewFlagSet("spherical", flag.ContinueOnError)
+	input := fs.String("i", "", "The MP4 or MOV file to read")
+	output := fs.String("o", "", "The file to write the video with metadata to")
+	stereo := fs.String("stereo", "none", "The stereo layout the video was rendered with. Valid values are: none, sbs (side-by-side), ou (over-under)")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if *input == "" || *output == "" {
+		return errors.New("please specify the input and output files with -i and -o")
+	}
+	switch ext := strings.ToLower(filepath.Ext(*input)); ext {
+	case ".mp4", ".m4v", ".mov":
+	case ".webm", ".mkv":
+		return fmt.Errorf("%s files are not supported, please encode to MP4", ext)
+	default:
+		return fmt.Errorf("unsupported file type: %q", ext)
+	}
+	meta := spherical.Metadata{Software: "shady"}
+	switch *stereo {
+	case "none":
+		meta.Stereo = spherical.StereoMono
+	case "sbs":
+		meta.Stereo = spherical.StereoLeftRight
+	case "ou":
+		meta.Stereo = spherical.StereoTopBottom
+	default:
+		return fmt.Errorf("invalid stereo layout: %q (valid: none, sbs, ou)", *stereo)
+	}
+
+	in, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := spherical.InjectMP4(in, info.Size(), out, meta); err != nil {
+		out.Close()
+		os.Remove(*output)
+		return fmt.Errorf("%s: %w", *input, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/status"
+)
+
+// statusFallback returns a function that creates a status screen environment
+// showing an error. It is shown when a shader fails to load.
+func statusFallback(url string, width, height uint, glslVersion string) func(error) renderer.Environment {
+	return func(err error) renderer.Environment {
+		log.Println(err)
+		env, err := status.NewEnvironment(status.Screen{Err: err, URL: url}, width, height, glslVersion)
+		if err != nil {
+			log.Printf("Could not create status screen: %v", err)
+			return nil
+		}
+		return env
+	}
+}
+
+// fallbackReporter shows the status screen for errors that occur while
+// watching the environment.
+type fallbackReporter struct {
+	engine   interface{ SetEnvironment(renderer.Environment) }
+	fallback func(error) renderer.Environment
+}
+
+func (r fallbackReporter) SetEnvironment(env renderer.Environment) {
+	r.engine.SetEnvironment(env)
+}
+
+func (r fallbackReporter) ReportError(err error) {
+	if env := r.fallback(err); env != nil {
+		r.engine.SetEnvironment(env)
+	}
+}
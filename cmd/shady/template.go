@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadTemplateData combines the template data of the project, the data file
+// and the variables, in increasing order of precedence. Variables are
+// formatted as NAME=VALUE, where VALUE is parsed as JSON if possible and used
+// as a string otherwise.
+//
+// nil is returned if no data is specified, which disables templating.
+func loadTemplateData(proj *project, filename string, vars []string) (interface{}, error) {
+	if (proj == nil || proj.Template == nil) && filename == "" && len(vars) == 0 {
+		return nil, nil
+	}
+	data := map[string]interface{}{}
+	if proj != nil {
+		for k, v := range proj.Template {
+			data[k] = v
+		}
+	}
+	if filename != "" {
+		buf, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var fileData map[string]interface{}
+		if err := json.Unmarshal(buf, &fileData); err != nil {
+			return nil, fmt.Errorf("could not parse template data %q: %w", filename, err)
+		}
+		for k, v := range fileData {
+			data[k] = v
+		}
+	}
+	for _, v := range vars {
+		i := strings.IndexByte(v, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid template variable: %q (format: NAME=VALUE)", v)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(v[i+1:]), &value); err != nil {
+			value = v[i+1:]
+		}
+		data[v[:i]] = value
+	}
+	return data, nil
+}
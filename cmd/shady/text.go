@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// A textOverlay renders a template as text for every frame. The template has
+// access to the following functions:
+//
+//	fps              The measured number of frames rendered per second
+//	time             The time of the frame in seconds
+//	frame            The number of the frame, starting at 0
+//	timecode         The SMPTE timecode of the frame, e.g. 00:00:01:12
+//	uniform "name"   The value of a uniform of the shader
+type textOverlay struct {
+	tmpl     *template.Template
+	face     font.Face
+	timecode timecode
+
+	frame    renderer.OverlayFrame
+	lastDraw time.Time
+	fps      float64
+}
+
+// newTextOverlay parses the template and loads the font. If fontFile is
+// empty, Go Mono is used. The timecode function formats frames with tc, which
+// is the zero value if no frame rate is set.
+func newTextOverlay(text, fontFile string, size float64, tc timecode) (*textOverlay, error) {
+	face, err := loadFace(fontFile, size)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &textOverlay{face: face, timecode: tc}
+	t.tmpl, err = template.New("text").Funcs(template.FuncMap{
+		"fps": func() string {
+			return fmt.Sprintf("%.1f", t.fps)
+		},
+		"time": func() string {
+			return fmt.Sprintf("%.2f", t.frame.Time.Seconds())
+		},
+		"frame": func() uint64 {
+			return t.frame.Frame
+		},
+		"timecode": func() (string, error) {
+			if t.timecode.rate == 0 {
+				return "", fmt.Errorf("timecodes require a frame rate to be set with -f")
+			}
+			return t.timecode.format(t.frame.Frame), nil
+		},
+		"uniform": func(name string) (string, error) {
+			value, ok := t.frame.Uniform(name)
+			if !ok {
+				return "", fmt.Errorf("no such uniform: %q", name)
+			}
+			return formatUniform(value), nil
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// loadFace loads a TrueType font at a size in pixels. If fontFile is empty,
+// Go Mono is used.
+func loadFace(fontFile string, size float64) (font.Face, error) {
+	ttf := gomono.TTF
+	if fontFile != "" {
+		var err error
+		if ttf, err = os.ReadFile(fontFile); err != nil {
+			return nil, err
+		}
+	}
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse font: %v", err)
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+func formatUniform(value []float32) string {
+	s := make([]string, len(value))
+	for i, v := range value {
+		s[i] = fmt.Sprintf("%.3g", v)
+	}
+	if len(s) == 1 {
+		return s[0]
+	}
+	return "(" + strings.Join(s, ", ") + ")"
+}
+
+// execute evaluates the template for a frame.
+func (t *textOverlay) execute(frame renderer.OverlayFrame) (string, error) {
+	now := time.Now()
+	if !t.lastDraw.IsZero() {
+		// Smooth the measurement to keep the number readable.
+		fps := 1 / now.Sub(t.lastDraw).Seconds()
+		if t.fps == 0 {
+			t.fps = fps
+		} else {
+			t.fps = t.fps*0.9 + fps*0.1
+		}
+	}
+	t.lastDraw = now
+	t.frame = frame
+
+	var buf strings.Builder
+	if err := t.tmpl.Execute(&buf, nil); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Render draws the text on a translucent background. It implements the Render
+// function of renderer.Overlay.
+func (t *textOverlay) Render(frame renderer.OverlayFrame) image.Image {
+	text, err := t.execute(frame)
+	if err != nil {
+		log.Printf("Error rendering text: %v", err)
+		text = err.Error()
+	}
+	return drawText(t.face, strings.Split(strings.TrimRight(text, "\n"), "\n"), color.White)
+}
+
+// drawText draws lines of text in a color on a translucent background.
+func drawText(face font.Face, lines []string, c color.Color) *image.RGBA {
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	padding := lineHeight / 4
+	width := 0
+	for _, line := range lines {
+		if w := font.MeasureString(face, line).Ceil(); w > width {
+			width = w
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width+padding*2, lineHeight*len(lines)+padding*2))
+	draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{A: 0x80}), image.Point{}, draw.Src)
+	d := font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face}
+	for i, line := range lines {
+		d.Dot = fixed.P(padding, padding+i*lineHeight+metrics.Ascent.Ceil())
+		d.DrawString(line)
+	}
+	return img
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/polyfloyd/shady/encode"
+)
+
+// configureTIFF applies the -tiff-bits flag to the TIFF format.
+func configureTIFF(bits int) error {
+	if bits != 8 && bits != 16 {
+		return fmt.Errorf("invalid number of TIFF bits: %d (valid: 8, 16)", bits)
+	}
+	tiff := encode.Formats["tiff"].(encode.TIFFFormat)
+	tiff.Bits = bits
+	encode.Formats["tiff"] = tiff
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+type tileResult struct {
+	Width  uint `json:"width"`
+	Height uint `json:"height"`
+	// X and Y hold the largest differences in any color channel, from 0 to
+	// 255, across the vertical and horizontal seams.
+	X        delta `json:"x"`
+	Y        delta `json:"y"`
+	Seamless bool  `json:"seamless"`
+}
+
+// tileCommand implements "shady tile", which checks whether the output of a
+// shader tiles seamlessly and renders a tiled preview.
+func tileCommand(args []string) error {
+	fs := flag.NewFlagSet("tile", flag.ContinueOnError)
+	sf := newShaderFlags(fs)
+	geometry := fs.String("g", "512x512", "The geometry of a single tile in WIDTHxHEIGHT format")
+	tolerance := fs.Int("seam-tolerance", 2, "How much larger the difference in a color channel across a seam, from 0 to 255, may be than the largest difference between adjacent pixels within the tile")
+	previewFile := fs.String("preview", "", "Write a preview of 3x3 tiles to the specified file")
+	offset := fs.Bool("offset", false, "Shift the preview by half a tile so the seams are in the middle")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	if *sf.env != "shadertoy" {
+		return errors.New("tiling is only supported by the shadertoy environment")
+	}
+	width, height, err := parseGeometry(*geometry)
+	if err != nil {
+		return err
+	}
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+
+	render := func(tiling shadertoy.Tiling) (image.Image, error) {
+		env, _, err := sf.newEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		env.(*shadertoy.ShaderToy).SetTiling(tiling)
+		n := uint(tiling.Tiles)
+		sh, err := renderer.NewShader(width*n, height*n, openGLVersion)
+		if err != nil {
+			return nil, err
+		}
+		defer sh.Close()
+		logToStderr(sh)
+		sh.SetEnvironment(env)
+		if err := sh.Load(context.Background()); err != nil {
+			return nil, err
+		}
+		return sh.Image(context.Background(), time.Second/60)
+	}
+
+	img, err := render(shadertoy.Tiling{Tiles: 1})
+	if err != nil {
+		return err
+	}
+	res := tileResult{Width: width, Height: height}
+	res.X, res.Y = seamDeltas(renderer.FrameRGBA(img))
+	res.Seamless = res.X.seamless(*tolerance) && res.Y.seamless(*tolerance)
+
+	if *previewFile != "" {
+		preview, err := render(shadertoy.Tiling{Tiles: 3, Offset: *offset})
+		if err != nil {
+			return err
+		}
+		if err := writeImage(*previewFile, preview); err != nil {
+			return err
+		}
+	}
+
+	if *sf.json {
+		if err := printJSON(res); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Max seam delta: x=%d y=%d\n", res.X.Seam, res.Y.Seam)
+		fmt.Printf("Max delta within the tile: x=%d y=%d\n", res.X.Interior, res.Y.Interior)
+	}
+	if !res.Seamless {
+		if !*sf.json {
+			fmt.Println("The shader does not tile seamlessly")
+		}
+		return errCommandFailed
+	}
+	return nil
+}
+
+// seamDeltas returns the largest difference in any channel between the
+// pixels on the right and left edge, which are adjacent when the image is
+// tiled, and the largest difference between horizontally adjacent pixels
+// within the image. The same is returned for the bottom and top edge and
+// vertically adjacent pixels as y.
+func seamDeltas(img *image.RGBA) (x, y delta) {
+	b := img.Rect
+	diff := func(p, q image.Point) int {
+		i, j := img.PixOffset(p.X, p.Y), img.PixOffset(q.X, q.Y)
+		d := 0
+		for c := 0; c < 4; c++ {
+			if v := absInt(int(img.Pix[i+c]) - int(img.Pix[j+c])); v > d {
+				d = v
+			}
+		}
+		return d
+	}
+	for py := b.Min.Y; py < b.Max.Y; py++ {
+		x.add(diff(image.Pt(b.Max.X-1, py), image.Pt(b.Min.X, py)), true)
+		for px := b.Min.X; px < b.Max.X-1; px++ {
+			x.add(diff(image.Pt(px, py), image.Pt(px+1, py)), false)
+		}
+	}
+	for px := b.Min.X; px < b.Max.X; px++ {
+		y.add(diff(image.Pt(px, b.Max.Y-1), image.Pt(px, b.Min.Y)), true)
+		for py := b.Min.Y; py < b.Max.Y-1; py++ {
+			y.add(diff(image.Pt(px, py), image.Pt(px, py+1)), false)
+		}
+	}
+	return x, y
+}
+
+// A delta holds the largest differences between adjacent pixels across a seam
+// and within the image.
+type delta struct {
+	Seam     int `json:"seam"`
+	Interior int `json:"interior"`
+}
+
+func (d *delta) add(v int, seam bool) {
+	if seam && v > d.Seam {
+		d.Seam = v
+	} else if !seam && v > d.Interior {
+		d.Interior = v
+	}
+}
+
+// seamless reports whether the seam does not stand out from the rest of the
+// image by more than the tolerance.
+func (d delta) seamless(tolerance int) bool {
+	return d.Seam <= d.Interior+tolerance
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
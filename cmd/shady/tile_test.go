@@ -0,0 +1,24 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSeamDeltas(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 10), 0, 0, 255})
+		}
+	}
+	img.SetRGBA(2, 3, color.RGBA{20, 0, 5, 255})
+	x, y := seamDeltas(img)
+	if x != (delta{Seam: 30, Interior: 10}) || y != (delta{Seam: 5, Interior: 5}) {
+		t.Fatalf("unexpected deltas: x=%+v y=%+v", x, y)
+	}
+	if x.seamless(2) || !y.seamless(0) {
+		t.Fatalf("unexpected seamlessness")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// A timecode labels frames with SMPTE timecodes in HH:MM:SS:FF format, so
+// rendered footage can be aligned in editing software against audio that was
+// recorded separately.
+//
+// NTSC rates of 29.97 and 59.94 fps use drop-frame timecodes, which skip frame
+// numbers at the start of every minute except each tenth to stay in sync with
+// the clock. They are separated by a semicolon instead of a colon.
+type timecode struct {
+	// rate is the nominal number of frames per second, e.g. 30 for 29.97 fps.
+	rate      int
+	dropFrame bool
+	// start is the frame count of the timecode of the first frame.
+	start uint64
+}
+
+var timecodeRe = regexp.MustCompile(`^(\d{1,2}):(\d{2}):(\d{2})[:;.](\d{2})$`)
+
+// newTimecode creates a timecode for frames rendered at the interval that
+// starts at the specified timecode.
+func newTimecode(interval time.Duration, start string) (timecode, error) {
+	if interval <= 0 {
+		return timecode{}, fmt.Errorf("timecodes require a frame rate to be set with -f")
+	}
+	fps := float64(time.Second) / float64(interval)
+	tc := timecode{rate: int(math.Round(fps))}
+	if tc.rate < 1 {
+		return timecode{}, fmt.Errorf("timecodes require a frame rate of at least 1 fps")
+	}
+	ntsc := int(math.Round(fps * 1.001))
+	if ntsc%30 == 0 && math.Abs(fps*1.001-float64(ntsc)) < 1e-3 {
+		tc.rate, tc.dropFrame = ntsc, true
+	}
+	var err error
+	if tc.start, err = tc.parse(start); err != nil {
+		return timecode{}, err
+	}
+	return tc, nil
+}
+
+// dropped returns the number of frame numbers skipped every minute.
+func (tc timecode) dropped() uint64 {
+	if !tc.dropFrame {
+		return 0
+	}
+	return uint64(tc.rate / 15)
+}
+
+// parse converts a timecode to the number of frames since midnight.
+func (tc timecode) parse(s string) (uint64, error) {
+	m := timecodeRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid timecode: %q, expected HH:MM:SS:FF", s)
+	}
+	var f [4]uint64
+	for i := range f {
+		f[i], _ = strconv.ParseUint(m[i+1], 10, 64)
+	}
+	hours, minutes, seconds, frames := f[0], f[1], f[2], f[3]
+	if hours >= 24 || minutes >= 60 || seconds >= 60 || frames >= uint64(tc.rate) {
+		return 0, fmt.Errorf("invalid timecode: %q, out of range at %d fps", s, tc.rate)
+	}
+	drop := tc.dropped()
+	if seconds == 0 && minutes%10 != 0 && frames < drop {
+		return 0, fmt.Errorf("invalid timecode: %q, frame numbers are dropped at the start of the minute", s)
+	}
+	totalMinutes := hours*60 + minutes
+	count := (totalMinutes*60+seconds)*uint64(tc.rate) + frames
+	return count - drop*(totalMinutes-totalMinutes/10), nil
+}
+
+// format returns the timecode of the frame with the specified number, of
+// which the first frame is 0.
+func (tc timecode) format(frame uint64) string {
+	rate := uint64(tc.rate)
+	count := tc.start + frame
+	sep := ":"
+	if drop := tc.dropped(); drop > 0 {
+		// Add the dropped frame numbers back to get a count at the nominal
+		// rate.
+		perMinute := rate*60 - drop
+		perTenMinutes := perMinute*10 + drop
+		tens, rem := count/perTenMinutes, count%perTenMinutes
+		count += 9 * drop * tens
+		if rem > drop {
+			count += drop * ((rem - drop) / perMinute)
+		}
+		sep = ";"
+	}
+	count %= 24 * 3600 * rate
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d",
+		count/(3600*rate), count/(60*rate)%60, count/rate%60, sep, count%rate)
+}
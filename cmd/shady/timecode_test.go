@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimecodeFormat(t *testing.T) {
+	tests := []struct {
+		fps      float64
+		start    string
+		frame    uint64
+		expected string
+	}{
+		{25, "00:00:00:00", 0, "00:00:00:00"},
+		{25, "00:00:00:00", 90000, "01:00:00:00"},
+		{25, "01:00:00:00", 26, "01:00:01:01"},
+		{24, "23:59:59:23", 1, "00:00:00:00"},
+		{30000.0 / 1001, "00:00:00:00", 1799, "00:00:59;29"},
+		{30000.0 / 1001, "00:00:00:00", 1800, "00:01:00;02"},
+		{30000.0 / 1001, "00:00:00:00", 3598, "00:02:00;02"},
+		{30000.0 / 1001, "00:00:00:00", 17982, "00:10:00;00"},
+		{60000.0 / 1001, "00:00:00:00", 3600, "00:01:00;04"},
+		{24000.0 / 1001, "00:00:00:00", 24, "00:00:01:00"},
+	}
+	for _, tt := range tests {
+		tc, err := newTimecode(time.Duration(float64(time.Second)/tt.fps), tt.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := tc.format(tt.frame); s != tt.expected {
+			t.Errorf("frame %d at %.3f fps from %s: expected %s, got %s", tt.frame, tt.fps, tt.start, tt.expected, s)
+		}
+	}
+}
+
+func TestTimecodeParse(t *testing.T) {
+	tc, err := newTimecode(time.Second*1001/30000, "00:00:00;00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for frame := uint64(0); frame < 40000; frame += 7 {
+		s := tc.format(frame)
+		if n, err := tc.parse(s); err != nil || n != frame {
+			t.Fatalf("%s: expected frame %d, got %d (%v)", s, frame, n, err)
+		}
+	}
+	for _, s := range []string{"00:01:00;00", "00:00:60:00", "00:00:00:30", "0:0:0:0"} {
+		if _, err := tc.parse(s); err == nil {
+			t.Errorf("expected %q to be invalid", s)
+		}
+	}
+}
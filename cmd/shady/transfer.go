@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+
+	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// colorTags describe the output of each transfer function.
+var colorTags = map[renderer.Transfer]encode.ColorTag{
+	renderer.TransferSRGB:  encode.ColorSRGB,
+	renderer.TransferBT709: encode.ColorBT709,
+	renderer.TransferHLG:   encode.ColorHLG,
+	renderer.TransferPQ:    encode.ColorPQ,
+}
+
+// configureTransfer adds the post pass of the -transfer flag to the shader and
+// tags the PNG and Y4M formats. white is the luminance of 1.0 with PQ. It
+// should be called after any other post passes are added.
+func configureTransfer(engine *renderer.Shader, float bool, name string, white float64) error {
+	transfer, err := renderer.ParseTransfer(name)
+	if err != nil || transfer == renderer.TransferNone {
+		return err
+	}
+	if transfer.HDR() && !float {
+		log.Printf("-transfer %s is set without -float, values above 1.0 are clipped", transfer)
+	}
+	pp, err := renderer.TransferPostPass(transfer, float32(white))
+	if err != nil {
+		return err
+	}
+	if err := engine.AddPostPass(pp); err != nil {
+		return err
+	}
+	tag := colorTags[transfer]
+	png := encode.Formats["png"].(encode.PNGFormat)
+	png.Color = &tag
+	encode.Formats["png"] = png
+	y4m := encode.Formats["y4m"].(encode.Y4MFormat)
+	y4m.Color = &tag
+	encode.Formats["y4m"] = y4m
+	return nil
+}
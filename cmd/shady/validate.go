@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type validateResult struct {
+	Valid    bool                  `json:"valid"`
+	Stage    renderer.Stage        `json:"stage,omitempty"`
+	Errors   []renderer.Diagnostic `json:"errors,omitempty"`
+	Uniforms []uniformInfo         `json:"uniforms,omitempty"`
+	err      error
+}
+
+type uniformInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// validateCommand implements "shady validate", which compiles a shader
+// without rendering it.
+func validateCommand(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	sf := newShaderFlags(fs)
+	watch := fs.Bool("w", false, "Watch the shader source files and validate them on every change")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	if *watch {
+		return validateWatch(sf)
+	}
+
+	res := validate(sf)
+	if *sf.json {
+		if err := printJSON(res); err != nil {
+			return err
+		}
+	} else if res.err != nil {
+		fmt.Fprintln(os.Stderr, res.err)
+	}
+	if !res.Valid {
+		return errCommandFailed
+	}
+	return nil
+}
+
+func validate(sf *shaderFlags) validateResult {
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return newValidateResult(nil, err)
+	}
+	env, _, err := sf.newEnvironment()
+	if err != nil {
+		return newValidateResult(nil, err)
+	}
+	sh, err := renderer.NewShader(1, 1, openGLVersion)
+	if err != nil {
+		return newValidateResult(nil, err)
+	}
+	defer sh.Close()
+	logToStderr(sh)
+	sh.SetEnvironment(env)
+	err = sh.Load(context.Background())
+	return newValidateResult(sh.Uniforms(), err)
+}
+
+// validateRequests is used to pass environments that should be validated, or
+// the errors that occurred while creating them, from the file watcher to the
+// goroutine owning the OpenGL context.
+type validateRequests chan interface{}
+
+func (ch validateRequests) SetEnvironment(env renderer.Environment) {
+	ch <- env
+}
+
+func (ch validateRequests) ReportError(err error) {
+	ch <- err
+}
+
+// validateWatch validates the shader each time one of its source files
+// changes, until interrupted.
+//
+// With -json, each result is printed as a single line of JSON so editor
+// integrations can consume the output as a stream.
+func validateWatch(sf *shaderFlags) error {
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+	sh, err := renderer.NewShader(1, 1, openGLVersion)
+	if err != nil {
+		return err
+	}
+	defer sh.Close()
+	logToStderr(sh)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	requests := make(validateRequests)
+	go watchEnvironment(ctx, requests, sf.newEnvironment)
+
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		var res validateResult
+		select {
+		case <-ctx.Done():
+			return nil
+		case req := <-requests:
+			switch r := req.(type) {
+			case error:
+				res = newValidateResult(nil, r)
+			case renderer.Environment:
+				sh.SetEnvironment(r)
+				err := sh.Load(ctx)
+				res = newValidateResult(sh.Uniforms(), err)
+			}
+		}
+
+		if *sf.json {
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+		} else if res.err != nil {
+			fmt.Fprintln(os.Stderr, res.err)
+		} else {
+			fmt.Fprintf(os.Stderr, "OK, %d active uniforms\n", len(res.Uniforms))
+		}
+	}
+}
+
+func newValidateResult(uniforms map[string]renderer.Uniform, err error) validateResult {
+	res := validateResult{Valid: err == nil, err: err}
+	var cerr renderer.CompileError
+	if errors.As(err, &cerr) {
+		res.Stage = cerr.Stage()
+		res.Errors = cerr.Diagnostics()
+	}
+	if err != nil && len(res.Errors) == 0 {
+		res.Errors = []renderer.Diagnostic{{Severity: "error", Message: err.Error()}}
+	}
+	if err == nil {
+		res.Uniforms = sortedUniforms(uniforms)
+	}
+	return res
+}
+
+func sortedUniforms(uniforms map[string]renderer.Uniform) []uniformInfo {
+	infos := make([]uniformInfo, 0, len(uniforms))
+	for _, u := range uniforms {
+		infos = append(infos, uniformInfo{Name: u.Name, Type: u.TypeLiteral()})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// watchCommand implements "shady watch", a live coding loop: the shader is
+// shown in a window and reloaded when its files change. Errors are shown in
+// the window over the last version that loaded, or instead of the shader if
+// none did, so the terminal is not needed while editing.
+func watchCommand(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shady watch [flags] [shader.glsl...]\n")
+		fs.PrintDefaults()
+	}
+	sf := newShaderFlags(fs)
+	vsync := fs.Bool("vsync", true, "Synchronize the window to the refresh rate of the display")
+	mjpegAddr := fs.String("mjpeg", "", "Also serve the preview as a Motion JPEG stream on the specified address, e.g. :8080, for viewing in a browser or OBS")
+	mjpegQuality := fs.Int("mjpeg-quality", 75, "The JPEG quality of the -mjpeg stream, from 1 to 100")
+	history := fs.Int("history", 8, "The number of previous versions of the shader that are kept, to roll back to with the Z key")
+	var clips clipSettings
+	clips.flags(fs)
+	var compareFiles arrayFlags
+	fs.Var(&compareFiles, "compare", "A shader file to compare the shader with, switching between them with Tab and showing them side by side with V")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	sf.inputFiles = append(sf.inputFiles, fs.Args()...)
+	if err := sf.load(fs); err != nil {
+		return err
+	}
+	if *mjpegQuality < 1 || *mjpegQuality > 100 {
+		return fmt.Errorf("-mjpeg-quality must be between 1 and 100")
+	}
+	openGLVersion, err := sf.openGLVersion()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	engine, err := renderer.NewOnScreenEngineContext(ctx, openGLVersion)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+	logToStderr(engine)
+	// The size of the window is not known in advance.
+	fallback := statusFallback("", 1280, 720, *sf.glslVersion)
+	engine.SetFallback(fallback)
+	engine.SetVSync(*vsync)
+	engine.SetHistory(*history)
+	reporter, err := configureErrorOverlay(engine, 1280, fallback)
+	if err != nil {
+		return err
+	}
+	engine.SetControls(previewControls(engine, sf.newEnvironment, fallback, reporter, clips))
+
+	if *mjpegAddr != "" {
+		server := newMJPEGServer(*mjpegQuality)
+		engine.SetFrameStream(server.frames)
+		go server.run(ctx)
+		if err := serveHTTP(ctx, *mjpegAddr, server); err != nil {
+			return err
+		}
+		log.Printf("Serving the preview at http://%s/", *mjpegAddr)
+	}
+
+	go watchEnvironment(ctx, reporter, sf.newEnvironment)
+	if len(compareFiles) > 0 {
+		// The shader to compare with is loaded with the same settings.
+		csf := *sf
+		csf.inputFiles = compareFiles
+		engine.SetCompareMode(renderer.CompareSplit)
+		go watchEnvironment(ctx, compareEngine{engine}, csf.newEnvironment)
+	}
+	if err := engine.Animate(ctx); errors.Is(err, renderer.ErrWindowClosed) || errors.Is(err, context.Canceled) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// compareEngine sets the environments of watchEnvironment as the one to
+// compare with.
+type compareEngine struct {
+	engine *renderer.OnScreenEngine
+}
+
+func (c compareEngine) SetEnvironment(env renderer.Environment) {
+	c.engine.SetCompareEnvironment(env)
+}
@@ -0,0 +1,139 @@
+package egl
+
+// #cgo pkg-config: egl
+// #include <EGL/egl.h>
+// #include <EGL/eglext.h>
+//
+// static EGLBoolean exportQuery(EGLDisplay dpy, EGLImageKHR image, int *fourcc, int *numPlanes, EGLuint64KHR *modifiers) {
+// 	PFNEGLEXPORTDMABUFIMAGEQUERYMESAPROC query =
+// 		(PFNEGLEXPORTDMABUFIMAGEQUERYMESAPROC)eglGetProcAddress("eglExportDMABUFImageQueryMESA");
+// 	if (!query) {
+// 		return EGL_FALSE;
+// 	}
+// 	return query(dpy, image, fourcc, numPlanes, modifiers);
+// }
+//
+// static EGLBoolean exportImage(EGLDisplay dpy, EGLImageKHR image, int *fds, EGLint *strides, EGLint *offsets) {
+// 	PFNEGLEXPORTDMABUFIMAGEMESAPROC export =
+// 		(PFNEGLEXPORTDMABUFIMAGEMESAPROC)eglGetProcAddress("eglExportDMABUFImageMESA");
+// 	if (!export) {
+// 		return EGL_FALSE;
+// 	}
+// 	return export(dpy, image, fds, strides, offsets);
+// }
+//
+// static EGLint queryModifiers(EGLDisplay dpy, EGLint format, EGLint max, EGLuint64KHR *modifiers) {
+// 	PFNEGLQUERYDMABUFMODIFIERSEXTPROC query =
+// 		(PFNEGLQUERYDMABUFMODIFIERSEXTPROC)eglGetProcAddress("eglQueryDmaBufModifiersEXT");
+// 	EGLint num;
+// 	if (!query || !query(dpy, format, max, modifiers, NULL, &num)) {
+// 		return -1;
+// 	}
+// 	return num;
+// }
+import "C"
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	// ModifierLinear is the DRM format modifier of buffers that are laid
+	// out row by row, which every consumer can read.
+	ModifierLinear uint64 = 0
+	// ModifierInvalid is the DRM format modifier of buffers of which the
+	// layout is implied by the driver. It can only be imported by the same
+	// driver.
+	ModifierInvalid uint64 = 0x00ffffffffffffff
+)
+
+// A DMABuf is an image that is exported as Linux dma-buf file descriptors,
+// which can be imported by other processes and APIs, e.g. Wayland
+// compositors and V4L2 encoders, without copying the pixels.
+type DMABuf struct {
+	// FourCC is the DRM format of the pixels, e.g. AB24 for 8-bit RGBA.
+	FourCC uint32
+	// Modifier is the DRM format modifier, which describes the layout of the
+	// pixels in memory, such as tiling and compression.
+	Modifier uint64
+	Planes   []DMABufPlane
+}
+
+// A DMABufPlane is a plane of a DMABuf. Planes may share a file descriptor.
+type DMABufPlane struct {
+	FD     int
+	Stride uint32
+	Offset uint32
+}
+
+// Close closes the file descriptors of the buffer. The memory is released
+// once every process that imported it has released it too.
+func (buf *DMABuf) Close() error {
+	var err error
+	closed := map[int]bool{}
+	for _, p := range buf.Planes {
+		if closed[p.FD] {
+			continue
+		}
+		closed[p.FD] = true
+		if e := syscall.Close(p.FD); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ExportDMABuf exports the image as a dma-buf. It requires the
+// EGL_MESA_image_dma_buf_export extension.
+func (img *Image) ExportDMABuf() (*DMABuf, error) {
+	if !hasExtension(img.display.Extensions(), "EGL_MESA_image_dma_buf_export") {
+		return nil, fmt.Errorf("exporting dma-bufs requires EGL_MESA_image_dma_buf_export, which is not supported")
+	}
+	var fourcc, numPlanes C.int
+	var modifiers [4]C.EGLuint64KHR
+	if C.exportQuery(img.display.dpy, img.img, &fourcc, &numPlanes, &modifiers[0]) == C.EGL_FALSE {
+		return nil, fmt.Errorf("error querying dma-buf: %w", getError())
+	}
+	if numPlanes < 1 || int(numPlanes) > len(modifiers) {
+		return nil, fmt.Errorf("unsupported number of dma-buf planes: %d", numPlanes)
+	}
+	var fds [4]C.int
+	var strides, offsets [4]C.EGLint
+	if C.exportImage(img.display.dpy, img.img, &fds[0], &strides[0], &offsets[0]) == C.EGL_FALSE {
+		return nil, fmt.Errorf("error exporting dma-buf: %w", getError())
+	}
+	buf := &DMABuf{FourCC: uint32(fourcc), Modifier: uint64(modifiers[0])}
+	for i := 0; i < int(numPlanes); i++ {
+		buf.Planes = append(buf.Planes, DMABufPlane{
+			FD:     int(fds[i]),
+			Stride: uint32(strides[i]),
+			Offset: uint32(offsets[i]),
+		})
+	}
+	return buf, nil
+}
+
+// DMABufModifiers returns the modifiers with which the display can import
+// dma-bufs of the DRM format. It requires the
+// EGL_EXT_image_dma_buf_import_modifiers extension.
+func (d Display) DMABufModifiers(fourcc uint32) ([]uint64, error) {
+	if !hasExtension(d.Extensions(), "EGL_EXT_image_dma_buf_import_modifiers") {
+		return nil, fmt.Errorf("querying modifiers requires EGL_EXT_image_dma_buf_import_modifiers, which is not supported")
+	}
+	num := C.queryModifiers(d.dpy, C.EGLint(fourcc), 0, nil)
+	if num < 0 {
+		return nil, fmt.Errorf("error querying modifiers: %w", getError())
+	}
+	if num == 0 {
+		return nil, nil
+	}
+	modifiers := make([]C.EGLuint64KHR, num)
+	if num = C.queryModifiers(d.dpy, C.EGLint(fourcc), num, &modifiers[0]); num < 0 {
+		return nil, fmt.Errorf("error querying modifiers: %w", getError())
+	}
+	out := make([]uint64, num)
+	for i := range out {
+		out[i] = uint64(modifiers[i])
+	}
+	return out, nil
+}
@@ -131,6 +131,10 @@ func (cx Context) MakeCurrent() {
 	C.eglMakeCurrent(cx.Display.dpy, cx.Surface.surf, cx.Surface.surf, cx.context)
 }
 
+func (cx Context) Destroy() {
+	C.eglDestroyContext(cx.Display.dpy, cx.context)
+}
+
 func getError() error {
 	switch code := C.eglGetError(); code {
 	case C.EGL_NOT_INITIALIZED:
@@ -0,0 +1,60 @@
+package egl
+
+// #cgo pkg-config: egl
+// #include <stdint.h>
+// #include <EGL/egl.h>
+// #include <EGL/eglext.h>
+//
+// static EGLImageKHR createTextureImage(EGLDisplay dpy, EGLContext ctx, unsigned int texture) {
+// 	PFNEGLCREATEIMAGEKHRPROC createImage =
+// 		(PFNEGLCREATEIMAGEKHRPROC)eglGetProcAddress("eglCreateImageKHR");
+// 	if (!createImage) {
+// 		return EGL_NO_IMAGE_KHR;
+// 	}
+// 	return createImage(dpy, ctx, EGL_GL_TEXTURE_2D_KHR, (EGLClientBuffer)(uintptr_t)texture, NULL);
+// }
+//
+// static void destroyImage(EGLDisplay dpy, EGLImageKHR image) {
+// 	PFNEGLDESTROYIMAGEKHRPROC destroyImage =
+// 		(PFNEGLDESTROYIMAGEKHRPROC)eglGetProcAddress("eglDestroyImageKHR");
+// 	if (destroyImage) {
+// 		destroyImage(dpy, image);
+// 	}
+// }
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// An Image is an EGLImage, which shares the pixels of a texture with other
+// contexts and APIs on the same display without copying them.
+type Image struct {
+	display Display
+	img     C.EGLImageKHR
+}
+
+// CreateTextureImage creates an image from level 0 of a 2D texture of the
+// context. It requires the EGL_KHR_gl_texture_2D_image extension.
+func (cx Context) CreateTextureImage(texture uint32) (*Image, error) {
+	if !hasExtension(cx.Display.Extensions(), "EGL_KHR_gl_texture_2D_image") {
+		return nil, fmt.Errorf("creating images from textures requires EGL_KHR_gl_texture_2D_image, which is not supported")
+	}
+	img := C.createTextureImage(cx.Display.dpy, cx.context, C.uint(texture))
+	if img == nil {
+		return nil, fmt.Errorf("error creating image: %w", getError())
+	}
+	return &Image{display: cx.Display, img: img}, nil
+}
+
+// Pointer returns the EGLImageKHR handle, e.g. to pass to
+// glEGLImageTargetTexture2DOES in another context.
+func (img *Image) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(img.img)
+}
+
+// Destroy releases the image. Textures created from it in other contexts
+// remain valid.
+func (img *Image) Destroy() {
+	C.destroyImage(img.display.dpy, img.img)
+}
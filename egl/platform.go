@@ -0,0 +1,135 @@
+package egl
+
+// #cgo pkg-config: egl
+// #include <EGL/egl.h>
+// #include <EGL/eglext.h>
+//
+// static EGLDisplay getPlatformDisplay(EGLenum platform, void *nativeDisplay) {
+// 	PFNEGLGETPLATFORMDISPLAYEXTPROC getPlatformDisplay =
+// 		(PFNEGLGETPLATFORMDISPLAYEXTPROC)eglGetProcAddress("eglGetPlatformDisplayEXT");
+// 	if (!getPlatformDisplay) {
+// 		return EGL_NO_DISPLAY;
+// 	}
+// 	return getPlatformDisplay(platform, nativeDisplay, NULL);
+// }
+//
+// static EGLint queryDevices(EGLDeviceEXT *devices, EGLint max) {
+// 	PFNEGLQUERYDEVICESEXTPROC queryDevices =
+// 		(PFNEGLQUERYDEVICESEXTPROC)eglGetProcAddress("eglQueryDevicesEXT");
+// 	EGLint num;
+// 	if (!queryDevices || !queryDevices(max, devices, &num)) {
+// 		return -1;
+// 	}
+// 	return num;
+// }
+import "C"
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// A Platform is the window system or device an EGL display is obtained from.
+type Platform struct {
+	name      string
+	v         C.EGLenum
+	extension string
+}
+
+var (
+	// PlatformDefault is the platform chosen by the EGL implementation. With
+	// Mesa, this is usually X11 or Wayland, unless overridden with the
+	// EGL_PLATFORM environment variable.
+	PlatformDefault = Platform{name: "default"}
+	// PlatformDevice renders on a GPU without a window system, using the
+	// first device that can be initialized. It requires the
+	// EGL_EXT_platform_device extension, which is supported by the NVIDIA
+	// and Mesa drivers.
+	PlatformDevice = Platform{name: "device", v: C.EGL_PLATFORM_DEVICE_EXT, extension: "EGL_EXT_platform_device"}
+	// PlatformSurfaceless renders without a window system or a specific
+	// device using Mesa, e.g. with its software rasterizer in containers.
+	PlatformSurfaceless = Platform{name: "surfaceless", v: C.EGL_PLATFORM_SURFACELESS_MESA, extension: "EGL_MESA_platform_surfaceless"}
+)
+
+// noDisplay is EGL_NO_DISPLAY, which cgo can not translate.
+var noDisplay C.EGLDisplay
+
+var platforms = []Platform{PlatformDefault, PlatformDevice, PlatformSurfaceless}
+
+// ParsePlatform parses the name of a platform as returned by String.
+func ParsePlatform(s string) (Platform, error) {
+	names := make([]string, len(platforms))
+	for i, p := range platforms {
+		if p.name == s {
+			return p, nil
+		}
+		names[i] = p.name
+	}
+	return Platform{}, fmt.Errorf("unknown EGL platform %q (valid: %s)", s, strings.Join(names, ", "))
+}
+
+func (p Platform) String() string {
+	return p.name
+}
+
+// GetPlatformDisplay initializes a display of the platform.
+func GetPlatformDisplay(p Platform) (Display, error) {
+	if p.v == 0 {
+		return GetDisplay(DefaultDisplay)
+	}
+	exts := ClientExtensions()
+	for _, ext := range []string{"EGL_EXT_platform_base", p.extension} {
+		if !hasExtension(exts, ext) {
+			return Display{}, fmt.Errorf("the %s platform requires %s, which is not supported", p, ext)
+		}
+	}
+	if p != PlatformDevice {
+		return initialize(C.getPlatformDisplay(p.v, nil))
+	}
+
+	var devices [16]C.EGLDeviceEXT
+	num := C.queryDevices(&devices[0], C.EGLint(len(devices)))
+	if num < 0 {
+		return Display{}, fmt.Errorf("could not enumerate EGL devices: %w", getError())
+	}
+	if num == 0 {
+		return Display{}, fmt.Errorf("no EGL devices found")
+	}
+	var err error
+	for _, dev := range devices[:num] {
+		var d Display
+		if d, err = initialize(C.getPlatformDisplay(p.v, unsafe.Pointer(dev))); err == nil {
+			return d, nil
+		}
+	}
+	return Display{}, err
+}
+
+func initialize(dpy C.EGLDisplay) (Display, error) {
+	if dpy == noDisplay {
+		return Display{}, fmt.Errorf("error getting display: %w", getError())
+	}
+	if C.eglInitialize(dpy, nil, nil) == C.EGL_FALSE {
+		return Display{}, fmt.Errorf("error initializing display: %w", getError())
+	}
+	return Display{dpy: dpy}, nil
+}
+
+// ClientExtensions retrieves the extensions that are supported independent of
+// a display, such as the platforms.
+func ClientExtensions() []string {
+	str := C.eglQueryString(noDisplay, C.EGL_EXTENSIONS)
+	if str == nil {
+		return nil
+	}
+	return strings.Split(strings.Trim(C.GoString(str), " "), " ")
+}
+
+func hasExtension(exts []string, ext string) bool {
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
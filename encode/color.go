@@ -0,0 +1,64 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// A ColorTag describes how the colors of images are encoded with the code
+// points of ITU-T H.273, which are shared by video and image formats.
+type ColorTag struct {
+	Primaries uint8
+	Transfer  uint8
+	// Matrix are the coefficients with which RGB is converted to YCbCr.
+	Matrix uint8
+}
+
+var (
+	ColorSRGB  = ColorTag{Primaries: 1, Transfer: 13, Matrix: 1}
+	ColorBT709 = ColorTag{Primaries: 1, Transfer: 1, Matrix: 1}
+	ColorHLG   = ColorTag{Primaries: 9, Transfer: 18, Matrix: 9}
+	ColorPQ    = ColorTag{Primaries: 9, Transfer: 16, Matrix: 9}
+)
+
+// lumaCoefficients returns the weights of red and blue in luma for the
+// matrix of the tag. BT.601 is used if the tag is nil.
+func (c *ColorTag) lumaCoefficients() (kr, kb float64) {
+	if c != nil {
+		switch c.Matrix {
+		case 1:
+			return 0.2126, 0.0722
+		case 9:
+			return 0.2627, 0.0593
+		}
+	}
+	return 0.299, 0.114
+}
+
+// tagPNG inserts a cICP chunk declaring the colors into an encoded PNG file.
+func tagPNG(png []byte, c ColorTag) ([]byte, error) {
+	// The matrix is 0 as PNG stores RGB, and the range is always full.
+	return insertPNGChunk(png, "cICP", []byte{c.Primaries, c.Transfer, 0, 1})
+}
+
+// insertPNGChunk inserts a chunk into an encoded PNG file. The chunk is put
+// right after the header, which has a fixed size, as chunks describing the
+// colors must precede the image data.
+func insertPNGChunk(png []byte, typ string, data []byte) ([]byte, error) {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	if len(png) < ihdrEnd || string(png[12:16]) != "IHDR" {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+	var chunk bytes.Buffer
+	binary.Write(&chunk, binary.BigEndian, uint32(len(data)))
+	chunk.WriteString(typ)
+	chunk.Write(data)
+	binary.Write(&chunk, binary.BigEndian, crc32.ChecksumIEEE(chunk.Bytes()[4:]))
+
+	out := make([]byte, 0, len(png)+chunk.Len())
+	out = append(out, png[:ihdrEnd]...)
+	out = append(out, chunk.Bytes()...)
+	return append(out, png[ihdrEnd:]...), nil
+}
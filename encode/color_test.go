@@ -0,0 +1,46 @@
+package encode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestPNGColorTag(t *testing.T) {
+	img := image.NewRGBA64(image.Rect(0, 0, 2, 2))
+	var buf bytes.Buffer
+	if err := (PNGFormat{Color: &ColorPQ}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(buf.Bytes(), []byte("cICP"))
+	if i < 0 {
+		t.Fatalf("expected a cICP chunk")
+	}
+	if data := buf.Bytes()[i+4 : i+8]; !bytes.Equal(data, []byte{9, 16, 0, 1}) {
+		t.Fatalf("unexpected cICP data: %v", data)
+	}
+	if i > bytes.Index(buf.Bytes(), []byte("IDAT")) {
+		t.Fatalf("the cICP chunk must precede the image data")
+	}
+	// Decoding verifies the checksum of the chunk.
+	if _, err := png.Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRGBToYCbCr(t *testing.T) {
+	for _, c := range [][3]uint8{{0, 0, 0}, {255, 255, 255}, {255, 0, 0}, {12, 200, 64}} {
+		y, cb, cr := rgbToYCbCr(c[0], c[1], c[2], 0.299, 0.114)
+		ey, ecb, ecr := color.RGBToYCbCr(c[0], c[1], c[2])
+		diff := func(a, b uint8) bool { return int(a)+1 < int(b) || int(b)+1 < int(a) }
+		if diff(y, ey) || diff(cb, ecb) || diff(cr, ecr) {
+			t.Errorf("%v: expected %d %d %d, got %d %d %d", c, ey, ecb, ecr, y, cb, cr)
+		}
+	}
+	kr, kb := ColorHLG.lumaCoefficients()
+	if y, cb, cr := rgbToYCbCr(255, 255, 255, kr, kb); y != 255 || cb != 128 || cr != 128 {
+		t.Errorf("expected white to be neutral, got %d %d %d", y, cb, cr)
+	}
+}
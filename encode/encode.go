@@ -4,23 +4,54 @@ import (
 	"bytes"
 	"fmt"
 	"image"
-	"image/color/palette"
 	"image/draw"
-	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"math"
 	"time"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
-type PNGFormat struct{}
+type PNGFormat struct {
+	// Color is declared in a cICP chunk if set, e.g. for HDR images.
+	Color *ColorTag
+	// ICC is an ICC profile that is embedded if set, see SRGBProfile.
+	ICC []byte
+}
 
 func (f PNGFormat) Extensions() []string {
 	return []string{"png"}
 }
 
+func (f PNGFormat) MediaType() string {
+	return "image/png"
+}
+
 func (f PNGFormat) Encode(w io.Writer, img image.Image) error {
-	return png.Encode(w, img)
+	if f.Color == nil && f.ICC == nil {
+		return png.Encode(w, img)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	tagged := buf.Bytes()
+	var err error
+	if f.ICC != nil {
+		if tagged, err = embedICCPNG(tagged, f.ICC); err != nil {
+			return err
+		}
+	}
+	if f.Color != nil {
+		if tagged, err = tagPNG(tagged, *f.Color); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(tagged)
+	return err
 }
 
 func (f PNGFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
@@ -32,14 +63,48 @@ func (f PNGFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, inter
 	return nil
 }
 
-type JPGFormat struct{}
+type JPGFormat struct {
+	// Quality ranges from 1 to 100, higher is better. If 0, the default of
+	// 75 is used.
+	Quality int
+	// Grayscale drops the chroma channels altogether, which are otherwise
+	// subsampled 4:2:0.
+	Grayscale bool
+	// ICC is an ICC profile that is embedded if set, see SRGBProfile.
+	ICC []byte
+}
 
 func (f JPGFormat) Extensions() []string {
 	return []string{"jpg", "jpeg"}
 }
 
+func (f JPGFormat) MediaType() string {
+	return "image/jpeg"
+}
+
 func (f JPGFormat) Encode(w io.Writer, img image.Image) error {
-	return jpeg.Encode(w, img, nil)
+	var opts *jpeg.Options
+	if f.Quality != 0 {
+		opts = &jpeg.Options{Quality: f.Quality}
+	}
+	if f.Grayscale {
+		gray := image.NewGray(img.Bounds())
+		draw.Draw(gray, gray.Rect, img, img.Bounds().Min, draw.Src)
+		img = gray
+	}
+	if f.ICC == nil {
+		return jpeg.Encode(w, img, opts)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, opts); err != nil {
+		return err
+	}
+	tagged, err := embedICCJPEG(buf.Bytes(), f.ICC)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(tagged)
+	return err
 }
 
 func (f JPGFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
@@ -51,6 +116,101 @@ func (f JPGFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, inter
 	return nil
 }
 
+// TIFFFormat writes images as deflate compressed TIFF files, as required by
+// e.g. print workflows.
+type TIFFFormat struct {
+	// Bits is the number of bits per channel, 8 or 16. 16-bit files keep the
+	// precision of HDR images, which are clamped to [0, 1].
+	Bits int
+	// ICC is an ICC profile that is embedded if set, see SRGBProfile.
+	ICC []byte
+}
+
+func (f TIFFFormat) Extensions() []string {
+	return []string{"tif", "tiff"}
+}
+
+func (f TIFFFormat) MediaType() string {
+	return "image/tiff"
+}
+
+func (f TIFFFormat) Encode(w io.Writer, img image.Image) error {
+	if f.Bits == 16 {
+		img = toNRGBA64(img)
+	}
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if f.ICC != nil {
+		var err error
+		if data, err = embedICCTIFF(data, f.ICC); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (f TIFFFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toNRGBA64 converts an image to 16 bits per channel. The unclamped colors of
+// FloatImages with 4 channels are used rather than their 8-bit colors.
+func toNRGBA64(img image.Image) *image.NRGBA64 {
+	b := img.Bounds()
+	out := image.NewNRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	fimg, ok := img.(FloatImage)
+	if !ok {
+		draw.Draw(out, out.Rect, img, b.Min, draw.Src)
+		return out
+	}
+	values, channels := fimg.FloatData()
+	if channels != 4 {
+		draw.Draw(out, out.Rect, img, b.Min, draw.Src)
+		return out
+	}
+	for i, v := range values {
+		c := uint16(math.Round(math.Max(0, math.Min(1, float64(v))) * 0xffff))
+		out.Pix[i*2] = uint8(c >> 8)
+		out.Pix[i*2+1] = uint8(c)
+	}
+	return out
+}
+
+// BMPFormat writes images as uncompressed BMP files, which embedded firmware
+// can read without a decoder. Opaque images are written with 24 bits per
+// pixel, others with 32.
+type BMPFormat struct{}
+
+func (f BMPFormat) Extensions() []string {
+	return []string{"bmp"}
+}
+
+func (f BMPFormat) MediaType() string {
+	return "image/bmp"
+}
+
+func (f BMPFormat) Encode(w io.Writer, img image.Image) error {
+	return bmp.Encode(w, img)
+}
+
+func (f BMPFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type RGB24Format struct{}
 
 func (f RGB24Format) Extensions() []string {
@@ -118,38 +278,6 @@ func (f RGBA32Format) EncodeAnimation(w io.Writer, stream <-chan image.Image, in
 	return nil
 }
 
-type GIFFormat struct{}
-
-func (f GIFFormat) Extensions() []string {
-	return []string{"gif"}
-}
-
-func (f GIFFormat) Encode(w io.Writer, img image.Image) error {
-	// Forward to the code stream encoder for easy code reuse.
-	stream := make(chan image.Image, 1)
-	stream <- img
-	close(stream)
-	return f.EncodeAnimation(w, stream, 0)
-}
-
-func (f GIFFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
-	gifImg := &gif.GIF{
-		Image:           []*image.Paletted{},
-		Delay:           []int{},
-		LoopCount:       0,
-		Disposal:        []byte{},
-		BackgroundIndex: 0,
-	}
-	for img := range stream {
-		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
-		draw.Draw(frame, img.Bounds(), img, image.Point{X: 0, Y: 0}, draw.Over)
-		gifImg.Image = append(gifImg.Image, frame)
-		gifImg.Delay = append(gifImg.Delay, int(interval/(time.Second/100)))
-		gifImg.Disposal = append(gifImg.Disposal, gif.DisposalBackground)
-	}
-	return gif.EncodeAll(w, gifImg)
-}
-
 type AnsiDisplay struct {
 	initDone bool
 }
@@ -0,0 +1,221 @@
+package encode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"time"
+)
+
+// EXRFormat writes images as OpenEXR files, which keep the values of HDR
+// images beyond 1.0.
+//
+// FloatImages, such as those rendered with -hdr, are written as is. Other
+// images are converted to floats in [0, 1]. No transfer function is applied,
+// so the values are those written by the shader. Animations are written as
+// concatenated files.
+type EXRFormat struct {
+	// Half stores the values as 16-bit floats rather than 32-bit floats,
+	// which is sufficient for colors and halves the size of the files.
+	Half bool
+}
+
+func (f EXRFormat) Extensions() []string {
+	return []string{"exr"}
+}
+
+func (f EXRFormat) MediaType() string {
+	return "image/x-exr"
+}
+
+// exrLinesPerBlock is the number of scanlines that are compressed together
+// with ZIP compression.
+const exrLinesPerBlock = 16
+
+func (f EXRFormat) Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	values, channels := floatPixels(img)
+	names := []string{"R", "G", "B", "A"}[:channels]
+	if channels == 1 {
+		names = []string{"Y"}
+	}
+	pixelType, size := uint32(2), 4
+	if f.Half {
+		pixelType, size = 1, 2
+	}
+
+	var header bytes.Buffer
+	header.Write([]byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0})
+	// Channels are stored in alphabetical order.
+	order := exrChannelOrder(names)
+	var chlist bytes.Buffer
+	for _, c := range order {
+		chlist.WriteString(names[c] + "\x00")
+		binary.Write(&chlist, binary.LittleEndian, []uint32{pixelType, 0, 1, 1})
+	}
+	chlist.WriteByte(0)
+	window := []int32{0, 0, int32(b.Dx() - 1), int32(b.Dy() - 1)}
+	exrAttribute(&header, "channels", "chlist", chlist.Bytes())
+	exrAttribute(&header, "compression", "compression", []byte{3}) // ZIP
+	exrAttribute(&header, "dataWindow", "box2i", window)
+	exrAttribute(&header, "displayWindow", "box2i", window)
+	exrAttribute(&header, "lineOrder", "lineOrder", []byte{0}) // Increasing Y
+	exrAttribute(&header, "pixelAspectRatio", "float", float32(1))
+	exrAttribute(&header, "screenWindowCenter", "v2f", []float32{0, 0})
+	exrAttribute(&header, "screenWindowWidth", "float", float32(1))
+	header.WriteByte(0)
+
+	// The header is followed by a table with the offset of each block.
+	numBlocks := (b.Dy() + exrLinesPerBlock - 1) / exrLinesPerBlock
+	offset := uint64(header.Len() + numBlocks*8)
+	var blocks bytes.Buffer
+	raw := make([]byte, 0, exrLinesPerBlock*b.Dx()*channels*size)
+	for y := 0; y < b.Dy(); y += exrLinesPerBlock {
+		raw = raw[:0]
+		for line := y; line < y+exrLinesPerBlock && line < b.Dy(); line++ {
+			for _, c := range order {
+				for x := 0; x < b.Dx(); x++ {
+					v := values[(line*b.Dx()+x)*channels+c]
+					if f.Half {
+						raw = append(raw, 0, 0)
+						binary.LittleEndian.PutUint16(raw[len(raw)-2:], halfBits(v))
+					} else {
+						raw = append(raw, 0, 0, 0, 0)
+						binary.LittleEndian.PutUint32(raw[len(raw)-4:], math.Float32bits(v))
+					}
+				}
+			}
+		}
+		data, err := exrCompress(raw)
+		if err != nil {
+			return err
+		}
+		binary.Write(&header, binary.LittleEndian, offset+uint64(blocks.Len()))
+		binary.Write(&blocks, binary.LittleEndian, []int32{int32(y), int32(len(data))})
+		blocks.Write(data)
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(blocks.Bytes())
+	return err
+}
+
+func (f EXRFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exrAttribute(w *bytes.Buffer, name, typ string, value interface{}) {
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, value)
+	w.WriteString(name + "\x00" + typ + "\x00")
+	binary.Write(w, binary.LittleEndian, int32(data.Len()))
+	w.Write(data.Bytes())
+}
+
+// exrChannelOrder returns the indices of the named channels in alphabetical
+// order of their names.
+func exrChannelOrder(names []string) []int {
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	for i := 1; i < len(order); i++ {
+		for j := i; j > 0 && names[order[j]] < names[order[j-1]]; j-- {
+			order[j], order[j-1] = order[j-1], order[j]
+		}
+	}
+	return order
+}
+
+// exrCompress compresses a block of scanlines with the ZIP compression of
+// OpenEXR. The data is stored as is if it does not get any smaller.
+func exrCompress(raw []byte) ([]byte, error) {
+	// The bytes at even and odd positions are separated, after which each
+	// byte is replaced by its difference to the previous one.
+	t := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for i, v := range raw {
+		t[i/2+i%2*half] = v
+	}
+	prev := t[0]
+	for i := 1; i < len(t); i++ {
+		v := t[i]
+		t[i] = v - prev + 128
+		prev = v
+	}
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(t); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(raw) {
+		return raw, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// halfBits converts a float to the bits of the nearest IEEE 754 half
+// precision float. Values that are out of range become infinity.
+func halfBits(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	switch {
+	case b&0x7fffffff > 0x7f800000:
+		return sign | 0x7e00
+	case exp >= 0x1f:
+		return sign | 0x7c00
+	case exp <= 0:
+		// Subnormal.
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		h := mant >> shift
+		rem, halfway := mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > halfway || rem == halfway && h&1 == 1 {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	// Rounding may carry into the exponent, which yields the correct result.
+	h := uint32(exp)<<10 | mant>>13
+	if rem := mant & 0x1fff; rem > 0x1000 || rem == 0x1000 && h&1 == 1 {
+		h++
+	}
+	return sign | uint16(h)
+}
+
+// floatPixels returns the values of the pixels of an image as floats in
+// row-major order and the number of values per pixel. Images that are not
+// FloatImages are converted to RGBA in [0, 1].
+func floatPixels(img image.Image) ([]float32, int) {
+	if fimg, ok := img.(FloatImage); ok {
+		return fimg.FloatData()
+	}
+	b := img.Bounds()
+	values := make([]float32, 0, b.Dx()*b.Dy()*4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			values = append(values,
+				float32(c.R)/0xffff, float32(c.G)/0xffff, float32(c.B)/0xffff, float32(c.A)/0xffff)
+		}
+	}
+	return values, 4
+}
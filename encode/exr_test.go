@@ -0,0 +1,130 @@
+package encode
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"image"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestHalfBits(t *testing.T) {
+	tests := []struct {
+		in  float32
+		out uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{1e6, 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		{float32(math.Pow(2, -24)), 0x0001},
+		{float32(math.Pow(2, -14)), 0x0400},
+		// 1 + 2^-11 is halfway between 1 and the next half, rounding to even.
+		{1 + float32(math.Pow(2, -11)), 0x3c00},
+		{1 + 3*float32(math.Pow(2, -11)), 0x3c02},
+	}
+	for _, tt := range tests {
+		if h := halfBits(tt.in); h != tt.out {
+			t.Errorf("%v: expected %#04x, got %#04x", tt.in, tt.out, h)
+		}
+	}
+	if h := halfBits(float32(math.NaN())); h&0x7c00 != 0x7c00 || h&0x3ff == 0 {
+		t.Errorf("NaN: got %#04x", h)
+	}
+}
+
+func TestEXRCompress(t *testing.T) {
+	raw := make([]byte, 1024)
+	for i := range raw {
+		raw[i] = byte(i / 7)
+	}
+	data, err := exrCompress(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(raw) {
+		t.Fatalf("data was not compressed")
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = tmp[i-1] + tmp[i] - 128
+	}
+	half := (len(tmp) + 1) / 2
+	for i := range raw {
+		if v := tmp[i/2+i%2*half]; v != raw[i] {
+			t.Fatalf("byte %d: expected %d, got %d", i, raw[i], v)
+		}
+	}
+}
+
+func TestEXRHeader(t *testing.T) {
+	var buf bytes.Buffer
+	img := testFloatImage{Gray: image.NewGray(image.Rect(0, 0, 2, 1)), data: []float32{0.5, 2}, channels: 1}
+	if err := (EXRFormat{Half: true}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if !bytes.HasPrefix(b, []byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0}) {
+		t.Fatalf("unexpected magic: %x", b[:8])
+	}
+	if !bytes.Contains(b, []byte("channels\x00chlist\x00")) || !bytes.Contains(b, []byte("Y\x00\x01\x00\x00\x00")) {
+		t.Fatalf("the half Y channel is missing")
+	}
+	// The data is too small to compress, so the block is stored as is
+	// after its line number and size.
+	if !bytes.HasSuffix(b, []byte{0, 0, 0, 0, 4, 0, 0, 0, 0x00, 0x38, 0x00, 0x40}) {
+		t.Fatalf("unexpected block: %x", b[len(b)-12:])
+	}
+}
+
+func TestRadianceRLE(t *testing.T) {
+	data := []byte{1, 2, 3, 3, 3, 3, 3, 3, 4, 4, 5, 5, 5, 5, 5}
+	for i := 0; i < 300; i++ {
+		data = append(data, 9)
+	}
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeRLE(w, data)
+	w.Flush()
+
+	var decoded []byte
+	enc := buf.Bytes()
+	for i := 0; i < len(enc); {
+		n := int(enc[i])
+		if n > 128 {
+			for j := 0; j < n-128; j++ {
+				decoded = append(decoded, enc[i+1])
+			}
+			i += 2
+		} else {
+			decoded = append(decoded, enc[i+1:i+1+n]...)
+			i += 1 + n
+		}
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Fatalf("expected %v, got %v", data, decoded)
+	}
+	if len(enc) >= len(data)/4 {
+		t.Fatalf("runs were not encoded: %d bytes", len(enc))
+	}
+}
+
+func TestRGBE(t *testing.T) {
+	c := rgbe([3]float32{4, 1, -1})
+	// 4 is 0.5 * 2^3, so the mantissa of red is 128 with an exponent of 3.
+	if exp := []byte{128, 32, 0, 128 + 3}; !bytes.Equal(c, exp) {
+		t.Fatalf("expected %v, got %v", exp, c)
+	}
+}
@@ -3,34 +3,100 @@ package encode
 import (
 	"image"
 	"io"
+	"mime"
 	"path"
+	"sort"
+	"strings"
 	"time"
 )
 
+// Formats maps the names of the registered formats to their encoders. The
+// values may be replaced to change the settings of a format.
 var Formats = map[string]Format{
 	"ansi":   &AnsiDisplay{},
+	"bmp":    BMPFormat{},
+	"exr":    EXRFormat{},
 	"gif":    GIFFormat{},
+	"hdr":    RadianceFormat{},
 	"jpg":    JPGFormat{},
+	"mp4":    MP4Format{},
+	"npy":    NPYFormat{},
 	"png":    PNGFormat{},
 	"rgb24":  RGB24Format{},
 	"rgba32": RGBA32Format{},
+	"tiff":   TIFFFormat{},
+	"y4m":    Y4MFormat{},
 }
 
+// RegisterFormat makes a format available with the specified name, so it can
+// be selected with -ofmt and detected from the extensions and MIME type of
+// output files.
+func RegisterFormat(name string, format Format) {
+	if _, ok := Formats[name]; ok {
+		panic(name + " is already registered as format")
+	}
+	if _, ok := sinks[name]; ok {
+		panic(name + " is already registered as sink")
+	}
+	Formats[name] = format
+}
+
+// FormatNames returns the names of the registered formats.
+func FormatNames() []string {
+	names := make([]string, 0, len(Formats))
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupFormat returns the format with the specified name or MIME type.
+func LookupFormat(nameOrType string) (Format, bool) {
+	if f, ok := Formats[nameOrType]; ok {
+		return f, true
+	}
+	mediaType, _, err := mime.ParseMediaType(nameOrType)
+	if err != nil {
+		return nil, false
+	}
+	for _, name := range FormatNames() {
+		if mt, ok := Formats[name].(MediaTyper); ok && mt.MediaType() == mediaType {
+			return Formats[name], true
+		}
+	}
+	return nil, false
+}
+
+// DetectFormat returns the format of a file from its extension, which is
+// matched regardless of case. A format that is named after the extension is
+// preferred over others that use it.
 func DetectFormat(filename string) (Format, bool) {
-	ext := path.Ext(filename)
-	if len(ext) == 0 {
+	ext := strings.ToLower(path.Ext(filename))
+	if len(ext) <= 1 {
 		return nil, false
 	}
-	for _, f := range Formats {
-		for _, e := range f.Extensions() {
-			if e == ext[1:] {
-				return f, true
-			}
+	ext = ext[1:]
+	if f, ok := Formats[ext]; ok && hasExtension(f, ext) {
+		return f, true
+	}
+	for _, name := range FormatNames() {
+		if hasExtension(Formats[name], ext) {
+			return Formats[name], true
 		}
 	}
 	return nil, false
 }
 
+func hasExtension(f Format, ext string) bool {
+	for _, e := range f.Extensions() {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
 type Format interface {
 	// Extensions returns all file extensions excluding '.' that this format is
 	// commonly encoded into.
@@ -46,3 +112,11 @@ type Format interface {
 	// The interval parameter is the time between two images.
 	EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error
 }
+
+// A MediaTyper is a Format with a MIME type, which allows it to be looked up
+// by that type and to be served over HTTP.
+type MediaTyper interface {
+	// MediaType returns the MIME type of the encoded data without
+	// parameters, e.g. "image/png".
+	MediaType() string
+}
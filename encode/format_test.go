@@ -0,0 +1,60 @@
+package encode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		format   Format
+	}{
+		{"out.png", Formats["png"]},
+		{"OUT.JPEG", Formats["jpg"]},
+		{"dir.tif/out.tif", Formats["tiff"]},
+		{"out.hdr", Formats["hdr"]},
+		{"out.raw", nil},
+		{"out.", nil},
+		{"out", nil},
+	}
+	for _, tt := range tests {
+		f, ok := DetectFormat(tt.filename)
+		if ok != (tt.format != nil) || reflect.TypeOf(f) != reflect.TypeOf(tt.format) {
+			t.Errorf("%s: expected %T, got %T", tt.filename, tt.format, f)
+		}
+	}
+}
+
+func TestLookupFormat(t *testing.T) {
+	tests := []struct {
+		in     string
+		format Format
+	}{
+		{"gif", Formats["gif"]},
+		{"image/jpeg", Formats["jpg"]},
+		{"image/x-exr; version=2", Formats["exr"]},
+		{"image/webp", nil},
+		{"webp", nil},
+	}
+	for _, tt := range tests {
+		f, ok := LookupFormat(tt.in)
+		if ok != (tt.format != nil) || reflect.TypeOf(f) != reflect.TypeOf(tt.format) {
+			t.Errorf("%s: expected %T, got %T", tt.in, tt.format, f)
+		}
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("test", NPYFormat{})
+	defer delete(Formats, "test")
+	if _, ok := LookupFormat("test"); !ok {
+		t.Fatalf("the format was not registered")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("registering a name twice did not panic")
+		}
+	}()
+	RegisterFormat("png", PNGFormat{})
+}
@@ -0,0 +1,94 @@
+package encode
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"time"
+)
+
+// A FrameRateSink is a Sink that consumes frames at a fixed rate, e.g. a
+// device with its own refresh rate. Frames are dropped or repeated to convert
+// the rate at which they are rendered to the rate of the sink.
+type FrameRateSink interface {
+	Sink
+	// FrameInterval returns the time between two frames of the sink, or 0 to
+	// receive every rendered frame.
+	FrameInterval() time.Duration
+}
+
+// ConvertFrameRate converts a stream of frames rendered every from to a stream
+// of frames every to. Each output frame is the rendered frame at its time, so
+// frames are dropped if to is longer than from and repeated otherwise. If
+// blend is set, output frames that fall between two rendered frames are mixed
+// from both according to their distance in time, which smooths motion at the
+// cost of ghosting.
+//
+// The stream is returned as is if the intervals are the same.
+func ConvertFrameRate(in <-chan image.Image, from, to time.Duration, blend bool) <-chan image.Image {
+	if from == to || from <= 0 || to <= 0 {
+		return in
+	}
+	out := make(chan image.Image)
+	go func() {
+		defer close(out)
+		// Rendered frame i is shown from i*from until (i+1)*from, output frame
+		// k is shown at k*to. Intervals are rounded to nanoseconds, so times
+		// that are almost equal are considered to be the same.
+		var i, k time.Duration
+		var prev image.Image
+		for img := range in {
+			if blend && prev != nil {
+				// Output frames between the previous frame and this one.
+				for ; k*to+time.Microsecond < i*from; k++ {
+					f := math.Max(0, float64(k*to-(i-1)*from)/float64(from))
+					out <- BlendImages(prev, img, f)
+				}
+			} else if !blend {
+				for ; k*to+time.Microsecond < (i+1)*from; k++ {
+					out <- img
+				}
+			}
+			prev = img
+			i++
+		}
+		// The last frame has no successor to blend with.
+		for ; blend && prev != nil && k*to+time.Microsecond < i*from; k++ {
+			out <- prev
+		}
+	}()
+	return out
+}
+
+// BlendImages mixes two images of the same size. f is the weight of b, from 0
+// to 1.
+func BlendImages(a, b image.Image, f float64) image.Image {
+	rect := a.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	ra, okA := a.(*image.RGBA)
+	rb, okB := b.(*image.RGBA)
+	if okA && okB && ra.Rect == rb.Rect && ra.Stride == 4*rect.Dx() && rb.Stride == ra.Stride {
+		w := uint32(f*256 + 0.5)
+		for i := range dst.Pix {
+			dst.Pix[i] = uint8((uint32(ra.Pix[i])*(256-w) + uint32(rb.Pix[i])*w + 128) >> 8)
+		}
+		return dst
+	}
+	mix := func(x, y uint32) uint8 {
+		return uint8((float64(x)*(1-f) + float64(y)*f) / 0x101)
+	}
+	offset := b.Bounds().Min.Sub(rect.Min)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r0, g0, b0, a0 := a.At(x, y).RGBA()
+			r1, g1, b1, a1 := b.At(x+offset.X, y+offset.Y).RGBA()
+			dst.SetRGBA(x-rect.Min.X, y-rect.Min.Y, color.RGBA{
+				R: mix(r0, r1),
+				G: mix(g0, g1),
+				B: mix(b0, b1),
+				A: mix(a0, a1),
+			})
+		}
+	}
+	return dst
+}
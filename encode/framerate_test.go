@@ -0,0 +1,71 @@
+package encode
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestConvertFrameRate(t *testing.T) {
+	convert := func(n int, from, to time.Duration, blend bool) []uint8 {
+		in := make(chan image.Image)
+		go func() {
+			defer close(in)
+			for i := 0; i < n; i++ {
+				img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+				img.Pix[0] = uint8(i * 10)
+				in <- img
+			}
+		}()
+		var values []uint8
+		for img := range ConvertFrameRate(in, from, to, blend) {
+			values = append(values, img.(*image.RGBA).Pix[0])
+		}
+		return values
+	}
+	tests := []struct {
+		from, to time.Duration
+		blend    bool
+		expected []uint8
+	}{
+		{time.Second / 60, time.Second / 30, false, []uint8{0, 20, 40}},
+		{time.Second / 30, time.Second / 60, false, []uint8{0, 0, 10, 10, 20, 20, 30, 30, 40, 40, 50, 50}},
+		{time.Second / 20, time.Second / 30, false, []uint8{0, 0, 10, 20, 20, 30, 40, 40, 50}},
+		{time.Second / 30, time.Second / 60, true, []uint8{0, 5, 10, 15, 20, 25, 30, 35, 40, 45, 50, 50}},
+		{time.Second / 10, time.Second / 10, true, []uint8{0, 10, 20, 30, 40, 50}},
+	}
+	for _, tt := range tests {
+		values := convert(6, tt.from, tt.to, tt.blend)
+		if len(values) != len(tt.expected) {
+			t.Errorf("%v -> %v, blend %v: expected %v, got %v", tt.from, tt.to, tt.blend, tt.expected, values)
+			continue
+		}
+		for i := range values {
+			if values[i] != tt.expected[i] {
+				t.Errorf("%v -> %v, blend %v: expected %v, got %v", tt.from, tt.to, tt.blend, tt.expected, values)
+				break
+			}
+		}
+	}
+}
+
+func TestBlendImages(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	b := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			a.SetRGBA(x, y, color.RGBA{0, 100, 200, 255})
+			b.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+		}
+	}
+	expected := color.RGBA{64, 139, 214, 255}
+	if c := BlendImages(a, b, 0.25).(*image.RGBA).RGBAAt(1, 1); c != expected {
+		t.Fatalf("expected %v, got %v", expected, c)
+	}
+	// Other types of images take the slow path.
+	gray := image.NewGray(image.Rect(0, 0, 2, 2))
+	if c := BlendImages(gray, b, 0.5).(*image.RGBA).RGBAAt(1, 1); c != (color.RGBA{127, 127, 127, 255}) {
+		t.Fatalf("unexpected color of blended gray image: %v", c)
+	}
+}
@@ -0,0 +1,78 @@
+package encode
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// GIFFormat encodes animations as looping GIFs.
+type GIFFormat struct {
+	// Delay is the time each frame is shown, which is rounded down to
+	// hundredths of a second. If 0, the interval between frames is used.
+	Delay time.Duration
+	// Quantizer creates the palette of each frame, e.g. MedianCut or Octree.
+	// If nil, all frames use the Plan 9 palette.
+	Quantizer draw.Quantizer
+	// Dither enables Floyd-Steinberg error diffusion, which reduces banding in
+	// gradients at the cost of noise.
+	Dither bool
+}
+
+func (f GIFFormat) Extensions() []string {
+	return []string{"gif"}
+}
+
+func (f GIFFormat) MediaType() string {
+	return "image/gif"
+}
+
+func (f GIFFormat) Encode(w io.Writer, img image.Image) error {
+	// Forward to the code stream encoder for easy code reuse.
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f GIFFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	delay := interval
+	if f.Delay > 0 {
+		delay = f.Delay
+	}
+	gifImg := &gif.GIF{
+		Image:           []*image.Paletted{},
+		Delay:           []int{},
+		LoopCount:       0,
+		Disposal:        []byte{},
+		BackgroundIndex: 0,
+	}
+	for img := range stream {
+		gifImg.Image = append(gifImg.Image, f.paletted(img))
+		gifImg.Delay = append(gifImg.Delay, int(delay/(time.Second/100)))
+		gifImg.Disposal = append(gifImg.Disposal, gif.DisposalBackground)
+	}
+	return gif.EncodeAll(w, gifImg)
+}
+
+// paletted converts a frame to the palette of the format.
+func (f GIFFormat) paletted(img image.Image) *image.Paletted {
+	pal := color.Palette(palette.Plan9)
+	if f.Quantizer != nil {
+		pal = f.Quantizer.Quantize(make(color.Palette, 0, 256), img)
+		if len(pal) == 0 {
+			pal = append(pal, color.Black)
+		}
+	}
+	frame := image.NewPaletted(img.Bounds(), pal)
+	if f.Dither {
+		draw.FloydSteinberg.Draw(frame, img.Bounds(), img, img.Bounds().Min)
+	} else {
+		draw.Draw(frame, img.Bounds(), img, img.Bounds().Min, draw.Over)
+	}
+	return frame
+}
@@ -0,0 +1,38 @@
+package encode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+)
+
+func TestGIFEncodeAnimation(t *testing.T) {
+	stream := make(chan image.Image, 2)
+	for _, c := range []color.RGBA{{255, 128, 0, 255}, {0, 128, 255, 255}} {
+		frame := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		for i := range frame.Pix {
+			frame.Pix[i] = []uint8{c.R, c.G, c.B, c.A}[i%4]
+		}
+		stream <- frame
+	}
+	close(stream)
+
+	var buf bytes.Buffer
+	f := GIFFormat{Delay: time.Second / 10, Quantizer: MedianCut{}, Dither: true}
+	if err := f.EncodeAnimation(&buf, stream, time.Second/60); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 2 || g.Delay[0] != 10 || g.Delay[1] != 10 {
+		t.Fatalf("unexpected frames: %d, delays: %v", len(g.Image), g.Delay)
+	}
+	if c := color.RGBAModel.Convert(g.Image[1].At(3, 3)).(color.RGBA); c != (color.RGBA{0, 128, 255, 255}) {
+		t.Fatalf("unexpected color: %v", c)
+	}
+}
@@ -0,0 +1,201 @@
+package encode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+// LoadICCProfile reads an ICC profile from a file, such as a .icc or .icm
+// file.
+func LoadICCProfile(filename string) ([]byte, error) {
+	profile, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(profile) < 128 || string(profile[36:40]) != "acsp" {
+		return nil, fmt.Errorf("%s is not an ICC profile", filename)
+	}
+	return profile, nil
+}
+
+// SRGBProfile returns a version 2 ICC profile of the sRGB color space, which
+// is what shaders are generally written for.
+func SRGBProfile() []byte {
+	// The primaries are adapted to the D50 illuminant of the profile
+	// connection space with the Bradford transform.
+	primaries := [3][3]float64{
+		{0.4360747, 0.2225045, 0.0139322},
+		{0.3850649, 0.7168786, 0.0971045},
+		{0.1430804, 0.0606169, 0.7141733},
+	}
+	d50 := [3]float64{0.9642, 1.0, 0.8249}
+
+	curve := make([]uint16, 1024)
+	for i := range curve {
+		v := float64(i) / float64(len(curve)-1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		curve[i] = uint16(math.Round(v * 0xffff))
+	}
+	trc := iccTag("curv", uint32(len(curve)), curve)
+
+	desc := "sRGB"
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", iccTag("desc", uint32(len(desc)+1), []byte(desc+"\x00"), [78]byte{})},
+		{"cprt", iccTag("text", []byte("No copyright, use freely\x00"))},
+		{"wtpt", iccTag("XYZ ", s15Fixed16(d50))},
+		{"rXYZ", iccTag("XYZ ", s15Fixed16(primaries[0]))},
+		{"gXYZ", iccTag("XYZ ", s15Fixed16(primaries[1]))},
+		{"bXYZ", iccTag("XYZ ", s15Fixed16(primaries[2]))},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	// The tag data follows the header and the tag table. Tags with the same
+	// data share it.
+	offset := 128 + 4 + len(tags)*12
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	offsets := map[*byte]int{}
+	for _, tag := range tags {
+		o, ok := offsets[&tag.data[0]]
+		if !ok {
+			o = offset + data.Len()
+			offsets[&tag.data[0]] = o
+			data.Write(tag.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(tag.sig)
+		binary.Write(&table, binary.BigEndian, []uint32{uint32(o), uint32(len(tag.data))})
+	}
+
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, uint32(offset+data.Len()))
+	header.Write(make([]byte, 4))
+	binary.Write(&header, binary.BigEndian, uint32(0x02100000))
+	header.WriteString("mntrRGB XYZ ")
+	binary.Write(&header, binary.BigEndian, []uint16{2024, 1, 1, 0, 0, 0})
+	header.WriteString("acsp")
+	header.Write(make([]byte, 68-header.Len()))
+	header.Write(s15Fixed16(d50))
+	header.Write(make([]byte, 128-header.Len()))
+
+	return append(append(header.Bytes(), table.Bytes()...), data.Bytes()...)
+}
+
+// iccTag encodes the data of a tag of the specified type.
+func iccTag(typ string, values ...interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(typ)
+	buf.Write(make([]byte, 4))
+	for _, v := range values {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	return buf.Bytes()
+}
+
+func s15Fixed16(xyz [3]float64) []byte {
+	b := make([]byte, 12)
+	for i, v := range xyz {
+		binary.BigEndian.PutUint32(b[i*4:], uint32(int32(math.Round(v*0x10000))))
+	}
+	return b
+}
+
+// embedICCPNG inserts an iCCP chunk with the profile into an encoded PNG
+// file.
+func embedICCPNG(png, profile []byte) ([]byte, error) {
+	var data bytes.Buffer
+	// The name of the profile is followed by the compression method, of
+	// which 0 is zlib.
+	data.WriteString("ICC profile\x00\x00")
+	zw := zlib.NewWriter(&data)
+	if _, err := zw.Write(profile); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return insertPNGChunk(png, "iCCP", data.Bytes())
+}
+
+// embedICCJPEG inserts APP2 segments with the profile into an encoded JPEG
+// file. Profiles that do not fit in a single segment are split.
+func embedICCJPEG(jpeg, profile []byte) ([]byte, error) {
+	if len(jpeg) < 2 || jpeg[0] != 0xff || jpeg[1] != 0xd8 {
+		return nil, fmt.Errorf("not a JPEG file")
+	}
+	const marker = "ICC_PROFILE\x00"
+	const maxChunk = 0xffff - 2 - len(marker) - 2
+	numChunks := (len(profile) + maxChunk - 1) / maxChunk
+	if numChunks > 0xff {
+		return nil, fmt.Errorf("ICC profile is too large: %d bytes", len(profile))
+	}
+	var segments bytes.Buffer
+	for i := 0; i < numChunks; i++ {
+		chunk := profile[i*maxChunk:]
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+		segments.Write([]byte{0xff, 0xe2})
+		binary.Write(&segments, binary.BigEndian, uint16(2+len(marker)+2+len(chunk)))
+		segments.WriteString(marker)
+		segments.Write([]byte{byte(i + 1), byte(numChunks)})
+		segments.Write(chunk)
+	}
+	// The segments are put right after the start of image marker.
+	out := make([]byte, 0, len(jpeg)+segments.Len())
+	out = append(out, jpeg[:2]...)
+	out = append(out, segments.Bytes()...)
+	return append(out, jpeg[2:]...), nil
+}
+
+// embedICCTIFF adds the ICC profile tag to an encoded little endian TIFF
+// file. A copy of the image file directory with the tag added is appended to
+// the file, after which the profile follows, and the header is pointed at it.
+func embedICCTIFF(tiff, profile []byte) ([]byte, error) {
+	if len(tiff) < 8 || string(tiff[:4]) != "II*\x00" {
+		return nil, fmt.Errorf("not a little endian TIFF file")
+	}
+	le := binary.LittleEndian
+	ifd := int(le.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return nil, fmt.Errorf("invalid TIFF file directory offset")
+	}
+	n := int(le.Uint16(tiff[ifd:]))
+	entries := tiff[ifd+2 : ifd+2+n*12]
+
+	out := append([]byte{}, tiff...)
+	if len(out)%2 != 0 {
+		out = append(out, 0)
+	}
+	newIFD := len(out)
+	out = append(out, 0, 0)
+	le.PutUint16(out[newIFD:], uint16(n+1))
+	// Tags must be in ascending order. The ICC profile tag, 34675, is
+	// greater than all tags that are written by the encoder.
+	out = append(out, entries...)
+	entry := make([]byte, 12)
+	le.PutUint16(entry[0:], 34675)
+	le.PutUint16(entry[2:], 7) // Undefined, i.e. bytes.
+	le.PutUint32(entry[4:], uint32(len(profile)))
+	le.PutUint32(entry[8:], uint32(newIFD+2+(n+1)*12+4))
+	out = append(out, entry...)
+	out = append(out, 0, 0, 0, 0) // No next directory.
+	out = append(out, profile...)
+	le.PutUint32(out[4:], uint32(newIFD))
+	return out, nil
+}
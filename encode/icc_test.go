@@ -0,0 +1,85 @@
+package encode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestSRGBProfile(t *testing.T) {
+	profile := SRGBProfile()
+	if size := binary.BigEndian.Uint32(profile); int(size) != len(profile) {
+		t.Fatalf("size %d does not match the length %d", size, len(profile))
+	}
+	if string(profile[36:40]) != "acsp" || string(profile[12:24]) != "mntrRGB XYZ " {
+		t.Fatalf("invalid header: %q", profile[:40])
+	}
+	numTags := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < numTags; i++ {
+		entry := profile[132+i*12:]
+		sig := string(entry[:4])
+		offset, size := binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:])
+		if offset%4 != 0 || int(offset+size) > len(profile) {
+			t.Fatalf("tag %s is out of bounds: %d+%d", sig, offset, size)
+		}
+	}
+}
+
+func TestPNGICC(t *testing.T) {
+	profile := SRGBProfile()
+	var buf bytes.Buffer
+	if err := (PNGFormat{ICC: profile, Color: &ColorSRGB}).Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(buf.Bytes(), []byte("iCCP"))
+	if i < 0 {
+		t.Fatalf("expected an iCCP chunk")
+	}
+	length := binary.BigEndian.Uint32(buf.Bytes()[i-4:])
+	data := buf.Bytes()[i+4 : i+4+int(length)]
+	if !bytes.HasPrefix(data, []byte("ICC profile\x00\x00")) {
+		t.Fatalf("unexpected profile name: %q", data[:14])
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data[13:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := io.ReadAll(zr); err != nil || !bytes.Equal(decoded, profile) {
+		t.Fatalf("the embedded profile does not match: %v", err)
+	}
+	if _, err := png.Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJPEGICC(t *testing.T) {
+	// A profile that is split over multiple segments.
+	profile := make([]byte, 100000)
+	copy(profile, SRGBProfile())
+	var buf bytes.Buffer
+	if err := (JPGFormat{ICC: profile}).Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	var joined []byte
+	b := buf.Bytes()
+	for i := 2; b[i] == 0xff && b[i+1] == 0xe2; {
+		length := int(binary.BigEndian.Uint16(b[i+2:]))
+		segment := b[i+4 : i+2+length]
+		if !bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")) || segment[13] != 2 {
+			t.Fatalf("unexpected segment header: %q", segment[:14])
+		}
+		joined = append(joined, segment[14:]...)
+		i += 2 + length
+	}
+	if !bytes.Equal(joined, profile) {
+		t.Fatalf("the embedded profile does not match: %d bytes", len(joined))
+	}
+	if _, err := jpeg.Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
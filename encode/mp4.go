@@ -0,0 +1,86 @@
+package encode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MP4Format encodes frames to H.264 video in an MP4 container by piping them
+// as a YUV4MPEG2 stream through ffmpeg, which must be installed. The output is
+// a fragmented MP4, so it can be written to pipes and other outputs that can
+// not seek.
+type MP4Format struct {
+	// Codec is the ffmpeg video encoder, libx264 if empty.
+	Codec string
+	// CRF sets the constant rate factor of the encoder, which trades quality
+	// for size. The default of the encoder is used if 0.
+	CRF int
+}
+
+func (f MP4Format) Extensions() []string {
+	return []string{"mp4"}
+}
+
+func (f MP4Format) MediaType() string {
+	return "video/mp4"
+}
+
+func (f MP4Format) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f MP4Format) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	codec := f.Codec
+	if codec == "" {
+		codec = "libx264"
+	}
+	args := []string{
+		"-loglevel", "error",
+		"-f", "yuv4mpegpipe",
+		"-i", "-",
+		"-c:v", codec,
+		"-pix_fmt", "yuv420p",
+	}
+	if f.CRF != 0 {
+		args = append(args, "-crf", strconv.Itoa(f.CRF))
+	}
+	args = append(args, "-movflags", "frag_keyframe+empty_moov", "-f", "mp4", "-")
+
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stdin = pr
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		for range stream {
+		}
+		return fmt.Errorf("could not start ffmpeg: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		// Unblock the encoder if ffmpeg exits early.
+		pr.CloseWithError(io.ErrClosedPipe)
+		done <- err
+	}()
+
+	encErr := Y4MFormat{}.EncodeAnimation(pw, stream, interval)
+	// The stream should be consumed, even if ffmpeg failed.
+	for range stream {
+	}
+	pw.Close()
+	if err := <-done; err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return encErr
+}
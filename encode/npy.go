@@ -0,0 +1,152 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// A FloatImage is an image with floating point values, such as the depth
+// output of a shader. It is implemented by renderer.FloatImage.
+type FloatImage interface {
+	image.Image
+	// FloatData returns the values of all pixels in row-major order and the
+	// number of values per pixel.
+	FloatData() ([]float32, int)
+}
+
+// NPYFormat writes images as NumPy arrays, which can be loaded with
+// numpy.load.
+//
+// FloatImages are written as float32 arrays with the shape (height, width) for
+// a single channel or (height, width, channels) otherwise. Other images are
+// written as uint8 RGBA arrays. Animations are stacked into a single array with
+// the frame as the first dimension. If the writer can not seek, such as a
+// pipe, every frame is written as a separate array instead, which can be
+// read by calling numpy.load repeatedly on the same file.
+type NPYFormat struct{}
+
+func (f NPYFormat) Extensions() []string {
+	return []string{"npy"}
+}
+
+func (f NPYFormat) Encode(w io.Writer, img image.Image) error {
+	descr, shape, data := npyArray(img)
+	header := npyHeader(descr, shape, 0)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (f NPYFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	ws, ok := w.(io.WriteSeeker)
+	if ok {
+		_, err := ws.Seek(0, io.SeekCurrent)
+		ok = err == nil
+	}
+	if !ok {
+		for img := range stream {
+			if err := f.Encode(w, img); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The number of frames is not known until the stream closes, so the
+	// header is written with room for the largest possible count and
+	// rewritten afterwards.
+	var descr string
+	var shape []int
+	var headerLen, frames int
+	for img := range stream {
+		d, s, data := npyArray(img)
+		if frames == 0 {
+			descr, shape = d, s
+			headerLen = len(npyHeader(descr, append([]int{math.MaxInt64}, shape...), 0))
+			if _, err := ws.Write(npyHeader(descr, append([]int{0}, shape...), headerLen)); err != nil {
+				return err
+			}
+		} else if d != descr || fmt.Sprint(s) != fmt.Sprint(shape) {
+			return fmt.Errorf("npy: frame %d has shape %v, expected %v", frames, s, shape)
+		}
+		if _, err := ws.Write(data); err != nil {
+			return err
+		}
+		frames++
+	}
+	if frames == 0 {
+		return nil
+	}
+	if _, err := ws.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(npyHeader(descr, append([]int{frames}, shape...), headerLen)); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// npyArray returns the data type, shape and little endian contents of an
+// image.
+func npyArray(img image.Image) (string, []int, []byte) {
+	b := img.Bounds()
+	if fimg, ok := img.(FloatImage); ok {
+		values, channels := fimg.FloatData()
+		data := make([]byte, len(values)*4)
+		for i, v := range values {
+			binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+		}
+		shape := []int{b.Dy(), b.Dx()}
+		if channels > 1 {
+			shape = append(shape, channels)
+		}
+		return "<f4", shape, data
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Stride != b.Dx()*4 || rgba.Rect.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	}
+	return "|u1", []int{b.Dy(), b.Dx(), 4}, rgba.Pix
+}
+
+// npyHeader creates the header of a version 1.0 .npy file, padded to at least
+// minLen bytes.
+func npyHeader(descr string, shape []int, minLen int) []byte {
+	dims := make([]string, len(shape))
+	for i, n := range shape {
+		dims[i] = fmt.Sprint(n)
+	}
+	tuple := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		tuple += ","
+	}
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, tuple)
+
+	// The header is padded with spaces and a newline so the data is aligned to
+	// 64 bytes.
+	const preamble = 10
+	total := preamble + len(dict) + 1
+	if total < minLen {
+		total = minLen
+	}
+	total = (total + 63) / 64 * 64
+
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&buf, binary.LittleEndian, uint16(total-preamble))
+	buf.WriteString(dict)
+	buf.WriteString(strings.Repeat(" ", total-preamble-len(dict)-1))
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
@@ -0,0 +1,76 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testFloatImage struct {
+	*image.Gray
+	data     []float32
+	channels int
+}
+
+func (img testFloatImage) FloatData() ([]float32, int) {
+	return img.data, img.channels
+}
+
+func TestNPYHeader(t *testing.T) {
+	header := npyHeader("<f4", []int{3}, 0)
+	if len(header)%64 != 0 {
+		t.Fatalf("header is not aligned: %d bytes", len(header))
+	}
+	if n := binary.LittleEndian.Uint16(header[8:]); int(n) != len(header)-10 {
+		t.Fatalf("unexpected header length: %d", n)
+	}
+	dict := strings.TrimRight(string(header[10:]), " \n")
+	if exp := "{'descr': '<f4', 'fortran_order': False, 'shape': (3,), }"; dict != exp {
+		t.Fatalf("unexpected header: %q", dict)
+	}
+	if header[len(header)-1] != '\n' {
+		t.Fatalf("header does not end in a newline")
+	}
+}
+
+func TestNPYAnimation(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.npy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stream := make(chan image.Image, 2)
+	for i := 0; i < 2; i++ {
+		stream <- testFloatImage{
+			Gray:     image.NewGray(image.Rect(0, 0, 3, 2)),
+			data:     []float32{0, 1, 2, 3, 4, float32(i)},
+			channels: 1,
+		}
+	}
+	close(stream)
+	if err := (NPYFormat{}).EncodeAnimation(f, stream, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerLen := 10 + int(binary.LittleEndian.Uint16(buf[8:]))
+	if !bytes.Contains(buf[:headerLen], []byte("'shape': (2, 2, 3)")) {
+		t.Fatalf("unexpected header: %q", buf[:headerLen])
+	}
+	data := buf[headerLen:]
+	if len(data) != 2*6*4 {
+		t.Fatalf("unexpected data length: %d", len(data))
+	}
+	if v := math.Float32frombits(binary.LittleEndian.Uint32(data[len(data)-4:])); v != 1 {
+		t.Fatalf("unexpected last value: %v", v)
+	}
+}
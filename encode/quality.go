@@ -0,0 +1,61 @@
+package encode
+
+import (
+	"math"
+	"time"
+)
+
+// A QualityController adapts the quality of a lossy stream, such as JPEG
+// frames sent over a network, to a target bitrate and to consumers that can
+// not keep up. The quality is lowered quickly when frames are too large or
+// are not consumed in time and raised slowly otherwise, which keeps live
+// previews responsive on slow links.
+type QualityController struct {
+	// Min and Max bound the quality.
+	Min, Max int
+	// Bitrate is the target in bits per second, or 0 to only adapt to lag.
+	Bitrate float64
+	// Interval is the time between two frames.
+	Interval time.Duration
+
+	quality float64
+}
+
+// NewQualityController creates a controller that starts at the maximum
+// quality.
+func NewQualityController(min, max int, bitrate float64, interval time.Duration) *QualityController {
+	return &QualityController{
+		Min:      min,
+		Max:      max,
+		Bitrate:  bitrate,
+		Interval: interval,
+		quality:  float64(max),
+	}
+}
+
+// Quality returns the quality to encode the next frame with.
+func (c *QualityController) Quality() int {
+	return int(math.Round(c.quality))
+}
+
+// Update adjusts the quality after a frame of size bytes was sent. lagging
+// reports whether a consumer fell behind.
+func (c *QualityController) Update(size int, lagging bool) {
+	var bitrate float64
+	if c.Interval > 0 {
+		bitrate = float64(size*8) / c.Interval.Seconds()
+	}
+	switch {
+	case lagging:
+		c.quality *= 0.75
+	case c.Bitrate > 0 && bitrate > c.Bitrate:
+		// The size does not scale linearly with the quality, so only go
+		// part of the way to avoid overshooting.
+		c.quality -= c.quality * (1 - c.Bitrate/bitrate) / 2
+	case c.Bitrate > 0 && bitrate > c.Bitrate*0.9:
+		// Close enough to the target.
+	default:
+		c.quality++
+	}
+	c.quality = math.Max(float64(c.Min), math.Min(float64(c.Max), c.quality))
+}
@@ -0,0 +1,43 @@
+package encode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQualityController(t *testing.T) {
+	c := NewQualityController(10, 90, 0, time.Second/10)
+	if q := c.Quality(); q != 90 {
+		t.Fatalf("expected to start at 90, got %d", q)
+	}
+	c.Update(1000, true)
+	c.Update(1000, true)
+	if q := c.Quality(); q != 51 {
+		t.Fatalf("expected 51 after lagging twice, got %d", q)
+	}
+	c.Update(1000, false)
+	if q := c.Quality(); q != 52 {
+		t.Fatalf("expected 52 after catching up, got %d", q)
+	}
+	for i := 0; i < 20; i++ {
+		c.Update(1000, true)
+	}
+	if q := c.Quality(); q != 10 {
+		t.Fatalf("expected the minimum of 10, got %d", q)
+	}
+
+	// 10 frames per second of 25kB is twice the target of 1Mbit/s.
+	c = NewQualityController(10, 90, 1e6, time.Second/10)
+	c.Update(25000, false)
+	if q := c.Quality(); q != 68 {
+		t.Fatalf("expected 68 over the bitrate, got %d", q)
+	}
+	c.Update(12000, false)
+	if q := c.Quality(); q != 68 {
+		t.Fatalf("expected 68 near the bitrate, got %d", q)
+	}
+	c.Update(5000, false)
+	if q := c.Quality(); q != 69 {
+		t.Fatalf("expected 69 under the bitrate, got %d", q)
+	}
+}
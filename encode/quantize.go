@@ -0,0 +1,220 @@
+package encode
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// histogramEntry is a distinct color of an image and the number of pixels of
+// that color.
+type histogramEntry struct {
+	c [3]uint8
+	n int
+}
+
+// histogram counts the distinct opaque colors of an image.
+func histogram(m image.Image) []histogramEntry {
+	counts := map[[3]uint8]int{}
+	b := m.Bounds()
+	if rgba, ok := m.(*image.RGBA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := rgba.Pix[rgba.PixOffset(b.Min.X, y):rgba.PixOffset(b.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				counts[[3]uint8{row[i], row[i+1], row[i+2]}]++
+			}
+		}
+	} else {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
+				counts[[3]uint8{c.R, c.G, c.B}]++
+			}
+		}
+	}
+	hist := make([]histogramEntry, 0, len(counts))
+	for c, n := range counts {
+		hist = append(hist, histogramEntry{c: c, n: n})
+	}
+	// Sort for deterministic palettes, as maps are iterated in random order.
+	sort.Slice(hist, func(i, j int) bool {
+		a, b := hist[i].c, hist[j].c
+		return a[0] < b[0] || a[0] == b[0] && (a[1] < b[1] || a[1] == b[1] && a[2] < b[2])
+	})
+	return hist
+}
+
+// MedianCut is a draw.Quantizer that repeatedly splits the colors of an image
+// in two groups of the same number of pixels along the channel with the
+// widest range. It preserves large areas of similar colors well.
+type MedianCut struct{}
+
+func (MedianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	boxes := [][]histogramEntry{histogram(m)}
+	for len(boxes) < cap(p)-len(p) {
+		// Split the box with the widest range.
+		split, channel, widest := -1, 0, 0
+		for i, box := range boxes {
+			if ch, width := widestChannel(box); width > widest {
+				split, channel, widest = i, ch, width
+			}
+		}
+		if split < 0 {
+			break
+		}
+		box := boxes[split]
+		sort.Slice(box, func(i, j int) bool { return box[i].c[channel] < box[j].c[channel] })
+		median := medianIndex(box)
+		boxes[split] = box[:median]
+		boxes = append(boxes, box[median:])
+	}
+	for _, box := range boxes {
+		if len(box) == 0 {
+			continue
+		}
+		var r, g, b, n int
+		for _, e := range box {
+			r += int(e.c[0]) * e.n
+			g += int(e.c[1]) * e.n
+			b += int(e.c[2]) * e.n
+			n += e.n
+		}
+		p = append(p, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 0xff})
+	}
+	return p
+}
+
+// widestChannel returns the channel of which the values in the box have the
+// widest range, and that range.
+func widestChannel(box []histogramEntry) (int, int) {
+	if len(box) < 2 {
+		return 0, 0
+	}
+	channel, widest := 0, 0
+	for ch := 0; ch < 3; ch++ {
+		min, max := box[0].c[ch], box[0].c[ch]
+		for _, e := range box[1:] {
+			if e.c[ch] < min {
+				min = e.c[ch]
+			}
+			if e.c[ch] > max {
+				max = e.c[ch]
+			}
+		}
+		if int(max-min) > widest {
+			channel, widest = ch, int(max-min)
+		}
+	}
+	return channel, widest
+}
+
+// medianIndex returns the index that splits the sorted box in two halves of
+// about the same number of pixels, of which neither is empty.
+func medianIndex(box []histogramEntry) int {
+	var total int
+	for _, e := range box {
+		total += e.n
+	}
+	var count int
+	for i, e := range box[:len(box)-1] {
+		count += e.n
+		if count*2 >= total {
+			return i + 1
+		}
+	}
+	return len(box) - 1
+}
+
+// Octree is a draw.Quantizer that sorts the colors of an image in a tree of
+// which each level holds one more bit of every channel, and merges the least
+// used branches until the palette fits. It preserves small details of
+// distinct colors well.
+type Octree struct{}
+
+type octreeNode struct {
+	children [8]*octreeNode
+	leaf     bool
+	n        int
+	r, g, b  int
+}
+
+func (Octree) Quantize(p color.Palette, m image.Image) color.Palette {
+	max := cap(p) - len(p)
+	if max <= 0 {
+		return p
+	}
+	root := &octreeNode{}
+	// levels holds the nodes of each depth that have children.
+	var levels [8][]*octreeNode
+	var leaves int
+	for _, e := range histogram(m) {
+		node := root
+		for depth := 0; ; depth++ {
+			node.n += e.n
+			node.r += int(e.c[0]) * e.n
+			node.g += int(e.c[1]) * e.n
+			node.b += int(e.c[2]) * e.n
+			if depth == 8 {
+				break
+			}
+			shift := 7 - depth
+			i := (e.c[0]>>shift&1)<<2 | (e.c[1]>>shift&1)<<1 | e.c[2]>>shift&1
+			if node.children[i] == nil {
+				if !node.hasChildren() {
+					levels[depth] = append(levels[depth], node)
+				}
+				node.children[i] = &octreeNode{leaf: depth == 7}
+				if depth == 7 {
+					leaves++
+				}
+			}
+			node = node.children[i]
+		}
+	}
+
+	// Merge the children of the least used nodes of the deepest level until
+	// the palette fits.
+	for depth := 7; depth >= 0 && leaves > max; depth-- {
+		nodes := levels[depth]
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].n < nodes[j].n })
+		for _, node := range nodes {
+			if leaves <= max {
+				break
+			}
+			for i, child := range node.children {
+				if child != nil {
+					node.children[i] = nil
+					leaves--
+				}
+			}
+			node.leaf = true
+			leaves++
+		}
+	}
+
+	var collect func(node *octreeNode)
+	collect = func(node *octreeNode) {
+		if node.leaf {
+			p = append(p, color.RGBA{R: uint8(node.r / node.n), G: uint8(node.g / node.n), B: uint8(node.b / node.n), A: 0xff})
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				collect(child)
+			}
+		}
+	}
+	if root.n > 0 {
+		collect(root)
+	}
+	return p
+}
+
+func (node *octreeNode) hasChildren() bool {
+	for _, child := range node.children {
+		if child != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package encode
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	colors := []color.RGBA{
+		{255, 0, 0, 255},
+		{0, 255, 0, 255},
+		{0, 0, 255, 255},
+		{250, 0, 0, 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		img.SetRGBA(i%4, i/4, colors[i%4])
+	}
+
+	for name, q := range map[string]draw.Quantizer{"median-cut": MedianCut{}, "octree": Octree{}} {
+		if p := q.Quantize(make(color.Palette, 0, 256), img); len(p) != 4 {
+			t.Fatalf("%s: expected all 4 colors, got %v", name, p)
+		}
+		p := q.Quantize(make(color.Palette, 0, 3), img)
+		if len(p) != 3 {
+			t.Fatalf("%s: expected 3 colors, got %v", name, p)
+		}
+		// The similar reds should be merged.
+		if c := p.Convert(colors[3]).(color.RGBA); c.R < 250 || c.G != 0 || c.B != 0 {
+			t.Fatalf("%s: unexpected color for red: %v", name, c)
+		}
+		if c := p.Convert(colors[2]).(color.RGBA); c != colors[2] {
+			t.Fatalf("%s: unexpected color for blue: %v", name, c)
+		}
+	}
+}
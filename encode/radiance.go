@@ -0,0 +1,127 @@
+package encode
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"time"
+)
+
+// RadianceFormat writes images as Radiance RGBE files, also known as .hdr,
+// which keep the values of HDR images beyond 1.0 with a shared exponent.
+//
+// As with EXRFormat, values are written as is and animations are written as
+// concatenated files. Alpha is dropped and single channel images are written
+// as grayscale.
+type RadianceFormat struct{}
+
+func (f RadianceFormat) Extensions() []string {
+	return []string{"hdr"}
+}
+
+func (f RadianceFormat) MediaType() string {
+	return "image/vnd.radiance"
+}
+
+func (f RadianceFormat) Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	values, channels := floatPixels(img)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", b.Dy(), b.Dx())
+
+	scanline := make([]byte, b.Dx()*4)
+	component := make([]byte, b.Dx())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			i := (y*b.Dx() + x) * channels
+			var rgb [3]float32
+			for c := range rgb {
+				rgb[c] = values[i+c%channels]
+			}
+			if channels == 2 {
+				rgb[2] = 0
+			}
+			copy(scanline[x*4:], rgbe(rgb))
+		}
+		// Run length encoding is only defined for these widths. Other
+		// scanlines are stored flat.
+		if b.Dx() < 8 || b.Dx() > 0x7fff {
+			bw.Write(scanline)
+			continue
+		}
+		bw.Write([]byte{2, 2, byte(b.Dx() >> 8), byte(b.Dx())})
+		for c := 0; c < 4; c++ {
+			for x := range component {
+				component[x] = scanline[x*4+c]
+			}
+			writeRLE(bw, component)
+		}
+	}
+	return bw.Flush()
+}
+
+func (f RadianceFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rgbe encodes a color as 8-bit mantissas with a shared exponent. Negative
+// values are clamped to 0.
+func rgbe(rgb [3]float32) []byte {
+	max := float64(0)
+	for _, v := range rgb {
+		max = math.Max(max, float64(v))
+	}
+	if max < 1e-32 || math.IsNaN(max) {
+		return []byte{0, 0, 0, 0}
+	}
+	m, e := math.Frexp(max)
+	scale := m * 256 / max
+	out := []byte{0, 0, 0, byte(e + 128)}
+	for c, v := range rgb {
+		out[c] = byte(math.Max(0, float64(v)*scale))
+	}
+	return out
+}
+
+// writeRLE writes a component of a scanline with the run length encoding of
+// Radiance. Runs of at least 4 equal bytes are stored as a count above 128
+// and the byte, others are stored as a count and the bytes themselves.
+func writeRLE(w *bufio.Writer, data []byte) {
+	const minRun = 4
+	for cur := 0; cur < len(data); {
+		// Find the next run that is long enough.
+		start, run, prevRun := cur, 0, 0
+		for run < minRun && start < len(data) {
+			start += run
+			prevRun, run = run, 1
+			for start+run < len(data) && run < 127 && data[start] == data[start+run] {
+				run++
+			}
+		}
+		// A short run right before the long one is stored as a run too.
+		if prevRun > 1 && prevRun == start-cur {
+			w.Write([]byte{byte(128 + prevRun), data[cur]})
+			cur = start
+		}
+		for cur < start {
+			n := start - cur
+			if n > 128 {
+				n = 128
+			}
+			w.WriteByte(byte(n))
+			w.Write(data[cur : cur+n])
+			cur += n
+		}
+		if run >= minRun {
+			w.Write([]byte{byte(128 + run), data[start]})
+			cur += run
+		}
+	}
+}
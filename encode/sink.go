@@ -0,0 +1,82 @@
+package encode
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"time"
+)
+
+// A Sink consumes rendered frames, e.g. by sending them to a device. Unlike a
+// Format, which encodes to a byte stream, a sink is responsible for its own
+// output, which is identified by the target it is opened with.
+//
+// Sink is the stable interface to implement for new output devices.
+type Sink interface {
+	// Write is called with every rendered frame.
+	Write(img image.Image) error
+	// Close is called after the last frame.
+	Close() error
+}
+
+// SinkConfig describes the output a sink is opened for.
+type SinkConfig struct {
+	// Target identifies the output of the sink, e.g. a device or an address.
+	// It is set to the value of the -o flag.
+	Target        string
+	Width, Height int
+	// Interval is the time between two frames, or 0 for a single image.
+	Interval time.Duration
+}
+
+// OpenSinkFunc creates a Sink for the configuration.
+type OpenSinkFunc func(SinkConfig) (Sink, error)
+
+var sinks = map[string]OpenSinkFunc{}
+
+// RegisterSink makes a sink available as an output format with the specified
+// name.
+func RegisterSink(name string, open OpenSinkFunc) {
+	if _, ok := sinks[name]; ok {
+		panic(name + " is already registered as sink")
+	}
+	if _, ok := Formats[name]; ok {
+		panic(name + " is already registered as format")
+	}
+	sinks[name] = open
+}
+
+// Sinks returns the names of the registered sinks.
+func Sinks() []string {
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenSink opens the sink with the specified name. ok is false if no such sink
+// is registered.
+func OpenSink(name string, config SinkConfig) (sink Sink, ok bool, err error) {
+	open, ok := sinks[name]
+	if !ok {
+		return nil, false, nil
+	}
+	sink, err = open(config)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", name, err)
+	}
+	return sink, true, nil
+}
+
+// WriteAll writes all images from the stream to the sink until the stream is
+// closed.
+func WriteAll(sink Sink, stream <-chan image.Image) error {
+	for img := range stream {
+		if err := sink.Write(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
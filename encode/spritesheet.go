@@ -0,0 +1,137 @@
+package encode
+
+import (
+	"encoding/json"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SpriteSheet is a Sink that packs the frames of an animation into a grid in a
+// single PNG image, as used by game engines to play back baked effects.
+//
+// When closed, the image is written to the target and the position and timing
+// of every frame is written to a JSON file next to it, with the extension
+// replaced by ".json". The metadata uses the JSON array format of
+// TexturePacker and Aseprite, which is understood by most engines.
+type SpriteSheet struct {
+	target   string
+	columns  int
+	interval time.Duration
+	frames   []*image.RGBA
+}
+
+// SpriteSheetMetadata describes the frames of a sprite sheet.
+type SpriteSheetMetadata struct {
+	Frames []SpriteSheetFrame `json:"frames"`
+	Meta   struct {
+		App   string `json:"app"`
+		Image string `json:"image"`
+		Size  struct {
+			W int `json:"w"`
+			H int `json:"h"`
+		} `json:"size"`
+		FrameRate float64 `json:"frameRate,omitempty"`
+	} `json:"meta"`
+}
+
+// SpriteSheetFrame is the position of a frame in a sprite sheet.
+type SpriteSheetFrame struct {
+	Filename string `json:"filename"`
+	Frame    struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+		W int `json:"w"`
+		H int `json:"h"`
+	} `json:"frame"`
+	// Duration is the time the frame is shown in milliseconds.
+	Duration int `json:"duration"`
+}
+
+// NewSpriteSheet creates a sprite sheet that is written to the target. If
+// columns is 0, the grid is made as square as possible.
+func NewSpriteSheet(target string, columns int, interval time.Duration) *SpriteSheet {
+	return &SpriteSheet{target: target, columns: columns, interval: interval}
+}
+
+func (s *SpriteSheet) Write(img image.Image) error {
+	b := img.Bounds()
+	frame := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(frame, frame.Rect, img, b.Min, draw.Src)
+	s.frames = append(s.frames, frame)
+	return nil
+}
+
+// grid returns the number of columns and rows of the sheet.
+func (s *SpriteSheet) grid() (int, int) {
+	n := len(s.frames)
+	columns := s.columns
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(n))))
+	}
+	if columns > n {
+		columns = n
+	}
+	return columns, (n + columns - 1) / columns
+}
+
+// Pack lays out the frames written so far. The image name is referenced by
+// the metadata.
+func (s *SpriteSheet) Pack(imageName string) (*image.RGBA, SpriteSheetMetadata) {
+	var meta SpriteSheetMetadata
+	meta.Meta.App = "shady"
+	meta.Meta.Image = imageName
+	if s.interval > 0 {
+		meta.Meta.FrameRate = float64(time.Second) / float64(s.interval)
+	}
+	meta.Frames = []SpriteSheetFrame{}
+	if len(s.frames) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0)), meta
+	}
+
+	fw, fh := s.frames[0].Rect.Dx(), s.frames[0].Rect.Dy()
+	columns, rows := s.grid()
+	sheet := image.NewRGBA(image.Rect(0, 0, columns*fw, rows*fh))
+	meta.Meta.Size.W, meta.Meta.Size.H = sheet.Rect.Dx(), sheet.Rect.Dy()
+	for i, frame := range s.frames {
+		var f SpriteSheetFrame
+		f.Filename = strconv.Itoa(i)
+		f.Frame.X, f.Frame.Y = i%columns*fw, i/columns*fh
+		f.Frame.W, f.Frame.H = fw, fh
+		// The durations are rounded such that they add up to the length
+		// of the animation.
+		f.Duration = int((time.Duration(i+1) * s.interval).Milliseconds() - (time.Duration(i) * s.interval).Milliseconds())
+		meta.Frames = append(meta.Frames, f)
+		draw.Draw(sheet, image.Rect(f.Frame.X, f.Frame.Y, f.Frame.X+fw, f.Frame.Y+fh), frame, image.Point{}, draw.Src)
+	}
+	return sheet, meta
+}
+
+// Close writes the sheet and its metadata.
+func (s *SpriteSheet) Close() error {
+	sheet, meta := s.Pack(filepath.Base(s.target))
+	fd, err := os.Create(s.target)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(fd, sheet); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+
+	buf, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	metaFile := strings.TrimSuffix(s.target, filepath.Ext(s.target)) + ".json"
+	return os.WriteFile(metaFile, append(buf, '\n'), 0644)
+}
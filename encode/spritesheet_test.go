@@ -0,0 +1,38 @@
+package encode
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestSpriteSheetPack(t *testing.T) {
+	s := NewSpriteSheet("fx.png", 0, time.Second/30)
+	for i := 0; i < 5; i++ {
+		frame := image.NewRGBA(image.Rect(0, 0, 4, 2))
+		frame.SetRGBA(0, 0, color.RGBA{uint8(i), 0, 0, 255})
+		s.Write(frame)
+	}
+	sheet, meta := s.Pack("fx.png")
+	if sheet.Rect != image.Rect(0, 0, 12, 4) {
+		t.Fatalf("unexpected sheet size: %v", sheet.Rect)
+	}
+	if len(meta.Frames) != 5 || meta.Meta.Size.W != 12 || meta.Meta.Size.H != 4 {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+	f := meta.Frames[4]
+	if f.Frame.X != 4 || f.Frame.Y != 2 || f.Frame.W != 4 || f.Frame.H != 2 {
+		t.Fatalf("unexpected frame rect: %+v", f.Frame)
+	}
+	if c := sheet.RGBAAt(f.Frame.X, f.Frame.Y); c.R != 4 {
+		t.Fatalf("unexpected pixel: %v", c)
+	}
+	var total int
+	for _, f := range meta.Frames {
+		total += f.Duration
+	}
+	if total != 166 {
+		t.Fatalf("unexpected total duration: %d", total)
+	}
+}
@@ -0,0 +1,78 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+type testHDRImage struct {
+	*image.RGBA
+	data []float32
+}
+
+func (img testHDRImage) FloatData() ([]float32, int) {
+	return img.data, 4
+}
+
+func TestTIFF16(t *testing.T) {
+	img := testHDRImage{
+		RGBA: image.NewRGBA(image.Rect(0, 0, 2, 1)),
+		data: []float32{0.5, 2, -1, 1, 0.25, 0, 0, 1},
+	}
+	var buf bytes.Buffer
+	if err := (TIFFFormat{Bits: 16}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := tiff.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := color.NRGBA64Model.Convert(decoded.At(0, 0)).(color.NRGBA64)
+	if exp := (color.NRGBA64{R: 0x8000, G: 0xffff, B: 0, A: 0xffff}); c != exp {
+		t.Fatalf("expected %v, got %v", exp, c)
+	}
+}
+
+func TestTIFFICC(t *testing.T) {
+	profile := SRGBProfile()
+	var buf bytes.Buffer
+	if err := (TIFFFormat{ICC: profile}).Encode(&buf, image.NewRGBA(image.Rect(0, 0, 3, 3))); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	ifd := int(binary.LittleEndian.Uint32(b[4:]))
+	n := int(binary.LittleEndian.Uint16(b[ifd:]))
+	last := b[ifd+2+(n-1)*12:]
+	if tag := binary.LittleEndian.Uint16(last); tag != 34675 {
+		t.Fatalf("expected the ICC profile tag last, got %d", tag)
+	}
+	offset, size := binary.LittleEndian.Uint32(last[8:]), binary.LittleEndian.Uint32(last[4:])
+	if !bytes.Equal(b[offset:offset+size], profile) {
+		t.Fatalf("the embedded profile does not match")
+	}
+	if _, err := tiff.Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBMP(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	var buf bytes.Buffer
+	if err := (BMPFormat{}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := bmp.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := decoded.At(1, 1).RGBA(); r>>8 != 10 || g>>8 != 20 || b>>8 != 30 {
+		t.Fatalf("unexpected color: %d %d %d", r>>8, g>>8, b>>8)
+	}
+}
@@ -0,0 +1,210 @@
+package encode
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"time"
+)
+
+// Y4MFormat encodes frames as a YUV4MPEG2 stream. Unlike raw video, the
+// stream declares the size and frame rate of the frames in its header, so it
+// can be piped into programs such as ffmpeg without repeating them.
+//
+// Colors are converted with the full range BT.601 coefficients, or those of
+// the matrix of Color if set. The full range is declared with the
+// XCOLORRANGE=FULL extension understood by ffmpeg.
+type Y4MFormat struct {
+	// Chroma444 stores the chroma planes at full resolution. By default, they
+	// have half the width and height (4:2:0), as expected by most encoders.
+	Chroma444 bool
+	// FieldOrder declares the frames as interlaced. The chroma of 4:2:0
+	// frames is then subsampled from the lines of each field separately.
+	FieldOrder FieldOrder
+	// Color selects the coefficients with which colors are converted to
+	// YCbCr. YUV4MPEG2 can not declare the colors, so the tag should be
+	// passed to the encoder as well.
+	Color *ColorTag
+}
+
+// FieldOrder is the order in which the fields of interlaced frames are
+// displayed.
+type FieldOrder string
+
+const (
+	Progressive FieldOrder = ""
+	// TopFieldFirst displays the even lines, counting from 0 at the top,
+	// before the odd lines.
+	TopFieldFirst FieldOrder = "tff"
+	// BottomFieldFirst displays the odd lines before the even lines.
+	BottomFieldFirst FieldOrder = "bff"
+)
+
+func (f Y4MFormat) Extensions() []string {
+	return []string{"y4m"}
+}
+
+func (f Y4MFormat) Encode(w io.Writer, img image.Image) error {
+	// Forward to the code stream encoder for easy code reuse.
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f Y4MFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	bw := bufio.NewWriter(w)
+	var size image.Point
+	var planes []byte
+	for img := range stream {
+		if planes == nil {
+			size = img.Bounds().Size()
+			chroma := "420jpeg"
+			if f.Chroma444 {
+				chroma = "444"
+			}
+			interlacing := "p"
+			switch f.FieldOrder {
+			case TopFieldFirst:
+				interlacing = "t"
+			case BottomFieldFirst:
+				interlacing = "b"
+			}
+			num, den := y4mFrameRate(interval)
+			if _, err := fmt.Fprintf(bw, "YUV4MPEG2 W%d H%d F%d:%d I%s A1:1 C%s XCOLORRANGE=FULL\n", size.X, size.Y, num, den, interlacing, chroma); err != nil {
+				return err
+			}
+			cw, ch := f.chromaSize(size)
+			planes = make([]byte, size.X*size.Y+2*cw*ch)
+		} else if img.Bounds().Size() != size {
+			return fmt.Errorf("the size of the frames changed from %v to %v, which is not supported by YUV4MPEG2", size, img.Bounds().Size())
+		}
+		f.convert(planes, img)
+		if _, err := bw.WriteString("FRAME\n"); err != nil {
+			return err
+		}
+		if _, err := bw.Write(planes); err != nil {
+			return err
+		}
+		// Flush every frame, so consumers receive it as soon as it is
+		// rendered.
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (f Y4MFormat) chromaSize(size image.Point) (int, int) {
+	if f.Chroma444 {
+		return size.X, size.Y
+	}
+	return (size.X + 1) / 2, (size.Y + 1) / 2
+}
+
+// convert writes the Y, Cb and Cr planes of the image to buf, of which the
+// rows are stored from top to bottom.
+func (f Y4MFormat) convert(buf []byte, img image.Image) {
+	b := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+	}
+	w, h := b.Dx(), b.Dy()
+	cw, ch := f.chromaSize(b.Size())
+	toYCbCr := color.RGBToYCbCr
+	if f.Color != nil {
+		kr, kb := f.Color.lumaCoefficients()
+		toYCbCr = func(r, g, b uint8) (uint8, uint8, uint8) {
+			return rgbToYCbCr(r, g, b, kr, kb)
+		}
+	}
+	yPlane, cbPlane, crPlane := buf[:w*h], buf[w*h:w*h+cw*ch], buf[w*h+cw*ch:]
+
+	if f.Chroma444 {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := rgba.PixOffset(b.Min.X+x, b.Min.Y+y)
+				yPlane[y*w+x], cbPlane[y*w+x], crPlane[y*w+x] = toYCbCr(rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2])
+			}
+		}
+		return
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := rgba.PixOffset(b.Min.X+x, b.Min.Y+y)
+			yPlane[y*w+x], _, _ = toYCbCr(rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2])
+		}
+	}
+	// The chroma of each block of 2x2 pixels is that of their mean color.
+	// Blocks at the right and bottom edges of odd sizes are 1 pixel wide.
+	// The chroma lines of interlaced frames alternate between the fields, so
+	// each is subsampled from two lines of the same field.
+	rows := func(cy int) [2]int {
+		if f.FieldOrder == Progressive {
+			return [2]int{cy * 2, cy*2 + 1}
+		}
+		return [2]int{cy/2*4 + cy%2, cy/2*4 + cy%2 + 2}
+	}
+	for cy := 0; cy < ch; cy++ {
+		for cx := 0; cx < cw; cx++ {
+			var r, g, bl, n int
+			for _, y := range rows(cy) {
+				if y >= h {
+					continue
+				}
+				for x := cx * 2; x < cx*2+2 && x < w; x++ {
+					i := rgba.PixOffset(b.Min.X+x, b.Min.Y+y)
+					r += int(rgba.Pix[i])
+					g += int(rgba.Pix[i+1])
+					bl += int(rgba.Pix[i+2])
+					n++
+				}
+			}
+			_, cbPlane[cy*cw+cx], crPlane[cy*cw+cx] = toYCbCr(uint8((r+n/2)/n), uint8((g+n/2)/n), uint8((bl+n/2)/n))
+		}
+	}
+}
+
+// rgbToYCbCr converts a color to full range YCbCr with the weights of red and
+// blue in luma.
+func rgbToYCbCr(r, g, b uint8, kr, kb float64) (uint8, uint8, uint8) {
+	rf, gf, bf := float64(r), float64(g), float64(b)
+	y := kr*rf + (1-kr-kb)*gf + kb*bf
+	cb := 128 + (bf-y)/(2*(1-kb))
+	cr := 128 + (rf-y)/(2*(1-kr))
+	clamp := func(v float64) uint8 {
+		return uint8(math.Max(0, math.Min(255, math.Round(v))))
+	}
+	return clamp(y), clamp(cb), clamp(cr)
+}
+
+// y4mFrameRate expresses the frame rate of the interval as a fraction.
+// NTSC rates such as 29.97 fps are recognized as multiples of 1000/1001.
+func y4mFrameRate(interval time.Duration) (int, int) {
+	if interval <= 0 {
+		return 1, 1
+	}
+	fps := float64(time.Second) / float64(interval)
+	for _, den := range []int{1, 1001, 1000} {
+		num := int(math.Round(fps * float64(den)))
+		if math.Abs(float64(num)/float64(den)-fps) < fps*1e-5 {
+			return reduce(num, den)
+		}
+	}
+	return reduce(int(math.Round(fps*1000)), 1000)
+}
+
+func reduce(num, den int) (int, int) {
+	a, b := num, den
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return num / a, den / a
+}
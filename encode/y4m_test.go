@@ -0,0 +1,91 @@
+package encode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestY4MFrameRate(t *testing.T) {
+	for interval, expected := range map[time.Duration][2]int{
+		time.Second / 30: {30, 1},
+		33366700:         {30000, 1001},
+		time.Second * 2:  {1, 2},
+		0:                {1, 1},
+	} {
+		if num, den := y4mFrameRate(interval); num != expected[0] || den != expected[1] {
+			t.Errorf("%v: expected %d:%d, got %d:%d", interval, expected[0], expected[1], num, den)
+		}
+	}
+}
+
+func TestY4MEncodeAnimation(t *testing.T) {
+	stream := make(chan image.Image, 2)
+	for i := 0; i < 2; i++ {
+		frame := image.NewRGBA(image.Rect(0, 0, 3, 3))
+		frame.SetRGBA(0, 0, color.RGBA{255, 255, 255, 255})
+		stream <- frame
+	}
+	close(stream)
+
+	var buf bytes.Buffer
+	if err := (Y4MFormat{}).EncodeAnimation(&buf, stream, time.Second/25); err != nil {
+		t.Fatal(err)
+	}
+	header, err := buf.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header != "YUV4MPEG2 W3 H3 F25:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n" {
+		t.Fatalf("unexpected header: %q", header)
+	}
+	// Each frame has a 3x3 luma plane and two 2x2 chroma planes.
+	frames := strings.Split(buf.String(), "FRAME\n")
+	if len(frames) != 3 || frames[0] != "" || len(frames[1]) != 9+2*4 {
+		t.Fatalf("unexpected frames: %q", frames)
+	}
+	if y := frames[1][:3]; y != "\xff\x00\x00" {
+		t.Fatalf("unexpected luma: %q", y)
+	}
+}
+
+func TestY4MInterlaced(t *testing.T) {
+	// The lines of the top field are red, those of the bottom field blue.
+	frame := image.NewRGBA(image.Rect(0, 0, 2, 4))
+	for y := 0; y < 4; y++ {
+		c := color.RGBA{255, 0, 0, 255}
+		if y%2 == 1 {
+			c = color.RGBA{0, 0, 255, 255}
+		}
+		for x := 0; x < 2; x++ {
+			frame.SetRGBA(x, y, c)
+		}
+	}
+	stream := make(chan image.Image, 1)
+	stream <- frame
+	close(stream)
+
+	var buf bytes.Buffer
+	if err := (Y4MFormat{FieldOrder: TopFieldFirst}).EncodeAnimation(&buf, stream, time.Second/25); err != nil {
+		t.Fatal(err)
+	}
+	header, err := buf.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(header, " It ") {
+		t.Fatalf("expected the frames to be declared top field first: %q", header)
+	}
+	buf.ReadString('\n')
+	planes := buf.Bytes()
+	// The chroma lines are subsampled from each field separately, so they
+	// alternate between red and blue instead of mixing them.
+	_, redCb, _ := color.RGBToYCbCr(255, 0, 0)
+	_, blueCb, _ := color.RGBToYCbCr(0, 0, 255)
+	if cb := planes[8:10]; cb[0] != redCb || cb[1] != blueCb {
+		t.Fatalf("expected Cb %d and %d, got %v", redCb, blueCb, cb)
+	}
+}
@@ -0,0 +1,115 @@
+package glslsandbox
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// backbufferTexIndex is the texture unit the backbuffer sampler is bound to.
+const backbufferTexIndex = 0
+
+// GLSLSandbox implements a shader environment similar to the one on
+// glslsandbox.com.
+//
+// The shader sources are expected to define main() and declare the uniforms
+// they need. Shady will set the time, resolution, surfaceSize, mouse and
+// backbuffer uniforms when they are declared.
+type GLSLSandbox struct {
+	shaderSources []renderer.SourceFile
+	glslVersion   string
+	// plain indicates that the sources already contain a #version directive.
+	plain bool
+}
+
+// NewGLSLSandbox creates a GLSL Sandbox environment. A #version directive
+// for the specified GLSL version is inserted before the shader sources.
+func NewGLSLSandbox(shaderSources []renderer.SourceFile, glslVersion string) *GLSLSandbox {
+	return &GLSLSandbox{
+		shaderSources: shaderSources,
+		glslVersion:   glslVersion,
+	}
+}
+
+// NewPlain creates an environment that compiles the shader sources as-is.
+// The sources are responsible for declaring their own #version.
+//
+// The uniforms are the same as those of the GLSL Sandbox environment.
+func NewPlain(shaderSources []renderer.SourceFile, glslVersion string) *GLSLSandbox {
+	return &GLSLSandbox{
+		shaderSources: shaderSources,
+		glslVersion:   glslVersion,
+		plain:         true,
+	}
+}
+
+func (gs GLSLSandbox) Sources() (map[renderer.Stage][]renderer.Source, error) {
+	fragment := []renderer.Source{}
+	if !gs.plain {
+		fragment = append(fragment, renderer.SourceBuf(fmt.Sprintf("#version %s\n", gs.glslVersion)))
+	}
+	for _, s := range gs.shaderSources {
+		fragment = append(fragment, s)
+	}
+	return map[renderer.Stage][]renderer.Source{
+		renderer.StageVertex: {renderer.SourceBuf(fmt.Sprintf(`
+			#version %s
+			attribute vec3 vert;
+			void main(void) {
+				gl_Position = vec4(vert, 1.0);
+			}
+		`, gs.glslVersion))},
+		renderer.StageFragment: fragment,
+	}, nil
+}
+
+func (gs *GLSLSandbox) Setup(state renderer.RenderState) error {
+	return nil
+}
+
+func (gs GLSLSandbox) SubEnvironments() (map[string]renderer.SubEnvironment, error) {
+	return map[string]renderer.SubEnvironment{}, nil
+}
+
+func (gs GLSLSandbox) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms["time"]; ok {
+		gl.Uniform1f(loc.Location, float32(state.Time)/float32(time.Second))
+	}
+	if loc, ok := state.Uniforms["resolution"]; ok {
+		gl.Uniform2f(loc.Location, float32(state.CanvasWidth), float32(state.CanvasHeight))
+	}
+	if loc, ok := state.Uniforms["surfaceSize"]; ok {
+		gl.Uniform2f(loc.Location, float32(state.CanvasWidth), float32(state.CanvasHeight))
+	}
+	if loc, ok := state.Uniforms["mouse"]; ok {
+		if m := state.Mouse; m != nil {
+			gl.Uniform2f(loc.Location, m.X/float32(state.CanvasWidth), m.Y/float32(state.CanvasHeight))
+		} else {
+			gl.Uniform2f(loc.Location, 0.5, 0.5)
+		}
+	}
+	// The frame index is not part of GLSL Sandbox, but feedback and
+	// dithering shaders often need it. It may be declared as either an int
+	// or a float.
+	for _, name := range []string{"frame", "iFrame"} {
+		if loc, ok := state.Uniforms[name]; ok {
+			if loc.Type == gl.INT {
+				gl.Uniform1i(loc.Location, int32(state.FramesProcessed))
+			} else {
+				gl.Uniform1f(loc.Location, float32(state.FramesProcessed))
+			}
+		}
+	}
+	if loc, ok := state.Uniforms["backbuffer"]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + backbufferTexIndex)
+		gl.BindTexture(gl.TEXTURE_2D, state.PreviousFrameTexID())
+		gl.Uniform1i(loc.Location, backbufferTexIndex)
+	}
+}
+
+func (gs *GLSLSandbox) Close() error {
+	return nil
+}
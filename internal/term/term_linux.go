@@ -0,0 +1,30 @@
+// Package term configures the terminal from which shady reads keys.
+package term
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Unbuffer disables line buffering and echoing of a terminal, so keys
+// can be read as they are pressed. Signals such as ^C keep working. Nothing is
+// done if the file is not a terminal.
+func Unbuffer(f *os.File) (restore func(), err error) {
+	fd := int(f.Fd())
+	orig, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		// Not a terminal.
+		return func() {}, nil
+	}
+	raw := *orig
+	raw.Lflag &^= unix.ICANON | unix.ECHO
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return func() {
+		unix.IoctlSetTermios(fd, unix.TCSETS, orig)
+	}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package term
+
+import (
+	"os"
+)
+
+// Unbuffer is only supported on Linux. Elsewhere, keys are read once
+// enter is pressed.
+func Unbuffer(f *os.File) (restore func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,181 @@
+//go:build cuda
+
+// Package cuda shares the frames of shaders with CUDA, so ML and vision
+// pipelines can consume them on the GPU without reading them back to the CPU,
+// e.g. to feed generated imagery into inference.
+//
+// It requires the CUDA toolkit and the shader to render on an NVIDIA GPU,
+// which is the case with the device EGL platform on systems with the NVIDIA
+// driver. The package is only built with the cuda build tag, and the
+// directories of the toolkit are set with CGO_CFLAGS and CGO_LDFLAGS.
+package cuda
+
+// #cgo LDFLAGS: -lcudart
+// #include <cuda_runtime.h>
+// #include <cuda_gl_interop.h>
+import "C"
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// A Texture is an OpenGL texture that is registered with CUDA. Frames are
+// copied into it on the GPU, as registering a texture is too slow to do for
+// every frame.
+//
+// Except for CopyToDevice, its methods must be called on the rendering thread
+// of the shader, e.g. from a frame hook.
+type Texture struct {
+	width, height int
+	float         bool
+	texture, fbo  uint32
+	resource      C.cudaGraphicsResource_t
+}
+
+// NewTexture creates and registers a texture. If float is set, it holds
+// 32-bit floats per channel like the frames of shaders with float precision,
+// otherwise bytes.
+func NewTexture(width, height int, float bool) (*Texture, error) {
+	t := &Texture{width: width, height: height, float: float}
+	internalFormat, xtype := int32(gl.RGBA8), uint32(gl.UNSIGNED_BYTE)
+	if float {
+		internalFormat, xtype = gl.RGBA32F, gl.FLOAT
+	}
+	gl.GenTextures(1, &t.texture)
+	gl.BindTexture(gl.TEXTURE_2D, t.texture)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, int32(width), int32(height), 0, gl.RGBA, xtype, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.GenFramebuffers(1, &t.fbo)
+
+	resource := (**C.struct_cudaGraphicsResource)(unsafe.Pointer(&t.resource))
+	err := check(C.cudaGraphicsGLRegisterImage(resource, C.GLuint(t.texture), gl.TEXTURE_2D, C.cudaGraphicsRegisterFlagsReadOnly))
+	if err != nil {
+		gl.DeleteFramebuffers(1, &t.fbo)
+		gl.DeleteTextures(1, &t.texture)
+		return nil, fmt.Errorf("error registering texture: %w", err)
+	}
+	return t, nil
+}
+
+// CopyFrom copies a texture of the same size and precision into the texture,
+// such as the one returned by renderer.Frame.Texture.
+func (t *Texture) CopyFrom(texture uint32) {
+	var prev int32
+	gl.GetIntegerv(gl.READ_FRAMEBUFFER_BINDING, &prev)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, t.fbo)
+	gl.FramebufferTexture2D(gl.READ_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, texture, 0)
+	gl.BindTexture(gl.TEXTURE_2D, t.texture)
+	gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, int32(t.width), int32(t.height))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, uint32(prev))
+}
+
+// Map makes the texture accessible to CUDA on the stream, which may be nil
+// for the default stream. It returns the cudaArray_t holding the pixels,
+// which can be read by kernels through a texture or surface object until
+// Unmap is called. OpenGL must not use the texture while it is mapped.
+func (t *Texture) Map(stream unsafe.Pointer) (unsafe.Pointer, error) {
+	if err := check(C.cudaGraphicsMapResources(1, &t.resource, C.cudaStream_t(stream))); err != nil {
+		return nil, fmt.Errorf("error mapping texture: %w", err)
+	}
+	var array C.cudaArray_t
+	if err := check(C.cudaGraphicsSubResourceGetMappedArray(&array, t.resource, 0, 0)); err != nil {
+		t.Unmap(stream)
+		return nil, fmt.Errorf("error getting mapped array: %w", err)
+	}
+	return unsafe.Pointer(array), nil
+}
+
+// Unmap returns the texture to OpenGL after CUDA is done with it. Work on
+// the stream that was issued before is completed first.
+func (t *Texture) Unmap(stream unsafe.Pointer) error {
+	return check(C.cudaGraphicsUnmapResources(1, &t.resource, C.cudaStream_t(stream)))
+}
+
+// CopyToDevice copies the pixels of the mapped array returned by Map to
+// linear device memory with rows of pitch bytes, which is the layout most ML
+// frameworks expect of tensors. Rows are in the same order as in the images
+// sent by Animate.
+func (t *Texture) CopyToDevice(array, dst unsafe.Pointer, pitch int, stream unsafe.Pointer) error {
+	bytesPerPixel := 4
+	if t.float {
+		bytesPerPixel = 16
+	}
+	return check(C.cudaMemcpy2DFromArrayAsync(
+		dst, C.size_t(pitch),
+		C.cudaArray_const_t(array), 0, 0,
+		C.size_t(t.width*bytesPerPixel), C.size_t(t.height),
+		C.cudaMemcpyDeviceToDevice, C.cudaStream_t(stream),
+	))
+}
+
+// Close unregisters and deletes the texture.
+func (t *Texture) Close() error {
+	err := check(C.cudaGraphicsUnregisterResource(t.resource))
+	gl.DeleteFramebuffers(1, &t.fbo)
+	gl.DeleteTextures(1, &t.texture)
+	return err
+}
+
+// A Hook passes every frame of a shader to CUDA. Its Hook method should be
+// added to the shader with AddFrameHook.
+type Hook struct {
+	float   bool
+	stream  unsafe.Pointer
+	consume func(t *Texture, array unsafe.Pointer, frame *renderer.Frame) error
+	tex     *Texture
+}
+
+// NewHook creates a hook that calls consume with every frame while it is
+// mapped to the stream, which may be nil for the default stream. consume
+// should enqueue its work on the stream, e.g. by calling CopyToDevice, which
+// completes before the texture is used by OpenGL again. float must match the
+// precision of the shader.
+func NewHook(float bool, stream unsafe.Pointer, consume func(t *Texture, array unsafe.Pointer, frame *renderer.Frame) error) *Hook {
+	return &Hook{float: float, stream: stream, consume: consume}
+}
+
+func (h *Hook) Hook(frame *renderer.Frame) error {
+	size := frame.Image.Bounds().Size()
+	if h.tex != nil && (h.tex.width != size.X || h.tex.height != size.Y) {
+		h.tex.Close()
+		h.tex = nil
+	}
+	if h.tex == nil {
+		tex, err := NewTexture(size.X, size.Y, h.float)
+		if err != nil {
+			return err
+		}
+		h.tex = tex
+	}
+	h.tex.CopyFrom(frame.Texture())
+	array, err := h.tex.Map(h.stream)
+	if err != nil {
+		return err
+	}
+	err = h.consume(h.tex, array, frame)
+	if unmapErr := h.tex.Unmap(h.stream); err == nil {
+		err = unmapErr
+	}
+	return err
+}
+
+// Close releases the texture of the hook. It must be called on the rendering
+// thread after the shader stopped animating.
+func (h *Hook) Close() error {
+	if h.tex == nil {
+		return nil
+	}
+	return h.tex.Close()
+}
+
+func check(err C.cudaError_t) error {
+	if err == C.cudaSuccess {
+		return nil
+	}
+	return fmt.Errorf("CUDA error: %s", C.GoString(C.cudaGetErrorString(err)))
+}
@@ -0,0 +1,79 @@
+// Package interop delivers the frames of shaders to the images of Go game and
+// GUI libraries such as Ebiten and Fyne, without depending on them.
+//
+// Frames are passed through a renderer.LiveImage that is updated by a frame
+// hook. These libraries do not expose their OpenGL contexts, so textures can
+// not be shared with the context of shady and every frame is copied once in
+// memory.
+package interop
+
+import (
+	"image"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// An EbitenImage is implemented by *ebiten.Image.
+type EbitenImage interface {
+	Bounds() image.Rectangle
+	WritePixels(pixels []byte)
+}
+
+// Ebiten copies the frames of a LiveImage into Ebiten images.
+type Ebiten struct {
+	live    *renderer.LiveImage
+	version uint64
+}
+
+// NewEbiten creates an adapter for frames that are copied into live.
+func NewEbiten(live *renderer.LiveImage) *Ebiten {
+	return &Ebiten{live: live}
+}
+
+// Draw writes the current frame to dst if it has changed since the previous
+// call and reports whether it did so. It should be called from the Update or
+// Draw method of the ebiten.Game. Frames are skipped if their size differs
+// from that of dst.
+func (e *Ebiten) Draw(dst EbitenImage) bool {
+	version := e.live.Version()
+	if version == e.version {
+		return false
+	}
+	written := false
+	e.live.View(func(img *image.RGBA) {
+		if img.Rect.Size() != dst.Bounds().Size() {
+			return
+		}
+		dst.WritePixels(img.Pix)
+		written = true
+	})
+	e.version = version
+	return written
+}
+
+// A Refresher is implemented by the canvas objects of Fyne, such as
+// *canvas.Raster.
+type Refresher interface {
+	Refresh()
+}
+
+// Raster returns a function for canvas.NewRaster that returns a copy of the
+// current frame. The raster should be refreshed with RefreshOnUpdate:
+//
+//	raster := canvas.NewRaster(interop.Raster(live))
+//	interop.RefreshOnUpdate(live, raster)
+func Raster(live *renderer.LiveImage) func(w, h int) image.Image {
+	return func(w, h int) image.Image {
+		var frame *image.RGBA
+		live.View(func(img *image.RGBA) {
+			frame = image.NewRGBA(img.Rect)
+			copy(frame.Pix, img.Pix)
+		})
+		return frame
+	}
+}
+
+// RefreshOnUpdate refreshes obj whenever a frame is copied into live.
+func RefreshOnUpdate(live *renderer.LiveImage, obj Refresher) {
+	live.OnUpdate(obj.Refresh)
+}
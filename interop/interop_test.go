@@ -0,0 +1,70 @@
+package interop
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type fakeEbitenImage struct {
+	rect   image.Rectangle
+	pixels []byte
+	writes int
+}
+
+func (img *fakeEbitenImage) Bounds() image.Rectangle { return img.rect }
+
+func (img *fakeEbitenImage) WritePixels(pixels []byte) {
+	img.pixels = append(img.pixels[:0], pixels...)
+	img.writes++
+}
+
+type counter int
+
+func (c *counter) Refresh() { *c++ }
+
+func TestEbiten(t *testing.T) {
+	live := renderer.NewLiveImage(2, 1)
+	e := NewEbiten(live)
+	dst := &fakeEbitenImage{rect: image.Rect(0, 0, 2, 1)}
+	if e.Draw(dst) {
+		t.Fatal("exp no write before the first frame")
+	}
+
+	frame := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	frame.SetRGBA(1, 0, color.RGBA{1, 2, 3, 4})
+	live.Update(frame)
+	if !e.Draw(dst) || dst.pixels[4] != 1 || dst.pixels[7] != 4 {
+		t.Fatalf("unexpected pixels: %v", dst.pixels)
+	}
+	if e.Draw(dst) || dst.writes != 1 {
+		t.Fatal("exp no write when the frame did not change")
+	}
+
+	// Frames of another size are skipped.
+	live.Update(image.NewRGBA(image.Rect(0, 0, 3, 3)))
+	if e.Draw(dst) {
+		t.Fatal("exp no write of a frame with another size")
+	}
+}
+
+func TestFyne(t *testing.T) {
+	live := renderer.NewLiveImage(1, 1)
+	var refreshes counter
+	RefreshOnUpdate(live, &refreshes)
+	raster := Raster(live)
+
+	frame := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	frame.SetRGBA(0, 0, color.RGBA{9, 9, 9, 255})
+	live.Update(frame)
+	if refreshes != 1 {
+		t.Fatalf("exp 1 refresh, got %d", refreshes)
+	}
+	img := raster(100, 100).(*image.RGBA)
+	live.Update(image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if c := img.RGBAAt(0, 0); c != (color.RGBA{9, 9, 9, 255}) {
+		t.Fatalf("exp the raster to be a copy, got %v", c)
+	}
+}
@@ -0,0 +1,302 @@
+// Package osc receives Open Sound Control messages over UDP, so shady can be
+// controlled from lighting desks, DAWs and apps such as TouchOSC.
+//
+// Messages and bundles of OSC 1.0 are supported, with arguments of the types
+// i (int32), f (float32), s (string), T (true) and F (false). The time tags
+// of bundles are ignored.
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strings"
+	"sync"
+)
+
+// A Message is an address with a list of arguments of type int32, float32,
+// string or bool.
+type Message struct {
+	Address string
+	Args    []interface{}
+}
+
+// Float returns argument i as a number.
+func (m Message) Float(i int) (float64, bool) {
+	if i >= len(m.Args) {
+		return 0, false
+	}
+	switch v := m.Args[i].(type) {
+	case int32:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Parse parses a message or a bundle of messages from a packet.
+func Parse(packet []byte) ([]Message, error) {
+	if bytes.HasPrefix(packet, []byte("#bundle\x00")) {
+		return parseBundle(packet)
+	}
+	msg, err := parseMessage(packet)
+	if err != nil {
+		return nil, err
+	}
+	return []Message{msg}, nil
+}
+
+func parseBundle(packet []byte) ([]Message, error) {
+	// Skip the "#bundle" string and the time tag.
+	if len(packet) < 16 {
+		return nil, errors.New("osc: truncated bundle")
+	}
+	var msgs []Message
+	for b := packet[16:]; len(b) > 0; {
+		if len(b) < 4 {
+			return nil, errors.New("osc: truncated bundle element")
+		}
+		size := binary.BigEndian.Uint32(b)
+		if size%4 != 0 || uint64(size) > uint64(len(b)-4) {
+			return nil, fmt.Errorf("osc: invalid bundle element size: %d", size)
+		}
+		elems, err := Parse(b[4 : 4+size])
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, elems...)
+		b = b[4+size:]
+	}
+	return msgs, nil
+}
+
+func parseMessage(packet []byte) (Message, error) {
+	address, rest, err := readString(packet)
+	if err != nil {
+		return Message{}, err
+	}
+	if !strings.HasPrefix(address, "/") {
+		return Message{}, fmt.Errorf("osc: invalid address: %q", address)
+	}
+	msg := Message{Address: address}
+	if len(rest) == 0 {
+		// Old implementations may omit the type tags of messages without
+		// arguments.
+		return msg, nil
+	}
+	tags, rest, err := readString(rest)
+	if err != nil {
+		return Message{}, err
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return Message{}, fmt.Errorf("osc: invalid type tags: %q", tags)
+	}
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i', 'f':
+			if len(rest) < 4 {
+				return Message{}, errors.New("osc: truncated argument")
+			}
+			v := binary.BigEndian.Uint32(rest)
+			if tag == 'i' {
+				msg.Args = append(msg.Args, int32(v))
+			} else {
+				msg.Args = append(msg.Args, math.Float32frombits(v))
+			}
+			rest = rest[4:]
+		case 's':
+			var s string
+			if s, rest, err = readString(rest); err != nil {
+				return Message{}, err
+			}
+			msg.Args = append(msg.Args, s)
+		case 'T', 'F':
+			msg.Args = append(msg.Args, tag == 'T')
+		default:
+			return Message{}, fmt.Errorf("osc: unsupported argument type: %q", tag)
+		}
+	}
+	return msg, nil
+}
+
+// readString reads a null terminated string padded to a multiple of 4 bytes.
+func readString(b []byte) (string, []byte, error) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, errors.New("osc: unterminated string")
+	}
+	end := (i + 4) &^ 3
+	if end > len(b) {
+		return "", nil, errors.New("osc: truncated string")
+	}
+	return string(b[:i]), b[end:], nil
+}
+
+// AppendMessage encodes a message, e.g. for sending it with a UDP socket.
+func AppendMessage(b []byte, msg Message) ([]byte, error) {
+	appendString := func(b []byte, s string) []byte {
+		b = append(b, s...)
+		return append(b, make([]byte, 4-len(s)%4)...)
+	}
+	tags := ","
+	var args []byte
+	for _, arg := range msg.Args {
+		var buf [4]byte
+		switch v := arg.(type) {
+		case int32:
+			tags += "i"
+			binary.BigEndian.PutUint32(buf[:], uint32(v))
+			args = append(args, buf[:]...)
+		case float32:
+			tags += "f"
+			binary.BigEndian.PutUint32(buf[:], math.Float32bits(v))
+			args = append(args, buf[:]...)
+		case string:
+			tags += "s"
+			args = appendString(args, v)
+		case bool:
+			if v {
+				tags += "T"
+			} else {
+				tags += "F"
+			}
+		default:
+			return nil, fmt.Errorf("osc: unsupported argument type: %T", arg)
+		}
+	}
+	b = appendString(b, msg.Address)
+	b = appendString(b, tags)
+	return append(b, args...), nil
+}
+
+// A Server receives messages on a UDP address and dispatches them to the
+// handlers of their address paths.
+type Server struct {
+	conn *net.UDPConn
+
+	lock     sync.Mutex
+	handlers map[string][]*handler
+}
+
+type handler struct {
+	fn func(Message)
+}
+
+var (
+	serversLock sync.Mutex
+	servers     = map[string]*sharedServer{}
+)
+
+type sharedServer struct {
+	*Server
+	refs int
+}
+
+// Listen starts receiving messages on a UDP address, e.g. ":9000".
+func Listen(address string) (*Server, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{conn: conn, handlers: map[string][]*handler{}}
+	go s.serve()
+	return s, nil
+}
+
+// Handle calls fn for every message with the OSC address path received on the
+// UDP address. Servers are shared by all handlers of an address and closed
+// once their last handler is removed. fn is called from a separate goroutine.
+func Handle(address, path string, fn func(Message)) (remove func(), err error) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	shared, ok := servers[address]
+	if !ok {
+		s, err := Listen(address)
+		if err != nil {
+			return nil, err
+		}
+		shared = &sharedServer{Server: s}
+		servers[address] = shared
+	}
+	shared.refs++
+	removeHandler := shared.Handle(path, fn)
+	return func() {
+		removeHandler()
+		serversLock.Lock()
+		defer serversLock.Unlock()
+		if shared.refs--; shared.refs == 0 {
+			delete(servers, address)
+			shared.Close()
+		}
+	}, nil
+}
+
+// Handle calls fn for every message with the address path. Paths are
+// matched exactly, patterns are not supported. The returned function removes
+// the handler.
+func (s *Server) Handle(path string, fn func(Message)) (remove func()) {
+	h := &handler{fn: fn}
+	s.lock.Lock()
+	s.handlers[path] = append(s.handlers[path], h)
+	s.lock.Unlock()
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		hs := s.handlers[path]
+		for i, e := range hs {
+			if e == h {
+				s.handlers[path] = append(hs[:i:i], hs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Addr returns the address the server receives messages on.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *Server) serve() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, _, err := s.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Printf("OSC: %v", err)
+			continue
+		}
+		msgs, err := Parse(buf[:n])
+		if err != nil {
+			log.Printf("OSC: %v", err)
+			continue
+		}
+		for _, msg := range msgs {
+			s.lock.Lock()
+			hs := append([]*handler(nil), s.handlers[msg.Address]...)
+			s.lock.Unlock()
+			for _, h := range hs {
+				h.fn(msg)
+			}
+		}
+	}
+}
+
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
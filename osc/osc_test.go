@@ -0,0 +1,76 @@
+package osc
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	msg := Message{Address: "/slides/page", Args: []interface{}{int32(3), float32(0.5), "hello", true}}
+	packet, err := AppendMessage(nil, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet)%4 != 0 {
+		t.Fatalf("packet is not padded: %d bytes", len(packet))
+	}
+	msgs, err := Parse(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msgs, []Message{msg}) {
+		t.Fatalf("unexpected messages: %#v", msgs)
+	}
+
+	next, _ := AppendMessage(nil, Message{Address: "/slides/next"})
+	bundle := append([]byte("#bundle\x00"), make([]byte, 8)...)
+	for _, elem := range [][]byte{packet, next} {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(elem)))
+		bundle = append(append(bundle, size[:]...), elem...)
+	}
+	msgs, err = Parse(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[1].Address != "/slides/next" {
+		t.Fatalf("unexpected messages: %#v", msgs)
+	}
+
+	for _, invalid := range [][]byte{[]byte("/abc"), []byte("abc\x00"), []byte("/a\x00\x00,i\x00\x00")} {
+		if _, err := Parse(invalid); err == nil {
+			t.Fatalf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	received := make(chan Message, 1)
+	remove, err := Handle("127.0.0.1:0", "/next", func(msg Message) { received <- msg })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remove()
+	addr := servers["127.0.0.1:0"].Addr()
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, address := range []string{"/other", "/next"} {
+		packet, _ := AppendMessage(nil, Message{Address: address, Args: []interface{}{int32(1)}})
+		conn.Write(packet)
+	}
+	select {
+	case msg := <-received:
+		if v, ok := msg.Float(0); msg.Address != "/next" || !ok || v != 1 {
+			t.Fatalf("unexpected message: %#v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
@@ -0,0 +1,143 @@
+// Package plugin runs input sources and output sinks implemented by external
+// programs, so devices can be supported without modifying shady.
+//
+// Plugins are executables in the PATH named shady-source-NAME or
+// shady-sink-NAME. Sources are available to shaders as mappings in the NAME
+// namespace, e.g. "#pragma map iChannel0=NAME:VALUE", and sinks as the
+// output format NAME, e.g. "-ofmt NAME -o TARGET". Built in sources and sinks
+// take precedence over plugins with the same name.
+//
+// A source is started with the value of the mapping as its only argument, in
+// the directory of the shader that declared the mapping. It writes frames to
+// its standard output whenever it has a new image. Shady uses the latest
+// frame, so sources do not need to match the frame rate of shady.
+//
+// A sink is started with the target as its only argument and the environment
+// variables SHADY_WIDTH, SHADY_HEIGHT and SHADY_INTERVAL (in seconds, 0 for a
+// single image). It reads frames from its standard input until it is closed,
+// after which it should exit. Shady waits for it to do so.
+//
+// Frames are sent as a line of text followed by the pixels:
+//
+//	frame WIDTH HEIGHT\n
+//	WIDTH*HEIGHT*4 bytes of RGBA, 8 bits per channel, rows from top to bottom
+//
+// The standard error of plugins and the standard output of sinks are written
+// to the writer passed to Discover.
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+const (
+	sourcePrefix = "shady-source-"
+	sinkPrefix   = "shady-sink-"
+	// maxFrameSize limits the size of the frames read from sources.
+	maxFrameSize = 16384
+)
+
+// Discover registers the sources and sinks of the plugins found in the PATH.
+// The diagnostics of the plugins are written to stderr, or discarded if it is
+// nil.
+func Discover(stderr io.Writer) {
+	sources := map[string]bool{}
+	for _, name := range shadertoy.ResourceTypes() {
+		sources[name] = true
+	}
+	sinks := map[string]bool{}
+	for _, name := range encode.Sinks() {
+		sinks[name] = true
+	}
+	for name := range encode.Formats {
+		sinks[name] = true
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			file := entry.Name()
+			if !strings.HasPrefix(file, sourcePrefix) && !strings.HasPrefix(file, sinkPrefix) {
+				continue
+			}
+			path := filepath.Join(dir, file)
+			if !isExecutable(path) {
+				continue
+			}
+			// Like exec.LookPath, the first match in the PATH is used.
+			if name := strings.TrimPrefix(file, sourcePrefix); name != file && name != "" && !sources[name] {
+				sources[name] = true
+				shadertoy.RegisterChannelSource(name, func(m shadertoy.Mapping) (shadertoy.ChannelSource, error) {
+					s, err := startSource(path, m.Value, m.PWD, stderr)
+					if err != nil {
+						return nil, err
+					}
+					return s, nil
+				})
+			}
+			if name := strings.TrimPrefix(file, sinkPrefix); name != file && name != "" && !sinks[name] {
+				sinks[name] = true
+				encode.RegisterSink(name, func(c encode.SinkConfig) (encode.Sink, error) {
+					s, err := startSink(path, c, stderr)
+					if err != nil {
+						return nil, err
+					}
+					return s, nil
+				})
+			}
+		}
+	}
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0
+}
+
+// WriteFrame writes an image in the format of the plugin protocol.
+func WriteFrame(w io.Writer, img image.Image) error {
+	rect := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Stride != 4*rect.Dx() {
+		rgba = image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, rect.Min, draw.Src)
+	}
+	if _, err := fmt.Fprintf(w, "frame %d %d\n", rect.Dx(), rect.Dy()); err != nil {
+		return err
+	}
+	_, err := w.Write(rgba.Pix[:4*rect.Dx()*rect.Dy()])
+	return err
+}
+
+// ReadFrame reads an image in the format of the plugin protocol.
+func ReadFrame(r *bufio.Reader) (*image.RGBA, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(line, "frame %d %d\n", &width, &height); err != nil {
+		return nil, fmt.Errorf("invalid frame header: %q", strings.TrimSpace(line))
+	}
+	if width <= 0 || height <= 0 || width > maxFrameSize || height > maxFrameSize {
+		return nil, fmt.Errorf("invalid frame size: %dx%d", width, height)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if _, err := io.ReadFull(r, img.Pix); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
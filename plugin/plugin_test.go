@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(2, 3, 5, 5))
+	img.Set(3, 4, color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "frame 3 2\n") {
+		t.Fatalf("unexpected header: %q", buf.String())
+	}
+	out, err := ReadFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Rect != image.Rect(0, 0, 3, 2) {
+		t.Fatalf("unexpected bounds: %v", out.Rect)
+	}
+	if c := out.RGBAAt(1, 1); c != (color.RGBA{R: 10, G: 20, B: 30, A: 255}) {
+		t.Fatalf("unexpected pixel: %v", c)
+	}
+}
+
+func TestReadFrameInvalid(t *testing.T) {
+	for _, input := range []string{
+		"hello\n",
+		"frame 0 10\n",
+		"frame 2 2\n\x00\x00",
+	} {
+		if _, err := ReadFrame(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Fatalf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestSourceCloseWaits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sourcePrefix+"sleep")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := startSource(path, "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if s.cmd.ProcessState == nil {
+		t.Fatal("the process was not waited for")
+	}
+}
@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// source is a ChannelSource backed by a plugin process.
+type source struct {
+	cmd  *exec.Cmd
+	name string
+
+	lock   sync.Mutex
+	latest *image.RGBA
+	err    error
+
+	waitOnce sync.Once
+	waitErr  error
+}
+
+func startSource(path, value, dir string, stderr io.Writer) (*source, error) {
+	cmd := exec.Command(path, value)
+	cmd.Dir = dir
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	s := &source{cmd: cmd, name: filepath.Base(path)}
+	go s.read(stdout)
+	return s, nil
+}
+
+func (s *source) read(stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+	for {
+		img, err := ReadFrame(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = s.wait()
+				if err == nil {
+					err = io.EOF
+				}
+			}
+			s.lock.Lock()
+			s.err = fmt.Errorf("%s: %w", s.name, err)
+			s.lock.Unlock()
+			return
+		}
+		s.lock.Lock()
+		s.latest = img
+		s.lock.Unlock()
+	}
+}
+
+func (s *source) Image(renderer.RenderState) (image.Image, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if img := s.latest; img != nil {
+		s.latest = nil
+		return img, nil
+	}
+	return nil, s.err
+}
+
+// wait waits for the process to exit. It may be called more than once and
+// from several goroutines.
+func (s *source) wait() error {
+	s.waitOnce.Do(func() {
+		s.waitErr = s.cmd.Wait()
+	})
+	return s.waitErr
+}
+
+func (s *source) Close() error {
+	// Sources run until they are stopped. The process is waited for so it
+	// does not linger as a zombie.
+	s.cmd.Process.Kill()
+	s.wait()
+	return nil
+}
+
+// sink is a Sink backed by a plugin process.
+type sink struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	w     *bufio.Writer
+}
+
+func startSink(path string, c encode.SinkConfig, stderr io.Writer) (*sink, error) {
+	cmd := exec.Command(path, c.Target)
+	cmd.Env = append(os.Environ(),
+		"SHADY_WIDTH="+strconv.Itoa(c.Width),
+		"SHADY_HEIGHT="+strconv.Itoa(c.Height),
+		"SHADY_INTERVAL="+strconv.FormatFloat(c.Interval.Seconds(), 'f', -1, 64),
+	)
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sink{cmd: cmd, stdin: stdin, w: bufio.NewWriter(stdin)}, nil
+}
+
+func (s *sink) Write(img image.Image) error {
+	if err := WriteFrame(s.w, img); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *sink) Close() error {
+	s.w.Flush()
+	s.stdin.Close()
+	return s.cmd.Wait()
+}
@@ -0,0 +1,113 @@
+package renderer
+
+import (
+	"image"
+	"math/rand"
+	"time"
+)
+
+// Accumulation configures a Shader to render multiple samples for each
+// output frame and average them. This enables progressive path tracing and
+// high quality motion blur.
+type Accumulation struct {
+	// Samples is the number of sub-frames rendered per output frame. Values
+	// of 0 and 1 disable accumulation.
+	Samples uint
+	// Shutter is the fraction of the frame interval over which the time of
+	// the samples is spread, like the shutter angle of a film camera. 0
+	// renders all samples at the same time, 1 spreads them over the whole
+	// interval.
+	Shutter float64
+}
+
+// offsets returns the time of each sample relative to the start of the frame.
+// The samples are stratified, each being jittered randomly within its own
+// part of the shutter interval.
+func (acc Accumulation) offsets(interval time.Duration) []time.Duration {
+	offsets := make([]time.Duration, acc.Samples)
+	for i := range offsets {
+		f := (float64(i) + rand.Float64()) / float64(acc.Samples)
+		offsets[i] = time.Duration(f * acc.Shutter * float64(interval))
+	}
+	return offsets
+}
+
+// jitter returns the subpixel offset of a sample in pixels, in the range of
+// -0.5..0.5. The offsets follow the Halton(2, 3) sequence, which covers the
+// area of a pixel evenly for any number of samples.
+func jitter(sample uint) [2]float32 {
+	return [2]float32{
+		float32(halton(sample+1, 2) - 0.5),
+		float32(halton(sample+1, 3) - 0.5),
+	}
+}
+
+func halton(i, base uint) float64 {
+	f, r := 1.0, 0.0
+	for ; i > 0; i /= base {
+		f /= float64(base)
+		r += f * float64(i%base)
+	}
+	return r
+}
+
+// accumulate renders all samples of the next frame and returns their
+// average.
+//
+// Rendering is not pipelined with reading back the images, so this is
+// considerably slower than rendering the same number of regular frames.
+func (sh *Shader) accumulate(interval time.Duration) image.Image {
+	offsets := sh.accumulation.offsets(interval)
+	var sum []uint32
+	var floatSum []float32
+	var last image.Image
+	for i, offset := range offsets {
+		sh.sample = uint(i)
+		sh.sampleOffset = offset
+		// Only advance the time after the last sample, the samples
+		// themselves are offset from the start of the frame.
+		advance := time.Duration(0)
+		if i == len(offsets)-1 {
+			advance = interval
+		}
+		handle := sh.nextHandle(interval, advance)
+		if handle == nil {
+			return nil
+		}
+		last = sh.renderer.Image(handle)
+		rgba := FrameRGBA(last)
+		if sum == nil {
+			sum = make([]uint32, len(rgba.Pix))
+		}
+		for j, v := range rgba.Pix {
+			sum[j] += uint32(v)
+		}
+		if hdr, ok := last.(*HDRImage); ok {
+			if floatSum == nil {
+				floatSum = make([]float32, len(hdr.Float))
+			}
+			for j, v := range hdr.Float {
+				floatSum[j] += v
+			}
+		}
+	}
+	sh.sample, sh.sampleOffset = 0, 0
+
+	avg := image.NewRGBA(FrameRGBA(last).Rect)
+	for j, v := range sum {
+		avg.Pix[j] = uint8((v + uint32(len(offsets))/2) / uint32(len(offsets)))
+	}
+	if layered, ok := last.(*LayeredImage); ok {
+		// Additional outputs can not be averaged meaningfully, so those of
+		// the last sample are used.
+		layered.RGBA = avg
+		return layered
+	}
+	if floatSum != nil {
+		for j := range floatSum {
+			floatSum[j] /= float32(len(offsets))
+		}
+		return &HDRImage{RGBA: avg, Float: floatSum}
+	}
+	return avg
+}
@@ -0,0 +1,21 @@
+package renderer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestJitter(t *testing.T) {
+	var sum [2]float32
+	for i := uint(0); i < 64; i++ {
+		j := jitter(i)
+		if j[0] < -0.5 || j[0] >= 0.5 || j[1] < -0.5 || j[1] >= 0.5 {
+			t.Fatalf("jitter of sample %d out of range: %v", i, j)
+		}
+		sum[0] += j[0]
+		sum[1] += j[1]
+	}
+	if math.Abs(float64(sum[0]/64)) > 0.02 || math.Abs(float64(sum[1]/64)) > 0.02 {
+		t.Fatalf("jitter is not centered: %v", sum)
+	}
+}
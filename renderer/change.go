@@ -0,0 +1,244 @@
+package renderer
+
+import (
+	"image"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// changeBlockSize is the width and height of the blocks of pixels of which
+// the difference is reduced to a single value on the GPU.
+const changeBlockSize = 16
+
+const changeFrag = SourceBuf(`#version 330 core
+	uniform sampler2D frame;
+	uniform sampler2D last;
+	uniform ivec4 region;
+	out vec4 color;
+
+	// The same as changeBlockSize.
+	const int blockSize = 16;
+
+	void main() {
+		ivec2 start = region.xy + ivec2(gl_FragCoord.xy) * blockSize;
+		ivec2 end = min(start + blockSize, region.zw);
+		float d = 0.0;
+		for (int y = start.y; y < end.y; y++) {
+			for (int x = start.x; x < end.x; x++) {
+				vec4 e = abs(texelFetch(frame, ivec2(x, y), 0) - texelFetch(last, ivec2(x, y), 0));
+				d = max(d, max(max(e.r, e.g), max(e.b, e.a)));
+			}
+		}
+		color = vec4(d);
+	}
+`)
+
+// A ChangeDetector drops frames that do not differ from the last frame that
+// was passed on by more than a threshold, e.g. to save bandwidth and prevent
+// LEDs from flickering when a shader is mostly static. Frames are compared on
+// the GPU, only the largest difference per block of 16x16 pixels is read
+// back. Its Hook method should be added to the shader with AddFrameHook.
+type ChangeDetector struct {
+	// Threshold is the largest difference of a color channel, in the range
+	// [0, 1], at which a frame is considered to be unchanged.
+	Threshold float32
+	// Region limits the comparison to a rectangle of the frame, the whole
+	// frame is compared if it is empty.
+	Region image.Rectangle
+	// Keepalive is the longest time of the animation for which frames are
+	// dropped, after which a frame is passed on regardless. Frames are
+	// dropped indefinitely if it is 0.
+	Keepalive time.Duration
+
+	program     uint32
+	vao, vbo    uint32
+	fbo         uint32
+	diff        uint32
+	last        uint32
+	size        image.Point
+	format      uint32
+	lastTime    time.Duration
+	hasLast     bool
+	skipped     uint64
+	frameLoc    int32
+	lastLoc     int32
+	regionLoc   int32
+	vertLoc     uint32
+	initialized bool
+}
+
+// Hook compares the frame to the last frame that was passed on and drops it
+// if it is unchanged.
+func (d *ChangeDetector) Hook(frame *Frame) error {
+	if !d.initialized {
+		if err := d.init(); err != nil {
+			return err
+		}
+	}
+	size := frame.Image.Bounds().Size()
+	var format int32
+	gl.BindTexture(gl.TEXTURE_2D, frame.Texture())
+	gl.GetTexLevelParameteriv(gl.TEXTURE_2D, 0, gl.TEXTURE_INTERNAL_FORMAT, &format)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	if size != d.size || uint32(format) != d.format {
+		d.allocate(size, uint32(format))
+	}
+	region := image.Rectangle{Max: size}
+	if !d.Region.Empty() {
+		region = d.Region.Intersect(region)
+	}
+
+	if d.hasLast && (d.Keepalive == 0 || frame.Time-d.lastTime < d.Keepalive) &&
+		d.difference(frame.Texture(), region) <= d.Threshold {
+		frame.Image = nil
+		d.skipped++
+		return nil
+	}
+
+	// Keep the frame to compare the next ones to.
+	defer restoreGLState()()
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, d.fbo)
+	gl.FramebufferTexture2D(gl.READ_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, frame.Texture(), 0)
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.BindTexture(gl.TEXTURE_2D, d.last)
+	gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, int32(size.X), int32(size.Y))
+	d.hasLast, d.lastTime = true, frame.Time
+	return nil
+}
+
+// Skipped returns the number of frames that were dropped.
+func (d *ChangeDetector) Skipped() uint64 {
+	return d.skipped
+}
+
+func (d *ChangeDetector) init() error {
+	program, err := linkProgram(map[Stage][]Source{
+		StageVertex:   {postPassVert},
+		StageFragment: {changeFrag},
+	})
+	if err != nil {
+		return err
+	}
+	d.program = program
+	d.frameLoc = gl.GetUniformLocation(program, gl.Str("frame\x00"))
+	d.lastLoc = gl.GetUniformLocation(program, gl.Str("last\x00"))
+	d.regionLoc = gl.GetUniformLocation(program, gl.Str("region\x00"))
+	d.vertLoc = uint32(gl.GetAttribLocation(program, gl.Str("vert\x00")))
+	d.vao, d.vbo = createGLQuad()
+	gl.GenFramebuffers(1, &d.fbo)
+	gl.GenTextures(1, &d.diff)
+	gl.GenTextures(1, &d.last)
+	d.initialized = true
+	return nil
+}
+
+// allocate sets the size of the differences of the blocks and the size and
+// internal format of the copy of the last frame, which must match those of
+// the frames.
+func (d *ChangeDetector) allocate(size image.Point, format uint32) {
+	d.size, d.format = size, format
+	d.hasLast = false
+	blocks := blockCount(size)
+	gl.BindTexture(gl.TEXTURE_2D, d.diff)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R32F, int32(blocks.X), int32(blocks.Y), 0, gl.RED, gl.FLOAT, nil)
+	gl.BindTexture(gl.TEXTURE_2D, d.last)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, int32(format), int32(size.X), int32(size.Y), 0, gl.RGBA, gl.FLOAT, nil)
+	for _, tex := range []uint32{d.diff, d.last} {
+		gl.BindTexture(gl.TEXTURE_2D, tex)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// difference returns the largest difference of a color channel between the
+// frame and the last frame in the region.
+func (d *ChangeDetector) difference(frame uint32, region image.Rectangle) float32 {
+	if region.Empty() {
+		return 0
+	}
+	defer restoreGLState()()
+	blocks := blockCount(region.Size())
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, d.fbo)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, d.diff, 0)
+	gl.DrawBuffer(gl.COLOR_ATTACHMENT0)
+	gl.Viewport(0, 0, int32(blocks.X), int32(blocks.Y))
+	gl.UseProgram(d.program)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, frame)
+	gl.Uniform1i(d.frameLoc, 0)
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, d.last)
+	gl.Uniform1i(d.lastLoc, 1)
+	gl.Uniform4i(d.regionLoc, int32(region.Min.X), int32(region.Min.Y), int32(region.Max.X), int32(region.Max.Y))
+	gl.BindVertexArray(d.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, d.vbo)
+	gl.EnableVertexAttribArray(d.vertLoc)
+	gl.VertexAttribPointer(d.vertLoc, 3, gl.FLOAT, false, 0, nil)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+
+	diffs := make([]float32, blocks.X*blocks.Y)
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 4)
+	gl.ReadPixels(0, 0, int32(blocks.X), int32(blocks.Y), gl.RED, gl.FLOAT, gl.Ptr(&diffs[0]))
+	var max float32
+	for _, v := range diffs {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// Close releases the OpenGL resources of the detector. It must be called on
+// the rendering thread after the shader stopped animating.
+func (d *ChangeDetector) Close() error {
+	if !d.initialized {
+		return nil
+	}
+	gl.DeleteProgram(d.program)
+	gl.DeleteVertexArrays(1, &d.vao)
+	gl.DeleteBuffers(1, &d.vbo)
+	gl.DeleteFramebuffers(1, &d.fbo)
+	gl.DeleteTextures(1, &d.diff)
+	gl.DeleteTextures(1, &d.last)
+	d.initialized = false
+	return nil
+}
+
+func blockCount(size image.Point) image.Point {
+	return image.Pt(
+		(size.X+changeBlockSize-1)/changeBlockSize,
+		(size.Y+changeBlockSize-1)/changeBlockSize,
+	)
+}
+
+// restoreGLState saves the state that is changed by hooks that draw, so they
+// do not interfere with the frames being rendered. The returned function
+// restores it.
+func restoreGLState() (restore func()) {
+	var drawFBO, readFBO, program, vao, vbo, texture, activeTexture int32
+	var viewport [4]int32
+	gl.GetIntegerv(gl.DRAW_FRAMEBUFFER_BINDING, &drawFBO)
+	gl.GetIntegerv(gl.READ_FRAMEBUFFER_BINDING, &readFBO)
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &program)
+	gl.GetIntegerv(gl.VERTEX_ARRAY_BINDING, &vao)
+	gl.GetIntegerv(gl.ARRAY_BUFFER_BINDING, &vbo)
+	gl.GetIntegerv(gl.ACTIVE_TEXTURE, &activeTexture)
+	gl.GetIntegerv(gl.VIEWPORT, &viewport[0])
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.GetIntegerv(gl.TEXTURE_BINDING_2D, &texture)
+	return func() {
+		gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, uint32(drawFBO))
+		gl.BindFramebuffer(gl.READ_FRAMEBUFFER, uint32(readFBO))
+		gl.UseProgram(uint32(program))
+		gl.BindVertexArray(uint32(vao))
+		gl.BindBuffer(gl.ARRAY_BUFFER, uint32(vbo))
+		gl.Viewport(viewport[0], viewport[1], viewport[2], viewport[3])
+		gl.ActiveTexture(gl.TEXTURE0)
+		gl.BindTexture(gl.TEXTURE_2D, uint32(texture))
+		gl.ActiveTexture(uint32(activeTexture))
+	}
+}
@@ -0,0 +1,154 @@
+package renderer
+
+import (
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// A CompareMode selects what the window of an OnScreenEngine shows while an
+// environment is compared, see SetCompareEnvironment.
+type CompareMode int
+
+const (
+	// CompareA shows the environment set with SetEnvironment.
+	CompareA CompareMode = iota
+	// CompareB shows the environment set with SetCompareEnvironment.
+	CompareB
+	// CompareSplit shows A on the left half and B on the right half.
+	CompareSplit
+)
+
+func (m CompareMode) String() string {
+	switch m {
+	case CompareB:
+		return "B"
+	case CompareSplit:
+		return "A|B"
+	default:
+		return "A"
+	}
+}
+
+// compareEnvironment is the environment that is compared with the current
+// one, along with its OpenGL state.
+type compareEnvironment struct {
+	env        Environment
+	subTargets map[string]*subTarget
+	program    uint32
+	uniforms   map[string]Uniform
+	vertLoc    uint32
+}
+
+// SetCompareEnvironment sets a second environment to compare with the one set
+// with SetEnvironment, e.g. to check that an optimized version of a shader
+// renders the same. Both are rendered at the same time, and SetCompareMode
+// selects which is shown. A nil environment stops comparing.
+//
+// Environments that read the previous frame receive the frame as shown, which
+// holds both environments while they are shown side by side.
+func (eng *OnScreenEngine) SetCompareEnvironment(env Environment) {
+	for {
+		select {
+		case eng.compareEnvs <- env:
+			return
+		default:
+			// Replace the environment that was not yet loaded.
+			select {
+			case prev := <-eng.compareEnvs:
+				if prev != nil {
+					prev.Close()
+				}
+			default:
+			}
+		}
+	}
+}
+
+// SetCompareMode selects what is shown while comparing environments. It may be
+// called from any goroutine.
+func (eng *OnScreenEngine) SetCompareMode(mode CompareMode) {
+	eng.actions <- func() { eng.setCompareMode(mode) }
+}
+
+func (eng *OnScreenEngine) setCompareMode(mode CompareMode) {
+	eng.compareMode = mode
+	eng.stale = true
+	eng.updateTitle()
+}
+
+// swapCompare exchanges the current environment with the one that is
+// compared, so the code that sets up and renders the current environment
+// applies to the compared one.
+func (eng *OnScreenEngine) swapCompare() {
+	c := eng.compare
+	eng.compare = compareEnvironment{eng.env, eng.subTargets, eng.program, eng.uniforms, eng.vertLoc}
+	eng.env, eng.subTargets, eng.program, eng.uniforms, eng.vertLoc = c.env, c.subTargets, c.program, c.uniforms, c.vertLoc
+}
+
+// reloadCompare sets up the environment to compare with, if a new one was
+// set.
+func (eng *OnScreenEngine) reloadCompare() {
+	var env Environment
+	select {
+	case env = <-eng.compareEnvs:
+	default:
+		return
+	}
+	eng.closeCompare()
+	eng.updateTitle()
+	if env == nil {
+		return
+	}
+	eng.swapCompare()
+	defer eng.swapCompare()
+	if err := eng.setupEnvironment(env); err != nil {
+		closeSubTargets(eng.subTargets)
+		env.Close()
+		eng.env, eng.subTargets, eng.program = nil, nil, 0
+		eng.log.Printf("Error loading environment to compare with: %v", err)
+	}
+}
+
+func (eng *OnScreenEngine) closeCompare() {
+	if eng.compare.env != nil {
+		loadedEnvironment{eng.compare.env, eng.compare.subTargets, eng.compare.program}.close()
+	}
+	eng.compare = compareEnvironment{}
+	eng.stale = true
+}
+
+// drawCompare renders the compared environment into the framebuffer over the
+// current one, as selected by the mode. state is that of the current
+// environment.
+func (eng *OnScreenEngine) drawCompare(fbo uint32, w, h int, state RenderState, interval time.Duration) {
+	if eng.compare.env == nil || eng.compareMode == CompareA {
+		return
+	}
+	eng.swapCompare()
+	defer eng.swapCompare()
+
+	state.Uniforms = eng.uniforms
+	state.SubBuffers = renderSubTargets(eng.subTargets, interval)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, fbo)
+	gl.Viewport(0, 0, int32(w), int32(h))
+	gl.BindVertexArray(eng.quadVAO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, eng.quadVBO)
+	if eng.compareMode == CompareSplit {
+		gl.Enable(gl.SCISSOR_TEST)
+		gl.Scissor(int32(w/2), 0, int32(w-w/2), int32(h))
+		defer gl.Disable(gl.SCISSOR_TEST)
+	}
+	gl.UseProgram(eng.program)
+	gl.EnableVertexAttribArray(eng.vertLoc)
+	gl.VertexAttribPointer(eng.vertLoc, 3, gl.FLOAT, false, 0, nil)
+	eng.stereo.draw(eng.env, state)
+
+	if eng.compareMode == CompareSplit {
+		// Divide the halves with a line.
+		gl.Scissor(int32(w/2), 0, 1, int32(h))
+		gl.ClearColor(1, 1, 1, 1)
+		gl.Clear(gl.COLOR_BUFFER_BIT)
+		gl.ClearColor(0, 0, 0, 0)
+	}
+}
@@ -18,18 +18,31 @@ func compileShader(stage Stage, sources ...Source) (uint32, error) {
 	}
 
 	originalSources := make([]string, len(sources))
+	filenames := make([]string, len(sources))
+	directives := make([][]lineDirective, len(sources))
+	starts := make([]int, len(sources))
 	src := ""
+	line := 1
 	for i, s := range sources {
-		c, err := s.Contents()
+		var c []byte
+		var err error
+		if sf, ok := s.(SourceFile); ok {
+			filenames[i] = sf.Filename
+			c, directives[i], err = sf.expand()
+		} else {
+			c, err = s.Contents()
+		}
 		if err != nil {
 			return 0, err
 		}
 		originalSources[i] = string(c)
-		if i != 0 {
-			src += fmt.Sprintf("#line 1 %d\n", i)
-		}
+		// The sources are concatenated without #line directives, as not all
+		// drivers report the source string numbers they set. Line numbers are
+		// mapped back to the sources using the line each one starts at.
+		starts[i] = line
 		src += string(c)
 		src += "\n\n"
+		line += strings.Count(string(c), "\n") + 2
 	}
 
 	shader := gl.CreateShader(glStage)
@@ -47,9 +60,12 @@ func compileShader(stage Stage, sources ...Source) (uint32, error) {
 		gl.GetShaderInfoLog(shader, logLen, nil, gl.Str(log))
 		gl.DeleteShader(shader)
 		return 0, CompileError{
-			sources: originalSources,
-			stage:   stage,
-			log:     log,
+			sources:    originalSources,
+			filenames:  filenames,
+			directives: directives,
+			starts:     starts,
+			stage:      stage,
+			log:        log,
 		}
 	}
 	return shader, nil
@@ -106,6 +122,15 @@ func linkProgram(sources map[Stage][]Source) (uint32, error) {
 
 type CompileError struct {
 	sources []string
+	// filenames holds the name of each source, or an empty string for
+	// sources that are not files.
+	filenames []string
+	// directives maps the lines of sources with #include directives to the
+	// files they were read from.
+	directives [][]lineDirective
+	// starts holds the line of the concatenated source at which each source
+	// starts.
+	starts []int
 
 	stage Stage
 	log   string
@@ -122,6 +147,8 @@ func (err CompileError) Error() string {
 	return buf.String()
 }
 
+// PrettyPrint writes the errors along with the lines of the source around
+// them. If the log of the driver could not be parsed, it is written as is.
 func (err CompileError) PrettyPrint(out io.Writer) {
 	markers := err.markers()
 	if len(markers) == 0 {
@@ -129,37 +156,163 @@ func (err CompileError) PrettyPrint(out io.Writer) {
 	}
 
 	for _, marker := range markers {
+		name, lineno := err.fileLine(marker.fileno, marker.lineno)
+		if name != "" {
+			fmt.Fprintf(out, "%s:%d:\n", name, lineno)
+		}
 		lines := strings.Split(err.sources[marker.fileno], "\n")
 		for i := marker.lineno - 2; i < marker.lineno+2; i++ {
-			if 0 <= i && i < len(lines) {
-				fmt.Fprintf(out, "%04d: %s\n", i+1, lines[i])
+			// Only show the lines around the error that are of the same file.
+			if lname, l := err.fileLine(marker.fileno, i+1); 0 <= i && i < len(lines) && lname == name {
+				fmt.Fprintf(out, "%04d: %s\n", l, lines[i])
 			}
 			if i+1 == marker.lineno {
-				fmt.Fprintf(out, "      ^ %s\n", marker.message)
+				fmt.Fprintf(out, "      %s^ %s\n", caretIndent(lines, i, marker.column), marker.message)
 			}
 		}
 	}
 }
 
-func (err CompileError) markers() []errorMarker {
-	errLineRe := regexp.MustCompile(`(?m)^(\d+):(\d+)\((\d+)\): (.+)$`)
+// caretIndent returns the whitespace that positions a caret below a column
+// of a line. Tabs are kept, so the caret lines up regardless of their width.
+func caretIndent(lines []string, i, column int) string {
+	if column < 1 || i < 0 || i >= len(lines) {
+		return ""
+	}
+	var indent strings.Builder
+	for j, c := range lines[i] {
+		if j >= column-1 {
+			break
+		}
+		if c == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	return indent.String()
+}
 
+// logFormats match the lines of the info logs of the compilers of different
+// drivers. Each has the named groups line and message, and optionally file,
+// column and severity.
+var logFormats = []*regexp.Regexp{
+	// Mesa: 0:12(5): error: `foo' undeclared
+	regexp.MustCompile(`(?m)^(?P<file>\d+):(?P<line>\d+)\((?P<column>\d+)\): (?P<severity>(?:preprocessor )?(?:error|warning)): (?P<message>.+)$`),
+	// NVIDIA: 0(12) : error C1008: undefined variable "foo"
+	regexp.MustCompile(`(?m)^(?P<file>\d+)\((?P<line>\d+)\) : (?P<severity>error|warning) (?P<message>.+)$`),
+	// ANGLE, AMD, Apple and glslang: ERROR: 0:12: 'foo' : undeclared identifier
+	regexp.MustCompile(`(?m)^(?P<severity>ERROR|WARNING): (?P<file>\d+):(?P<line>\d+): (?P<message>.+)$`),
+}
+
+func (err CompileError) markers() []errorMarker {
 	var markers []errorMarker
-	matches := errLineRe.FindAllStringSubmatch(err.log, -1)
-	for _, m := range matches {
-		fileno, _ := strconv.Atoi(m[1])
-		lineno, _ := strconv.Atoi(m[2])
-		message := m[4]
-
-		markers = append(markers, errorMarker{
-			fileno:  fileno,
-			lineno:  lineno,
-			message: message,
-		})
+	for _, re := range logFormats {
+		for _, m := range re.FindAllStringSubmatch(err.log, -1) {
+			marker := errorMarker{severity: "error"}
+			for i, name := range re.SubexpNames() {
+				switch name {
+				case "line":
+					marker.lineno, _ = strconv.Atoi(m[i])
+				case "column":
+					marker.column, _ = strconv.Atoi(m[i])
+				case "severity":
+					if strings.Contains(strings.ToLower(m[i]), "warning") {
+						marker.severity = "warning"
+					}
+				case "message":
+					marker.message = strings.TrimSpace(m[i])
+				}
+			}
+			marker.fileno, marker.lineno = err.sourceLine(marker.lineno)
+			markers = append(markers, marker)
+		}
+		if len(markers) > 0 {
+			break
+		}
 	}
 	return markers
 }
 
+// sourceLine maps a line of the concatenated source to the source it is in
+// and the line within that source.
+func (err CompileError) sourceLine(line int) (int, int) {
+	fileno := 0
+	for i, start := range err.starts {
+		if start <= line {
+			fileno = i
+		}
+	}
+	if len(err.starts) == 0 {
+		return 0, line
+	}
+	line -= err.starts[fileno] - 1
+	// Lines in the padding between sources are attributed to the last line
+	// of the source before it.
+	if n := strings.Count(err.sources[fileno], "\n") + 1; line > n {
+		line = n
+	}
+	return fileno, line
+}
+
+// fileLine maps a line of a source to the name of the file and the line it
+// was read from, which differ for lines of files included with #include.
+func (err CompileError) fileLine(fileno, line int) (string, int) {
+	if fileno < len(err.directives) && err.directives[fileno] != nil {
+		return resolveLine(err.directives[fileno], line)
+	}
+	return err.filenames[fileno], line
+}
+
+// Diagnostic is a single error reported by the shader compiler.
+type Diagnostic struct {
+	// Filename is the name of the source file the error is located in. It is
+	// empty if the source is not a file, e.g. code generated by an
+	// environment.
+	Filename string `json:"file,omitempty"`
+	// Line is the 1-based line number in the source.
+	Line int `json:"line,omitempty"`
+	// Column is the 1-based column in the line, if reported by the driver.
+	Column int `json:"column,omitempty"`
+	// Severity is either "error" or "warning".
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// Source is the line of the source the error is located in.
+	Source string `json:"source,omitempty"`
+}
+
+// Stage returns the pipeline stage that failed to compile.
+func (err CompileError) Stage() Stage {
+	return err.stage
+}
+
+// Log returns the raw info log of the compiler.
+func (err CompileError) Log() string {
+	return err.log
+}
+
+// Diagnostics returns the errors reported by the compiler.
+func (err CompileError) Diagnostics() []Diagnostic {
+	markers := err.markers()
+	diags := make([]Diagnostic, 0, len(markers))
+	for _, m := range markers {
+		d := Diagnostic{
+			Line:     m.lineno,
+			Column:   m.column,
+			Severity: m.severity,
+			Message:  m.message,
+		}
+		if m.fileno < len(err.filenames) {
+			d.Filename, d.Line = err.fileLine(m.fileno, m.lineno)
+			if lines := strings.Split(err.sources[m.fileno], "\n"); 0 < m.lineno && m.lineno <= len(lines) {
+				d.Source = lines[m.lineno-1]
+			}
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
 type LinkError struct {
 	log string
 }
@@ -169,7 +322,9 @@ func (err LinkError) Error() (str string) {
 }
 
 type errorMarker struct {
-	lineno  int
-	fileno  int
-	message string
+	lineno   int
+	column   int
+	fileno   int
+	severity string
+	message  string
 }
@@ -58,3 +58,66 @@ void main() {
 		t.Fatalf("Unexpected lineno")
 	}
 }
+
+func TestVersionedMultiFileMarkerPosition(t *testing.T) {
+	initTestGL(t)
+
+	source1 := SourceBuf(`#version 330
+// A bunch of text to offset the line number.
+`)
+	source2 := SourceBuf(`
+void main() {
+	gl_Position = undeclared;
+}
+`)
+
+	_, err := compileShader(StageVertex, source1, source2)
+	cerr := err.(CompileError)
+
+	t.Logf("\n%s\n", cerr.log)
+
+	m := cerr.markers()
+	if len(m) == 0 {
+		t.Fatalf("Expected at least one error marker")
+	}
+	if m[0].fileno != 1 {
+		t.Fatalf("Unexpected fileno: %d", m[0].fileno)
+	}
+	if m[0].lineno != 3 {
+		t.Fatalf("Unexpected lineno: %d", m[0].lineno)
+	}
+}
+
+func TestDriverLogFormats(t *testing.T) {
+	sources := []string{"#version 330\n", "void main() {\n\tfoo = 1;\n}\n"}
+	tests := []struct {
+		driver string
+		log    string
+		column int
+	}{
+		{"mesa", "0:4(2): error: `foo' undeclared\n", 2},
+		{"nvidia", "0(4) : error C1008: undefined variable \"foo\"\n", 0},
+		{"angle", "ERROR: 0:4: 'foo' : undeclared identifier\nERROR: 1 compilation errors.  No code generated.\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			cerr := CompileError{
+				sources:   sources,
+				filenames: []string{"", "main.glsl"},
+				starts:    []int{1, 3},
+				log:       tt.log,
+			}
+			diags := cerr.Diagnostics()
+			if len(diags) != 1 {
+				t.Fatalf("Expected one diagnostic, got %d", len(diags))
+			}
+			d := diags[0]
+			if d.Filename != "main.glsl" || d.Line != 2 || d.Column != tt.column || d.Severity != "error" {
+				t.Fatalf("Unexpected diagnostic: %+v", d)
+			}
+			if d.Source != "\tfoo = 1;" {
+				t.Fatalf("Unexpected source: %q", d.Source)
+			}
+		})
+	}
+}
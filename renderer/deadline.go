@@ -0,0 +1,52 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// A StallError is returned when a stage of setting up OpenGL did not complete
+// before the context passed to NewShaderContext or NewOnScreenEngineContext
+// was done.
+type StallError struct {
+	// Stage describes the step that stalled, e.g. "EGL display".
+	Stage string
+	Err   error
+}
+
+func (err *StallError) Error() string {
+	return fmt.Sprintf("setting up OpenGL stalled at the %s stage: %v", err.Stage, err.Err)
+}
+
+func (err *StallError) Unwrap() error {
+	return err.Err
+}
+
+// runStage calls fn, giving up once ctx is done.
+//
+// Calls into the driver can not be interrupted, so fn is called on a separate
+// thread which is abandoned if it stalls. The thread is terminated once fn
+// returns, so fn must not leave state bound to it that is needed afterwards,
+// such as a current context. If ctx can never be done, fn is called directly.
+func runStage(ctx context.Context, stage string, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return &StallError{Stage: stage, Err: err}
+	}
+	done := make(chan error, 1)
+	go func() {
+		// Not unlocking the thread makes the runtime terminate it when the
+		// goroutine exits.
+		runtime.LockOSThread()
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return &StallError{Stage: stage, Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,31 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunStage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	stall := make(chan struct{})
+	defer close(stall)
+	err := runStage(ctx, "window", func() error {
+		<-stall
+		return nil
+	})
+	var stallErr *StallError
+	if !errors.As(err, &stallErr) || stallErr.Stage != "window" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error does not wrap the context error: %v", err)
+	}
+
+	failed := errors.New("failed")
+	if err := runStage(context.Background(), "window", func() error { return failed }); err != failed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -3,6 +3,8 @@ package renderer
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"time"
@@ -55,24 +57,57 @@ func (s SourceBuf) Dir() string {
 // SourceFile is an implementation of the Source interface for real files.
 type SourceFile struct {
 	Filename string
+	// TemplateData is set to preprocess the file as a template, see
+	// ExecuteTemplate.
+	TemplateData interface{}
 }
 
 func SourceFiles(filenames ...string) []SourceFile {
+	return TemplateSourceFiles(nil, filenames...)
+}
+
+// TemplateSourceFiles is like SourceFiles, but preprocesses the files as
+// templates with the data if it is not nil.
+func TemplateSourceFiles(data interface{}, filenames ...string) []SourceFile {
 	sources := make([]SourceFile, len(filenames))
 	for i, f := range filenames {
-		sources[i] = SourceFile{Filename: f}
+		sources[i] = SourceFile{Filename: f, TemplateData: data}
 	}
 	return sources
 }
 
 // Contents implemetns the Source interface.
+//
+// The #include directives in the file are replaced with the contents of the
+// files they refer to, see IncludePaths.
 func (s SourceFile) Contents() ([]byte, error) {
-	fd, err := os.Open(s.Filename)
+	src, _, err := s.expand()
+	return src, err
+}
+
+// expand reads the file and resolves its #include directives. The returned
+// directives map the lines of the source to the files they were read from.
+func (s SourceFile) expand() ([]byte, []lineDirective, error) {
+	src, err := s.read(s.Filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return expandIncludes(s.Filename, src, s.read)
+}
+
+// read reads a file, preprocessing it as a template if the source has
+// template data.
+func (s SourceFile) read(filename string) ([]byte, error) {
+	fd, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer fd.Close()
-	return ioutil.ReadAll(fd)
+	src, err := ioutil.ReadAll(fd)
+	if err != nil || s.TemplateData == nil {
+		return src, err
+	}
+	return ExecuteTemplate(filename, src, s.TemplateData)
 }
 
 // Dir implemetns the Source interface.
@@ -110,11 +145,43 @@ type Environment interface {
 type SubEnvironment struct {
 	Environment
 	Width, Height uint
+
+	// RenderEvery is the number of frames between renders of the
+	// environment. In between, the output of the previous render is reused.
+	// Zero and one render every frame.
+	RenderEvery uint
+	// RenderOnce indicates that the environment only needs to be rendered
+	// for the first frame, e.g. because it precomputes a lookup table.
+	RenderOnce bool
+	// RenderOn lists uniforms of the shader at the root of the tree of
+	// environments. The environment is rendered again when a value set for
+	// one of them with SetUniform changes, e.g. to bake a lookup table again
+	// when a parameter is tweaked or a trigger is set. Unless RenderEvery is
+	// set as well, it is not rendered otherwise after the first frame.
+	RenderOn []string
+	// Scale is set for environments sized relative to the canvas of the
+	// environment declaring them. Width and Height are then recomputed with
+	// ScaleSize when the canvas is resized.
+	Scale float64
+	// ID identifies environments that produce the same output. If set,
+	// sub environments with the same ID that are declared anywhere in the
+	// tree of environments of a shader are rendered once per frame, and
+	// all environments declaring them sample the same texture.
+	ID string
+}
+
+// ScaleSize returns the size of a sub environment along one dimension of a
+// canvas, for a sub environment sized relative to it by scale. The size is at
+// least 1.
+func ScaleSize(canvasSize uint, scale float64) uint {
+	return uint(math.Max(1, math.Round(float64(canvasSize)*scale)))
 }
 
 type RenderState struct {
-	Time            time.Duration
-	Interval        time.Duration
+	Time     time.Duration
+	Interval time.Duration
+	// FramesProcessed is the index of the frame being rendered, starting at
+	// 0 for the first frame, including when rendering a single image.
 	FramesProcessed uint64
 
 	CanvasWidth  uint
@@ -126,4 +193,26 @@ type RenderState struct {
 	// SubBuffers contains the render output for each environment returned by
 	// SubEnvironments as a textureID.
 	SubBuffers map[string]uint32
+
+	// Sample is the index of the sample that is being rendered when
+	// multiple samples are accumulated per frame. Samples is the number of
+	// samples per frame, which is 1 if accumulation is disabled.
+	Sample, Samples uint
+	// Jitter is the subpixel offset of the sample in pixels, for
+	// antialiasing by accumulating samples. It is zero if accumulation is
+	// disabled.
+	Jitter [2]float32
+
+	// Eye is the view that is being rendered if the frame is rendered
+	// stereoscopically, nil otherwise. The canvas size is the size of the
+	// eye's view.
+	Eye *Eye
+
+	// Mouse is the state of the mouse, nil if there is no mouse input.
+	Mouse *Mouse
+
+	// Logger is the logger of the shader, to which environments should
+	// write errors that do not stop rendering, see Shader.SetLogger. It is
+	// set in all states passed to environments by shaders and engines.
+	Logger *log.Logger
 }
@@ -0,0 +1,85 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/polyfloyd/shady/egl"
+)
+
+// RenderTexture renders the next frame to a new texture without reading it
+// back to the CPU, for programs that process frames on the GPU themselves.
+// The animation advances by interval. The texture is an RGBA texture of the
+// size of the shader, which holds floats if SetFloatPrecision is enabled. It
+// belongs to the caller, who must release it by calling free.
+//
+// Frame hooks are not run for frames rendered with RenderTexture. Like
+// rendering with Animate, it must be called from the thread that created the
+// shader, which is also the thread on which the texture can be used. To use
+// it elsewhere, see ExportTexture.
+func (sh *Shader) RenderTexture(interval time.Duration) (texture uint32, free func(), err error) {
+	if err := sh.reloadEnvironment(context.Background()); err != nil {
+		return 0, nil, err
+	}
+	if sh.env == nil {
+		return 0, nil, fmt.Errorf("no environment is set")
+	}
+	handle := sh.nextHandle(interval, interval)
+	texture, free = sh.renderer.Texture(handle)
+	return texture, free, nil
+}
+
+// ExportTexture creates an EGLImage from a texture of the context of the
+// shaders, such as one returned by RenderTexture. The image can be bound to a
+// texture in other OpenGL contexts or imported by other APIs on the same EGL
+// display. The texture must not be deleted before the image is destroyed.
+func ExportTexture(texture uint32) (*egl.Image, error) {
+	if eglContext == nil {
+		return nil, fmt.Errorf("no shader has been created")
+	}
+	return eglContext.CreateTextureImage(texture)
+}
+
+// ExportDMABuf exports a texture of the context of the shaders, such as one
+// returned by RenderTexture, as a Linux dma-buf, which can be passed to other
+// processes. The file descriptors belong to the caller, who must close the
+// buffer once it has been handed off.
+//
+// modifiers lists the DRM format modifiers the consumer can import, e.g. as
+// advertised by a Wayland compositor. The layout of the texture is chosen by
+// the driver, so an error is returned if it is not one of them. If modifiers
+// is empty, any layout is accepted.
+func ExportDMABuf(texture uint32, modifiers []uint64) (*egl.DMABuf, error) {
+	img, err := ExportTexture(texture)
+	if err != nil {
+		return nil, err
+	}
+	// The buffer remains valid after the image is destroyed, as it is
+	// referenced by the file descriptors.
+	defer img.Destroy()
+	buf, err := img.ExportDMABuf()
+	if err != nil {
+		return nil, err
+	}
+	if len(modifiers) == 0 {
+		return buf, nil
+	}
+	for _, m := range modifiers {
+		if m == buf.Modifier {
+			return buf, nil
+		}
+	}
+	buf.Close()
+	return nil, fmt.Errorf("the texture is laid out with modifier %#x, which is not accepted by the consumer", buf.Modifier)
+}
+
+// DMABufModifiers returns the DRM format modifiers with which the driver of
+// the shaders can import dma-bufs of the format, which helps other processes
+// to pick the layout of buffers that they share.
+func DMABufModifiers(fourcc uint32) ([]uint64, error) {
+	if eglContext == nil {
+		return nil, fmt.Errorf("no shader has been created")
+	}
+	return eglContext.Display.DMABufModifiers(fourcc)
+}
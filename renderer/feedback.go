@@ -0,0 +1,42 @@
+package renderer
+
+import (
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// A feedbackFrame is a copy of a frame as rendered by the environment, which
+// it reads back as the previous frame. Post passes and overlays are applied to
+// the frame itself afterwards, so they do not end up in the next frames.
+type feedbackFrame struct {
+	tex   uint32
+	valid bool
+}
+
+// keep copies the color output of the bound framebuffer.
+func (f *feedbackFrame) keep(width, height uint, format uint32) {
+	if f.tex == 0 {
+		gl.GenTextures(1, &f.tex)
+		allocateFrameTexture(f.tex, width, height, format)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, f.tex)
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, int32(width), int32(height))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	f.valid = true
+}
+
+// texture returns the copy of the previous frame, or 0 if none was kept.
+func (f *feedbackFrame) texture() uint32 {
+	if !f.valid {
+		return 0
+	}
+	return f.tex
+}
+
+// close releases the copy, after which a copy of another size may be kept.
+func (f *feedbackFrame) close() {
+	if f.tex != 0 {
+		gl.DeleteTextures(1, &f.tex)
+	}
+	*f = feedbackFrame{}
+}
@@ -0,0 +1,232 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// FuzzOptions configures Fuzz.
+type FuzzOptions struct {
+	// Sizes is the number of random canvas sizes to render at. For each
+	// size, the environment is compiled again and Iterations frames are
+	// rendered with random uniform values.
+	Sizes, Iterations int
+	// MinSize and MaxSize bound the width and height of the canvas.
+	MinSize, MaxSize uint
+	// Min and Max bound the random values of uniforms. Besides random
+	// values in between, the bounds, 0, 1 and -1 are tried.
+	Min, Max float32
+	// Uniforms are the names of the uniforms to randomize. If empty, all
+	// float, int and bool uniforms of the program are randomized, except
+	// those listed in Exclude.
+	Uniforms, Exclude []string
+	// Seed seeds the random values, so a run can be reproduced.
+	Seed int64
+	// CheckNaN enables checking the color written by the shader for NaN
+	// and infinite values. The environment must write OutputColor as its
+	// only additional output.
+	CheckNaN bool
+	// Progress is called with each case before it is rendered. As a driver
+	// crash takes down the process, the last case reported is the one that
+	// crashed it.
+	Progress func(c FuzzCase)
+}
+
+// A FuzzCase holds the inputs of a single frame rendered by Fuzz.
+type FuzzCase struct {
+	Width    uint                 `json:"width"`
+	Height   uint                 `json:"height"`
+	Uniforms map[string][]float32 `json:"uniforms"`
+}
+
+// A FuzzFailure is a case for which rendering failed.
+type FuzzFailure struct {
+	FuzzCase
+	// GLError is the OpenGL error raised while rendering, if any.
+	GLError string `json:"gl_error,omitempty"`
+	// NaN and Inf are the number of pixels with a NaN or infinite value in
+	// any color channel.
+	NaN int `json:"nan"`
+	Inf int `json:"inf"`
+}
+
+func (f FuzzFailure) Error() string {
+	if f.GLError != "" {
+		return fmt.Sprintf("%dx%d: %s", f.Width, f.Height, f.GLError)
+	}
+	return fmt.Sprintf("%dx%d: %d NaN and %d infinite pixels", f.Width, f.Height, f.NaN, f.Inf)
+}
+
+// Fuzz renders the environments created by newEnv at random sizes and with
+// random values for their uniforms, to find the inputs for which a shader
+// misbehaves. The returned failures list the cases that raised OpenGL errors
+// or, if enabled, produced NaN or infinite colors.
+//
+// Only the uniforms of the main program are randomized, those of
+// sub-environments keep the values set by their environment. An error is
+// returned if the environment fails to load.
+func Fuzz(newEnv func() (Environment, error), glVersion OpenGLVersion, opts FuzzOptions) ([]FuzzFailure, error) {
+	if opts.MinSize == 0 || opts.MaxSize < opts.MinSize {
+		return nil, fmt.Errorf("invalid size range: %d..%d", opts.MinSize, opts.MaxSize)
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	var failures []FuzzFailure
+	for i := 0; i < opts.Sizes; i++ {
+		w, h := fuzzSize(rng, opts.MinSize, opts.MaxSize), fuzzSize(rng, opts.MinSize, opts.MaxSize)
+		f, err := fuzzAtSize(newEnv, glVersion, w, h, rng, opts)
+		failures = append(failures, f...)
+		if err != nil {
+			return failures, err
+		}
+	}
+	return failures, nil
+}
+
+func fuzzAtSize(newEnv func() (Environment, error), glVersion OpenGLVersion, w, h uint, rng *rand.Rand, opts FuzzOptions) ([]FuzzFailure, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+	sh, err := NewShader(w, h, glVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer sh.Close()
+	if opts.CheckNaN {
+		if err := sh.EnableOutputs(OutputColor); err != nil {
+			return nil, err
+		}
+	}
+	fenv := &fuzzEnvironment{Environment: env}
+	sh.SetEnvironment(fenv)
+	if err := sh.Load(context.Background()); err != nil {
+		return nil, err
+	}
+
+	names := fuzzUniforms(sh.uniforms, opts.Uniforms, opts.Exclude)
+	var failures []FuzzFailure
+	for i := 0; i < opts.Iterations; i++ {
+		c := FuzzCase{Width: w, Height: h, Uniforms: map[string][]float32{}}
+		for _, name := range names {
+			n, integer := sh.uniforms[name].components()
+			value := make([]float32, n)
+			for j := range value {
+				value[j] = fuzzValue(rng, opts.Min, opts.Max, integer)
+			}
+			c.Uniforms[name] = value
+		}
+		fenv.values = c.Uniforms
+		if opts.Progress != nil {
+			opts.Progress(c)
+		}
+
+		// Discard errors raised before the frame.
+		checkError()
+		handle := sh.nextHandle(time.Second/60, time.Second/60)
+		f := FuzzFailure{FuzzCase: c}
+		if err := checkError(); err != nil {
+			f.GLError = err.Error()
+		}
+		if handle != nil {
+			if img, ok := sh.renderer.Image(handle).(*LayeredImage); ok && img.Color != nil {
+				f.NaN, f.Inf = countNonFinite(img.Color, 4)
+			}
+		}
+		if f.GLError != "" || f.NaN > 0 || f.Inf > 0 {
+			failures = append(failures, f)
+		}
+	}
+	return failures, nil
+}
+
+// fuzzEnvironment overrides the uniforms set by an environment with the
+// values of the current case.
+type fuzzEnvironment struct {
+	Environment
+	values map[string][]float32
+}
+
+func (env *fuzzEnvironment) PreRender(state RenderState) {
+	env.Environment.PreRender(state)
+	for name, value := range env.values {
+		if u, ok := state.Uniforms[name]; ok {
+			u.set(value)
+		}
+	}
+}
+
+// fuzzUniforms returns the sorted names of the uniforms to randomize.
+func fuzzUniforms(uniforms map[string]Uniform, include, exclude []string) []string {
+	excluded := map[string]bool{}
+	for _, name := range exclude {
+		excluded[name] = true
+	}
+	var names []string
+	if len(include) > 0 {
+		for _, name := range include {
+			if u, ok := uniforms[name]; ok {
+				if n, _ := u.components(); n > 0 {
+					names = append(names, name)
+				}
+			}
+		}
+	} else {
+		for name, u := range uniforms {
+			if n, _ := u.components(); n > 0 && !excluded[name] {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fuzzSize returns a random dimension of the canvas. The bounds are picked
+// more often, as they are the most likely to reveal problems.
+func fuzzSize(rng *rand.Rand, min, max uint) uint {
+	switch rng.Intn(4) {
+	case 0:
+		return min
+	case 1:
+		return max
+	}
+	return min + uint(rng.Int63n(int64(max-min)+1))
+}
+
+// fuzzValue returns a random value in min..max, or one of the edge cases 0,
+// 1, -1, min and max.
+func fuzzValue(rng *rand.Rand, min, max float32, integer bool) float32 {
+	var v float32
+	if rng.Intn(4) == 0 {
+		v = []float32{0, 1, -1, min, max}[rng.Intn(5)]
+	} else {
+		v = min + rng.Float32()*(max-min)
+	}
+	if integer {
+		v = float32(math.Round(float64(v)))
+	}
+	return v
+}
+
+// countNonFinite counts the pixels with a NaN or infinite value in any of
+// their channels.
+func countNonFinite(data []float32, channels int) (nan, inf int) {
+	for i := 0; i+channels <= len(data); i += channels {
+		var hasNaN, hasInf bool
+		for _, v := range data[i : i+channels] {
+			hasNaN = hasNaN || math.IsNaN(float64(v))
+			hasInf = hasInf || math.IsInf(float64(v), 0)
+		}
+		if hasNaN {
+			nan++
+		}
+		if hasInf {
+			inf++
+		}
+	}
+	return nan, inf
+}
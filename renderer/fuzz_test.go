@@ -0,0 +1,51 @@
+package renderer
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+func TestCountNonFinite(t *testing.T) {
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	data := []float32{
+		0, 0, 0, 1,
+		nan, 0, nan, 1,
+		0, inf, 0, 1,
+		nan, -inf, 0, 1,
+	}
+	if n, i := countNonFinite(data, 4); n != 2 || i != 2 {
+		t.Fatalf("unexpected counts: %d NaN, %d Inf", n, i)
+	}
+}
+
+func TestFuzzValue(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		v := fuzzValue(rng, -10, 10, false)
+		if v < -10 || v > 10 {
+			t.Fatalf("value out of range: %v", v)
+		}
+		if v := fuzzValue(rng, -10, 10, true); v != float32(math.Round(float64(v))) {
+			t.Fatalf("integer value is not whole: %v", v)
+		}
+	}
+}
+
+func TestFuzzUniforms(t *testing.T) {
+	uniforms := map[string]Uniform{
+		"iTime":       {Name: "iTime", Type: gl.FLOAT},
+		"iResolution": {Name: "iResolution", Type: gl.FLOAT_VEC3},
+		"iFrame":      {Name: "iFrame", Type: gl.INT},
+		"iChannel0":   {Name: "iChannel0", Type: gl.SAMPLER_2D},
+	}
+	if names := fuzzUniforms(uniforms, nil, []string{"iResolution"}); !reflect.DeepEqual(names, []string{"iFrame", "iTime"}) {
+		t.Fatalf("unexpected uniforms: %v", names)
+	}
+	if names := fuzzUniforms(uniforms, []string{"iResolution", "iChannel0", "iMouse"}, nil); !reflect.DeepEqual(names, []string{"iResolution"}) {
+		t.Fatalf("unexpected uniforms: %v", names)
+	}
+}
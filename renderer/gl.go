@@ -2,7 +2,11 @@ package renderer
 
 import (
 	"fmt"
+	"io"
+	"log"
 	"runtime"
+	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
@@ -36,26 +40,232 @@ func (dm GLDebugMessage) String() string {
 	return fmt.Sprintf("[%s] %s", dm.SeverityString(), dm.Message)
 }
 
+// A DebugSeverity is the severity of an OpenGL debug message. Severities are
+// ordered, so messages can be filtered by a minimum severity.
+type DebugSeverity int
+
+const (
+	DebugNotification DebugSeverity = iota
+	DebugLow
+	DebugMedium
+	DebugHigh
+)
+
+// Level returns the severity of the message as a DebugSeverity.
+func (dm GLDebugMessage) Level() DebugSeverity {
+	switch dm.Severity {
+	case gl.DEBUG_SEVERITY_HIGH:
+		return DebugHigh
+	case gl.DEBUG_SEVERITY_MEDIUM:
+		return DebugMedium
+	case gl.DEBUG_SEVERITY_LOW:
+		return DebugLow
+	default:
+		return DebugNotification
+	}
+}
+
+// A DebugHandler receives the debug messages of OpenGL, see
+// Shader.SetDebugHandler. It is called from a goroutine of its own, one
+// message at a time.
+type DebugHandler func(GLDebugMessage)
+
+// DebugChannel returns a handler that sends the messages to ch. Messages are
+// dropped if ch is full, so a slow receiver does not hold up rendering.
+func DebugChannel(ch chan<- GLDebugMessage) DebugHandler {
+	return func(dm GLDebugMessage) {
+		select {
+		case ch <- dm:
+		default:
+		}
+	}
+}
+
+// DebugLogger returns a handler that writes the messages to l.
+func DebugLogger(l *log.Logger) DebugHandler {
+	return func(dm GLDebugMessage) {
+		l.Printf("OpenGL %s: %s", dm.SeverityString(), dm.Message)
+	}
+}
+
+// writerDebugHandler writes the messages along with the stack of the call
+// that raised them, as set with Shader.SetDebugOutput.
+func writerDebugHandler(w io.Writer) DebugHandler {
+	return func(dm GLDebugMessage) {
+		fmt.Fprintf(w, "OpenGL %s: %s\n", dm.SeverityString(), dm.Message)
+		fmt.Fprintf(w, "           %s\n", dm.Stack)
+	}
+}
+
+// GLDebugOutput enables debug output for the current OpenGL context and
+// returns a channel that receives its messages. The channel is never closed.
+//
+// Shaders and engines receive the messages themselves, see
+// Shader.SetDebugOutput and Shader.SetDebugHandler.
 func GLDebugOutput() <-chan GLDebugMessage {
-	ch := make(chan GLDebugMessage, 32)
+	debugOutput.install()
+	return debugOutput.subscribe()
+}
+
+// debugOutput distributes the debug messages of the OpenGL context to the
+// shaders and engines that use it.
+var debugOutput debugDispatcher
+
+type debugDispatcher struct {
+	mu   sync.Mutex
+	subs map[chan GLDebugMessage]struct{}
+}
+
+// install makes the dispatcher the receiver of the debug messages of the
+// current context.
+func (d *debugDispatcher) install() {
 	gl.Enable(gl.DEBUG_OUTPUT)
 	gl.DebugMessageControl(gl.DONT_CARE, gl.DONT_CARE, gl.DONT_CARE, 0, nil, true)
-	gl.DebugMessageCallback(func(source uint32, typ uint32, id uint32, severity uint32, length int32, message string, userParam unsafe.Pointer) {
-		dm := GLDebugMessage{
-			ID:       id,
-			Source:   source,
-			Type:     typ,
-			Severity: severity,
-			Message:  message,
-		}
-		var stack [8192]byte
-		stackLen := runtime.Stack(stack[:], false)
-		dm.Stack = string(stack[:stackLen])
+	gl.DebugMessageCallback(d.dispatch, nil)
+}
+
+func (d *debugDispatcher) dispatch(source uint32, typ uint32, id uint32, severity uint32, length int32, message string, userParam unsafe.Pointer) {
+	dm := GLDebugMessage{
+		ID:       id,
+		Source:   source,
+		Type:     typ,
+		Severity: severity,
+		Message:  message,
+	}
+	var stack [8192]byte
+	stackLen := runtime.Stack(stack[:], false)
+	dm.Stack = string(stack[:stackLen])
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for ch := range d.subs {
 		select {
 		case ch <- dm:
 		default:
 		}
-	}, nil)
+	}
+}
+
+func (d *debugDispatcher) subscribe() chan GLDebugMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.subs == nil {
+		d.subs = map[chan GLDebugMessage]struct{}{}
+	}
+	ch := make(chan GLDebugMessage, 32)
+	d.subs[ch] = struct{}{}
 	return ch
 }
+
+// unsubscribe stops sending messages to the channel and closes it.
+func (d *debugDispatcher) unsubscribe(ch chan GLDebugMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.subs, ch)
+	close(ch)
+}
+
+// A debugLog passes the debug messages of the OpenGL context of at least a
+// minimum severity to a handler until it is closed. By default, the messages
+// are discarded.
+type debugLog struct {
+	ch   chan GLDebugMessage
+	done chan struct{}
+
+	mu      sync.Mutex
+	handler DebugHandler
+	min     DebugSeverity
+}
+
+func newDebugLog() *debugLog {
+	l := &debugLog{
+		ch:   debugOutput.subscribe(),
+		done: make(chan struct{}),
+		min:  DebugLow,
+	}
+	go l.run()
+	return l
+}
+
+func (l *debugLog) run() {
+	defer close(l.done)
+	for dm := range l.ch {
+		l.mu.Lock()
+		if l.handler != nil && dm.Level() >= l.min {
+			l.handler(dm)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (l *debugLog) setOutput(w io.Writer) {
+	if w == nil {
+		l.setHandler(DebugLow, nil)
+		return
+	}
+	l.setHandler(DebugLow, writerDebugHandler(w))
+}
+
+func (l *debugLog) setHandler(min DebugSeverity, h DebugHandler) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handler, l.min = h, min
+}
+
+// close stops the log. No messages are written after it returns.
+func (l *debugLog) close() {
+	if l == nil {
+		return
+	}
+	debugOutput.unsubscribe(l.ch)
+	<-l.done
+}
+
+// checkError returns the errors flagged by OpenGL since the last check, if
+// any.
+func checkError() error {
+	var codes []string
+	for code := gl.GetError(); code != gl.NO_ERROR; code = gl.GetError() {
+		codes = append(codes, fmt.Sprintf("0x%04x", code))
+		if len(codes) >= 16 {
+			// Guard against implementations that keep reporting errors,
+			// such as when the context is lost.
+			break
+		}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return fmt.Errorf("OpenGL error %s", strings.Join(codes, ", "))
+}
+
+// Capabilities describes the OpenGL implementation of the current context.
+type Capabilities struct {
+	Vendor         string   `json:"vendor"`
+	Renderer       string   `json:"renderer"`
+	Version        string   `json:"version"`
+	GLSLVersion    string   `json:"glsl_version"`
+	MaxTextureSize int32    `json:"max_texture_size"`
+	Extensions     []string `json:"extensions"`
+}
+
+// QueryCapabilities reports on the OpenGL implementation of the current
+// context.
+func QueryCapabilities() Capabilities {
+	caps := Capabilities{
+		Vendor:      gl.GoStr(gl.GetString(gl.VENDOR)),
+		Renderer:    gl.GoStr(gl.GetString(gl.RENDERER)),
+		Version:     gl.GoStr(gl.GetString(gl.VERSION)),
+		GLSLVersion: gl.GoStr(gl.GetString(gl.SHADING_LANGUAGE_VERSION)),
+	}
+	gl.GetIntegerv(gl.MAX_TEXTURE_SIZE, &caps.MaxTextureSize)
+	var numExtensions int32
+	gl.GetIntegerv(gl.NUM_EXTENSIONS, &numExtensions)
+	for i := uint32(0); i < uint32(numExtensions); i++ {
+		caps.Extensions = append(caps.Extensions, gl.GoStr(gl.GetStringi(gl.EXTENSIONS, i)))
+	}
+	return caps
+}
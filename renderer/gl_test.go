@@ -0,0 +1,31 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+func TestDebugHandler(t *testing.T) {
+	ch := make(chan GLDebugMessage, 4)
+	l := newDebugLog()
+	l.setHandler(DebugMedium, DebugChannel(ch))
+	for _, severity := range []uint32{
+		gl.DEBUG_SEVERITY_NOTIFICATION,
+		gl.DEBUG_SEVERITY_LOW,
+		gl.DEBUG_SEVERITY_MEDIUM,
+		gl.DEBUG_SEVERITY_HIGH,
+	} {
+		l.ch <- GLDebugMessage{Severity: severity}
+	}
+	l.close()
+	close(ch)
+
+	var received []DebugSeverity
+	for dm := range ch {
+		received = append(received, dm.Level())
+	}
+	if len(received) != 2 || received[0] != DebugMedium || received[1] != DebugHigh {
+		t.Fatalf("unexpected messages: %v", received)
+	}
+}
@@ -0,0 +1,147 @@
+package renderer
+
+import (
+	"sync"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// loadedEnvironment is an environment that was set up, along with the OpenGL
+// state created for it.
+type loadedEnvironment struct {
+	env        Environment
+	subTargets map[string]*subTarget
+	program    uint32
+}
+
+func (l loadedEnvironment) close() {
+	l.env.Close()
+	closeSubTargets(l.subTargets)
+	gl.DeleteProgram(l.program)
+}
+
+// environmentHistory keeps the environments that were replaced, so they can be
+// rolled back to without loading them again. Environments are taken from the
+// history by any goroutine and restored by the rendering thread.
+type environmentHistory struct {
+	lock sync.Mutex
+	size int
+	envs []loadedEnvironment
+	// rollbacks holds the environments that were taken from the history
+	// until they are restored.
+	rollbacks chan loadedEnvironment
+}
+
+func (h *environmentHistory) setSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	h.size = size
+	h.rollbacks = make(chan loadedEnvironment, size)
+}
+
+// retire adds an environment that was replaced, closing the oldest one if the
+// history is full. It is closed right away if the history is disabled or if it
+// is a fallback environment, which is not worth restoring.
+func (h *environmentHistory) retire(l loadedEnvironment, fallback bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.size <= 0 || fallback {
+		l.close()
+		return
+	}
+	if len(h.envs) >= h.size {
+		h.envs[0].close()
+		h.envs = h.envs[1:]
+	}
+	h.envs = append(h.envs, l)
+}
+
+// rollback takes the most recent environment from the history to be restored.
+// It returns false if the history is empty.
+func (h *environmentHistory) rollback() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.envs) == 0 {
+		return false
+	}
+	select {
+	case h.rollbacks <- h.envs[len(h.envs)-1]:
+		h.envs = h.envs[:len(h.envs)-1]
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *environmentHistory) close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, l := range h.envs {
+		l.close()
+	}
+	h.envs = nil
+	for {
+		select {
+		case l := <-h.rollbacks:
+			l.close()
+		default:
+			return
+		}
+	}
+}
+
+// SetHistory makes the shader keep the last size environments that were
+// replaced by newer ones, so Rollback can restore them without loading them
+// again, e.g. to recover from a bad change during a live performance. The
+// environments keep their resources until they drop out of the history.
+// Fallback environments are not kept.
+//
+// It should be called before the first frame is rendered.
+func (sh *Shader) SetHistory(size int) {
+	sh.history.setSize(size)
+}
+
+// Rollback restores the environment that was replaced most recently, see
+// SetHistory. The current environment is closed. The rollback takes effect
+// from the next frame on. It returns false if there is no environment to roll
+// back to.
+func (sh *Shader) Rollback() bool {
+	return sh.history.rollback()
+}
+
+// restoreEnvironment closes the current environment, if any, and makes the
+// one taken from the history current.
+func (sh *Shader) restoreEnvironment(l loadedEnvironment) {
+	if sh.env != nil {
+		loadedEnvironment{env: sh.env, subTargets: sh.subTargets, program: sh.program}.close()
+	}
+	sh.env, sh.subTargets, sh.program, sh.fallbackActive = l.env, l.subTargets, l.program, false
+	gl.UseProgram(sh.program)
+	sh.uniforms = ListUniforms(sh.program)
+	sh.uniformValues.setUniforms(sh.uniforms)
+	sh.vertLoc = uint32(gl.GetAttribLocation(sh.program, gl.Str("vert\x00")))
+}
+
+// SetHistory makes the engine keep the environments that were replaced, see
+// Shader.SetHistory.
+func (eng *OnScreenEngine) SetHistory(size int) {
+	eng.history.setSize(size)
+}
+
+// Rollback restores the environment that was replaced most recently, see
+// Shader.Rollback.
+func (eng *OnScreenEngine) Rollback() bool {
+	return eng.history.rollback()
+}
+
+func (eng *OnScreenEngine) restoreEnvironment(l loadedEnvironment) {
+	if eng.env != nil {
+		loadedEnvironment{env: eng.env, subTargets: eng.subTargets, program: eng.program}.close()
+	}
+	eng.env, eng.subTargets, eng.program, eng.fallbackActive = l.env, l.subTargets, l.program, false
+	gl.UseProgram(eng.program)
+	eng.uniforms = ListUniforms(eng.program)
+	eng.vertLoc = uint32(gl.GetAttribLocation(eng.program, gl.Str("vert\x00")))
+	eng.stale = true
+}
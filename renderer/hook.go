@@ -0,0 +1,85 @@
+package renderer
+
+import (
+	"image"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// A Frame is a rendered frame as passed to frame hooks.
+type Frame struct {
+	// Image holds the pixels of the frame. Hooks may modify the image or
+	// replace it, the result is what is sent to the stream. Setting it to nil
+	// drops the frame.
+	Image image.Image
+	// Time is the time of the animation at which the frame was rendered.
+	Time time.Duration
+	// Number is the number of the frame, starting at 0.
+	Number uint64
+
+	texture     func() (uint32, func())
+	textureID   uint32
+	freeTexture func()
+}
+
+// Texture returns an OpenGL texture holding the frame as it was rendered. It
+// is created when first requested and deleted after all hooks have been
+// called, so it must not be used after the hook returns.
+func (f *Frame) Texture() uint32 {
+	if f.freeTexture == nil {
+		f.textureID, f.freeTexture = f.texture()
+	}
+	return f.textureID
+}
+
+// A FrameHook is called for every frame before it is sent to the stream of
+// Animate. Hooks run on the rendering thread with the OpenGL context current,
+// so slow hooks lower the frame rate. Errors are logged and the frame is sent
+// as is.
+type FrameHook func(frame *Frame) error
+
+// AddFrameHook adds a hook that is called for every frame rendered by
+// Animate. Hooks are called in the order in which they were added.
+func (sh *Shader) AddFrameHook(hook FrameHook) {
+	sh.frameHooks = append(sh.frameHooks, hook)
+}
+
+// runFrameHooks passes the frame through the hooks and returns the resulting
+// image, which is nil if the frame was dropped.
+func (sh *Shader) runFrameHooks(img image.Image, texture func() (uint32, func()), t time.Duration, number uint64) image.Image {
+	if len(sh.frameHooks) == 0 {
+		return img
+	}
+	frame := &Frame{Image: img, Time: t, Number: number, texture: texture}
+	for _, hook := range sh.frameHooks {
+		if err := hook(frame); err != nil {
+			sh.log.Printf("Error in frame hook: %v", err)
+		}
+		if frame.Image == nil {
+			break
+		}
+	}
+	if frame.freeTexture != nil {
+		frame.freeTexture()
+	}
+	return frame.Image
+}
+
+// imageTexture uploads an image to a new texture, for frames that are not
+// held by the renderer.
+func imageTexture(img image.Image) (uint32, func()) {
+	rgba := FrameRGBA(img)
+	var tex uint32
+	gl.GenTextures(1, &tex)
+	gl.BindTexture(gl.TEXTURE_2D, tex)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(rgba.Rect.Dx()), int32(rgba.Rect.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return tex, func() {
+		gl.DeleteTextures(1, &tex)
+	}
+}
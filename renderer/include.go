@@ -0,0 +1,135 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IncludePaths are the directories that are searched for files included with
+// #include "file.glsl" after the directory of the including file.
+var IncludePaths []string
+
+var ppHashIncludeRe = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*include[ \t]+"([^"]+)"[ \t]*(?://.*)?\r?$`)
+
+// A lineDirective states that the lines of a source expanded by
+// expandIncludes from line on are read from a file, starting at fileLine.
+type lineDirective struct {
+	line     int
+	filename string
+	fileLine int
+}
+
+// resolveLine maps a line of an expanded source to the file and line it was
+// read from.
+func resolveLine(directives []lineDirective, line int) (string, int) {
+	var d lineDirective
+	for _, dir := range directives {
+		if dir.line <= line {
+			d = dir
+		}
+	}
+	return d.filename, d.fileLine + line - d.line
+}
+
+// expandIncludes replaces the #include directives in the source read from
+// the file with the contents of the files they refer to, recursively. The
+// returned directives map the lines of the expanded source back to the files.
+//
+// Unlike "#pragma use", a file is included every time it is referred to,
+// like C does. Files that include themselves, directly or indirectly, are an
+// error. The "#pragma use" directives of the included files are kept, see
+// Includes for how they are resolved.
+func expandIncludes(filename string, src []byte, read func(string) ([]byte, error)) ([]byte, []lineDirective, error) {
+	var out bytes.Buffer
+	var directives []lineDirective
+	err := expandIncludesRecursive(&out, &directives, filename, src, read, nil)
+	return out.Bytes(), directives, err
+}
+
+func expandIncludesRecursive(out *bytes.Buffer, directives *[]lineDirective, filename string, src []byte, read func(string) ([]byte, error), stack []string) error {
+	stack = append(stack, filename)
+	line := bytes.Count(out.Bytes(), []byte("\n")) + 1
+	*directives = append(*directives, lineDirective{line: line, filename: filename, fileLine: 1})
+
+	lines := strings.SplitAfter(string(src), "\n")
+	for i, l := range lines {
+		m := ppHashIncludeRe.FindStringSubmatch(strings.TrimRight(l, "\n"))
+		if m == nil {
+			out.WriteString(l)
+			continue
+		}
+		included, err := resolveInclude(filename, m[1])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, i+1, err)
+		}
+		for _, f := range stack {
+			if f == included {
+				return fmt.Errorf("%s:%d: include cycle: %s -> %s", filename, i+1, strings.Join(stack, " -> "), included)
+			}
+		}
+		incSrc, err := read(included)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, i+1, err)
+		}
+		if err := expandIncludesRecursive(out, directives, included, incSrc, read, stack); err != nil {
+			return err
+		}
+		if out.Len() > 0 && out.Bytes()[out.Len()-1] != '\n' {
+			out.WriteByte('\n')
+		}
+		*directives = append(*directives, lineDirective{
+			line:     bytes.Count(out.Bytes(), []byte("\n")) + 1,
+			filename: filename,
+			fileLine: i + 2,
+		})
+	}
+	return nil
+}
+
+// resolveInclude finds the file referred to by an #include directive in the
+// including file. Relative paths are resolved against the directory of the
+// including file first and IncludePaths second.
+func resolveInclude(including, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name), nil
+	}
+	dirs := append([]string{filepath.Dir(including)}, IncludePaths...)
+	for _, dir := range dirs {
+		path, err := filepath.Abs(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("could not find included file %q in %s", name, strings.Join(dirs, ", "))
+}
+
+// IncludedFiles returns the files that are included with #include by the
+// specified files, recursively, e.g. to watch them for changes.
+func IncludedFiles(filenames ...string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return files, err
+		}
+		_, directives, err := expandIncludes(filename, src, os.ReadFile)
+		if err != nil {
+			return files, err
+		}
+		for _, d := range directives {
+			if d.filename != filename && !seen[d.filename] {
+				seen[d.filename] = true
+				files = append(files, d.filename)
+			}
+		}
+	}
+	return files, nil
+}
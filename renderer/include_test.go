@@ -0,0 +1,91 @@
+package renderer
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withIncludePaths(t *testing.T, paths ...string) {
+	prev := IncludePaths
+	IncludePaths = paths
+	t.Cleanup(func() { IncludePaths = prev })
+}
+
+func TestHashInclude(t *testing.T) {
+	withIncludePaths(t, "../testdata/preprocessor/lib")
+
+	src, err := SourceFile{Filename: "../testdata/preprocessor/hash-include.glsl"}.Contents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(src), "#include") {
+		t.Fatalf("include directives were not replaced:\n%s", src)
+	}
+	for _, fn := range []string{"float dep()", "float noise()", "float main2()"} {
+		if !strings.Contains(string(src), fn) {
+			t.Fatalf("expected %q in the expanded source:\n%s", fn, src)
+		}
+	}
+}
+
+func TestHashIncludeLineMapping(t *testing.T) {
+	withIncludePaths(t, "../testdata/preprocessor/lib")
+
+	_, directives, err := SourceFile{Filename: "../testdata/preprocessor/hash-include.glsl"}.expand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line     int
+		filename string
+		fileLine int
+	}{
+		{1, "hash-include-dep.glsl", 1},
+		{3, "hash-include-dep.glsl", 3},
+		{4, "noise.glsl", 1},
+		{6, "noise.glsl", 3},
+		{8, "hash-include.glsl", 3},
+		{10, "hash-include.glsl", 5},
+	}
+	for _, tt := range tests {
+		filename, fileLine := resolveLine(directives, tt.line)
+		if filepath.Base(filename) != tt.filename || fileLine != tt.fileLine {
+			t.Errorf("line %d: expected %s:%d, got %s:%d", tt.line, tt.filename, tt.fileLine, filename, fileLine)
+		}
+	}
+}
+
+func TestHashIncludeCycle(t *testing.T) {
+	_, err := SourceFile{Filename: "../testdata/preprocessor/hash-include-cycle-a.glsl"}.Contents()
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected an include cycle error, got %v", err)
+	}
+}
+
+func TestHashIncludeNotFound(t *testing.T) {
+	_, err := SourceFile{Filename: "../testdata/preprocessor/hash-include.glsl"}.Contents()
+	if err == nil || !strings.Contains(err.Error(), "hash-include.glsl:2:") {
+		t.Fatalf("expected the missing include to be reported, got %v", err)
+	}
+}
+
+func TestHashIncludeCompileError(t *testing.T) {
+	initTestGL(t)
+
+	_, err := compileShader(StageVertex,
+		SourceBuf("#version 330\n"),
+		SourceFile{Filename: "../testdata/preprocessor/hash-include-error.glsl"},
+	)
+	cerr, ok := err.(CompileError)
+	if !ok {
+		t.Fatalf("expected a compile error, got %v", err)
+	}
+	diags := cerr.Diagnostics()
+	if len(diags) == 0 {
+		t.Fatalf("expected at least one diagnostic:\n%s", cerr.log)
+	}
+	if filepath.Base(diags[0].Filename) != "hash-include-error-dep.glsl" || diags[0].Line != 2 {
+		t.Fatalf("unexpected location: %s:%d", diags[0].Filename, diags[0].Line)
+	}
+}
@@ -0,0 +1,138 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// maxZoom is the largest magnification of the preview window.
+const maxZoom = 64
+
+// A view is the part of the frame that is shown in the preview window. The
+// zero value shows the whole frame.
+type view struct {
+	// zoom is the magnification, a power of two. 0 is the same as 1.
+	zoom float64
+	// offset is the top left of the part that is shown, as a fraction of
+	// the size of the frame.
+	offset [2]float64
+	// panning is set while the view is dragged with the right mouse button,
+	// from the last position of the cursor.
+	panning    bool
+	panX, panY float64
+}
+
+func (v view) scale() float64 {
+	if v.zoom < 1 {
+		return 1
+	}
+	return v.zoom
+}
+
+// frameAt returns the position in the frame, as a fraction of its size, that
+// is shown at a position in the window, as a fraction of its size.
+func (v view) frameAt(x, y float64) (float64, float64) {
+	return v.offset[0] + x/v.scale(), v.offset[1] + y/v.scale()
+}
+
+// zoomAt changes the magnification by a number of steps, keeping the position
+// in the frame that is shown at x, y in the window in place.
+func (v *view) zoomAt(x, y float64, steps float64) {
+	fx, fy := v.frameAt(x, y)
+	v.zoom = math.Min(math.Max(v.scale()*math.Pow(2, math.Round(steps)), 1), maxZoom)
+	v.offset = [2]float64{fx - x/v.zoom, fy - y/v.zoom}
+	v.clamp()
+}
+
+// pan moves the view by a distance in the window, as a fraction of its size.
+func (v *view) pan(dx, dy float64) {
+	v.offset[0] -= dx / v.scale()
+	v.offset[1] -= dy / v.scale()
+	v.clamp()
+}
+
+// clamp keeps the view inside the frame.
+func (v *view) clamp() {
+	max := 1 - 1/v.scale()
+	for i := range v.offset {
+		v.offset[i] = math.Min(math.Max(v.offset[i], 0), max)
+	}
+}
+
+// windowPos returns the position of the cursor as a fraction of the size of
+// the window, from the top left.
+func (eng *OnScreenEngine) windowPos(x, y float64) (float64, float64) {
+	ww, wh := eng.window.GetSize()
+	if ww == 0 || wh == 0 {
+		return 0, 0
+	}
+	return x / float64(ww), y / float64(wh)
+}
+
+func (eng *OnScreenEngine) onScroll(win *glfw.Window, xoff, yoff float64) {
+	x, y := eng.windowPos(win.GetCursorPos())
+	eng.view.zoomAt(x, y, yoff)
+	eng.updateTitle()
+}
+
+// onPanButton starts or stops panning with the right mouse button.
+func (eng *OnScreenEngine) onPanButton(action glfw.Action) {
+	eng.view.panning = action == glfw.Press
+	eng.view.panX, eng.view.panY = eng.windowPos(eng.window.GetCursorPos())
+}
+
+// onPanCursor pans the view while the right mouse button is held.
+func (eng *OnScreenEngine) onPanCursor(x, y float64) {
+	if !eng.view.panning {
+		return
+	}
+	wx, wy := eng.windowPos(x, y)
+	eng.view.pan(wx-eng.view.panX, wy-eng.view.panY)
+	eng.view.panX, eng.view.panY = wx, wy
+}
+
+// inspectPixel shows the value of the pixel under the cursor in the title of
+// the window while zoomed in. The framebuffer holds the frame with the rows
+// in the order of an image.
+func (eng *OnScreenEngine) inspectPixel(fbo uint32, width, height int) {
+	if eng.view.scale() <= 1 {
+		return
+	}
+	fx, fy := eng.view.frameAt(eng.windowPos(eng.window.GetCursorPos()))
+	col, row := int(fx*float64(width)), int(fy*float64(height))
+	if col < 0 || row < 0 || col >= width || row >= height {
+		return
+	}
+	var pix [4]byte
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, fbo)
+	gl.ReadPixels(int32(col), int32(row), 1, 1, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(&pix[0]))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	// Pixels are reported from the bottom left, like gl_FragCoord.
+	eng.setTitle(fmt.Sprintf("%s %gx | %d, %d | R %d G %d B %d #%02x%02x%02x",
+		eng.baseTitle(), eng.view.scale(), col, height-1-row, pix[0], pix[1], pix[2], pix[0], pix[1], pix[2]))
+}
+
+// baseTitle returns the title of the window, which shows what is shown while
+// comparing environments.
+func (eng *OnScreenEngine) baseTitle() string {
+	if eng.compare.env == nil {
+		return "Shady"
+	}
+	return "Shady [" + eng.compareMode.String() + "]"
+}
+
+func (eng *OnScreenEngine) updateTitle() {
+	if eng.view.scale() <= 1 {
+		eng.setTitle(eng.baseTitle())
+	}
+}
+
+func (eng *OnScreenEngine) setTitle(title string) {
+	if title != eng.title {
+		eng.window.SetTitle(title)
+		eng.title = title
+	}
+}
@@ -0,0 +1,36 @@
+package renderer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	var v view
+	if x, y := v.frameAt(0.25, 0.75); x != 0.25 || y != 0.75 {
+		t.Fatalf("unexpected position without zoom: %v, %v", x, y)
+	}
+
+	// The position under the cursor stays in place.
+	v.zoomAt(0.5, 0.5, 2)
+	if v.zoom != 4 {
+		t.Fatalf("unexpected zoom: %v", v.zoom)
+	}
+	if x, y := v.frameAt(0.5, 0.5); math.Abs(x-0.5) > 1e-9 || math.Abs(y-0.5) > 1e-9 {
+		t.Fatalf("unexpected position under the cursor: %v, %v", x, y)
+	}
+
+	// The view does not leave the frame.
+	v.pan(4, -4)
+	if v.offset != [2]float64{0, 0.75} {
+		t.Fatalf("unexpected offset: %v", v.offset)
+	}
+	v.zoomAt(0, 0, 10)
+	if v.zoom != maxZoom {
+		t.Fatalf("unexpected zoom: %v", v.zoom)
+	}
+	v.zoomAt(0, 0, -10)
+	if v.zoom != 1 || v.offset != [2]float64{0, 0} {
+		t.Fatalf("unexpected view after zooming out: %v, %v", v.zoom, v.offset)
+	}
+}
@@ -0,0 +1,115 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+)
+
+// A LiveImage is a draw.Image that holds the most recent frame, so code that
+// is written against the image interfaces can consume the output of a
+// shader. It is safe for concurrent use.
+//
+// The pixels are updated in place, so readers that need a consistent frame,
+// e.g. to upload it to a GUI toolkit, should use View rather than At.
+type LiveImage struct {
+	lock     sync.RWMutex
+	rgba     *image.RGBA
+	version  uint64
+	onUpdate []func()
+}
+
+// NewLiveImage creates a transparent LiveImage of the specified size.
+func NewLiveImage(width, height int) *LiveImage {
+	return &LiveImage{rgba: image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+func (li *LiveImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (li *LiveImage) Bounds() image.Rectangle {
+	li.lock.RLock()
+	defer li.lock.RUnlock()
+	return li.rgba.Rect
+}
+
+func (li *LiveImage) At(x, y int) color.Color {
+	return li.RGBAAt(x, y)
+}
+
+func (li *LiveImage) RGBAAt(x, y int) color.RGBA {
+	li.lock.RLock()
+	defer li.lock.RUnlock()
+	return li.rgba.RGBAAt(x, y)
+}
+
+func (li *LiveImage) Set(x, y int, c color.Color) {
+	li.lock.Lock()
+	defer li.lock.Unlock()
+	li.rgba.Set(x, y, c)
+}
+
+// Update copies a frame into the image. The image is resized if the size of
+// the frame differs.
+func (li *LiveImage) Update(img image.Image) {
+	for _, fn := range li.update(img) {
+		fn()
+	}
+}
+
+// update copies the frame and returns the functions to call now that the
+// image is updated.
+func (li *LiveImage) update(img image.Image) []func() {
+	li.lock.Lock()
+	defer li.lock.Unlock()
+	b := img.Bounds()
+	if b.Size() != li.rgba.Rect.Size() {
+		li.rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	}
+	if src, ok := img.(*LayeredImage); ok {
+		img = src.RGBA
+	}
+	if src, ok := img.(*image.RGBA); ok && src.Stride == li.rgba.Stride {
+		copy(li.rgba.Pix, src.Pix[src.PixOffset(b.Min.X, b.Min.Y):])
+	} else {
+		draw.Draw(li.rgba, li.rgba.Rect, img, b.Min, draw.Src)
+	}
+	li.version++
+	return li.onUpdate
+}
+
+// OnUpdate registers a function that is called after every update of the
+// image, e.g. to refresh a widget. It is called from the goroutine that
+// updates the image, which is the rendering thread for frame hooks.
+func (li *LiveImage) OnUpdate(fn func()) {
+	li.lock.Lock()
+	defer li.lock.Unlock()
+	li.onUpdate = append(li.onUpdate, fn)
+}
+
+// View calls fn with the pixels of the current frame, which are not updated
+// until fn returns. The image must not be retained or modified by fn.
+func (li *LiveImage) View(fn func(img *image.RGBA)) {
+	li.lock.RLock()
+	defer li.lock.RUnlock()
+	fn(li.rgba)
+}
+
+// Version returns the number of frames that have been copied into the image,
+// so consumers can tell whether it has changed.
+func (li *LiveImage) Version() uint64 {
+	li.lock.RLock()
+	defer li.lock.RUnlock()
+	return li.version
+}
+
+// FrameHook returns a hook for Shader.AddFrameHook that copies every frame
+// into the image.
+func (li *LiveImage) FrameHook() FrameHook {
+	return func(frame *Frame) error {
+		li.Update(frame.Image)
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestLiveImage(t *testing.T) {
+	li := NewLiveImage(2, 2)
+	var _ draw.Image = li
+
+	frame := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	frame.SetRGBA(1, 1, color.RGBA{255, 0, 0, 255})
+	li.Update(frame)
+	if c := li.RGBAAt(1, 1); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Fatalf("unexpected color: %v", c)
+	}
+	if li.Version() != 1 {
+		t.Fatalf("unexpected version: %d", li.Version())
+	}
+
+	// Frames of another size resize the image.
+	gray := image.NewGray(image.Rect(4, 4, 7, 5))
+	gray.SetGray(6, 4, color.Gray{128})
+	li.Update(gray)
+	if b := li.Bounds(); b != image.Rect(0, 0, 3, 1) {
+		t.Fatalf("unexpected bounds: %v", b)
+	}
+	li.View(func(img *image.RGBA) {
+		if c := img.RGBAAt(2, 0); c != (color.RGBA{128, 128, 128, 255}) {
+			t.Fatalf("unexpected color: %v", c)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package renderer
+
+import (
+	"io"
+	"log"
+	"sync"
+)
+
+// A logOutput is the logger to which a shader writes its diagnostics. It is
+// shared by the shaders rendering its sub environments and overlays, so
+// changing it affects all of them.
+type logOutput struct {
+	mu sync.Mutex
+	l  *log.Logger
+}
+
+func newLogOutput() *logOutput {
+	return &logOutput{l: log.New(io.Discard, "", 0)}
+}
+
+func (o *logOutput) set(l *log.Logger) {
+	if l == nil {
+		l = log.New(io.Discard, "", 0)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.l = l
+}
+
+func (o *logOutput) logger() *log.Logger {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.l
+}
+
+func (o *logOutput) Printf(format string, v ...interface{}) {
+	o.logger().Printf(format, v...)
+}
+
+// SetLogger sets the logger to which the errors that do not stop the shader,
+// such as those of reloading the environment and of frame hooks, are written.
+// Environments receive it through RenderState.Logger. By default, and if nil,
+// the messages are discarded.
+//
+// Like SetDebugOutput, this applies to the shaders rendering the sub
+// environments and overlays as well. As both discard by default, a shader
+// that is embedded in an application does not write to the standard streams
+// of the process unless they are set to do so.
+func (sh *Shader) SetLogger(l *log.Logger) {
+	sh.log.set(l)
+}
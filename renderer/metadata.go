@@ -0,0 +1,69 @@
+package renderer
+
+import (
+	"context"
+	"image"
+	"time"
+)
+
+// FrameMetadata describes a frame sent by Animate, e.g. to mux frames with
+// other streams or to log how they were rendered.
+type FrameMetadata struct {
+	// Number is the number of the frame, starting at 0.
+	Number uint64
+	// Time is the time of the animation at which the frame was rendered.
+	Time time.Duration
+	// Uniforms holds the values that were set with SetUniform when the frame
+	// was rendered.
+	Uniforms map[string]interface{}
+	// Stats are the statistics of the shader when the frame was sent.
+	Stats Stats
+}
+
+// SetMetadataStream makes Animate send the metadata of every frame on ch
+// right before the frame itself is sent on its stream, so they can be
+// received in lockstep. Rendering blocks until the metadata is received.
+//
+// It should be called before Animate.
+func (sh *Shader) SetMetadataStream(ch chan<- FrameMetadata) {
+	sh.metadata = ch
+}
+
+// sendFrame sends a frame on the stream, preceded by its metadata if
+// enabled. It returns false if the context was canceled.
+func (sh *Shader) sendFrame(ctx context.Context, stream chan<- image.Image, img image.Image, number uint64, t time.Duration, uniforms map[string]interface{}) bool {
+	if sh.metadata != nil {
+		meta := FrameMetadata{
+			Number:   number,
+			Time:     t,
+			Uniforms: uniforms,
+			Stats:    sh.stats.get(),
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case sh.metadata <- meta:
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case stream <- img:
+		return true
+	}
+}
+
+// uniformSnapshot copies the values set with SetUniform if metadata is
+// enabled.
+func (sh *Shader) uniformSnapshot() map[string]interface{} {
+	if sh.metadata == nil {
+		return nil
+	}
+	sh.uniformValues.mu.Lock()
+	defer sh.uniformValues.mu.Unlock()
+	values := make(map[string]interface{}, len(sh.uniformValues.values))
+	for name, v := range sh.uniformValues.values {
+		values[name] = v
+	}
+	return values
+}
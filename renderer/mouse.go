@@ -0,0 +1,92 @@
+package renderer
+
+import (
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Mouse is the state of the mouse over the canvas, as set by the window of an
+// OnScreenEngine or with Shader.SetMouse. Positions are in pixels from the
+// bottom left corner.
+type Mouse struct {
+	// X and Y are the position of the cursor.
+	X, Y float32
+	// DragX and DragY are the position of the cursor when the button was
+	// last held down.
+	DragX, DragY float32
+	// ClickX and ClickY are the position at which the button was last
+	// pressed.
+	ClickX, ClickY float32
+	// Down is set while the button is held. Clicked is only set for the
+	// first frame after the button was pressed.
+	Down, Clicked bool
+}
+
+// SetMouse sets the state of the mouse for the next frames, e.g. to render
+// interactive shaders as if the cursor was dragged to a position. Clicked is
+// cleared after the next frame. It may be called from any goroutine.
+func (sh *Shader) SetMouse(m Mouse) {
+	for {
+		select {
+		case sh.mice <- m:
+			return
+		default:
+			// Replace the state that was not yet applied.
+			select {
+			case <-sh.mice:
+			default:
+			}
+		}
+	}
+}
+
+// applyMouse makes the state set by SetMouse available to the environments of
+// the tree before a frame is rendered.
+func (sh *Shader) applyMouse() {
+	select {
+	case m := <-sh.mice:
+		sh.shared.mouse = &m
+	default:
+		// A click only lasts a frame.
+		if sh.shared.mouse != nil && sh.shared.mouse.Clicked {
+			m := *sh.shared.mouse
+			m.Clicked = false
+			sh.shared.mouse = &m
+		}
+	}
+}
+
+func (eng *OnScreenEngine) onCursorPos(win *glfw.Window, x, y float64) {
+	eng.onPanCursor(x, y)
+	eng.mouse.X, eng.mouse.Y = eng.canvasPos(x, y)
+	if eng.mouse.Down {
+		eng.mouse.DragX, eng.mouse.DragY = eng.mouse.X, eng.mouse.Y
+	}
+}
+
+func (eng *OnScreenEngine) onMouseButton(win *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+	if button == glfw.MouseButtonRight {
+		eng.onPanButton(action)
+		return
+	}
+	if button != glfw.MouseButtonLeft {
+		return
+	}
+	switch action {
+	case glfw.Press:
+		m := &eng.mouse
+		m.Down, m.Clicked = true, true
+		m.ClickX, m.ClickY = m.X, m.Y
+		m.DragX, m.DragY = m.X, m.Y
+	case glfw.Release:
+		eng.mouse.Down = false
+	}
+}
+
+// canvasPos converts a position in the window, which is in screen
+// coordinates from the top left, to pixels of the canvas from the bottom
+// left. They differ on high DPI displays and while zoomed in.
+func (eng *OnScreenEngine) canvasPos(x, y float64) (float32, float32) {
+	fw, fh := eng.window.GetFramebufferSize()
+	fx, fy := eng.view.frameAt(eng.windowPos(x, y))
+	return float32(fx * float64(fw)), float32(float64(fh) - fy*float64(fh))
+}
@@ -0,0 +1,304 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// An Output is a value a shader can write for each pixel in addition to its
+// color.
+type Output int
+
+const (
+	// OutputDepth is the depth or distance of each pixel as a single float.
+	OutputDepth Output = iota
+	// OutputMotion is the motion of each pixel since the previous frame in
+	// pixels, as a vec2 with Y pointing up.
+	OutputMotion
+	// OutputColor is the color written by the shader as a vec4, before it is
+	// clamped and quantized to 8 bits. It reveals values that are out of
+	// range, NaN or infinite.
+	OutputColor
+)
+
+func (o Output) String() string {
+	switch o {
+	case OutputDepth:
+		return "depth"
+	case OutputMotion:
+		return "motion"
+	case OutputColor:
+		return "color"
+	}
+	return fmt.Sprintf("Output(%d)", int(o))
+}
+
+// Components returns the number of floats written per pixel.
+func (o Output) Components() int {
+	switch o {
+	case OutputMotion:
+		return 2
+	case OutputColor:
+		return 4
+	}
+	return 1
+}
+
+func (o Output) internalFormat() uint32 {
+	switch o {
+	case OutputMotion:
+		return gl.RG32F
+	case OutputColor:
+		return gl.RGBA32F
+	}
+	return gl.R32F
+}
+
+func (o Output) format() uint32 {
+	switch o {
+	case OutputMotion:
+		return gl.RG
+	case OutputColor:
+		return gl.RGBA
+	}
+	return gl.RED
+}
+
+// A LayeredImage is a rendered image along with the additional outputs of
+// the shader. Outputs which were not enabled are nil.
+type LayeredImage struct {
+	*image.RGBA
+	// Depth contains the depth value of each pixel as written by the
+	// shader, in the same order as the pixels of the image.
+	Depth []float32
+	// Motion contains the X and Y motion of each pixel.
+	Motion []float32
+	// Color contains the unclamped red, green, blue and alpha of each pixel.
+	Color []float32
+}
+
+func (img *LayeredImage) setOutput(output Output, data []float32) {
+	switch output {
+	case OutputDepth:
+		img.Depth = data
+	case OutputMotion:
+		img.Motion = data
+	case OutputColor:
+		img.Color = data
+	}
+}
+
+// An HDRImage is a rendered image along with the colors of its pixels at
+// floating point precision, as enabled with Shader.SetHDR. The embedded
+// image holds the colors clamped and quantized to 8 bits.
+type HDRImage struct {
+	*image.RGBA
+	// Float contains the unclamped red, green, blue and alpha of each pixel,
+	// in the same order as the pixels of the image.
+	Float []float32
+}
+
+// FloatData returns the unclamped colors of the image and the number of
+// values per pixel, which is always 4.
+func (img *HDRImage) FloatData() ([]float32, int) {
+	return img.Float, 4
+}
+
+// OutputImage returns the values of an output as a FloatImage, or nil if the
+// output was not enabled.
+func (img *LayeredImage) OutputImage(output Output) *FloatImage {
+	var data []float32
+	switch output {
+	case OutputDepth:
+		data = img.Depth
+	case OutputMotion:
+		data = img.Motion
+	case OutputColor:
+		data = img.Color
+	}
+	if data == nil {
+		return nil
+	}
+	return &FloatImage{Rect: img.Rect, Channels: output.Components(), Data: data}
+}
+
+// A FloatImage holds floating point values for each pixel, such as the depth
+// output of a shader. It can be written as a NumPy array or converted to a
+// matrix for further processing.
+//
+// As an image.Image, the first channel is shown as grayscale with values
+// clamped to 0..1.
+type FloatImage struct {
+	Rect image.Rectangle
+	// Channels is the number of values per pixel.
+	Channels int
+	// Data holds the values of the pixels in the same order as an image.RGBA.
+	Data []float32
+}
+
+func (img *FloatImage) ColorModel() color.Model {
+	return color.Gray16Model
+}
+
+func (img *FloatImage) Bounds() image.Rectangle {
+	return img.Rect
+}
+
+func (img *FloatImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return color.Gray16{}
+	}
+	return color.Gray16{Y: unorm16(float64(img.Value(x, y, 0)))}
+}
+
+// Value returns a channel of the pixel at x, y.
+func (img *FloatImage) Value(x, y, channel int) float32 {
+	i := (y-img.Rect.Min.Y)*img.Rect.Dx() + x - img.Rect.Min.X
+	return img.Data[i*img.Channels+channel]
+}
+
+// FloatData returns the values of the image and the number of values per
+// pixel.
+func (img *FloatImage) FloatData() ([]float32, int) {
+	return img.Data, img.Channels
+}
+
+// Gray16 converts the first channel of the image to grayscale, mapping values
+// from low to high onto black to white. Values outside of the range are
+// clamped.
+func (img *FloatImage) Gray16(low, high float32) *image.Gray16 {
+	gray := image.NewGray16(img.Rect)
+	for i := 0; i < len(img.Data)/img.Channels; i++ {
+		c := unorm16(float64((img.Data[i*img.Channels] - low) / (high - low)))
+		gray.Pix[i*2] = uint8(c >> 8)
+		gray.Pix[i*2+1] = uint8(c)
+	}
+	return gray
+}
+
+// Dense returns a channel of the image as a row-major matrix of float64 with
+// a row for each row of pixels. The result matches the arguments of
+// gonum's mat.NewDense, so a matrix is created with:
+//
+//	m := mat.NewDense(img.Dense(0))
+func (img *FloatImage) Dense(channel int) (rows, cols int, data []float64) {
+	rows, cols = img.Rect.Dy(), img.Rect.Dx()
+	data = make([]float64, rows*cols)
+	for i := range data {
+		data[i] = float64(img.Data[i*img.Channels+channel])
+	}
+	return rows, cols, data
+}
+
+// DepthImage converts the depth output to a grayscale image, mapping depth
+// values from near to far onto black to white. Values outside of the range are
+// clamped.
+func (img *LayeredImage) DepthImage(near, far float32) *image.Gray16 {
+	return (&FloatImage{Rect: img.Rect, Channels: 1, Data: img.Depth}).Gray16(near, far)
+}
+
+// MotionImage converts the motion output to an image. See EncodeMotion.
+func (img *LayeredImage) MotionImage(scale float32) *image.RGBA64 {
+	return EncodeMotion(img.Rect, img.Motion, scale)
+}
+
+// EncodeMotion converts motion vectors to an image that can be stored in
+// regular image formats. The X and Y motion are stored in the red and green
+// channels respectively, mapping -scale..scale pixels to 0..1. An absence of
+// motion is thus encoded as 0.5.
+func EncodeMotion(rect image.Rectangle, motion []float32, scale float32) *image.RGBA64 {
+	img := image.NewRGBA64(rect)
+	for i := 0; i < len(motion)/2; i++ {
+		x, y := rect.Min.X+i%rect.Dx(), rect.Min.Y+i/rect.Dx()
+		img.SetRGBA64(x, y, color.RGBA64{
+			R: unorm16(float64(motion[i*2]/scale)*0.5 + 0.5),
+			G: unorm16(float64(motion[i*2+1]/scale)*0.5 + 0.5),
+			B: 0,
+			A: math.MaxUint16,
+		})
+	}
+	return img
+}
+
+// EstimateMotion derives motion vectors from the difference between two
+// consecutive frames. It can be used for shaders that do not output motion
+// vectors themselves.
+//
+// The motion of each pixel is estimated using the Lucas-Kanade method, which
+// is only accurate for small movements in areas with a distinct texture.
+// Along edges, only the motion perpendicular to the edge is found. Where no
+// motion can be determined, it is set to zero. The vectors are
+// formatted like OutputMotion.
+func EstimateMotion(prev, cur *image.RGBA) []float32 {
+	const window = 2
+	w, h := cur.Rect.Dx(), cur.Rect.Dy()
+	luma := func(img *image.RGBA, x, y int) float64 {
+		x = int(math.Max(0, math.Min(float64(w-1), float64(x))))
+		y = int(math.Max(0, math.Min(float64(h-1), float64(y))))
+		i := y*img.Stride + x*4
+		return (0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])) / 255
+	}
+	avg := func(x, y int) float64 {
+		return (luma(prev, x, y) + luma(cur, x, y)) / 2
+	}
+
+	// Compute the spatial and temporal derivatives once.
+	ix := make([]float64, w*h)
+	iy := make([]float64, w*h)
+	it := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			ix[i] = (avg(x+1, y) - avg(x-1, y)) / 2
+			iy[i] = (avg(x, y+1) - avg(x, y-1)) / 2
+			it[i] = luma(cur, x, y) - luma(prev, x, y)
+		}
+	}
+
+	motion := make([]float32, w*h*2)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sxx, sxy, syy, sxt, syt float64
+			for wy := y - window; wy <= y+window; wy++ {
+				for wx := x - window; wx <= x+window; wx++ {
+					if wx < 0 || wy < 0 || wx >= w || wy >= h {
+						continue
+					}
+					i := wy*w + wx
+					sxx += ix[i] * ix[i]
+					sxy += ix[i] * iy[i]
+					syy += iy[i] * iy[i]
+					sxt += ix[i] * it[i]
+					syt += iy[i] * it[i]
+				}
+			}
+			var vx, vy float64
+			if det := sxx*syy - sxy*sxy; math.Abs(det) > 1e-9 {
+				vx = (-syy*sxt + sxy*syt) / det
+				vy = (sxy*sxt - sxx*syt) / det
+			} else if g := sxx + syy; g > 1e-9 {
+				// The texture only varies in one direction, so only the
+				// motion along the gradient can be determined.
+				vx, vy = -sxt/g, -syt/g
+			} else {
+				continue
+			}
+			// Image rows run downwards while motion vectors point up.
+			motion[(y*w+x)*2] = float32(vx)
+			motion[(y*w+x)*2+1] = float32(-vy)
+		}
+	}
+	return motion
+}
+
+func unorm16(v float64) uint16 {
+	if math.IsNaN(v) {
+		v = 0
+	}
+	v = math.Max(0, math.Min(1, v))
+	return uint16(math.Round(v * math.MaxUint16))
+}
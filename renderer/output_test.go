@@ -0,0 +1,64 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestEstimateMotion(t *testing.T) {
+	pattern := func(shift float64) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				v := 0.5 + 0.25*math.Sin(float64(x)*0.4-shift*0.4) + 0.25*math.Cos(float64(y)*0.3)
+				c := uint8(v * 255)
+				img.Set(x, y, color.RGBA{c, c, c, 255})
+			}
+		}
+		return img
+	}
+
+	motion := EstimateMotion(pattern(0), pattern(0.5))
+	i := (16*32 + 16) * 2
+	if math.Abs(float64(motion[i])-0.5) > 0.1 || math.Abs(float64(motion[i+1])) > 0.1 {
+		t.Fatalf("unexpected motion: exp (0.5, 0), got (%v, %v)", motion[i], motion[i+1])
+	}
+}
+
+func TestFloatImageDense(t *testing.T) {
+	img := &FloatImage{
+		Rect:     image.Rect(0, 0, 2, 2),
+		Channels: 2,
+		Data:     []float32{0, 10, 1, 11, 2, 12, 3, 13},
+	}
+	rows, cols, data := img.Dense(1)
+	if rows != 2 || cols != 2 {
+		t.Fatalf("unexpected size: %dx%d", rows, cols)
+	}
+	for i, exp := range []float64{10, 11, 12, 13} {
+		if data[i] != exp {
+			t.Fatalf("unexpected value at %d: exp %v, got %v", i, exp, data[i])
+		}
+	}
+	if v := img.Value(1, 1, 0); v != 3 {
+		t.Fatalf("unexpected value: %v", v)
+	}
+}
+
+func TestFrameRGBA(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	for _, img := range []image.Image{
+		rgba,
+		&LayeredImage{RGBA: rgba},
+		&HDRImage{RGBA: rgba},
+	} {
+		if FrameRGBA(img) != rgba {
+			t.Fatalf("FrameRGBA(%T) did not return the color of the frame", img)
+		}
+	}
+	if FrameRGBA(image.NewGray(rgba.Rect)) != nil {
+		t.Fatal("FrameRGBA returned the color of a frame not rendered by a shader")
+	}
+}
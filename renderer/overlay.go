@@ -0,0 +1,228 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+const (
+	overlayVert = SourceBuf(`#version 330 core
+		in vec3 vert;
+		uniform vec4 rect;
+		out vec2 texCoord;
+
+		void main() {
+			texCoord = vert.xy * .5 + .5;
+			gl_Position = vec4(mix(rect.xy, rect.zw, texCoord), 0.0, 1.0);
+		}
+	`)
+	overlayFrag = SourceBuf(`#version 330 core
+		out vec4 fragColor;
+		in vec2 texCoord;
+		uniform sampler2D overlay;
+		uniform float opacity;
+
+		void main() {
+			vec4 c = texture(overlay, texCoord);
+			fragColor = vec4(c.rgb, c.a * opacity);
+		}
+	`)
+)
+
+// A Corner is a position of an overlay in the frame.
+type Corner string
+
+const (
+	CornerTopLeft     Corner = "top-left"
+	CornerTopRight    Corner = "top-right"
+	CornerBottomLeft  Corner = "bottom-left"
+	CornerBottomRight Corner = "bottom-right"
+	CornerCenter      Corner = "center"
+)
+
+// ParseCorner parses the name of a corner, as used by the constants, e.g.
+// "top-left".
+func ParseCorner(s string) (Corner, error) {
+	switch c := Corner(s); c {
+	case CornerTopLeft, CornerTopRight, CornerBottomLeft, CornerBottomRight, CornerCenter:
+		return c, nil
+	}
+	return "", fmt.Errorf("invalid overlay position: %q (valid: top-left, top-right, bottom-left, bottom-right, center)", s)
+}
+
+// An Overlay is an image or the output of a second "HUD" shader composited
+// over each rendered frame using its alpha channel.
+type Overlay struct {
+	// Image is a static image to overlay. It is ignored if Environment or
+	// Render is set.
+	Image image.Image
+	// Environment is rendered every frame at the size of the overlay.
+	Environment Environment
+	// Render is called for every frame to produce the image to overlay.
+	Render func(OverlayFrame) image.Image
+	// Width and Height are the size of the overlay in pixels. If zero, the
+	// size of the image or frame is used.
+	Width, Height uint
+
+	Corner Corner
+	// Margin is the distance in pixels between the overlay and the edges of
+	// the frame.
+	Margin  uint
+	Opacity float32
+}
+
+// OverlayFrame describes the frame an overlay is rendered for.
+type OverlayFrame struct {
+	Time     time.Duration
+	Interval time.Duration
+	Frame    uint64
+	// Uniform returns the value of a uniform of the frame's shader. False
+	// is returned if the uniform does not exist or its type is unsupported.
+	Uniform func(name string) ([]float32, bool)
+}
+
+// overlay holds the OpenGL state of an Overlay.
+type overlay struct {
+	Overlay
+	program uint32
+	vertLoc uint32
+	texture uint32
+	shader  *subTarget
+	// width and height are the size at which the overlay is drawn, which is
+	// that of the last image if the size of the Overlay is not set.
+	width, height uint
+}
+
+func newOverlay(ov Overlay, glVersion OpenGLVersion, logger *logOutput) (*overlay, error) {
+	program, err := linkProgram(map[Stage][]Source{
+		StageVertex:   {overlayVert},
+		StageFragment: {overlayFrag},
+	})
+	if err != nil {
+		return nil, err
+	}
+	o := &overlay{
+		Overlay: ov,
+		program: program,
+		vertLoc: uint32(gl.GetAttribLocation(program, gl.Str("vert\x00"))),
+		width:   ov.Width,
+		height:  ov.Height,
+	}
+
+	if ov.Environment != nil {
+		if o.Width == 0 || o.Height == 0 {
+			o.Close()
+			return nil, fmt.Errorf("the size of an overlay shader must be set")
+		}
+		targets, err := newSubTargets(map[string]SubEnvironment{
+			"overlay": {Environment: ov.Environment, Width: o.Width, Height: o.Height},
+		}, glVersion, nil, timeRange{}, logger)
+		if err != nil {
+			o.Close()
+			return nil, err
+		}
+		o.shader = targets["overlay"]
+		return o, nil
+	}
+
+	gl.GenTextures(1, &o.texture)
+	gl.BindTexture(gl.TEXTURE_2D, o.texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	if ov.Render == nil {
+		o.upload(ov.Image)
+	}
+	return o, nil
+}
+
+// upload replaces the contents of the overlay's texture with the image. If
+// the size of the overlay is not set, it is drawn at the size of the image.
+func (o *overlay) upload(img image.Image) {
+	bounds := img.Bounds()
+	if o.Width == 0 || o.Height == 0 {
+		o.width, o.height = uint(bounds.Dx()), uint(bounds.Dy())
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Rect.Min != (image.Point{}) || rgba.Stride != rgba.Rect.Dx()*4 {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	}
+	if len(rgba.Pix) == 0 {
+		return
+	}
+	gl.BindTexture(gl.TEXTURE_2D, o.texture)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(rgba.Rect.Dx()), int32(rgba.Rect.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// prepare renders the overlay shader, if any. It should be called before the
+// frame is drawn.
+func (o *overlay) prepare(advance time.Duration) {
+	if o.shader != nil {
+		o.texture = o.shader.Texture(advance)
+	}
+}
+
+// draw composites the overlay over a frame of the specified size. The quad
+// vertex array should be bound.
+func (o *overlay) draw(width, height uint, frame OverlayFrame) {
+	if o.Render != nil {
+		img := o.Render(frame)
+		if img == nil {
+			return
+		}
+		o.upload(img)
+	}
+
+	// Compute the position of the overlay in pixels. Rendered frames are
+	// flipped vertically when they are output, so the top is at Y = 0.
+	w, h, m := float32(o.width), float32(o.height), float32(o.Margin)
+	fw, fh := float32(width), float32(height)
+	var x, y float32
+	switch o.Corner {
+	case CornerTopRight:
+		x, y = fw-w-m, m
+	case CornerBottomLeft:
+		x, y = m, fh-h-m
+	case CornerBottomRight:
+		x, y = fw-w-m, fh-h-m
+	case CornerCenter:
+		x, y = (fw-w)/2, (fh-h)/2
+	default:
+		x, y = m, m
+	}
+
+	defer colorOutputOnly()()
+	gl.Viewport(0, 0, int32(width), int32(height))
+	gl.Enable(gl.BLEND)
+	gl.BlendFuncSeparate(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA, gl.ONE, gl.ONE_MINUS_SRC_ALPHA)
+	gl.UseProgram(o.program)
+	gl.Uniform4f(
+		gl.GetUniformLocation(o.program, gl.Str("rect\x00")),
+		x/fw*2-1, y/fh*2-1, (x+w)/fw*2-1, (y+h)/fh*2-1,
+	)
+	gl.Uniform1f(gl.GetUniformLocation(o.program, gl.Str("opacity\x00")), o.Opacity)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, o.texture)
+	gl.Uniform1i(gl.GetUniformLocation(o.program, gl.Str("overlay\x00")), 0)
+	gl.EnableVertexAttribArray(o.vertLoc)
+	gl.VertexAttribPointer(o.vertLoc, 3, gl.FLOAT, false, 0, nil)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	gl.Disable(gl.BLEND)
+}
+
+func (o *overlay) Close() error {
+	gl.DeleteProgram(o.program)
+	if o.shader != nil {
+		return o.shader.Close()
+	}
+	gl.DeleteTextures(1, &o.texture)
+	return nil
+}
@@ -0,0 +1,133 @@
+package renderer
+
+import (
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+const postPassVert = SourceBuf(`#version 330 core
+	in vec3 vert;
+	out vec2 texCoord;
+
+	void main() {
+		texCoord = vert.xy * .5 + .5;
+		gl_Position = vec4(vert, 1.0);
+	}
+`)
+
+// A PostPass is a fragment shader that is applied to every rendered frame
+// before overlays are composited, e.g. for color grading. It is only applied
+// to the output, environments that read the previous frame receive it as they
+// rendered it.
+type PostPass struct {
+	// Fragment is the source of a "#version 330 core" fragment shader. It
+	// reads the rendered frame from "uniform sampler2D frame" at
+	// "in vec2 texCoord" and writes the processed color to its only output.
+	Fragment Source
+	// PreRender is called before every frame is processed with the program
+	// of the pass in use, to set additional uniforms. Texture unit 0 is used
+	// for the frame.
+	PreRender func(program uint32)
+	// Close is called when the shader is closed to release the resources of
+	// the pass.
+	Close func() error
+}
+
+// postPass holds the OpenGL state of a PostPass.
+type postPass struct {
+	PostPass
+	program  uint32
+	vertLoc  uint32
+	frameLoc int32
+	// frame is a copy of the frame being processed, as a texture can not be
+	// sampled while it is also rendered to.
+	frame uint32
+}
+
+func newPostPass(pp PostPass, width, height uint, format uint32) (*postPass, error) {
+	program, err := linkProgram(map[Stage][]Source{
+		StageVertex:   {postPassVert},
+		StageFragment: {pp.Fragment},
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := &postPass{
+		PostPass: pp,
+		program:  program,
+		vertLoc:  uint32(gl.GetAttribLocation(program, gl.Str("vert\x00"))),
+		frameLoc: gl.GetUniformLocation(program, gl.Str("frame\x00")),
+	}
+	gl.GenTextures(1, &p.frame)
+	p.allocate(width, height, format)
+	return p, nil
+}
+
+// allocate sets the size and internal format of the copy of the frame, which
+// should match those of the frame to keep values outside of [0, 1].
+func (p *postPass) allocate(width, height uint, format uint32) {
+	allocateFrameTexture(p.frame, width, height, format)
+}
+
+// allocateFrameTexture sets the size and internal format of a texture that
+// holds a copy of a frame.
+func allocateFrameTexture(tex uint32, width, height uint, format uint32) {
+	xtype := uint32(gl.FLOAT)
+	if format == gl.RGBA8 || format == gl.RGB8 {
+		xtype = gl.UNSIGNED_BYTE
+	}
+	gl.BindTexture(gl.TEXTURE_2D, tex)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, int32(format), int32(width), int32(height), 0, gl.RGBA, xtype, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// draw processes the color output of the bound framebuffer. The quad vertex
+// array should be bound.
+func (p *postPass) draw(width, height uint) {
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, p.frame)
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, int32(width), int32(height))
+
+	defer colorOutputOnly()()
+	gl.Viewport(0, 0, int32(width), int32(height))
+	gl.UseProgram(p.program)
+	gl.Uniform1i(p.frameLoc, 0)
+	if p.PreRender != nil {
+		p.PreRender(p.program)
+	}
+	gl.EnableVertexAttribArray(p.vertLoc)
+	gl.VertexAttribPointer(p.vertLoc, 3, gl.FLOAT, false, 0, nil)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+}
+
+func (p *postPass) close() error {
+	gl.DeleteProgram(p.program)
+	gl.DeleteTextures(1, &p.frame)
+	if p.Close != nil {
+		return p.Close()
+	}
+	return nil
+}
+
+// colorOutputOnly makes draw calls only write to the color output, leaving
+// additional outputs of the frame untouched. The returned function restores
+// the previous draw buffers.
+func colorOutputOnly() (restore func()) {
+	var drawBuffers []uint32
+	for i := uint32(0); i < 8; i++ {
+		var buf int32
+		gl.GetIntegerv(gl.DRAW_BUFFER0+i, &buf)
+		if buf == gl.NONE {
+			break
+		}
+		drawBuffers = append(drawBuffers, uint32(buf))
+	}
+	gl.DrawBuffer(gl.COLOR_ATTACHMENT0)
+	return func() {
+		gl.DrawBuffers(int32(len(drawBuffers)), &drawBuffers[0])
+	}
+}
@@ -1,6 +1,7 @@
 package renderer
 
 import (
+	"bytes"
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
@@ -11,6 +12,13 @@ var ppIncludeRe = regexp.MustCompile(`(?im)^#pragma\s+use\s+"([^"]+)"$`)
 // Includes recursively resolves dependencies in the specified file.
 //
 // The argument file is returned included in the returned list of files.
+//
+// The dependencies are the files referred to with "#pragma use", which are
+// compiled as separate sources before the files using them. #include
+// directives are expanded first, so "#pragma use" in a file that is included
+// with #include is followed as well, relative to the included file. A file
+// should be referred to with only one of the two: its contents would
+// otherwise be compiled twice.
 func Includes(filenames ...string) ([]string, error) {
 	return processRecursive(filenames, []string{})
 }
@@ -26,6 +34,10 @@ func processRecursive(filenames []string, sources []string) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
+		shaderSource, directives, err := expandIncludes(currentFile, shaderSource, ioutil.ReadFile)
+		if err != nil {
+			return nil, err
+		}
 
 		// We need to check for recursion using a set that includes the current
 		// file. But we need to append the current file after all included sources
@@ -35,13 +47,16 @@ func processRecursive(filenames []string, sources []string) ([]string, error) {
 
 		// Check for files being included in the current file so we can later
 		// recurse into all of them.
-		includeMatches := ppIncludeRe.FindAllSubmatch(shaderSource, -1)
+		includeMatches := ppIncludeRe.FindAllSubmatchIndex(shaderSource, -1)
 		includes := make([]string, 0, len(includeMatches))
 	outer:
 		for _, submatch := range includeMatches {
-			includedFile := string(submatch[1])
+			includedFile := string(shaderSource[submatch[2]:submatch[3]])
 			if !filepath.IsAbs(includedFile) {
-				includedFile = filepath.Join(filepath.Dir(absFilename), includedFile)
+				// The directive may be in a file included with #include.
+				line := bytes.Count(shaderSource[:submatch[0]], []byte("\n")) + 1
+				declaringFile, _ := resolveLine(directives, line)
+				includedFile = filepath.Join(filepath.Dir(declaringFile), includedFile)
 			} else {
 				includedFile = filepath.Clean(includedFile)
 			}
@@ -1,6 +1,8 @@
 package renderer
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -43,3 +45,16 @@ func TestStopRecursionCycle(t *testing.T) {
 		t.Fatalf("unexpected number of sources: exp %v, got %v", 1, len(sources))
 	}
 }
+
+func TestIncludeFromHashInclude(t *testing.T) {
+	sources, err := Includes("../testdata/preprocessor/hash-include-use.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("unexpected number of sources: exp %v, got %v", 2, len(sources))
+	}
+	if exp := filepath.Join("lib", "hash-include-use-lib.glsl"); !strings.HasSuffix(sources[0], exp) {
+		t.Fatalf("unexpected dependency: exp %v, got %v", exp, sources[0])
+	}
+}
@@ -0,0 +1,205 @@
+package renderer
+
+import (
+	"image"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// PreviewControls are called by the keyboard shortcuts of the window of an
+// OnScreenEngine. Besides these, the mouse wheel zooms in to inspect pixels,
+// which shows the value of the pixel under the cursor in the title, and
+// dragging with the right mouse button pans:
+//
+//	Space        pause or resume time
+//	Left, Right  scrub time by a second, or by a frame with Shift
+//	R            reload the environment
+//	Z            roll back to the previous environment
+//	S            take a screenshot
+//	C            start or stop recording a clip
+//	Tab          switch between the compared environments
+//	V            show the compared environments side by side
+//	0            reset the zoom
+//	Escape       close the window
+//
+// The functions are called from a separate goroutine, so they do not hold up
+// rendering.
+type PreviewControls struct {
+	// Reload should load the environment again and set it with
+	// SetEnvironment.
+	Reload func()
+	// Rollback should call Rollback, e.g. along with hiding errors of the
+	// environment that is rolled back from.
+	Rollback func()
+	// Screenshot receives the frame that is shown in the window.
+	Screenshot func(image.Image)
+	// Clip receives the frames of a clip while it is recorded. The stream
+	// is closed when recording stops. Frames are sent as they are rendered,
+	// so rendering waits for them to be received.
+	Clip func(frames <-chan image.Image, interval time.Duration)
+	// ClipInterval is the time between the frames of a clip, 1/30s if zero.
+	// While a clip is recorded, time advances by it for every frame, so the
+	// clip plays at the right speed however long encoding the frames takes.
+	ClipInterval time.Duration
+	// ClipLength limits the length of clips, if positive. Recording stops
+	// once it is reached.
+	ClipLength time.Duration
+}
+
+func (c PreviewControls) clipInterval() time.Duration {
+	if c.ClipInterval <= 0 {
+		return time.Second / 30
+	}
+	return c.ClipInterval
+}
+
+// SetControls sets the functions that are called by the keyboard shortcuts.
+// Pausing and closing work without them.
+func (eng *OnScreenEngine) SetControls(controls PreviewControls) {
+	eng.controls = controls
+}
+
+// SetFrameStream makes the engine send the frames shown in the window to the
+// stream, e.g. to serve the preview over the network. Reading frames back from
+// the GPU is expensive, so frames are only read while the stream has room for
+// them and are dropped otherwise. The stream must be buffered.
+func (eng *OnScreenEngine) SetFrameStream(stream chan<- image.Image) {
+	eng.frames = stream
+}
+
+// SetVSync makes the engine wait for the vertical blank of the display before
+// presenting a frame, which prevents tearing and limits the frame rate to
+// the refresh rate of the display.
+func (eng *OnScreenEngine) SetVSync(enable bool) {
+	if enable {
+		glfw.SwapInterval(1)
+	} else {
+		glfw.SwapInterval(0)
+	}
+}
+
+// Pause stops or resumes time. While paused, the last frame is shown.
+//
+// Like the other controls of the engine, it may be called from any goroutine
+// and takes effect before the next frame is rendered.
+func (eng *OnScreenEngine) Pause(paused bool) {
+	eng.actions <- func() { eng.paused = paused }
+}
+
+// Seek moves time forward, or back if offset is negative. Time does not go
+// back further than the first frame.
+func (eng *OnScreenEngine) Seek(offset time.Duration) {
+	eng.actions <- func() { eng.seek(offset) }
+}
+
+// Screenshot passes the next frame to PreviewControls.Screenshot.
+func (eng *OnScreenEngine) Screenshot() {
+	eng.actions <- func() { eng.screenshot = eng.controls.Screenshot != nil }
+}
+
+// ToggleClip starts recording a clip that is passed to PreviewControls.Clip,
+// or stops recording the clip that is being recorded.
+func (eng *OnScreenEngine) ToggleClip() {
+	eng.actions <- eng.toggleClip
+}
+
+func (eng *OnScreenEngine) seek(offset time.Duration) {
+	eng.time += offset
+	if eng.time < 0 {
+		eng.time = 0
+	}
+	eng.stale = true
+}
+
+func (eng *OnScreenEngine) toggleClip() {
+	if eng.clip != nil {
+		eng.stopClip()
+		return
+	}
+	if eng.controls.Clip == nil {
+		return
+	}
+	eng.clip = make(chan image.Image, 4)
+	eng.clipFrames = 0
+	go eng.controls.Clip(eng.clip, eng.controls.clipInterval())
+}
+
+func (eng *OnScreenEngine) recordClipFrame(img image.Image) {
+	eng.clip <- img
+	eng.clipFrames++
+	if length := eng.controls.ClipLength; length > 0 && time.Duration(eng.clipFrames)*eng.controls.clipInterval() >= length {
+		eng.stopClip()
+	}
+}
+
+func (eng *OnScreenEngine) stopClip() {
+	if eng.clip != nil {
+		close(eng.clip)
+		eng.clip = nil
+	}
+}
+
+func (eng *OnScreenEngine) onKey(win *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	// Holding an arrow key keeps scrubbing.
+	if action == glfw.Repeat && (key == glfw.KeyLeft || key == glfw.KeyRight) {
+		action = glfw.Press
+	}
+	if action != glfw.Press {
+		return
+	}
+	step := time.Second
+	if mods&glfw.ModShift != 0 {
+		step = time.Second / 60
+	}
+	switch key {
+	case glfw.KeySpace:
+		eng.paused = !eng.paused
+	case glfw.KeyLeft:
+		eng.seek(-step)
+	case glfw.KeyRight:
+		eng.seek(step)
+	case glfw.KeyR:
+		if eng.controls.Reload != nil {
+			go eng.controls.Reload()
+		}
+	case glfw.KeyZ:
+		if eng.controls.Rollback != nil {
+			go eng.controls.Rollback()
+		}
+	case glfw.KeyS:
+		eng.screenshot = eng.controls.Screenshot != nil
+	case glfw.KeyC:
+		eng.toggleClip()
+	case glfw.KeyTab:
+		if eng.compareMode == CompareB {
+			eng.setCompareMode(CompareA)
+		} else {
+			eng.setCompareMode(CompareB)
+		}
+	case glfw.KeyV:
+		if eng.compareMode == CompareSplit {
+			eng.setCompareMode(CompareA)
+		} else {
+			eng.setCompareMode(CompareSplit)
+		}
+	case glfw.Key0:
+		eng.view = view{}
+		eng.updateTitle()
+	case glfw.KeyEscape:
+		win.SetShouldClose(true)
+	}
+}
+
+// readFramebuffer reads the color of a framebuffer of the size of the
+// window. The framebuffer holds the frame upside down, as it is flipped when
+// copied to the window, so the rows are in the order of an image.
+func readFramebuffer(fbo uint32, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, fbo)
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 4)
+	gl.ReadPixels(0, 0, int32(width), int32(height), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(&img.Pix[0]))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	return img
+}
@@ -0,0 +1,86 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"sync"
+	"time"
+)
+
+// A framePool holds the buffers of frames that were handed back with Recycle,
+// so they can be read back into again instead of allocating new ones.
+type framePool struct {
+	pool sync.Pool
+	// dst is the buffer that the next frame is read into, see ImageInto.
+	dst *image.RGBA
+}
+
+// get returns a buffer for a frame of the specified size.
+func (p *framePool) get(w, h uint) *image.RGBA {
+	rect := image.Rect(0, 0, int(w), int(h))
+	if p == nil {
+		return image.NewRGBA(rect)
+	}
+	if dst := p.dst; dst != nil {
+		p.dst = nil
+		return dst
+	}
+	// Buffers of another size are left for the garbage collector.
+	if img, ok := p.pool.Get().(*image.RGBA); ok && img.Rect == rect {
+		return img
+	}
+	return image.NewRGBA(rect)
+}
+
+// Recycle hands a frame that was received from Animate, Image or
+// RenderFrames back to the shader, which reads later frames into its buffer.
+// At high resolutions and frame rates this saves allocating and collecting
+// megabytes per frame. The frame must not be used afterwards, which includes
+// hooks and outputs that keep it. It may be called from any goroutine.
+func (sh *Shader) Recycle(img image.Image) {
+	if rgba := FrameRGBA(img); rgba != nil {
+		sh.frames.pool.Put(rgba)
+	}
+}
+
+// FrameRGBA returns the 8-bit color of a frame, or nil if the frame is not of
+// a type rendered by a shader, e.g. as it was replaced by a frame hook.
+func FrameRGBA(img image.Image) *image.RGBA {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return img
+	case *LayeredImage:
+		return img.RGBA
+	case *HDRImage:
+		return img.RGBA
+	}
+	return nil
+}
+
+// ImageInto is like Image, but reads the frame into dst, which must be of the
+// size of the shader, instead of allocating an image. False is returned if a
+// frame hook dropped the frame. Only the 8-bit color is read into dst, so
+// additional outputs and HDR precision are not available.
+func (sh *Shader) ImageInto(ctx context.Context, dst *image.RGBA, interval time.Duration) (bool, error) {
+	sh.applyResize()
+	if b := dst.Bounds(); b.Dx() != int(sh.w) || b.Dy() != int(sh.h) {
+		return false, fmt.Errorf("image of %dx%d does not match the shader of %dx%d", b.Dx(), b.Dy(), sh.w, sh.h)
+	}
+	// The buffer is only used directly if it can be read into as a whole.
+	if dst.Rect.Min == (image.Point{}) && dst.Stride == 4*dst.Rect.Dx() {
+		sh.frames.dst = dst
+		defer func() { sh.frames.dst = nil }()
+	}
+	img, err := sh.Image(ctx, interval)
+	if err != nil || img == nil {
+		return false, err
+	}
+	if rgba := FrameRGBA(img); rgba == nil {
+		draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	} else if rgba != dst {
+		draw.Draw(dst, dst.Bounds(), rgba, rgba.Bounds().Min, draw.Src)
+	}
+	return true, nil
+}
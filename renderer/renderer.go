@@ -7,6 +7,7 @@ import (
 	"image"
 	"io"
 	"log"
+	"math"
 	"os"
 	"regexp"
 	"strconv"
@@ -34,9 +35,11 @@ const (
 		out vec4 fragColor;
 		in vec2 texCoord;
 		uniform sampler2D screenTexture;
+		uniform float zoom;
+		uniform vec2 offset;
 
 		void main() {
-			fragColor = texture(screenTexture, texCoord);
+			fragColor = texture(screenTexture, offset + texCoord / zoom);
 		}
 	`)
 )
@@ -52,44 +55,100 @@ const (
 
 var ErrWindowClosed = errors.New("window closed")
 
-var initGLOnce sync.Once
+var (
+	initGLOnce sync.Once
+	initGLErr  error
 
-func initEGL(glVersion OpenGLVersion) error {
-	display, err := egl.GetDisplay(egl.DefaultDisplay)
-	if err != nil {
-		return err
+	platformLock sync.Mutex
+	platform     = egl.PlatformDefault
+	initialized  bool
+
+	// eglContext is the context shared by all shaders.
+	eglContext *egl.Context
+)
+
+// SetPlatform selects the EGL platform that the OpenGL context of shaders is
+// created on, which is the platform chosen by EGL by default. Selecting
+// egl.PlatformDevice or egl.PlatformSurfaceless renders without a display
+// server, e.g. on headless machines and in containers.
+//
+// All shaders share the same context, so an error is returned if a shader was
+// already created.
+func SetPlatform(p egl.Platform) error {
+	platformLock.Lock()
+	defer platformLock.Unlock()
+	if initialized {
+		return fmt.Errorf("the EGL platform can not be changed after creating a shader")
 	}
-	surface, err := display.CreateSurface(1<<12, 1<<12)
-	if err != nil {
+	platform = p
+	return nil
+}
+
+// Platform returns the EGL platform the context of shaders is created on.
+func Platform() egl.Platform {
+	platformLock.Lock()
+	defer platformLock.Unlock()
+	return platform
+}
+
+func initEGL(ctx context.Context, glVersion OpenGLVersion) error {
+	platformLock.Lock()
+	p := platform
+	initialized = true
+	platformLock.Unlock()
+
+	var display egl.Display
+	if err := runStage(ctx, "EGL display", func() (err error) {
+		display, err = egl.GetPlatformDisplay(p)
 		return err
+	}); err != nil {
+		return setupError("EGL display", err, displayHint(p))
 	}
-	if err := display.BindAPI(egl.OpenGLAPI); err != nil {
+	var surface *egl.Surface
+	if err := runStage(ctx, "EGL surface", func() (err error) {
+		surface, err = display.CreateSurface(1<<12, 1<<12)
 		return err
+	}); err != nil {
+		return setupError("EGL surface", err, "")
 	}
-	glMajor, glMinor := glVersion.majorMinor()
-	glContext, err := display.CreateContext(surface, glMajor, glMinor)
-	if err != nil {
+	var glContext *egl.Context
+	if err := runStage(ctx, "EGL context", func() error {
+		if err := display.BindAPI(egl.OpenGLAPI); err != nil {
+			return err
+		}
+		glMajor, glMinor := glVersion.majorMinor()
+		var err error
+		glContext, err = display.CreateContext(surface, glMajor, glMinor)
+		if err != nil {
+			// The hint is determined here, as the context is created on
+			// another thread if the stage has a deadline.
+			hint := versionHint(glVersion, newestSupported(glVersion, func(v OpenGLVersion) bool {
+				maj, min := v.majorMinor()
+				cx, err := display.CreateContext(surface, maj, min)
+				if err == nil {
+					cx.Destroy()
+				}
+				return err == nil
+			}))
+			return setupError("EGL context", err, hint)
+		}
+		return nil
+	}); err != nil {
+		return setupError("EGL context", err, "")
+	}
+	// The API is bound per thread, so it is bound again if the context was
+	// created on another thread.
+	if err := display.BindAPI(egl.OpenGLAPI); err != nil {
 		return err
 	}
 	glContext.MakeCurrent()
+	eglContext = glContext
 	return nil
 }
 
-func initOpenGL() error {
-	if err := gl.Init(); err != nil {
-		return err
-	}
-
-	debug := GLDebugOutput()
-	go func() {
-		for dm := range debug {
-			if dm.Severity != gl.DEBUG_SEVERITY_NOTIFICATION {
-				fmt.Fprintf(os.Stderr, "OpenGL %s: %s\n", dm.SeverityString(), dm.Message)
-				fmt.Fprintf(os.Stderr, "           %s\n", dm.Stack)
-			}
-		}
-	}()
-	return nil
+func initOpenGL(ctx context.Context) error {
+	err := runStage(ctx, "OpenGL initialization", gl.Init)
+	return setupError("OpenGL initialization", err, "the OpenGL library could not be loaded or lacks functions, check that a hardware driver or Mesa is installed")
 }
 
 type Shader struct {
@@ -100,51 +159,126 @@ type Shader struct {
 	vao     uint32
 	vbo     uint32
 
-	uniforms map[string]Uniform
-	renderer imageRenderer
-	program  uint32
+	uniforms      map[string]Uniform
+	uniformValues uniformValues
+	renderer      imageRenderer
+	outputs       []Output
+	hdrBits       int
+	program       uint32
 
 	env     Environment
 	newEnvs chan Environment
-
-	subTargets map[string]*Shader
-
+	// resizes holds the size set by Resize until it is applied.
+	resizes chan [2]uint
+	// mice holds the state set by SetMouse until it is applied.
+	mice chan Mouse
+
+	subTargets map[string]*subTarget
+	stereo     Stereo
+	fallback   func(error) Environment
+	// fallbackActive is set while the fallback environment is rendered.
+	fallbackActive bool
+	history        environmentHistory
+	// keepOnError receives the errors of environments that failed to load
+	// while the previous one is kept, if set.
+	keepOnError func(error)
+	// shared holds the sub environments that are shared within the tree of
+	// shaders this shader belongs to. nested is set for all shaders but the
+	// root of the tree.
+	shared *sharedTargets
+	nested bool
+
+	postPasses   []*postPass
+	overlays     []*overlay
+	frameHooks   []FrameHook
+	metadata     chan<- FrameMetadata
+	accumulation Accumulation
+	sample       uint
+	sampleOffset time.Duration
+
+	// time is the time elapsed since the first frame, which timeRange maps
+	// to the time of the animation.
 	time            time.Duration
+	timeRange       timeRange
 	frame           uint64
 	prevFrameHandle interface{}
+	// feedback is the previous frame without post passes and overlays, if
+	// there are any.
+	feedback feedbackFrame
+
+	restartOnError bool
+	stats          stats
+	timer          gpuTimer
+	frames         framePool
+	debug          *debugLog
+	log            *logOutput
 }
 
+// NewShader creates a shader that renders frames of the specified size.
+//
+// OpenGL is bound to the thread that creates the first shader, so the shader
+// must be created and used from a goroutine that has called
+// runtime.LockOSThread. To use a shader from any goroutine, see
+// NewThreadShader.
 func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
+	return NewShaderContext(context.Background(), width, height, glVersion)
+}
+
+// NewShaderContext is like NewShader, but gives up setting up OpenGL once the
+// context is done, returning a *StallError describing the stage that stalled.
+// This guards against broken drivers which hang rather than fail.
+//
+// A stalled stage keeps a thread occupied until the driver returns, if ever.
+// The context does not apply to compiling environments, see Load for that.
+func NewShaderContext(ctx context.Context, width, height uint, glVersion OpenGLVersion) (*Shader, error) {
+	initGL := func() error {
+		if err := initOpenGL(ctx); err != nil {
+			return err
+		}
+		if err := initEGL(ctx, glVersion); err != nil {
+			return err
+		}
+		debugOutput.install()
+		return nil
+	}
 	// Hack: Unit tests require a different style of initialization. We'll
 	// detect whether we are running as a test for now.
 	var err error
 	if strings.HasSuffix(os.Args[0], ".test") {
-		err = initOpenGL()
-		if err == nil {
-			err = initEGL(glVersion)
-		}
+		err = initGL()
 	} else {
 		initGLOnce.Do(func() {
-			err = initOpenGL()
-			if err == nil {
-				err = initEGL(glVersion)
-			}
+			initGLErr = initGL()
 		})
+		err = initGLErr
 	}
 	if err != nil {
 		return nil, err
 	}
+	return newShader(width, height, glVersion)
+}
 
+// newShader creates a shader in the OpenGL context that is current, e.g. for
+// a sub environment of another shader.
+func newShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
 	sh := &Shader{
 		w:         width,
 		h:         height,
 		glVersion: glVersion,
-		renderer:  &pboRenderer{w: width, h: height},
 		newEnvs:   make(chan Environment, 1),
+		resizes:   make(chan [2]uint, 1),
+		mice:      make(chan Mouse, 1),
+		shared:    &sharedTargets{},
+		debug:     newDebugLog(),
+		log:       newLogOutput(),
 	}
 
+	sh.shared.uniforms = &sh.uniformValues
+	sh.renderer = &pboRenderer{w: width, h: height, frames: &sh.frames}
+
 	// Set up the render targets.
 	if err := sh.renderer.Setup(); err != nil {
+		sh.debug.close()
 		return nil, err
 	}
 	sh.vao, sh.vbo = createGLQuad()
@@ -163,33 +297,77 @@ func (sh *Shader) reloadEnvironment(ctx context.Context) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		case env = <-sh.newEnvs:
+		case l := <-sh.history.rollbacks:
+			sh.restoreEnvironment(l)
+			return nil
 		}
 	} else {
 		// If an environment is already set, check if a newer environment is
 		// available or just exit.
 		select {
 		case env = <-sh.newEnvs:
+		case l := <-sh.history.rollbacks:
+			sh.restoreEnvironment(l)
+			return nil
 		default:
 			return nil
 		}
 	}
 
-	// Close the old environment if there is one.
+	if sh.env != nil && env != nil && sh.keepOnError != nil {
+		err := sh.replaceEnvironment(env)
+		sh.stats.reloaded(err)
+		if err != nil {
+			sh.keepOnError(err)
+		}
+		return nil
+	}
+
+	// Retire the old environment if there is one.
 	if sh.env != nil {
-		sh.env.Close()
-		gl.DeleteProgram(sh.program)
-		sh.env = nil
+		sh.history.retire(loadedEnvironment{sh.env, sh.subTargets, sh.program}, sh.fallbackActive)
+		sh.env, sh.subTargets, sh.fallbackActive = nil, nil, false
 	}
 	if env == nil {
 		return nil
 	}
 
+	err := sh.setupEnvironment(env)
+	sh.stats.reloaded(err)
+	if err == nil {
+		return nil
+	}
+	closeSubTargets(sh.subTargets)
+	sh.subTargets = nil
+	env.Close()
+	if sh.fallback == nil {
+		return err
+	}
+	fallback := sh.fallback(err)
+	if fallback == nil {
+		return err
+	}
+	if fallbackErr := sh.setupEnvironment(fallback); fallbackErr != nil {
+		closeSubTargets(sh.subTargets)
+		sh.subTargets = nil
+		fallback.Close()
+		sh.log.Printf("Error loading fallback environment: %v", fallbackErr)
+		return err
+	}
+	// The error is shown by the fallback.
+	sh.fallbackActive = true
+	return nil
+}
+
+// setupEnvironment compiles the environment and makes it the current one.
+func (sh *Shader) setupEnvironment(env Environment) error {
 	renderState := RenderState{
-		Time:            sh.time,
+		Time:            sh.timeRange.at(sh.time),
 		FramesProcessed: sh.frame,
 		CanvasWidth:     sh.w,
 		CanvasHeight:    sh.h,
 		Uniforms:        sh.uniforms,
+		Logger:          sh.log.logger(),
 	}
 	if err := env.Setup(renderState); err != nil {
 		return fmt.Errorf("error setting up environment: %w", err)
@@ -199,17 +377,9 @@ func (sh *Shader) reloadEnvironment(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	sh.subTargets = map[string]*Shader{}
-	for name, env := range subEnvs {
-		s, err := NewShader(env.Width, env.Height, sh.glVersion)
-		if err != nil {
-			return err
-		}
-		s.SetEnvironment(env.Environment)
-		if err := s.reloadEnvironment(context.Background()); err != nil {
-			return err
-		}
-		sh.subTargets[name] = s
+	sh.subTargets, err = newSubTargets(subEnvs, sh.glVersion, sh.shared, sh.timeRange, sh.log)
+	if err != nil {
+		return err
 	}
 
 	sources, err := env.Sources()
@@ -222,44 +392,282 @@ func (sh *Shader) reloadEnvironment(ctx context.Context) error {
 	}
 	gl.UseProgram(sh.program)
 	sh.uniforms = ListUniforms(sh.program)
+	sh.uniformValues.setUniforms(sh.uniforms)
 	sh.vertLoc = uint32(gl.GetAttribLocation(sh.program, gl.Str("vert\x00")))
 
 	sh.env = env
 	return nil
 }
 
+// replaceEnvironment sets up env in place of the current environment, which
+// is kept if env fails to load.
+func (sh *Shader) replaceEnvironment(env Environment) error {
+	prevEnv, prevSubTargets, prevProgram := sh.env, sh.subTargets, sh.program
+	sh.subTargets = nil
+	if err := sh.setupEnvironment(env); err != nil {
+		closeSubTargets(sh.subTargets)
+		env.Close()
+		sh.env, sh.subTargets, sh.program = prevEnv, prevSubTargets, prevProgram
+		gl.UseProgram(sh.program)
+		return err
+	}
+	// Sub environments that are also used by the new environment are kept,
+	// as they are shared.
+	sh.history.retire(loadedEnvironment{prevEnv, prevSubTargets, prevProgram}, sh.fallbackActive)
+	sh.fallbackActive = false
+	return nil
+}
+
 func (sh *Shader) SetEnvironment(env Environment) {
 	sh.newEnvs <- env
 }
 
-func (sh *Shader) nextHandle(interval time.Duration) interface{} {
+// SetFallback sets a function that is called when an environment fails to
+// load. The environment it returns is rendered instead until the next
+// environment is set, in which case the error is not returned by Load.
+func (sh *Shader) SetFallback(fallback func(err error) Environment) {
+	sh.fallback = fallback
+}
+
+// SetKeepOnError makes the shader keep rendering the current environment when
+// a newly set one fails to load, rather than loading the fallback. The error
+// is passed to report, which is called while rendering. Setting nil restores
+// the default behavior.
+func (sh *Shader) SetKeepOnError(report func(err error)) {
+	sh.keepOnError = report
+}
+
+// EnableOutputs makes the shader render the specified outputs in addition to
+// the color of each pixel. The environment should write them in the same
+// order, starting at the second output. Images sent by Animate are then of
+// type *LayeredImage.
+//
+// It should be called before rendering the first frame.
+func (sh *Shader) EnableOutputs(outputs ...Output) error {
+	sh.outputs = outputs
+	return sh.setupRenderer()
+}
+
+// SetFloatPrecision makes the shader render the color of each pixel at 32-bit
+// floating point precision, without clamping it. The images sent by Animate
+// are not affected, but the previous frame and the output of sub environments
+// that are sampled by the environment are. Feedback shaders that keep their
+// state in the previous frame or a buffer, such as simulations of
+// reaction-diffusion, need this precision to work.
+//
+// The precision applies to the sub environments as well. It should be set
+// before rendering the first frame.
+func (sh *Shader) SetFloatPrecision(enable bool) error {
+	sh.shared.float = enable
+	return sh.setupRenderer()
+}
+
+// SetHDR makes the shader read back the color of each pixel at floating point
+// precision without clamping it, so values above 1.0 that are produced by
+// e.g. raymarching shaders are kept. The images sent by Animate are then of
+// type *HDRImage.
+//
+// bits is the precision of the framebuffer, 16 for half floats or 32. It is
+// disabled with 0. HDR images can not be combined with additional outputs. It
+// should be set before rendering the first frame.
+func (sh *Shader) SetHDR(bits int) error {
+	if bits != 0 && bits != 16 && bits != 32 {
+		return fmt.Errorf("invalid HDR precision: %d bits (valid: 16, 32)", bits)
+	}
+	sh.hdrBits = bits
+	return sh.setupRenderer()
+}
+
+// Resize changes the size of the frames that are rendered. The render targets
+// are replaced before the next frame is rendered, while the compiled
+// environment and the values of its uniforms are kept. Frames that were
+// already being rendered by Animate are sent at the previous size first.
+//
+// Sub environments that are sized relative to the canvas are resized along
+// with it, others keep their size. It may be called from any goroutine.
+func (sh *Shader) Resize(width, height uint) {
+	for {
+		select {
+		case sh.resizes <- [2]uint{width, height}:
+			return
+		default:
+			// Replace a size that was not applied yet.
+			select {
+			case <-sh.resizes:
+			default:
+			}
+		}
+	}
+}
+
+// applyResize replaces the render targets if the size was changed by Resize.
+func (sh *Shader) applyResize() {
+	select {
+	case size := <-sh.resizes:
+		sh.resize(size[0], size[1])
+	default:
+	}
+}
+
+// resize replaces the render targets with ones of the specified size. It
+// reports whether the size changed.
+func (sh *Shader) resize(width, height uint) bool {
+	if width == sh.w && height == sh.h {
+		return false
+	}
+	sh.w, sh.h = width, height
+	// The previous frame is of the previous size.
+	sh.prevFrameHandle = nil
+	if err := sh.setupRenderer(); err != nil {
+		sh.log.Printf("Error resizing to %dx%d: %v", sh.w, sh.h, err)
+	}
+	resizeSubTargets(sh.subTargets, sh.w, sh.h)
+	return true
+}
+
+// setupRenderer replaces the render targets.
+func (sh *Shader) setupRenderer() error {
+	if sh.hdrBits != 0 && len(sh.outputs) > 0 {
+		return fmt.Errorf("HDR images can not be combined with additional outputs")
+	}
+	if err := sh.renderer.Close(); err != nil {
+		return err
+	}
+	sh.feedback.close()
+	sh.renderer = &pboRenderer{w: sh.w, h: sh.h, outputs: sh.outputs, float: sh.shared.float, hdrBits: sh.hdrBits, frames: &sh.frames}
+	format := colorFormat(sh.shared.float, sh.hdrBits)
+	for _, p := range sh.postPasses {
+		p.allocate(sh.w, sh.h, format)
+	}
+	return sh.renderer.Setup()
+}
+
+// AddOverlay adds an overlay that is composited over every frame. Overlays
+// are drawn in the order in which they are added. Environments that read the
+// previous frame receive it without overlays.
+func (sh *Shader) AddOverlay(ov Overlay) error {
+	o, err := newOverlay(ov, sh.glVersion, sh.log)
+	if err != nil {
+		return err
+	}
+	sh.overlays = append(sh.overlays, o)
+	return nil
+}
+
+// AddPostPass adds a pass that processes every frame before overlays are
+// composited. Passes are applied in the order in which they are added.
+// Environments that read the previous frame receive it unprocessed.
+func (sh *Shader) AddPostPass(pp PostPass) error {
+	p, err := newPostPass(pp, sh.w, sh.h, colorFormat(sh.shared.float, sh.hdrBits))
+	if err != nil {
+		return err
+	}
+	sh.postPasses = append(sh.postPasses, p)
+	return nil
+}
+
+// SetRestartOnError makes Animate check for OpenGL errors after every frame.
+// If an error occurred, the render targets and the current environment are
+// set up again from scratch.
+func (sh *Shader) SetRestartOnError(restart bool) {
+	sh.restartOnError = restart
+}
+
+// Stats returns statistics about the rendering. It may be called from any
+// goroutine.
+func (sh *Shader) Stats() Stats {
+	return sh.stats.get()
+}
+
+// restart recreates the render targets and reloads the current environment.
+func (sh *Shader) restart() error {
+	sh.prevFrameHandle = nil
+	if err := sh.renderer.Close(); err != nil {
+		return err
+	}
+	if err := sh.renderer.Setup(); err != nil {
+		return err
+	}
+	env := sh.env
+	if env == nil {
+		return nil
+	}
+	env.Close()
+	closeSubTargets(sh.subTargets)
+	sh.subTargets = nil
+	gl.DeleteProgram(sh.program)
+	sh.env = nil
+	return sh.setupEnvironment(env)
+}
+
+// SetAccumulation configures the shader to render multiple samples for each
+// frame sent by Animate.
+func (sh *Shader) SetAccumulation(acc Accumulation) {
+	sh.accumulation = acc
+}
+
+// SetStereo configures the shader to render each frame once for every eye.
+// It should be called before rendering the first frame.
+func (sh *Shader) SetStereo(stereo Stereo) {
+	sh.stereo = stereo
+}
+
+// Load sets up the most recently set environment and compiles its sources
+// without rendering a frame. It blocks until an environment is set or the
+// context is canceled.
+func (sh *Shader) Load(ctx context.Context) error {
+	return sh.reloadEnvironment(ctx)
+}
+
+// Uniforms returns the active uniforms of the currently loaded program.
+func (sh *Shader) Uniforms() map[string]Uniform {
+	return sh.uniforms
+}
+
+// UniformValue reads the current value of an active uniform of the loaded
+// program, see Uniform.Value. Like Uniforms, it must be called from the
+// rendering thread, e.g. between calls to Image.
+func (sh *Shader) UniformValue(name string) ([]float32, bool) {
+	u, ok := sh.uniforms[name]
+	if !ok {
+		return nil, false
+	}
+	return u.Value(sh.program)
+}
+
+// nextHandle renders the next frame. interval is the time between frames,
+// advance the time by which the animation is advanced after the frame.
+func (sh *Shader) nextHandle(interval, advance time.Duration) interface{} {
 	if err := sh.reloadEnvironment(context.Background()); err != nil {
-		log.Printf("Error reloading environment: %v", err)
+		sh.log.Printf("Error reloading environment: %v", err)
 		return nil
 	}
 
 	prevTexID, freePrevTexID := uint32(0), func() {}
 	getPrevTexID := func() uint32 {
 		if sh.prevFrameHandle != nil && prevTexID == 0 {
-			prevTexID, freePrevTexID = sh.renderer.Texture(sh.prevFrameHandle)
+			if prevTexID = sh.feedback.texture(); prevTexID == 0 {
+				prevTexID, freePrevTexID = sh.renderer.Texture(sh.prevFrameHandle)
+			}
 		}
 		return prevTexID
 	}
 	defer freePrevTexID()
 
-	subTextures := map[string]uint32{}
-	freeSubTextures := []func(){}
-	for name, s := range sh.subTargets {
-		h := s.nextHandle(interval)
-		textureID, free := s.renderer.Texture(h)
-		subTextures[name] = textureID
-		freeSubTextures = append(freeSubTextures, free)
+	if gpuTime, ok := sh.timer.poll(); ok {
+		sh.stats.setGPUTime(gpuTime)
+	}
+	sh.timer.begin()
+	defer sh.timer.end()
+
+	if !sh.nested {
+		sh.shared.advance()
+		sh.applyMouse()
+	}
+	subTextures := renderSubTargets(sh.subTargets, advance)
+	for _, o := range sh.overlays {
+		o.prepare(advance)
 	}
-	defer func() {
-		for _, free := range freeSubTextures {
-			free()
-		}
-	}()
 
 	// Ensure that the render state is up to date.
 	gl.BindVertexArray(sh.vao)
@@ -268,71 +676,276 @@ func (sh *Shader) nextHandle(interval time.Duration) interface{} {
 	gl.EnableVertexAttribArray(sh.vertLoc)
 	gl.VertexAttribPointer(sh.vertLoc, 3, gl.FLOAT, false, 0, nil)
 
-	sh.env.PreRender(RenderState{
-		Time:               sh.time,
-		Interval:           interval,
+	samples := sh.accumulation.Samples
+	if samples == 0 {
+		samples = 1
+	}
+	state := RenderState{
+		Time:               sh.timeRange.at(sh.time + sh.sampleOffset),
+		Interval:           sh.timeRange.duration(interval),
 		FramesProcessed:    sh.frame,
 		CanvasWidth:        sh.w,
 		CanvasHeight:       sh.h,
 		Uniforms:           sh.uniforms,
 		PreviousFrameTexID: getPrevTexID,
 		SubBuffers:         subTextures,
-	})
-	sh.time += interval
-	sh.frame++
+		Sample:             sh.sample,
+		Samples:            samples,
+		Mouse:              sh.shared.mouse,
+		Logger:             sh.log.logger(),
+	}
+	if samples > 1 {
+		state.Jitter = jitter(sh.sample)
+	}
+	overlayFrame := OverlayFrame{
+		Time:     state.Time,
+		Interval: state.Interval,
+		Frame:    sh.frame,
+		Uniform: func(name string) ([]float32, bool) {
+			u, ok := sh.uniforms[name]
+			if !ok {
+				return nil, false
+			}
+			return u.Value(sh.program)
+		},
+	}
+	sh.time += advance
+	// The samples of an accumulated frame share its frame number.
+	if sh.sample+1 >= sh.accumulation.Samples {
+		sh.frame++
+	}
 
 	// Render the geometry.
 	handle := sh.renderer.Draw(func() {
-		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+		sh.stereo.draw(sh.uniformValues.wrap(sh.env), state)
+		if len(sh.postPasses) > 0 || len(sh.overlays) > 0 {
+			sh.feedback.keep(sh.w, sh.h, colorFormat(sh.shared.float, sh.hdrBits))
+		}
+		for _, p := range sh.postPasses {
+			p.draw(sh.w, sh.h)
+		}
+		for _, o := range sh.overlays {
+			o.draw(sh.w, sh.h, overlayFrame)
+		}
 	})
 	sh.prevFrameHandle = handle
 	return handle
 }
 
+// Animate renders frames that are interval apart and sends them on the
+// stream until the context is done. If no environment is set, it waits for
+// one. Rendering is pipelined, so frames are sent a few frames after they are
+// rendered. Frames that are still being rendered when the context is done are
+// discarded; the shader holds no resources for them and can be animated
+// again.
 func (sh *Shader) Animate(ctx context.Context, interval time.Duration, stream chan<- image.Image) {
-	buffer := make(chan interface{}, sh.renderer.NumBuffers())
+	// pendingFrame is a frame of which the rendering has been started.
+	type pendingFrame struct {
+		handle   interface{}
+		time     time.Duration
+		number   uint64
+		uniforms map[string]interface{}
+	}
+	buffer := make(chan pendingFrame, sh.renderer.NumBuffers())
+	// send reads back a rendered frame and sends it on the stream. It
+	// returns false if the context is done.
+	send := func(done pendingFrame) bool {
+		img := sh.renderer.Image(done.handle)
+		img = sh.runFrameHooks(img, func() (uint32, func()) { return sh.renderer.Texture(done.handle) }, done.time, done.number)
+		if img == nil {
+			// Hooks may drop every frame, in which case nothing is
+			// sent on which the context is checked.
+			return ctx.Err() == nil
+		}
+		return sh.sendFrame(ctx, stream, img, done.number, done.time, done.uniforms)
+	}
 	for {
 		if err := sh.reloadEnvironment(ctx); errors.Is(err, context.Canceled) {
 			return
 		} else if err != nil {
-			log.Printf("Error reloading environment: %v", err)
+			sh.log.Printf("Error reloading environment: %v", err)
+			continue
+		}
+		if len(sh.resizes) > 0 {
+			// The frames being rendered are lost with the render targets,
+			// so they are completed first.
+			for len(buffer) > 0 {
+				if !send(<-buffer) {
+					return
+				}
+			}
+			sh.applyResize()
+		}
+
+		if sh.accumulation.Samples > 1 {
+			t, number, uniforms := sh.timeRange.at(sh.time), sh.frame, sh.uniformSnapshot()
+			img := sh.accumulate(interval)
+			if img == nil {
+				continue
+			}
+			img = sh.runFrameHooks(img, func() (uint32, func()) { return imageTexture(img) }, t, number)
+			if img == nil {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			if !sh.sendFrame(ctx, stream, img, number, t, uniforms) {
+				return
+			}
 			continue
 		}
 
-		handle := sh.nextHandle(interval)
-		buffer <- handle
+		pending := pendingFrame{time: sh.timeRange.at(sh.time), number: sh.frame, uniforms: sh.uniformSnapshot()}
+		pending.handle = sh.nextHandle(interval, interval)
+		if sh.restartOnError {
+			if err := checkError(); err != nil {
+				sh.log.Printf("%v, restarting", err)
+				sh.stats.error(err)
+				// The pending frames are lost along with the render
+				// targets.
+				for len(buffer) > 0 {
+					<-buffer
+				}
+				if err := sh.restart(); err != nil {
+					sh.log.Printf("Error restarting: %v", err)
+				}
+				continue
+			}
+		}
+		buffer <- pending
 
 		if len(buffer) != cap(buffer) {
 			// Give the first renders time to complete.
 			continue
 		}
 
-		img := sh.renderer.Image(<-buffer)
-		select {
-		case <-ctx.Done():
+		if !send(<-buffer) {
 			return
-		case stream <- img:
 		}
 	}
 }
 
+// errFrameNotRendered is returned by Image if a newly set environment failed
+// to load while rendering, of which the error is logged.
+var errFrameNotRendered = errors.New("the frame could not be rendered, as the environment failed to load")
+
+// Image renders the next frame, advancing the animation by interval, and
+// returns it once it is complete. Frame hooks are run like with Animate; the
+// image is nil if a hook dropped the frame. If no environment is set, it
+// waits for one until the context is done, in which case the error of the
+// context is returned.
+//
+// Unlike Animate, rendering the frame is not overlapped with reading back the
+// previous one, which makes Image suited for rendering single frames.
+func (sh *Shader) Image(ctx context.Context, interval time.Duration) (image.Image, error) {
+	if err := sh.reloadEnvironment(ctx); err != nil {
+		return nil, err
+	}
+	if sh.env == nil {
+		return nil, fmt.Errorf("no environment is set")
+	}
+	sh.applyResize()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	t, number := sh.timeRange.at(sh.time), sh.frame
+	if sh.accumulation.Samples > 1 {
+		img := sh.accumulate(interval)
+		if img == nil {
+			return nil, errFrameNotRendered
+		}
+		return sh.runFrameHooks(img, func() (uint32, func()) { return imageTexture(img) }, t, number), nil
+	}
+	handle := sh.nextHandle(interval, interval)
+	if handle == nil {
+		return nil, errFrameNotRendered
+	}
+	img := sh.renderer.Image(handle)
+	return sh.runFrameHooks(img, func() (uint32, func()) { return sh.renderer.Texture(handle) }, t, number), nil
+}
+
+// RenderFrames renders n frames at fps frames per second, continuing from the
+// current time of the animation, and passes each to fn along with its number,
+// counting from 0. Frame i is rendered at exactly i/fps seconds after the
+// first, without rounding errors adding up. Rendering stops after the last
+// frame or when fn returns an error, which is returned. Frames dropped by
+// hooks are counted, but not passed to fn.
+//
+// Like Image, each frame is complete before the next is started, so the
+// animation is left at the frame after the last one.
+func (sh *Shader) RenderFrames(n int, fps float64, fn func(i int, img image.Image) error) error {
+	if fps <= 0 || math.IsInf(fps, 0) || math.IsNaN(fps) {
+		return fmt.Errorf("invalid frame rate: %v", fps)
+	}
+	at := func(i int) time.Duration {
+		return time.Duration(math.Round(float64(i) * float64(time.Second) / fps))
+	}
+	if sh.env == nil && len(sh.newEnvs) == 0 {
+		return fmt.Errorf("no environment is set")
+	}
+	for i := 0; i < n; i++ {
+		img, err := sh.Image(context.Background(), at(i+1)-at(i))
+		if err != nil {
+			return err
+		}
+		if img == nil {
+			continue
+		}
+		if err := fn(i, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (sh *Shader) Close() error {
 	var envErr error
 	if sh.env != nil {
 		envErr = sh.env.Close()
 	}
-	for _, s := range sh.subTargets {
-		s.Close()
+	closeSubTargets(sh.subTargets)
+	sh.history.close()
+	for _, p := range sh.postPasses {
+		p.close()
 	}
+	for _, o := range sh.overlays {
+		o.Close()
+	}
+	sh.timer.Close()
+	sh.feedback.close()
+	sh.uniformValues.closeTextures()
 	gl.DeleteProgram(sh.program)
 	gl.DeleteVertexArrays(1, &sh.vao)
 	gl.DeleteBuffers(1, &sh.vbo)
+	sh.debug.close()
 	if err := sh.renderer.Close(); err != nil {
 		return err
 	}
 	return envErr
 }
 
+// SetDebugOutput sets the writer to which the debug messages of OpenGL are
+// written while the shader is open. By default, and if nil, the messages are
+// discarded. The messages raised while rendering the sub
+// environments and overlays of the shader are written to it as well.
+//
+// All shaders share a single OpenGL context, so the messages raised while
+// another shader is rendering are written as well.
+func (sh *Shader) SetDebugOutput(w io.Writer) {
+	sh.debug.setOutput(w)
+}
+
+// SetDebugHandler passes the debug messages of OpenGL of at least severity min
+// to h instead of writing them, e.g. to integrate them with the logging of the
+// application with DebugLogger or to receive them on a channel with
+// DebugChannel. If h is nil, the messages are discarded. Like SetDebugOutput,
+// this applies to the sub environments and overlays of the shader as well.
+func (sh *Shader) SetDebugHandler(min DebugSeverity, h DebugHandler) {
+	sh.debug.setHandler(min, h)
+}
+
 // OnScreenEngine is an animation engine for rendering to an OS window.
 //
 // Internally, it renders to a framebuffer so we can obtain a texture
@@ -355,50 +968,115 @@ type OnScreenEngine struct {
 	}
 
 	program    uint32
-	subTargets map[string]*Shader
+	subTargets map[string]*subTarget
+	shared     sharedTargets
 	uniforms   map[string]Uniform
-
-	time  time.Duration
-	frame uint64
+	stereo     Stereo
+	fallback   func(error) Environment
+	// fallbackActive, history and keepOnError are like those of Shader.
+	fallbackActive bool
+	history        environmentHistory
+	keepOnError    func(error)
+	overlays       []*overlay
+	feedback       feedbackFrame
+
+	time      time.Duration
+	timeRange timeRange
+	frame     uint64
+
+	controls PreviewControls
+	// paused stops time, showing the last frame rendered. stale is set if
+	// that frame no longer matches the window or environment, in which case
+	// it is rendered again.
+	paused, stale bool
+	screenshot    bool
+	// clip receives the frames of the clip being recorded, if any.
+	clip       chan image.Image
+	clipFrames int
+	// actions are the calls of the controls made from other goroutines,
+	// which are run before the next frame is rendered.
+	actions chan func()
+	mouse   Mouse
+	frames  chan<- image.Image
+	// compare is the environment that is compared with env, which is
+	// loaded from compareEnvs.
+	compare     compareEnvironment
+	compareEnvs chan Environment
+	compareMode CompareMode
+	// view is the part of the frame shown in the window, which is zoomed
+	// into to inspect pixels. title is the title of the window.
+	view  view
+	title string
 
 	window *glfw.Window
+	debug  *debugLog
+	log    *logOutput
 }
 
 func NewOnScreenEngine(glVersion OpenGLVersion) (*OnScreenEngine, error) {
-	if err := glfw.Init(); err != nil {
-		return nil, err
+	return NewOnScreenEngineContext(context.Background(), glVersion)
+}
+
+// NewOnScreenEngineContext is like NewOnScreenEngine, but gives up setting up
+// the window and OpenGL once the context is done, see NewShaderContext.
+func NewOnScreenEngineContext(ctx context.Context, glVersion OpenGLVersion) (*OnScreenEngine, error) {
+	if err := runStage(ctx, "GLFW initialization", glfw.Init); err != nil {
+		return nil, setupError("GLFW initialization", err, windowHint())
 	}
 
-	maj, min := glVersion.majorMinor()
-	glfw.WindowHint(glfw.ContextVersionMajor, maj)
-	glfw.WindowHint(glfw.ContextVersionMinor, min)
-	window, err := glfw.CreateWindow(1366, 768, "Shady", nil, nil)
-	if err != nil {
-		glfw.Terminate()
-		return nil, err
+	var window *glfw.Window
+	if err := runStage(ctx, "window", func() (err error) {
+		maj, min := glVersion.majorMinor()
+		glfw.WindowHint(glfw.ContextVersionMajor, maj)
+		glfw.WindowHint(glfw.ContextVersionMinor, min)
+		window, err = glfw.CreateWindow(1366, 768, "Shady", nil, nil)
+		var glfwErr *glfw.Error
+		if errors.As(err, &glfwErr) && glfwErr.Code == glfw.VersionUnavailable {
+			return setupError("window", err, versionHint(glVersion, newestSupported(glVersion, glfwVersionSupported)))
+		}
+		return setupError("window", err, windowHint())
+	}); err != nil {
+		// Terminating while the window is being created elsewhere is not
+		// safe.
+		if !errors.As(err, new(*StallError)) {
+			glfw.Terminate()
+		}
+		return nil, setupError("window", err, "")
 	}
 	window.MakeContextCurrent()
 
-	if err := initOpenGL(); err != nil {
+	if err := initOpenGL(ctx); err != nil {
 		window.Destroy()
 		glfw.Terminate()
 		return nil, err
 	}
+	debugOutput.install()
 
 	eng := &OnScreenEngine{
-		newEnvs: make(chan Environment, 1),
-		window:  window,
+		newEnvs:     make(chan Environment, 1),
+		actions:     make(chan func(), 16),
+		compareEnvs: make(chan Environment, 1),
+		window:      window,
+		title:       "Shady",
+		debug:       newDebugLog(),
+		log:         newLogOutput(),
 	}
 
 	w, h := eng.window.GetFramebufferSize()
 	eng.onResize(window, w, h)
 	window.SetSizeCallback(eng.onResize)
+	window.SetKeyCallback(eng.onKey)
+	window.SetCursorPosCallback(eng.onCursorPos)
+	window.SetMouseButtonCallback(eng.onMouseButton)
+	window.SetScrollCallback(eng.onScroll)
 
+	var err error
 	eng.copyProgram, err = linkProgram(map[Stage][]Source{
 		StageVertex:   {textureCopyVert},
 		StageFragment: {textureCopyFrag},
 	})
 	if err != nil {
+		eng.debug.close()
 		return nil, err
 	}
 
@@ -431,8 +1109,13 @@ func (eng *OnScreenEngine) onResize(win *glfw.Window, width int, height int) {
 	}
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 	gl.BindTexture(gl.TEXTURE_2D, 0)
+	eng.feedback.close()
 
 	gl.Viewport(0, 0, int32(width), int32(height))
+	fw, fh := win.GetFramebufferSize()
+	resizeSubTargets(eng.subTargets, uint(fw), uint(fh))
+	resizeSubTargets(eng.compare.subTargets, uint(fw), uint(fh))
+	eng.stale = true
 }
 
 func (eng *OnScreenEngine) Animate(ctx context.Context) error {
@@ -447,37 +1130,102 @@ func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 			return ctx.Err()
 		}
 
+		for len(eng.actions) > 0 {
+			(<-eng.actions)()
+		}
 		if err := eng.reloadEnvironment(ctx); errors.Is(err, context.Canceled) {
 			return err
 		} else if err != nil {
-			log.Printf("Error reloading environment: %v", err)
+			eng.log.Printf("Error reloading environment: %v", err)
 			continue
 		}
+		eng.reloadCompare()
 
+		w, h := eng.window.GetFramebufferSize()
 		gl.BindVertexArray(eng.quadVAO)
 		gl.BindBuffer(gl.ARRAY_BUFFER, eng.quadVBO)
 
-		target := &eng.targets[i%len(eng.targets)]
-		prevTarget := &eng.targets[(i+len(eng.targets)-1)%len(eng.targets)]
+		// While paused, the last frame is shown again.
+		target := &eng.targets[(i+len(eng.targets)-1)%len(eng.targets)]
+		rendered := !eng.paused || eng.stale
+		if rendered {
+			target = &eng.targets[i%len(eng.targets)]
+			prevTarget := &eng.targets[(i+len(eng.targets)-1)%len(eng.targets)]
+
+			// Render the buffers of the sub environments first, each at
+			// their own resolution.
+			eng.shared.advance()
+			mouse := eng.mouse
+			eng.shared.mouse = &mouse
+			eng.mouse.Clicked = false
+			subTextures := renderSubTargets(eng.subTargets, interval)
+			for _, o := range eng.overlays {
+				o.prepare(interval)
+			}
 
-		// 1st pass: render the actual image.
-		w, h := eng.window.GetFramebufferSize()
-		gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
-		gl.UseProgram(eng.program)
-		eng.env.PreRender(RenderState{
-			Time:               eng.time,
-			Interval:           interval,
-			FramesProcessed:    eng.frame,
-			CanvasWidth:        uint(w),
-			CanvasHeight:       uint(h),
-			Uniforms:           eng.uniforms,
-			PreviousFrameTexID: func() uint32 { return prevTarget.tex },
-			SubBuffers:         nil, // TODO
-		})
+			// The previous frame is kept without overlays, if there are
+			// any.
+			prevTexID := func() uint32 {
+				if tex := eng.feedback.texture(); tex != 0 {
+					return tex
+				}
+				return prevTarget.tex
+			}
 
-		gl.EnableVertexAttribArray(eng.vertLoc)
-		gl.VertexAttribPointer(eng.vertLoc, 3, gl.FLOAT, false, 0, nil)
-		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+			// 1st pass: render the actual image.
+			gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
+			gl.Viewport(0, 0, int32(w), int32(h))
+			gl.UseProgram(eng.program)
+			gl.EnableVertexAttribArray(eng.vertLoc)
+			gl.VertexAttribPointer(eng.vertLoc, 3, gl.FLOAT, false, 0, nil)
+			state := RenderState{
+				Time:               eng.timeRange.at(eng.time),
+				Interval:           eng.timeRange.duration(interval),
+				FramesProcessed:    eng.frame,
+				CanvasWidth:        uint(w),
+				CanvasHeight:       uint(h),
+				Uniforms:           eng.uniforms,
+				PreviousFrameTexID: prevTexID,
+				SubBuffers:         subTextures,
+				Mouse:              &mouse,
+				Logger:             eng.log.logger(),
+			}
+			eng.stereo.draw(eng.env, state)
+			eng.drawCompare(target.fbo, w, h, state, interval)
+			if len(eng.overlays) > 0 {
+				gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
+				eng.feedback.keep(uint(w), uint(h), gl.RGB8)
+			}
+			for _, o := range eng.overlays {
+				o.draw(uint(w), uint(h), OverlayFrame{
+					Time:     eng.timeRange.at(eng.time),
+					Interval: eng.timeRange.duration(interval),
+					Frame:    eng.frame,
+					Uniform: func(name string) ([]float32, bool) {
+						u, ok := eng.uniforms[name]
+						if !ok {
+							return nil, false
+						}
+						return u.Value(eng.program)
+					},
+				})
+			}
+			gl.Viewport(0, 0, int32(w), int32(h))
+			eng.frame++
+			eng.stale = false
+			i++
+		}
+		if eng.screenshot {
+			eng.screenshot = false
+			go eng.controls.Screenshot(readFramebuffer(target.fbo, w, h))
+		}
+		if eng.frames != nil && rendered && len(eng.frames) < cap(eng.frames) {
+			eng.frames <- readFramebuffer(target.fbo, w, h)
+		}
+		if eng.clip != nil && rendered {
+			eng.recordClipFrame(readFramebuffer(target.fbo, w, h))
+		}
+		eng.inspectPixel(target.fbo, w, h)
 
 		// 2nd pass: copy the rendered image to the on-screen framebuffer.
 		gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
@@ -488,6 +1236,8 @@ func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 			gl.GetUniformLocation(eng.copyProgram, gl.Str("screenTexture\x00")),
 			0,
 		)
+		gl.Uniform1f(gl.GetUniformLocation(eng.copyProgram, gl.Str("zoom\x00")), float32(eng.view.scale()))
+		gl.Uniform2f(gl.GetUniformLocation(eng.copyProgram, gl.Str("offset\x00")), float32(eng.view.offset[0]), float32(eng.view.offset[1]))
 
 		loc := uint32(gl.GetAttribLocation(eng.copyProgram, gl.Str("pos\x00")))
 		gl.EnableVertexAttribArray(loc)
@@ -497,16 +1247,60 @@ func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 		now := time.Now()
 		interval = now.Sub(lastFrame)
 		lastFrame = now
-		eng.time += interval
-		eng.frame++
-		i++
+		if eng.clip != nil {
+			// The clip is recorded at a fixed rate, regardless of how
+			// long reading and encoding the frames takes.
+			interval = eng.controls.clipInterval()
+		}
+		if !eng.paused {
+			eng.time += interval
+		}
 
 		eng.window.SwapBuffers()
 		glfw.PollEvents()
 	}
 }
 
+// Size returns the size of the frames rendered to the window, which changes as
+// the window is resized. It must be called from the thread that created the
+// engine.
+func (eng *OnScreenEngine) Size() (uint, uint) {
+	w, h := eng.window.GetFramebufferSize()
+	return uint(w), uint(h)
+}
+
+// SetStereo configures the engine to render each frame once for every eye.
+func (eng *OnScreenEngine) SetStereo(stereo Stereo) {
+	eng.stereo = stereo
+}
+
+// SetDebugOutput sets the writer to which the debug messages of OpenGL are
+// written. By default, and if nil, the messages are discarded.
+func (eng *OnScreenEngine) SetDebugOutput(w io.Writer) {
+	eng.debug.setOutput(w)
+}
+
+// SetDebugHandler passes the debug messages of OpenGL of at least severity min
+// to h, see Shader.SetDebugHandler.
+func (eng *OnScreenEngine) SetDebugHandler(min DebugSeverity, h DebugHandler) {
+	eng.debug.setHandler(min, h)
+}
+
+// SetLogger sets the logger to which errors that do not stop the engine are
+// written, see Shader.SetLogger.
+func (eng *OnScreenEngine) SetLogger(l *log.Logger) {
+	eng.log.set(l)
+}
+
 func (eng *OnScreenEngine) Close() error {
+	eng.stopClip()
+	eng.closeCompare()
+	eng.history.close()
+	for _, o := range eng.overlays {
+		o.Close()
+	}
+	eng.feedback.close()
+	eng.debug.close()
 	eng.window.Destroy()
 	glfw.Terminate()
 	return nil
@@ -521,34 +1315,78 @@ func (eng *OnScreenEngine) reloadEnvironment(ctx context.Context) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		case env = <-eng.newEnvs:
+		case l := <-eng.history.rollbacks:
+			eng.restoreEnvironment(l)
+			return nil
 		}
 	} else {
 		// If an environment is already set, check if a newer environment is
 		// available or just exit.
 		select {
 		case env = <-eng.newEnvs:
+		case l := <-eng.history.rollbacks:
+			eng.restoreEnvironment(l)
+			return nil
 		default:
 			return nil
 		}
 	}
 
-	// Close the old environment if there is one.
+	if eng.env != nil && env != nil && eng.keepOnError != nil {
+		if err := eng.replaceEnvironment(env); err != nil {
+			eng.keepOnError(err)
+		}
+		// The frame shown while paused is rendered again, as the error may
+		// be shown in it.
+		eng.stale = true
+		return nil
+	}
+
+	// Retire the old environment if there is one.
 	if eng.env != nil {
-		eng.env.Close()
-		gl.DeleteProgram(eng.program)
-		eng.env = nil
+		eng.history.retire(loadedEnvironment{eng.env, eng.subTargets, eng.program}, eng.fallbackActive)
+		eng.env, eng.subTargets, eng.fallbackActive = nil, nil, false
 	}
 	if env == nil {
 		return nil
 	}
 
+	err := eng.setupEnvironment(env)
+	if err == nil {
+		return nil
+	}
+	closeSubTargets(eng.subTargets)
+	eng.subTargets = nil
+	env.Close()
+	if eng.fallback == nil {
+		return err
+	}
+	fallback := eng.fallback(err)
+	if fallback == nil {
+		return err
+	}
+	if fallbackErr := eng.setupEnvironment(fallback); fallbackErr != nil {
+		closeSubTargets(eng.subTargets)
+		eng.subTargets = nil
+		fallback.Close()
+		eng.log.Printf("Error loading fallback environment: %v", fallbackErr)
+		return err
+	}
+	// The error is shown by the fallback.
+	eng.fallbackActive = true
+	return nil
+}
+
+// setupEnvironment compiles the environment and makes it the current one.
+func (eng *OnScreenEngine) setupEnvironment(env Environment) error {
 	w, h := eng.window.GetFramebufferSize()
 	renderState := RenderState{
-		Time:            eng.time,
+		Time:            eng.timeRange.at(eng.time),
 		FramesProcessed: eng.frame,
 		CanvasWidth:     uint(w),
 		CanvasHeight:    uint(h),
 		Uniforms:        eng.uniforms,
+		Logger:          eng.log.logger(),
 	}
 	if err := env.Setup(renderState); err != nil {
 		return fmt.Errorf("error setting up environment: %w", err)
@@ -558,17 +1396,9 @@ func (eng *OnScreenEngine) reloadEnvironment(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	eng.subTargets = map[string]*Shader{}
-	for name, env := range subEnvs {
-		s, err := NewShader(env.Width, env.Height, eng.glVersion)
-		if err != nil {
-			return err
-		}
-		s.SetEnvironment(env.Environment)
-		if err := s.reloadEnvironment(context.Background()); err != nil {
-			return err
-		}
-		eng.subTargets[name] = s
+	eng.subTargets, err = newSubTargets(subEnvs, eng.glVersion, &eng.shared, eng.timeRange, eng.log)
+	if err != nil {
+		return err
 	}
 
 	sources, err := env.Sources()
@@ -584,6 +1414,26 @@ func (eng *OnScreenEngine) reloadEnvironment(ctx context.Context) error {
 	eng.vertLoc = uint32(gl.GetAttribLocation(eng.program, gl.Str("vert\x00")))
 
 	eng.env = env
+	eng.stale = true
+	return nil
+}
+
+// replaceEnvironment sets up env in place of the current environment, which
+// is kept if env fails to load. See Shader.replaceEnvironment.
+func (eng *OnScreenEngine) replaceEnvironment(env Environment) error {
+	prevEnv, prevSubTargets, prevProgram := eng.env, eng.subTargets, eng.program
+	eng.subTargets = nil
+	if err := eng.setupEnvironment(env); err != nil {
+		closeSubTargets(eng.subTargets)
+		env.Close()
+		eng.env, eng.subTargets, eng.program = prevEnv, prevSubTargets, prevProgram
+		gl.UseProgram(eng.program)
+		return err
+	}
+	// Sub environments that are also used by the new environment are kept,
+	// as they are shared.
+	eng.history.retire(loadedEnvironment{prevEnv, prevSubTargets, prevProgram}, eng.fallbackActive)
+	eng.fallbackActive = false
 	return nil
 }
 
@@ -591,6 +1441,30 @@ func (eng *OnScreenEngine) SetEnvironment(env Environment) {
 	eng.newEnvs <- env
 }
 
+// SetFallback sets a function that is called when an environment fails to
+// load. See Shader.SetFallback.
+func (eng *OnScreenEngine) SetFallback(fallback func(err error) Environment) {
+	eng.fallback = fallback
+}
+
+// SetKeepOnError makes the engine keep rendering the current environment when
+// a newly set one fails to load. See Shader.SetKeepOnError.
+func (eng *OnScreenEngine) SetKeepOnError(report func(err error)) {
+	eng.keepOnError = report
+}
+
+// AddOverlay adds an overlay that is composited over every frame, see
+// Shader.AddOverlay. Overlays are part of the frames that are sent to the
+// frame stream and taken as screenshots, but not of the previous frame.
+func (eng *OnScreenEngine) AddOverlay(ov Overlay) error {
+	o, err := newOverlay(ov, eng.glVersion, eng.log)
+	if err != nil {
+		return err
+	}
+	eng.overlays = append(eng.overlays, o)
+	return nil
+}
+
 type renderer interface {
 	io.Closer
 	Setup() error
@@ -606,10 +1480,24 @@ type imageRenderer interface {
 }
 
 type pboRenderer struct {
-	w, h           uint
+	w, h    uint
+	outputs []Output
+	// float makes the color attachment store 32-bit floats, which are
+	// copied to textures directly rather than through the 8-bit PBO.
+	float bool
+	// hdrBits is the precision of the floats the color attachment is
+	// stored and read back as in addition to 8 bits, or 0.
+	hdrBits int
+	// frames holds the buffers that frames are read back into, if set.
+	frames         *framePool
 	curTargetIndex int
 	targets        [3]struct {
 		pbo, rbo, fbo uint32
+		// hdrPBO holds the color at float precision if hdrBits is set.
+		hdrPBO uint32
+		// aux holds a renderbuffer and pixelbuffer for each additional
+		// output.
+		aux []struct{ pbo, rbo uint32 }
 	}
 }
 
@@ -622,7 +1510,7 @@ func (pr *pboRenderer) Setup() error {
 		// Color renderbuffer.
 		gl.GenRenderbuffers(1, &t.rbo)
 		gl.BindRenderbuffer(gl.RENDERBUFFER, t.rbo)
-		gl.RenderbufferStorage(gl.RENDERBUFFER, gl.RGBA8, int32(pr.w), int32(pr.h))
+		gl.RenderbufferStorage(gl.RENDERBUFFER, colorFormat(pr.float, pr.hdrBits), int32(pr.w), int32(pr.h))
 
 		gl.FramebufferRenderbuffer(gl.DRAW_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.RENDERBUFFER, t.rbo)
 		gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
@@ -632,6 +1520,32 @@ func (pr *pboRenderer) Setup() error {
 		gl.GenBuffers(1, &t.pbo)
 		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, t.pbo)
 		gl.BufferData(gl.PIXEL_PACK_BUFFER, int(pr.w*pr.h*4), nil, gl.DYNAMIC_READ)
+		if pr.hdrBits != 0 {
+			gl.GenBuffers(1, &t.hdrPBO)
+			gl.BindBuffer(gl.PIXEL_PACK_BUFFER, t.hdrPBO)
+			gl.BufferData(gl.PIXEL_PACK_BUFFER, int(pr.w*pr.h*4*4), nil, gl.DYNAMIC_READ)
+		}
+
+		// Additional outputs, rendered to the next color attachments.
+		t.aux = make([]struct{ pbo, rbo uint32 }, len(pr.outputs))
+		drawBuffers := []uint32{gl.COLOR_ATTACHMENT0}
+		for j, output := range pr.outputs {
+			aux := &t.aux[j]
+			attachment := gl.COLOR_ATTACHMENT1 + uint32(j)
+			gl.GenRenderbuffers(1, &aux.rbo)
+			gl.BindRenderbuffer(gl.RENDERBUFFER, aux.rbo)
+			gl.RenderbufferStorage(gl.RENDERBUFFER, output.internalFormat(), int32(pr.w), int32(pr.h))
+			gl.FramebufferRenderbuffer(gl.DRAW_FRAMEBUFFER, attachment, gl.RENDERBUFFER, aux.rbo)
+			drawBuffers = append(drawBuffers, attachment)
+
+			gl.GenBuffers(1, &aux.pbo)
+			gl.BindBuffer(gl.PIXEL_PACK_BUFFER, aux.pbo)
+			gl.BufferData(gl.PIXEL_PACK_BUFFER, int(pr.w*pr.h)*output.Components()*4, nil, gl.DYNAMIC_READ)
+		}
+		gl.DrawBuffers(int32(len(drawBuffers)), &drawBuffers[0])
+		if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
+			return fmt.Errorf("incomplete framebuffer")
+		}
 	}
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
@@ -645,11 +1559,30 @@ func (pr *pboRenderer) NumBuffers() int {
 
 func (pr *pboRenderer) Image(handle interface{}) image.Image {
 	i := handle.(int)
-	img := image.NewRGBA(image.Rect(0, 0, int(pr.w), int(pr.h)))
+	img := pr.frames.get(pr.w, pr.h)
 	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, pr.targets[i].pbo)
 	gl.GetBufferSubData(gl.PIXEL_PACK_BUFFER, 0, int(pr.w*pr.h*4), gl.Ptr(&img.Pix[0]))
 	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
-	return img
+	if pr.hdrBits != 0 {
+		hdr := &HDRImage{RGBA: img, Float: make([]float32, len(img.Pix))}
+		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, pr.targets[i].hdrPBO)
+		gl.GetBufferSubData(gl.PIXEL_PACK_BUFFER, 0, len(hdr.Float)*4, gl.Ptr(&hdr.Float[0]))
+		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+		return hdr
+	}
+	if len(pr.outputs) == 0 {
+		return img
+	}
+
+	layered := &LayeredImage{RGBA: img}
+	for j, output := range pr.outputs {
+		data := make([]float32, int(pr.w*pr.h)*output.Components())
+		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, pr.targets[i].aux[j].pbo)
+		gl.GetBufferSubData(gl.PIXEL_PACK_BUFFER, 0, len(data)*4, gl.Ptr(&data[0]))
+		layered.setOutput(output, data)
+	}
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+	return layered
 }
 
 // Draw instructs OpenGL to render a single image with the scene drawn by
@@ -659,11 +1592,23 @@ func (pr *pboRenderer) Draw(drawFunc func()) interface{} {
 	pr.curTargetIndex = (pr.curTargetIndex + 1) % len(pr.targets)
 	t := &pr.targets[pr.curTargetIndex]
 	gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+	gl.Viewport(0, 0, int32(pr.w), int32(pr.h))
 	gl.Clear(gl.COLOR_BUFFER_BIT)
 	drawFunc()
 	// Start the transfer of the image to the PBO.
 	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, t.pbo)
 	gl.ReadPixels(0, 0, int32(pr.w), int32(pr.h), gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	if pr.hdrBits != 0 {
+		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, t.hdrPBO)
+		gl.ReadPixels(0, 0, int32(pr.w), int32(pr.h), gl.RGBA, gl.FLOAT, nil)
+	}
+	for j, output := range pr.outputs {
+		gl.ReadBuffer(gl.COLOR_ATTACHMENT1 + uint32(j))
+		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, t.aux[j].pbo)
+		gl.ReadPixels(0, 0, int32(pr.w), int32(pr.h), output.format(), gl.FLOAT, nil)
+	}
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 	return pr.curTargetIndex
 }
@@ -673,15 +1618,26 @@ func (pr *pboRenderer) Texture(handle interface{}) (uint32, func()) {
 	var tex uint32
 	gl.GenTextures(1, &tex)
 	gl.BindTexture(gl.TEXTURE_2D, tex)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(pr.w), int32(pr.h), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
 
-	gl.BindBuffer(gl.PIXEL_UNPACK_BUFFER, t.pbo)
-	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(pr.w), int32(pr.h), gl.RGBA, gl.UNSIGNED_BYTE, nil)
-	gl.BindBuffer(gl.PIXEL_UNPACK_BUFFER, 0)
+	if pr.float {
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA32F, int32(pr.w), int32(pr.h), 0, gl.RGBA, gl.FLOAT, nil)
+		// Textures are requested while drawing, so the framebuffer that is
+		// being drawn to is restored.
+		var prev int32
+		gl.GetIntegerv(gl.READ_FRAMEBUFFER_BINDING, &prev)
+		gl.BindFramebuffer(gl.READ_FRAMEBUFFER, t.fbo)
+		gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, int32(pr.w), int32(pr.h))
+		gl.BindFramebuffer(gl.READ_FRAMEBUFFER, uint32(prev))
+	} else {
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(pr.w), int32(pr.h), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+		gl.BindBuffer(gl.PIXEL_UNPACK_BUFFER, t.pbo)
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(pr.w), int32(pr.h), gl.RGBA, gl.UNSIGNED_BYTE, nil)
+		gl.BindBuffer(gl.PIXEL_UNPACK_BUFFER, 0)
+	}
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 	return tex, func() {
 		gl.DeleteTextures(1, &tex)
@@ -693,10 +1649,28 @@ func (pr *pboRenderer) Close() error {
 		gl.DeleteFramebuffers(1, &t.fbo)
 		gl.DeleteRenderbuffers(1, &t.rbo)
 		gl.DeleteBuffers(1, &t.pbo)
+		if t.hdrPBO != 0 {
+			gl.DeleteBuffers(1, &t.hdrPBO)
+		}
+		for _, aux := range t.aux {
+			gl.DeleteRenderbuffers(1, &aux.rbo)
+			gl.DeleteBuffers(1, &aux.pbo)
+		}
 	}
 	return nil
 }
 
+// colorFormat returns the internal format of the color of rendered frames.
+func colorFormat(float bool, hdrBits int) uint32 {
+	switch {
+	case float || hdrBits == 32:
+		return gl.RGBA32F
+	case hdrBits == 16:
+		return gl.RGBA16F
+	}
+	return gl.RGBA8
+}
+
 type OpenGLVersion int
 
 func ParseOpenGLVersion(s string) (OpenGLVersion, error) {
@@ -0,0 +1,96 @@
+// Package rendertest provides helpers for testing shaders and environments
+// with an actual OpenGL implementation.
+//
+// Tests that render should start with RequireGL, which skips them on machines
+// without a usable OpenGL context, such as most CI runners:
+//
+//	func TestMyShader(t *testing.T) {
+//		rendertest.RequireGL(t)
+//		img := rendertest.Render(t, env, 64, 64)
+//		...
+//	}
+//
+// With SoftwareFallback, machines without a GPU or display fall back to Mesa's
+// software rasterizer instead, so the tests still run.
+package rendertest
+
+import (
+	"context"
+	"image"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// SoftwareFallback makes RequireGL retry with Mesa's software rasterizer on a
+// surfaceless platform if no OpenGL context can be created otherwise. It is
+// enabled by setting SHADY_SOFTWARE_GL=1 in the environment, or by setting it
+// from TestMain.
+var SoftwareFallback = os.Getenv("SHADY_SOFTWARE_GL") == "1"
+
+// RequireGL skips the test if no OpenGL 3.3 context can be created.
+func RequireGL(t testing.TB) {
+	t.Helper()
+	err := probe()
+	if err != nil && SoftwareFallback {
+		useSoftwareRendering()
+		err = probe()
+	}
+	if err != nil {
+		t.Skipf("OpenGL is not available: %v", err)
+	}
+}
+
+// probeTimeout bounds the time to set up OpenGL, so that tests are skipped
+// rather than hanging on broken drivers.
+const probeTimeout = 30 * time.Second
+
+func probe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	sh, err := renderer.NewShaderContext(ctx, 1, 1, renderer.OpenGL33)
+	if err != nil {
+		return err
+	}
+	return sh.Close()
+}
+
+// useSoftwareRendering configures Mesa to render in software without a
+// display. Settings from the environment take precedence.
+func useSoftwareRendering() {
+	for k, v := range map[string]string{
+		"LIBGL_ALWAYS_SOFTWARE": "1",
+		"EGL_PLATFORM":          "surfaceless",
+	} {
+		if _, ok := os.LookupEnv(k); !ok {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+// Render renders the first frame of the environment at the specified size.
+// The test fails if the environment can not be loaded. RequireGL should be
+// called first.
+func Render(t testing.TB, env renderer.Environment, width, height uint) *image.RGBA {
+	t.Helper()
+	sh, err := renderer.NewShader(width, height, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetEnvironment(env)
+	if err := sh.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := sh.Image(context.Background(), time.Second/60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layered, ok := img.(*renderer.LayeredImage); ok {
+		return layered.RGBA
+	}
+	return img.(*image.RGBA)
+}
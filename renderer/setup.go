@@ -0,0 +1,99 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+
+	"github.com/polyfloyd/shady/egl"
+)
+
+// A SetupError is returned when a stage of setting up OpenGL failed. Hint
+// suggests how the problem may be solved, if the cause could be determined.
+type SetupError struct {
+	// Stage describes the step that failed, e.g. "EGL display".
+	Stage string
+	Hint  string
+	Err   error
+}
+
+func (err *SetupError) Error() string {
+	if err.Hint == "" {
+		return fmt.Sprintf("setting up OpenGL failed at the %s stage: %v", err.Stage, err.Err)
+	}
+	return fmt.Sprintf("setting up OpenGL failed at the %s stage: %v; %s", err.Stage, err.Err, err.Hint)
+}
+
+func (err *SetupError) Unwrap() error {
+	return err.Err
+}
+
+// setupError wraps an error of a stage. Stalls and errors that are already
+// wrapped are returned as is.
+func setupError(stage string, err error, hint string) error {
+	if err == nil || errors.As(err, new(*StallError)) || errors.As(err, new(*SetupError)) {
+		return err
+	}
+	return &SetupError{Stage: stage, Hint: hint, Err: err}
+}
+
+// noDisplayServer reports whether no X11 or Wayland display server is
+// configured.
+func noDisplayServer() bool {
+	return os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+}
+
+// displayHint suggests how to render if no display could be opened.
+func displayHint(p egl.Platform) string {
+	if p == egl.PlatformDefault && noDisplayServer() {
+		return "no display server is running, select the device or surfaceless EGL platform to render without one"
+	}
+	return ""
+}
+
+// windowHint suggests how to render if no window could be created.
+func windowHint() string {
+	if noDisplayServer() {
+		return "no display server is running, render offscreen or run under a virtual display server such as Xvfb"
+	}
+	return ""
+}
+
+// versionHint suggests how to render if the driver does not support the
+// requested version of OpenGL. supported is the newest version that it does
+// support, 0 if none.
+func versionHint(requested, supported OpenGLVersion) string {
+	if supported == 0 {
+		return fmt.Sprintf("the driver does not support OpenGL %s or any earlier version, check that a hardware driver or Mesa is installed", requested)
+	}
+	return fmt.Sprintf("the driver supports up to OpenGL %s, select it or an earlier GLSL version", supported)
+}
+
+// newestSupported returns the newest version before v for which try
+// succeeds, 0 if none.
+func newestSupported(v OpenGLVersion, try func(OpenGLVersion) bool) OpenGLVersion {
+	for _, earlier := range []OpenGLVersion{OpenGL33, OpenGL32, OpenGL31, OpenGL30, OpenGL21, OpenGL20} {
+		if earlier < v && try(earlier) {
+			return earlier
+		}
+	}
+	return 0
+}
+
+// glfwVersionSupported reports whether a window with a context of the version
+// can be created.
+func glfwVersionSupported(v OpenGLVersion) bool {
+	defer glfw.DefaultWindowHints()
+	maj, min := v.majorMinor()
+	glfw.WindowHint(glfw.Visible, glfw.False)
+	glfw.WindowHint(glfw.ContextVersionMajor, maj)
+	glfw.WindowHint(glfw.ContextVersionMinor, min)
+	window, err := glfw.CreateWindow(1, 1, "", nil, nil)
+	if err != nil {
+		return false
+	}
+	window.Destroy()
+	return true
+}
@@ -0,0 +1,20 @@
+package renderer
+
+import "testing"
+
+func TestNewestSupported(t *testing.T) {
+	var tried []OpenGLVersion
+	v := newestSupported(OpenGL33, func(v OpenGLVersion) bool {
+		tried = append(tried, v)
+		return v <= OpenGL30
+	})
+	if v != OpenGL30 {
+		t.Fatalf("unexpected version: %v", v)
+	}
+	if len(tried) != 3 || tried[0] != OpenGL32 {
+		t.Fatalf("unexpected versions tried: %v", tried)
+	}
+	if v := newestSupported(OpenGL21, func(OpenGLVersion) bool { return false }); v != 0 {
+		t.Fatalf("unexpected version: %v", v)
+	}
+}
@@ -0,0 +1,125 @@
+package renderer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// Stats contains statistics about a Shader for monitoring.
+type Stats struct {
+	// GPUTime is the time the GPU spent rendering the most recent frame of
+	// which the timing is known. It lags a few frames behind.
+	GPUTime time.Duration
+	// Reloads is the number of environments that were loaded, including
+	// those that failed to load.
+	Reloads uint64
+	// Errors is the number of environments that failed to load plus the
+	// number of OpenGL errors encountered while rendering.
+	Errors    uint64
+	LastError error
+	// LastErrorTime is the time at which LastError occurred.
+	LastErrorTime time.Time
+}
+
+// stats is updated by the render loop and may be read concurrently.
+type stats struct {
+	lock sync.Mutex
+	Stats
+}
+
+func (st *stats) reloaded(err error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.Reloads++
+	if err != nil {
+		st.failed(err)
+	}
+}
+
+func (st *stats) error(err error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.failed(err)
+}
+
+func (st *stats) failed(err error) {
+	st.Errors++
+	st.LastError = err
+	st.LastErrorTime = time.Now()
+}
+
+func (st *stats) setGPUTime(d time.Duration) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.GPUTime = d
+}
+
+func (st *stats) get() Stats {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.Stats
+}
+
+// A gpuTimer measures the time the GPU spends on rendering frames using timer
+// queries. Results are collected once they become available, so that the
+// render loop is not stalled.
+type gpuTimer struct {
+	pending []uint32
+	free    []uint32
+	// disabled is set for the shaders of buffers and overlays. They are
+	// rendered as part of the frame of another shader, which is timed as a
+	// whole, as timer queries can not be nested.
+	disabled bool
+}
+
+// begin starts timing a frame.
+func (t *gpuTimer) begin() {
+	if t.disabled {
+		return
+	}
+	var query uint32
+	if n := len(t.free); n > 0 {
+		query, t.free = t.free[n-1], t.free[:n-1]
+	} else {
+		gl.GenQueries(1, &query)
+	}
+	gl.BeginQuery(gl.TIME_ELAPSED, query)
+	t.pending = append(t.pending, query)
+}
+
+func (t *gpuTimer) end() {
+	if !t.disabled {
+		gl.EndQuery(gl.TIME_ELAPSED)
+	}
+}
+
+// poll returns the duration of the most recent frame that finished
+// rendering since the last poll.
+func (t *gpuTimer) poll() (time.Duration, bool) {
+	var elapsed uint64
+	var ok bool
+	for len(t.pending) > 0 {
+		query := t.pending[0]
+		var available int32
+		gl.GetQueryObjectiv(query, gl.QUERY_RESULT_AVAILABLE, &available)
+		if available == 0 {
+			break
+		}
+		gl.GetQueryObjectui64v(query, gl.QUERY_RESULT, &elapsed)
+		ok = true
+		t.pending = t.pending[1:]
+		t.free = append(t.free, query)
+	}
+	return time.Duration(elapsed), ok
+}
+
+func (t *gpuTimer) Close() {
+	for _, queries := range [][]uint32{t.pending, t.free} {
+		if len(queries) > 0 {
+			gl.DeleteQueries(int32(len(queries)), &queries[0])
+		}
+	}
+	t.pending, t.free = nil, nil
+}
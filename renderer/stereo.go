@@ -0,0 +1,104 @@
+package renderer
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// StereoLayout determines how the views of both eyes are arranged in a
+// stereoscopic frame.
+type StereoLayout string
+
+const (
+	// StereoNone renders a single view covering the whole frame.
+	StereoNone StereoLayout = ""
+	// StereoSideBySide renders the left eye in the left half and the right
+	// eye in the right half of the frame.
+	StereoSideBySide StereoLayout = "sbs"
+	// StereoOverUnder renders the left eye in the top half and the right eye
+	// in the bottom half of the frame.
+	StereoOverUnder StereoLayout = "ou"
+)
+
+func ParseStereoLayout(s string) (StereoLayout, error) {
+	switch layout := StereoLayout(s); layout {
+	case StereoNone, StereoSideBySide, StereoOverUnder:
+		return layout, nil
+	case "none":
+		return StereoNone, nil
+	}
+	return StereoNone, fmt.Errorf("invalid stereo layout: %q (valid: none, sbs, ou)", s)
+}
+
+// Stereo configures an engine to render each frame once for every eye.
+type Stereo struct {
+	Layout StereoLayout
+	// Separation is the distance between the eyes in world units.
+	Separation float32
+}
+
+// Eye describes the view of a single eye in a stereoscopic frame.
+type Eye struct {
+	// Index is 0 for the left eye and 1 for the right eye.
+	Index int
+	// Offset is a column major matrix that translates from the center
+	// between the eyes to the position of this eye.
+	Offset [16]float32
+
+	// X and Y are the origin of the eye's viewport in the frame.
+	X, Y          uint
+	Width, Height uint
+}
+
+// eyes returns the views for a frame of the specified size. Nil is returned
+// if no stereo layout is configured.
+func (st Stereo) eyes(width, height uint) []Eye {
+	var eyes []Eye
+	switch st.Layout {
+	case StereoSideBySide:
+		eyes = []Eye{
+			{Index: 0, X: 0, Y: 0, Width: width / 2, Height: height},
+			{Index: 1, X: width / 2, Y: 0, Width: width / 2, Height: height},
+		}
+	case StereoOverUnder:
+		// Rendered frames are flipped vertically when they are output, so
+		// the top half starts at the origin.
+		eyes = []Eye{
+			{Index: 0, X: 0, Y: 0, Width: width, Height: height / 2},
+			{Index: 1, X: 0, Y: height / 2, Width: width, Height: height / 2},
+		}
+	default:
+		return nil
+	}
+	for i := range eyes {
+		eyes[i].Offset = [16]float32{
+			1, 0, 0, 0,
+			0, 1, 0, 0,
+			0, 0, 1, 0,
+			st.Separation * (float32(i) - 0.5), 0, 0, 1,
+		}
+	}
+	return eyes
+}
+
+// draw renders the environment once for each eye, or just once covering the
+// whole frame if no stereo layout is configured. The viewport of the frame
+// should be set up before calling draw.
+func (st Stereo) draw(env Environment, state RenderState) {
+	eyes := st.eyes(state.CanvasWidth, state.CanvasHeight)
+	if eyes == nil {
+		env.PreRender(state)
+		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+		return
+	}
+	for i := range eyes {
+		eye := &eyes[i]
+		gl.Viewport(int32(eye.X), int32(eye.Y), int32(eye.Width), int32(eye.Height))
+		eyeState := state
+		eyeState.CanvasWidth, eyeState.CanvasHeight = eye.Width, eye.Height
+		eyeState.Eye = eye
+		env.PreRender(eyeState)
+		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	}
+}
@@ -0,0 +1,219 @@
+package renderer
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// subTarget renders a sub environment to a texture which is sampled by the
+// environment that declared it.
+//
+// The texture persists between frames, so a sub environment that does not
+// need to be rendered every frame can reuse its previous output.
+type subTarget struct {
+	*Shader
+	every uint
+	once  bool
+	// scale is that of the sub environment, see SubEnvironment.Scale.
+	scale float64
+	// on are the uniforms the target is rendered on, see
+	// SubEnvironment.RenderOn, and onValues their values when it was last
+	// rendered.
+	on       []string
+	onValues []interface{}
+
+	frame   uint64
+	pending time.Duration
+	texture uint32
+	free    func()
+
+	// id is the ID of a shared target, see SubEnvironment.ID. refs counts
+	// the environments sampling it and renderedAt is the frame of the tree
+	// it was last rendered for.
+	id         string
+	refs       int
+	renderedAt uint64
+}
+
+// sharedTargets holds the targets that are shared by the environments of a
+// tree of shaders.
+type sharedTargets struct {
+	targets map[string]*subTarget
+	// frame is the number of the frame that is being rendered by the root
+	// of the tree.
+	frame uint64
+	// float is set if the shaders of the tree render at floating point
+	// precision, see SetFloatPrecision.
+	float bool
+	// mouse is the state of the mouse for the frame, nil if unknown.
+	mouse *Mouse
+	// uniforms are the values set with SetUniform on the root of the tree.
+	uniforms *uniformValues
+}
+
+// advance is called by the root of the tree before each frame.
+func (sh *sharedTargets) advance() {
+	sh.frame++
+}
+
+// newSubTargets creates the targets of the sub environments of a shader that
+// is part of the tree of shared. If shared is nil, each sub environment
+// becomes the root of a new tree. The targets play at the time range of the
+// shader and write their diagnostics to its log.
+func newSubTargets(subEnvs map[string]SubEnvironment, glVersion OpenGLVersion, shared *sharedTargets, tr timeRange, logger *logOutput) (map[string]*subTarget, error) {
+	targets := map[string]*subTarget{}
+	for name, env := range subEnvs {
+		if shared == nil {
+			env.ID = ""
+		} else if t, ok := shared.targets[env.ID]; ok && env.ID != "" {
+			t.refs++
+			targets[name] = t
+			continue
+		}
+		s, err := newShader(env.Width, env.Height, glVersion)
+		if err != nil {
+			closeSubTargets(targets)
+			return nil, err
+		}
+		if shared != nil {
+			s.shared, s.nested = shared, true
+			if shared.float {
+				if err := s.setupRenderer(); err != nil {
+					s.Close()
+					closeSubTargets(targets)
+					return nil, err
+				}
+			}
+		}
+		// The debug messages of the target are received by the debug log
+		// of the shader, as they are raised while it renders.
+		s.debug.close()
+		s.debug, s.log = nil, logger
+		s.timer.disabled = true
+		s.timeRange = tr
+		s.SetEnvironment(env.Environment)
+		if err := s.reloadEnvironment(context.Background()); err != nil {
+			s.Close()
+			closeSubTargets(targets)
+			return nil, err
+		}
+		t := &subTarget{
+			Shader: s,
+			every:  env.RenderEvery,
+			once:   env.RenderOnce,
+			scale:  env.Scale,
+			on:     env.RenderOn,
+			id:     env.ID,
+			refs:   1,
+		}
+		if env.ID != "" {
+			if shared.targets == nil {
+				shared.targets = map[string]*subTarget{}
+			}
+			shared.targets[env.ID] = t
+		}
+		targets[name] = t
+	}
+	return targets, nil
+}
+
+// resize resizes the target along with the canvas of the shader declaring
+// it, if it is sized relative to the canvas. Its previous output is of the
+// previous size, so the target is rendered again in the next frame.
+func (st *subTarget) resize(canvasWidth, canvasHeight uint) {
+	if st.scale == 0 || !st.Shader.resize(ScaleSize(canvasWidth, st.scale), ScaleSize(canvasHeight, st.scale)) {
+		return
+	}
+	if st.free != nil {
+		st.free()
+		st.free = nil
+	}
+}
+
+// due reports whether the target should be rendered in the current frame.
+func (st *subTarget) due() bool {
+	if changed := st.changed(); st.free == nil || changed {
+		return true
+	}
+	if st.once || len(st.on) > 0 && st.every == 0 {
+		return false
+	}
+	return st.every <= 1 || st.frame%uint64(st.every) == 0
+}
+
+// changed reports whether the value of a uniform the target is rendered on
+// changed since it was last checked.
+func (st *subTarget) changed() bool {
+	if len(st.on) == 0 || st.shared.uniforms == nil {
+		return false
+	}
+	if st.onValues == nil {
+		st.onValues = make([]interface{}, len(st.on))
+	}
+	changed := false
+	for i, name := range st.on {
+		if v := st.shared.uniforms.get(name); !reflect.DeepEqual(v, st.onValues[i]) {
+			st.onValues[i] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Texture returns the texture containing the output of the sub environment,
+// rendering a new frame if one is due.
+func (st *subTarget) Texture(interval time.Duration) uint32 {
+	if st.id != "" {
+		// Shared targets are rendered once per frame of the tree.
+		if st.free != nil && st.renderedAt == st.shared.frame {
+			return st.texture
+		}
+		st.renderedAt = st.shared.frame
+	}
+	st.pending += interval
+	if st.due() {
+		if st.free != nil {
+			st.free()
+		}
+		// Advance the time of the sub environment by the time elapsed
+		// since it was last rendered.
+		st.texture, st.free = st.renderer.Texture(st.nextHandle(st.pending, st.pending))
+		st.pending = 0
+	}
+	st.frame++
+	return st.texture
+}
+
+func (st *subTarget) Close() error {
+	if st.refs--; st.refs > 0 {
+		return nil
+	}
+	if st.id != "" {
+		delete(st.shared.targets, st.id)
+	}
+	if st.free != nil {
+		st.free()
+	}
+	return st.Shader.Close()
+}
+
+func renderSubTargets(targets map[string]*subTarget, interval time.Duration) map[string]uint32 {
+	textures := make(map[string]uint32, len(targets))
+	for name, st := range targets {
+		textures[name] = st.Texture(interval)
+	}
+	return textures
+}
+
+func resizeSubTargets(targets map[string]*subTarget, canvasWidth, canvasHeight uint) {
+	for _, st := range targets {
+		st.resize(canvasWidth, canvasHeight)
+	}
+}
+
+func closeSubTargets(targets map[string]*subTarget) {
+	for _, st := range targets {
+		st.Close()
+	}
+}
@@ -0,0 +1,121 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ExecuteTemplate runs shader source code through text/template with the data,
+// which allows shaders to be generated from configuration, such as palettes
+// or the number of LEDs of a display.
+//
+// In addition to the builtin functions, these are available to format values
+// as GLSL:
+//
+//	float X        X as a float literal, e.g. 1.0
+//	vec LIST       a vector of 2 to 4 numbers, e.g. vec3(1.0, 0.5, 0.0)
+//	array LIST     an array of floats or vectors, e.g. float[](1.0, 2.0)
+//	seq N          the integers 0 to N-1, for use with range
+func ExecuteTemplate(name string, src []byte, data interface{}) ([]byte, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(templateFuncs).
+		Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var templateFuncs = template.FuncMap{
+	"float": glslFloat,
+	"vec":   glslVec,
+	"array": glslArray,
+	"seq": func(n int) []int {
+		s := make([]int, n)
+		for i := range s {
+			s[i] = i
+		}
+		return s
+	},
+}
+
+func glslFloat(v interface{}) (string, error) {
+	var f float64
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f = rv.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f = float64(rv.Uint())
+	default:
+		return "", fmt.Errorf("not a number: %v", v)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s, nil
+}
+
+func glslFloats(v interface{}) ([]string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("not a list: %v", v)
+	}
+	floats := make([]string, rv.Len())
+	for i := range floats {
+		f, err := glslFloat(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		floats[i] = f
+	}
+	return floats, nil
+}
+
+func glslVec(v interface{}) (string, error) {
+	floats, err := glslFloats(v)
+	if err != nil {
+		return "", err
+	}
+	if len(floats) < 2 || len(floats) > 4 {
+		return "", fmt.Errorf("a vector must have 2 to 4 components, got %d", len(floats))
+	}
+	return fmt.Sprintf("vec%d(%s)", len(floats), strings.Join(floats, ", ")), nil
+}
+
+func glslArray(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("not a list: %v", v)
+	}
+	if rv.Len() == 0 {
+		return "", fmt.Errorf("arrays can not be empty")
+	}
+	elems := make([]string, rv.Len())
+	typ := "float"
+	for i := range elems {
+		elem := rv.Index(i).Interface()
+		var err error
+		if k := reflect.ValueOf(elem).Kind(); k == reflect.Slice || k == reflect.Array {
+			elems[i], err = glslVec(elem)
+			typ = elems[i][:4]
+		} else {
+			elems[i], err = glslFloat(elem)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s[](%s)", typ, strings.Join(elems, ", ")), nil
+}
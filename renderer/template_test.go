@@ -0,0 +1,31 @@
+package renderer
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExecuteTemplate(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`{"leds": 64, "scale": 0.5, "palette": [[1, 0, 0], [0, 0.5, 1]]}`), &data)
+
+	src := `const int LEDS = {{.leds}};
+const float SCALE = {{float .scale}};
+const vec3 PALETTE[{{len .palette}}] = {{array .palette}};
+{{range seq 2}}v{{.}}{{end}} {{vec (index .palette 0)}} {{float 3}}`
+	out, err := ExecuteTemplate("test", []byte(src), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `const int LEDS = 64;
+const float SCALE = 0.5;
+const vec3 PALETTE[2] = vec3[](vec3(1.0, 0.0, 0.0), vec3(0.0, 0.5, 1.0));
+v0v1 vec3(1.0, 0.0, 0.0) 3.0`
+	if string(out) != exp {
+		t.Fatalf("unexpected output:\nexp: %s\ngot: %s", exp, out)
+	}
+
+	if _, err := ExecuteTemplate("test", []byte(`{{.missing}}`), data); err == nil {
+		t.Fatalf("expected an error for a missing key")
+	}
+}
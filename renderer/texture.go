@@ -0,0 +1,134 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// A texture is an image set with SetTexture. It is uploaded by the rendering
+// thread before the next frame.
+type texture struct {
+	img  *image.RGBA
+	id   uint32
+	size image.Rectangle
+}
+
+// SetTexture binds an image to a sampler2D uniform of the shader, from the
+// next frame on. The size of the image is set to a vec3 uniform with the name
+// of the sampler followed by "Size", if the shader declares one:
+//
+//	uniform sampler2D texture0;
+//	uniform vec3 texture0Size;
+//
+// The image is copied, so it may be modified after SetTexture returns. Calling
+// SetTexture again with the same name replaces the image, setting it to nil
+// removes it.
+//
+// The textures are bound to the highest texture units, so they do not
+// interfere with those of the environment. An error is returned if the
+// shader has no active sampler2D uniform with the name. Like SetUniform,
+// SetTexture may be called from any goroutine.
+func (sh *Shader) SetTexture(name string, img image.Image) error {
+	return sh.uniformValues.setTexture(name, img)
+}
+
+func (uv *uniformValues) setTexture(name string, img image.Image) error {
+	uv.mu.Lock()
+	defer uv.mu.Unlock()
+	if img == nil {
+		if tex, ok := uv.textures[name]; ok {
+			uv.deleted = append(uv.deleted, tex.id)
+			delete(uv.textures, name)
+		}
+		return nil
+	}
+	u, ok := uv.uniforms[name]
+	if !ok {
+		return fmt.Errorf("no active uniform named %q", name)
+	}
+	if u.Type != gl.SAMPLER_2D {
+		return fmt.Errorf("can not assign a texture to %s", u)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	if uv.textures == nil {
+		uv.textures = map[string]*texture{}
+	}
+	tex, ok := uv.textures[name]
+	if !ok {
+		tex = &texture{}
+		uv.textures[name] = tex
+	}
+	tex.img = rgba
+	return nil
+}
+
+// bindTextures uploads new images and binds the textures to the uniforms of
+// the program in use. It must be called with the lock held.
+func (uv *uniformValues) bindTextures(uniforms map[string]Uniform) {
+	if len(uv.deleted) > 0 {
+		gl.DeleteTextures(int32(len(uv.deleted)), &uv.deleted[0])
+		uv.deleted = nil
+	}
+	if len(uv.textures) == 0 {
+		return
+	}
+	var maxUnits int32
+	gl.GetIntegerv(gl.MAX_COMBINED_TEXTURE_IMAGE_UNITS, &maxUnits)
+
+	names := make([]string, 0, len(uv.textures))
+	for name := range uv.textures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		tex := uv.textures[name]
+		unit := uint32(maxUnits) - 1 - uint32(i)
+		gl.ActiveTexture(gl.TEXTURE0 + unit)
+		if tex.img != nil {
+			tex.upload()
+		}
+		gl.BindTexture(gl.TEXTURE_2D, tex.id)
+		if u, ok := uniforms[name]; ok && u.Type == gl.SAMPLER_2D {
+			gl.Uniform1i(u.Location, int32(unit))
+		}
+		if u, ok := uniforms[name+"Size"]; ok && u.Type == gl.FLOAT_VEC3 {
+			gl.Uniform3f(u.Location, float32(tex.size.Dx()), float32(tex.size.Dy()), 1.0)
+		}
+	}
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+// upload copies the pending image to the texture bound to the active unit.
+func (tex *texture) upload() {
+	if tex.id == 0 {
+		gl.GenTextures(1, &tex.id)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(tex.img.Rect.Dx()), int32(tex.img.Rect.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(tex.img.Pix))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	tex.size = tex.img.Rect
+	tex.img = nil
+}
+
+// closeTextures deletes all textures.
+func (uv *uniformValues) closeTextures() {
+	uv.mu.Lock()
+	defer uv.mu.Unlock()
+	for _, tex := range uv.textures {
+		uv.deleted = append(uv.deleted, tex.id)
+	}
+	uv.textures = nil
+	if len(uv.deleted) > 0 {
+		gl.DeleteTextures(int32(len(uv.deleted)), &uv.deleted[0])
+		uv.deleted = nil
+	}
+}
@@ -0,0 +1,126 @@
+package renderer
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// renderThread is a goroutine locked to an OS thread on which the shaders
+// created with NewThreadShader are used. The OpenGL context is shared by all
+// shaders and current on a single thread, so they share the thread as well.
+var renderThread struct {
+	once  sync.Once
+	calls chan func()
+}
+
+// onRenderThread calls fn on the render thread and waits for it to return.
+// Calls are run one at a time in the order in which they are made.
+func onRenderThread(fn func()) {
+	renderThread.once.Do(func() {
+		renderThread.calls = make(chan func())
+		go func() {
+			runtime.LockOSThread()
+			for fn := range renderThread.calls {
+				fn()
+			}
+		}()
+	})
+	done := make(chan struct{})
+	renderThread.calls <- func() {
+		defer close(done)
+		fn()
+	}
+	<-done
+}
+
+// A ThreadShader is a Shader that is safe to use from any goroutine.
+//
+// The OpenGL context of a Shader is only current on the thread that created
+// it, so a Shader must be used from a goroutine that is locked to that thread
+// with runtime.LockOSThread. Calling its methods from another goroutine
+// corrupts the state of OpenGL without an error. A ThreadShader instead runs
+// all calls on a dedicated thread, one at a time, so a call waits until the
+// previous ones, including Animate, have returned.
+//
+// As the context is shared, a process should either use ThreadShaders or
+// Shaders created by NewShader on a single thread, not both.
+type ThreadShader struct {
+	sh *Shader
+}
+
+// NewThreadShader creates a shader on the render thread, see
+// NewShaderContext.
+func NewThreadShader(ctx context.Context, width, height uint, glVersion OpenGLVersion) (*ThreadShader, error) {
+	var sh *Shader
+	var err error
+	onRenderThread(func() {
+		sh, err = NewShaderContext(ctx, width, height, glVersion)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ThreadShader{sh: sh}, nil
+}
+
+// Do calls fn with the shader on the render thread and returns its error. It
+// gives access to all methods of the Shader, which must not be used after fn
+// returns. Frame hooks, outputs and other functions that are called while
+// rendering run on the render thread as well.
+//
+// fn, and the functions called while rendering, must use the Shader they are
+// given rather than the methods of the ThreadShader: such a call waits for
+// the render thread, which is busy running fn, and never returns. This is not
+// detected.
+func (t *ThreadShader) Do(fn func(sh *Shader) error) error {
+	var err error
+	onRenderThread(func() {
+		err = fn(t.sh)
+	})
+	return err
+}
+
+// SetEnvironment sets the environment that is rendered from the next frame
+// on, see Shader.SetEnvironment. It does not wait for the render thread.
+func (t *ThreadShader) SetEnvironment(env Environment) {
+	t.sh.SetEnvironment(env)
+}
+
+// Resize changes the size of the frames that are rendered from the next frame
+// on, see Shader.Resize. It does not wait for the render thread.
+func (t *ThreadShader) Resize(width, height uint) {
+	t.sh.Resize(width, height)
+}
+
+// SetMouse sets the state of the mouse from the next frame on, see
+// Shader.SetMouse. It does not wait for the render thread.
+func (t *ThreadShader) SetMouse(m Mouse) {
+	t.sh.SetMouse(m)
+}
+
+// Image renders a single frame, see Shader.Image.
+func (t *ThreadShader) Image(ctx context.Context, interval time.Duration) (image.Image, error) {
+	var img image.Image
+	err := t.Do(func(sh *Shader) (err error) {
+		img, err = sh.Image(ctx, interval)
+		return err
+	})
+	return img, err
+}
+
+// Animate renders frames until the context is done, see Shader.Animate. The
+// render thread is occupied until it returns, so the frame hooks and outputs
+// of the shader must not call the methods of the ThreadShader, see Do.
+func (t *ThreadShader) Animate(ctx context.Context, interval time.Duration, stream chan<- image.Image) {
+	t.Do(func(sh *Shader) error {
+		sh.Animate(ctx, interval, stream)
+		return nil
+	})
+}
+
+// Close releases the resources of the shader on the render thread.
+func (t *ThreadShader) Close() error {
+	return t.Do((*Shader).Close)
+}
@@ -0,0 +1,61 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// timeRange maps the time that elapsed since the first frame to the time of
+// the animation. The zero value maps times to themselves.
+type timeRange struct {
+	start time.Duration
+	scale float64
+}
+
+func newTimeRange(start time.Duration, scale float64) (timeRange, error) {
+	if scale <= 0 || math.IsInf(scale, 0) || math.IsNaN(scale) {
+		return timeRange{}, fmt.Errorf("invalid time scale: %v, it must be a positive number", scale)
+	}
+	return timeRange{start: start, scale: scale}, nil
+}
+
+// at returns the time of the animation after elapsed time.
+func (r timeRange) at(elapsed time.Duration) time.Duration {
+	return r.start + r.duration(elapsed)
+}
+
+// duration returns the duration of the animation that passes in d.
+func (r timeRange) duration(d time.Duration) time.Duration {
+	if r.scale == 0 {
+		return d
+	}
+	return time.Duration(math.Round(float64(d) * r.scale))
+}
+
+// SetTimeRange sets the time of the animation at which the first frame is
+// rendered and the speed at which it plays, e.g. 0.5 for slow motion. The
+// interval between frames is not affected, so slowing down renders more
+// frames of the same part of the animation. The time of frames passed to hooks
+// and in metadata is the time of the animation.
+//
+// It should be called before the first frame is rendered.
+func (sh *Shader) SetTimeRange(start time.Duration, scale float64) error {
+	r, err := newTimeRange(start, scale)
+	if err != nil {
+		return err
+	}
+	sh.timeRange = r
+	return nil
+}
+
+// SetTimeRange sets the time of the animation at which the engine starts and
+// the speed at which it plays, see Shader.SetTimeRange.
+func (eng *OnScreenEngine) SetTimeRange(start time.Duration, scale float64) error {
+	r, err := newTimeRange(start, scale)
+	if err != nil {
+		return err
+	}
+	eng.timeRange = r
+	return nil
+}
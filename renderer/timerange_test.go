@@ -0,0 +1,38 @@
+package renderer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeRange(t *testing.T) {
+	tests := []struct {
+		start   time.Duration
+		scale   float64
+		elapsed time.Duration
+		expect  time.Duration
+	}{
+		{0, 1, time.Second, time.Second},
+		{10 * time.Second, 1, time.Second, 11 * time.Second},
+		{10 * time.Second, 0.5, time.Second, 10*time.Second + 500*time.Millisecond},
+		{-time.Second, 2, time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		r, err := newTimeRange(tt.start, tt.scale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.at(tt.elapsed); got != tt.expect {
+			t.Errorf("start %v, scale %v: expected %v after %v, got %v", tt.start, tt.scale, tt.expect, tt.elapsed, got)
+		}
+	}
+
+	if got := (timeRange{}).at(time.Second); got != time.Second {
+		t.Errorf("expected the zero value to map times to themselves, got %v", got)
+	}
+	for _, scale := range []float64{0, -1} {
+		if _, err := newTimeRange(0, scale); err == nil {
+			t.Errorf("expected an error for scale %v", scale)
+		}
+	}
+}
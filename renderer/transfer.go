@@ -0,0 +1,112 @@
+package renderer
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// A Transfer is a transfer function that encodes the linear light values
+// output by a shader for display, as expected by video encoders and players.
+type Transfer string
+
+const (
+	// TransferNone leaves the output of the shader as is.
+	TransferNone  Transfer = ""
+	TransferSRGB  Transfer = "srgb"
+	TransferBT709 Transfer = "bt709"
+	// TransferHLG is the Hybrid Log-Gamma function of BT.2100 for HDR video.
+	TransferHLG Transfer = "hlg"
+	// TransferPQ is the Perceptual Quantizer of SMPTE ST 2084 for HDR video.
+	TransferPQ Transfer = "pq"
+)
+
+func ParseTransfer(s string) (Transfer, error) {
+	switch t := Transfer(s); t {
+	case "none":
+		return TransferNone, nil
+	case TransferSRGB, TransferBT709, TransferHLG, TransferPQ:
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid transfer function: %q (valid: none, srgb, bt709, hlg, pq)", s)
+}
+
+// HDR reports whether the transfer function is for high dynamic range video,
+// which uses the wide gamut BT.2020 primaries.
+func (t Transfer) HDR() bool {
+	return t == TransferHLG || t == TransferPQ
+}
+
+// transferFunctions are GLSL functions that encode linear light, of which 1.0
+// is the reference white.
+var transferFunctions = map[Transfer]string{
+	TransferSRGB: `
+		vec3 encode(vec3 l) {
+			l = clamp(l, 0.0, 1.0);
+			return mix(l * 12.92, 1.055 * pow(l, vec3(1.0 / 2.4)) - 0.055, step(0.0031308, l));
+		}
+	`,
+	TransferBT709: `
+		vec3 encode(vec3 l) {
+			l = clamp(l, 0.0, 1.0);
+			return mix(l * 4.5, 1.099 * pow(l, vec3(0.45)) - 0.099, step(0.018, l));
+		}
+	`,
+	TransferHLG: `
+		vec3 encode(vec3 l) {
+			// Reference white is at 75% of the signal as recommended by
+			// BT.2408.
+			vec3 e = clamp(l * 0.26496, 0.0, 1.0);
+			const float a = 0.17883277, b = 0.28466892, c = 0.55991073;
+			return mix(sqrt(3.0 * e), a * log(max(12.0 * e - b, 1e-6)) + c, step(1.0 / 12.0, e));
+		}
+	`,
+	TransferPQ: `
+		vec3 encode(vec3 l) {
+			vec3 y = clamp(l * white / 10000.0, 0.0, 1.0);
+			const float m1 = 0.1593017578125, m2 = 78.84375;
+			const float c1 = 0.8359375, c2 = 18.8515625, c3 = 18.6875;
+			vec3 ym = pow(y, vec3(m1));
+			return pow((c1 + c2 * ym) / (1.0 + c3 * ym), vec3(m2));
+		}
+	`,
+}
+
+// TransferPostPass returns a pass that encodes the linear output of the shader
+// with the transfer function. For HDR transfer functions, the colors are
+// converted from the BT.709 primaries shaders work with to BT.2020.
+//
+// white is the luminance of 1.0 in cd/m² for PQ, of which 203 is recommended
+// by BT.2408. Values above 1.0 are brighter than reference white, so shaders
+// should render with float precision to keep them.
+func TransferPostPass(t Transfer, white float32) (PostPass, error) {
+	fn, ok := transferFunctions[t]
+	if !ok {
+		return PostPass{}, fmt.Errorf("no post pass for transfer function %q", t)
+	}
+	primaries := "mat3(1.0)"
+	if t.HDR() {
+		primaries = `mat3(
+			0.6274, 0.0691, 0.0164,
+			0.3293, 0.9195, 0.0880,
+			0.0433, 0.0114, 0.8956
+		)`
+	}
+	fragment := SourceBuf(`#version 330 core
+		in vec2 texCoord;
+		out vec4 fragColor;
+		uniform sampler2D frame;
+		uniform float white;
+	` + fn + `
+		void main() {
+			vec4 c = texture(frame, texCoord);
+			fragColor = vec4(encode(` + primaries + ` * max(c.rgb, 0.0)), c.a);
+		}
+	`)
+	return PostPass{
+		Fragment: fragment,
+		PreRender: func(program uint32) {
+			gl.Uniform1f(gl.GetUniformLocation(program, gl.Str("white\x00")), white)
+		},
+	}, nil
+}
@@ -2,7 +2,10 @@ package renderer
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
 )
@@ -273,3 +276,351 @@ func (u Uniform) TypeLiteral() string {
 func (u Uniform) String() string {
 	return fmt.Sprintf("uniform %s %s (%x)", u.TypeLiteral(), u.Name, u.Location)
 }
+
+// components returns the number of scalar values of the uniform's type, or 0
+// if it is not a float, int or bool type.
+func (u Uniform) components() (n int, integer bool) {
+	switch u.Type {
+	case gl.FLOAT:
+		return 1, false
+	case gl.FLOAT_VEC2:
+		return 2, false
+	case gl.FLOAT_VEC3:
+		return 3, false
+	case gl.FLOAT_VEC4, gl.FLOAT_MAT2:
+		return 4, false
+	case gl.FLOAT_MAT3:
+		return 9, false
+	case gl.FLOAT_MAT4:
+		return 16, false
+	case gl.INT, gl.BOOL:
+		return 1, true
+	case gl.INT_VEC2, gl.BOOL_VEC2:
+		return 2, true
+	case gl.INT_VEC3, gl.BOOL_VEC3:
+		return 3, true
+	case gl.INT_VEC4, gl.BOOL_VEC4:
+		return 4, true
+	}
+	return 0, false
+}
+
+// Value reads the current value of the uniform from the program. False is
+// returned if the type of the uniform is not a float, int or bool type.
+func (u Uniform) Value(program uint32) ([]float32, bool) {
+	n, integer := u.components()
+	if n == 0 {
+		return nil, false
+	}
+	value := make([]float32, n)
+	if integer {
+		ints := make([]int32, n)
+		gl.GetUniformiv(program, u.Location, &ints[0])
+		for i, v := range ints {
+			value[i] = float32(v)
+		}
+	} else {
+		gl.GetUniformfv(program, u.Location, &value[0])
+	}
+	return value, true
+}
+
+// set sets the value of the uniform in the program that is in use. The value
+// must have as many components as the type of the uniform. False is returned
+// if the type of the uniform is not a float, int or bool type.
+func (u Uniform) set(value []float32) bool {
+	n, integer := u.components()
+	if n == 0 || len(value) != n {
+		return false
+	}
+	if integer {
+		ints := make([]int32, n)
+		for i, v := range value {
+			ints[i] = int32(v)
+		}
+		switch n {
+		case 1:
+			gl.Uniform1iv(u.Location, 1, &ints[0])
+		case 2:
+			gl.Uniform2iv(u.Location, 1, &ints[0])
+		case 3:
+			gl.Uniform3iv(u.Location, 1, &ints[0])
+		case 4:
+			gl.Uniform4iv(u.Location, 1, &ints[0])
+		}
+		return true
+	}
+	switch u.Type {
+	case gl.FLOAT:
+		gl.Uniform1fv(u.Location, 1, &value[0])
+	case gl.FLOAT_VEC2:
+		gl.Uniform2fv(u.Location, 1, &value[0])
+	case gl.FLOAT_VEC3:
+		gl.Uniform3fv(u.Location, 1, &value[0])
+	case gl.FLOAT_VEC4:
+		gl.Uniform4fv(u.Location, 1, &value[0])
+	case gl.FLOAT_MAT2:
+		gl.UniformMatrix2fv(u.Location, 1, false, &value[0])
+	case gl.FLOAT_MAT3:
+		gl.UniformMatrix3fv(u.Location, 1, false, &value[0])
+	case gl.FLOAT_MAT4:
+		gl.UniformMatrix4fv(u.Location, 1, false, &value[0])
+	}
+	return true
+}
+
+// checkValue returns an error if a Go value can not be assigned to the
+// uniform. See Shader.SetUniform for the accepted types.
+func (u Uniform) checkValue(value interface{}) error {
+	var ok bool
+	switch value.(type) {
+	case float32, float64:
+		ok = u.Type == gl.FLOAT
+	case int, int32:
+		ok = u.Type == gl.INT
+	case uint32:
+		ok = u.Type == gl.UNSIGNED_INT
+	case bool:
+		ok = u.Type == gl.BOOL
+	case [2]float32:
+		ok = u.Type == gl.FLOAT_VEC2
+	case [3]float32:
+		ok = u.Type == gl.FLOAT_VEC3
+	case [4]float32:
+		ok = u.Type == gl.FLOAT_VEC4 || u.Type == gl.FLOAT_MAT2
+	case [9]float32:
+		ok = u.Type == gl.FLOAT_MAT3
+	case [16]float32:
+		ok = u.Type == gl.FLOAT_MAT4
+	case [2]int32:
+		ok = u.Type == gl.INT_VEC2
+	case [3]int32:
+		ok = u.Type == gl.INT_VEC3
+	case [4]int32:
+		ok = u.Type == gl.INT_VEC4
+	default:
+		return fmt.Errorf("unsupported uniform value type %T", value)
+	}
+	if !ok {
+		return fmt.Errorf("can not assign %T to %s", value, u)
+	}
+	return nil
+}
+
+// ParseValue parses a value for the uniform, as accepted by
+// Shader.SetUniform, from a list of numbers separated by commas or spaces,
+// e.g. "0.5" or "1, 0, 0". Bools are parsed as true or false, or 1 or 0.
+func (u Uniform) ParseValue(s string) (interface{}, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	n, integer := u.components()
+	switch u.Type {
+	case gl.UNSIGNED_INT:
+		n, integer = 1, true
+	case gl.BOOL:
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("%s takes 1 value, got %d", u, len(fields))
+		}
+		return strconv.ParseBool(fields[0])
+	case gl.BOOL_VEC2, gl.BOOL_VEC3, gl.BOOL_VEC4:
+		n = 0
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("can not set %s", u)
+	}
+	if len(fields) != n {
+		return nil, fmt.Errorf("%s takes %d values, got %d", u, n, len(fields))
+	}
+	floats := make([]float32, n)
+	ints := make([]int32, n)
+	for i, f := range fields {
+		if integer {
+			v, err := strconv.ParseInt(f, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			ints[i] = int32(v)
+		} else {
+			v, err := strconv.ParseFloat(f, 32)
+			if err != nil {
+				return nil, err
+			}
+			floats[i] = float32(v)
+		}
+	}
+	switch u.Type {
+	case gl.FLOAT:
+		return floats[0], nil
+	case gl.FLOAT_VEC2:
+		return [2]float32{floats[0], floats[1]}, nil
+	case gl.FLOAT_VEC3:
+		return [3]float32{floats[0], floats[1], floats[2]}, nil
+	case gl.FLOAT_VEC4, gl.FLOAT_MAT2:
+		var v [4]float32
+		copy(v[:], floats)
+		return v, nil
+	case gl.FLOAT_MAT3:
+		var v [9]float32
+		copy(v[:], floats)
+		return v, nil
+	case gl.FLOAT_MAT4:
+		var v [16]float32
+		copy(v[:], floats)
+		return v, nil
+	case gl.INT:
+		return ints[0], nil
+	case gl.UNSIGNED_INT:
+		if ints[0] < 0 {
+			return nil, fmt.Errorf("%s can not be negative", u)
+		}
+		return uint32(ints[0]), nil
+	case gl.INT_VEC2:
+		return [2]int32{ints[0], ints[1]}, nil
+	case gl.INT_VEC3:
+		return [3]int32{ints[0], ints[1], ints[2]}, nil
+	default:
+		return [4]int32{ints[0], ints[1], ints[2], ints[3]}, nil
+	}
+}
+
+// setValue sets the uniform in the program that is in use to a value that
+// passed checkValue.
+func (u Uniform) setValue(value interface{}) {
+	switch v := value.(type) {
+	case float32:
+		gl.Uniform1f(u.Location, v)
+	case float64:
+		gl.Uniform1f(u.Location, float32(v))
+	case int:
+		gl.Uniform1i(u.Location, int32(v))
+	case int32:
+		gl.Uniform1i(u.Location, v)
+	case uint32:
+		gl.Uniform1ui(u.Location, v)
+	case bool:
+		b := int32(0)
+		if v {
+			b = 1
+		}
+		gl.Uniform1i(u.Location, b)
+	case [2]float32:
+		gl.Uniform2fv(u.Location, 1, &v[0])
+	case [3]float32:
+		gl.Uniform3fv(u.Location, 1, &v[0])
+	case [4]float32:
+		if u.Type == gl.FLOAT_MAT2 {
+			gl.UniformMatrix2fv(u.Location, 1, false, &v[0])
+		} else {
+			gl.Uniform4fv(u.Location, 1, &v[0])
+		}
+	case [9]float32:
+		gl.UniformMatrix3fv(u.Location, 1, false, &v[0])
+	case [16]float32:
+		gl.UniformMatrix4fv(u.Location, 1, false, &v[0])
+	case [2]int32:
+		gl.Uniform2iv(u.Location, 1, &v[0])
+	case [3]int32:
+		gl.Uniform3iv(u.Location, 1, &v[0])
+	case [4]int32:
+		gl.Uniform4iv(u.Location, 1, &v[0])
+	}
+}
+
+// uniformValues holds the values and textures set with SetUniform and
+// SetTexture, which are applied after the environment has set its uniforms.
+type uniformValues struct {
+	mu       sync.Mutex
+	values   map[string]interface{}
+	textures map[string]*texture
+	// deleted holds the textures that were removed but not yet deleted.
+	deleted []uint32
+	// uniforms are the active uniforms of the loaded program, which values
+	// are checked against.
+	uniforms map[string]Uniform
+}
+
+func (uv *uniformValues) setUniforms(uniforms map[string]Uniform) {
+	uv.mu.Lock()
+	defer uv.mu.Unlock()
+	uv.uniforms = uniforms
+}
+
+func (uv *uniformValues) set(name string, value interface{}) error {
+	uv.mu.Lock()
+	defer uv.mu.Unlock()
+	if value == nil {
+		delete(uv.values, name)
+		return nil
+	}
+	u, ok := uv.uniforms[name]
+	if !ok {
+		return fmt.Errorf("no active uniform named %q", name)
+	}
+	if err := u.checkValue(value); err != nil {
+		return err
+	}
+	if uv.values == nil {
+		uv.values = map[string]interface{}{}
+	}
+	uv.values[name] = value
+	return nil
+}
+
+// get returns the value set for a uniform, or nil if none is set.
+func (uv *uniformValues) get(name string) interface{} {
+	uv.mu.Lock()
+	defer uv.mu.Unlock()
+	return uv.values[name]
+}
+
+// wrap returns an environment that applies the values after the environment
+// has prepared each frame.
+func (uv *uniformValues) wrap(env Environment) Environment {
+	uv.mu.Lock()
+	defer uv.mu.Unlock()
+	if len(uv.values) == 0 && len(uv.textures) == 0 && len(uv.deleted) == 0 {
+		return env
+	}
+	return uniformEnvironment{Environment: env, uv: uv}
+}
+
+type uniformEnvironment struct {
+	Environment
+	uv *uniformValues
+}
+
+func (env uniformEnvironment) PreRender(state RenderState) {
+	env.Environment.PreRender(state)
+	env.uv.mu.Lock()
+	defer env.uv.mu.Unlock()
+	for name, value := range env.uv.values {
+		// The value is checked again, as the uniform may have changed
+		// after a reload.
+		if u, ok := state.Uniforms[name]; ok && u.checkValue(value) == nil {
+			u.setValue(value)
+		}
+	}
+	env.uv.bindTextures(state.Uniforms)
+}
+
+// SetUniform sets a uniform of the shader to a fixed value, overriding the
+// value set by the environment from the next frame on. Setting the value to
+// nil hands the uniform back to the environment.
+//
+// The value must match the type of the uniform in the loaded program:
+//
+//	float          float32, float64
+//	int            int, int32
+//	unsigned int   uint32
+//	bool           bool
+//	vec2..vec4     [2]float32..[4]float32
+//	ivec2..ivec4   [2]int32..[4]int32
+//	mat2, mat3     [4]float32, [9]float32, column major
+//	mat4           [16]float32, column major
+//
+// An error is returned if no such uniform is active or the type does not
+// match. Values remain set when the environment is reloaded, but are not
+// applied while the uniform is missing or of a different type. SetUniform may
+// be called from any goroutine.
+func (sh *Shader) SetUniform(name string, value interface{}) error {
+	return sh.uniformValues.set(name, value)
+}
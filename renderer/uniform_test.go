@@ -0,0 +1,102 @@
+package renderer
+
+import (
+	"image"
+	"testing"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+func TestUniformValues(t *testing.T) {
+	var uv uniformValues
+	uv.setUniforms(map[string]Uniform{
+		"iTime":  {Name: "iTime", Type: gl.FLOAT},
+		"iMouse": {Name: "iMouse", Type: gl.FLOAT_VEC4},
+		"rot":    {Name: "rot", Type: gl.FLOAT_MAT2},
+	})
+	for _, tc := range []struct {
+		name  string
+		value interface{}
+		ok    bool
+	}{
+		{"iTime", 1.5, true},
+		{"iTime", float32(1.5), true},
+		{"iTime", 1, false},
+		{"iMouse", [4]float32{1, 2, 3, 4}, true},
+		{"iMouse", [3]float32{1, 2, 3}, false},
+		{"rot", [4]float32{1, 0, 0, 1}, true},
+		{"iTime", "1.5", false},
+		{"iFrame", 1, false},
+	} {
+		if err := uv.set(tc.name, tc.value); (err == nil) != tc.ok {
+			t.Errorf("setting %s to %#v: unexpected error: %v", tc.name, tc.value, err)
+		}
+	}
+	if len(uv.values) != 3 {
+		t.Fatalf("unexpected values: %v", uv.values)
+	}
+	if err := uv.set("iTime", nil); err != nil || uv.values["iTime"] != nil {
+		t.Fatalf("value was not unset: %v", err)
+	}
+}
+
+func TestUniformValuesTexture(t *testing.T) {
+	var uv uniformValues
+	uv.setUniforms(map[string]Uniform{
+		"iTime":    {Name: "iTime", Type: gl.FLOAT},
+		"texture0": {Name: "texture0", Type: gl.SAMPLER_2D},
+	})
+	img := image.NewRGBA(image.Rect(4, 4, 6, 7))
+	if err := uv.setTexture("iTime", img); err == nil {
+		t.Fatal("expected an error for a float uniform")
+	}
+	if err := uv.setTexture("texture0", img); err != nil {
+		t.Fatal(err)
+	}
+	if tex := uv.textures["texture0"]; tex == nil || tex.img.Rect != image.Rect(0, 0, 2, 3) {
+		t.Fatalf("unexpected texture: %+v", tex)
+	}
+	uv.textures["texture0"].id = 7
+	if err := uv.setTexture("texture0", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(uv.textures) != 0 || len(uv.deleted) != 1 || uv.deleted[0] != 7 {
+		t.Fatalf("texture was not removed: %v, %v", uv.textures, uv.deleted)
+	}
+}
+
+func TestUniformParseValue(t *testing.T) {
+	for _, tc := range []struct {
+		typ   uint32
+		input string
+		value interface{}
+	}{
+		{gl.FLOAT, "0.5", float32(0.5)},
+		{gl.FLOAT_VEC3, "1, 0 0.25", [3]float32{1, 0, 0.25}},
+		{gl.FLOAT_MAT2, "1,0,0,1", [4]float32{1, 0, 0, 1}},
+		{gl.INT, "-3", int32(-3)},
+		{gl.UNSIGNED_INT, "3", uint32(3)},
+		{gl.INT_VEC2, "1 2", [2]int32{1, 2}},
+		{gl.BOOL, "true", true},
+		{gl.BOOL, "0", false},
+		{gl.FLOAT, "1 2", nil},
+		{gl.INT, "1.5", nil},
+		{gl.UNSIGNED_INT, "-1", nil},
+		{gl.SAMPLER_2D, "0", nil},
+	} {
+		u := Uniform{Name: "u", Type: tc.typ}
+		value, err := u.ParseValue(tc.input)
+		if tc.value == nil {
+			if err == nil {
+				t.Errorf("%s from %q: expected an error, got %#v", u.TypeLiteral(), tc.input, value)
+			}
+			continue
+		}
+		if err != nil || value != tc.value {
+			t.Errorf("%s from %q: got %#v, %v", u.TypeLiteral(), tc.input, value, err)
+		}
+		if err := u.checkValue(value); err != nil {
+			t.Errorf("%s from %q: value is not accepted: %v", u.TypeLiteral(), tc.input, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package renderer
+
+import (
+	"context"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// A Watcher loads an environment again each time one of its source files
+// changes and sets it on a shader, so the shader can be edited while it is
+// animated. If an environment fails to load or compile, the shader keeps
+// rendering the last one that did and the error is sent on Errors.
+type Watcher struct {
+	sh     *Shader
+	load   func() (Environment, []string, error)
+	errors chan error
+}
+
+// NewWatcher creates a Watcher for the shader. load is called to create the
+// environment and returns the files to watch, which should also be returned
+// if it fails.
+//
+// The watcher changes how the shader handles environments that fail to load
+// using SetKeepOnError, so it should be created before the shader is
+// animated.
+func NewWatcher(sh *Shader, load func() (Environment, []string, error)) *Watcher {
+	w := &Watcher{
+		sh:     sh,
+		load:   load,
+		errors: make(chan error, 16),
+	}
+	sh.SetKeepOnError(w.report)
+	return w
+}
+
+// Errors returns the channel on which errors are sent. Errors are dropped if
+// they are not received in time, rendering is never blocked.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *Watcher) report(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// Watch loads the environment and then waits for changes to load it again,
+// until the context is canceled.
+func (w *Watcher) Watch(ctx context.Context) error {
+	for {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		env, files, err := w.load()
+		for _, f := range files {
+			if err := watcher.Add(f); err != nil {
+				w.report(err)
+			}
+		}
+		if err != nil {
+			w.report(err)
+		} else {
+			w.sh.SetEnvironment(env)
+		}
+
+		err = w.wait(ctx, watcher)
+		watcher.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// wait blocks until a watched file has changed. Changes that follow in quick
+// succession, e.g. when an editor writes a file in multiple steps, are
+// collected.
+func (w *Watcher) wait(ctx context.Context, watcher *fsnotify.Watcher) error {
+	for changed := false; !changed; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.Errors:
+			w.report(err)
+		case <-watcher.Events:
+			changed = true
+		}
+	}
+	t := time.NewTimer(time.Millisecond * 20)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-watcher.Events:
+		case <-t.C:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+const (
+	// fftSize is the number of samples that are analyzed per frame, which
+	// yields a bin for every pixel of the texture.
+	fftSize = texWidth * 2
+
+	// These are the defaults of the Web Audio AnalyserNode that ShaderToy
+	// uses.
+	smoothing = 0.8
+	minDB     = -100.0
+	maxDB     = -30.0
+)
+
+// analyzer computes the rows of the texture like ShaderToy does: the first
+// row holds the magnitudes of the spectrum in decibels and the second row the
+// waveform.
+type analyzer struct {
+	smoothed []float64
+}
+
+// update analyzes the most recent fftSize samples and writes the rows to
+// data, which has a byte per pixel.
+func (a *analyzer) update(samples []float64, data []uint8) {
+	if a.smoothed == nil {
+		a.smoothed = make([]float64, texWidth)
+	}
+
+	windowed := make([]float64, fftSize)
+	for i, v := range samples {
+		// Blackman window.
+		x := 2 * math.Pi * float64(i) / fftSize
+		windowed[i] = v * (0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x))
+	}
+	freqs := fft.FFTReal(windowed)
+	for x := 0; x < texWidth; x++ {
+		mag := cmplx.Abs(freqs[x]) / fftSize
+		a.smoothed[x] = smoothing*a.smoothed[x] + (1-smoothing)*mag
+		db := 20 * math.Log10(a.smoothed[x])
+		data[x] = toByte((db - minDB) / (maxDB - minDB))
+	}
+
+	wave := samples[len(samples)-texWidth:]
+	for x, v := range wave {
+		data[texWidth+x] = toByte(v*0.5 + 0.5)
+	}
+}
+
+func toByte(v float64) uint8 {
+	if math.IsNaN(v) || v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	return uint8(v * 255)
+}
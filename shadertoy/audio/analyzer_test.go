@@ -0,0 +1,76 @@
+package audio
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestAnalyzer(t *testing.T) {
+	// A sine that completes 64 periods in the window peaks in bin 64.
+	samples := make([]float64, fftSize)
+	for i := range samples {
+		samples[i] = 0.01 * math.Sin(2*math.Pi*64*float64(i)/fftSize)
+	}
+	var a analyzer
+	data := make([]uint8, texWidth*texHeight)
+	for i := 0; i < 50; i++ {
+		a.update(samples, data)
+	}
+	peak := 0
+	for x := range data[:texWidth] {
+		if data[x] > data[peak] {
+			peak = x
+		}
+	}
+	if peak != 64 || data[peak] == 255 {
+		t.Fatalf("expected an unclipped peak at bin 64, got %d at %d", data[peak], peak)
+	}
+	if data[200] != 0 {
+		t.Fatalf("expected silence at bin 200, got %d", data[200])
+	}
+	if w := data[texWidth]; w != 127 {
+		t.Fatalf("expected the wave to start at 127, got %d", w)
+	}
+}
+
+func TestPCMReader(t *testing.T) {
+	tests := []struct {
+		format   format
+		channels int
+		in       []byte
+		out      []float64
+	}{
+		{"s16le", 1, []byte{0x00, 0x40, 0x00, 0xc0}, []float64{0.5, -0.5}},
+		{"s16be", 1, []byte{0x40, 0x00}, []float64{0.5}},
+		{"u8le", 2, []byte{0xc0, 0x40, 0x80, 0x00}, []float64{0, -0.5}},
+		{"s24le", 1, []byte{0x00, 0x00, 0x80}, []float64{-1}},
+		// The last sample is incomplete.
+		{"s16le", 1, []byte{0x00, 0x40, 0x00}, []float64{0.5}},
+	}
+	for _, tt := range tests {
+		pcm := &pcmReader{r: bytes.NewReader(tt.in), channels: tt.channels, format: tt.format}
+		samples, _ := pcm.Read(2)
+		if len(samples) != len(tt.out) {
+			t.Fatalf("%s: expected %v, got %v", tt.format, tt.out, samples)
+		}
+		for i := range samples {
+			if samples[i] != tt.out[i] {
+				t.Fatalf("%s: expected %v, got %v", tt.format, tt.out, samples)
+			}
+		}
+	}
+}
+
+func TestPushSamples(t *testing.T) {
+	history := []float64{1, 2, 3, 4}
+	pushSamples(history, []float64{5})
+	pushSamples(history, []float64{6, 7, 8, 9, 10})
+	pushSamples(history, []float64{11})
+	exp := []float64{8, 9, 10, 11}
+	for i := range exp {
+		if history[i] != exp[i] {
+			t.Fatalf("expected %v, got %v", exp, history)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
-	"github.com/mjibson/go-dsp/fft"
 
 	"github.com/polyfloyd/shady/renderer"
 	"github.com/polyfloyd/shady/shadertoy"
@@ -27,17 +26,25 @@ func init() {
 
 const (
 	texWidth  = 512
-	texHeight = 4
+	texHeight = 2
 )
 
 var (
 	genericValueRe = regexp.MustCompile(`^([^;]+)$`)
 	pcmValueRe     = regexp.MustCompile(`^([^;]+);(\d+):(\d+):([su]\d{1,2}[lb]e)$`)
+	micValueRe     = regexp.MustCompile(`^mic(?::(.+))?$`)
 )
 
-func parseMappingValue(pwd, value string) (*source, error) {
+func parseMappingValue(pwd, value string) (source, error) {
+	if match := micValueRe.FindStringSubmatch(value); match != nil {
+		return newMicrophoneSource(match[1])
+	}
 	if match := genericValueRe.FindStringSubmatch(value); match != nil {
-		return newAudioFileSource(match[1])
+		filename, err := shadertoy.ResolvePath(pwd, match[1])
+		if err != nil {
+			return nil, err
+		}
+		return newAudioFileSource(filename), nil
 	}
 
 	match := pcmValueRe.FindStringSubmatch(value)
@@ -65,12 +72,7 @@ func parseMappingValue(pwd, value string) (*source, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not open audio source: %w", err)
 	}
-	return &source{
-		SampleRate: samplerate,
-		Channels:   channels,
-		Format:     format,
-		file:       fd,
-	}, nil
+	return newLiveSource(fd, samplerate, channels, format), nil
 }
 
 // texture is a mapping of an audio stream.
@@ -78,35 +80,40 @@ type texture struct {
 	uniformName string
 	id          uint32
 	index       uint32
-	source      *source
+	source      source
 
-	prevPeriod     []float64
-	stabilizedWave []float64
+	analyzer analyzer
+	window   []float64
+	data     []uint8
+	time     time.Duration
+	updated  bool
 }
 
-func newAudioTexture(uniformName string, source *source, texIndex uint32) *texture {
+func newAudioTexture(uniformName string, source source, texIndex uint32) *texture {
 	at := &texture{
-		uniformName:    uniformName,
-		index:          texIndex,
-		source:         source,
-		prevPeriod:     make([]float64, texWidth),
-		stabilizedWave: make([]float64, texWidth),
+		uniformName: uniformName,
+		index:       texIndex,
+		source:      source,
+		window:      make([]float64, fftSize),
+		data:        make([]uint8, texWidth*texHeight),
 	}
 	gl.GenTextures(1, &at.id)
 	gl.BindTexture(gl.TEXTURE_2D, at.id)
 
-	var initialData [texWidth * texHeight * 3]uint8
 	gl.TexImage2D(
-		gl.TEXTURE_2D,          // target
-		0,                      // level
-		gl.RGBA,                // internalFormat
-		texWidth,               // width
-		texHeight,              // height
-		0,                      // border
-		gl.RGB,                 // format
-		gl.UNSIGNED_BYTE,       // type
-		gl.Ptr(initialData[:]), // data
+		gl.TEXTURE_2D,      // target
+		0,                  // level
+		gl.R8,              // internalFormat
+		texWidth,           // width
+		texHeight,          // height
+		0,                  // border
+		gl.RED,             // format
+		gl.UNSIGNED_BYTE,   // type
+		gl.Ptr(at.data[:]), // data
 	)
+	// Shaders written for ShaderToy may read any of the color channels.
+	swizzle := []int32{gl.RED, gl.RED, gl.RED, gl.ONE}
+	gl.TexParameteriv(gl.TEXTURE_2D, gl.TEXTURE_SWIZZLE_RGBA, &swizzle[0])
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
@@ -123,67 +130,32 @@ func (at *texture) UniformSource() string {
 }
 
 func (at *texture) PreRender(state renderer.RenderState) {
-	newPeriod := at.source.ReadSamples(state.Interval)
-	prevPeriod := at.prevPeriod[len(at.prevPeriod)-texWidth:]
-	at.prevPeriod = append(at.prevPeriod, newPeriod...)[len(newPeriod):]
-	period := at.prevPeriod[len(at.prevPeriod)-texWidth:]
-
-	if loc, ok := state.Uniforms[at.uniformName]; ok {
-		textureData := make([]uint8, texWidth*texHeight*3)
-		// FFT
-		freqs := fft.FFTReal(period)
-		for x := 0; x < texWidth/2; x++ {
-			fft1 := uint8((real(freqs[x])*0.5 + 0.5) * 255.0)
-			fft2 := uint8((imag(freqs[x])*0.5 + 0.5) * 255.0)
-			textureData[x*2*3+0] = fft1
-			textureData[x*2*3+1] = fft1
-			textureData[x*2*3+2] = fft1
-			textureData[(x*2+1)*3+0] = fft2
-			textureData[(x*2+1)*3+1] = fft2
-			textureData[(x*2+1)*3+2] = fft2
-		}
-		// Wave
-		for x := 0; x < texWidth; x++ {
-			wave := uint8((period[x]*0.5 + 0.5) * 255.0)
-			textureData[(texWidth+x)*3+0] = wave
-			textureData[(texWidth+x)*3+1] = wave
-			textureData[(texWidth+x)*3+2] = wave
-		}
-		// Stabilized Wave
-		corrPeriod := period
-		// Search the newly read samples for a window of samples that
-		// resebles the previous period.
-		best := -1.0
-		for i := 0; i < len(newPeriod)-texWidth; i++ {
-			p := newPeriod[i : i+texWidth]
-			w := correlate(p, prevPeriod)
-			if w > best {
-				best = w
-				corrPeriod = p
-			}
-		}
-		const n = 0.35
-		for x := 0; x < texWidth; x++ {
-			at.stabilizedWave[x] = at.stabilizedWave[x]*(1-n) + corrPeriod[x]*n
-			wave := uint8((at.stabilizedWave[x]*0.5 + 0.5) * 255.0)
-			textureData[(texWidth*2+x)*3+0] = wave
-			textureData[(texWidth*2+x)*3+1] = wave
-			textureData[(texWidth*2+x)*3+2] = wave
+	// The texture is updated once per frame, not for every sample of it.
+	if !at.updated || state.Time != at.time {
+		if err := at.source.Window(state.Time, at.window); err != nil {
+			state.Logger.Printf("Error reading %s: %v", at.uniformName, err)
 		}
+		at.analyzer.update(at.window, at.data)
+		at.time, at.updated = state.Time, true
 
 		gl.ActiveTexture(gl.TEXTURE0 + at.index)
 		gl.BindTexture(gl.TEXTURE_2D, at.id)
 		gl.TexSubImage2D(
-			gl.TEXTURE_2D,       // target,
-			0,                   // level,
-			0,                   // xoffset,
-			0,                   // yoffset,
-			texWidth,            // width,
-			texHeight,           // height,
-			gl.RGB,              // format,
-			gl.UNSIGNED_BYTE,    // type,
-			gl.Ptr(textureData), // data
+			gl.TEXTURE_2D,    // target,
+			0,                // level,
+			0,                // xoffset,
+			0,                // yoffset,
+			texWidth,         // width,
+			texHeight,        // height,
+			gl.RED,           // format,
+			gl.UNSIGNED_BYTE, // type,
+			gl.Ptr(at.data),  // data
 		)
+	}
+
+	if loc, ok := state.Uniforms[at.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + at.index)
+		gl.BindTexture(gl.TEXTURE_2D, at.id)
 		gl.Uniform1i(loc.Location, int32(at.index))
 	}
 	if m := shadertoy.IchannelNumRe.FindStringSubmatch(at.uniformName); m != nil {
@@ -203,7 +175,7 @@ func (at *texture) PreRender(state renderer.RenderState) {
 		gl.Uniform1f(loc.Location, float32(state.Time)/float32(time.Second))
 	}
 	if loc, ok := state.Uniforms["iSampleRate"]; ok {
-		gl.Uniform1f(loc.Location, float32(at.source.SampleRate))
+		gl.Uniform1f(loc.Location, float32(at.source.SampleRate()))
 	}
 }
 
@@ -212,14 +184,3 @@ func (at *texture) Close() error {
 	gl.DeleteTextures(1, &at.id)
 	return nil
 }
-
-func correlate(a, b []float64) float64 {
-	if len(a) != len(b) {
-		panic("mismatched slice lengths")
-	}
-	w := 0.0
-	for i := range a {
-		w += a[i] * b[i]
-	}
-	return w
-}
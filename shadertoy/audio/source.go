@@ -1,77 +1,283 @@
 package audio
 
 import (
+	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"os/exec"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-type source struct {
-	SampleRate int
-	Channels   int
-	Format     format
-	file       io.ReadCloser
+// sampleRate is the rate at which files and microphones are decoded. It is
+// the rate of most music, so the FFT covers the audible spectrum.
+const sampleRate = 44100
+
+// A source provides the most recent samples of an audio stream, mixed down
+// to mono in the range [-1, 1].
+type source interface {
+	// Window fills buf with the samples that end at time t of the stream.
+	// An error is returned once if the stream fails, after which it is
+	// silent.
+	Window(t time.Duration, buf []float64) error
+	SampleRate() int
+	Close() error
 }
 
-func newAudioFileSource(filename string) (*source, error) {
-	r, w := io.Pipe()
-	go func() {
-		cmd := exec.Command(
-			"ffmpeg",
-			"-i", filename,
-			"-f", "s16le",
-			"-acodec", "pcm_s16le",
-			"-ac", "1",
-			"-ar", "22000",
-			"-",
-		)
-		cmd.Stdout = w
-		if err := cmd.Run(); err != nil {
-			if err := w.CloseWithError(err); err != nil {
-				log.Print(err)
+// fileSource plays a file in sync with the time of the animation, so frames
+// rendered offline match the soundtrack.
+type fileSource struct {
+	filename string
+	history  []float64
+
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	pcm    *pcmReader
+	read   int64
+	closed bool
+}
+
+func newAudioFileSource(filename string) *fileSource {
+	return &fileSource{filename: filename}
+}
+
+func (s *fileSource) SampleRate() int {
+	return sampleRate
+}
+
+func (s *fileSource) Window(t time.Duration, buf []float64) error {
+	if len(s.history) != len(buf) {
+		s.history = make([]float64, len(buf))
+	}
+	end := int64(t) * sampleRate / int64(time.Second)
+	if s.cmd != nil && end < s.read {
+		// The animation went back in time, e.g. because it loops.
+		s.stop()
+		for i := range s.history {
+			s.history[i] = 0
+		}
+	}
+	var err error
+	if s.cmd == nil && !s.closed {
+		// Decoding starts at the first frame, which is not at 0 if the
+		// animation is started at an offset.
+		if err = s.start(end - int64(len(buf))); err != nil {
+			s.closed = true
+		}
+	}
+	if n := end - s.read; n > 0 {
+		var samples []float64
+		if s.pcm != nil {
+			if samples, err = s.pcm.Read(int(n)); err != nil {
+				// The file has ended, silence follows.
+				if err = s.cmd.Wait(); err != nil {
+					err = fmt.Errorf("%w: %s", err, strings.TrimSpace(s.stderr.String()))
+				}
+				s.pcm = nil
 			}
-			return
 		}
-		w.Close()
-	}()
-	return &source{
-		SampleRate: 22000,
-		Channels:   1,
-		Format:     "s16le",
-		file:       r,
-	}, nil
-}
-
-func (s *source) ReadSamples(period time.Duration) []float64 {
-	numBytes := s.Format.Bits() / 8
-	buf := make([]byte, s.SampleRate*s.Channels*int(period)/int(time.Second)*numBytes)
-	n, err := s.file.Read(buf)
+		samples = append(samples, make([]float64, int(n)-len(samples))...)
+		pushSamples(s.history, samples)
+		s.read = end
+	}
+	copy(buf, s.history)
 	if err != nil {
-		return make([]float64, time.Duration(s.SampleRate)*period/time.Second)
+		return fmt.Errorf("%s: %w", s.filename, err)
+	}
+	return nil
+}
+
+func (s *fileSource) start(offset int64) error {
+	if offset < 0 {
+		offset = 0
+	}
+	s.read = offset
+	s.cmd = exec.Command(
+		"ffmpeg",
+		"-ss", fmt.Sprintf("%.6f", float64(offset)/sampleRate),
+		"-i", s.filename,
+		"-f", "s16le",
+		"-acodec", "pcm_s16le",
+		"-ac", "1",
+		"-ar", strconv.Itoa(sampleRate),
+		"-loglevel", "error",
+		"-",
+	)
+	s.stderr.Reset()
+	s.cmd.Stderr = &s.stderr
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := s.cmd.Start(); err != nil {
+		return fmt.Errorf("could not start ffmpeg: %w", err)
+	}
+	s.pcm = &pcmReader{r: stdout, channels: 1, format: "s16le"}
+	return nil
+}
+
+func (s *fileSource) stop() {
+	if s.pcm != nil {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+	}
+	s.cmd, s.pcm = nil, nil
+}
+
+func (s *fileSource) Close() error {
+	s.closed = true
+	s.stop()
+	return nil
+}
+
+// liveSource reads a realtime stream, such as a microphone or a PCM pipe. The
+// window is the most recently produced audio, regardless of the time of the
+// animation, so information is skipped if rendering can not keep up.
+type liveSource struct {
+	sampleRate int
+	closer     io.Closer
+
+	lock    sync.Mutex
+	history []float64
+}
+
+func newLiveSource(r io.ReadCloser, sampleRate, channels int, format format) *liveSource {
+	s := &liveSource{
+		sampleRate: sampleRate,
+		closer:     r,
+		history:    make([]float64, texWidth*2),
 	}
+	pcm := &pcmReader{r: r, channels: channels, format: format}
+	go func() {
+		// Read in chunks of about 5ms to keep the latency low.
+		n := sampleRate / 200
+		if n < 1 {
+			n = 1
+		}
+		for {
+			samples, err := pcm.Read(n)
+			s.lock.Lock()
+			pushSamples(s.history, samples)
+			s.lock.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return s
+}
 
-	samples := make([]float64, n/numBytes)
-	switch s.Format {
-	case "s16le":
-		for i := range samples {
-			offset := i * s.Channels * numBytes
-			bytes := buf[offset : offset+numBytes]
-			sample := int16(bytes[0]) | int16(bytes[1])<<8
-			samples[i] = float64(sample) / float64(0x7fff)
+// newMicrophoneSource captures audio from an input device with FFmpeg. The
+// device is the default input if empty.
+func newMicrophoneSource(device string) (*liveSource, error) {
+	var input []string
+	switch runtime.GOOS {
+	case "darwin":
+		if device == "" {
+			device = "default"
+		}
+		input = []string{"-f", "avfoundation", "-i", ":" + device}
+	case "windows":
+		if device == "" {
+			return nil, fmt.Errorf("the name of the microphone must be specified on Windows")
 		}
+		input = []string{"-f", "dshow", "-i", "audio=" + device}
 	default:
-		panic(fmt.Sprintf("Unimplemented format %q", s.Format))
+		if device == "" {
+			device = "default"
+		}
+		input = []string{"-f", "pulse", "-i", device}
 	}
-	return samples
+	args := append(input,
+		"-f", "s16le",
+		"-acodec", "pcm_s16le",
+		"-ac", "1",
+		"-ar", strconv.Itoa(sampleRate),
+		"-loglevel", "error",
+		"-",
+	)
+	cmd := exec.Command("ffmpeg", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start ffmpeg: %w", err)
+	}
+	return newLiveSource(&cmdReader{ReadCloser: stdout, cmd: cmd}, sampleRate, 1, "s16le"), nil
+}
+
+func (s *liveSource) SampleRate() int {
+	return s.sampleRate
+}
+
+func (s *liveSource) Window(t time.Duration, buf []float64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	copy(buf, s.history[len(s.history)-len(buf):])
+	return nil
+}
+
+func (s *liveSource) Close() error {
+	return s.closer.Close()
 }
 
-func (s *source) Close() error {
-	return s.file.Close()
+// cmdReader stops a command when its output is closed.
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
 }
 
+func (r *cmdReader) Close() error {
+	r.cmd.Process.Kill()
+	r.ReadCloser.Close()
+	r.cmd.Wait()
+	return nil
+}
+
+// pushSamples appends samples to the end of a fixed size history, dropping
+// the oldest ones.
+func pushSamples(history, samples []float64) {
+	if len(samples) >= len(history) {
+		copy(history, samples[len(samples)-len(history):])
+		return
+	}
+	copy(history, history[len(samples):])
+	copy(history[len(history)-len(samples):], samples)
+}
+
+// pcmReader decodes interleaved PCM samples and mixes the channels down to
+// mono.
+type pcmReader struct {
+	r        io.Reader
+	channels int
+	format   format
+}
+
+// Read reads up to n samples. Fewer samples are returned along with an error
+// if the stream ends.
+func (p *pcmReader) Read(n int) ([]float64, error) {
+	size := p.format.Bits() / 8
+	buf := make([]byte, n*p.channels*size)
+	read, err := io.ReadFull(p.r, buf)
+	frames := read / (p.channels * size)
+	samples := make([]float64, frames)
+	for i := range samples {
+		var sum float64
+		for c := 0; c < p.channels; c++ {
+			offset := (i*p.channels + c) * size
+			sum += p.format.decode(buf[offset : offset+size])
+		}
+		samples[i] = sum / float64(p.channels)
+	}
+	return samples, err
+}
+
+// format is a PCM sample format as accepted by FFmpeg, such as s16le: the
+// sign, the number of bits and the endianness.
 type format string
 
 func (f format) Bits() int {
@@ -85,3 +291,23 @@ func (f format) Bits() int {
 	}
 	return b
 }
+
+// decode converts a single sample to the range [-1, 1].
+func (f format) decode(b []byte) float64 {
+	var v uint64
+	for i := range b {
+		if f[len(f)-2] == 'l' {
+			v |= uint64(b[i]) << (8 * i)
+		} else {
+			v = v<<8 | uint64(b[i])
+		}
+	}
+	bits := uint(len(b) * 8)
+	half := float64(uint64(1) << (bits - 1))
+	if f[0] == 'u' {
+		return float64(v)/half - 1
+	}
+	// Sign extend.
+	sv := int64(v<<(64-bits)) >> (64 - bits)
+	return float64(sv) / half
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
 
@@ -11,7 +12,7 @@ import (
 )
 
 func init() {
-	RegisterResourceType("buffer", func(m Mapping, genTexID GenTexFunc, _ renderer.RenderState) (Resource, error) {
+	RegisterResourceType("buffer", func(m Mapping, genTexID GenTexFunc, state renderer.RenderState) (Resource, error) {
 		match := bufferValueRe.FindStringSubmatch(m.Value)
 		if match == nil {
 			return nil, fmt.Errorf("could not parse buffer value: %q (format: %s)", m.Value, bufferValueRe)
@@ -21,11 +22,11 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
-		width, err := strconv.ParseUint(match[2], 10, 32)
+		width, height, scale, err := parseBufferSize(match[2], state.CanvasWidth, state.CanvasHeight)
 		if err != nil {
 			return nil, err
 		}
-		height, err := strconv.ParseUint(match[3], 10, 32)
+		schedule, err := parseBufferSchedule(match[3])
 		if err != nil {
 			return nil, err
 		}
@@ -39,14 +40,54 @@ func init() {
 			name:     m.Name,
 			index:    genTexID(),
 			filename: filename,
-			width:    uint(width),
-			height:   uint(height),
-			sources:  renderer.SourceFiles(sources...),
+			width:    width,
+			height:   height,
+			scale:    scale,
+			sources:  renderer.TemplateSourceFiles(m.templateData, sources...),
+			schedule: schedule,
 		}, nil
 	})
 }
 
-var bufferValueRe = regexp.MustCompile(`^([^;]+);(\d+)x(\d+)$`)
+var (
+	bufferValueRe     = regexp.MustCompile(`^([^;]+);([^;]+)(?:;(.+))?$`)
+	bufferEveryRe     = regexp.MustCompile(`^every=(\d+)$`)
+	bufferOnRe        = regexp.MustCompile(`^on=(\w+)$`)
+	bufferAbsSizeRe   = regexp.MustCompile(`^(\d+)x(\d+)$`)
+	bufferScaleSizeRe = regexp.MustCompile(`^(\d*\.?\d+)$`)
+)
+
+// parseBufferSize parses the size of a buffer. This is either an absolute
+// size formatted as WxH, or a scale factor relative to the size of the canvas
+// of the shader mapping the buffer, e.g. 0.25 for a quarter resolution buffer.
+// The scale factor is returned as well, and is 0 for absolute sizes.
+func parseBufferSize(s string, canvasWidth, canvasHeight uint) (uint, uint, float64, error) {
+	if match := bufferAbsSizeRe.FindStringSubmatch(s); match != nil {
+		width, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		height, err := strconv.ParseUint(match[2], 10, 32)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if width == 0 || height == 0 {
+			return 0, 0, 0, fmt.Errorf("buffer size can not be 0, got %q", s)
+		}
+		return uint(width), uint(height), 0, nil
+	}
+	if match := bufferScaleSizeRe.FindStringSubmatch(s); match != nil {
+		scale, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if scale == 0 {
+			return 0, 0, 0, fmt.Errorf("buffer scale can not be 0, got %q", s)
+		}
+		return renderer.ScaleSize(canvasWidth, scale), renderer.ScaleSize(canvasHeight, scale), scale, nil
+	}
+	return 0, 0, 0, fmt.Errorf("invalid buffer size: %q (format: WxH or a scale factor)", s)
+}
 
 type bufferImage struct {
 	name  string
@@ -54,7 +95,56 @@ type bufferImage struct {
 
 	filename      string
 	width, height uint
-	sources       []renderer.SourceFile
+	// scale is set for buffers sized relative to the canvas, in which case
+	// width and height are those of the canvas the buffer was set up for.
+	scale   float64
+	sources []renderer.SourceFile
+	// mappings are applied to the buffer's shader in addition to the
+	// mappings declared in its sources.
+	mappings []Mapping
+	// pass is the name of the pass of the pipeline rendered to the buffer,
+	// if any.
+	pass string
+
+	schedule bufferSchedule
+}
+
+// A bufferSchedule determines when a buffer is rendered, see
+// renderer.SubEnvironment.
+type bufferSchedule struct {
+	every uint
+	once  bool
+	on    []string
+}
+
+// parseBufferSchedule parses the optional part of a buffer mapping that
+// determines when the buffer is rendered. This is a comma separated list of
+// "every=N" to render every Nth frame, "once" to only render the first frame
+// and "on=UNIFORM" to render when the value set for the uniform changes.
+func parseBufferSchedule(s string) (bufferSchedule, error) {
+	var schedule bufferSchedule
+	if s == "" {
+		return schedule, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		if field == "once" {
+			schedule.once = true
+		} else if match := bufferEveryRe.FindStringSubmatch(field); match != nil {
+			every, err := strconv.ParseUint(match[1], 10, 32)
+			if err != nil {
+				return bufferSchedule{}, err
+			}
+			schedule.every = uint(every)
+		} else if match := bufferOnRe.FindStringSubmatch(field); match != nil {
+			schedule.on = append(schedule.on, match[1])
+		} else {
+			return bufferSchedule{}, fmt.Errorf("invalid buffer schedule: %q (format: every=N, once or on=UNIFORM, separated by commas)", s)
+		}
+	}
+	if schedule.once && schedule.every != 0 {
+		return bufferSchedule{}, fmt.Errorf("invalid buffer schedule: %q (once can not be combined with every)", s)
+	}
+	return schedule, nil
 }
 
 func (tex *bufferImage) UniformSource() string {
@@ -64,7 +154,16 @@ func (tex *bufferImage) UniformSource() string {
 	`, tex.name, tex.name)
 }
 
+// size returns the size of the buffer for a canvas of the specified size.
+func (tex *bufferImage) size(canvasWidth, canvasHeight uint) (uint, uint) {
+	if tex.scale == 0 {
+		return tex.width, tex.height
+	}
+	return renderer.ScaleSize(canvasWidth, tex.scale), renderer.ScaleSize(canvasHeight, tex.scale)
+}
+
 func (tex *bufferImage) PreRender(state renderer.RenderState) {
+	width, height := tex.size(state.CanvasWidth, state.CanvasHeight)
 	if loc, ok := state.Uniforms[tex.name]; ok {
 		gl.ActiveTexture(gl.TEXTURE0 + tex.index)
 		gl.BindTexture(gl.TEXTURE_2D, state.SubBuffers[tex.name])
@@ -72,11 +171,11 @@ func (tex *bufferImage) PreRender(state renderer.RenderState) {
 	}
 	if m := IchannelNumRe.FindStringSubmatch(tex.name); m != nil {
 		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
-			gl.Uniform3f(loc.Location, float32(tex.width), float32(tex.height), 1.0)
+			gl.Uniform3f(loc.Location, float32(width), float32(height), 1.0)
 		}
 	}
 	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", tex.name)]; ok {
-		gl.Uniform3f(loc.Location, float32(tex.width), float32(tex.height), 1.0)
+		gl.Uniform3f(loc.Location, float32(width), float32(height), 1.0)
 	}
 }
 
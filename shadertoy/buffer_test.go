@@ -0,0 +1,86 @@
+package shadertoy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBufferSize(t *testing.T) {
+	tests := []struct {
+		in            string
+		width, height uint
+		scale         float64
+		err           bool
+	}{
+		{in: "512x256", width: 512, height: 256},
+		{in: "1x1", width: 1, height: 1},
+		{in: "0.5", width: 320, height: 240, scale: 0.5},
+		{in: ".25", width: 160, height: 120, scale: 0.25},
+		{in: "2", width: 1280, height: 960, scale: 2},
+		// Tiny scales are at least a pixel.
+		{in: "0.0001", width: 1, height: 1, scale: 0.0001},
+		{in: "0x256", err: true},
+		{in: "512x0", err: true},
+		{in: "0", err: true},
+		{in: "-1", err: true},
+		{in: "512", width: 327680, height: 245760, scale: 512},
+		{in: "512x", err: true},
+		{in: "half", err: true},
+		{in: "", err: true},
+	}
+	for _, test := range tests {
+		width, height, scale, err := parseBufferSize(test.in, 640, 480)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.in, err)
+			continue
+		}
+		if width != test.width || height != test.height || scale != test.scale {
+			t.Errorf("%q: exp %dx%d at scale %g, got %dx%d at scale %g", test.in, test.width, test.height, test.scale, width, height, scale)
+		}
+	}
+}
+
+func TestParseBufferSchedule(t *testing.T) {
+	tests := []struct {
+		in       string
+		schedule bufferSchedule
+		err      bool
+	}{
+		{in: "", schedule: bufferSchedule{}},
+		{in: "once", schedule: bufferSchedule{once: true}},
+		{in: "every=4", schedule: bufferSchedule{every: 4}},
+		{in: "on=seed", schedule: bufferSchedule{on: []string{"seed"}}},
+		{in: "on=seed,on=bake", schedule: bufferSchedule{on: []string{"seed", "bake"}}},
+		{in: "every=10,on=seed", schedule: bufferSchedule{every: 10, on: []string{"seed"}}},
+		{in: "once,on=seed", schedule: bufferSchedule{once: true, on: []string{"seed"}}},
+		{in: "once,every=2", err: true},
+		{in: "every=", err: true},
+		{in: "every=-1", err: true},
+		{in: "on=", err: true},
+		{in: "on=a b", err: true},
+		{in: "twice", err: true},
+		{in: "once,", err: true},
+	}
+	for _, test := range tests {
+		schedule, err := parseBufferSchedule(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(schedule, test.schedule) {
+			t.Errorf("%q: exp %+v, got %+v", test.in, test.schedule, schedule)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package camera
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterResourceType("camera", func(m shadertoy.Mapping, _ shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		filename, err := shadertoy.ResolvePath(m.PWD, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		fd, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		path, err := ReadPath(fd)
+		if err != nil {
+			return nil, fmt.Errorf("error reading camera path %q: %v", filename, err)
+		}
+		return &cameraPath{uniformName: m.Name, path: path}, nil
+	})
+}
+
+// cameraPath exposes the camera matrix at the current time of a path as a
+// mat4 uniform.
+type cameraPath struct {
+	uniformName string
+	path        *Path
+}
+
+func (cp *cameraPath) UniformSource() string {
+	return fmt.Sprintf("uniform mat4 %s;", cp.uniformName)
+}
+
+func (cp *cameraPath) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms[cp.uniformName]; ok {
+		m := cp.path.Matrix(state.Time)
+		gl.UniformMatrix4fv(loc.Location, 1, false, &m[0])
+	}
+}
+
+func (cp *cameraPath) Close() error {
+	return nil
+}
@@ -0,0 +1,221 @@
+package camera
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// A Keyframe is a position and orientation of the camera at some point in
+// time.
+type Keyframe struct {
+	// Time is the number of seconds since the start of the animation.
+	Time     float64    `json:"time"`
+	Position [3]float64 `json:"position"`
+	// Orientation is a quaternion formatted as [x, y, z, w]. It is ignored
+	// if Target is set.
+	Orientation *[4]float64 `json:"orientation,omitempty"`
+	// Target is a point the camera is looking at.
+	Target *[3]float64 `json:"target,omitempty"`
+}
+
+// A Path is a sequence of keyframes through which the camera moves.
+//
+// Positions are interpolated using a Catmull-Rom spline, orientations are
+// interpolated spherically.
+type Path struct {
+	Keyframes []Keyframe `json:"keyframes"`
+	// Loop restarts the path after the last keyframe, instead of holding
+	// the camera at its last position.
+	Loop bool `json:"loop"`
+}
+
+// ReadPath decodes a path from JSON.
+func ReadPath(r io.Reader) (*Path, error) {
+	var path Path
+	if err := json.NewDecoder(r).Decode(&path); err != nil {
+		return nil, err
+	}
+	if len(path.Keyframes) == 0 {
+		return nil, fmt.Errorf("camera path has no keyframes")
+	}
+	sort.SliceStable(path.Keyframes, func(i, j int) bool {
+		return path.Keyframes[i].Time < path.Keyframes[j].Time
+	})
+	return &path, nil
+}
+
+// Matrix returns the camera-to-world matrix of the camera at the specified
+// time in column major order. The camera looks along its negative Z axis
+// with Y up, like an OpenGL camera.
+func (path *Path) Matrix(t time.Duration) [16]float32 {
+	pos, rot := path.at(t.Seconds())
+	m := rot.matrix()
+	m[12], m[13], m[14] = float32(pos[0]), float32(pos[1]), float32(pos[2])
+	return m
+}
+
+// at returns the interpolated position and orientation at the specified
+// number of seconds.
+func (path *Path) at(t float64) ([3]float64, quat) {
+	kf := path.Keyframes
+	first, last := kf[0].Time, kf[len(kf)-1].Time
+	if path.Loop && last > first {
+		t = first + math.Mod(t-first, last-first)
+		if t < first {
+			t += last - first
+		}
+	}
+	if t <= first || len(kf) == 1 {
+		return kf[0].Position, kf[0].orientation()
+	}
+	if t >= last {
+		return kf[len(kf)-1].Position, kf[len(kf)-1].orientation()
+	}
+
+	i := sort.Search(len(kf), func(i int) bool { return kf[i].Time > t }) - 1
+	k1, k2 := kf[i], kf[i+1]
+	f := 0.0
+	if k2.Time > k1.Time {
+		f = (t - k1.Time) / (k2.Time - k1.Time)
+	}
+
+	var pos [3]float64
+	for j := range pos {
+		p1, p2 := k1.Position[j], k2.Position[j]
+		// Extrapolate the control points beyond the ends of the path, so
+		// the camera does not slow down near the first and last keyframes.
+		p0, p3 := 2*p1-p2, 2*p2-p1
+		if i > 0 {
+			p0 = kf[i-1].Position[j]
+		}
+		if i+2 < len(kf) {
+			p3 = kf[i+2].Position[j]
+		}
+		pos[j] = catmullRom(p0, p1, p2, p3, f)
+	}
+	return pos, slerp(k1.orientation(), k2.orientation(), f)
+}
+
+func (k Keyframe) orientation() quat {
+	if k.Target != nil {
+		return lookAt(k.Position, *k.Target)
+	}
+	if k.Orientation != nil {
+		return quat(*k.Orientation).normalize()
+	}
+	return quat{0, 0, 0, 1}
+}
+
+func catmullRom(p0, p1, p2, p3, t float64) float64 {
+	t2, t3 := t*t, t*t*t
+	return 0.5 * (2*p1 +
+		(-p0+p2)*t +
+		(2*p0-5*p1+4*p2-p3)*t2 +
+		(-p0+3*p1-3*p2+p3)*t3)
+}
+
+// quat is a quaternion formatted as [x, y, z, w].
+type quat [4]float64
+
+func (q quat) normalize() quat {
+	l := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+	if l == 0 {
+		return quat{0, 0, 0, 1}
+	}
+	return quat{q[0] / l, q[1] / l, q[2] / l, q[3] / l}
+}
+
+func slerp(a, b quat, t float64) quat {
+	dot := a[0]*b[0] + a[1]*b[1] + a[2]*b[2] + a[3]*b[3]
+	if dot < 0 {
+		// Take the shortest path.
+		b = quat{-b[0], -b[1], -b[2], -b[3]}
+		dot = -dot
+	}
+	if dot > 0.9995 {
+		// The quaternions are nearly equal, interpolate linearly to avoid
+		// dividing by zero.
+		var q quat
+		for i := range q {
+			q[i] = a[i] + (b[i]-a[i])*t
+		}
+		return q.normalize()
+	}
+	theta := math.Acos(dot)
+	sa, sb := math.Sin((1-t)*theta)/math.Sin(theta), math.Sin(t*theta)/math.Sin(theta)
+	var q quat
+	for i := range q {
+		q[i] = a[i]*sa + b[i]*sb
+	}
+	return q
+}
+
+// lookAt returns the orientation of a camera at the specified position
+// looking at the target with Y up.
+func lookAt(pos, target [3]float64) quat {
+	fwd := normalize3([3]float64{target[0] - pos[0], target[1] - pos[1], target[2] - pos[2]})
+	right := normalize3(cross(fwd, [3]float64{0, 1, 0}))
+	if right == ([3]float64{}) {
+		// Looking straight up or down.
+		right = [3]float64{1, 0, 0}
+	}
+	up := cross(right, fwd)
+	// The columns of the rotation matrix are right, up and -forward.
+	m := [3][3]float64{
+		{right[0], up[0], -fwd[0]},
+		{right[1], up[1], -fwd[1]},
+		{right[2], up[2], -fwd[2]},
+	}
+	return fromRotation(m)
+}
+
+// fromRotation converts a row major rotation matrix to a quaternion.
+func fromRotation(m [3][3]float64) quat {
+	var q quat
+	switch tr := m[0][0] + m[1][1] + m[2][2]; {
+	case tr > 0:
+		s := math.Sqrt(tr+1) * 2
+		q = quat{(m[2][1] - m[1][2]) / s, (m[0][2] - m[2][0]) / s, (m[1][0] - m[0][1]) / s, s / 4}
+	case m[0][0] > m[1][1] && m[0][0] > m[2][2]:
+		s := math.Sqrt(1+m[0][0]-m[1][1]-m[2][2]) * 2
+		q = quat{s / 4, (m[0][1] + m[1][0]) / s, (m[0][2] + m[2][0]) / s, (m[2][1] - m[1][2]) / s}
+	case m[1][1] > m[2][2]:
+		s := math.Sqrt(1+m[1][1]-m[0][0]-m[2][2]) * 2
+		q = quat{(m[0][1] + m[1][0]) / s, s / 4, (m[1][2] + m[2][1]) / s, (m[0][2] - m[2][0]) / s}
+	default:
+		s := math.Sqrt(1+m[2][2]-m[0][0]-m[1][1]) * 2
+		q = quat{(m[0][2] + m[2][0]) / s, (m[1][2] + m[2][1]) / s, s / 4, (m[1][0] - m[0][1]) / s}
+	}
+	return q.normalize()
+}
+
+// matrix returns the rotation as a column major 4x4 matrix.
+func (q quat) matrix() [16]float32 {
+	x, y, z, w := q[0], q[1], q[2], q[3]
+	return [16]float32{
+		float32(1 - 2*(y*y+z*z)), float32(2 * (x*y + z*w)), float32(2 * (x*z - y*w)), 0,
+		float32(2 * (x*y - z*w)), float32(1 - 2*(x*x+z*z)), float32(2 * (y*z + x*w)), 0,
+		float32(2 * (x*z + y*w)), float32(2 * (y*z - x*w)), float32(1 - 2*(x*x+y*y)), 0,
+		0, 0, 0, 1,
+	}
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func normalize3(v [3]float64) [3]float64 {
+	l := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	if l == 0 {
+		return [3]float64{}
+	}
+	return [3]float64{v[0] / l, v[1] / l, v[2] / l}
+}
@@ -0,0 +1,65 @@
+package camera
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPathInterpolation(t *testing.T) {
+	path, err := ReadPath(strings.NewReader(`{"keyframes": [
+		{"time": 2, "position": [2, 0, 0]},
+		{"time": 0, "position": [0, 0, 0]},
+		{"time": 1, "position": [1, 0, 0]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		t, x float64
+	}{
+		{-1, 0},
+		{0, 0},
+		{0.5, 0.5},
+		{1.5, 1.5},
+		{3, 2},
+	} {
+		pos, _ := path.at(c.t)
+		if math.Abs(pos[0]-c.x) > 1e-9 {
+			t.Errorf("unexpected position at %v: exp %v, got %v", c.t, c.x, pos[0])
+		}
+	}
+}
+
+func TestPathLoop(t *testing.T) {
+	path, err := ReadPath(strings.NewReader(`{"loop": true, "keyframes": [
+		{"time": 0, "position": [0, 0, 0]},
+		{"time": 2, "position": [2, 0, 0]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos, _ := path.at(3); math.Abs(pos[0]-1) > 1e-9 {
+		t.Fatalf("unexpected position after looping: %v", pos)
+	}
+}
+
+func TestPathTarget(t *testing.T) {
+	path, err := ReadPath(strings.NewReader(`{"keyframes": [
+		{"time": 0, "position": [0, 0, 5], "target": [5, 0, 5]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := path.Matrix(time.Second)
+	// The camera looks along its negative Z axis, which should point at
+	// the target.
+	fwd := [3]float32{-m[8], -m[9], -m[10]}
+	if math.Abs(float64(fwd[0]-1)) > 1e-6 || math.Abs(float64(fwd[1])) > 1e-6 || math.Abs(float64(fwd[2])) > 1e-6 {
+		t.Fatalf("unexpected forward vector: %v", fwd)
+	}
+	if m[12] != 0 || m[13] != 0 || m[14] != 5 {
+		t.Fatalf("unexpected translation: %v", m[12:15])
+	}
+}
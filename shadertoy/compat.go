@@ -0,0 +1,83 @@
+package shadertoy
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// SetCompatible makes the environment behave like shadertoy.com where Shady
+// deviates from it, so shaders copied from there run unmodified:
+//
+//   - iFrame is declared as an int instead of a float.
+//   - iChannel0 to iChannel3 are declared as empty textures, which sample as
+//     transparent black, unless they are mapped.
+//
+// Sub-environments, such as buffers and passes, inherit the setting. It
+// should be called before the environment is used to render.
+func (st *ShaderToy) SetCompatible(compat bool) {
+	st.compat = compat
+}
+
+// emptyChannels returns the resources of the channels that are not mapped.
+func (st *ShaderToy) emptyChannels() []Resource {
+	mapped := map[string]bool{}
+	for _, m := range st.mappings {
+		mapped[m.Name] = true
+	}
+	var resources []Resource
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("iChannel%d", i)
+		if !mapped[name] {
+			resources = append(resources, newEmptyChannel(name, genTexID()))
+		}
+	}
+	return resources
+}
+
+// emptyChannel is a texture of a single transparent black pixel, as sampled
+// from channels without an input on shadertoy.com.
+type emptyChannel struct {
+	uniformName string
+	id          uint32
+	index       uint32
+}
+
+func newEmptyChannel(uniformName string, index uint32) *emptyChannel {
+	ch := &emptyChannel{uniformName: uniformName, index: index}
+	pixel := [4]uint8{}
+	gl.GenTextures(1, &ch.id)
+	gl.BindTexture(gl.TEXTURE_2D, ch.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, 1, 1, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(&pixel[0]))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return ch
+}
+
+func (ch *emptyChannel) UniformSource() string {
+	return fmt.Sprintf("uniform sampler2D %s;", ch.uniformName)
+}
+
+func (ch *emptyChannel) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms[ch.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + ch.index)
+		gl.BindTexture(gl.TEXTURE_2D, ch.id)
+		gl.Uniform1i(loc.Location, int32(ch.index))
+	}
+}
+
+func (ch *emptyChannel) Close() error {
+	gl.DeleteTextures(1, &ch.id)
+	return nil
+}
+
+// frameType returns the GLSL type of iFrame.
+func (st ShaderToy) frameType() string {
+	if st.compat {
+		return "int"
+	}
+	return "float"
+}
@@ -0,0 +1,265 @@
+// Package data drives uniforms with values from a file with a row per frame,
+// such as automation exported from a DAW or motion capture data.
+//
+// A file is mapped to a struct uniform with a field for each column:
+//
+//	#pragma map mocap=data:capture.csv
+//
+// CSV files have a header with the names of the columns, followed by a row of
+// numbers per frame. JSON files contain an array with an object per frame,
+// of which the values are numbers or arrays of 2 to 4 numbers, for vectors.
+// If a column is named "frame", it holds the number of the frame a row is
+// applied from, otherwise rows are applied to consecutive frames. The last
+// row is held after the end of the file.
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// frameColumn is the name of the column holding frame numbers.
+const frameColumn = "frame"
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func init() {
+	shadertoy.RegisterResourceType("data", func(m shadertoy.Mapping, _ shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		path, err := shadertoy.ResolvePath(m.PWD, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		table, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		return &resource{uniformName: m.Name, table: table}, nil
+	})
+}
+
+// A Column is a field of the uniform.
+type Column struct {
+	Name string
+	// Size is the number of components, 1 for a float and 2 to 4 for
+	// vectors.
+	Size int
+}
+
+// A Table holds the values of the columns for each frame.
+type Table struct {
+	Columns []Column
+	// Frames is the number of the frame each row is applied from, in
+	// ascending order.
+	Frames []uint64
+	// Rows holds the values of all columns of each row, in the order of
+	// the columns.
+	Rows [][]float32
+}
+
+// Load reads a table from a CSV or JSON file, depending on its extension.
+func Load(path string) (*Table, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table *Table
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		table, err = ParseJSON(buf)
+	} else {
+		table, err = ParseCSV(buf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
+
+// ParseCSV parses a table from CSV with a header. All columns are floats.
+func ParseCSV(buf []byte) (*Table, error) {
+	r := csv.NewReader(bytes.NewReader(buf))
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range header {
+		names = append(names, strings.TrimSpace(name))
+	}
+
+	var records []map[string][]float32
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		row := map[string][]float32{}
+		for i, s := range record {
+			v, err := strconv.ParseFloat(strings.TrimSpace(s), 32)
+			if err != nil {
+				line, _ := r.FieldPos(i)
+				return nil, fmt.Errorf("line %d: invalid value for %s: %q", line, names[i], s)
+			}
+			row[names[i]] = []float32{float32(v)}
+		}
+		records = append(records, row)
+	}
+	return newTable(names, records)
+}
+
+// ParseJSON parses a table from an array of objects.
+func ParseJSON(buf []byte) (*Table, error) {
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &objects); err != nil {
+		return nil, err
+	}
+	nameSet := map[string]bool{}
+	var records []map[string][]float32
+	for i, obj := range objects {
+		row := map[string][]float32{}
+		for name, raw := range obj {
+			var v float32
+			var vec []float32
+			if err := json.Unmarshal(raw, &v); err == nil {
+				vec = []float32{v}
+			} else if err := json.Unmarshal(raw, &vec); err != nil || len(vec) < 2 || len(vec) > 4 {
+				return nil, fmt.Errorf("row %d: %s is not a number or an array of 2 to 4 numbers", i, name)
+			}
+			row[name] = vec
+			nameSet[name] = true
+		}
+		records = append(records, row)
+	}
+	names := make([]string, 0, len(nameSet))
+	for name := range nameSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return newTable(names, records)
+}
+
+// newTable checks the records and converts them to a table. Values that are
+// missing from a record are held from the previous one.
+func newTable(names []string, records []map[string][]float32) (*Table, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the file has no rows")
+	}
+	t := &Table{}
+	for _, name := range names {
+		if name == frameColumn {
+			continue
+		}
+		if !identifierRe.MatchString(name) {
+			return nil, fmt.Errorf("column %q is not a valid GLSL identifier", name)
+		}
+		size := 0
+		for _, rec := range records {
+			if v, ok := rec[name]; ok {
+				if size != 0 && len(v) != size {
+					return nil, fmt.Errorf("column %q has values of different sizes", name)
+				}
+				size = len(v)
+			}
+		}
+		t.Columns = append(t.Columns, Column{Name: name, Size: size})
+	}
+
+	var prev []float32
+	for i, rec := range records {
+		frame := uint64(i)
+		if v, ok := rec[frameColumn]; ok {
+			if len(v) != 1 || v[0] < 0 {
+				return nil, fmt.Errorf("row %d: invalid frame number", i)
+			}
+			frame = uint64(v[0])
+		}
+		if i > 0 && frame <= t.Frames[i-1] {
+			return nil, fmt.Errorf("row %d: frame numbers must be ascending", i)
+		}
+		var row []float32
+		offset := 0
+		for _, col := range t.Columns {
+			if v, ok := rec[col.Name]; ok {
+				row = append(row, v...)
+			} else if prev != nil {
+				row = append(row, prev[offset:offset+col.Size]...)
+			} else {
+				row = append(row, make([]float32, col.Size)...)
+			}
+			offset += col.Size
+		}
+		t.Frames = append(t.Frames, frame)
+		t.Rows = append(t.Rows, row)
+		prev = row
+	}
+	return t, nil
+}
+
+// Row returns the values that apply to a frame.
+func (t *Table) Row(frame uint64) []float32 {
+	// The first row with a greater frame number follows the row that applies.
+	i := sort.Search(len(t.Frames), func(i int) bool { return t.Frames[i] > frame })
+	if i == 0 {
+		return t.Rows[0]
+	}
+	return t.Rows[i-1]
+}
+
+type resource struct {
+	uniformName string
+	table       *Table
+}
+
+func (r *resource) UniformSource() string {
+	var fields strings.Builder
+	for _, col := range r.table.Columns {
+		typ := "float"
+		if col.Size > 1 {
+			typ = fmt.Sprintf("vec%d", col.Size)
+		}
+		fmt.Fprintf(&fields, "%s %s; ", typ, col.Name)
+	}
+	return fmt.Sprintf("struct %[1]s_data { %[2]s}; uniform %[1]s_data %[1]s;", r.uniformName, fields.String())
+}
+
+func (r *resource) PreRender(state renderer.RenderState) {
+	row := r.table.Row(state.FramesProcessed)
+	offset := 0
+	for _, col := range r.table.Columns {
+		v := row[offset : offset+col.Size]
+		offset += col.Size
+		loc, ok := state.Uniforms[r.uniformName+"."+col.Name]
+		if !ok {
+			continue
+		}
+		switch col.Size {
+		case 1:
+			gl.Uniform1fv(loc.Location, 1, &v[0])
+		case 2:
+			gl.Uniform2fv(loc.Location, 1, &v[0])
+		case 3:
+			gl.Uniform3fv(loc.Location, 1, &v[0])
+		case 4:
+			gl.Uniform4fv(loc.Location, 1, &v[0])
+		}
+	}
+}
+
+func (r *resource) Close() error { return nil }
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	table, err := ParseCSV([]byte("frame, kick, snare\n0, 1, 0\n# A comment\n10, 0.5, 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []Column{{"kick", 1}, {"snare", 1}}; !reflect.DeepEqual(table.Columns, exp) {
+		t.Fatalf("unexpected columns: %v", table.Columns)
+	}
+	for frame, exp := range map[uint64][]float32{0: {1, 0}, 9: {1, 0}, 10: {0.5, 1}, 100: {0.5, 1}} {
+		if row := table.Row(frame); !reflect.DeepEqual(row, exp) {
+			t.Fatalf("unexpected row for frame %d: %v", frame, row)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	table, err := ParseJSON([]byte(`[
+		{"hand": [1, 2, 3], "grip": 0},
+		{"hand": [4, 5, 6]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []Column{{"grip", 1}, {"hand", 3}}; !reflect.DeepEqual(table.Columns, exp) {
+		t.Fatalf("unexpected columns: %v", table.Columns)
+	}
+	// Missing values are held from the previous row.
+	if row := table.Row(1); !reflect.DeepEqual(row, []float32{0, 4, 5, 6}) {
+		t.Fatalf("unexpected row: %v", row)
+	}
+
+	if _, err := ParseJSON([]byte(`[{"not-glsl": 1}]`)); err == nil {
+		t.Fatalf("expected an error for an invalid name")
+	}
+}
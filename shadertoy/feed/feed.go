@@ -0,0 +1,180 @@
+// Package feed lets programs that embed shady push frames into shaders, for
+// example the output of a computer vision pipeline.
+//
+// A Feed is created with a name, after which shaders can use it with a
+// mapping in the "feed" namespace:
+//
+//	#pragma map iChannel0=feed:NAME
+//
+// Frames may be pushed from any goroutine as image.Image, as raw BGR, BGRA or
+// grayscale pixels as produced by OpenCV, or as a gocv.Mat. Shaders use the
+// most recent frame.
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"sync"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+var (
+	feedsLock sync.Mutex
+	feeds     = map[string]*Feed{}
+)
+
+func init() {
+	shadertoy.RegisterChannelSource("feed", func(m shadertoy.Mapping) (shadertoy.ChannelSource, error) {
+		feedsLock.Lock()
+		defer feedsLock.Unlock()
+		f, ok := feeds[m.Value]
+		if !ok {
+			return nil, fmt.Errorf("no such feed: %q", m.Value)
+		}
+		return &feedSource{feed: f}, nil
+	})
+}
+
+// A Feed holds the latest frame pushed by a program.
+type Feed struct {
+	name string
+
+	lock sync.Mutex
+	img  *image.RGBA
+	// version is incremented for every frame, so sources can tell whether
+	// the frame changed.
+	version uint64
+}
+
+// New creates a feed that shaders can map by its name.
+func New(name string) (*Feed, error) {
+	feedsLock.Lock()
+	defer feedsLock.Unlock()
+	if _, ok := feeds[name]; ok {
+		return nil, fmt.Errorf("feed %q already exists", name)
+	}
+	f := &Feed{name: name}
+	feeds[name] = f
+	return f, nil
+}
+
+// Push sets the current frame of the feed. The image is copied, so it may be
+// reused by the caller.
+func (f *Feed) Push(img image.Image) {
+	b := img.Bounds()
+	// A new image is used for every frame, as the current frame may not have
+	// been uploaded yet.
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	f.publish(rgba)
+}
+
+// PushBGR sets the current frame of the feed from pixels in the order used by
+// OpenCV. The number of channels is 1 for grayscale, 3 for BGR or 4 for BGRA,
+// with 8 bits per channel. Stride is the number of bytes between the starts
+// of two rows.
+func (f *Feed) PushBGR(pix []byte, width, height, stride, channels int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid frame size %dx%d", width, height)
+	}
+	if channels != 1 && channels != 3 && channels != 4 {
+		return fmt.Errorf("unsupported number of channels: %d", channels)
+	}
+	if stride < width*channels || len(pix) < stride*(height-1)+width*channels {
+		return errors.New("the frame is smaller than its size and stride")
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	bgrToRGBA(rgba, pix, stride, channels)
+	f.publish(rgba)
+	return nil
+}
+
+// Mat is implemented by *gocv.Mat. Only matrices with 8 bits per channel are
+// supported.
+type Mat interface {
+	Empty() bool
+	Rows() int
+	Cols() int
+	Channels() int
+	ElemSize() int
+	Step() int
+	DataPtrUint8() ([]uint8, error)
+}
+
+// PushMat sets the current frame of the feed from an OpenCV matrix.
+func (f *Feed) PushMat(m Mat) error {
+	if m.Empty() {
+		return errors.New("the matrix is empty")
+	}
+	if m.ElemSize() != m.Channels() {
+		return fmt.Errorf("unsupported matrix depth: %d bytes per channel", m.ElemSize()/m.Channels())
+	}
+	pix, err := m.DataPtrUint8()
+	if err != nil {
+		return err
+	}
+	return f.PushBGR(pix, m.Cols(), m.Rows(), m.Step(), m.Channels())
+}
+
+func (f *Feed) publish(img *image.RGBA) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.img = img
+	f.version++
+}
+
+func (f *Feed) current() (*image.RGBA, uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.img, f.version
+}
+
+// Close removes the feed. Shaders that map it keep showing the last frame.
+func (f *Feed) Close() error {
+	feedsLock.Lock()
+	defer feedsLock.Unlock()
+	if feeds[f.name] == f {
+		delete(feeds, f.name)
+	}
+	return nil
+}
+
+func bgrToRGBA(dst *image.RGBA, pix []byte, stride, channels int) {
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	for y := 0; y < h; y++ {
+		src := pix[y*stride : y*stride+w*channels]
+		row := dst.Pix[y*dst.Stride : y*dst.Stride+w*4]
+		for x := 0; x < w; x++ {
+			s, d := src[x*channels:], row[x*4:]
+			switch channels {
+			case 1:
+				d[0], d[1], d[2], d[3] = s[0], s[0], s[0], 0xff
+			case 3:
+				d[0], d[1], d[2], d[3] = s[2], s[1], s[0], 0xff
+			case 4:
+				d[0], d[1], d[2], d[3] = s[2], s[1], s[0], s[3]
+			}
+		}
+	}
+}
+
+// feedSource is a ChannelSource of the frames of a feed.
+type feedSource struct {
+	feed    *Feed
+	version uint64
+}
+
+func (src *feedSource) Image(state renderer.RenderState) (image.Image, error) {
+	img, version := src.feed.current()
+	if img == nil || version == src.version {
+		return nil, nil
+	}
+	src.version = version
+	return img, nil
+}
+
+func (src *feedSource) Close() error { return nil }
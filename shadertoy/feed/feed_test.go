@@ -0,0 +1,75 @@
+package feed
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type fakeMat struct {
+	rows, cols, channels, step int
+	pix                        []uint8
+}
+
+func (m fakeMat) Empty() bool                    { return len(m.pix) == 0 }
+func (m fakeMat) Rows() int                      { return m.rows }
+func (m fakeMat) Cols() int                      { return m.cols }
+func (m fakeMat) Channels() int                  { return m.channels }
+func (m fakeMat) ElemSize() int                  { return m.channels }
+func (m fakeMat) Step() int                      { return m.step }
+func (m fakeMat) DataPtrUint8() ([]uint8, error) { return m.pix, nil }
+
+func TestPushMat(t *testing.T) {
+	f, err := New("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := New("test"); err == nil {
+		t.Fatal("expected an error for a duplicate name")
+	}
+
+	// A 2x2 BGR image with a padded stride.
+	mat := fakeMat{rows: 2, cols: 2, channels: 3, step: 8, pix: []uint8{
+		255, 0, 0, 0, 255, 0, 0, 0,
+		0, 0, 255, 1, 2, 3, 0, 0,
+	}}
+	if err := f.PushMat(mat); err != nil {
+		t.Fatal(err)
+	}
+	img, _ := f.current()
+	exp := []color.RGBA{{0, 0, 255, 255}, {0, 255, 0, 255}, {255, 0, 0, 255}, {3, 2, 1, 255}}
+	for i, c := range exp {
+		if got := img.RGBAAt(i%2, i/2); got != c {
+			t.Errorf("pixel %d: exp %v, got %v", i, c, got)
+		}
+	}
+
+	if err := f.PushBGR(make([]byte, 3), 2, 2, 2, 1); err == nil {
+		t.Fatal("expected an error for a short buffer")
+	}
+	if err := f.PushBGR(make([]byte, 8), 2, 2, 4, 2); err == nil {
+		t.Fatal("expected an error for an unsupported number of channels")
+	}
+}
+
+func TestFeedSource(t *testing.T) {
+	f, err := New("source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	src := &feedSource{feed: f}
+	if img, _ := src.Image(renderer.RenderState{}); img != nil {
+		t.Fatal("exp no image before a frame was pushed")
+	}
+	f.Push(image.NewGray(image.Rect(0, 0, 4, 4)))
+	if img, _ := src.Image(renderer.RenderState{}); img == nil || img.Bounds().Dx() != 4 {
+		t.Fatalf("exp the pushed frame, got %v", img)
+	}
+	if img, _ := src.Image(renderer.RenderState{}); img != nil {
+		t.Fatal("exp no image when the frame did not change")
+	}
+}
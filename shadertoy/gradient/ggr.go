@@ -0,0 +1,225 @@
+package gradient
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The blending functions of GIMP gradient segments.
+const (
+	ggrLinear = iota
+	ggrCurved
+	ggrSine
+	ggrSphereIncreasing
+	ggrSphereDecreasing
+	ggrStep
+)
+
+// The coloring types of GIMP gradient segments.
+const (
+	ggrRGB = iota
+	ggrHSVCounterClockwise
+	ggrHSVClockwise
+)
+
+// GGR is a GIMP gradient, consisting of segments that each blend between two
+// colors.
+type GGR struct {
+	Name     string
+	Segments []GGRSegment
+}
+
+type GGRSegment struct {
+	Left, Middle, Right   float64
+	LeftColor, RightColor [4]float64
+	Blending, Coloring    int
+}
+
+// ParseGGR parses a GIMP gradient. Colors of segments that take their color
+// from the foreground or background of GIMP are used as is.
+func ParseGGR(buf []byte) (*GGR, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "GIMP Gradient" {
+		return nil, fmt.Errorf("not a GIMP gradient")
+	}
+	g := &GGR{}
+	var numSegments int
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Name:") {
+			g.Name = strings.TrimSpace(strings.TrimPrefix(line, "Name:"))
+			continue
+		}
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of segments: %q", line)
+		}
+		numSegments = n
+		break
+	}
+
+	for scanner.Scan() && len(g.Segments) < numSegments {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			return nil, fmt.Errorf("invalid segment: %q", scanner.Text())
+		}
+		var v [13]float64
+		for i := range v {
+			var err error
+			if v[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+				return nil, fmt.Errorf("invalid segment: %q", scanner.Text())
+			}
+		}
+		seg := GGRSegment{
+			Left:       v[0],
+			Middle:     v[1],
+			Right:      v[2],
+			LeftColor:  [4]float64{v[3], v[4], v[5], v[6]},
+			RightColor: [4]float64{v[7], v[8], v[9], v[10]},
+			Blending:   int(v[11]),
+			Coloring:   int(v[12]),
+		}
+		if seg.Left > seg.Middle || seg.Middle > seg.Right {
+			return nil, fmt.Errorf("invalid segment bounds: %q", scanner.Text())
+		}
+		g.Segments = append(g.Segments, seg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(g.Segments) != numSegments {
+		return nil, fmt.Errorf("expected %d segments, got %d", numSegments, len(g.Segments))
+	}
+	return g, nil
+}
+
+// At computes colors like GIMP does.
+func (g *GGR) At(t float64) [4]float64 {
+	seg := g.Segments[len(g.Segments)-1]
+	for _, s := range g.Segments {
+		if t <= s.Right {
+			seg = s
+			break
+		}
+	}
+
+	var pos, middle float64
+	if width := seg.Right - seg.Left; width > 0 {
+		pos = (t - seg.Left) / width
+		middle = (seg.Middle - seg.Left) / width
+	} else {
+		pos, middle = 0.5, 0.5
+	}
+	pos = math.Max(0, math.Min(1, pos))
+
+	var f float64
+	switch seg.Blending {
+	case ggrCurved:
+		if middle < 1e-10 {
+			f = 1
+		} else {
+			f = math.Pow(pos, math.Log(0.5)/math.Log(middle))
+		}
+	case ggrSine:
+		f = (math.Sin(-math.Pi/2+math.Pi*linearFactor(middle, pos)) + 1) / 2
+	case ggrSphereIncreasing:
+		f = linearFactor(middle, pos) - 1
+		f = math.Sqrt(1 - f*f)
+	case ggrSphereDecreasing:
+		f = linearFactor(middle, pos)
+		f = 1 - math.Sqrt(1-f*f)
+	case ggrStep:
+		if pos >= middle {
+			f = 1
+		}
+	default:
+		f = linearFactor(middle, pos)
+	}
+
+	a, b := seg.LeftColor, seg.RightColor
+	var c [4]float64
+	if seg.Coloring == ggrRGB {
+		for i := range c {
+			c[i] = a[i] + (b[i]-a[i])*f
+		}
+		return c
+	}
+
+	h0, s0, v0 := rgbToHSV(a[0], a[1], a[2])
+	h1, s1, v1 := rgbToHSV(b[0], b[1], b[2])
+	if seg.Coloring == ggrHSVCounterClockwise && h1 < h0 {
+		h1++
+	} else if seg.Coloring == ggrHSVClockwise && h1 > h0 {
+		h1--
+	}
+	h := math.Mod(h0+(h1-h0)*f+1, 1)
+	c[0], c[1], c[2] = hsvToRGB(h, s0+(s1-s0)*f, v0+(v1-v0)*f)
+	c[3] = a[3] + (b[3]-a[3])*f
+	return c
+}
+
+// linearFactor maps pos so the middle of a segment is halfway between its
+// colors.
+func linearFactor(middle, pos float64) float64 {
+	if pos <= middle {
+		if middle < 1e-10 {
+			return 0
+		}
+		return 0.5 * pos / middle
+	}
+	if middle > 1-1e-10 {
+		return 1
+	}
+	return 0.5 + 0.5*(pos-middle)/(1-middle)
+}
+
+// rgbToHSV converts a color to hue, saturation and value, all between 0 and
+// 1.
+func rgbToHSV(r, g, b float64) (h, s, v float64) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	v = max
+	d := max - min
+	if max == 0 || d == 0 {
+		return 0, 0, v
+	}
+	s = d / max
+	switch max {
+	case r:
+		h = (g - b) / d
+	case g:
+		h = 2 + (b-r)/d
+	default:
+		h = 4 + (r-g)/d
+	}
+	h /= 6
+	if h < 0 {
+		h++
+	}
+	return h, s, v
+}
+
+func hsvToRGB(h, s, v float64) (r, g, b float64) {
+	h = math.Mod(h, 1) * 6
+	i := math.Floor(h)
+	f := h - i
+	p, q, t := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+	switch int(i) {
+	case 0:
+		return v, t, p
+	case 1:
+		return q, v, p
+	case 2:
+		return p, v, t
+	case 3:
+		return p, q, v
+	case 4:
+		return t, p, v
+	default:
+		return v, p, q
+	}
+}
@@ -0,0 +1,356 @@
+// Package gradient loads color gradients and makes them available to shaders
+// as textures.
+//
+// Gradients are declared with the "gradient" namespace, e.g.
+// "#pragma map sky=gradient:#003 0%, #36c 60%, #fc8 100%", or loaded from a
+// GIMP gradient (.ggr), a JSON file or a text file with CSS-like stops. An
+// interpolation may follow a semicolon, e.g. "gradient:sky.json;smooth".
+package gradient
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// textureSize is the number of samples of a gradient in its texture.
+const textureSize = 256
+
+func init() {
+	shadertoy.RegisterResourceType("gradient", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		g, err := Load(m.Value, m.PWD)
+		if err != nil {
+			return nil, err
+		}
+		return newGradientTexture(g, m.Name, genTexID()), nil
+	})
+}
+
+// A Gradient maps positions between 0 and 1 to colors.
+type Gradient interface {
+	// At returns the non-premultiplied RGBA color at t, with components
+	// between 0 and 1.
+	At(t float64) [4]float64
+}
+
+// Interpolation determines how colors between two stops are computed.
+type Interpolation string
+
+const (
+	Linear Interpolation = "linear"
+	// Smooth eases in and out of each stop.
+	Smooth Interpolation = "smooth"
+	// Step holds the color of a stop until the next one.
+	Step Interpolation = "step"
+)
+
+func ParseInterpolation(s string) (Interpolation, error) {
+	switch i := Interpolation(s); i {
+	case Linear, Smooth, Step:
+		return i, nil
+	}
+	return "", fmt.Errorf("invalid interpolation: %q (valid: linear, smooth, step)", s)
+}
+
+// A Stop is a color at a position in a gradient.
+type Stop struct {
+	Pos   float64
+	Color [4]float64
+}
+
+// Stops is a gradient interpolating between colors at fixed positions.
+type Stops struct {
+	// Stops is sorted by position.
+	Stops         []Stop
+	Interpolation Interpolation
+}
+
+func (s Stops) At(t float64) [4]float64 {
+	stops := s.Stops
+	if t <= stops[0].Pos {
+		return stops[0].Color
+	}
+	for i := 1; i < len(stops); i++ {
+		a, b := stops[i-1], stops[i]
+		if t >= b.Pos {
+			continue
+		}
+		f := (t - a.Pos) / (b.Pos - a.Pos)
+		switch s.Interpolation {
+		case Step:
+			f = 0
+		case Smooth:
+			f = f * f * (3 - 2*f)
+		}
+		var c [4]float64
+		for j := range c {
+			c[j] = a.Color[j] + (b.Color[j]-a.Color[j])*f
+		}
+		return c
+	}
+	return stops[len(stops)-1].Color
+}
+
+// Load loads a gradient from a list of CSS-like stops, e.g.
+// "#000 0%, #f80 40%, #fff", or from a file. Files may be GIMP gradients
+// (.ggr), JSON (.json) or text files containing a list of stops.
+//
+// The value may end in ";INTERPOLATION", which applies to gradients defined
+// by stops. The segments of GIMP gradients have their own interpolation.
+func Load(value, pwd string) (Gradient, error) {
+	interpolation := Linear
+	if i := strings.LastIndex(value, ";"); i >= 0 {
+		var err error
+		if interpolation, err = ParseInterpolation(strings.TrimSpace(value[i+1:])); err != nil {
+			return nil, err
+		}
+		value = value[:i]
+	}
+	if strings.HasPrefix(strings.TrimSpace(value), "#") {
+		stops, err := ParseStops(value)
+		if err != nil {
+			return nil, err
+		}
+		return Stops{Stops: stops, Interpolation: interpolation}, nil
+	}
+
+	path, err := shadertoy.ResolvePath(pwd, value)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var g Gradient
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ggr":
+		g, err = ParseGGR(buf)
+	case ".json":
+		g, err = parseJSON(buf, interpolation)
+	default:
+		var stops []Stop
+		stops, err = ParseStops(string(buf))
+		g = Stops{Stops: stops, Interpolation: interpolation}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+// ParseStops parses a comma separated list of stops formatted as a
+// hexadecimal color followed by an optional position, either as a percentage
+// or a number between 0 and 1. Like in CSS, missing positions are spread
+// evenly between their neighbours, the first defaulting to 0 and the last to
+// 1.
+func ParseStops(s string) ([]Stop, error) {
+	var stops []Stop
+	var known []bool
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		parts := strings.Fields(field)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("invalid stop: %q", strings.TrimSpace(field))
+		}
+		c, err := parseColor(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		stop := Stop{Color: c}
+		if len(parts) == 2 {
+			if stop.Pos, err = parsePos(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+		stops = append(stops, stop)
+		known = append(known, len(parts) == 2)
+	}
+	if len(stops) < 2 {
+		return nil, fmt.Errorf("a gradient needs at least 2 stops")
+	}
+
+	if !known[0] {
+		stops[0].Pos, known[0] = 0, true
+	}
+	if last := len(stops) - 1; !known[last] {
+		stops[last].Pos, known[last] = 1, true
+	}
+	for i := 1; i < len(stops); i++ {
+		if known[i] {
+			continue
+		}
+		j := i
+		for !known[j] {
+			j++
+		}
+		for k := i; k < j; k++ {
+			stops[k].Pos = stops[i-1].Pos + (stops[j].Pos-stops[i-1].Pos)*float64(k-i+1)/float64(j-i+1)
+		}
+		i = j
+	}
+	return stops, checkOrder(stops)
+}
+
+func checkOrder(stops []Stop) error {
+	for i := 1; i < len(stops); i++ {
+		if stops[i].Pos < stops[i-1].Pos {
+			return fmt.Errorf("the positions of stops must be in ascending order")
+		}
+	}
+	return nil
+}
+
+func parsePos(s string) (float64, error) {
+	scale := 1.0
+	if strings.HasSuffix(s, "%") {
+		s, scale = strings.TrimSuffix(s, "%"), 100
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v/scale < 0 || v/scale > 1 {
+		return 0, fmt.Errorf("invalid position: %q", s)
+	}
+	return v / scale, nil
+}
+
+// parseColor parses a color formatted as #rgb, #rgba, #rrggbb or #rrggbbaa.
+func parseColor(s string) ([4]float64, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		long := make([]byte, 0, 2*len(hex))
+		for i := 0; i < len(hex); i++ {
+			long = append(long, hex[i], hex[i])
+		}
+		hex = string(long)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return [4]float64{}, fmt.Errorf("invalid color: %q", s)
+	}
+	return [4]float64{
+		float64(v>>24&0xff) / 255,
+		float64(v>>16&0xff) / 255,
+		float64(v>>8&0xff) / 255,
+		float64(v&0xff) / 255,
+	}, nil
+}
+
+// parseJSON parses a gradient formatted as either a list of stops or an
+// object with the stops and interpolation:
+//
+//	{"interpolation": "smooth", "stops": [{"pos": 0, "color": "#000"}, ...]}
+func parseJSON(buf []byte, interpolation Interpolation) (Gradient, error) {
+	type jsonStop struct {
+		Pos   *float64 `json:"pos"`
+		Color string   `json:"color"`
+	}
+	var doc struct {
+		Interpolation string     `json:"interpolation"`
+		Stops         []jsonStop `json:"stops"`
+	}
+	if err := json.Unmarshal(buf, &doc.Stops); err != nil {
+		if err := json.Unmarshal(buf, &doc); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Interpolation != "" {
+		var err error
+		if interpolation, err = ParseInterpolation(doc.Interpolation); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reuse the defaults for missing positions of the text format.
+	list := make([]string, len(doc.Stops))
+	for i, s := range doc.Stops {
+		list[i] = s.Color
+		if s.Pos != nil {
+			list[i] += " " + strconv.FormatFloat(*s.Pos, 'g', -1, 64)
+		}
+	}
+	stops, err := ParseStops(strings.Join(list, ","))
+	if err != nil {
+		return nil, err
+	}
+	return Stops{Stops: stops, Interpolation: interpolation}, nil
+}
+
+// gradientTexture provides a gradient to shaders as a texture and a function
+// to look up colors.
+type gradientTexture struct {
+	uniformName string
+	id          uint32
+	index       uint32
+}
+
+func newGradientTexture(g Gradient, uniformName string, texID uint32) *gradientTexture {
+	tex := &gradientTexture{
+		uniformName: uniformName,
+		index:       texID,
+	}
+	// Step gradients are sampled exactly to keep their edges sharp.
+	filter := int32(gl.LINEAR)
+	if s, ok := g.(Stops); ok && s.Interpolation == Step {
+		filter = gl.NEAREST
+	}
+	pix := Sample(g, textureSize)
+	gl.GenTextures(1, &tex.id)
+	gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, textureSize, 1, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pix))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, filter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, filter)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return tex
+}
+
+// Sample evaluates a gradient at n evenly spaced positions, including both
+// ends, and returns the colors as 8-bit RGBA.
+func Sample(g Gradient, n int) []uint8 {
+	pix := make([]uint8, 0, 4*n)
+	for i := 0; i < n; i++ {
+		c := g.At(float64(i) / float64(n-1))
+		for _, v := range c {
+			pix = append(pix, uint8(math.Round(math.Max(0, math.Min(1, v))*255)))
+		}
+	}
+	return pix
+}
+
+func (tex *gradientTexture) UniformSource() string {
+	return fmt.Sprintf(`
+		uniform sampler2D %[1]s;
+		// Returns the color at t in [0, 1].
+		vec4 %[1]sAt(float t) {
+			return texture(%[1]s, vec2((clamp(t, 0.0, 1.0) * %[2]d.0 + 0.5) / %[3]d.0, 0.5));
+		}
+	`, tex.uniformName, textureSize-1, textureSize)
+}
+
+func (tex *gradientTexture) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms[tex.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + tex.index)
+		gl.BindTexture(gl.TEXTURE_2D, tex.id)
+		gl.Uniform1i(loc.Location, int32(tex.index))
+	}
+}
+
+func (tex *gradientTexture) Close() error {
+	gl.DeleteTextures(1, &tex.id)
+	return nil
+}
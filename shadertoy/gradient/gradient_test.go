@@ -0,0 +1,108 @@
+package gradient
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func approxColor(a, b [4]float64) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-6 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseStops(t *testing.T) {
+	stops, err := ParseStops("#000, #ff0000 25%, #00ff00, #0000ff80 0.75, #fff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expPos := []float64{0, 0.25, 0.5, 0.75, 1}
+	for i, s := range stops {
+		if math.Abs(s.Pos-expPos[i]) > 1e-9 {
+			t.Fatalf("stop %d: exp position %v, got %v", i, expPos[i], s.Pos)
+		}
+	}
+	if exp := [4]float64{0, 0, 1, 128.0 / 255}; stops[3].Color != exp {
+		t.Fatalf("unexpected color: exp %v, got %v", exp, stops[3].Color)
+	}
+
+	for _, invalid := range []string{"#000", "#000 50%, #fff 20%", "#00 0%, #fff", "#000 150%, #fff"} {
+		if _, err := ParseStops(invalid); err == nil {
+			t.Fatalf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	stops := []Stop{
+		{Pos: 0, Color: [4]float64{0, 0, 0, 1}},
+		{Pos: 1, Color: [4]float64{1, 1, 1, 1}},
+	}
+	for _, tt := range []struct {
+		interpolation Interpolation
+		t, exp        float64
+	}{
+		{Linear, 0.25, 0.25},
+		{Smooth, 0.25, 0.15625},
+		{Step, 0.75, 0},
+		{Step, 1, 1},
+	} {
+		c := Stops{Stops: stops, Interpolation: tt.interpolation}.At(tt.t)
+		if math.Abs(c[0]-tt.exp) > 1e-9 {
+			t.Fatalf("%s at %v: exp %v, got %v", tt.interpolation, tt.t, tt.exp, c[0])
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"interpolation": "step", "stops": [{"color": "#000"}, {"pos": 0.5, "color": "#fff"}, {"color": "#f00"}]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "b.json"), []byte(`[{"color": "#000"}, {"color": "#fff"}]`), 0644)
+	os.WriteFile(filepath.Join(dir, "c.txt"), []byte("#000 0%\n#fff 100%\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "d.ggr"), []byte(`GIMP Gradient
+Name: Test
+2
+0.000000 0.250000 0.500000 0.000000 0.000000 0.000000 1.000000 1.000000 1.000000 1.000000 1.000000 0 0
+0.500000 0.750000 1.000000 1.000000 0.000000 0.000000 1.000000 0.000000 0.000000 1.000000 1.000000 5 0
+`), 0644)
+
+	for _, tt := range []struct {
+		value string
+		t     float64
+		exp   [4]float64
+	}{
+		{"#000, #fff", 0.5, [4]float64{0.5, 0.5, 0.5, 1}},
+		{"#000, #fff;smooth", 0.25, [4]float64{0.15625, 0.15625, 0.15625, 1}},
+		{"a.json", 0.4, [4]float64{0, 0, 0, 1}},
+		{"a.json;linear", 0.4, [4]float64{0, 0, 0, 1}},
+		{"b.json", 0.5, [4]float64{0.5, 0.5, 0.5, 1}},
+		{"c.txt;step", 0.5, [4]float64{0, 0, 0, 1}},
+		{"d.ggr", 0.25, [4]float64{0.5, 0.5, 0.5, 1}},
+		{"d.ggr", 0.125, [4]float64{0.25, 0.25, 0.25, 1}},
+		{"d.ggr", 0.7, [4]float64{1, 0, 0, 1}},
+		{"d.ggr", 0.8, [4]float64{0, 0, 1, 1}},
+	} {
+		g, err := Load(tt.value, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.value, err)
+		}
+		if c := g.At(tt.t); !approxColor(c, tt.exp) {
+			t.Fatalf("%s at %v: exp %v, got %v", tt.value, tt.t, tt.exp, c)
+		}
+	}
+}
+
+func TestHSV(t *testing.T) {
+	for _, c := range [][3]float64{{1, 0, 0}, {0.2, 0.4, 0.6}, {0.5, 0.5, 0.5}, {1, 1, 0}} {
+		h, s, v := rgbToHSV(c[0], c[1], c[2])
+		r, g, b := hsvToRGB(h, s, v)
+		if !approxColor([4]float64{r, g, b}, [4]float64{c[0], c[1], c[2]}) {
+			t.Fatalf("%v: got %v %v %v", c, r, g, b)
+		}
+	}
+}
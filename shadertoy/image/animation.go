@@ -0,0 +1,370 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+// An Animation is a sequence of frames, each composited onto the full canvas.
+type Animation struct {
+	Frames []*image.RGBA
+	Delays []time.Duration
+	// LoopCount is the number of times the animation is played, or 0 to
+	// repeat it forever.
+	LoopCount int
+}
+
+// minDelay is the shortest delay of a frame. Like browsers do, frames without
+// a delay are shown for 100ms instead.
+const minDelay = 20 * time.Millisecond
+
+// Duration returns the time it takes to play the animation once.
+func (anim *Animation) Duration() time.Duration {
+	var d time.Duration
+	for _, delay := range anim.Delays {
+		d += delay
+	}
+	return d
+}
+
+// FrameAt returns the index of the frame shown at t, holding the last frame
+// once all loops have been played.
+func (anim *Animation) FrameAt(t time.Duration) int {
+	total := anim.Duration()
+	if t < 0 || total <= 0 {
+		return 0
+	}
+	if loop := int(t / total); anim.LoopCount > 0 && loop >= anim.LoopCount {
+		return len(anim.Frames) - 1
+	}
+	t %= total
+	for i, delay := range anim.Delays {
+		if t < delay {
+			return i
+		}
+		t -= delay
+	}
+	return len(anim.Frames) - 1
+}
+
+func frameDelay(d time.Duration) time.Duration {
+	if d == 0 {
+		return 100 * time.Millisecond
+	}
+	if d < minDelay {
+		return minDelay
+	}
+	return d
+}
+
+// DecodeAnimation decodes an animated GIF, PNG (APNG) or WebP image. Nil is
+// returned if the image is not animated or has only one frame.
+func DecodeAnimation(buf []byte) (*Animation, error) {
+	var anim *Animation
+	var err error
+	switch {
+	case bytes.HasPrefix(buf, []byte("GIF8")):
+		anim, err = decodeGIF(buf)
+	case bytes.HasPrefix(buf, pngSignature):
+		anim, err = decodeAPNG(buf)
+	case len(buf) >= 12 && string(buf[:4]) == "RIFF" && string(buf[8:12]) == "WEBP":
+		anim, err = decodeAnimatedWebP(buf)
+	}
+	if err != nil || anim == nil || len(anim.Frames) < 2 {
+		return nil, err
+	}
+	return anim, nil
+}
+
+func decodeGIF(buf []byte) (*Animation, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	anim := &Animation{}
+	switch {
+	case g.LoopCount == 0:
+		anim.LoopCount = 0
+	case g.LoopCount < 0:
+		anim.LoopCount = 1
+	default:
+		// The loop count of GIFs is the number of repetitions.
+		anim.LoopCount = g.LoopCount + 1
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		if g.Disposal[i] == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		anim.Frames = append(anim.Frames, cloneRGBA(canvas))
+		anim.Delays = append(anim.Delays, frameDelay(time.Duration(g.Delay[i])*10*time.Millisecond))
+
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func readPNGChunks(buf []byte) ([]pngChunk, error) {
+	var chunks []pngChunk
+	for b := buf[len(pngSignature):]; len(b) > 0; {
+		if len(b) < 12 {
+			return nil, errors.New("png: truncated chunk")
+		}
+		size := binary.BigEndian.Uint32(b)
+		if uint64(size) > uint64(len(b)-12) {
+			return nil, errors.New("png: truncated chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(b[4:8]), data: b[8 : 8+size]})
+		b = b[12+size:]
+	}
+	return chunks, nil
+}
+
+func appendPNGChunk(b []byte, typ string, data []byte) []byte {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	b = append(b, n[:]...)
+	start := len(b)
+	b = append(b, typ...)
+	b = append(b, data...)
+	binary.BigEndian.PutUint32(n[:], crc32.ChecksumIEEE(b[start:]))
+	return append(b, n[:]...)
+}
+
+// apngFrame is a frame of an APNG as described by its fcTL chunk.
+type apngFrame struct {
+	rect           image.Rectangle
+	delay          time.Duration
+	dispose, blend byte
+	data           [][]byte
+}
+
+func decodeAPNG(buf []byte) (*Animation, error) {
+	chunks, err := readPNGChunks(buf)
+	if err != nil {
+		return nil, err
+	}
+	var ihdr []byte
+	var shared []pngChunk
+	var frames []*apngFrame
+	var anim *Animation
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			if len(c.data) != 13 {
+				return nil, errors.New("png: invalid IHDR")
+			}
+			ihdr = c.data
+		case "acTL":
+			if len(c.data) != 8 {
+				return nil, errors.New("apng: invalid acTL")
+			}
+			anim = &Animation{LoopCount: int(binary.BigEndian.Uint32(c.data[4:]))}
+		case "fcTL":
+			if len(c.data) != 26 {
+				return nil, errors.New("apng: invalid fcTL")
+			}
+			d := c.data
+			w, h := int(binary.BigEndian.Uint32(d[4:])), int(binary.BigEndian.Uint32(d[8:]))
+			x, y := int(binary.BigEndian.Uint32(d[12:])), int(binary.BigEndian.Uint32(d[16:]))
+			num, den := binary.BigEndian.Uint16(d[20:]), binary.BigEndian.Uint16(d[22:])
+			if den == 0 {
+				den = 100
+			}
+			frames = append(frames, &apngFrame{
+				rect:    image.Rect(x, y, x+w, y+h),
+				delay:   frameDelay(time.Duration(num) * time.Second / time.Duration(den)),
+				dispose: d[24],
+				blend:   d[25],
+			})
+		case "IDAT":
+			// The default image is only part of the animation if it is
+			// preceded by a fcTL chunk.
+			if len(frames) == 1 {
+				frames[0].data = append(frames[0].data, c.data)
+			}
+		case "fdAT":
+			if len(frames) == 0 || len(c.data) < 4 {
+				return nil, errors.New("apng: invalid fdAT")
+			}
+			f := frames[len(frames)-1]
+			f.data = append(f.data, c.data[4:])
+		case "IEND":
+		default:
+			// Chunks such as PLTE and tRNS apply to all frames.
+			if len(frames) == 0 {
+				shared = append(shared, c)
+			}
+		}
+	}
+	if anim == nil || ihdr == nil {
+		// Not animated.
+		return nil, nil
+	}
+
+	canvasRect := image.Rect(0, 0, int(binary.BigEndian.Uint32(ihdr)), int(binary.BigEndian.Uint32(ihdr[4:])))
+	canvas := image.NewRGBA(canvasRect)
+	for i, f := range frames {
+		if len(f.data) == 0 {
+			continue
+		}
+		if !f.rect.In(canvasRect) {
+			return nil, fmt.Errorf("apng: frame %d is outside of the canvas", i)
+		}
+		// Decode the frame as a separate PNG of the size of the frame.
+		frameIHDR := append([]byte(nil), ihdr...)
+		binary.BigEndian.PutUint32(frameIHDR, uint32(f.rect.Dx()))
+		binary.BigEndian.PutUint32(frameIHDR[4:], uint32(f.rect.Dy()))
+		b := appendPNGChunk(append([]byte(nil), pngSignature...), "IHDR", frameIHDR)
+		for _, c := range shared {
+			b = appendPNGChunk(b, c.typ, c.data)
+		}
+		for _, data := range f.data {
+			b = appendPNGChunk(b, "IDAT", data)
+		}
+		b = appendPNGChunk(b, "IEND", nil)
+		img, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("apng: frame %d: %w", i, err)
+		}
+
+		var previous *image.RGBA
+		if f.dispose == 2 {
+			previous = cloneRGBA(canvas)
+		}
+		op := draw.Src
+		if f.blend == 1 {
+			op = draw.Over
+		}
+		draw.Draw(canvas, f.rect, img, image.Point{}, op)
+		anim.Frames = append(anim.Frames, cloneRGBA(canvas))
+		anim.Delays = append(anim.Delays, f.delay)
+
+		switch f.dispose {
+		case 1:
+			draw.Draw(canvas, f.rect, image.Transparent, image.Point{}, draw.Src)
+		case 2:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
+
+func decodeAnimatedWebP(buf []byte) (*Animation, error) {
+	const animationBit = 1 << 1
+	var anim *Animation
+	var canvas *image.RGBA
+	for b := buf[12:]; len(b) >= 8; {
+		typ, size := string(b[:4]), binary.LittleEndian.Uint32(b[4:])
+		if uint64(size) > uint64(len(b)-8) {
+			return nil, errors.New("webp: truncated chunk")
+		}
+		data := b[8 : 8+size]
+		// Chunks are padded to an even size.
+		b = b[8+size+size%2:]
+
+		switch typ {
+		case "VP8X":
+			if len(data) != 10 {
+				return nil, errors.New("webp: invalid VP8X")
+			}
+			if data[0]&animationBit == 0 {
+				return nil, nil
+			}
+			w, h := int(uint24(data[4:]))+1, int(uint24(data[7:]))+1
+			canvas = image.NewRGBA(image.Rect(0, 0, w, h))
+		case "ANIM":
+			if len(data) != 6 {
+				return nil, errors.New("webp: invalid ANIM")
+			}
+			// Like browsers, the background color is ignored and the canvas
+			// is cleared to transparent instead.
+			anim = &Animation{LoopCount: int(binary.LittleEndian.Uint16(data[4:]))}
+		case "ANMF":
+			if anim == nil || canvas == nil || len(data) < 16 {
+				return nil, errors.New("webp: invalid ANMF")
+			}
+			x, y := 2*int(uint24(data)), 2*int(uint24(data[3:]))
+			w, h := int(uint24(data[6:]))+1, int(uint24(data[9:]))+1
+			delay := time.Duration(uint24(data[12:])) * time.Millisecond
+			flags := data[15]
+			rect := image.Rect(x, y, x+w, y+h)
+			img, err := decodeWebPFrame(data[16:], w, h)
+			if err != nil {
+				return nil, fmt.Errorf("webp: frame %d: %w", len(anim.Frames), err)
+			}
+			op := draw.Over
+			if flags&0x02 != 0 {
+				op = draw.Src
+			}
+			draw.Draw(canvas, rect, img, image.Point{}, op)
+			anim.Frames = append(anim.Frames, cloneRGBA(canvas))
+			anim.Delays = append(anim.Delays, frameDelay(delay))
+			if flags&0x01 != 0 {
+				draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return anim, nil
+}
+
+// decodeWebPFrame decodes the image data of an ANMF chunk by wrapping it in a
+// WebP file of its own.
+func decodeWebPFrame(chunks []byte, w, h int) (image.Image, error) {
+	var body []byte
+	body = append(body, "WEBP"...)
+	if bytes.HasPrefix(chunks, []byte("ALPH")) {
+		// Lossy images with alpha require an extended header.
+		vp8x := make([]byte, 18)
+		copy(vp8x, "VP8X")
+		binary.LittleEndian.PutUint32(vp8x[4:], 10)
+		vp8x[8] = 1 << 4
+		putUint24(vp8x[12:], uint32(w-1))
+		putUint24(vp8x[15:], uint32(h-1))
+		body = append(body, vp8x...)
+	}
+	body = append(body, chunks...)
+	file := append([]byte("RIFF\x00\x00\x00\x00"), body...)
+	binary.LittleEndian.PutUint32(file[4:], uint32(len(body)))
+	return webp.Decode(bytes.NewReader(file))
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	c := image.NewRGBA(img.Rect)
+	copy(c.Pix, img.Pix)
+	return c
+}
@@ -0,0 +1,147 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestFrameAt(t *testing.T) {
+	anim := &Animation{
+		Frames:    make([]*image.RGBA, 3),
+		Delays:    []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 100 * time.Millisecond},
+		LoopCount: 2,
+	}
+	tests := []struct {
+		t     time.Duration
+		frame int
+	}{
+		{0, 0},
+		{99 * time.Millisecond, 0},
+		{100 * time.Millisecond, 1},
+		{350 * time.Millisecond, 2},
+		{400 * time.Millisecond, 0},
+		{750 * time.Millisecond, 2},
+		{10 * time.Second, 2},
+	}
+	for _, tt := range tests {
+		if frame := anim.FrameAt(tt.t); frame != tt.frame {
+			t.Errorf("%v: exp frame %d, got %d", tt.t, tt.frame, frame)
+		}
+	}
+	anim.LoopCount = 0
+	if frame := anim.FrameAt(10*time.Second + 150*time.Millisecond); frame != 1 {
+		t.Errorf("exp frame 1 when looping forever, got %d", frame)
+	}
+}
+
+func TestDecodeGIF(t *testing.T) {
+	frame := func(rect image.Rectangle, c color.Color) *image.Paletted {
+		img := image.NewPaletted(rect, palette.Plan9)
+		for i := range img.Pix {
+			img.Pix[i] = uint8(img.Palette.Index(c))
+		}
+		return img
+	}
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:     []*image.Paletted{frame(image.Rect(0, 0, 4, 4), red), frame(image.Rect(2, 2, 4, 4), blue)},
+		Delay:     []int{5, 0},
+		LoopCount: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := DecodeAnimation(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Frames) != 2 || anim.LoopCount != 3 {
+		t.Fatalf("unexpected animation: %d frames, %d loops", len(anim.Frames), anim.LoopCount)
+	}
+	if exp := []time.Duration{50 * time.Millisecond, 100 * time.Millisecond}; anim.Delays[0] != exp[0] || anim.Delays[1] != exp[1] {
+		t.Fatalf("unexpected delays: %v", anim.Delays)
+	}
+	if c := anim.Frames[1].RGBAAt(0, 0); c != red {
+		t.Fatalf("exp the first frame to remain visible, got %v", c)
+	}
+	if c := anim.Frames[1].RGBAAt(3, 3); c != blue {
+		t.Fatalf("exp the second frame to be drawn, got %v", c)
+	}
+}
+
+func TestDecodeAPNG(t *testing.T) {
+	encode := func(c color.RGBA) []pngChunk {
+		img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := readPNGChunks(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunks
+	}
+	fcTL := func(seq uint32, delayNum uint16) []byte {
+		b := make([]byte, 26)
+		binary.BigEndian.PutUint32(b, seq)
+		binary.BigEndian.PutUint32(b[4:], 2)
+		binary.BigEndian.PutUint32(b[8:], 2)
+		binary.BigEndian.PutUint16(b[20:], delayNum)
+		binary.BigEndian.PutUint16(b[22:], 1000)
+		return b
+	}
+
+	red, green := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}
+	first, second := encode(red), encode(green)
+	b := appendPNGChunk(append([]byte(nil), pngSignature...), "IHDR", first[0].data)
+	b = appendPNGChunk(b, "acTL", []byte{0, 0, 0, 2, 0, 0, 0, 0})
+	b = appendPNGChunk(b, "fcTL", fcTL(0, 250))
+	for _, c := range first[1:] {
+		if c.typ == "IDAT" {
+			b = appendPNGChunk(b, "IDAT", c.data)
+		}
+	}
+	b = appendPNGChunk(b, "fcTL", fcTL(1, 500))
+	for _, c := range second[1:] {
+		if c.typ == "IDAT" {
+			b = appendPNGChunk(b, "fdAT", append([]byte{0, 0, 0, 2}, c.data...))
+		}
+	}
+	b = appendPNGChunk(b, "IEND", nil)
+
+	anim, err := DecodeAnimation(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Frames) != 2 || anim.LoopCount != 0 {
+		t.Fatalf("unexpected animation: %d frames, %d loops", len(anim.Frames), anim.LoopCount)
+	}
+	if anim.Delays[0] != 250*time.Millisecond || anim.Delays[1] != 500*time.Millisecond {
+		t.Fatalf("unexpected delays: %v", anim.Delays)
+	}
+	if c := anim.Frames[0].RGBAAt(1, 1); c != red {
+		t.Fatalf("unexpected color of the first frame: %v", c)
+	}
+	if c := anim.Frames[1].RGBAAt(1, 1); c != green {
+		t.Fatalf("unexpected color of the second frame: %v", c)
+	}
+
+	// Plain PNGs are not animations.
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if anim, err := DecodeAnimation(buf.Bytes()); anim != nil || err != nil {
+		t.Fatalf("exp no animation, got %v, %v", anim, err)
+	}
+}
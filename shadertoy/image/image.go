@@ -1,6 +1,7 @@
 package image
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/draw"
@@ -37,12 +38,18 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
-		fd, err := os.Open(path)
+		buf, err := os.ReadFile(path)
 		if err != nil {
 			return nil, err
 		}
-		defer fd.Close()
-		img, _, err := image.Decode(fd)
+		anim, err := DecodeAnimation(buf)
+		if err != nil {
+			return nil, err
+		}
+		if anim != nil {
+			return newAnimatedTexture(anim, m.Name, genTexID()), nil
+		}
+		img, _, err := image.Decode(bytes.NewReader(buf))
 		if err != nil {
 			return nil, err
 		}
@@ -123,6 +130,71 @@ func (tex *imageTexture) Close() error {
 	return nil
 }
 
+// animatedTexture is a mapping of an animated image. The frame is picked
+// using the animation time.
+type animatedTexture struct {
+	uniformName string
+	anim        *Animation
+	id          uint32
+	index       uint32
+	frame       int
+}
+
+func newAnimatedTexture(anim *Animation, uniformName string, texID uint32) *animatedTexture {
+	tex := &animatedTexture{
+		uniformName: uniformName,
+		anim:        anim,
+		index:       texID,
+	}
+	gl.GenTextures(1, &tex.id)
+	tex.upload(0)
+	return tex
+}
+
+func (tex *animatedTexture) upload(frame int) {
+	img := tex.anim.Frames[frame]
+	gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(img.Rect.Dx()), int32(img.Rect.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	tex.frame = frame
+}
+
+func (tex *animatedTexture) UniformSource() string {
+	return fmt.Sprintf(`
+		uniform sampler2D %s;
+		uniform vec3 %sSize;
+	`, tex.uniformName, tex.uniformName)
+}
+
+func (tex *animatedTexture) PreRender(state renderer.RenderState) {
+	if frame := tex.anim.FrameAt(state.Time); frame != tex.frame {
+		tex.upload(frame)
+	}
+	rect := tex.anim.Frames[tex.frame].Rect
+	if loc, ok := state.Uniforms[tex.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + tex.index)
+		gl.BindTexture(gl.TEXTURE_2D, tex.id)
+		gl.Uniform1i(loc.Location, int32(tex.index))
+	}
+	if m := shadertoy.IchannelNumRe.FindStringSubmatch(tex.uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
+			gl.Uniform3f(loc.Location, float32(rect.Dx()), float32(rect.Dy()), 1.0)
+		}
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", tex.uniformName)]; ok {
+		gl.Uniform3f(loc.Location, float32(rect.Dx()), float32(rect.Dy()), 1.0)
+	}
+}
+
+func (tex *animatedTexture) Close() error {
+	gl.DeleteTextures(1, &tex.id)
+	return nil
+}
+
 func noise(rect image.Rectangle) image.Image {
 	img := image.NewRGBA(rect)
 	rng := rand.New(rand.NewSource(1337))
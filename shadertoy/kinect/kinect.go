@@ -35,10 +35,13 @@ import (
 )
 
 var (
-	resolution = image.Rect(0, 0, 640, 480)
-	gamma      [2048]uint8
+	depthResolution = image.Rect(0, 0, 640, 480)
+	gamma           [2048]uint8
 )
 
+// noDepth is the raw depth value of pixels for which the distance is unknown.
+const noDepth = 2047
+
 var instances sync.Map
 
 func init() {
@@ -49,7 +52,16 @@ func init() {
 	}
 
 	shadertoy.RegisterResourceType("kinect", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
-		kin, err := open(m.Name, genTexID())
+		var videoFormat C.freenect_video_format
+		switch m.Value {
+		case "on", "rgb":
+			videoFormat = C.FREENECT_VIDEO_RGB
+		case "ir":
+			videoFormat = C.FREENECT_VIDEO_IR_8BIT
+		default:
+			return nil, fmt.Errorf("invalid kinect video stream %q (valid: on, rgb, ir)", m.Value)
+		}
+		kin, err := open(m.Name, videoFormat, genTexID(), genTexID())
 		if err != nil {
 			return nil, err
 		}
@@ -64,23 +76,38 @@ type kinect struct {
 
 	closed, loopClosed chan struct{}
 
+	videoFormat C.freenect_video_format
+	videoMode   C.freenect_frame_mode
+
+	// currentImage holds the video stream, with the depth image in the
+	// alpha channel. currentDepth holds the depth in meters.
 	currentImage     *image.RGBA
+	currentDepth     []float32
 	currentImageLock sync.Mutex
 
-	uniformName  string
-	textureIndex uint32
-	textureID    uint32
+	uniformName       string
+	textureIndex      uint32
+	textureID         uint32
+	depthTextureIndex uint32
+	depthTextureID    uint32
 }
 
-func open(uniformName string, textureIndex uint32) (*kinect, error) {
+func open(uniformName string, videoFormat C.freenect_video_format, textureIndex, depthTextureIndex uint32) (*kinect, error) {
 	kin := &kinect{
-		instanceHandle: &struct{}{},
-		closed:         make(chan struct{}),
-		loopClosed:     make(chan struct{}),
-		currentImage:   image.NewRGBA(resolution),
-		uniformName:    uniformName,
-		textureIndex:   textureIndex,
+		instanceHandle:    &struct{}{},
+		closed:            make(chan struct{}),
+		loopClosed:        make(chan struct{}),
+		videoFormat:       videoFormat,
+		videoMode:         C.freenect_find_video_mode(C.FREENECT_RESOLUTION_MEDIUM, videoFormat),
+		currentDepth:      make([]float32, depthResolution.Dx()*depthResolution.Dy()),
+		uniformName:       uniformName,
+		textureIndex:      textureIndex,
+		depthTextureIndex: depthTextureIndex,
+	}
+	if kin.videoMode.is_valid == 0 {
+		return nil, fmt.Errorf("the kinect video stream is not supported")
 	}
+	kin.currentImage = image.NewRGBA(image.Rect(0, 0, int(kin.videoMode.width), int(kin.videoMode.height)))
 
 	if C.freenect_init(&kin.ctx, C.NULL) < 0 {
 		return nil, fmt.Errorf("freenect_init() failed")
@@ -112,8 +139,8 @@ func open(uniformName string, textureIndex uint32) (*kinect, error) {
 		gl.TEXTURE_2D,                // target
 		0,                            // level
 		gl.RGBA,                      // internalFormat
-		int32(resolution.Dx()),       // width
-		int32(resolution.Dy()),       // height
+		int32(kin.videoRect().Dx()),  // width
+		int32(kin.videoRect().Dy()),  // height
 		0,                            // border
 		gl.RGBA,                      // format
 		gl.UNSIGNED_BYTE,             // type
@@ -124,6 +151,15 @@ func open(uniformName string, textureIndex uint32) (*kinect, error) {
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
 
+	gl.GenTextures(1, &kin.depthTextureID)
+	gl.BindTexture(gl.TEXTURE_2D, kin.depthTextureID)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R32F, int32(depthResolution.Dx()), int32(depthResolution.Dy()), 0, gl.RED, gl.FLOAT, gl.Ptr(kin.currentDepth))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
 	go kin.freenectLoop()
 
 	return kin, nil
@@ -134,15 +170,22 @@ func (kin *kinect) Close() error {
 	<-kin.loopClosed
 	instances.Delete(kin.instanceHandle)
 	gl.DeleteTextures(1, &kin.textureID)
+	gl.DeleteTextures(1, &kin.depthTextureID)
 	return nil
 }
 
+func (kin *kinect) videoRect() image.Rectangle {
+	return kin.currentImage.Rect
+}
+
 func (kin *kinect) UniformSource() string {
 	return fmt.Sprintf(`
 		uniform sampler2D %s;
 		uniform vec3 %sSize;
 		uniform float %sCurTime;
-	`, kin.uniformName, kin.uniformName, kin.uniformName)
+		uniform sampler2D %sDepth;
+		uniform vec3 %sDepthSize;
+	`, kin.uniformName, kin.uniformName, kin.uniformName, kin.uniformName, kin.uniformName)
 }
 
 func (kin *kinect) PreRender(state renderer.RenderState) {
@@ -157,8 +200,8 @@ func (kin *kinect) PreRender(state renderer.RenderState) {
 			0,                            // level,
 			0,                            // xoffset,
 			0,                            // yoffset,
-			int32(resolution.Dx()),       // width,
-			int32(resolution.Dy()),       // height,
+			int32(kin.videoRect().Dx()),  // width,
+			int32(kin.videoRect().Dy()),  // height,
 			gl.RGBA,                      // format,
 			gl.UNSIGNED_BYTE,             // type,
 			gl.Ptr(kin.currentImage.Pix), // data
@@ -167,11 +210,20 @@ func (kin *kinect) PreRender(state renderer.RenderState) {
 	}
 	if m := shadertoy.IchannelNumRe.FindStringSubmatch(kin.uniformName); m != nil {
 		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
-			gl.Uniform3f(loc.Location, float32(resolution.Dx()), float32(resolution.Dy()), 1.0)
+			gl.Uniform3f(loc.Location, float32(kin.videoRect().Dx()), float32(kin.videoRect().Dy()), 1.0)
 		}
 	}
 	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", kin.uniformName)]; ok {
-		gl.Uniform3f(loc.Location, float32(resolution.Dx()), float32(resolution.Dy()), 1.0)
+		gl.Uniform3f(loc.Location, float32(kin.videoRect().Dx()), float32(kin.videoRect().Dy()), 1.0)
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sDepth", kin.uniformName)]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + kin.depthTextureIndex)
+		gl.BindTexture(gl.TEXTURE_2D, kin.depthTextureID)
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(depthResolution.Dx()), int32(depthResolution.Dy()), gl.RED, gl.FLOAT, gl.Ptr(kin.currentDepth))
+		gl.Uniform1i(loc.Location, int32(kin.depthTextureIndex))
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sDepthSize", kin.uniformName)]; ok {
+		gl.Uniform3f(loc.Location, float32(depthResolution.Dx()), float32(depthResolution.Dy()), 1.0)
 	}
 }
 
@@ -183,7 +235,7 @@ func (kin *kinect) freenectLoop() {
 	C.freenect_set_tilt_degs(kin.dev, C.double(tiltAngle))
 	C.freenect_set_led(kin.dev, C.LED_GREEN)
 	C.init_callbacks_cgo(kin.dev)
-	C.freenect_set_video_mode(kin.dev, C.freenect_find_video_mode(C.FREENECT_RESOLUTION_MEDIUM, C.FREENECT_VIDEO_RGB))
+	C.freenect_set_video_mode(kin.dev, kin.videoMode)
 	C.freenect_set_depth_mode(kin.dev, C.freenect_find_depth_mode(C.FREENECT_RESOLUTION_MEDIUM, C.FREENECT_DEPTH_11BIT))
 	C.freenect_start_depth(kin.dev)
 	C.freenect_start_video(kin.dev)
@@ -212,9 +264,18 @@ func (kin *kinect) rgbCallback(rgbPtr *uint8) {
 	kin.currentImageLock.Lock()
 	defer kin.currentImageLock.Unlock()
 
-	length := resolution.Dx() * resolution.Dy()
+	length := kin.videoRect().Dx() * kin.videoRect().Dy()
+	if kin.videoFormat == C.FREENECT_VIDEO_IR_8BIT {
+		// Infrared images have a single channel, which is shown as gray.
+		ir := unsafe.Slice(rgbPtr, length)
+		for i, v := range ir {
+			kin.currentImage.Pix[i*4] = v
+			kin.currentImage.Pix[i*4+1] = v
+			kin.currentImage.Pix[i*4+2] = v
+		}
+		return
+	}
 	rgb := unsafe.Slice(rgbPtr, length*3)
-
 	for i := 0; i < length; i++ {
 		kin.currentImage.Pix[i*4] = rgb[i*3]
 		kin.currentImage.Pix[i*4+1] = rgb[i*3+1]
@@ -226,10 +287,27 @@ func (kin *kinect) depthCallback(depthPtr *uint8) {
 	kin.currentImageLock.Lock()
 	defer kin.currentImageLock.Unlock()
 
-	length := resolution.Dx() * resolution.Dy()
-	depth := unsafe.Slice((*uint8)(depthPtr), length)
+	// Depth values are 11 bits wide, stored as 16 bit integers.
+	length := depthResolution.Dx() * depthResolution.Dy()
+	depth := unsafe.Slice((*uint16)(unsafe.Pointer(depthPtr)), length)
 
 	for i, value := range depth {
-		kin.currentImage.Pix[i*4+3] = gamma[value]
+		if value > noDepth {
+			value = noDepth
+		}
+		if i*4+3 < len(kin.currentImage.Pix) {
+			kin.currentImage.Pix[i*4+3] = gamma[value]
+		}
+		kin.currentDepth[i] = rawDepthToMeters(value)
+	}
+}
+
+// rawDepthToMeters converts a raw depth value to the distance in meters, or
+// 0 if the distance is unknown. The approximation is the one by Stéphane
+// Magnenat that is common in the OpenKinect community.
+func rawDepthToMeters(raw uint16) float32 {
+	if raw >= noDepth {
+		return 0
 	}
+	return float32(0.1236 * math.Tan(float64(raw)/2842.5+1.1863))
 }
@@ -0,0 +1,311 @@
+// Package lut loads 3D lookup tables (LUTs) in the .cube and .3dl formats for
+// color grading.
+//
+// LUTs are available to shaders with the "lut" namespace, e.g.
+// "#pragma map look=lut:film.cube", which declares a sampler3D with the name
+// of the mapping and a function to grade a color with it:
+//
+//	vec3 lookApply(vec3 color);
+//
+// PostPass grades the whole output of a shader with a LUT instead.
+package lut
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// maxSize limits the number of entries along each axis of a table.
+const maxSize = 256
+
+func init() {
+	shadertoy.RegisterResourceType("lut", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		path, err := shadertoy.ResolvePath(m.PWD, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		table, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		return &lutTexture{
+			table:       table,
+			uniformName: m.Name,
+			id:          table.texture(),
+			index:       genTexID(),
+		}, nil
+	})
+}
+
+// A Table is a 3D lookup table mapping input colors to output colors.
+type Table struct {
+	// Size is the number of entries along each axis.
+	Size int
+	// Data holds Size^3 RGB output colors, with red changing fastest and blue
+	// slowest.
+	Data []float32
+	// DomainMin and DomainMax are the input colors mapped to the first and
+	// last entries.
+	DomainMin, DomainMax [3]float32
+}
+
+// Load loads a LUT from a .cube or .3dl file.
+func Load(path string) (*Table, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table *Table
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".cube":
+		table, err = ParseCube(buf)
+	case ".3dl":
+		table, err = Parse3DL(buf)
+	default:
+		return nil, fmt.Errorf("%s: unsupported LUT format %q (valid: .cube, .3dl)", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
+
+// ParseCube parses a LUT in the Resolve/Adobe .cube format.
+func ParseCube(buf []byte) (*Table, error) {
+	table := &Table{DomainMax: [3]float32{1, 1, 1}}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "TITLE":
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("line %d: 1D LUTs are not supported", lineNum)
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: invalid size", lineNum)
+			}
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < 2 || size > maxSize {
+				return nil, fmt.Errorf("line %d: invalid size %q", lineNum, fields[1])
+			}
+			table.Size = size
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			dst := &table.DomainMin
+			if fields[0] == "DOMAIN_MAX" {
+				dst = &table.DomainMax
+			}
+			rgb, err := parseTriple(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			*dst = rgb
+		default:
+			if table.Size == 0 {
+				return nil, fmt.Errorf("line %d: LUT_3D_SIZE must precede the data", lineNum)
+			}
+			rgb, err := parseTriple(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			table.Data = append(table.Data, rgb[:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if table.Size == 0 {
+		return nil, fmt.Errorf("missing LUT_3D_SIZE")
+	}
+	if n := table.Size * table.Size * table.Size; len(table.Data) != 3*n {
+		return nil, fmt.Errorf("expected %d entries, got %d", n, len(table.Data)/3)
+	}
+	for i := range table.DomainMin {
+		if table.DomainMin[i] >= table.DomainMax[i] {
+			return nil, fmt.Errorf("invalid domain")
+		}
+	}
+	return table, nil
+}
+
+// Parse3DL parses a LUT in the Autodesk/Lustre .3dl format. The values are
+// integers, of which the bit depth is derived from the largest value.
+func Parse3DL(buf []byte) (*Table, error) {
+	var entries [][3]float32
+	var max float32
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "<") {
+			continue
+		}
+		if len(fields) != 3 {
+			// The input shaper line, e.g. "0 64 128 ... 1023". The inputs
+			// are assumed to be evenly spaced.
+			if entries == nil {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: expected 3 values", lineNum)
+		}
+		rgb, err := parseTriple(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		for _, v := range rgb {
+			if v > max {
+				max = v
+			}
+		}
+		entries = append(entries, rgb)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	size := int(math.Round(math.Cbrt(float64(len(entries)))))
+	if size < 2 || size > maxSize || size*size*size != len(entries) {
+		return nil, fmt.Errorf("the number of entries (%d) is not a cube", len(entries))
+	}
+	scale := float32(1)
+	for _, bits := range []uint{8, 10, 12, 14, 16} {
+		if scale = float32(uint(1)<<bits - 1); max <= scale {
+			break
+		}
+	}
+
+	// Blue changes fastest in .3dl files.
+	table := &Table{
+		Size:      size,
+		Data:      make([]float32, 0, 3*len(entries)),
+		DomainMax: [3]float32{1, 1, 1},
+	}
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				e := entries[(r*size+g)*size+b]
+				table.Data = append(table.Data, e[0]/scale, e[1]/scale, e[2]/scale)
+			}
+		}
+	}
+	return table, nil
+}
+
+func parseTriple(fields []string) ([3]float32, error) {
+	var rgb [3]float32
+	if len(fields) != 3 {
+		return rgb, fmt.Errorf("expected 3 values")
+	}
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 32)
+		if err != nil {
+			return rgb, fmt.Errorf("invalid value: %q", f)
+		}
+		rgb[i] = float32(v)
+	}
+	return rgb, nil
+}
+
+// texture uploads the table to a 3D texture with linear interpolation.
+func (table *Table) texture() uint32 {
+	var id uint32
+	size := int32(table.Size)
+	gl.GenTextures(1, &id)
+	gl.BindTexture(gl.TEXTURE_3D, id)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage3D(gl.TEXTURE_3D, 0, gl.RGB16F, size, size, size, 0, gl.RGB, gl.FLOAT, gl.Ptr(table.Data))
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.BindTexture(gl.TEXTURE_3D, 0)
+	return id
+}
+
+// uniformSource declares the sampler and the function to apply the table.
+// The texture coordinates are scaled so the first and last entries are
+// sampled at the center of their texels.
+func (table *Table) uniformSource(name string) string {
+	vec3 := func(v [3]float32) string {
+		return fmt.Sprintf("vec3(%g, %g, %g)", v[0], v[1], v[2])
+	}
+	n := float64(table.Size)
+	return fmt.Sprintf(`
+		uniform sampler3D %[1]s;
+		vec3 %[1]sApply(vec3 color) {
+			vec3 c = clamp((color - %[2]s) / (%[3]s - %[2]s), 0.0, 1.0);
+			return texture(%[1]s, c * %[4]g + %[5]g).rgb;
+		}
+	`, name, vec3(table.DomainMin), vec3(table.DomainMax), (n-1)/n, 0.5/n)
+}
+
+// lutTexture provides a table to shaders as a 3D texture.
+type lutTexture struct {
+	table       *Table
+	uniformName string
+	id          uint32
+	index       uint32
+}
+
+func (tex *lutTexture) UniformSource() string {
+	return tex.table.uniformSource(tex.uniformName)
+}
+
+func (tex *lutTexture) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms[tex.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + tex.index)
+		gl.BindTexture(gl.TEXTURE_3D, tex.id)
+		gl.Uniform1i(loc.Location, int32(tex.index))
+	}
+}
+
+func (tex *lutTexture) Close() error {
+	gl.DeleteTextures(1, &tex.id)
+	return nil
+}
+
+// PostPass creates a pass that grades every frame with the table. Strength
+// mixes between the original (0) and the graded (1) colors.
+//
+// It must be called from the rendering thread.
+func PostPass(table *Table, strength float32) renderer.PostPass {
+	id := table.texture()
+	fragment := renderer.SourceBuf(`#version 330 core
+		in vec2 texCoord;
+		out vec4 fragColor;
+		uniform sampler2D frame;
+		uniform float strength;
+	` + table.uniformSource("lut") + `
+		void main() {
+			vec4 c = texture(frame, texCoord);
+			fragColor = vec4(mix(c.rgb, lutApply(c.rgb), strength), c.a);
+		}
+	`)
+	return renderer.PostPass{
+		Fragment: fragment,
+		PreRender: func(program uint32) {
+			gl.ActiveTexture(gl.TEXTURE1)
+			gl.BindTexture(gl.TEXTURE_3D, id)
+			gl.Uniform1i(gl.GetUniformLocation(program, gl.Str("lut\x00")), 1)
+			gl.Uniform1f(gl.GetUniformLocation(program, gl.Str("strength\x00")), strength)
+		},
+		Close: func() error {
+			gl.DeleteTextures(1, &id)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package lut
+
+import (
+	"reflect"
+	"testing"
+)
+
+// identity2 is a 2x2x2 identity LUT, with red changing fastest.
+var identity2 = []float32{
+	0, 0, 0, 1, 0, 0, 0, 1, 0, 1, 1, 0,
+	0, 0, 1, 1, 0, 1, 0, 1, 1, 1, 1, 1,
+}
+
+func TestParseCube(t *testing.T) {
+	src := `# comment
+TITLE "identity"
+LUT_3D_SIZE 2
+DOMAIN_MIN 0 0 0
+DOMAIN_MAX 1 1 2
+
+0 0 0
+1 0 0
+0 1 0
+1 1 0
+0 0 1
+1 0 1
+0 1 1
+1 1 1
+`
+	table, err := ParseCube([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Size != 2 {
+		t.Fatalf("unexpected size: %d", table.Size)
+	}
+	if !reflect.DeepEqual(table.Data, identity2) {
+		t.Fatalf("unexpected data: %v", table.Data)
+	}
+	if table.DomainMax != [3]float32{1, 1, 2} {
+		t.Fatalf("unexpected domain: %v", table.DomainMax)
+	}
+
+	if _, err := ParseCube([]byte("LUT_3D_SIZE 2\n0 0 0\n")); err == nil {
+		t.Fatal("expected an error for missing entries")
+	}
+	if _, err := ParseCube([]byte("LUT_1D_SIZE 2\n0 0 0\n1 1 1\n")); err == nil {
+		t.Fatal("expected an error for a 1D LUT")
+	}
+}
+
+func TestParse3DL(t *testing.T) {
+	src := `# 10-bit output
+0 1023
+0 0 0
+0 0 1023
+0 1023 0
+0 1023 1023
+1023 0 0
+1023 0 1023
+1023 1023 0
+1023 1023 1023
+`
+	table, err := Parse3DL([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Size != 2 {
+		t.Fatalf("unexpected size: %d", table.Size)
+	}
+	if !reflect.DeepEqual(table.Data, identity2) {
+		t.Fatalf("unexpected data: %v", table.Data)
+	}
+
+	if _, err := Parse3DL([]byte("0 0 0\n1 1 1\n")); err == nil {
+		t.Fatal("expected an error for a non-cubic number of entries")
+	}
+}
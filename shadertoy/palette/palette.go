@@ -0,0 +1,218 @@
+package palette
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// maxColors limits the size of palettes, which are compiled into the shader.
+// Larger images are sampled evenly.
+const maxColors = 256
+
+var (
+	hexListRe  = regexp.MustCompile(`^\s*#?[0-9a-fA-F]{3}(?:[0-9a-fA-F]{3})?(?:[\s,]+#?[0-9a-fA-F]{3}(?:[0-9a-fA-F]{3})?)*\s*$`)
+	gplColorRe = regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s+(\d+)`)
+)
+
+func init() {
+	shadertoy.RegisterResourceType("palette", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		colors, err := Load(m.Value, m.PWD)
+		if err != nil {
+			return nil, err
+		}
+		return newPaletteTexture(colors, m.Name, genTexID()), nil
+	})
+}
+
+// Load loads a palette from a list of hexadecimal colors, e.g.
+// "#000000,#ff8800,#fff", or from a file. Files may be images, of which the
+// middle row is used, GIMP palettes (.gpl) or text files with a hexadecimal
+// color per line.
+func Load(value, pwd string) ([]color.RGBA, error) {
+	if hexListRe.MatchString(value) {
+		return parseHexList(value)
+	}
+	path, err := shadertoy.ResolvePath(pwd, value)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var colors []color.RGBA
+	if img, _, err := image.Decode(bytes.NewReader(buf)); err == nil {
+		colors = imageColors(img)
+	} else if strings.EqualFold(filepath.Ext(path), ".gpl") {
+		colors, err = parseGPL(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		// Lines may be commented out, e.g. with "//" or ";".
+		var list []string
+		for _, line := range strings.Split(string(buf), "\n") {
+			if line = strings.TrimSpace(line); line != "" && hexListRe.MatchString(line) {
+				list = append(list, line)
+			}
+		}
+		colors, err = parseHexList(strings.Join(list, ","))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if len(colors) == 0 {
+		return nil, fmt.Errorf("%s: the palette has no colors", path)
+	}
+	return colors, nil
+}
+
+func parseHexList(s string) ([]color.RGBA, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	colors := make([]color.RGBA, 0, len(fields))
+	for _, f := range fields {
+		f = strings.TrimPrefix(f, "#")
+		if len(f) == 3 {
+			f = string([]byte{f[0], f[0], f[1], f[1], f[2], f[2]})
+		}
+		v, err := strconv.ParseUint(f, 16, 32)
+		if err != nil || len(f) != 6 {
+			return nil, fmt.Errorf("invalid color: %q", f)
+		}
+		colors = append(colors, color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff})
+	}
+	if len(colors) > maxColors {
+		return nil, fmt.Errorf("palettes can have at most %d colors, got %d", maxColors, len(colors))
+	}
+	return colors, nil
+}
+
+func parseGPL(buf []byte) ([]color.RGBA, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "GIMP Palette" {
+		return nil, fmt.Errorf("not a GIMP palette")
+	}
+	var colors []color.RGBA
+	for scanner.Scan() {
+		m := gplColorRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			// Headers such as "Name:" and comments.
+			continue
+		}
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.ParseUint(m[i+1], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid color: %q", scanner.Text())
+			}
+			rgb[i] = uint8(v)
+		}
+		colors = append(colors, color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff})
+	}
+	if len(colors) > maxColors {
+		return nil, fmt.Errorf("palettes can have at most %d colors, got %d", maxColors, len(colors))
+	}
+	return colors, scanner.Err()
+}
+
+// imageColors samples the middle row of an image, which covers both palette
+// strips and gradients.
+func imageColors(img image.Image) []color.RGBA {
+	b := img.Bounds()
+	n := b.Dx()
+	if n > maxColors {
+		n = maxColors
+	}
+	y := b.Min.Y + b.Dy()/2
+	colors := make([]color.RGBA, n)
+	for i := range colors {
+		x := b.Min.X + (2*i+1)*b.Dx()/(2*n)
+		colors[i] = color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+	return colors
+}
+
+// paletteTexture provides a palette to shaders as a constant array, a texture
+// and functions to look up colors.
+type paletteTexture struct {
+	uniformName string
+	colors      []color.RGBA
+	id          uint32
+	index       uint32
+}
+
+func newPaletteTexture(colors []color.RGBA, uniformName string, texID uint32) *paletteTexture {
+	tex := &paletteTexture{
+		uniformName: uniformName,
+		colors:      colors,
+		index:       texID,
+	}
+	pix := make([]uint8, 0, 4*len(colors))
+	for _, c := range colors {
+		pix = append(pix, c.R, c.G, c.B, c.A)
+	}
+	gl.GenTextures(1, &tex.id)
+	gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(len(colors)), 1, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pix))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return tex
+}
+
+func (tex *paletteTexture) UniformSource() string {
+	return uniformSource(tex.uniformName, tex.colors)
+}
+
+func uniformSource(name string, colors []color.RGBA) string {
+	elems := make([]string, len(colors))
+	for i, c := range colors {
+		elems[i] = fmt.Sprintf("vec3(%.4f, %.4f, %.4f)", float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+	}
+	return fmt.Sprintf(`
+		const int %[1]sCount = %[2]d;
+		const vec3 %[1]s[%[2]d] = vec3[](%[3]s);
+		uniform sampler2D %[1]sTex;
+		// Returns the color at t in [0, 1], interpolating between the colors.
+		vec3 %[1]sAt(float t) {
+			float x = clamp(t, 0.0, 1.0) * float(%[1]sCount - 1);
+			int i = int(floor(x));
+			return mix(%[1]s[i], %[1]s[min(i + 1, %[1]sCount - 1)], x - float(i));
+		}
+		// Returns color i, wrapping around at the end of the palette.
+		vec3 %[1]sIndex(int i) {
+			return %[1]s[(i %% %[1]sCount + %[1]sCount) %% %[1]sCount];
+		}
+	`, name, len(colors), strings.Join(elems, ", "))
+}
+
+func (tex *paletteTexture) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms[tex.uniformName+"Tex"]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + tex.index)
+		gl.BindTexture(gl.TEXTURE_2D, tex.id)
+		gl.Uniform1i(loc.Location, int32(tex.index))
+	}
+}
+
+func (tex *paletteTexture) Close() error {
+	gl.DeleteTextures(1, &tex.id)
+	return nil
+}
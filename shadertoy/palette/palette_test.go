@@ -0,0 +1,46 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	red := color.RGBA{R: 0xff, A: 0xff}
+	green := color.RGBA{G: 0x88, A: 0xff}
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	img.Set(0, 0, red)
+	img.Set(1, 0, green)
+	img.Set(2, 0, white)
+	fd, err := os.Create(filepath.Join(dir, "strip.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(fd, img)
+	fd.Close()
+	os.WriteFile(filepath.Join(dir, "colors.hex"), []byte("// comment\nff0000\n008800\n#fff\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "colors.gpl"), []byte("GIMP Palette\nName: test\n#\n255   0   0\tRed\n  0 136   0\tGreen\n255 255 255\tWhite\n"), 0644)
+
+	exp := []color.RGBA{red, green, white}
+	for _, value := range []string{"#ff0000, #008800, #fff", "ff0000 008800 ffffff", "strip.png", "colors.hex", "colors.gpl"} {
+		colors, err := Load(value, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+		if !reflect.DeepEqual(colors, exp) {
+			t.Fatalf("%s: unexpected colors: exp %v, got %v", value, exp, colors)
+		}
+	}
+
+	if _, err := Load("#ff00", dir); err == nil {
+		t.Fatalf("expected an error for an invalid color")
+	}
+}
@@ -0,0 +1,108 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	pdfinfoPagesRe = regexp.MustCompile(`(?m)^Pages:\s+(\d+)`)
+	pdfinfoSizeRe  = regexp.MustCompile(`(?m)^Page\s+(\d+) size:\s+([\d.]+) x ([\d.]+)`)
+)
+
+// A document is a PDF file of which the pages are rendered to fit a size.
+type document struct {
+	path          string
+	width, height uint
+	// pageSizes holds the size of each page in points.
+	pageSizes [][2]float64
+}
+
+func openDocument(path string, width, height uint) (*document, error) {
+	// Request the sizes of all pages, pdfinfo limits the last page to the
+	// number of pages.
+	out, err := runPoppler("pdfinfo", "-f", "1", "-l", strconv.Itoa(math.MaxInt32), path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parsePDFInfo(string(out))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	doc.path, doc.width, doc.height = path, width, height
+	return doc, nil
+}
+
+func parsePDFInfo(info string) (*document, error) {
+	m := pdfinfoPagesRe.FindStringSubmatch(info)
+	if m == nil {
+		return nil, fmt.Errorf("could not determine the number of pages")
+	}
+	n, _ := strconv.Atoi(m[1])
+	if n == 0 {
+		return nil, fmt.Errorf("the document has no pages")
+	}
+	doc := &document{pageSizes: make([][2]float64, n)}
+	for _, m := range pdfinfoSizeRe.FindAllStringSubmatch(info, -1) {
+		page, _ := strconv.Atoi(m[1])
+		if page < 1 || page > n {
+			continue
+		}
+		w, _ := strconv.ParseFloat(m[2], 64)
+		h, _ := strconv.ParseFloat(m[3], 64)
+		doc.pageSizes[page-1] = [2]float64{w, h}
+	}
+	return doc, nil
+}
+
+func (doc *document) numPages() int {
+	return len(doc.pageSizes)
+}
+
+// render renders a page, starting at 0, at the largest size that fits the
+// document's size while keeping the page's aspect ratio.
+func (doc *document) render(page int) (*image.RGBA, error) {
+	args := []string{"-f", strconv.Itoa(page + 1), "-l", strconv.Itoa(page + 1), "-singlefile", "-png"}
+	size := doc.pageSizes[page]
+	if size[0] > 0 && size[1] > 0 && size[0]/size[1] > float64(doc.width)/float64(doc.height) {
+		args = append(args, "-scale-to-x", strconv.Itoa(int(doc.width)), "-scale-to-y", "-1")
+	} else {
+		args = append(args, "-scale-to-x", "-1", "-scale-to-y", strconv.Itoa(int(doc.height)))
+	}
+	out, err := runPoppler("pdftoppm", append(args, doc.path)...)
+	if err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %w", page+1, err)
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+		draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	}
+	return rgba, nil
+}
+
+func runPoppler(name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %v: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v (is Poppler installed?)", name, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,127 @@
+package pdf
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/polyfloyd/shady/internal/term"
+)
+
+type key int
+
+const (
+	keyNext key = iota + 1
+	keyPrev
+	keyFirst
+)
+
+var (
+	keysLock    sync.Mutex
+	keyHandlers = map[*func(key)]struct{}{}
+	readingKeys bool
+	// restoreTerminal restores the mode of the terminal while no handlers
+	// are registered.
+	restoreTerminal func()
+)
+
+// handleKeys calls fn for every navigation key read from the standard input.
+// If the standard input is a terminal, it is switched to unbuffered mode as
+// long as there are handlers, failing which is reported to logger. The
+// returned function removes the handler.
+func handleKeys(fn func(key), logger *log.Logger) (remove func()) {
+	keysLock.Lock()
+	defer keysLock.Unlock()
+	if len(keyHandlers) == 0 {
+		restore, err := term.Unbuffer(os.Stdin)
+		if err != nil {
+			logger.Printf("Could not set up the terminal for reading keys: %v", err)
+			restore = func() {}
+		}
+		restoreTerminal = restore
+	}
+	keyHandlers[&fn] = struct{}{}
+	if !readingKeys {
+		// Reading from stdin can not be interrupted, so the same goroutine
+		// is used for all handlers.
+		readingKeys = true
+		go readKeys()
+	}
+	return func() {
+		keysLock.Lock()
+		defer keysLock.Unlock()
+		delete(keyHandlers, &fn)
+		if len(keyHandlers) == 0 {
+			restoreTerminal()
+		}
+	}
+}
+
+func readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			keysLock.Lock()
+			readingKeys = false
+			keysLock.Unlock()
+			return
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			keysLock.Lock()
+			handlers := make([]func(key), 0, len(keyHandlers))
+			for fn := range keyHandlers {
+				handlers = append(handlers, *fn)
+			}
+			keysLock.Unlock()
+			for _, fn := range handlers {
+				fn(k)
+			}
+		}
+	}
+}
+
+// parseKeys maps the bytes read from a terminal to navigation keys. Escape
+// sequences are expected to be read at once.
+func parseKeys(b []byte) []key {
+	sequences := []struct {
+		seq string
+		key key
+	}{
+		{"\x1b[C", keyNext},  // Right arrow.
+		{"\x1b[6~", keyNext}, // Page down.
+		{"\x1b[D", keyPrev},  // Left arrow.
+		{"\x1b[5~", keyPrev}, // Page up.
+		{"\x1b[H", keyFirst}, // Home.
+		{"\x1b[1~", keyFirst},
+		{" ", keyNext},
+		{"\r", keyNext},
+		{"\n", keyNext},
+		{"n", keyNext},
+		{"\x7f", keyPrev}, // Backspace.
+		{"\b", keyPrev},
+		{"p", keyPrev},
+		{"g", keyFirst},
+	}
+	var keys []key
+outer:
+	for len(b) > 0 {
+		for _, s := range sequences {
+			if bytes.HasPrefix(b, []byte(s.seq)) {
+				keys = append(keys, s.key)
+				b = b[len(s.seq):]
+				continue outer
+			}
+		}
+		if b[0] == 0x1b {
+			// Skip unknown escape sequences.
+			if i := bytes.IndexAny(b[1:], "\x1b~ABCDEFGHPQRS"); i >= 0 && b[1+i] != 0x1b {
+				b = b[2+i:]
+				continue
+			}
+		}
+		b = b[1:]
+	}
+	return keys
+}
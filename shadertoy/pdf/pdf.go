@@ -0,0 +1,323 @@
+// Package pdf renders the pages of PDF documents into textures, so shaders can
+// be used for slide transitions and projection mapped presentations.
+//
+// Pages are rendered with pdftoppm and pdfinfo of Poppler, which should be
+// installed. Mappings are formatted as "FILE;TRIGGER;TRIGGER...", where the
+// triggers determine when the next page is shown:
+//
+//   - every=DURATION advances the page at a fixed interval of the animation
+//     time, e.g. every=10s, starting over after the last page.
+//   - keys reads keys from the terminal: space, enter, the right arrow, page
+//     down and "n" show the next page, backspace, the left arrow, page up and
+//     "p" the previous one. Home and "g" go back to the first page.
+//   - osc=ADDRESS receives OSC messages on a UDP address, e.g. osc=:9000.
+//     The paths are /NAME/next, /NAME/prev and /NAME/page with the page
+//     number, starting at 1, as argument.
+package pdf
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/osc"
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterResourceType("pdf", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
+		opts, err := parseValue(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		path, err := shadertoy.ResolvePath(m.PWD, opts.file)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := openDocument(path, state.CanvasWidth, state.CanvasHeight)
+		if err != nil {
+			return nil, err
+		}
+		return newPDFTexture(m.Name, doc, opts, genTexID(), genTexID(), state.Logger)
+	})
+}
+
+type options struct {
+	file  string
+	every time.Duration
+	keys  bool
+	osc   string
+}
+
+func parseValue(value string) (options, error) {
+	fields := strings.Split(value, ";")
+	opts := options{file: fields[0]}
+	if opts.file == "" {
+		return opts, fmt.Errorf("missing pdf file in %q", value)
+	}
+	for _, f := range fields[1:] {
+		switch {
+		case f == "keys":
+			opts.keys = true
+		case strings.HasPrefix(f, "every="):
+			d, err := time.ParseDuration(strings.TrimPrefix(f, "every="))
+			if err != nil || d <= 0 {
+				return opts, fmt.Errorf("invalid pdf page interval: %q", f)
+			}
+			opts.every = d
+		case strings.HasPrefix(f, "osc="):
+			opts.osc = strings.TrimPrefix(f, "osc=")
+		default:
+			return opts, fmt.Errorf("invalid pdf trigger: %q (valid: every=DURATION, keys, osc=ADDRESS)", f)
+		}
+	}
+	if opts.every > 0 && (opts.keys || opts.osc != "") {
+		return opts, fmt.Errorf("the every trigger can not be combined with keys or osc")
+	}
+	return opts, nil
+}
+
+// pdfTexture shows a page of a document along with the previously shown page,
+// for transitions.
+type pdfTexture struct {
+	uniformName string
+	doc         *document
+	every       time.Duration
+	removeFuncs []func()
+	logger      *log.Logger
+
+	// cur and prev are the textures of the current and previous page.
+	cur, prev pdfPage
+	// changed is the time at which the current page was first shown.
+	changed time.Duration
+
+	lock sync.Mutex
+	// requested is the page to show, as set by keys and OSC.
+	requested int
+	rendered  map[int]*image.RGBA
+	rendering map[int]bool
+	lastErr   string
+}
+
+type pdfPage struct {
+	id, index uint32
+	page      int
+	rect      image.Rectangle
+}
+
+func newPDFTexture(uniformName string, doc *document, opts options, curIndex, prevIndex uint32, logger *log.Logger) (*pdfTexture, error) {
+	first, err := doc.render(0)
+	if err != nil {
+		return nil, err
+	}
+	tex := &pdfTexture{
+		uniformName: uniformName,
+		doc:         doc,
+		every:       opts.every,
+		logger:      logger,
+		cur:         pdfPage{index: curIndex},
+		prev:        pdfPage{index: prevIndex},
+		rendered:    map[int]*image.RGBA{0: first},
+		rendering:   map[int]bool{},
+	}
+	for _, p := range []*pdfPage{&tex.cur, &tex.prev} {
+		gl.GenTextures(1, &p.id)
+		p.upload(first, 0)
+	}
+
+	if opts.keys {
+		tex.removeFuncs = append(tex.removeFuncs, handleKeys(tex.navigate, logger))
+	}
+	if opts.osc != "" {
+		prefix := "/" + uniformName
+		for _, path := range []string{"/next", "/prev", "/page"} {
+			path := path
+			remove, err := osc.Handle(opts.osc, prefix+path, func(msg osc.Message) {
+				switch path {
+				case "/next":
+					tex.navigate(keyNext)
+				case "/prev":
+					tex.navigate(keyPrev)
+				case "/page":
+					if v, ok := msg.Float(0); ok {
+						tex.goTo(int(v) - 1)
+					}
+				}
+			})
+			if err != nil {
+				tex.Close()
+				return nil, err
+			}
+			tex.removeFuncs = append(tex.removeFuncs, remove)
+		}
+	}
+	tex.prefetch(1)
+	return tex, nil
+}
+
+func (tex *pdfTexture) navigate(k key) {
+	tex.lock.Lock()
+	page := tex.requested
+	tex.lock.Unlock()
+	switch k {
+	case keyNext:
+		tex.goTo(page + 1)
+	case keyPrev:
+		tex.goTo(page - 1)
+	case keyFirst:
+		tex.goTo(0)
+	}
+}
+
+func (tex *pdfTexture) goTo(page int) {
+	if page < 0 {
+		page = 0
+	} else if page >= tex.doc.numPages() {
+		page = tex.doc.numPages() - 1
+	}
+	tex.lock.Lock()
+	tex.requested = page
+	tex.lock.Unlock()
+	tex.prefetch(page)
+}
+
+// prefetch renders a page in the background if it has not been rendered yet.
+func (tex *pdfTexture) prefetch(page int) {
+	if page < 0 || page >= tex.doc.numPages() {
+		return
+	}
+	tex.lock.Lock()
+	defer tex.lock.Unlock()
+	if tex.rendered[page] != nil || tex.rendering[page] {
+		return
+	}
+	tex.rendering[page] = true
+	go func() {
+		img, err := tex.doc.render(page)
+		tex.lock.Lock()
+		defer tex.lock.Unlock()
+		delete(tex.rendering, page)
+		if err != nil {
+			if err.Error() != tex.lastErr {
+				tex.logger.Printf("Error rendering %s: %v", tex.uniformName, err)
+				tex.lastErr = err.Error()
+			}
+			return
+		}
+		tex.rendered[page] = img
+	}()
+}
+
+func (tex *pdfTexture) UniformSource() string {
+	return fmt.Sprintf(`
+		uniform sampler2D %[1]s;
+		uniform vec3 %[1]sSize;
+		uniform sampler2D %[1]sPrev;
+		uniform vec3 %[1]sPrevSize;
+		uniform int %[1]sPage;
+		uniform int %[1]sPageCount;
+		uniform float %[1]sTransition;
+	`, tex.uniformName)
+}
+
+func (tex *pdfTexture) PreRender(state renderer.RenderState) {
+	var page int
+	var img *image.RGBA
+	if tex.every > 0 {
+		// Pages follow the animation time, so they are rendered when needed
+		// to keep rendering deterministic.
+		page = int(state.Time/tex.every) % tex.doc.numPages()
+		tex.lock.Lock()
+		img = tex.rendered[page]
+		tex.lock.Unlock()
+		if img == nil && page != tex.cur.page {
+			var err error
+			if img, err = tex.doc.render(page); err != nil {
+				state.Logger.Printf("Error rendering %s: %v", tex.uniformName, err)
+			}
+		}
+	} else {
+		tex.lock.Lock()
+		page = tex.requested
+		img = tex.rendered[page]
+		tex.lock.Unlock()
+	}
+
+	if page != tex.cur.page && img != nil {
+		tex.cur, tex.prev = tex.prev, tex.cur
+		tex.cur.upload(img, page)
+		tex.changed = state.Time
+		// Only keep the pages around the current one in memory.
+		tex.lock.Lock()
+		tex.rendered[page] = img
+		for p := range tex.rendered {
+			if p < page-1 || p > page+1 {
+				delete(tex.rendered, p)
+			}
+		}
+		tex.lock.Unlock()
+		tex.prefetch(page + 1)
+		tex.prefetch(page - 1)
+	}
+
+	tex.cur.bind(state, tex.uniformName)
+	tex.prev.bind(state, tex.uniformName+"Prev")
+	if loc, ok := state.Uniforms[tex.uniformName+"Page"]; ok {
+		gl.Uniform1i(loc.Location, int32(tex.cur.page))
+	}
+	if loc, ok := state.Uniforms[tex.uniformName+"PageCount"]; ok {
+		gl.Uniform1i(loc.Location, int32(tex.doc.numPages()))
+	}
+	if loc, ok := state.Uniforms[tex.uniformName+"Transition"]; ok {
+		gl.Uniform1f(loc.Location, float32((state.Time - tex.changed).Seconds()))
+	}
+}
+
+func (p *pdfPage) upload(img *image.RGBA, page int) {
+	if img.Stride != 4*img.Rect.Dx() {
+		rgba := image.NewRGBA(image.Rect(0, 0, img.Rect.Dx(), img.Rect.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, img.Rect.Min, draw.Src)
+		img = rgba
+	}
+	gl.BindTexture(gl.TEXTURE_2D, p.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(img.Rect.Dx()), int32(img.Rect.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	p.page = page
+	p.rect = img.Rect
+}
+
+func (p *pdfPage) bind(state renderer.RenderState, uniformName string) {
+	if loc, ok := state.Uniforms[uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + p.index)
+		gl.BindTexture(gl.TEXTURE_2D, p.id)
+		gl.Uniform1i(loc.Location, int32(p.index))
+	}
+	if m := shadertoy.IchannelNumRe.FindStringSubmatch(uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
+			gl.Uniform3f(loc.Location, float32(p.rect.Dx()), float32(p.rect.Dy()), 1.0)
+		}
+	}
+	if loc, ok := state.Uniforms[uniformName+"Size"]; ok {
+		gl.Uniform3f(loc.Location, float32(p.rect.Dx()), float32(p.rect.Dy()), 1.0)
+	}
+}
+
+func (tex *pdfTexture) Close() error {
+	for _, remove := range tex.removeFuncs {
+		remove()
+	}
+	gl.DeleteTextures(1, &tex.cur.id)
+	gl.DeleteTextures(1, &tex.prev.id)
+	return nil
+}
@@ -0,0 +1,57 @@
+package pdf
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseValue(t *testing.T) {
+	opts, err := parseValue("slides.pdf;keys;osc=:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := (options{file: "slides.pdf", keys: true, osc: ":9000"}); opts != exp {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	opts, err = parseValue("slides.pdf;every=2.5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.every != 2500*time.Millisecond {
+		t.Fatalf("unexpected interval: %v", opts.every)
+	}
+	for _, invalid := range []string{"", "slides.pdf;every=0s", "slides.pdf;every=5s;keys", "slides.pdf;mouse"} {
+		if _, err := parseValue(invalid); err == nil {
+			t.Fatalf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestParsePDFInfo(t *testing.T) {
+	doc, err := parsePDFInfo(`Title:          Slides
+Pages:          3
+Page    1 size: 960 x 540 pts
+Page    2 size: 960 x 540 pts
+Page    3 size: 595.276 x 841.89 pts (A4)
+File size:      12345 bytes
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := [][2]float64{{960, 540}, {960, 540}, {595.276, 841.89}}
+	if !reflect.DeepEqual(doc.pageSizes, exp) {
+		t.Fatalf("unexpected page sizes: %v", doc.pageSizes)
+	}
+	if _, err := parsePDFInfo("Pages: 0\n"); err == nil {
+		t.Fatal("expected an error for an empty document")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte(" \x1b[C\x1b[A\x1b[Dpxg\x1b[6~"))
+	exp := []key{keyNext, keyNext, keyPrev, keyPrev, keyFirst, keyNext}
+	if !reflect.DeepEqual(keys, exp) {
+		t.Fatalf("unexpected keys: exp %v, got %v", exp, keys)
+	}
+}
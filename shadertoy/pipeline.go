@@ -0,0 +1,150 @@
+package shadertoy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// A Pass is a shader in a pipeline that renders to a buffer which can be
+// sampled by other passes.
+type Pass struct {
+	Name    string
+	Sources []renderer.SourceFile
+	// Size is the size of the buffer, formatted like the size of a buffer
+	// mapping: WxH or a scale factor relative to the canvas.
+	Size string
+	// Channels maps the names of sampler uniforms to the names of the passes
+	// they sample. A pass may sample itself, in which case it receives the
+	// previous frame it rendered.
+	Channels map[string]string
+	// Every is the number of frames between renders of the pass. Zero and
+	// one render every frame.
+	Every uint
+	// Once indicates that the pass is only rendered for the first frame and
+	// its output is reused afterwards.
+	Once bool
+	// On lists uniforms on which the pass is rendered again when their
+	// value is set to a different one, see renderer.SubEnvironment.
+	On []string
+}
+
+// NewPipeline creates a ShaderToy environment in which the image shader and
+// passes may sample each other's output as declared by the channels of each
+// pass.
+//
+// The passes are validated to form an acyclic graph and may be specified in
+// any order. Each frame, a pass is rendered when it is first sampled, after
+// the passes it samples itself, so the graph determines the order in which
+// they are rendered.
+func NewPipeline(
+	imageSources []renderer.SourceFile,
+	imageChannels map[string]string,
+	passes []Pass,
+	overrideMappings []Mapping,
+	glslVersion string,
+) (*ShaderToy, error) {
+	if _, err := SortPasses(passes); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Pass, len(passes))
+	for i := range passes {
+		byName[passes[i].Name] = &passes[i]
+	}
+	for name, pass := range imageChannels {
+		if _, ok := byName[pass]; !ok {
+			return nil, fmt.Errorf("channel %s of the image samples unknown pass %q", name, pass)
+		}
+	}
+
+	st, err := NewShaderToy(imageSources, overrideMappings, glslVersion)
+	if err != nil {
+		return nil, err
+	}
+	st.passes = byName
+	st.mappings = deduplicateMappings(append(st.mappings, passMappings(imageChannels, "")...)...)
+	return st, nil
+}
+
+// passMappings converts the channels of a pass to mappings.
+func passMappings(channels map[string]string, self string) []Mapping {
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mappings := make([]Mapping, 0, len(channels))
+	for _, name := range names {
+		pass := channels[name]
+		if pass == self {
+			mappings = append(mappings, Mapping{Name: name, Namespace: "builtin", Value: "Back Buffer"})
+		} else {
+			mappings = append(mappings, Mapping{Name: name, Namespace: "pass", Value: pass})
+		}
+	}
+	return mappings
+}
+
+// SortPasses orders the passes such that each pass comes after the passes it
+// samples. An error is returned if a pass samples an unknown pass or if the
+// passes sample each other in a cycle.
+func SortPasses(passes []Pass) ([]Pass, error) {
+	byName := make(map[string]*Pass, len(passes))
+	for i := range passes {
+		p := &passes[i]
+		if _, ok := byName[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate pass %q", p.Name)
+		}
+		byName[p.Name] = p
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(passes))
+	sorted := make([]Pass, 0, len(passes))
+	var visit func(p *Pass, path []string) error
+	visit = func(p *Pass, path []string) error {
+		switch state[p.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("passes form a cycle: %s; only a pass sampling itself can be rendered using its previous frame", strings.Join(append(path, p.Name), " -> "))
+		}
+		state[p.Name] = visiting
+
+		channels := make([]string, 0, len(p.Channels))
+		for name := range p.Channels {
+			channels = append(channels, name)
+		}
+		sort.Strings(channels)
+		for _, ch := range channels {
+			depName := p.Channels[ch]
+			if depName == p.Name {
+				continue
+			}
+			dep, ok := byName[depName]
+			if !ok {
+				return fmt.Errorf("channel %s of pass %q samples unknown pass %q", ch, p.Name, depName)
+			}
+			if err := visit(dep, append(path, p.Name)); err != nil {
+				return err
+			}
+		}
+
+		state[p.Name] = visited
+		sorted = append(sorted, *p)
+		return nil
+	}
+	for i := range passes {
+		if err := visit(&passes[i], nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
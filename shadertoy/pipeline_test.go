@@ -0,0 +1,44 @@
+package shadertoy
+
+import (
+	"testing"
+)
+
+func TestSortPasses(t *testing.T) {
+	passes := []Pass{
+		{Name: "C", Channels: map[string]string{"iChannel0": "A", "iChannel1": "B"}},
+		{Name: "B", Channels: map[string]string{"iChannel0": "A", "iChannel1": "B"}},
+		{Name: "A"},
+	}
+	sorted, err := SortPasses(passes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := ""
+	for _, p := range sorted {
+		order += p.Name
+	}
+	if order != "ABC" {
+		t.Fatalf("unexpected order: exp %q, got %q", "ABC", order)
+	}
+}
+
+func TestSortPassesCycle(t *testing.T) {
+	passes := []Pass{
+		{Name: "A", Channels: map[string]string{"iChannel0": "B"}},
+		{Name: "B", Channels: map[string]string{"iChannel0": "C"}},
+		{Name: "C", Channels: map[string]string{"iChannel0": "A"}},
+	}
+	if _, err := SortPasses(passes); err == nil {
+		t.Fatalf("expected an error for a cycle")
+	}
+}
+
+func TestSortPassesUnknown(t *testing.T) {
+	passes := []Pass{
+		{Name: "A", Channels: map[string]string{"iChannel0": "B"}},
+	}
+	if _, err := SortPasses(passes); err == nil {
+		t.Fatalf("expected an error for an unknown pass")
+	}
+}
@@ -0,0 +1,104 @@
+package shadertoy
+
+import (
+	"fmt"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// A Projection determines how the pixels of the canvas are mapped to view
+// rays for panoramic rendering.
+type Projection string
+
+const (
+	// ProjectionNone calls the regular mainImage entrypoint.
+	ProjectionNone Projection = ""
+	// ProjectionEquirect maps the canvas to the full sphere around the
+	// viewer, with the longitude along the X axis and the latitude along
+	// the Y axis. The mainVR entrypoint is called with the ray of each
+	// pixel.
+	ProjectionEquirect Projection = "equirect"
+	// ProjectionCubemap divides the canvas into a 3x2 grid of cube faces
+	// in the order +X, -X, +Y on the top row and -Y, +Z, -Z on the bottom
+	// row. The mainCubemap entrypoint is called with the ray of each pixel.
+	ProjectionCubemap Projection = "cubemap"
+)
+
+func ParseProjection(s string) (Projection, error) {
+	switch p := Projection(s); p {
+	case ProjectionNone, ProjectionEquirect, ProjectionCubemap:
+		return p, nil
+	case "none":
+		return ProjectionNone, nil
+	}
+	return ProjectionNone, fmt.Errorf("invalid projection: %q (valid: none, equirect, cubemap)", s)
+}
+
+// mainSource returns the source of the main function that calls the
+// entrypoint of the shader for the projection. The additional outputs are
+// written after the color, in the specified order. The position of each pixel
+// is wrapped according to the tiling.
+//
+// The ray origin is offset perpendicular to the ray direction by the eye
+// offset, so panoramas rendered stereoscopically have the correct parallax
+// in every direction.
+func (p Projection) mainSource(outputs []renderer.Output, tiling Tiling) string {
+	var call string
+	switch p {
+	case ProjectionEquirect:
+		call = `
+			vec2 uv = pos / iResolution.xy;
+			float lon = (uv.x - 0.5) * 6.28318530718;
+			float lat = (uv.y - 0.5) * 3.14159265359;
+			vec3 dir = vec3(cos(lat) * sin(lon), sin(lat), -cos(lat) * cos(lon));
+			vec3 ori = vec3(cos(lon), 0.0, sin(lon)) * iEyeOffset[3].x;
+			mainVR(color, pos, ori, dir);
+		`
+	case ProjectionCubemap:
+		call = `
+			vec2 cell = pos / iResolution.xy * vec2(3.0, 2.0);
+			int face = int(cell.x) + (cell.y >= 1.0 ? 0 : 3);
+			vec2 f = fract(cell) * 2.0 - 1.0;
+			vec3 dir;
+			if (face == 0) dir = vec3(1.0, f.y, f.x);
+			else if (face == 1) dir = vec3(-1.0, f.y, -f.x);
+			else if (face == 2) dir = vec3(f.x, 1.0, -f.y);
+			else if (face == 3) dir = vec3(f.x, -1.0, f.y);
+			else if (face == 4) dir = vec3(-f.x, f.y, 1.0);
+			else dir = vec3(f.x, f.y, -1.0);
+			dir = normalize(dir);
+			vec3 right = normalize(vec3(-dir.z, 0.0, dir.x) + vec3(1e-6, 0.0, 0.0));
+			vec3 ori = right * iEyeOffset[3].x;
+			mainCubemap(color, pos, ori, dir);
+		`
+	default:
+		call = `
+			mainImage(color, pos);
+		`
+	}
+	output := "gl_FragColor = color;"
+	if len(outputs) > 0 {
+		output = "gl_FragData[0] = color;"
+		for i, o := range outputs {
+			switch o {
+			case renderer.OutputDepth:
+				output += fmt.Sprintf("gl_FragData[%d] = vec4(shady_fragDepth);", i+1)
+			case renderer.OutputMotion:
+				output += fmt.Sprintf("gl_FragData[%d] = vec4(shady_fragMotion, 0.0, 0.0);", i+1)
+			case renderer.OutputColor:
+				output += fmt.Sprintf("gl_FragData[%d] = color;", i+1)
+			}
+		}
+	}
+	return fmt.Sprintf(`
+		void main(void) {
+			vec2 pos = gl_FragCoord.xy - iEyeOrigin;
+			pos.y = iResolution.y - pos.y - 1;
+			%s
+			pos += iJitter;
+			vec4 color;
+			%s
+			%s
+		}
+	`, tiling.wrapSource(), call, output)
+}
@@ -0,0 +1,331 @@
+//go:build realsense
+
+package realsense
+
+// #cgo pkg-config: realsense2
+// #include <stdlib.h>
+// #include <librealsense2/rs.h>
+// #include <librealsense2/h/rs_pipeline.h>
+// #include <librealsense2/h/rs_config.h>
+// #include <librealsense2/h/rs_frame.h>
+// #include <librealsense2/h/rs_sensor.h>
+//
+// rs2_context *create_context_cgo(rs2_error **err) {
+//   return rs2_create_context(RS2_API_VERSION, err);
+// }
+//
+// // depth_scale_cgo returns the number of meters per depth unit of the first
+// // depth sensor of the device.
+// float depth_scale_cgo(rs2_pipeline_profile *profile, rs2_error **err) {
+//   rs2_device *dev = rs2_pipeline_profile_get_device(profile, err);
+//   if (*err) return 0;
+//   rs2_sensor_list *sensors = rs2_query_sensors(dev, err);
+//   if (*err) { rs2_delete_device(dev); return 0; }
+//   float scale = 0;
+//   int n = rs2_get_sensors_count(sensors, err);
+//   for (int i = 0; !*err && i < n && scale == 0; i++) {
+//     rs2_sensor *sensor = rs2_create_sensor(sensors, i, err);
+//     if (*err) break;
+//     if (rs2_is_sensor_extendable_to(sensor, RS2_EXTENSION_DEPTH_SENSOR, err) && !*err) {
+//       scale = rs2_get_depth_scale(sensor, err);
+//     }
+//     rs2_delete_sensor(sensor);
+//   }
+//   rs2_delete_sensor_list(sensors);
+//   rs2_delete_device(dev);
+//   return scale;
+// }
+import "C"
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"unsafe"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+const (
+	width, height = 640, 480
+	framerate     = 30
+	// waitTimeout is the number of milliseconds to wait for frames, after
+	// which the closing of the device is checked.
+	waitTimeout = 500
+)
+
+func init() {
+	shadertoy.RegisterResourceType("realsense", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
+		serial := m.Value
+		if serial == "on" {
+			serial = ""
+		}
+		return open(m.Name, serial, [3]uint32{genTexID(), genTexID(), genTexID()})
+	})
+}
+
+func rsError(err *C.rs2_error) error {
+	if err == nil {
+		return nil
+	}
+	defer C.rs2_free_error(err)
+	return fmt.Errorf("realsense: %s: %s", C.GoString(C.rs2_get_failed_function(err)), C.GoString(C.rs2_get_error_message(err)))
+}
+
+// stream is a texture holding the latest frame of a stream of the camera.
+type stream struct {
+	uniformName                    string
+	id, index                      uint32
+	internalFormat, format, glType uint32
+	pix                            interface{}
+}
+
+func (s *stream) create() {
+	gl.GenTextures(1, &s.id)
+	gl.BindTexture(gl.TEXTURE_2D, s.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, int32(s.internalFormat), width, height, 0, s.format, s.glType, gl.Ptr(s.pix))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func (s *stream) bind(state renderer.RenderState, dirty bool) {
+	if loc, ok := state.Uniforms[s.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + s.index)
+		gl.BindTexture(gl.TEXTURE_2D, s.id)
+		if dirty {
+			gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, width, height, s.format, s.glType, gl.Ptr(s.pix))
+		}
+		gl.Uniform1i(loc.Location, int32(s.index))
+	}
+	if m := shadertoy.IchannelNumRe.FindStringSubmatch(s.uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
+			gl.Uniform3f(loc.Location, width, height, 1.0)
+		}
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", s.uniformName)]; ok {
+		gl.Uniform3f(loc.Location, width, height, 1.0)
+	}
+}
+
+type realsense struct {
+	ctx     *C.rs2_context
+	pipe    *C.rs2_pipeline
+	profile *C.rs2_pipeline_profile
+	// depthScale is the number of meters per unit of the depth stream.
+	depthScale float32
+
+	closed, loopClosed chan struct{}
+
+	uniformName string
+
+	// lock protects the pixels of the streams, which are written by the
+	// frame loop.
+	lock             sync.Mutex
+	color, depth, ir stream
+	colorPix, irPix  []uint8
+	depthPix         []float32
+	dirty            bool
+}
+
+func open(uniformName, serial string, textureIndices [3]uint32) (*realsense, error) {
+	rs := &realsense{
+		closed:      make(chan struct{}),
+		loopClosed:  make(chan struct{}),
+		uniformName: uniformName,
+		colorPix:    make([]uint8, width*height*4),
+		depthPix:    make([]float32, width*height),
+		irPix:       make([]uint8, width*height),
+	}
+	rs.color = stream{uniformName: uniformName, index: textureIndices[0], internalFormat: gl.RGBA, format: gl.RGBA, glType: gl.UNSIGNED_BYTE, pix: rs.colorPix}
+	rs.depth = stream{uniformName: uniformName + "Depth", index: textureIndices[1], internalFormat: gl.R32F, format: gl.RED, glType: gl.FLOAT, pix: rs.depthPix}
+	rs.ir = stream{uniformName: uniformName + "IR", index: textureIndices[2], internalFormat: gl.R8, format: gl.RED, glType: gl.UNSIGNED_BYTE, pix: rs.irPix}
+
+	if err := rs.start(serial); err != nil {
+		rs.stop()
+		return nil, err
+	}
+	for _, s := range []*stream{&rs.color, &rs.depth, &rs.ir} {
+		s.create()
+	}
+	go rs.frameLoop()
+	return rs, nil
+}
+
+func (rs *realsense) start(serial string) error {
+	var err *C.rs2_error
+	if rs.ctx = C.create_context_cgo(&err); err != nil {
+		return rsError(err)
+	}
+	if rs.pipe = C.rs2_create_pipeline(rs.ctx, &err); err != nil {
+		return rsError(err)
+	}
+	config := C.rs2_create_config(&err)
+	if err != nil {
+		return rsError(err)
+	}
+	defer C.rs2_delete_config(config)
+	if serial != "" {
+		cSerial := C.CString(serial)
+		defer C.free(unsafe.Pointer(cSerial))
+		if C.rs2_config_enable_device(config, cSerial, &err); err != nil {
+			return rsError(err)
+		}
+	}
+	streams := []struct {
+		stream C.rs2_stream
+		index  C.int
+		format C.rs2_format
+	}{
+		{C.RS2_STREAM_COLOR, 0, C.RS2_FORMAT_RGBA8},
+		{C.RS2_STREAM_DEPTH, 0, C.RS2_FORMAT_Z16},
+		{C.RS2_STREAM_INFRARED, 1, C.RS2_FORMAT_Y8},
+	}
+	for _, s := range streams {
+		if C.rs2_config_enable_stream(config, s.stream, s.index, width, height, s.format, framerate, &err); err != nil {
+			return rsError(err)
+		}
+	}
+	if rs.profile = C.rs2_pipeline_start_with_config(rs.pipe, config, &err); err != nil {
+		return rsError(err)
+	}
+	if rs.depthScale = float32(C.depth_scale_cgo(rs.profile, &err)); err != nil {
+		return rsError(err)
+	}
+	return nil
+}
+
+// stop stops the pipeline and releases everything that was created by start.
+func (rs *realsense) stop() {
+	var err *C.rs2_error
+	if rs.profile != nil {
+		C.rs2_pipeline_stop(rs.pipe, &err)
+		if err != nil {
+			log.Println(rsError(err))
+		}
+		C.rs2_delete_pipeline_profile(rs.profile)
+	}
+	if rs.pipe != nil {
+		C.rs2_delete_pipeline(rs.pipe)
+	}
+	if rs.ctx != nil {
+		C.rs2_delete_context(rs.ctx)
+	}
+}
+
+func (rs *realsense) frameLoop() {
+	defer close(rs.loopClosed)
+	for {
+		select {
+		case <-rs.closed:
+			return
+		default:
+		}
+		var err *C.rs2_error
+		frames := C.rs2_pipeline_wait_for_frames(rs.pipe, waitTimeout, &err)
+		if err != nil {
+			// Timeouts are reported as errors too.
+			log.Println(rsError(err))
+			continue
+		}
+		if err := rs.processFrames(frames); err != nil {
+			log.Println(err)
+		}
+		C.rs2_release_frame(frames)
+	}
+}
+
+func (rs *realsense) processFrames(frames *C.rs2_frame) error {
+	var err *C.rs2_error
+	n := C.rs2_embedded_frames_count(frames, &err)
+	if err != nil {
+		return rsError(err)
+	}
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	for i := C.int(0); i < n; i++ {
+		frame := C.rs2_extract_frame(frames, i, &err)
+		if err != nil {
+			return rsError(err)
+		}
+		err := rs.copyFrame(frame)
+		C.rs2_release_frame(frame)
+		if err != nil {
+			return err
+		}
+	}
+	rs.dirty = true
+	return nil
+}
+
+func (rs *realsense) copyFrame(frame *C.rs2_frame) error {
+	var err *C.rs2_error
+	profile := C.rs2_get_frame_stream_profile(frame, &err)
+	if err != nil {
+		return rsError(err)
+	}
+	var kind C.rs2_stream
+	var format C.rs2_format
+	var index, uniqueID, rate C.int
+	if C.rs2_get_stream_profile_data(profile, &kind, &format, &index, &uniqueID, &rate, &err); err != nil {
+		return rsError(err)
+	}
+	w, h := C.rs2_get_frame_width(frame, &err), C.rs2_get_frame_height(frame, &err)
+	if err != nil {
+		return rsError(err)
+	}
+	if w != width || h != height {
+		return fmt.Errorf("realsense: unexpected frame size %dx%d", w, h)
+	}
+	data := C.rs2_get_frame_data(frame, &err)
+	if err != nil {
+		return rsError(err)
+	}
+
+	switch kind {
+	case C.RS2_STREAM_COLOR:
+		copy(rs.colorPix, unsafe.Slice((*uint8)(data), len(rs.colorPix)))
+	case C.RS2_STREAM_DEPTH:
+		for i, v := range unsafe.Slice((*uint16)(data), len(rs.depthPix)) {
+			rs.depthPix[i] = float32(v) * rs.depthScale
+		}
+	case C.RS2_STREAM_INFRARED:
+		copy(rs.irPix, unsafe.Slice((*uint8)(data), len(rs.irPix)))
+	}
+	return nil
+}
+
+func (rs *realsense) UniformSource() string {
+	return fmt.Sprintf(`
+		uniform sampler2D %[1]s;
+		uniform vec3 %[1]sSize;
+		uniform sampler2D %[1]sDepth;
+		uniform vec3 %[1]sDepthSize;
+		uniform sampler2D %[1]sIR;
+		uniform vec3 %[1]sIRSize;
+	`, rs.uniformName)
+}
+
+func (rs *realsense) PreRender(state renderer.RenderState) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	for _, s := range []*stream{&rs.color, &rs.depth, &rs.ir} {
+		s.bind(state, rs.dirty)
+	}
+	rs.dirty = false
+}
+
+func (rs *realsense) Close() error {
+	close(rs.closed)
+	<-rs.loopClosed
+	rs.stop()
+	for _, s := range []*stream{&rs.color, &rs.depth, &rs.ir} {
+		gl.DeleteTextures(1, &s.id)
+	}
+	return nil
+}
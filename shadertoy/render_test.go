@@ -0,0 +1,668 @@
+package shadertoy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/glslsandbox"
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/renderer/rendertest"
+)
+
+func TestRender(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	source := `
+		void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+			fragColor = vec4(fragCoord.x < iResolution.x / 2.0 ? 1.0 : 0.0, 0.0, 1.0, 1.0);
+		}
+	`
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := rendertest.Render(t, env, 4, 2)
+	if c := img.RGBAAt(0, 0); c != (color.RGBA{255, 0, 255, 255}) {
+		t.Fatalf("unexpected color on the left: %v", c)
+	}
+	if c := img.RGBAAt(3, 1); c != (color.RGBA{0, 0, 255, 255}) {
+		t.Fatalf("unexpected color on the right: %v", c)
+	}
+}
+
+func TestResizeScaledBuffer(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	dir := t.TempDir()
+	// The buffer outputs its own resolution, which is shown by the image.
+	buffer := "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(iResolution.xy / 255.0, 0.0, 1.0); }"
+	source := `
+#pragma map buf=buffer:buffer.glsl;0.5
+		void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+			fragColor = texture(buf, vec2(0.5));
+		}
+	`
+	if err := os.WriteFile(filepath.Join(dir, "buffer.glsl"), []byte(buffer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "shader.glsl"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filepath.Join(dir, "shader.glsl")), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := renderer.NewShader(8, 4, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetEnvironment(env)
+	size := func() (uint8, uint8) {
+		img, err := sh.Image(context.Background(), time.Second/10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := img.(*image.RGBA).RGBAAt(0, 0)
+		return c.R, c.G
+	}
+
+	if w, h := size(); w != 4 || h != 2 {
+		t.Fatalf("unexpected buffer size: exp 4x2, got %dx%d", w, h)
+	}
+	sh.Resize(32, 16)
+	if w, h := size(); w != 16 || h != 8 {
+		t.Fatalf("unexpected buffer size after resizing: exp 16x8, got %dx%d", w, h)
+	}
+}
+
+func TestBufferRenderOn(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	dir := t.TempDir()
+	// The buffer outputs the number of times it was rendered before.
+	buffer := "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(float(iFrame) / 255.0, 0.0, 0.0, 1.0); }"
+	source := `
+#pragma map buf=buffer:buffer.glsl;1x1;on=seed
+		uniform float seed;
+		void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+			fragColor = vec4(texture(buf, vec2(0.5)).r, seed, 0.0, 1.0);
+		}
+	`
+	if err := os.WriteFile(filepath.Join(dir, "buffer.glsl"), []byte(buffer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "shader.glsl"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filepath.Join(dir, "shader.glsl")), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := renderer.NewShader(1, 1, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetEnvironment(env)
+	renders := func() uint8 {
+		img, err := sh.Image(context.Background(), time.Second/10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img.(*image.RGBA).RGBAAt(0, 0).R
+	}
+
+	for i := 0; i < 3; i++ {
+		if n := renders(); n != 0 {
+			t.Fatalf("expected the buffer to be rendered once, got %d renders", n+1)
+		}
+	}
+	for i, seed := range []float32{1, 1, 0, 0} {
+		if err := sh.SetUniform("seed", seed); err != nil {
+			t.Fatal(err)
+		}
+		if n, exp := renders(), uint8(1+i/2); n != exp {
+			t.Fatalf("unexpected number of renders after setting seed to %v: exp %d, got %d", seed, exp+1, n+1)
+		}
+	}
+}
+
+func TestPipelineOrder(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	dir := t.TempDir()
+	// Each pass adds a color component to the output of the pass it samples.
+	sources := map[string]string{
+		"a":     "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(1.0, 0.0, 0.0, 1.0); }",
+		"b":     "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = texture(iChannel0, vec2(0.5)) + vec4(0.0, 1.0, 0.0, 0.0); }",
+		"c":     "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = texture(iChannel0, vec2(0.5)) + vec4(0.0, 0.0, 1.0, 0.0); }",
+		"image": "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = texture(iChannel0, vec2(0.5)); }",
+	}
+	files := map[string][]renderer.SourceFile{}
+	for name, source := range sources {
+		filename := filepath.Join(dir, name+".glsl")
+		if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files[name] = renderer.SourceFiles(filename)
+	}
+	passes := []Pass{
+		{Name: "C", Sources: files["c"], Size: "1x1", Channels: map[string]string{"iChannel0": "B"}},
+		{Name: "B", Sources: files["b"], Size: "1x1", Channels: map[string]string{"iChannel0": "A"}},
+		{Name: "A", Sources: files["a"], Size: "1x1"},
+	}
+	env, err := NewPipeline(files["image"], map[string]string{"iChannel0": "C"}, passes, nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := rendertest.Render(t, env, 1, 1)
+	if c := img.RGBAAt(0, 0); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Fatalf("unexpected color: exp white, got %v", c)
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	// The shader may use the names of the variables of outputs without the
+	// prefix itself.
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	source := `
+		float fragDepth = 0.5;
+		vec2 fragMotion = vec2(0.0);
+		void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+			fragColor = vec4(1.0);
+			shady_fragDepth = fragDepth / 2.0;
+			shady_fragMotion = fragMotion;
+		}
+	`
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.SetOutputs(renderer.OutputDepth, renderer.OutputMotion)
+	sh, err := renderer.NewShader(1, 1, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	if err := sh.EnableOutputs(renderer.OutputDepth, renderer.OutputMotion); err != nil {
+		t.Fatal(err)
+	}
+	sh.SetEnvironment(env)
+	img, err := sh.Image(context.Background(), time.Second/10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth := img.(*renderer.LayeredImage).Depth[0]; depth != 0.25 {
+		t.Fatalf("unexpected depth: exp 0.25, got %v", depth)
+	}
+}
+
+func TestAccumulationFrame(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	source := "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(float(iFrame) / 255.0, 0.0, 0.0, 1.0); }"
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := renderer.NewShader(1, 1, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetAccumulation(renderer.Accumulation{Samples: 4})
+	sh.SetEnvironment(env)
+
+	// All samples of a frame are rendered with its frame number.
+	for frame := uint8(0); frame < 3; frame++ {
+		img, err := sh.Image(context.Background(), time.Second/10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := img.(*image.RGBA).RGBAAt(0, 0).R; r != frame {
+			t.Fatalf("unexpected frame number: exp %d, got %d", frame, r)
+		}
+	}
+}
+
+func TestRenderFrames(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	source := `
+		void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+			fragColor = vec4(iTime, 0.0, 0.0, 1.0);
+		}
+	`
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := renderer.NewShader(1, 1, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetEnvironment(env)
+
+	var reds []uint8
+	err = sh.RenderFrames(5, 5, func(i int, img image.Image) error {
+		if i != len(reds) {
+			t.Fatalf("expected frame %d, got %d", len(reds), i)
+		}
+		r, _, _, _ := img.At(0, 0).RGBA()
+		reds = append(reds, uint8(r>>8))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint8{0, 51, 102, 153, 204}
+	for i := range expected {
+		if reds[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, reds)
+		}
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = sh.RenderFrames(5, 5, func(i int, img image.Image) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Fatalf("expected to stop after the first frame, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	newEnv := func(color string) renderer.Environment {
+		filename := filepath.Join(t.TempDir(), "shader.glsl")
+		source := "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(" + color + ", 1.0); }"
+		if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return env
+	}
+	sh, err := renderer.NewShader(1, 1, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetHistory(1)
+	render := func() color.Color {
+		img, err := sh.Image(context.Background(), time.Second/10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img.At(0, 0)
+	}
+
+	if sh.Rollback() {
+		t.Fatal("expected nothing to roll back to")
+	}
+	red, green := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}
+	sh.SetEnvironment(newEnv("1.0, 0.0, 0.0"))
+	if c := render(); c != red {
+		t.Fatalf("expected red, got %v", c)
+	}
+	sh.SetEnvironment(newEnv("0.0, 1.0, 0.0"))
+	if c := render(); c != green {
+		t.Fatalf("expected green, got %v", c)
+	}
+	if !sh.Rollback() {
+		t.Fatal("expected to roll back")
+	}
+	if c := render(); c != red {
+		t.Fatalf("expected red after rolling back, got %v", c)
+	}
+	if sh.Rollback() {
+		t.Fatal("expected the rolled back version to be removed from the history")
+	}
+}
+
+func TestThreadShader(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	source := "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(0.0, 0.0, 1.0, 1.0); }"
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := renderer.NewThreadShader(context.Background(), 2, 2, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetEnvironment(env)
+
+	// Render from goroutines that are not locked to the thread of the
+	// context.
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			img, err := sh.Image(context.Background(), time.Second/10)
+			if err == nil && img.At(1, 1) != (color.RGBA{0, 0, 255, 255}) {
+				err = fmt.Errorf("unexpected color: %v", img.At(1, 1))
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImageInto(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	source := "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(1.0, 0.0, 1.0, 1.0); }"
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := renderer.NewShader(2, 2, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetEnvironment(env)
+
+	dst := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if ok, err := sh.ImageInto(context.Background(), dst, time.Second/10); err != nil || !ok {
+		t.Fatalf("frame not rendered: %v", err)
+	}
+	if c := dst.RGBAAt(1, 1); c != (color.RGBA{255, 0, 255, 255}) {
+		t.Fatalf("unexpected color: %v", c)
+	}
+	if _, err := sh.ImageInto(context.Background(), image.NewRGBA(image.Rect(0, 0, 3, 2)), time.Second/10); err == nil {
+		t.Fatal("expected an error for an image of another size")
+	}
+
+	// A recycled frame is read into again.
+	img, err := sh.Image(context.Background(), time.Second/10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.Recycle(img)
+	next, err := sh.Image(context.Background(), time.Second/10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &next.(*image.RGBA).Pix[0] != &img.(*image.RGBA).Pix[0] {
+		t.Fatal("recycled frame was not reused")
+	}
+}
+
+// renderFeedback renders a few frames of a shader that shows the green of the
+// previous frame in red, and returns the red of the last frame. setup adds
+// processing to the shader that may put green in the frames.
+func renderFeedback(t *testing.T, setup func(sh *renderer.Shader) error) uint8 {
+	t.Helper()
+	// The back buffer is provided by another package, so the shader is run
+	// in the GLSL Sandbox environment.
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	source := `
+		uniform sampler2D backbuffer;
+		uniform vec2 resolution;
+		out vec4 color;
+		void main() {
+			color = vec4(texture(backbuffer, gl_FragCoord.xy / resolution).g, 0.0, 0.0, 1.0);
+		}
+	`
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := glslsandbox.NewGLSLSandbox(renderer.SourceFiles(filename), "330")
+	sh, err := renderer.NewShader(1, 1, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	if err := setup(sh); err != nil {
+		t.Fatal(err)
+	}
+	sh.SetEnvironment(env)
+	var img image.Image
+	for i := 0; i < 3; i++ {
+		if img, err = sh.Image(context.Background(), time.Second/10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return img.(*image.RGBA).RGBAAt(0, 0).R
+}
+
+func TestOverlayFeedback(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	// The overlay is not part of the previous frame.
+	red := renderFeedback(t, func(sh *renderer.Shader) error {
+		green := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		green.SetRGBA(0, 0, color.RGBA{0, 255, 0, 255})
+		return sh.AddOverlay(renderer.Overlay{Image: green, Corner: renderer.CornerTopLeft, Opacity: 0.5})
+	})
+	if red != 0 {
+		t.Fatalf("overlay is part of the previous frame: red %d", red)
+	}
+}
+
+func TestPostPassFeedback(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	// The processed frame is not read back as the previous frame.
+	red := renderFeedback(t, func(sh *renderer.Shader) error {
+		return sh.AddPostPass(renderer.PostPass{Fragment: renderer.SourceBuf(`#version 330 core
+			uniform sampler2D frame;
+			in vec2 texCoord;
+			out vec4 color;
+			void main() {
+				color = texture(frame, texCoord) + vec4(0.0, 0.5, 0.0, 0.0);
+			}
+		`)})
+	})
+	if red != 0 {
+		t.Fatalf("post pass is applied to the previous frame: red %d", red)
+	}
+}
+
+func TestOverlayRenderSize(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	source := "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(0.0, 0.0, 0.0, 1.0); }"
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := renderer.NewShader(2, 2, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	// Without a size, the overlay follows the size of the rendered images.
+	size := 1
+	err = sh.AddOverlay(renderer.Overlay{
+		Render: func(renderer.OverlayFrame) image.Image {
+			img := image.NewRGBA(image.Rect(0, 0, size, size))
+			draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{0, 255, 0, 255}), image.Point{}, draw.Src)
+			return img
+		},
+		Corner:  renderer.CornerTopLeft,
+		Opacity: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.SetEnvironment(env)
+	for _, exp := range []uint8{0, 255} {
+		img, err := sh.Image(context.Background(), time.Second/10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := img.(*image.RGBA).RGBAAt(1, 1).G; g != exp {
+			t.Fatalf("unexpected overlay at %dx%d: exp green %d, got %d", size, size, exp, g)
+		}
+		size++
+	}
+}
+
+// closeRecorder records whether the environment was closed.
+type closeRecorder struct {
+	renderer.Environment
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return r.Environment.Close()
+}
+
+func TestFallback(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	dir := t.TempDir()
+	newEnv := func(name, source string) *closeRecorder {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		env, err := NewShaderToy(renderer.SourceFiles(filename), nil, "330")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &closeRecorder{Environment: env}
+	}
+	broken := newEnv("broken.glsl", "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = undefined; }")
+	fallback := newEnv("fallback.glsl", "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(0.0, 1.0, 0.0, 1.0); }")
+	sh, err := renderer.NewShader(1, 1, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	var loadErr error
+	sh.SetFallback(func(err error) renderer.Environment {
+		loadErr = err
+		return fallback
+	})
+	sh.SetEnvironment(broken)
+
+	// The error is passed to the fallback, which is shown instead.
+	if err := sh.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error with a fallback: %v", err)
+	}
+	if loadErr == nil {
+		t.Fatal("expected the error to be passed to the fallback")
+	}
+	if !broken.closed {
+		t.Fatal("expected the environment that failed to load to be closed")
+	}
+	img, err := sh.Image(context.Background(), time.Second/10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := img.At(0, 0); c != (color.RGBA{0, 255, 0, 255}) {
+		t.Fatalf("expected the fallback to be rendered, got %v", c)
+	}
+}
+
+func TestBufferNoGLError(t *testing.T) {
+	rendertest.RequireGL(t)
+
+	dir := t.TempDir()
+	buffer := "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = vec4(1.0, 0.0, 0.0, 1.0); }"
+	source := `
+#pragma map buf=buffer:buffer.glsl;1x1
+		void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+			fragColor = texture(buf, vec2(0.5));
+		}
+	`
+	if err := os.WriteFile(filepath.Join(dir, "buffer.glsl"), []byte(buffer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "shader.glsl"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewShaderToy(renderer.SourceFiles(filepath.Join(dir, "shader.glsl")), nil, "330")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := renderer.NewShader(2, 2, renderer.OpenGL33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+	sh.SetRestartOnError(true)
+	sh.SetEnvironment(env)
+
+	// The buffer is rendered while the frame of the shader is timed, which
+	// must not raise an error that restarts the shader.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(10*time.Second, cancel)
+	stream := make(chan image.Image)
+	received := make(chan int, 1)
+	go func() {
+		n := 0
+		for ; n < 10; n++ {
+			select {
+			case <-stream:
+			case <-ctx.Done():
+				received <- n
+				return
+			}
+		}
+		cancel()
+		received <- n
+	}()
+	sh.Animate(ctx, time.Second/10, stream)
+	if st := sh.Stats(); st.Errors != 0 {
+		t.Fatalf("unexpected OpenGL error: %v", st.LastError)
+	}
+	if n := <-received; n != 10 {
+		t.Fatalf("expected 10 frames, got %d", n)
+	}
+}
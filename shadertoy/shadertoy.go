@@ -46,8 +46,17 @@ type ShaderToy struct {
 	shaderSources []renderer.SourceFile
 	mappings      []Mapping
 	glslVersion   string
+	projection    Projection
+	tiling        Tiling
+	outputs       []renderer.Output
+	// sampleRate is set to render a sound shader.
+	sampleRate int
+	compat     bool
 
 	resources []Resource
+	// passes holds the passes of the pipeline this environment is part of,
+	// if any. They can be sampled through mappings in the "pass" namespace.
+	passes map[string]*Pass
 }
 
 func NewShaderToy(
@@ -59,6 +68,15 @@ func NewShaderToy(
 	if err != nil {
 		return nil, err
 	}
+	if len(shaderSources) > 0 {
+		// Mappings from elsewhere inherit the template data of the shader.
+		overrideMappings = append([]Mapping(nil), overrideMappings...)
+		for i := range overrideMappings {
+			if overrideMappings[i].templateData == nil {
+				overrideMappings[i].templateData = shaderSources[0].TemplateData
+			}
+		}
+	}
 	mappings := deduplicateMappings(append(overrideMappings, sourceMappings...)...)
 
 	return &ShaderToy{
@@ -69,6 +87,26 @@ func NewShaderToy(
 	}, nil
 }
 
+// SetProjection sets the projection used to map the pixels of the canvas to
+// view rays. It should be called before the environment is used to render.
+func (st *ShaderToy) SetProjection(p Projection) {
+	st.projection = p
+}
+
+// SetTiling repeats the shader over the canvas according to the tiling. It
+// should be called before the environment is used to render.
+func (st *ShaderToy) SetTiling(t Tiling) {
+	st.tiling = t
+}
+
+// SetOutputs makes the environment write the specified outputs in addition to
+// the color of each pixel. The values are taken from the shady_fragDepth and
+// shady_fragMotion variables, which may be set by mainImage. OutputColor
+// repeats the color written by mainImage.
+func (st *ShaderToy) SetOutputs(outputs ...renderer.Output) {
+	st.outputs = outputs
+}
+
 func (st ShaderToy) Sources() (map[renderer.Stage][]renderer.Source, error) {
 	return map[renderer.Stage][]renderer.Source{
 		renderer.StageVertex: {renderer.SourceBuf(fmt.Sprintf(`
@@ -85,26 +123,32 @@ func (st ShaderToy) Sources() (map[renderer.Stage][]renderer.Source, error) {
 				uniform vec3 iResolution;
 				uniform float iTime;
 				uniform float iTimeDelta;
-				uniform float iFrame;
+				uniform %s iFrame;
 				uniform float iChannelTime[4];
 				uniform vec4 iMouse;
 				uniform vec4 iDate;
 				uniform float iSampleRate;
 				uniform vec3 iChannelResolution[4];
-			`, st.glslVersion)))
+				uniform int iEye;
+				uniform mat4 iEyeOffset;
+				uniform vec2 iEyeOrigin;
+				uniform int iSample;
+				uniform int iSampleCount;
+				uniform vec2 iJitter;
+				float shady_fragDepth = 1.0;
+				vec2 shady_fragMotion = vec2(0.0);
+			`, st.glslVersion, st.frameType())))
 			for _, res := range st.resources {
 				ss = append(ss, renderer.SourceBuf(res.UniformSource()))
 			}
 			for _, s := range st.shaderSources {
 				ss = append(ss, s)
 			}
-			ss = append(ss, renderer.SourceBuf(`
-				void main(void) {
-					vec2 pos = gl_FragCoord.xy;
-					pos.y = iResolution.y - pos.y - 1;
-					mainImage(gl_FragColor, pos);
-				}
-			`))
+			if st.sampleRate > 0 {
+				ss = append(ss, renderer.SourceBuf(soundMainSource()))
+			} else {
+				ss = append(ss, renderer.SourceBuf(st.projection.mainSource(st.outputs, st.tiling)))
+			}
 			return ss
 		}(),
 	}, nil
@@ -115,12 +159,21 @@ func (st *ShaderToy) Setup(state renderer.RenderState) error {
 		return fmt.Errorf("double call to ShaderToy.Setup")
 	}
 	for _, mapping := range st.mappings {
-		res, err := mapping.resource(state)
+		var res Resource
+		var err error
+		if mapping.Namespace == "pass" {
+			res, err = st.passResource(mapping, state)
+		} else {
+			res, err = mapping.resource(state)
+		}
 		if err != nil {
 			return err
 		}
 		st.resources = append(st.resources, res)
 	}
+	if st.compat {
+		st.resources = append(st.resources, st.emptyChannels()...)
+	}
 	// If no mappings are found, we're good to go. If iChannels are referenced
 	// anyway we'll let OpenGL decide if we should abort.
 	return nil
@@ -130,15 +183,28 @@ func (st ShaderToy) SubEnvironments() (map[string]renderer.SubEnvironment, error
 	envs := map[string]renderer.SubEnvironment{}
 	for _, res := range st.resources {
 		if bi, ok := res.(*bufferImage); ok {
-			env, err := NewShaderToy(bi.sources, nil, st.glslVersion)
+			env, err := NewShaderToy(bi.sources, bi.mappings, st.glslVersion)
 			if err != nil {
 				return nil, err
 			}
-			envs[bi.name] = renderer.SubEnvironment{
+			env.passes = st.passes
+			env.compat = st.compat
+			sub := renderer.SubEnvironment{
 				Environment: env,
 				Width:       bi.width,
 				Height:      bi.height,
+				RenderEvery: bi.schedule.every,
+				RenderOnce:  bi.schedule.once,
+				RenderOn:    bi.schedule.on,
+				Scale:       bi.scale,
+			}
+			if bi.pass != "" {
+				// A pass that is sampled by several passes is rendered once
+				// per frame. Passes sized relative to differently sized
+				// canvases are distinct buffers.
+				sub.ID = fmt.Sprintf("pass:%s@%dx%d", bi.pass, bi.width, bi.height)
 			}
+			envs[bi.name] = sub
 		}
 	}
 	return envs, nil
@@ -147,7 +213,8 @@ func (st ShaderToy) SubEnvironments() (map[string]renderer.SubEnvironment, error
 func (st ShaderToy) PreRender(state renderer.RenderState) {
 	// https://shadertoyunofficial.wordpress.com/2016/07/20/special-shadertoy-features/
 	if loc, ok := state.Uniforms["iResolution"]; ok {
-		gl.Uniform3f(loc.Location, float32(state.CanvasWidth), float32(state.CanvasHeight), 0.0)
+		tiles := float32(st.tiling.tiles())
+		gl.Uniform3f(loc.Location, float32(state.CanvasWidth)/tiles, float32(state.CanvasHeight)/tiles, 0.0)
 	}
 	if loc, ok := state.Uniforms["iTime"]; ok {
 		gl.Uniform1f(loc.Location, float32(state.Time)/float32(time.Second))
@@ -155,6 +222,16 @@ func (st ShaderToy) PreRender(state renderer.RenderState) {
 	if loc, ok := state.Uniforms["iTimeDelta"]; ok {
 		gl.Uniform1f(loc.Location, float32(state.Interval)/float32(time.Second))
 	}
+	if loc, ok := state.Uniforms["iSampleRate"]; ok {
+		rate := st.sampleRate
+		if rate == 0 {
+			rate = 44100
+		}
+		gl.Uniform1f(loc.Location, float32(rate))
+	}
+	if st.sampleRate > 0 {
+		st.soundPreRender(state)
+	}
 	if loc, ok := state.Uniforms["iDate"]; ok {
 		t := time.Now()
 		sinceMidnight := t.Sub(t.Truncate(time.Hour * 24))
@@ -166,7 +243,48 @@ func (st ShaderToy) PreRender(state renderer.RenderState) {
 		)
 	}
 	if loc, ok := state.Uniforms["iFrame"]; ok {
-		gl.Uniform1f(loc.Location, float32(state.FramesProcessed))
+		if loc.Type == gl.INT {
+			gl.Uniform1i(loc.Location, int32(state.FramesProcessed))
+		} else {
+			gl.Uniform1f(loc.Location, float32(state.FramesProcessed))
+		}
+	}
+	if loc, ok := state.Uniforms["iMouse"]; ok && state.Mouse != nil {
+		// The sign of z tells whether the button is down and that of w
+		// whether it was pressed this frame.
+		m := state.Mouse
+		z, w := m.ClickX, m.ClickY
+		if !m.Down {
+			z = -z
+		}
+		if !m.Clicked {
+			w = -w
+		}
+		gl.Uniform4f(loc.Location, m.DragX, m.DragY, z, w)
+	}
+	if loc, ok := state.Uniforms["iSample"]; ok {
+		gl.Uniform1i(loc.Location, int32(state.Sample))
+	}
+	if loc, ok := state.Uniforms["iSampleCount"]; ok {
+		gl.Uniform1i(loc.Location, int32(state.Samples))
+	}
+	if loc, ok := state.Uniforms["iJitter"]; ok {
+		gl.Uniform2f(loc.Location, state.Jitter[0], state.Jitter[1])
+	}
+	eye := state.Eye
+	if eye == nil {
+		eye = &renderer.Eye{
+			Offset: [16]float32{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1},
+		}
+	}
+	if loc, ok := state.Uniforms["iEye"]; ok {
+		gl.Uniform1i(loc.Location, int32(eye.Index))
+	}
+	if loc, ok := state.Uniforms["iEyeOffset"]; ok {
+		gl.UniformMatrix4fv(loc.Location, 1, false, &eye.Offset[0])
+	}
+	if loc, ok := state.Uniforms["iEyeOrigin"]; ok {
+		gl.Uniform2f(loc.Location, float32(eye.X), float32(eye.Y))
 	}
 	for _, resource := range st.resources {
 		resource.PreRender(state)
@@ -199,6 +317,10 @@ type Mapping struct {
 	Namespace string
 	Value     string
 	PWD       string
+
+	// templateData is the template data of the source declaring the
+	// mapping, which is passed on to the sources of buffers.
+	templateData interface{}
 }
 
 func ParseMapping(str, pwd string) (Mapping, error) {
@@ -224,10 +346,11 @@ func extractMappings(shaderSources []renderer.SourceFile) ([]Mapping, error) {
 		matches := inputMappingSourceRe.FindAllSubmatch(src, -1)
 		for _, match := range matches {
 			mappings = append(mappings, Mapping{
-				Name:      string(match[1]),
-				Namespace: string(match[2]),
-				Value:     string(match[3]),
-				PWD:       s.Dir(),
+				Name:         string(match[1]),
+				Namespace:    string(match[2]),
+				Value:        string(match[3]),
+				PWD:          s.Dir(),
+				templateData: s.TemplateData,
 			})
 		}
 	}
@@ -255,14 +378,38 @@ func (m Mapping) resource(state renderer.RenderState) (Resource, error) {
 	if !ok {
 		return nil, fmt.Errorf("don't know how to map %s", m.Namespace)
 	}
-	genTexID := func() uint32 {
-		id := texIndexEnum
-		texIndexEnum++
-		return id
-	}
 	return fn(m, genTexID, state)
 }
 
+// passResource instantiates a mapping of a pass of the pipeline as a buffer.
+func (st *ShaderToy) passResource(m Mapping, state renderer.RenderState) (Resource, error) {
+	pass, ok := st.passes[m.Value]
+	if !ok {
+		return nil, fmt.Errorf("unknown pass %q", m.Value)
+	}
+	width, height, scale, err := parseBufferSize(pass.Size, state.CanvasWidth, state.CanvasHeight)
+	if err != nil {
+		return nil, fmt.Errorf("pass %q: %w", pass.Name, err)
+	}
+	return &bufferImage{
+		name:     m.Name,
+		index:    genTexID(),
+		width:    width,
+		height:   height,
+		scale:    scale,
+		sources:  pass.Sources,
+		mappings: passMappings(pass.Channels, pass.Name),
+		pass:     pass.Name,
+		schedule: bufferSchedule{every: pass.Every, once: pass.Once, on: pass.On},
+	}, nil
+}
+
+func genTexID() uint32 {
+	id := texIndexEnum
+	texIndexEnum++
+	return id
+}
+
 func ResolvePath(pwd, path string) (string, error) {
 	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
 		return "", fmt.Errorf("URLs are not supported")
@@ -0,0 +1,76 @@
+package shadertoy
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// The size of the canvas sound shaders should be rendered to. Like on
+// Shadertoy, every pixel holds a sample, so a frame holds a block of 262144
+// samples.
+const (
+	SoundBlockWidth  = 512
+	SoundBlockHeight = 512
+)
+
+// SetSound makes the environment render the mainSound function of a Shadertoy
+// sound shader at the sample rate instead of an image:
+//
+//	vec2 mainSound(int samp, float time)
+//
+// Every frame renders the next block of samples, which can be converted to
+// audio with DecodeSound. The offset of the block is available to the shader
+// as iBlockOffset in seconds and as iSampleOffset in samples.
+func (st *ShaderToy) SetSound(sampleRate int) {
+	st.sampleRate = sampleRate
+}
+
+// soundMainSource returns the source of the main function that calls the
+// entrypoint of a sound shader. The left and right channel are stored as
+// unsigned 16 bit values in the red and green, and blue and alpha channels
+// respectively, with the low byte first.
+func soundMainSource() string {
+	return `
+		uniform float iBlockOffset;
+		uniform int iSampleOffset;
+
+		void main(void) {
+			ivec2 p = ivec2(gl_FragCoord.xy);
+			int samp = p.y * int(iResolution.x) + p.x;
+			vec2 s = mainSound(iSampleOffset + samp, iBlockOffset + float(samp) / iSampleRate);
+			vec2 v = floor((clamp(s, -1.0, 1.0) * 0.5 + 0.5) * 65535.0 + 0.5);
+			vec2 hi = floor(v / 256.0);
+			vec2 lo = v - hi * 256.0;
+			gl_FragColor = vec4(lo.x, hi.x, lo.y, hi.y) / 255.0;
+		}
+	`
+}
+
+func (st ShaderToy) soundPreRender(state renderer.RenderState) {
+	offset := int(state.FramesProcessed) * int(state.CanvasWidth*state.CanvasHeight)
+	if loc, ok := state.Uniforms["iSampleOffset"]; ok {
+		gl.Uniform1i(loc.Location, int32(offset))
+	}
+	if loc, ok := state.Uniforms["iBlockOffset"]; ok {
+		gl.Uniform1f(loc.Location, float32(float64(offset)/float64(st.sampleRate)))
+	}
+}
+
+// DecodeSound converts a frame rendered by a sound shader to interleaved
+// stereo samples.
+func DecodeSound(img *image.RGBA) ([]int16, error) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if img.Stride != w*4 {
+		return nil, fmt.Errorf("unexpected stride of sound frame: %d", img.Stride)
+	}
+	samples := make([]int16, w*h*2)
+	for i := range samples {
+		v := int(img.Pix[i*2]) | int(img.Pix[i*2+1])<<8
+		samples[i] = int16(v - 32768)
+	}
+	return samples, nil
+}
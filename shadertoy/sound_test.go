@@ -0,0 +1,22 @@
+package shadertoy
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeSound(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	copy(img.Pix, []byte{
+		0x00, 0x80, 0xff, 0xff,
+		0x00, 0x00, 0x01, 0x80,
+	})
+	samples, err := DecodeSound(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []int16{0, 32767, -32768, 1}; !reflect.DeepEqual(samples, exp) {
+		t.Fatalf("unexpected samples: %v", samples)
+	}
+}
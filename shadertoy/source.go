@@ -0,0 +1,132 @@
+package shadertoy
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// A ChannelSource provides images to shaders without having to deal with
+// OpenGL. The images are uploaded to a texture that is available to the
+// shader as a sampler2D with the name of the mapping, along with a vec3
+// <name>Size uniform, like the textures of the "image" namespace.
+//
+// ChannelSource is the stable interface to implement for new input devices.
+// Implementations that need more control over OpenGL may implement Resource
+// instead.
+type ChannelSource interface {
+	// Image is called before every frame is rendered and returns the latest
+	// image of the source, or nil if it has not changed since the previous
+	// call. Errors are logged and the previous image remains in use.
+	//
+	// Image is called from the rendering thread and should not block.
+	Image(state renderer.RenderState) (image.Image, error)
+	Close() error
+}
+
+// OpenChannelSourceFunc creates a ChannelSource for a mapping.
+type OpenChannelSourceFunc func(m Mapping) (ChannelSource, error)
+
+// RegisterChannelSource makes a ChannelSource available to mappings in the
+// namespace.
+func RegisterChannelSource(namespace string, open OpenChannelSourceFunc) {
+	RegisterResourceType(namespace, func(m Mapping, genTexID GenTexFunc, _ renderer.RenderState) (Resource, error) {
+		src, err := open(m)
+		if err != nil {
+			return nil, err
+		}
+		tex := &sourceTexture{
+			source:      src,
+			uniformName: m.Name,
+			index:       genTexID(),
+		}
+		gl.GenTextures(1, &tex.id)
+		return tex, nil
+	})
+}
+
+// ResourceTypes returns the namespaces for which resources are registered.
+func ResourceTypes() []string {
+	names := make([]string, 0, len(resourceBuilders))
+	for name := range resourceBuilders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sourceTexture is a Resource that uploads the images of a ChannelSource.
+type sourceTexture struct {
+	source      ChannelSource
+	uniformName string
+	id          uint32
+	index       uint32
+	rect        image.Rectangle
+	lastErr     string
+}
+
+func (tex *sourceTexture) UniformSource() string {
+	return fmt.Sprintf(`
+		uniform sampler2D %s;
+		uniform vec3 %sSize;
+	`, tex.uniformName, tex.uniformName)
+}
+
+func (tex *sourceTexture) PreRender(state renderer.RenderState) {
+	img, err := tex.source.Image(state)
+	if err != nil {
+		// Sources that keep failing should not flood the log.
+		if err.Error() != tex.lastErr {
+			state.Logger.Printf("Error reading %s: %v", tex.uniformName, err)
+			tex.lastErr = err.Error()
+		}
+	} else if img != nil {
+		tex.lastErr = ""
+		tex.upload(img)
+	}
+
+	if loc, ok := state.Uniforms[tex.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + tex.index)
+		gl.BindTexture(gl.TEXTURE_2D, tex.id)
+		gl.Uniform1i(loc.Location, int32(tex.index))
+	}
+	if m := IchannelNumRe.FindStringSubmatch(tex.uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
+			gl.Uniform3f(loc.Location, float32(tex.rect.Dx()), float32(tex.rect.Dy()), 1.0)
+		}
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", tex.uniformName)]; ok {
+		gl.Uniform3f(loc.Location, float32(tex.rect.Dx()), float32(tex.rect.Dy()), 1.0)
+	}
+}
+
+func (tex *sourceTexture) upload(img image.Image) {
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Stride != 4*rgba.Rect.Dx() {
+		rgba = image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+		draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	if rgba.Rect.Size() == tex.rect.Size() {
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(rgba.Rect.Dx()), int32(rgba.Rect.Dy()), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
+	} else {
+		// The first image, or the source changed its resolution.
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(rgba.Rect.Dx()), int32(rgba.Rect.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+		tex.rect = rgba.Rect
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func (tex *sourceTexture) Close() error {
+	gl.DeleteTextures(1, &tex.id)
+	return tex.source.Close()
+}
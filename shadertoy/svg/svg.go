@@ -0,0 +1,162 @@
+// Package svg rasterizes SVG files into textures at the resolution of the
+// shader they are mapped into, so vector artwork stays crisp at any size.
+package svg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+var (
+	valueRe     = regexp.MustCompile(`^([^;]+)(?:;([^;]+))?$`)
+	absSizeRe   = regexp.MustCompile(`^(\d+)x(\d+)$`)
+	scaleSizeRe = regexp.MustCompile(`^(\d*\.?\d+)$`)
+)
+
+func init() {
+	shadertoy.RegisterResourceType("svg", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
+		match := valueRe.FindStringSubmatch(m.Value)
+		if match == nil {
+			return nil, fmt.Errorf("could not parse svg value: %q (format: %s)", m.Value, valueRe)
+		}
+		path, err := shadertoy.ResolvePath(m.PWD, match[1])
+		if err != nil {
+			return nil, err
+		}
+		fd, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		icon, err := oksvg.ReadIconStream(fd, oksvg.WarnErrorMode)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+			return nil, fmt.Errorf("%s: the image has no size", path)
+		}
+
+		tex := &svgTexture{
+			uniformName: m.Name,
+			index:       genTexID(),
+			icon:        icon,
+			scale:       1,
+		}
+		if size := match[2]; size != "" {
+			valid := false
+			if m := absSizeRe.FindStringSubmatch(size); m != nil {
+				w, _ := strconv.Atoi(m[1])
+				h, _ := strconv.Atoi(m[2])
+				tex.bounds = image.Pt(w, h)
+				valid = w > 0 && h > 0
+			} else if m := scaleSizeRe.FindStringSubmatch(size); m != nil {
+				tex.scale, _ = strconv.ParseFloat(m[1], 64)
+				valid = tex.scale > 0
+			}
+			if !valid {
+				return nil, fmt.Errorf("invalid svg size: %q (format: WxH or a scale factor)", size)
+			}
+		}
+
+		gl.GenTextures(1, &tex.id)
+		gl.BindTexture(gl.TEXTURE_2D, tex.id)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		return tex, nil
+	})
+}
+
+// svgTexture is an SVG image that is rasterized again whenever the size of
+// the canvas changes.
+type svgTexture struct {
+	uniformName string
+	id          uint32
+	index       uint32
+	icon        *oksvg.SvgIcon
+
+	// bounds is the absolute size the image is fit into. If zero, the size
+	// of the canvas multiplied by scale is used.
+	bounds image.Point
+	scale  float64
+	// canvas is the size of the canvas the image was last rasterized for.
+	canvas image.Point
+	rect   image.Rectangle
+}
+
+func (tex *svgTexture) UniformSource() string {
+	return fmt.Sprintf(`
+		uniform sampler2D %s;
+		uniform vec3 %sSize;
+	`, tex.uniformName, tex.uniformName)
+}
+
+func (tex *svgTexture) PreRender(state renderer.RenderState) {
+	if canvas := image.Pt(int(state.CanvasWidth), int(state.CanvasHeight)); canvas != tex.canvas {
+		tex.canvas = canvas
+		tex.rasterize()
+	}
+
+	if loc, ok := state.Uniforms[tex.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + tex.index)
+		gl.BindTexture(gl.TEXTURE_2D, tex.id)
+		gl.Uniform1i(loc.Location, int32(tex.index))
+	}
+	if m := shadertoy.IchannelNumRe.FindStringSubmatch(tex.uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
+			gl.Uniform3f(loc.Location, float32(tex.rect.Dx()), float32(tex.rect.Dy()), 1.0)
+		}
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", tex.uniformName)]; ok {
+		gl.Uniform3f(loc.Location, float32(tex.rect.Dx()), float32(tex.rect.Dy()), 1.0)
+	}
+}
+
+// rasterize renders the image into the texture at the largest size that fits
+// the bounds while keeping its aspect ratio.
+func (tex *svgTexture) rasterize() {
+	bounds := tex.bounds
+	if bounds == (image.Point{}) {
+		bounds = image.Pt(
+			int(math.Round(float64(tex.canvas.X)*tex.scale)),
+			int(math.Round(float64(tex.canvas.Y)*tex.scale)),
+		)
+	}
+	w, h := fitSize(tex.icon.ViewBox.W, tex.icon.ViewBox.H, bounds)
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	tex.icon.SetTarget(0, 0, float64(w), float64(h))
+	scanner := rasterx.NewScannerGV(w, h, img, img.Bounds())
+	tex.icon.Draw(rasterx.NewDasher(w, h, scanner), 1)
+
+	gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(w), int32(h), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	tex.rect = img.Rect
+}
+
+// fitSize returns the largest size with the aspect ratio of w:h that fits
+// in the bounds, which is at least 1x1.
+func fitSize(w, h float64, bounds image.Point) (int, int) {
+	scale := math.Min(float64(bounds.X)/w, float64(bounds.Y)/h)
+	fw := int(math.Max(1, math.Round(w*scale)))
+	fh := int(math.Max(1, math.Round(h*scale)))
+	return fw, fh
+}
+
+func (tex *svgTexture) Close() error {
+	gl.DeleteTextures(1, &tex.id)
+	return nil
+}
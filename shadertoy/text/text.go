@@ -0,0 +1,312 @@
+// Package text renders lines of text into a texture, so shaders can display
+// logs, chat messages or tickers.
+//
+// Mappings are formatted as "SOURCE;OPTION;OPTION...". The source is either
+// "-" for the standard input, or a file which is followed like tail -f does.
+// The texture holds the most recent lines, with the newest line at the bottom,
+// drawn in white on a transparent background so shaders are free to style
+// them. The options are:
+//
+//   - lines=N sets the number of lines in the texture, 16 by default.
+//   - width=PIXELS sets the width of the texture, 512 by default. Longer lines
+//     are wrapped.
+//   - size=POINTS sets the size of the font, 16 by default.
+//   - font=FILE uses a TrueType or OpenType font instead of Go Mono.
+package text
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// pollInterval is the interval at which followed files are checked for new
+// lines.
+const pollInterval = 100 * time.Millisecond
+
+func init() {
+	shadertoy.RegisterChannelSource("text", func(m shadertoy.Mapping) (shadertoy.ChannelSource, error) {
+		opts, err := parseValue(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		ttf := gomono.TTF
+		if opts.font != "" {
+			path, err := shadertoy.ResolvePath(m.PWD, opts.font)
+			if err != nil {
+				return nil, err
+			}
+			if ttf, err = os.ReadFile(path); err != nil {
+				return nil, err
+			}
+		}
+		f, err := opentype.Parse(ttf)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse font: %v", err)
+		}
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: opts.size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, err
+		}
+
+		src := &textSource{
+			face:    face,
+			opts:    opts,
+			changed: true,
+			closed:  make(chan struct{}),
+		}
+		if opts.source == "-" {
+			go src.readStdin()
+			return src, nil
+		}
+		path, err := shadertoy.ResolvePath(m.PWD, opts.source)
+		if err != nil {
+			face.Close()
+			return nil, err
+		}
+		fd, err := os.Open(path)
+		if err != nil {
+			face.Close()
+			return nil, err
+		}
+		go src.follow(fd)
+		return src, nil
+	})
+}
+
+type options struct {
+	source string
+	lines  int
+	width  int
+	size   float64
+	font   string
+}
+
+func parseValue(value string) (options, error) {
+	fields := strings.Split(value, ";")
+	opts := options{source: fields[0], lines: 16, width: 512, size: 16}
+	if opts.source == "" {
+		return opts, fmt.Errorf("missing text source in %q", value)
+	}
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return opts, fmt.Errorf("invalid text option: %q", f)
+		}
+		var err error
+		switch kv[0] {
+		case "lines":
+			opts.lines, err = strconv.Atoi(kv[1])
+			if err == nil && opts.lines <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "width":
+			opts.width, err = strconv.Atoi(kv[1])
+			if err == nil && opts.width <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "size":
+			opts.size, err = strconv.ParseFloat(kv[1], 64)
+			if err == nil && opts.size <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "font":
+			opts.font = kv[1]
+		default:
+			return opts, fmt.Errorf("unknown text option: %q (valid: lines, width, size, font)", kv[0])
+		}
+		if err != nil {
+			return opts, fmt.Errorf("invalid text option %q: %v", f, err)
+		}
+	}
+	return opts, nil
+}
+
+// textSource is a ChannelSource that draws the most recent lines read from a
+// file or the standard input.
+type textSource struct {
+	face   font.Face
+	opts   options
+	closed chan struct{}
+
+	lock    sync.Mutex
+	lines   []string
+	changed bool
+	err     error
+}
+
+func (src *textSource) addLine(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	line = strings.ReplaceAll(line, "\t", "    ")
+	src.lock.Lock()
+	defer src.lock.Unlock()
+	src.lines = append(src.lines, line)
+	// Only the lines that may still be visible are kept, assuming that every
+	// line fits on a line of the texture.
+	if n := len(src.lines); n > src.opts.lines {
+		src.lines = append(src.lines[:0], src.lines[n-src.opts.lines:]...)
+	}
+	src.changed = true
+}
+
+func (src *textSource) setErr(err error) {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+	src.err = err
+}
+
+func (src *textSource) readStdin() {
+	// Reading from stdin can not be interrupted, so the goroutine lingers
+	// after the source is closed.
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		select {
+		case <-src.closed:
+			return
+		default:
+		}
+		src.addLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		src.setErr(err)
+	}
+}
+
+// follow reads lines from the file as they are appended. If the file is
+// truncated, it is read again from the start.
+func (src *textSource) follow(fd *os.File) {
+	defer fd.Close()
+	rd := bufio.NewReader(fd)
+	var offset int64
+	var partial string
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		line, err := rd.ReadString('\n')
+		offset += int64(len(line))
+		if err == nil {
+			src.addLine(partial + line)
+			partial = ""
+			continue
+		}
+		// An incomplete line is completed by a later write.
+		partial += line
+		if err != io.EOF {
+			src.setErr(err)
+			return
+		}
+
+		select {
+		case <-src.closed:
+			return
+		case <-ticker.C:
+		}
+		if info, err := fd.Stat(); err == nil && info.Size() < offset {
+			if _, err := fd.Seek(0, io.SeekStart); err != nil {
+				src.setErr(err)
+				return
+			}
+			rd.Reset(fd)
+			offset, partial = 0, ""
+		}
+	}
+}
+
+func (src *textSource) Image(state renderer.RenderState) (image.Image, error) {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+	if src.err != nil {
+		err := src.err
+		src.err = nil
+		return nil, err
+	}
+	if !src.changed {
+		return nil, nil
+	}
+	src.changed = false
+	return render(src.face, src.lines, src.opts.lines, src.opts.width), nil
+}
+
+// render draws the last lines that fit in an image of numLines high, wrapping
+// lines that are wider than the image.
+func render(face font.Face, lines []string, numLines, width int) *image.RGBA {
+	var wrapped []string
+	for _, line := range lines {
+		wrapped = append(wrapped, wrap(face, line, width)...)
+	}
+	if len(wrapped) > numLines {
+		wrapped = wrapped[len(wrapped)-numLines:]
+	}
+
+	lineHeight := face.Metrics().Height.Ceil()
+	img := image.NewRGBA(image.Rect(0, 0, width, numLines*lineHeight))
+	d := font.Drawer{Dst: img, Src: image.NewUniform(color.White), Face: face}
+	// The newest line is at the bottom.
+	y := (numLines-len(wrapped))*lineHeight + face.Metrics().Ascent.Ceil()
+	for _, line := range wrapped {
+		d.Dot = fixed.P(0, y)
+		d.DrawString(line)
+		y += lineHeight
+	}
+	return img
+}
+
+// wrap splits a line into parts that are at most width pixels wide, breaking
+// at spaces where possible.
+func wrap(face font.Face, line string, width int) []string {
+	max := fixed.I(width)
+	var parts []string
+	for font.MeasureString(face, line) > max {
+		if _, size := utf8.DecodeRuneInString(line); size == len(line) {
+			// Not even a single character fits.
+			break
+		}
+		// Find the longest prefix that fits.
+		var w fixed.Int26_6
+		end, lastSpace := 0, -1
+		for i, r := range line {
+			adv, ok := face.GlyphAdvance(r)
+			if !ok {
+				adv, _ = face.GlyphAdvance('?')
+			}
+			if w+adv > max {
+				break
+			}
+			w += adv
+			if r == ' ' {
+				lastSpace = i
+			}
+			end = i + utf8.RuneLen(r)
+		}
+		if end == 0 {
+			// Put the character on a line of its own to make progress.
+			_, end = utf8.DecodeRuneInString(line)
+		} else if lastSpace > 0 {
+			end = lastSpace + 1
+		}
+		parts = append(parts, strings.TrimRight(line[:end], " "))
+		line = line[end:]
+	}
+	return append(parts, line)
+}
+
+func (src *textSource) Close() error {
+	close(src.closed)
+	return src.face.Close()
+}
@@ -0,0 +1,53 @@
+package text
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/basicfont"
+)
+
+func TestParseValue(t *testing.T) {
+	opts, err := parseValue("log.txt;lines=4;width=256;size=12;font=a.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := (options{source: "log.txt", lines: 4, width: 256, size: 12, font: "a.ttf"}); opts != exp {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	for _, invalid := range []string{"", "-;lines=0", "-;width", "-;color=red"} {
+		if _, err := parseValue(invalid); err == nil {
+			t.Fatalf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	// Characters of basicfont.Face7x13 are 7 pixels wide.
+	face := basicfont.Face7x13
+	tests := []struct {
+		line  string
+		width int
+		exp   []string
+	}{
+		{"hello", 70, []string{"hello"}},
+		{"hello world foo", 70, []string{"hello", "world foo"}},
+		{"abcdefghijkl", 35, []string{"abcde", "fghij", "kl"}},
+		{"ab", 3, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		if parts := wrap(face, tt.line, tt.width); strings.Join(parts, "|") != strings.Join(tt.exp, "|") {
+			t.Errorf("%q: exp %q, got %q", tt.line, tt.exp, parts)
+		}
+	}
+}
+
+func TestAddLine(t *testing.T) {
+	src := &textSource{opts: options{lines: 2}}
+	for _, line := range []string{"a\n", "b\r\n", "c\td"} {
+		src.addLine(line)
+	}
+	if strings.Join(src.lines, "|") != "b|c    d" {
+		t.Fatalf("unexpected lines: %q", src.lines)
+	}
+}
@@ -0,0 +1,37 @@
+package shadertoy
+
+import (
+	"fmt"
+)
+
+// Tiling repeats the output of a shader over the canvas, to check whether it
+// tiles seamlessly.
+type Tiling struct {
+	// Tiles is the number of times the shader is repeated horizontally and
+	// vertically. The coordinates and resolution seen by the shader are
+	// those of a single tile. Zero and one disable repetition.
+	Tiles int
+	// Offset shifts the coordinates by half a tile, so the edges of the
+	// tiles meet in the middle of the canvas where seams are easy to spot.
+	Offset bool
+}
+
+func (t Tiling) tiles() int {
+	if t.Tiles < 1 {
+		return 1
+	}
+	return t.Tiles
+}
+
+// wrapSource returns the statement that wraps the pixel position to the
+// coordinates of a tile.
+func (t Tiling) wrapSource() string {
+	if t.tiles() == 1 && !t.Offset {
+		return ""
+	}
+	offset := 0.0
+	if t.Offset {
+		offset = 0.5
+	}
+	return fmt.Sprintf("pos = mod(pos + iResolution.xy * %.1f, iResolution.xy);", offset)
+}
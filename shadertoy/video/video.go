@@ -1,6 +1,15 @@
+// Package video maps frames of video files to textures. Frames advance in
+// lockstep with the time of the animation, so footage can be post-processed
+// offline at any frame rate:
+//
+//	#pragma map iChannel0=video:footage.mkv
+//
+// The video is decoded with FFmpeg and loops. It is seeked if the animation
+// jumps back or far ahead in time.
 package video
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -18,14 +27,17 @@ import (
 	"github.com/polyfloyd/shady/shadertoy"
 )
 
+// maxSkip is the longest stretch of video that is decoded and discarded to
+// reach a frame ahead, instead of restarting the decoder at the frame.
+const maxSkip = 5 * time.Second
+
 func init() {
 	shadertoy.RegisterResourceType("video", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
 		path, err := shadertoy.ResolvePath(m.PWD, m.Value)
 		if err != nil {
 			return nil, err
 		}
-		r, err := newVideoTexture(m.Name, path, genTexID(), state.Time)
-		return r, err
+		return newVideoTexture(m.Name, path, genTexID())
 	})
 }
 
@@ -34,38 +46,47 @@ type videoTexture struct {
 	id          uint32
 	index       uint32
 
-	resolution        image.Rectangle
-	frameInterval     time.Duration
-	stream            <-chan interface{}
-	currentVideoFrame int
-
-	cancel func()
+	filename      string
+	resolution    image.Rectangle
+	frameInterval time.Duration
+	// duration is the length of the video, or 0 if it is unknown.
+	duration time.Duration
+
+	decoder *decoder
+	buf     []byte
+	// frame is the index of the frame in the texture, or -1 if there is
+	// none.
+	frame   int
+	lastErr string
 }
 
-func newVideoTexture(uniformName, filename string, texIndex uint32, currentTime time.Duration) (*videoTexture, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	resolution, interval, stream, err := decodeVideoFile(ctx, filename, currentTime)
+func newVideoTexture(uniformName, filename string, texIndex uint32) (*videoTexture, error) {
+	info, err := ffprobe(context.Background(), filename)
+	if err != nil {
+		return nil, err
+	}
+	resolution, err := info.VideoResolution()
 	if err != nil {
-		cancel()
 		return nil, err
 	}
+	interval := time.Second
+	if iv, err := info.VideoFrameInterval(); err == nil {
+		interval = iv
+	}
+	duration, _ := info.Duration()
 
 	vt := &videoTexture{
-		uniformName: uniformName,
-		index:       texIndex,
-
-		resolution:        resolution,
-		frameInterval:     interval,
-		stream:            stream,
-		currentVideoFrame: int(currentTime/interval) - 1,
-
-		cancel: cancel,
+		uniformName:   uniformName,
+		index:         texIndex,
+		filename:      filename,
+		resolution:    resolution,
+		frameInterval: interval,
+		duration:      duration,
+		buf:           make([]byte, resolution.Dx()*resolution.Dy()*4),
+		frame:         -1,
 	}
 	gl.GenTextures(1, &vt.id)
 	gl.BindTexture(gl.TEXTURE_2D, vt.id)
-
-	initialData := make([]byte, resolution.Dx()*resolution.Dy()*3)
 	gl.TexImage2D(
 		gl.TEXTURE_2D,          // target
 		0,                      // level
@@ -73,14 +94,15 @@ func newVideoTexture(uniformName, filename string, texIndex uint32, currentTime
 		int32(resolution.Dx()), // width
 		int32(resolution.Dy()), // height
 		0,                      // border
-		gl.RGB,                 // format
+		gl.RGBA,                // format
 		gl.UNSIGNED_BYTE,       // type
-		gl.Ptr(initialData[:]), // data
+		gl.Ptr(vt.buf),         // data
 	)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
 	return vt, nil
 }
 
@@ -93,127 +115,166 @@ func (vt *videoTexture) UniformSource() string {
 }
 
 func (vt *videoTexture) PreRender(state renderer.RenderState) {
-	nextFrameTime := time.Duration(vt.currentVideoFrame+1) * vt.frameInterval
-	if state.Time < nextFrameTime {
-		return
-	}
-	vt.currentVideoFrame++
-
-	var frame []byte
-	switch val := <-vt.stream; t := val.(type) {
-	case error:
-		return // TODO: Maybe do something with the error?
-	case []byte:
-		frame = t
-	case nil:
-		return // EOF
-	default:
-		panic(fmt.Sprintf("unreachable (%#v)", val))
+	frame, curTime := frameAt(state.Time, vt.frameInterval, vt.duration)
+	if frame != vt.frame {
+		if err := vt.seek(frame); err != nil {
+			// A video that keeps failing should not flood the log.
+			if err.Error() != vt.lastErr {
+				state.Logger.Printf("Error reading %s: %v", vt.uniformName, err)
+				vt.lastErr = err.Error()
+			}
+		} else {
+			vt.lastErr = ""
+			gl.BindTexture(gl.TEXTURE_2D, vt.id)
+			gl.TexSubImage2D(
+				gl.TEXTURE_2D,             // target,
+				0,                         // level,
+				0,                         // xoffset,
+				0,                         // yoffset,
+				int32(vt.resolution.Dx()), // width,
+				int32(vt.resolution.Dy()), // height,
+				gl.RGBA,                   // format,
+				gl.UNSIGNED_BYTE,          // type,
+				gl.Ptr(vt.buf),            // data
+			)
+			gl.BindTexture(gl.TEXTURE_2D, 0)
+		}
+		// The frame is not retried until the time reaches the next one.
+		vt.frame = frame
 	}
 
 	if loc, ok := state.Uniforms[vt.uniformName]; ok {
 		gl.ActiveTexture(gl.TEXTURE0 + vt.index)
 		gl.BindTexture(gl.TEXTURE_2D, vt.id)
-		gl.TexSubImage2D(
-			gl.TEXTURE_2D,             // target,
-			0,                         // level,
-			0,                         // xoffset,
-			0,                         // yoffset,
-			int32(vt.resolution.Dx()), // width,
-			int32(vt.resolution.Dy()), // height,
-			gl.RGB,                    // format,
-			gl.UNSIGNED_BYTE,          // type,
-			gl.Ptr(frame),             // data
-		)
 		gl.Uniform1i(loc.Location, int32(vt.index))
 	}
 	if m := shadertoy.IchannelNumRe.FindStringSubmatch(vt.uniformName); m != nil {
 		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
 			gl.Uniform3f(loc.Location, float32(vt.resolution.Dx()), float32(vt.resolution.Dy()), 1.0)
 		}
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelTime[%s]", m[1])]; ok {
+			gl.Uniform1f(loc.Location, float32(curTime.Seconds()))
+		}
 	}
 	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", vt.uniformName)]; ok {
 		gl.Uniform3f(loc.Location, float32(vt.resolution.Dx()), float32(vt.resolution.Dy()), 1.0)
 	}
-	if m := shadertoy.IchannelNumRe.FindStringSubmatch(vt.uniformName); m != nil {
-		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelTime[%s]", m[1])]; ok {
-			gl.Uniform1f(loc.Location, float32(state.Time)/float32(time.Second))
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sCurTime", vt.uniformName)]; ok {
+		gl.Uniform1f(loc.Location, float32(curTime.Seconds()))
+	}
+}
+
+// seek reads the frame into the buffer. Frames are decoded sequentially, the
+// decoder is restarted at the frame if it is behind or far ahead.
+func (vt *videoTexture) seek(frame int) error {
+	if vt.decoder != nil && (frame < vt.decoder.next || time.Duration(frame-vt.decoder.next)*vt.frameInterval > maxSkip) {
+		vt.decoder.close()
+		vt.decoder = nil
+	}
+	if vt.decoder == nil {
+		d, err := startDecoder(vt.filename, frame, vt.frameInterval, vt.resolution.Size())
+		if err != nil {
+			return err
 		}
+		vt.decoder = d
 	}
-	if loc, ok := state.Uniforms[fmt.Sprintf("%sCurTime", vt.uniformName)]; ok {
-		gl.Uniform1f(loc.Location, float32(state.Time)/float32(time.Second))
+	for vt.decoder.next <= frame {
+		if err := vt.decoder.read(vt.buf); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The duration is not exact, keep the last frame.
+				return nil
+			}
+			vt.decoder.close()
+			vt.decoder = nil
+			return err
+		}
 	}
+	return nil
 }
 
 func (vt *videoTexture) Close() error {
-	vt.cancel()
+	if vt.decoder != nil {
+		vt.decoder.close()
+	}
 	gl.DeleteTextures(1, &vt.id)
 	return nil
 }
 
-func decodeVideoFile(ctx context.Context, filename string, currentTime time.Duration) (image.Rectangle, time.Duration, <-chan interface{}, error) {
-	info, err := ffprobe(ctx, filename)
-	if err != nil {
-		return image.Rectangle{}, 0, nil, err
+// frameAt returns the index of the frame of a video that is shown at a time
+// of the animation and the time in the video. Videos of which the duration is
+// known loop.
+func frameAt(t, interval, duration time.Duration) (int, time.Duration) {
+	if duration > 0 {
+		t %= duration
+		if t < 0 {
+			t += duration
+		}
+	} else if t < 0 {
+		t = 0
 	}
-	resolution, err := info.VideoResolution()
-	if err != nil {
-		return image.Rectangle{}, 0, nil, err
+	return int(t / interval), t
+}
+
+// A decoder reads the frames of a video as RGBA with FFmpeg.
+type decoder struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	// next is the index of the frame that is read next.
+	next int
+	// err is returned by read after the video ended or failed.
+	err error
+}
+
+// startDecoder starts decoding at a frame. The frame rate is made constant,
+// so the index of a frame is its time divided by the interval.
+func startDecoder(filename string, frame int, interval time.Duration, size image.Point) (*decoder, error) {
+	d := &decoder{next: frame}
+	d.cmd = exec.Command(
+		"ffmpeg",
+		"-ss", fmt.Sprintf("%.6f", (time.Duration(frame)*interval).Seconds()),
+		"-i", filename,
+		"-an",
+		"-r", strconv.FormatFloat(float64(time.Second)/float64(interval), 'f', -1, 64),
+		"-vf", fmt.Sprintf("scale=%d:%d", size.X, size.Y),
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-loglevel", "error",
+		"-",
+	)
+	d.cmd.Stderr = &d.stderr
+	var err error
+	if d.stdout, err = d.cmd.StdoutPipe(); err != nil {
+		return nil, err
 	}
-	interval := time.Second
-	if iv, err := info.VideoFrameInterval(); err == nil {
-		interval = iv
+	if err := d.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start ffmpeg: %w", err)
 	}
+	return d, nil
+}
 
-	seekToOffset := time.Duration(0)
-	if duration, err := info.Duration(); err == nil {
-		seekToOffset = currentTime % duration
+// read reads the next frame into buf. io.EOF is returned at the end of the
+// video.
+func (d *decoder) read(buf []byte) error {
+	if d.err != nil {
+		return d.err
 	}
-
-	out := make(chan interface{}, 4)
-	go func() {
-		defer close(out)
-		for ctx.Err() == nil {
-			cmd := exec.CommandContext(
-				ctx,
-				"ffmpeg",
-				"-i", filename,
-				"-ss", fmt.Sprintf("%.2f", seekToOffset.Seconds()),
-				"-f", "rawvideo",
-				"-pix_fmt", "rgb24",
-				"-",
-			)
-			stdout, err := cmd.StdoutPipe()
-			if err != nil {
-				out <- err
-				return
-			}
-			if err := cmd.Start(); err != nil {
-				out <- err
-				return
-			}
-
-			for {
-				imgBuf := make([]byte, resolution.Dx()*resolution.Dy()*3)
-				if _, err := io.ReadFull(stdout, imgBuf); err != nil {
-					if errors.Is(err, io.EOF) {
-						out <- err
-					}
-					break
-				}
-				out <- imgBuf
-			}
-
-			if err := cmd.Wait(); err != nil {
-				out <- err
-				return
-			}
-
-			// Restart the next playback at the beginning.
-			seekToOffset = 0
+	if _, err := io.ReadFull(d.stdout, buf); err != nil {
+		d.err = io.EOF
+		if err := d.cmd.Wait(); err != nil {
+			d.err = fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(d.stderr.String()))
 		}
-	}()
-	return resolution, interval, out, nil
+		return d.err
+	}
+	d.next++
+	return nil
+}
+
+func (d *decoder) close() {
+	if d.err == nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+	}
 }
 
 type mediaInfo struct {
@@ -0,0 +1,29 @@
+package video
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrameAt(t *testing.T) {
+	interval := time.Second / 25
+	tests := []struct {
+		t, duration time.Duration
+		frame       int
+		curTime     time.Duration
+	}{
+		{0, 10 * time.Second, 0, 0},
+		{time.Second, 10 * time.Second, 25, time.Second},
+		{time.Second - time.Millisecond, 10 * time.Second, 24, time.Second - time.Millisecond},
+		{12 * time.Second, 10 * time.Second, 50, 2 * time.Second},
+		{-time.Second, 10 * time.Second, 225, 9 * time.Second},
+		{12 * time.Second, 0, 300, 12 * time.Second},
+		{-time.Second, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		frame, curTime := frameAt(tt.t, interval, tt.duration)
+		if frame != tt.frame || curTime != tt.curTime {
+			t.Errorf("%v of %v: expected frame %d at %v, got %d at %v", tt.t, tt.duration, tt.frame, tt.curTime, frame, curTime)
+		}
+	}
+}
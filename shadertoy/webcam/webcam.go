@@ -0,0 +1,182 @@
+// Package webcam captures live video from a camera, so shady can be used as a
+// real-time video effects processor:
+//
+//	#pragma map iChannel0=webcam:/dev/video0;1280x720@30
+//
+// The device is captured with FFmpeg through Video4Linux2 on Linux,
+// AVFoundation on macOS and DirectShow on Windows. Shaders use the most
+// recent frame, frames that arrive while a frame is rendered are skipped.
+package webcam
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterChannelSource("webcam", func(m shadertoy.Mapping) (shadertoy.ChannelSource, error) {
+		c, err := parseMappingValue(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		return open(c)
+	})
+}
+
+// config is the device and the video mode to capture.
+type config struct {
+	device        string
+	width, height int
+	framerate     int
+}
+
+var valueRe = regexp.MustCompile(`^([^;]*)(?:;(\d+)x(\d+)(?:@(\d+))?)?$`)
+
+func parseMappingValue(value string) (config, error) {
+	m := valueRe.FindStringSubmatch(value)
+	if m == nil {
+		return config{}, fmt.Errorf("could not parse webcam value: %q (format: DEVICE[;WxH[@FPS]])", value)
+	}
+	c := config{device: m[1], width: 640, height: 480}
+	if m[2] != "" {
+		c.width, _ = strconv.Atoi(m[2])
+		c.height, _ = strconv.Atoi(m[3])
+	}
+	if m[4] != "" {
+		c.framerate, _ = strconv.Atoi(m[4])
+	}
+	if c.width == 0 || c.height == 0 {
+		return config{}, fmt.Errorf("invalid webcam resolution: %dx%d", c.width, c.height)
+	}
+	return c, nil
+}
+
+// ffmpegArgs returns the arguments to capture the camera as raw RGBA frames
+// of the configured size.
+func (c config) ffmpegArgs() ([]string, error) {
+	args := []string{"-loglevel", "error"}
+	size := fmt.Sprintf("%dx%d", c.width, c.height)
+	device := c.device
+	switch runtime.GOOS {
+	case "darwin":
+		if device == "" {
+			device = "0"
+		}
+		args = append(args, "-f", "avfoundation", "-video_size", size)
+		if c.framerate != 0 {
+			args = append(args, "-framerate", strconv.Itoa(c.framerate))
+		}
+		args = append(args, "-i", device+":none")
+	case "windows":
+		if device == "" {
+			return nil, fmt.Errorf("the name of the camera must be specified on Windows")
+		}
+		args = append(args, "-f", "dshow", "-video_size", size)
+		if c.framerate != 0 {
+			args = append(args, "-framerate", strconv.Itoa(c.framerate))
+		}
+		args = append(args, "-i", "video="+device)
+	default:
+		if device == "" {
+			device = "/dev/video0"
+		}
+		args = append(args, "-f", "v4l2", "-video_size", size)
+		if c.framerate != 0 {
+			args = append(args, "-framerate", strconv.Itoa(c.framerate))
+		}
+		args = append(args, "-i", device)
+	}
+	// The camera may not honor the requested size, so the frames are scaled
+	// to make sure they have the size that is read.
+	return append(args,
+		"-vf", fmt.Sprintf("scale=%d:%d", c.width, c.height),
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-",
+	), nil
+}
+
+// webcamSource is a ChannelSource of the frames captured by ffmpeg.
+type webcamSource struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+
+	lock    sync.Mutex
+	img     *image.RGBA
+	version uint64
+	err     error
+	// read is the version of the last image returned by Image.
+	read uint64
+}
+
+func open(c config) (*webcamSource, error) {
+	args, err := c.ffmpegArgs()
+	if err != nil {
+		return nil, err
+	}
+	src := &webcamSource{cmd: exec.Command("ffmpeg", args...)}
+	src.cmd.Stderr = &src.stderr
+	if src.stdout, err = src.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := src.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start ffmpeg: %w", err)
+	}
+	go src.capture(c.width, c.height)
+	return src, nil
+}
+
+// capture reads frames until ffmpeg exits.
+func (src *webcamSource) capture(width, height int) {
+	for {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		if _, err := io.ReadFull(src.stdout, img.Pix); err != nil {
+			break
+		}
+		src.lock.Lock()
+		src.img = img
+		src.version++
+		src.lock.Unlock()
+	}
+	err := src.cmd.Wait()
+	src.lock.Lock()
+	defer src.lock.Unlock()
+	if msg := strings.TrimSpace(src.stderr.String()); msg != "" {
+		src.err = fmt.Errorf("ffmpeg: %s", msg)
+	} else if err != nil {
+		src.err = fmt.Errorf("ffmpeg: %w", err)
+	} else {
+		src.err = fmt.Errorf("the camera stopped")
+	}
+}
+
+func (src *webcamSource) Image(state renderer.RenderState) (image.Image, error) {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+	if src.err != nil {
+		return nil, src.err
+	}
+	if src.img == nil || src.version == src.read {
+		return nil, nil
+	}
+	src.read = src.version
+	return src.img, nil
+}
+
+func (src *webcamSource) Close() error {
+	src.cmd.Process.Kill()
+	src.stdout.Close()
+	return nil
+}
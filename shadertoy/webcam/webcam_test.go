@@ -0,0 +1,30 @@
+package webcam
+
+import (
+	"testing"
+)
+
+func TestParseMappingValue(t *testing.T) {
+	tests := []struct {
+		value string
+		exp   config
+	}{
+		{"", config{width: 640, height: 480}},
+		{"/dev/video2", config{device: "/dev/video2", width: 640, height: 480}},
+		{"/dev/video0;1280x720", config{device: "/dev/video0", width: 1280, height: 720}},
+		{"FaceTime HD Camera;1920x1080@30", config{device: "FaceTime HD Camera", width: 1920, height: 1080, framerate: 30}},
+	}
+	for _, tt := range tests {
+		c, err := parseMappingValue(tt.value)
+		if err != nil {
+			t.Errorf("%q: %v", tt.value, err)
+		} else if c != tt.exp {
+			t.Errorf("%q: expected %+v, got %+v", tt.value, tt.exp, c)
+		}
+	}
+	for _, value := range []string{"/dev/video0;0x720", "/dev/video0;720p"} {
+		if _, err := parseMappingValue(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
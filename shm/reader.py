@@ -0,0 +1,84 @@
+#!/usr/bin/env python3
+"""Reference reader for the shared memory frame buffers written by shady.
+
+See the documentation of the Go package for a description of the protocol.
+Without arguments, this prints the number of every new frame. With -o, the
+latest frame is written to a raw RGBA file.
+
+    shady -i shader.glsl -g 640x480 -f 30 -ofmt shm -o shady
+    python3 reader.py shady
+"""
+
+import argparse
+import mmap
+import os
+import struct
+import time
+
+HEADER = struct.Struct('<4sIIIIIII QQQ8x')
+SLOT_ENTRY = struct.Struct('<QQ16x')
+HEADER_SIZE = 64
+OFF_SEQUENCE = 48
+FLAG_CLOSED = 1
+
+
+class Reader:
+    def __init__(self, name):
+        path = name if '/' in name else os.path.join('/dev/shm', name)
+        with open(path, 'rb') as f:
+            self.mem = mmap.mmap(f.fileno(), 0, mmap.MAP_SHARED, mmap.PROT_READ)
+        (magic, version, self.width, self.height, fmt, self.slots,
+         self.stride, _flags, self.slot_size, self.data, _seq) = HEADER.unpack_from(self.mem)
+        if magic != b'SHDY':
+            raise ValueError('%s is not a frame buffer' % name)
+        if version != 1 or fmt != 0:
+            raise ValueError('unsupported version or pixel format')
+
+    def sequence(self):
+        return struct.unpack_from('<Q', self.mem, OFF_SEQUENCE)[0]
+
+    def closed(self):
+        return struct.unpack_from('<I', self.mem, 28)[0] & FLAG_CLOSED != 0
+
+    def latest(self):
+        """Returns (sequence, unix_nanoseconds, rgba_bytes) or None."""
+        while True:
+            seq = self.sequence()
+            if seq == 0:
+                return None
+            slot = (seq - 1) % self.slots
+            entry = HEADER_SIZE + slot * SLOT_ENTRY.size
+            slot_seq, timestamp = SLOT_ENTRY.unpack_from(self.mem, entry)
+            if slot_seq != seq:
+                continue
+            start = self.data + slot * self.slot_size
+            pixels = self.mem[start:start + self.stride * self.height]
+            # Retry if the writer has overwritten the slot in the meantime.
+            if SLOT_ENTRY.unpack_from(self.mem, entry)[0] == seq:
+                return seq, timestamp, pixels
+
+
+def main():
+    parser = argparse.ArgumentParser(description=__doc__.splitlines()[0])
+    parser.add_argument('name')
+    parser.add_argument('-o', dest='output', help='write the latest frame to this file and exit')
+    args = parser.parse_args()
+
+    r = Reader(args.name)
+    print('%dx%d, %d slots' % (r.width, r.height, r.slots))
+    last = 0
+    while not r.closed():
+        frame = r.latest()
+        if frame is None or frame[0] == last:
+            time.sleep(0.001)
+            continue
+        last = frame[0]
+        if args.output:
+            with open(args.output, 'wb') as f:
+                f.write(frame[2])
+            return
+        print('frame %d, %.1fms old' % (frame[0], (time.time_ns() - frame[1]) / 1e6))
+
+
+if __name__ == '__main__':
+    main()
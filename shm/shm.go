@@ -0,0 +1,363 @@
+// Package shm implements a ring buffer of frames in POSIX shared memory, which
+// allows processes on the same machine to consume rendered frames without
+// copying them through a socket or pipe.
+//
+// The segment consists of a header, a slot table and the slots holding the
+// pixel data. All integers are little-endian.
+//
+//	Offset  Size  Field
+//	0       4     magic, "SHDY"
+//	4       4     version, currently 1
+//	8       4     width in pixels
+//	12      4     height in pixels
+//	16      4     pixel format, 0 = RGBA with 8 bits per channel
+//	20      4     number of slots
+//	24      4     stride, the number of bytes per row
+//	28      4     flags, bit 0 is set when the writer has closed the buffer
+//	32      8     size of a slot in bytes
+//	40      8     offset of the first slot
+//	48      8     sequence number of the latest complete frame, 0 if none
+//	56      8     reserved
+//	64      32*n  slot table, one entry per slot:
+//	              8  sequence number of the frame in the slot, 0 while writing
+//	              8  time at which the frame was written, in Unix nanoseconds
+//	              16 reserved
+//
+// Frames are numbered from 1. Frame n is stored in slot (n-1) % slots, rows
+// from top to bottom. Slots are aligned to the page size.
+//
+// The writer clears the sequence number of a slot, writes the pixels, stores
+// the sequence number of the frame in the slot table and then publishes it in
+// the header. Readers load the sequence number from the header, copy the
+// pixels from its slot and check that the sequence number of the slot has not
+// changed in the meantime. If it has, the writer overtook the reader and the
+// read should be retried.
+package shm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Dir is the directory in which shared memory objects are created on Linux.
+var Dir = "/dev/shm"
+
+const (
+	magic   = "SHDY"
+	version = 1
+
+	headerSize    = 64
+	slotEntrySize = 32
+	pageSize      = 4096
+
+	offMagic      = 0
+	offVersion    = 4
+	offWidth      = 8
+	offHeight     = 12
+	offFormat     = 16
+	offSlots      = 20
+	offStride     = 24
+	offFlags      = 28
+	offSlotSize   = 32
+	offData       = 40
+	offSequence   = 48
+	flagClosed    = 1
+	formatRGBA8   = 0
+	bytesPerPixel = 4
+)
+
+var (
+	// ErrNoFrame is returned by a Reader when no frame has been written yet.
+	ErrNoFrame = errors.New("shm: no frame has been written yet")
+	// ErrClosed is returned by a Reader when the writer has closed the
+	// buffer.
+	ErrClosed = errors.New("shm: the writer has closed the buffer")
+)
+
+// path returns the filename of the shared memory object. Names containing a
+// slash are regarded as paths.
+func path(name string) string {
+	if strings.ContainsRune(name, '/') {
+		return name
+	}
+	return filepath.Join(Dir, name)
+}
+
+func align(n, to uint64) uint64 {
+	return (n + to - 1) / to * to
+}
+
+// segment is a mapped shared memory object.
+type segment struct {
+	mem []byte
+}
+
+func (s segment) u32(off int) uint32 {
+	return binary.LittleEndian.Uint32(s.mem[off:])
+}
+
+func (s segment) u64(off int) uint64 {
+	return binary.LittleEndian.Uint64(s.mem[off:])
+}
+
+func (s segment) putU32(off int, v uint32) {
+	binary.LittleEndian.PutUint32(s.mem[off:], v)
+}
+
+func (s segment) putU64(off int, v uint64) {
+	binary.LittleEndian.PutUint64(s.mem[off:], v)
+}
+
+// The sequence numbers are accessed atomically. This relies on the host
+// being little-endian, like the protocol.
+func (s segment) loadSeq(off int) uint64 {
+	return atomic.LoadUint64((*uint64)(unsafe.Pointer(&s.mem[off])))
+}
+
+func (s segment) storeSeq(off int, v uint64) {
+	atomic.StoreUint64((*uint64)(unsafe.Pointer(&s.mem[off])), v)
+}
+
+func slotEntry(i int) int {
+	return headerSize + i*slotEntrySize
+}
+
+// A Writer writes frames to a shared memory ring buffer.
+type Writer struct {
+	segment
+	file   string
+	width  int
+	height int
+	slots  int
+	seq    uint64
+}
+
+// Create creates a shared memory ring buffer with the specified name and
+// number of slots for frames of the specified size. An existing buffer with
+// the same name is replaced.
+func Create(name string, width, height, slots int) (*Writer, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("shm: invalid size: %dx%d", width, height)
+	}
+	if slots < 1 {
+		return nil, fmt.Errorf("shm: at least one slot is required")
+	}
+	stride := uint64(width * bytesPerPixel)
+	slotSize := align(stride*uint64(height), pageSize)
+	dataOffset := align(headerSize+uint64(slots)*slotEntrySize, pageSize)
+	size := dataOffset + slotSize*uint64(slots)
+
+	file := path(name)
+	// Replace rather than truncate the object, so readers that still have
+	// the previous one mapped are not affected.
+	os.Remove(file)
+	fd, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	if err := fd.Truncate(int64(size)); err != nil {
+		os.Remove(file)
+		return nil, err
+	}
+	mem, err := syscall.Mmap(int(fd.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		os.Remove(file)
+		return nil, err
+	}
+
+	w := &Writer{
+		segment: segment{mem: mem},
+		file:    file,
+		width:   width,
+		height:  height,
+		slots:   slots,
+	}
+	copy(w.mem[offMagic:], magic)
+	w.putU32(offVersion, version)
+	w.putU32(offWidth, uint32(width))
+	w.putU32(offHeight, uint32(height))
+	w.putU32(offFormat, formatRGBA8)
+	w.putU32(offSlots, uint32(slots))
+	w.putU32(offStride, uint32(stride))
+	w.putU64(offSlotSize, slotSize)
+	w.putU64(offData, dataOffset)
+	return w, nil
+}
+
+// Write stores the image in the next slot and publishes it. Images of a
+// different size are cropped or padded.
+func (w *Writer) Write(img image.Image) error {
+	if w.mem == nil {
+		return ErrClosed
+	}
+	seq := w.seq + 1
+	slot := int((seq - 1) % uint64(w.slots))
+	entry := slotEntry(slot)
+	start := w.u64(offData) + uint64(slot)*w.u64(offSlotSize)
+	stride := w.width * bytesPerPixel
+	dst := &image.RGBA{
+		Pix:    w.mem[start : start+uint64(stride*w.height)],
+		Stride: stride,
+		Rect:   image.Rect(0, 0, w.width, w.height),
+	}
+
+	w.storeSeq(entry, 0)
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect == dst.Rect && rgba.Stride == stride {
+		copy(dst.Pix, rgba.Pix)
+	} else {
+		draw.Draw(dst, dst.Rect, image.Transparent, image.Point{}, draw.Src)
+		draw.Draw(dst, dst.Rect, img, img.Bounds().Min, draw.Src)
+	}
+	w.putU64(entry+8, uint64(time.Now().UnixNano()))
+	w.storeSeq(entry, seq)
+	w.storeSeq(offSequence, seq)
+	w.seq = seq
+	return nil
+}
+
+// Close marks the buffer as closed, unmaps it and removes its name. Readers
+// that have it mapped can continue to read the last frames.
+func (w *Writer) Close() error {
+	if w.mem == nil {
+		return nil
+	}
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(&w.mem[offFlags])), flagClosed)
+	err := syscall.Munmap(w.mem)
+	w.mem = nil
+	if rmErr := os.Remove(w.file); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// A Frame is a frame read from a ring buffer.
+type Frame struct {
+	// Sequence is the number of the frame, starting at 1.
+	Sequence uint64
+	// Time is the time at which the frame was written.
+	Time  time.Time
+	Image *image.RGBA
+}
+
+// A Reader reads frames from a shared memory ring buffer.
+type Reader struct {
+	segment
+	width, height int
+	slots         int
+}
+
+// Open maps the shared memory ring buffer with the specified name.
+func Open(name string) (*Reader, error) {
+	fd, err := os.Open(path(name))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < headerSize {
+		return nil, fmt.Errorf("shm: %s is not a frame buffer", name)
+	}
+	mem, err := syscall.Mmap(int(fd.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{segment: segment{mem: mem}}
+	if string(r.mem[offMagic:offMagic+4]) != magic {
+		r.Close()
+		return nil, fmt.Errorf("shm: %s is not a frame buffer", name)
+	}
+	if v := r.u32(offVersion); v != version {
+		r.Close()
+		return nil, fmt.Errorf("shm: unsupported version: %d", v)
+	}
+	if f := r.u32(offFormat); f != formatRGBA8 {
+		r.Close()
+		return nil, fmt.Errorf("shm: unsupported pixel format: %d", f)
+	}
+	r.width = int(r.u32(offWidth))
+	r.height = int(r.u32(offHeight))
+	r.slots = int(r.u32(offSlots))
+	end := r.u64(offData) + r.u64(offSlotSize)*uint64(r.slots)
+	if r.slots < 1 || end > uint64(len(r.mem)) {
+		r.Close()
+		return nil, fmt.Errorf("shm: %s is truncated", name)
+	}
+	return r, nil
+}
+
+// Size returns the size of the frames in the buffer.
+func (r *Reader) Size() (width, height int) {
+	return r.width, r.height
+}
+
+// Sequence returns the number of the latest frame, or 0 if no frame has been
+// written yet. It can be used to poll for new frames cheaply.
+func (r *Reader) Sequence() uint64 {
+	return r.loadSeq(offSequence)
+}
+
+// Closed reports whether the writer has closed the buffer.
+func (r *Reader) Closed() bool {
+	return atomic.LoadUint32((*uint32)(unsafe.Pointer(&r.mem[offFlags])))&flagClosed != 0
+}
+
+// Latest copies the latest frame into dst, which is allocated if nil.
+func (r *Reader) Latest(dst *image.RGBA) (Frame, error) {
+	if dst == nil || dst.Rect.Dx() != r.width || dst.Rect.Dy() != r.height {
+		dst = image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+	}
+	stride := r.width * bytesPerPixel
+	for {
+		seq := r.Sequence()
+		if seq == 0 {
+			if r.Closed() {
+				return Frame{}, ErrClosed
+			}
+			return Frame{}, ErrNoFrame
+		}
+		slot := int((seq - 1) % uint64(r.slots))
+		entry := slotEntry(slot)
+		start := r.u64(offData) + uint64(slot)*r.u64(offSlotSize)
+		timestamp := r.u64(entry + 8)
+		if r.loadSeq(entry) != seq {
+			continue
+		}
+		for y := 0; y < r.height; y++ {
+			src := r.mem[start+uint64(y*stride):]
+			copy(dst.Pix[y*dst.Stride:y*dst.Stride+stride], src[:stride])
+		}
+		if r.loadSeq(entry) != seq {
+			// The writer has overwritten the slot while it was being read.
+			continue
+		}
+		return Frame{
+			Sequence: seq,
+			Time:     time.Unix(0, int64(timestamp)),
+			Image:    dst,
+		}, nil
+	}
+}
+
+// Close unmaps the buffer.
+func (r *Reader) Close() error {
+	if r.mem == nil {
+		return nil
+	}
+	err := syscall.Munmap(r.mem)
+	r.mem = nil
+	return err
+}
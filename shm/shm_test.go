@@ -0,0 +1,51 @@
+package shm
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "frames")
+	w, err := Create(name, 3, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	r, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := r.Latest(nil); err != ErrNoFrame {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+		img.Set(1, 1, color.RGBA{R: uint8(i), A: 255})
+		if err := w.Write(img); err != nil {
+			t.Fatal(err)
+		}
+		frame, err := r.Latest(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.Sequence != uint64(i) {
+			t.Fatalf("unexpected sequence: exp %d, got %d", i, frame.Sequence)
+		}
+		if c := frame.Image.RGBAAt(1, 1); c.R != uint8(i) {
+			t.Fatalf("unexpected pixel in frame %d: %v", i, c)
+		}
+	}
+
+	if r.Closed() {
+		t.Fatalf("buffer closed before the writer was closed")
+	}
+	w.Close()
+	if !r.Closed() {
+		t.Fatalf("buffer not closed after the writer was closed")
+	}
+}
@@ -0,0 +1,316 @@
+// Package spherical injects the metadata that marks a video as 360° content
+// into MP4 and MOV files, so video platforms and players display it as a
+// panorama instead of a flat equirectangular image.
+//
+// The metadata follows version 1 of Google's Spherical Video RFC, which is
+// an XML document in a uuid box in the video track:
+// https://github.com/google/spatial-media/blob/master/docs/spherical-video-rfc.md
+package spherical
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StereoMode is the layout of the eyes of stereoscopic video.
+type StereoMode string
+
+const (
+	StereoMono      StereoMode = "mono"
+	StereoTopBottom StereoMode = "top-bottom"
+	StereoLeftRight StereoMode = "left-right"
+)
+
+var sphericalUUID = [16]byte{0xff, 0xcc, 0x82, 0x63, 0xf8, 0x55, 0x4a, 0x93, 0x88, 0x14, 0x58, 0x7a, 0x02, 0x52, 0x1f, 0xdd}
+
+// Metadata describes a spherical video. Only the equirectangular projection
+// is supported.
+type Metadata struct {
+	Stereo StereoMode
+	// Software is the name of the program that created the video.
+	Software string
+}
+
+func (m Metadata) xml() []byte {
+	stereo := m.Stereo
+	if stereo == "" {
+		stereo = StereoMono
+	}
+	return []byte(fmt.Sprintf(`<?xml version="1.0"?>`+
+		`<rdf:SphericalVideo xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:GSpherical="http://ns.google.com/videos/1.0/spherical/">`+
+		`<GSpherical:Spherical>true</GSpherical:Spherical>`+
+		`<GSpherical:Stitched>true</GSpherical:Stitched>`+
+		`<GSpherical:StitchingSoftware>%s</GSpherical:StitchingSoftware>`+
+		`<GSpherical:ProjectionType>equirectangular</GSpherical:ProjectionType>`+
+		`<GSpherical:StereoMode>%s</GSpherical:StereoMode>`+
+		`</rdf:SphericalVideo>`, m.Software, stereo))
+}
+
+func (m Metadata) box() []byte {
+	xml := m.xml()
+	box := make([]byte, 8, 24+len(xml))
+	binary.BigEndian.PutUint32(box, uint32(24+len(xml)))
+	copy(box[4:], "uuid")
+	box = append(box, sphericalUUID[:]...)
+	return append(box, xml...)
+}
+
+// A box is an atom of an ISO base media file.
+type box struct {
+	typ string
+	// offset is the position of the header of the box, relative to the
+	// start of the data it was read from.
+	offset int64
+	// headerSize is 8, or 16 for boxes with a 64 bit size.
+	headerSize int64
+	size       int64
+}
+
+func (b box) end() int64 {
+	return b.offset + b.size
+}
+
+// readBox reads the header of the box at the offset. end is the end of the
+// parent.
+func readBox(r io.ReaderAt, offset, end int64) (box, error) {
+	var header [16]byte
+	if _, err := r.ReadAt(header[:8], offset); err != nil {
+		return box{}, err
+	}
+	b := box{
+		typ:        string(header[4:8]),
+		offset:     offset,
+		headerSize: 8,
+		size:       int64(binary.BigEndian.Uint32(header[:4])),
+	}
+	switch b.size {
+	case 0:
+		// The box extends to the end of its parent.
+		b.size = end - offset
+	case 1:
+		if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+			return box{}, err
+		}
+		b.headerSize = 16
+		b.size = int64(binary.BigEndian.Uint64(header[8:16]))
+	}
+	if b.size < b.headerSize || b.end() > end {
+		return box{}, fmt.Errorf("invalid size of %q box at %d", b.typ, offset)
+	}
+	return b, nil
+}
+
+// children reads the headers of the boxes contained by the parent.
+func children(r io.ReaderAt, parent box) ([]box, error) {
+	var boxes []box
+	for offset := parent.offset + parent.headerSize; offset < parent.end(); {
+		b, err := readBox(r, offset, parent.end())
+		if err != nil {
+			return nil, err
+		}
+		boxes = append(boxes, b)
+		offset = b.end()
+	}
+	return boxes, nil
+}
+
+func find(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// InjectMP4 copies an MP4 or MOV file of the size from r to w, adding the
+// spherical metadata to its video track.
+func InjectMP4(r io.ReaderAt, size int64, w io.Writer, meta Metadata) error {
+	root := box{offset: 0, size: size}
+	top, err := children(r, root)
+	if err != nil {
+		return err
+	}
+	moovBox, ok := find(top, "moov")
+	if !ok {
+		return errors.New("no moov box found, is this an MP4 file?")
+	}
+
+	// The moov box is small compared to the media, so it is edited in
+	// memory with the offsets of its boxes relative to its start.
+	moovBuf := make([]byte, moovBox.size)
+	if _, err := r.ReadAt(moovBuf, moovBox.offset); err != nil {
+		return err
+	}
+	moovR := bytes.NewReader(moovBuf)
+	moov := moovBox
+	moov.offset = 0
+	traks, err := children(moovR, moov)
+	if err != nil {
+		return err
+	}
+
+	var video *box
+	for i, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+		isVideo, hasMeta, err := inspectTrak(moovR, trak)
+		if err != nil {
+			return err
+		}
+		if hasMeta {
+			return errors.New("the video already contains spherical metadata")
+		}
+		if isVideo {
+			video = &traks[i]
+			break
+		}
+	}
+	if video == nil {
+		return errors.New("no video track found")
+	}
+
+	inject := meta.box()
+	grow := int64(len(inject))
+	// If the media data follows the moov box, it moves along with the
+	// growth of the moov box and the offsets to it must be updated.
+	var shift int64
+	if mdat, ok := find(top, "mdat"); ok && mdat.offset > moovBox.offset {
+		shift = grow
+	}
+	if shift != 0 {
+		for _, trak := range traks {
+			if trak.typ == "trak" {
+				if err := shiftChunkOffsets(moovBuf, trak, shift); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	newMoov := make([]byte, 0, len(moovBuf)+len(inject))
+	newMoov = append(newMoov, moovBuf[:video.end()]...)
+	newMoov = append(newMoov, inject...)
+	newMoov = append(newMoov, moovBuf[video.end():]...)
+	if err := setSize(newMoov, moov, moov.size+grow); err != nil {
+		return err
+	}
+	if err := setSize(newMoov, *video, video.size+grow); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, io.NewSectionReader(r, 0, moovBox.offset)); err != nil {
+		return err
+	}
+	if _, err := w.Write(newMoov); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, io.NewSectionReader(r, moovBox.end(), size-moovBox.end()))
+	return err
+}
+
+// inspectTrak reports whether the track is a video track and whether it
+// already has spherical metadata.
+func inspectTrak(r io.ReaderAt, trak box) (isVideo, hasMeta bool, err error) {
+	boxes, err := children(r, trak)
+	if err != nil {
+		return false, false, err
+	}
+	for _, b := range boxes {
+		if b.typ == "uuid" {
+			var uuid [16]byte
+			if _, err := r.ReadAt(uuid[:], b.offset+b.headerSize); err != nil {
+				return false, false, err
+			}
+			hasMeta = hasMeta || uuid == sphericalUUID
+		}
+	}
+	mdia, ok := find(boxes, "mdia")
+	if !ok {
+		return false, hasMeta, nil
+	}
+	mdiaBoxes, err := children(r, mdia)
+	if err != nil {
+		return false, false, err
+	}
+	hdlr, ok := find(mdiaBoxes, "hdlr")
+	if !ok {
+		return false, hasMeta, nil
+	}
+	// The handler type follows the version, flags and pre-defined fields.
+	var handler [4]byte
+	if _, err := r.ReadAt(handler[:], hdlr.offset+hdlr.headerSize+8); err != nil {
+		return false, false, err
+	}
+	return string(handler[:]) == "vide", hasMeta, nil
+}
+
+// shiftChunkOffsets adds the shift to the chunk offsets in the stco or co64
+// box of the track.
+func shiftChunkOffsets(buf []byte, trak box, shift int64) error {
+	r := bytes.NewReader(buf)
+	path := []string{"mdia", "minf", "stbl"}
+	parent := trak
+	for _, typ := range path {
+		boxes, err := children(r, parent)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if parent, ok = find(boxes, typ); !ok {
+			// Tracks without a sample table have no offsets.
+			return nil
+		}
+	}
+	boxes, err := children(r, parent)
+	if err != nil {
+		return err
+	}
+	for _, b := range boxes {
+		if b.typ != "stco" && b.typ != "co64" {
+			continue
+		}
+		// Entries follow the version, flags and entry count.
+		start := b.offset + b.headerSize + 8
+		if start > b.end() {
+			return fmt.Errorf("invalid %s box", b.typ)
+		}
+		count := int64(binary.BigEndian.Uint32(buf[start-4 : start]))
+		entrySize := int64(4)
+		if b.typ == "co64" {
+			entrySize = 8
+		}
+		if start+count*entrySize > b.end() {
+			return fmt.Errorf("invalid %s box", b.typ)
+		}
+		for i := int64(0); i < count; i++ {
+			p := buf[start+i*entrySize:]
+			if b.typ == "co64" {
+				binary.BigEndian.PutUint64(p, uint64(int64(binary.BigEndian.Uint64(p))+shift))
+				continue
+			}
+			v := int64(binary.BigEndian.Uint32(p)) + shift
+			if v > 0xffffffff {
+				return errors.New("the chunk offsets overflow, the file is too large")
+			}
+			binary.BigEndian.PutUint32(p, uint32(v))
+		}
+	}
+	return nil
+}
+
+func setSize(buf []byte, b box, size int64) error {
+	if b.headerSize == 16 {
+		binary.BigEndian.PutUint64(buf[b.offset+8:], uint64(size))
+		return nil
+	}
+	if size > 0xffffffff {
+		return fmt.Errorf("the %s box is too large", b.typ)
+	}
+	binary.BigEndian.PutUint32(buf[b.offset:], uint32(size))
+	return nil
+}
@@ -0,0 +1,85 @@
+package spherical
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func mkbox(typ string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+func TestInjectMP4(t *testing.T) {
+	stco := func(offset uint32) []byte {
+		b := make([]byte, 12)
+		binary.BigEndian.PutUint32(b[4:], 1)
+		binary.BigEndian.PutUint32(b[8:], offset)
+		return mkbox("stco", b)
+	}
+	hdlr := func(handler string) []byte {
+		b := make([]byte, 24)
+		copy(b[8:], handler)
+		return mkbox("hdlr", b)
+	}
+	trak := func(handler string, offset uint32) []byte {
+		return mkbox("trak", mkbox("mdia", hdlr(handler), mkbox("minf", mkbox("stbl", stco(offset)))))
+	}
+	ftyp := mkbox("ftyp", []byte("isom"))
+	// The size of the moov box does not depend on the offsets.
+	moovSize := len(mkbox("moov", trak("soun", 0), trak("vide", 0)))
+	mdatOffset := uint32(len(ftyp) + moovSize + 8)
+	file := bytes.Join([][]byte{
+		ftyp,
+		mkbox("moov", trak("soun", mdatOffset), trak("vide", mdatOffset+5)),
+		mkbox("mdat", []byte("audiovideo")),
+	}, nil)
+
+	var out bytes.Buffer
+	meta := Metadata{Stereo: StereoTopBottom, Software: "shady"}
+	if err := InjectMP4(bytes.NewReader(file), int64(len(file)), &out, meta); err != nil {
+		t.Fatal(err)
+	}
+	result := out.Bytes()
+	grow := len(meta.box())
+	if len(result) != len(file)+grow {
+		t.Fatalf("unexpected size: %d", len(result))
+	}
+
+	r := bytes.NewReader(result)
+	top, err := children(r, box{size: int64(len(result))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moov, _ := find(top, "moov")
+	traks, err := children(r, moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traks) != 2 {
+		t.Fatalf("unexpected number of tracks: %d", len(traks))
+	}
+	if isVideo, hasMeta, _ := inspectTrak(r, traks[1]); !isVideo || !hasMeta {
+		t.Fatalf("the video track has no metadata")
+	}
+	if _, hasMeta, _ := inspectTrak(r, traks[0]); hasMeta {
+		t.Fatalf("the audio track has metadata")
+	}
+
+	// The chunk offsets must point to the moved media data.
+	for i, exp := range []string{"audio", "video"} {
+		stco := bytes.Index(result[traks[i].offset:traks[i].end()], []byte("stco"))
+		offset := binary.BigEndian.Uint32(result[traks[i].offset+int64(stco)+12:])
+		if got := string(result[offset : offset+5]); got != exp {
+			t.Fatalf("chunk offset of track %d points to %q", i, got)
+		}
+	}
+
+	if err := InjectMP4(bytes.NewReader(result), int64(len(result)), &out, meta); err == nil {
+		t.Fatalf("expected an error for a file that already has metadata")
+	}
+}
@@ -0,0 +1,77 @@
+package status
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// Environment displays a static image stretched over the whole canvas.
+type Environment struct {
+	img         *image.RGBA
+	glslVersion string
+	texture     uint32
+}
+
+// NewEnvironment creates an environment that displays the status screen.
+func NewEnvironment(s Screen, width, height uint, glslVersion string) (*Environment, error) {
+	img, err := s.Image(width, height)
+	if err != nil {
+		return nil, err
+	}
+	return &Environment{img: img, glslVersion: glslVersion}, nil
+}
+
+func (env *Environment) Sources() (map[renderer.Stage][]renderer.Source, error) {
+	return map[renderer.Stage][]renderer.Source{
+		renderer.StageVertex: {renderer.SourceBuf(fmt.Sprintf(`
+			#version %s
+			attribute vec3 vert;
+			varying vec2 texCoord;
+			void main(void) {
+				texCoord = vert.xy * .5 + .5;
+				gl_Position = vec4(vert, 1.0);
+			}
+		`, env.glslVersion))},
+		renderer.StageFragment: {renderer.SourceBuf(fmt.Sprintf(`
+			#version %s
+			varying vec2 texCoord;
+			uniform sampler2D screen;
+			void main(void) {
+				gl_FragColor = texture2D(screen, texCoord);
+			}
+		`, env.glslVersion))},
+	}, nil
+}
+
+func (env *Environment) Setup(state renderer.RenderState) error {
+	gl.GenTextures(1, &env.texture)
+	gl.BindTexture(gl.TEXTURE_2D, env.texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(env.img.Rect.Dx()), int32(env.img.Rect.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(env.img.Pix))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return nil
+}
+
+func (env *Environment) SubEnvironments() (map[string]renderer.SubEnvironment, error) {
+	return map[string]renderer.SubEnvironment{}, nil
+}
+
+func (env *Environment) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms["screen"]; ok {
+		gl.ActiveTexture(gl.TEXTURE0)
+		gl.BindTexture(gl.TEXTURE_2D, env.texture)
+		gl.Uniform1i(loc.Location, 0)
+	}
+}
+
+func (env *Environment) Close() error {
+	gl.DeleteTextures(1, &env.texture)
+	return nil
+}
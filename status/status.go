@@ -0,0 +1,192 @@
+// Package status renders a fallback screen that is shown in place of a shader
+// that failed to load. It shows the error along with the network information
+// of the host and a QR code linking to a control URL, so unattended
+// installations can be debugged by looking at the display.
+package status
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	background = color.RGBA{0x20, 0x20, 0x20, 0xff}
+	foreground = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	errorColor = color.RGBA{0xff, 0x60, 0x60, 0xff}
+)
+
+// A Screen describes the contents of a status screen.
+type Screen struct {
+	// Err is the error that caused the status screen to be shown.
+	Err error
+	// URL is encoded as a QR code if not empty.
+	URL string
+}
+
+// Image renders the status screen at the specified size.
+func (s Screen) Image(width, height uint) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	draw.Draw(img, img.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+
+	margin := int(height) / 20
+	textRight := int(width) - margin
+	if s.URL != "" {
+		qr, err := qrcode.New(s.URL, qrcode.Medium)
+		if err != nil {
+			return nil, err
+		}
+		bitmap := qr.Bitmap()
+		// Make the QR code as large as possible within the right half of
+		// the screen, in whole pixels per module to keep it readable.
+		scale := min(int(width)/2-margin, int(height)-margin*2) / len(bitmap)
+		if scale < 1 {
+			scale = 1
+		}
+		size := len(bitmap) * scale
+		x0, y0 := int(width)-margin-size, (int(height)-size)/2
+		for y, row := range bitmap {
+			for x, black := range row {
+				c := color.White
+				if black {
+					c = color.Black
+				}
+				r := image.Rect(x0+x*scale, y0+y*scale, x0+(x+1)*scale, y0+(y+1)*scale)
+				draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+			}
+		}
+		textRight = x0 - margin
+	}
+
+	f, err := opentype.Parse(gomono.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    float64(max(int(height)/30, 8)),
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	lineHeight := face.Metrics().Height.Ceil()
+	maxChars := (textRight - margin) / max(font.MeasureString(face, "M").Ceil(), 1)
+	d := font.Drawer{Dst: img, Face: face}
+	y := margin + face.Metrics().Ascent.Ceil()
+	writeLine := func(c color.Color, text string) {
+		for _, line := range wrap(text, maxChars) {
+			d.Src = image.NewUniform(c)
+			d.Dot = fixed.P(margin, y)
+			d.DrawString(line)
+			y += lineHeight
+		}
+	}
+
+	writeLine(foreground, "Shady: the shader could not be loaded")
+	y += lineHeight
+	if s.Err != nil {
+		writeLine(errorColor, s.Err.Error())
+		y += lineHeight
+	}
+	for _, line := range networkInfo() {
+		writeLine(foreground, line)
+	}
+	if s.URL != "" {
+		y += lineHeight
+		writeLine(foreground, s.URL)
+	}
+	return img, nil
+}
+
+// networkInfo describes the host name and addresses of the network
+// interfaces.
+func networkInfo() []string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = err.Error()
+	}
+	lines := []string{"Host: " + hostname}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return append(lines, err.Error())
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		var ips []string
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipnet.IP.String())
+			}
+		}
+		if len(ips) > 0 {
+			lines = append(lines, fmt.Sprintf("%s: %s", iface.Name, strings.Join(ips, ", ")))
+		}
+	}
+	return lines
+}
+
+// wrap splits text into lines of at most width characters.
+func wrap(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		var line []rune
+		for _, field := range strings.Fields(para) {
+			word := []rune(field)
+			for len(word) > width {
+				if len(line) > 0 {
+					lines = append(lines, string(line))
+					line = nil
+				}
+				lines = append(lines, string(word[:width]))
+				word = word[width:]
+			}
+			if len(line) == 0 {
+				line = word
+			} else if len(line)+1+len(word) <= width {
+				line = append(append(line, ' '), word...)
+			} else {
+				lines = append(lines, string(line))
+				line = word
+			}
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
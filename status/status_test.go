@@ -0,0 +1,27 @@
+package status
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	lines := wrap("the quick brown fox\njumps over thelazydog", 10)
+	exp := []string{"the quick", "brown fox", "jumps over", "thelazydog"}
+	if !reflect.DeepEqual(lines, exp) {
+		t.Fatalf("unexpected lines: exp %q, got %q", exp, lines)
+	}
+
+	lines = wrap("abcdefghijkl", 5)
+	exp = []string{"abcde", "fghij", "kl"}
+	if !reflect.DeepEqual(lines, exp) {
+		t.Fatalf("unexpected lines: exp %q, got %q", exp, lines)
+	}
+
+	// Lines are measured in characters, not bytes.
+	lines = wrap("élan éclat œuvres", 5)
+	exp = []string{"élan", "éclat", "œuvre", "s"}
+	if !reflect.DeepEqual(lines, exp) {
+		t.Fatalf("unexpected lines: exp %q, got %q", exp, lines)
+	}
+}
@@ -0,0 +1 @@
+#include "hash-include-cycle-a.glsl"
@@ -0,0 +1,3 @@
+float dep() {
+	return 1.0;
+}
@@ -0,0 +1,3 @@
+float broken() {
+	return undeclared;
+}
@@ -0,0 +1,4 @@
+void main() {
+	gl_Position = vec4(0.0);
+}
+#include "hash-include-error-dep.glsl"
@@ -0,0 +1 @@
+#include "lib/hash-include-use-dep.glsl"
@@ -0,0 +1,6 @@
+#include "hash-include-dep.glsl"
+#include "noise.glsl"
+
+float main2() {
+	return dep() + noise();
+}
@@ -0,0 +1 @@
+#pragma use "hash-include-use-lib.glsl"
@@ -0,0 +1 @@
+float lib() { return 1.0; }
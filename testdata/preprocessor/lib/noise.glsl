@@ -0,0 +1,4 @@
+// A library that is found through the include paths.
+float noise() {
+	return 0.5;
+}
@@ -0,0 +1,417 @@
+// Package zmq implements a ZeroMQ PUB socket, so frames can be published to
+// subscribers using any ZeroMQ implementation without depending on libzmq.
+//
+// Only the parts of ZMTP 3.0 that a publisher needs are implemented: the NULL
+// security mechanism, the TCP and IPC transports and subscriptions sent either
+// as messages (ZMTP 3.0) or as commands (ZMTP 3.1).
+package zmq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	flagMore    = 1
+	flagLong    = 2
+	flagCommand = 4
+
+	greetingSize     = 64
+	handshakeTimeout = 10 * time.Second
+	// maxCommandSize limits the size of the commands and subscriptions
+	// accepted from subscribers.
+	maxCommandSize = 64 << 10
+)
+
+// ParseEndpoint converts a ZeroMQ endpoint, e.g. "tcp://*:5556" or
+// "ipc:///tmp/shady", to a network and address that can be listened on.
+func ParseEndpoint(endpoint string) (network, address string, err error) {
+	i := strings.Index(endpoint, "://")
+	if i < 0 {
+		return "", "", fmt.Errorf("zmq: invalid endpoint: %q", endpoint)
+	}
+	transport, address := endpoint[:i], endpoint[i+3:]
+	switch transport {
+	case "tcp":
+		return "tcp", strings.Replace(address, "*", "", 1), nil
+	case "ipc":
+		return "unix", address, nil
+	default:
+		return "", "", fmt.Errorf("zmq: unsupported transport: %q", transport)
+	}
+}
+
+// A Publisher is a bound PUB socket. Messages are only sent to the
+// subscribers that have subscribed to a prefix of their first frame, the
+// topic. Like with libzmq, messages for subscribers that can not keep up are
+// dropped.
+type Publisher struct {
+	listener net.Listener
+	// highWaterMark is the number of messages queued for a subscriber.
+	highWaterMark int
+
+	lock    sync.Mutex
+	subs    map[*subscriber]struct{}
+	dropped bool
+}
+
+// Listen binds a publisher to the endpoint. highWaterMark is the number of
+// messages that may be queued for a subscriber before messages are dropped.
+func Listen(endpoint string, highWaterMark int) (*Publisher, error) {
+	network, address, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		// Like libzmq, replace sockets left behind by a previous process.
+		os.Remove(address)
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if highWaterMark < 1 {
+		highWaterMark = 1
+	}
+	p := &Publisher{
+		listener:      ln,
+		highWaterMark: highWaterMark,
+		subs:          map[*subscriber]struct{}{},
+	}
+	go p.accept()
+	return p, nil
+}
+
+// Addr returns the address the publisher is listening on.
+func (p *Publisher) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+func (p *Publisher) accept() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.serve(conn)
+	}
+}
+
+func (p *Publisher) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := handshake(conn, r); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	sub := &subscriber{
+		conn:   conn,
+		queue:  make(chan [][]byte, p.highWaterMark),
+		topics: map[string]int{},
+		done:   make(chan struct{}),
+	}
+	p.lock.Lock()
+	p.subs[sub] = struct{}{}
+	p.lock.Unlock()
+	defer func() {
+		p.lock.Lock()
+		delete(p.subs, sub)
+		p.lock.Unlock()
+		close(sub.done)
+	}()
+
+	go sub.write()
+	for {
+		body, flags, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		sub.handle(body, flags)
+	}
+}
+
+// Publish sends a message consisting of one or more frames to the subscribers
+// of its first frame.
+func (p *Publisher) Publish(frames ...[]byte) {
+	if len(frames) == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for sub := range p.subs {
+		if !sub.subscribed(frames[0]) {
+			continue
+		}
+		select {
+		case sub.queue <- frames:
+		default:
+			p.dropped = true
+		}
+	}
+}
+
+// Lagging reports whether a subscriber can not keep up: messages were dropped
+// since the last call, or a subscriber has at least half of its queue filled.
+func (p *Publisher) Lagging() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	lagging := p.dropped
+	p.dropped = false
+	for sub := range p.subs {
+		if n := len(sub.queue); n > 0 && n*2 >= cap(sub.queue) {
+			lagging = true
+		}
+	}
+	return lagging
+}
+
+// Close stops accepting subscribers and disconnects the current ones.
+func (p *Publisher) Close() error {
+	err := p.listener.Close()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for sub := range p.subs {
+		// This also stops the reader and writer of the subscriber.
+		sub.conn.Close()
+	}
+	return err
+}
+
+type subscriber struct {
+	conn  net.Conn
+	queue chan [][]byte
+	done  chan struct{}
+
+	lock   sync.Mutex
+	topics map[string]int
+}
+
+// handle processes a frame received from the subscriber.
+func (sub *subscriber) handle(body []byte, flags byte) {
+	var subscribe bool
+	var topic []byte
+	switch {
+	case flags&flagCommand != 0:
+		name, rest, err := parseCommand(body)
+		if err != nil {
+			return
+		}
+		switch name {
+		case "SUBSCRIBE":
+			subscribe, topic = true, rest
+		case "CANCEL":
+			subscribe, topic = false, rest
+		default:
+			// Other commands, like heartbeats, are ignored.
+			return
+		}
+	case len(body) > 0 && body[0] <= 1:
+		subscribe, topic = body[0] == 1, body[1:]
+	default:
+		return
+	}
+
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	if subscribe {
+		sub.topics[string(topic)]++
+	} else if sub.topics[string(topic)] > 1 {
+		sub.topics[string(topic)]--
+	} else {
+		delete(sub.topics, string(topic))
+	}
+}
+
+func (sub *subscriber) subscribed(topic []byte) bool {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	for prefix := range sub.topics {
+		if bytes.HasPrefix(topic, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sub *subscriber) write() {
+	// Closing the connection on errors also stops the reader.
+	defer sub.conn.Close()
+	w := bufio.NewWriter(sub.conn)
+	for {
+		select {
+		case frames := <-sub.queue:
+			for i, frame := range frames {
+				var flags byte
+				if i < len(frames)-1 {
+					flags |= flagMore
+				}
+				if err := writeFrame(w, flags, frame); err != nil {
+					return
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// handshake exchanges the greeting and READY commands with a subscriber.
+func handshake(conn net.Conn, r *bufio.Reader) error {
+	if _, err := conn.Write(greeting()); err != nil {
+		return err
+	}
+	peer := make([]byte, greetingSize)
+	if _, err := io.ReadFull(r, peer); err != nil {
+		return err
+	}
+	if peer[0] != 0xff || peer[9] != 0x7f {
+		return errors.New("zmq: invalid greeting")
+	}
+	if peer[10] < 3 {
+		return errors.New("zmq: ZMTP versions before 3.0 are not supported")
+	}
+	if mechanism := string(bytes.TrimRight(peer[12:32], "\x00")); mechanism != "NULL" {
+		return fmt.Errorf("zmq: unsupported security mechanism: %q", mechanism)
+	}
+
+	ready := readyCommand(map[string]string{"Socket-Type": "PUB"})
+	if err := writeFrame(conn, flagCommand, ready); err != nil {
+		return err
+	}
+	body, flags, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	if flags&flagCommand == 0 {
+		return errors.New("zmq: expected READY command")
+	}
+	name, props, err := parseCommand(body)
+	if err != nil {
+		return err
+	}
+	if name != "READY" {
+		return fmt.Errorf("zmq: expected READY command, got %s", name)
+	}
+	properties, err := parseProperties(props)
+	if err != nil {
+		return err
+	}
+	if typ := properties["Socket-Type"]; typ != "SUB" && typ != "XSUB" {
+		writeFrame(conn, flagCommand, errorCommand("invalid socket type"))
+		return fmt.Errorf("zmq: incompatible socket type: %q", typ)
+	}
+	return nil
+}
+
+func greeting() []byte {
+	g := make([]byte, greetingSize)
+	g[0] = 0xff
+	g[9] = 0x7f
+	g[10] = 3 // Major version.
+	g[11] = 0 // Minor version.
+	copy(g[12:32], "NULL")
+	return g
+}
+
+func readyCommand(properties map[string]string) []byte {
+	body := []byte("\x05READY")
+	for name, value := range properties {
+		body = append(body, byte(len(name)))
+		body = append(body, name...)
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(value)))
+		body = append(body, size[:]...)
+		body = append(body, value...)
+	}
+	return body
+}
+
+func errorCommand(reason string) []byte {
+	body := []byte("\x05ERROR")
+	body = append(body, byte(len(reason)))
+	return append(body, reason...)
+}
+
+func parseCommand(body []byte) (name string, data []byte, err error) {
+	if len(body) == 0 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("zmq: malformed command")
+	}
+	return string(body[1 : 1+body[0]]), body[1+body[0]:], nil
+}
+
+func parseProperties(data []byte) (map[string]string, error) {
+	props := map[string]string{}
+	for len(data) > 0 {
+		n := int(data[0])
+		if len(data) < 1+n+4 {
+			return nil, errors.New("zmq: malformed property")
+		}
+		name := string(data[1 : 1+n])
+		data = data[1+n:]
+		m := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint32(len(data)) < m {
+			return nil, errors.New("zmq: malformed property")
+		}
+		props[name] = string(data[:m])
+		data = data[m:]
+	}
+	return props, nil
+}
+
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+	var header []byte
+	if len(body) > 255 {
+		header = make([]byte, 9)
+		header[0] = flags | flagLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func readFrame(r *bufio.Reader) ([]byte, byte, error) {
+	flags, err := r.ReadByte()
+	if err != nil {
+		return nil, 0, err
+	}
+	var size uint64
+	if flags&flagLong != 0 {
+		var buf [8]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, 0, err
+		}
+		size = binary.BigEndian.Uint64(buf[:])
+	} else {
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+		size = uint64(n)
+	}
+	if size > maxCommandSize {
+		return nil, 0, fmt.Errorf("zmq: frame of %d bytes is too large", size)
+	}
+	body := make([]byte, size)
+	_, err = io.ReadFull(r, body)
+	return body, flags, err
+}
@@ -0,0 +1,135 @@
+package zmq
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialSubscriber connects a minimal SUB socket to the publisher.
+func dialSubscriber(t *testing.T, p *Publisher) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", p.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	conn.Write(greeting())
+	if _, err := io.ReadFull(r, make([]byte, greetingSize)); err != nil {
+		t.Fatal(err)
+	}
+	writeFrame(conn, flagCommand, readyCommand(map[string]string{"Socket-Type": "SUB"}))
+	body, _, err := readFrame(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, data, _ := parseCommand(body)
+	if props, _ := parseProperties(data); name != "READY" || props["Socket-Type"] != "PUB" {
+		t.Fatalf("unexpected READY command: %q", body)
+	}
+	return conn, r
+}
+
+// publishUntilReceived publishes a message until the subscriber has
+// processed its subscription and receives it.
+func publishUntilReceived(t *testing.T, p *Publisher, r *bufio.Reader, frames ...[]byte) [][]byte {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				p.Publish(frames...)
+			}
+		}
+	}()
+	var msg [][]byte
+	for {
+		body, flags, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg = append(msg, body)
+		if flags&flagMore == 0 {
+			return msg
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	p, err := Listen("tcp://127.0.0.1:0", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// ZMTP 3.0 subscription message.
+	conn, r := dialSubscriber(t, p)
+	defer conn.Close()
+	writeFrame(conn, 0, []byte("\x01sha"))
+	msg := publishUntilReceived(t, p, r, []byte("shady"), []byte("frame"))
+	if len(msg) != 2 || string(msg[0]) != "shady" || string(msg[1]) != "frame" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+
+	// ZMTP 3.1 subscription command, which should not receive messages of
+	// other topics.
+	conn2, r2 := dialSubscriber(t, p)
+	defer conn2.Close()
+	writeFrame(conn2, flagCommand, []byte("\x09SUBSCRIBEdepth"))
+	p.Publish([]byte("shady"), make([]byte, 1000))
+	msg = publishUntilReceived(t, p, r2, []byte("depth"), make([]byte, 1000))
+	if len(msg) != 2 || string(msg[0]) != "depth" || len(msg[1]) != 1000 {
+		t.Fatalf("unexpected message: %q", msg[0])
+	}
+}
+
+func TestLagging(t *testing.T) {
+	p, err := Listen("tcp://127.0.0.1:0", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	conn, r := dialSubscriber(t, p)
+	defer conn.Close()
+	writeFrame(conn, 0, []byte("\x01"))
+	publishUntilReceived(t, p, r, []byte("shady"), []byte("frame"))
+	time.Sleep(50 * time.Millisecond)
+	if p.Lagging() {
+		t.Fatalf("the subscriber is lagging before it stopped reading")
+	}
+
+	// The subscriber stops reading, so the buffers of the connection fill
+	// up.
+	frame := make([]byte, 1<<20)
+	for i := 0; ; i++ {
+		if i == 1000 {
+			t.Fatalf("the subscriber is not lagging")
+		}
+		p.Publish([]byte("shady"), frame)
+		if p.Lagging() {
+			break
+		}
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	for endpoint, exp := range map[string][2]string{
+		"tcp://*:5556":        {"tcp", ":5556"},
+		"tcp://127.0.0.1:123": {"tcp", "127.0.0.1:123"},
+		"ipc:///tmp/shady":    {"unix", "/tmp/shady"},
+	} {
+		network, address, err := ParseEndpoint(endpoint)
+		if err != nil || network != exp[0] || address != exp[1] {
+			t.Fatalf("unexpected result for %q: %q %q %v", endpoint, network, address, err)
+		}
+	}
+	if _, _, err := ParseEndpoint("inproc://foo"); err == nil {
+		t.Fatalf("expected an error for an unsupported transport")
+	}
+}